@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -67,6 +69,21 @@ func initDB() (*gorm.DB, error) {
 		&models.ProvisionedDatabase{},     // Database pooling
 		&models.SharedCacheInstance{},     // Cache pooling
 		&models.ProvisionedCacheConfig{},  // Cache pooling
+		&models.BackupDestination{},       // Volume backups
+		&models.BackupPolicy{},            // Volume backups
+		&models.BackupSnapshot{},          // Volume backups
+		&models.DeploymentHealthCheck{},   // Deployment health history
+		&models.RemediationPolicy{},       // Per-deployment self-healing policy
+		&models.DedicatedInstance{},       // Per-deployment database/cache containers
+		&models.DatabaseDump{},            // SQL dumps of provisioned databases
+		&models.DeploymentJob{},           // Durable deployment job queue
+		&models.DeploymentEvent{},         // Structured deployment history
+		&models.PortAllocation{},          // Port registry
+		&models.PortReservation{},         // Port registry
+		&models.DeploymentDependency{},    // Dependency graph edges
+		&models.Certificate{},             // Certificates issued by the homelab CA
+		&models.DNSProvider{},             // Local DNS servers
+		&models.DNSRecord{},               // DNS records managed for deployments
 	)
 	if err != nil {
 		return nil, err
@@ -151,14 +168,42 @@ func main() {
 	deviceScorer := services.NewDeviceScorer(db, sshClient)
 
 	// Initialize orchestrator based on infrastructure config
+	// It schedules application dependency stacks; apps and shared pools always run on Docker Compose
 	orchestratorConfig := infraConfig.GetOrchestratorConfig()
 	orchestrator := services.NewOrchestrator(orchestratorConfig, sshClient)
-	log.Printf("🐳 Container orchestrator initialized (mode: %s)", orchestratorConfig.Mode)
+	log.Printf("🐳 Stack orchestrator initialized (mode: %s)", orchestratorConfig.Mode)
 
 	// Initialize deployment service with intelligent orchestration and dependency auto-provisioning
-	deploymentService := services.NewDeploymentService(db, sshClient, recipeLoader, deviceService, credService, wsHub, infraConfig, orchestrator)
+	containers := services.NewDockerComposeOrchestrator(sshClient)
+	deploymentService := services.NewDeploymentService(db, sshClient, recipeLoader, deviceService, credService, wsHub, infraConfig, containers)
+	deploymentService.SetStackOrchestrator(orchestrator)
 	log.Printf("🧠 Intelligent orchestration enabled (device scoring + database pooling + dependency auto-provisioning)")
 
+	// Initialize backup service (snapshots deployment volumes per recipe backup metadata)
+	backupService := services.NewBackupService(db, sshClient, recipeLoader, wsHub)
+	deploymentService.SetBackupService(backupService)
+
+	// Initialize update checker (compares running image digests with their registries)
+	registryClient := services.NewDockerRegistryClient("./.cache/registry")
+	if insecure := os.Getenv("INSECURE_REGISTRIES"); insecure != "" {
+		for _, host := range strings.Split(insecure, ",") {
+			registryClient.AddInsecureRegistry(strings.TrimSpace(host))
+		}
+	}
+	updateChecker := services.NewUpdateCheckerService(db, sshClient, registryClient, deploymentService, recipeLoader, wsHub)
+
+	// Initialize deployment health monitor (probes each recipe's health endpoint)
+	deploymentHealthMonitor := services.NewDeploymentHealthMonitor(db, recipeLoader, wsHub)
+	deploymentHealthMonitor.SetEventService(deploymentService.Events())
+
+	// Initialize self-healing (restart -> redeploy -> fail for unhealthy deployments)
+	remediationService := services.NewRemediationService(db, containers, deploymentService, wsHub)
+
+	// Initialize live deployment log streaming (follows container logs while a WebSocket client is subscribed)
+	logStreamer := services.NewDeploymentLogStreamer(db, sshClient, wsHub)
+	wsHub.OnSubscriptionChange(services.DeploymentLogChannelPrefix, logStreamer.HandleSubscriptionChange)
+	wsHub.RestrictChannels(services.DeploymentLogChannelPrefix, services.MaxLogSubscriptionsPerClient)
+
 	// Initialize health check service
 	healthCheckService := services.NewHealthCheckService(db, sshClient, credService)
 	healthCheckService.SetDeviceService(deviceService)
@@ -177,6 +222,57 @@ func main() {
 	healthCheckService.Start(healthCtx)
 	log.Printf("🏥 Health check service started")
 
+	// Start backup scheduler
+	backupService.Start(context.Background())
+	log.Printf("💾 Backup scheduler started")
+
+	// Record the ports of deployments created before the port registry existed
+	if err := deploymentService.BackfillPortAllocations(); err != nil {
+		log.Printf("⚠️  Warning: Failed to record existing deployment ports: %v", err)
+	}
+
+	// Record the dependencies of deployments created before the dependency graph existed
+	if err := deploymentService.BackfillDependencyGraph(context.Background()); err != nil {
+		log.Printf("⚠️  Warning: Failed to record existing deployment dependencies: %v", err)
+	}
+
+	// Start deployment job queue (resumes or fails jobs interrupted by the last shutdown)
+	maxDeploymentJobs := 2
+	if v := os.Getenv("DEPLOYMENT_MAX_CONCURRENT_JOBS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxDeploymentJobs = n
+		} else {
+			log.Printf("⚠️  Invalid DEPLOYMENT_MAX_CONCURRENT_JOBS %q, using %d", v, maxDeploymentJobs)
+		}
+	}
+	if err := deploymentService.StartJobQueue(context.Background(), maxDeploymentJobs); err != nil {
+		log.Printf("⚠️  Warning: Failed to start deployment job queue: %v", err)
+	} else {
+		log.Printf("📋 Deployment job queue started (max %d concurrent jobs)", maxDeploymentJobs)
+	}
+
+	// Start deployment health monitor
+	deploymentHealthMonitor.Start(context.Background())
+	log.Printf("🩺 Deployment health monitor started")
+
+	// Start self-healing service
+	remediationService.Start(context.Background())
+	log.Printf("🩹 Self-healing service started")
+
+	// Start certificate renewal
+	deploymentService.Certificates().Start(context.Background())
+	log.Printf("🔐 Certificate renewal service started")
+
+	// Advertise running deployments over mDNS/DNS-SD (needs the server on the LAN, e.g. host networking)
+	if os.Getenv("MDNS_ADVERTISE") != "false" {
+		deploymentService.MDNS().Start()
+		log.Printf("📡 mDNS advertiser started")
+	}
+
+	// Start update checker
+	updateChecker.Start(context.Background())
+	log.Printf("🔄 Update checker started")
+
 	// Configure resource monitoring WebSocket broadcast
 	resourceMonitoring.SetBroadcastFunc(func(channel, event string, data interface{}) {
 		wsHub.Broadcast(channel, event, data)
@@ -250,8 +346,15 @@ func main() {
 	scannerHandler := api.NewScannerHandler(scannerService)
 	scannerHandler.RegisterRoutes(protectedGroup)
 
-	// Initialize database pool manager for aggregate resources (with infrastructure config and orchestrator)
-	dbPoolManager := services.NewDatabasePoolManager(db, sshClient, credService, infraConfig, orchestrator)
+	// Initialize database pool manager for aggregate resources (shared instances are Compose projects)
+	dbPoolManager := services.NewDatabasePoolManager(db, sshClient, credService, infraConfig, containers)
+
+	// Initialize database dumps (export/restore of provisioned databases)
+	dumpDir := os.Getenv("DATABASE_DUMP_DIR")
+	if dumpDir == "" {
+		dumpDir = "./data/database-dumps"
+	}
+	databaseDumpService := services.NewDatabaseDumpService(db, sshClient, dbPoolManager, backupService, wsHub, dumpDir)
 
 	// Register resource monitoring routes (with database pooling stats)
 	resourceHandler := api.NewResourceHandler(resourceMonitoring, dbPoolManager)
@@ -263,12 +366,34 @@ func main() {
 	volumeHandler := api.NewVolumeHandler(volumeService)
 	marketplaceHandler := api.NewMarketplaceHandler(marketplaceService, deviceScorer)
 	deploymentHandler := api.NewDeploymentHandler(deploymentService)
+	backupHandler := api.NewBackupHandler(backupService, deploymentService)
+	databaseDumpHandler := api.NewDatabaseDumpHandler(databaseDumpService)
+	deploymentHealthHandler := api.NewDeploymentHealthHandler(deploymentHealthMonitor)
+	deploymentEventHandler := api.NewDeploymentEventHandler(deploymentService.Events())
+	remediationHandler := api.NewRemediationHandler(remediationService)
+	adoptionHandler := api.NewAdoptionHandler(deploymentService)
+	portHandler := api.NewPortHandler(deploymentService.Ports())
+	graphHandler := api.NewGraphHandler(deploymentService)
+	proxyRouteHandler := api.NewProxyRouteHandler(deploymentService)
+	certificateHandler := api.NewCertificateHandler(deploymentService.Certificates())
+	dnsHandler := api.NewDNSHandler(deploymentService.DNS())
 
 	// Register marketplace routes
 	marketplaceHandler.RegisterRoutes(protectedGroup)
 
 	// Register deployment routes
 	deploymentHandler.RegisterRoutes(protectedGroup)
+	backupHandler.RegisterRoutes(protectedGroup)
+	databaseDumpHandler.RegisterRoutes(protectedGroup)
+	deploymentHealthHandler.RegisterRoutes(protectedGroup)
+	deploymentEventHandler.RegisterRoutes(protectedGroup)
+	remediationHandler.RegisterRoutes(protectedGroup)
+	adoptionHandler.RegisterRoutes(protectedGroup)
+	portHandler.RegisterRoutes(protectedGroup)
+	graphHandler.RegisterRoutes(protectedGroup)
+	proxyRouteHandler.RegisterRoutes(protectedGroup)
+	certificateHandler.RegisterRoutes(protectedGroup)
+	dnsHandler.RegisterRoutes(protectedGroup)
 
 	// Register nested routes under devices
 	devices := protectedGroup.Group("/devices/:id")
@@ -307,9 +432,19 @@ func main() {
 	// Resource monitoring routes (device-specific)
 	resourceHandler.RegisterDeviceResourceRoutes(protectedGroup.Group("/devices"))
 
-	// Register WebSocket routes (websocket auth is handled separately)
+	// Register WebSocket routes; the upgrade needs a token when authentication is required,
+	// and deployment log channels always need an authenticated connection
+	wsAuth := middleware.OptionalAuthMiddleware()
+	if os.Getenv("REQUIRE_AUTH") == "true" {
+		wsAuth = middleware.AuthMiddleware()
+	}
 	wsHandler := api.NewWebSocketHandler(wsHub)
-	wsHandler.RegisterRoutes(app)
+	wsHandler.RegisterRoutes(app, wsAuth)
+
+	// Register interactive terminal (container exec / device shell) - always requires an admin
+	terminalService := services.NewTerminalService(db, sshClient, deviceService)
+	terminalHandler := api.NewTerminalHandler(terminalService)
+	terminalHandler.RegisterRoutes(app, middleware.AuthMiddleware(), middleware.AdminMiddleware(userService))
 
 	// Development mode - frontend is served by Vite at :5173
 	// Production mode will have embedded frontend (configured during build)
@@ -356,11 +491,35 @@ func main() {
 	log.Printf("🏥 Shutting down health check service...")
 	healthCheckService.Stop()
 
+	log.Printf("📋 Stopping deployment job queue (running jobs resume on next start)...")
+	deploymentService.StopJobQueue()
+
+	log.Printf("🩺 Shutting down deployment health monitor...")
+	deploymentHealthMonitor.Stop()
+
+	log.Printf("🩹 Shutting down self-healing service...")
+	remediationService.Stop()
+
+	log.Printf("🔐 Shutting down certificate renewal service...")
+	deploymentService.Certificates().Stop()
+
+	log.Printf("📡 Withdrawing mDNS services...")
+	deploymentService.MDNS().Stop()
+
+	log.Printf("🔄 Shutting down update checker...")
+	updateChecker.Stop()
+
+	log.Printf("💾 Shutting down backup scheduler...")
+	backupService.Stop()
+
 	log.Printf("📊 Shutting down resource monitoring service...")
 	if err := resourceMonitoring.Stop(); err != nil {
 		log.Printf("Error stopping resource monitoring service: %v", err)
 	}
 
+	log.Printf("📜 Stopping deployment log streams...")
+	logStreamer.Stop()
+
 	log.Printf("📡 Shutting down WebSocket hub...")
 	wsHub.Shutdown()
 
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// AdoptionHandler handles discovery and adoption of apps the platform doesn't manage yet
+type AdoptionHandler struct {
+	deploymentService *services.DeploymentService
+}
+
+// NewAdoptionHandler creates a new adoption handler
+func NewAdoptionHandler(deploymentService *services.DeploymentService) *AdoptionHandler {
+	return &AdoptionHandler{
+		deploymentService: deploymentService,
+	}
+}
+
+// RegisterRoutes registers adoption routes
+func (h *AdoptionHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/devices/:id/discover", h.DiscoverApps)
+	router.Post("/devices/:id/adopt", h.AdoptApp)
+}
+
+// DiscoverApps handles GET /api/v1/devices/:id/discover
+// Lists unmanaged Compose projects and containers on the device with matching recipes
+func (h *AdoptionHandler) DiscoverApps(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+
+	apps, err := h.deploymentService.DiscoverApps(deviceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to discover apps: %v", err),
+		})
+	}
+
+	return c.JSON(apps)
+}
+
+// AdoptApp handles POST /api/v1/devices/:id/adopt
+// Body: {"kind": "compose", "name": "nextcloud", "recipe_slug": "nextcloud"}
+// Creates the deployment and queues the job that takes the app over
+func (h *AdoptionHandler) AdoptApp(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+
+	var req services.AdoptAppRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+	if req.Name == "" || (req.Kind != services.DiscoveredAppCompose && req.Kind != services.DiscoveredAppContainer) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "kind (compose or container) and name are required",
+		})
+	}
+
+	deployment, err := h.deploymentService.AdoptApp(deviceID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to adopt app: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(deployment)
+}
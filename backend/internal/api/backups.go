@@ -0,0 +1,213 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// BackupHandler handles backup-related HTTP requests
+type BackupHandler struct {
+	backupService     *services.BackupService
+	deploymentService *services.DeploymentService
+}
+
+// NewBackupHandler creates a new backup handler
+func NewBackupHandler(backupService *services.BackupService, deploymentService *services.DeploymentService) *BackupHandler {
+	return &BackupHandler{
+		backupService:     backupService,
+		deploymentService: deploymentService,
+	}
+}
+
+// RegisterRoutes registers backup routes
+func (h *BackupHandler) RegisterRoutes(router fiber.Router) {
+	backups := router.Group("/backups")
+	backups.Get("/destinations", h.ListDestinations)
+	backups.Post("/destinations", h.CreateDestination)
+	backups.Delete("/destinations/:id", h.DeleteDestination)
+	backups.Get("/policies", h.ListPolicies)
+	backups.Post("/policies", h.CreatePolicy)
+
+	router.Get("/deployments/:id/backups", h.ListBackups)
+	router.Post("/deployments/:id/backups", h.CreateBackup)
+	router.Post("/deployments/:id/backups/:snapshotId/restore", h.RestoreBackup)
+}
+
+// ListDestinations handles GET /api/v1/backups/destinations
+func (h *BackupHandler) ListDestinations(c *fiber.Ctx) error {
+	destinations, err := h.backupService.ListDestinations()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list backup destinations: %v", err),
+		})
+	}
+
+	return c.JSON(destinations)
+}
+
+// CreateDestination handles POST /api/v1/backups/destinations
+func (h *BackupHandler) CreateDestination(c *fiber.Ctx) error {
+	var req services.CreateBackupDestinationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	if err := ValidateRequest(c, &req); err != nil {
+		return err
+	}
+
+	destination, err := h.backupService.CreateDestination(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to create backup destination: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(destination)
+}
+
+// DeleteDestination handles DELETE /api/v1/backups/destinations/:id
+func (h *BackupHandler) DeleteDestination(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid destination ID",
+		})
+	}
+
+	if err := h.backupService.DeleteDestination(id); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to delete backup destination: %v", err),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListPolicies handles GET /api/v1/backups/policies
+func (h *BackupHandler) ListPolicies(c *fiber.Ctx) error {
+	policies, err := h.backupService.ListPolicies()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list backup policies: %v", err),
+		})
+	}
+
+	return c.JSON(policies)
+}
+
+// CreatePolicy handles POST /api/v1/backups/policies
+func (h *BackupHandler) CreatePolicy(c *fiber.Ctx) error {
+	var req services.CreateBackupPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	if err := ValidateRequest(c, &req); err != nil {
+		return err
+	}
+
+	policy, err := h.backupService.CreatePolicy(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to create backup policy: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(policy)
+}
+
+// ListBackups handles GET /api/v1/deployments/:id/backups
+func (h *BackupHandler) ListBackups(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	snapshots, err := h.backupService.ListSnapshots(deploymentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list backups: %v", err),
+		})
+	}
+
+	return c.JSON(snapshots)
+}
+
+// CreateBackup handles POST /api/v1/deployments/:id/backups
+// The backup runs in the background; progress is broadcast on the "backups" channel
+func (h *BackupHandler) CreateBackup(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	var req services.CreateBackupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid request body",
+			})
+		}
+	}
+
+	snapshot, err := h.backupService.StartBackup(deploymentID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to start backup: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(snapshot)
+}
+
+// RestoreBackup handles POST /api/v1/deployments/:id/backups/:snapshotId/restore
+// The restore is queued as a deployment job; progress is shown in the deployment logs
+func (h *BackupHandler) RestoreBackup(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	snapshotID, err := uuid.Parse(c.Params("snapshotId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid snapshot ID",
+		})
+	}
+
+	var req services.RestoreBackupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid request body",
+			})
+		}
+	}
+
+	job, err := h.deploymentService.RestoreBackup(deploymentID.String(), snapshotID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to start restore: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":     "Backup restore queued",
+		"job_id":      job.ID,
+		"snapshot_id": snapshotID,
+	})
+}
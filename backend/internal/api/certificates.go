@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// CertificateHandler handles the homelab CA and the certificates it issued
+type CertificateHandler struct {
+	ca *services.CertificateAuthority
+}
+
+// NewCertificateHandler creates a new certificate handler
+func NewCertificateHandler(ca *services.CertificateAuthority) *CertificateHandler {
+	return &CertificateHandler{
+		ca: ca,
+	}
+}
+
+// RegisterRoutes registers certificate routes
+func (h *CertificateHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/certificates", h.ListCertificates)
+	router.Get("/certificates/ca.pem", h.DownloadRootCertificate)
+	router.Post("/certificates/:id/renew", h.RenewCertificate)
+}
+
+// ListCertificates handles GET /api/v1/certificates
+// Optional query parameter: device_id
+func (h *CertificateHandler) ListCertificates(c *fiber.Ctx) error {
+	var deviceID *uuid.UUID
+	if param := c.Query("device_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid device ID",
+			})
+		}
+		deviceID = &id
+	}
+
+	certs, err := h.ca.ListCertificates(deviceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list certificates: %v", err),
+		})
+	}
+
+	return c.JSON(certs)
+}
+
+// DownloadRootCertificate handles GET /api/v1/certificates/ca.pem
+// Clients install the root certificate to trust every domain served with the homelab CA
+func (h *CertificateHandler) DownloadRootCertificate(c *fiber.Ctx) error {
+	rootPEM, err := h.ca.RootCertificatePEM()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to load root certificate: %v", err),
+		})
+	}
+
+	c.Attachment("homelab-root-ca.crt")
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	return c.SendString(rootPEM)
+}
+
+// RenewCertificate handles POST /api/v1/certificates/:id/renew
+func (h *CertificateHandler) RenewCertificate(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid certificate ID",
+		})
+	}
+
+	cert, err := h.ca.RenewCertificate(id)
+	if err != nil {
+		if errors.Is(err, services.ErrCertificateNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "Certificate not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to renew certificate: %v", err),
+		})
+	}
+
+	return c.JSON(cert)
+}
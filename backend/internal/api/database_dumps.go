@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// DatabaseDumpHandler handles provisioned database dump and restore requests
+type DatabaseDumpHandler struct {
+	dumpService *services.DatabaseDumpService
+}
+
+// NewDatabaseDumpHandler creates a new database dump handler
+func NewDatabaseDumpHandler(dumpService *services.DatabaseDumpService) *DatabaseDumpHandler {
+	return &DatabaseDumpHandler{
+		dumpService: dumpService,
+	}
+}
+
+// RegisterRoutes registers database dump routes
+func (h *DatabaseDumpHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/deployments/:id/database/dumps", h.ListDumps)
+	router.Post("/deployments/:id/database/dumps", h.CreateDump)
+
+	dumps := router.Group("/database-dumps")
+	dumps.Get("/:id", h.GetDump)
+	dumps.Get("/:id/download", h.DownloadDump)
+	dumps.Post("/:id/restore", h.RestoreDump)
+	dumps.Delete("/:id", h.DeleteDump)
+}
+
+// ListDumps handles GET /api/v1/deployments/:id/database/dumps
+func (h *DatabaseDumpHandler) ListDumps(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	dumps, err := h.dumpService.ListDumps(deploymentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list database dumps: %v", err),
+		})
+	}
+
+	return c.JSON(dumps)
+}
+
+// CreateDump handles POST /api/v1/deployments/:id/database/dumps
+// The dump runs in the background; progress is broadcast on the backups channel
+func (h *DatabaseDumpHandler) CreateDump(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	var req services.CreateDatabaseDumpRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid request body",
+			})
+		}
+	}
+
+	dump, err := h.dumpService.StartDump(deploymentID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to start database dump: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(dump)
+}
+
+// GetDump handles GET /api/v1/database-dumps/:id
+func (h *DatabaseDumpHandler) GetDump(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid dump ID",
+		})
+	}
+
+	dump, err := h.dumpService.GetDump(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+
+	return c.JSON(dump)
+}
+
+// DownloadDump handles GET /api/v1/database-dumps/:id/download
+// Only dumps stored on the server can be downloaded
+func (h *DatabaseDumpHandler) DownloadDump(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid dump ID",
+		})
+	}
+
+	_, path, err := h.dumpService.OpenDump(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to open database dump: %v", err),
+		})
+	}
+
+	return c.Download(path, filepath.Base(path))
+}
+
+// RestoreDump handles POST /api/v1/database-dumps/:id/restore
+// The restore runs in the background; progress is broadcast on the backups channel
+func (h *DatabaseDumpHandler) RestoreDump(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid dump ID",
+		})
+	}
+
+	var req services.RestoreDatabaseDumpRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid request body",
+			})
+		}
+	}
+
+	if err := h.dumpService.StartRestore(id, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to start database restore: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Database restore started",
+	})
+}
+
+// DeleteDump handles DELETE /api/v1/database-dumps/:id
+func (h *DatabaseDumpHandler) DeleteDump(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid dump ID",
+		})
+	}
+
+	if err := h.dumpService.DeleteDump(id); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to delete database dump: %v", err),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
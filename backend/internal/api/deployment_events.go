@@ -0,0 +1,88 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// DeploymentEventHandler handles deployment event history requests
+type DeploymentEventHandler struct {
+	eventService *services.DeploymentEventService
+}
+
+// NewDeploymentEventHandler creates a new deployment event handler
+func NewDeploymentEventHandler(eventService *services.DeploymentEventService) *DeploymentEventHandler {
+	return &DeploymentEventHandler{
+		eventService: eventService,
+	}
+}
+
+// RegisterRoutes registers deployment event routes
+func (h *DeploymentEventHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/deployments/events/stats", h.GetStats)
+	router.Get("/deployments/:id/events", h.ListEvents)
+}
+
+// ListEvents handles GET /api/v1/deployments/:id/events?limit=100&offset=0&type=status&severity=error
+// Returns a page of the deployment's events, oldest first
+func (h *DeploymentEventHandler) ListEvents(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "limit must be between 1 and 1000",
+		})
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "offset must not be negative",
+		})
+	}
+
+	filter := services.DeploymentEventFilter{
+		Type:     models.DeploymentEventType(c.Query("type")),
+		Severity: models.DeploymentEventSeverity(c.Query("severity")),
+	}
+
+	page, err := h.eventService.ListEvents(deploymentID, filter, limit, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list deployment events: %v", err),
+		})
+	}
+
+	return c.JSON(page)
+}
+
+// GetStats handles GET /api/v1/deployments/events/stats?hours=168
+// Returns phase and step durations and failure clusters across all deployments
+func (h *DeploymentEventHandler) GetStats(c *fiber.Ctx) error {
+	hours := c.QueryInt("hours", 24*30)
+	if hours < 1 || hours > 24*365 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "hours must be between 1 and 8760",
+		})
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	stats, err := h.eventService.GetStats(since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to get deployment event stats: %v", err),
+		})
+	}
+
+	return c.JSON(stats)
+}
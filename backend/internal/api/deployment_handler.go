@@ -35,14 +35,21 @@ func (h *DeploymentHandler) RegisterRoutes(router fiber.Router) {
 	deployments := router.Group("/deployments")
 	deployments.Get("", h.ListDeployments)
 	deployments.Post("", h.CreateDeployment)
+	deployments.Post("/plan", h.PlanDeployment)
+	deployments.Post("/custom", h.CreateCustomDeployment)
 	deployments.Delete("/cleanup", h.CleanupDeployments)
+	deployments.Get("/jobs", h.ListJobs)
 	deployments.Get("/check-dependencies/:recipe_slug/:device_id", h.CheckRecipeDependencies)
 	deployments.Get("/:id", h.GetDeployment)
+	deployments.Patch("/:id", h.UpdateDeploymentConfig)
 	deployments.Delete("/:id", h.DeleteDeployment)
 	deployments.Post("/:id/cancel", h.CancelDeployment)
 	deployments.Post("/:id/restart", h.RestartDeployment)
 	deployments.Post("/:id/stop", h.StopDeployment)
 	deployments.Post("/:id/start", h.StartDeployment)
+	deployments.Post("/:id/upgrade", h.UpgradeDeployment)
+	deployments.Post("/:id/migrate", h.MigrateDeployment)
+	deployments.Get("/:id/job", h.GetActiveJob)
 	deployments.Get("/:id/urls", h.GetAccessURLs)
 	deployments.Get("/:id/troubleshoot", h.TroubleshootDeployment)
 }
@@ -66,6 +73,56 @@ func (h *DeploymentHandler) CreateDeployment(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(deployment)
 }
 
+// CreateCustomDeployment deploys a user-supplied compose file
+// Body: {"name": "Paperless", "device_id": "...", "compose": "services: ...", "environment": {"PAPERLESS_PORT": "8000"}}
+func (h *DeploymentHandler) CreateCustomDeployment(c *fiber.Ctx) error {
+	var req services.CreateCustomDeploymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	deployment, err := h.deploymentService.CreateCustomDeployment(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to create custom deployment: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(deployment)
+}
+
+// PlanDeployment returns what creating a deployment would do without changing anything
+// Takes the same body as CreateDeployment
+func (h *DeploymentHandler) PlanDeployment(c *fiber.Ctx) error {
+	var req services.CreateDeploymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	plan, err := h.deploymentService.PlanDeployment(req)
+	if err != nil {
+		if errors.Is(err, services.ErrRecipeNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: err.Error(),
+			})
+		}
+		if errors.Is(err, services.ErrDependencyServiceNotInit) {
+			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+				Error: "Service initialization error",
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to plan deployment: %v", err),
+		})
+	}
+
+	return c.JSON(plan)
+}
+
 // GetDeployment retrieves a deployment by ID
 func (h *DeploymentHandler) GetDeployment(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -112,11 +169,70 @@ func (h *DeploymentHandler) ListDeployments(c *fiber.Ctx) error {
 	return c.JSON(deployments)
 }
 
+// ListJobs lists deployment jobs, newest first, with optional deployment_id, status and limit filters
+// Queued jobs include their queue position
+func (h *DeploymentHandler) ListJobs(c *fiber.Ctx) error {
+	var deploymentID *uuid.UUID
+	var status *models.DeploymentJobStatus
+
+	if idStr := c.Query("deployment_id"); idStr != "" {
+		parsedID, err := uuid.Parse(idStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid deployment_id parameter",
+			})
+		}
+		deploymentID = &parsedID
+	}
+
+	if statusStr := c.Query("status"); statusStr != "" {
+		statusValue := models.DeploymentJobStatus(statusStr)
+		status = &statusValue
+	}
+
+	jobs, err := h.deploymentService.ListJobs(deploymentID, status, c.QueryInt("limit", 100))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list deployment jobs: %v", err),
+		})
+	}
+
+	return c.JSON(jobs)
+}
+
+// GetActiveJob returns a deployment's queued or running job and its queue position
+func (h *DeploymentHandler) GetActiveJob(c *fiber.Ctx) error {
+	job, err := h.deploymentService.GetActiveJob(c.Params("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotActive) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "Deployment has no queued or running job",
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: err.Error(),
+		})
+	}
+
+	return c.JSON(job)
+}
+
 // DeleteDeployment removes a deployment
+// A deployment other deployments depend on is only deleted with ?cascade=true, which deletes them too
 func (h *DeploymentHandler) DeleteDeployment(c *fiber.Ctx) error {
 	id := c.Params("id")
 
-	if err := h.deploymentService.DeleteDeployment(id); err != nil {
+	deleteDeployment := h.deploymentService.DeleteDeployment
+	if c.QueryBool("cascade") {
+		deleteDeployment = h.deploymentService.DeleteDeploymentCascade
+	}
+	if err := deleteDeployment(id); err != nil {
+		var inUse *services.ProviderInUseError
+		if errors.As(err, &inUse) {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
+				Error: fmt.Sprintf("Failed to delete deployment: %v", err),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
 			Error: fmt.Sprintf("Failed to delete deployment: %v", err),
 		})
@@ -151,6 +267,82 @@ func (h *DeploymentHandler) RestartDeployment(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// UpdateDeploymentConfig changes a deployment's configuration and redeploys it in place
+// Returns the env and compose diff; with dry_run nothing is applied, otherwise the redeploy runs in
+// the background and progress is streamed via deployment:log events
+func (h *DeploymentHandler) UpdateDeploymentConfig(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req services.UpdateDeploymentConfigRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	result, err := h.deploymentService.UpdateDeploymentConfig(id, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to update deployment configuration: %v", err),
+		})
+	}
+
+	if result.Applied {
+		return c.Status(fiber.StatusAccepted).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+// UpgradeDeployment upgrades a deployment to the latest recipe version
+// The upgrade runs in the background; progress is streamed via deployment:log events
+func (h *DeploymentHandler) UpgradeDeployment(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req services.UpgradeDeploymentRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid request body",
+			})
+		}
+	}
+
+	deployment, err := h.deploymentService.UpgradeDeployment(id, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to upgrade deployment: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(deployment)
+}
+
+// MigrateDeployment moves a deployment to another device
+// The migration runs in the background; progress is streamed via deployment:log events
+func (h *DeploymentHandler) MigrateDeployment(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req services.MigrateDeploymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	if err := ValidateRequest(c, &req); err != nil {
+		return err
+	}
+
+	deployment, err := h.deploymentService.MigrateDeployment(id, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to migrate deployment: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(deployment)
+}
+
 // StopDeployment stops a deployment
 func (h *DeploymentHandler) StopDeployment(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// DeploymentHealthHandler handles deployment health history requests
+type DeploymentHealthHandler struct {
+	healthMonitor *services.DeploymentHealthMonitor
+}
+
+// NewDeploymentHealthHandler creates a new deployment health handler
+func NewDeploymentHealthHandler(healthMonitor *services.DeploymentHealthMonitor) *DeploymentHealthHandler {
+	return &DeploymentHealthHandler{
+		healthMonitor: healthMonitor,
+	}
+}
+
+// RegisterRoutes registers deployment health routes
+func (h *DeploymentHealthHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/deployments/:id/health", h.GetHealth)
+}
+
+// GetHealth handles GET /api/v1/deployments/:id/health?hours=24&limit=100
+// Returns uptime over the window and the most recent health checks
+func (h *DeploymentHealthHandler) GetHealth(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	hours := c.QueryInt("hours", 24)
+	if hours < 1 || hours > 24*7 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "hours must be between 1 and 168",
+		})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "limit must be between 1 and 1000",
+		})
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	summary, err := h.healthMonitor.GetHealthSummary(deploymentID, since, limit)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to get deployment health: %v", err),
+		})
+	}
+
+	return c.JSON(summary)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// DNSHandler handles DNS providers and the records kept on them
+type DNSHandler struct {
+	dnsService *services.DNSService
+}
+
+// NewDNSHandler creates a new DNS handler
+func NewDNSHandler(dnsService *services.DNSService) *DNSHandler {
+	return &DNSHandler{
+		dnsService: dnsService,
+	}
+}
+
+// RegisterRoutes registers DNS routes
+func (h *DNSHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/dns/providers", h.ListProviders)
+	router.Post("/dns/providers", h.CreateProvider)
+	router.Delete("/dns/providers/:id", h.DeleteProvider)
+	router.Get("/dns/records", h.ListRecords)
+	router.Post("/dns/reconcile", h.Reconcile)
+}
+
+// ListProviders handles GET /api/v1/dns/providers
+func (h *DNSHandler) ListProviders(c *fiber.Ctx) error {
+	providers, err := h.dnsService.ListProviders()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list DNS providers: %v", err),
+		})
+	}
+
+	return c.JSON(providers)
+}
+
+// CreateProvider handles POST /api/v1/dns/providers
+// Body: {"name": "pihole", "type": "pihole", "url": "http://192.168.1.2", "password": "..."}
+// The records of existing deployments are added right away; the response includes what changed
+func (h *DNSHandler) CreateProvider(c *fiber.Ctx) error {
+	var req services.DNSProviderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	provider, result, err := h.dnsService.CreateProvider(req)
+	if err != nil {
+		if provider == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: fmt.Sprintf("Failed to add DNS provider: %v", err),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("DNS provider added, but its records could not be synced: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"provider": provider,
+		"sync":     result,
+	})
+}
+
+// DeleteProvider handles DELETE /api/v1/dns/providers/:id
+// The records the platform created on the provider are removed first
+func (h *DNSHandler) DeleteProvider(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid DNS provider ID",
+		})
+	}
+
+	if err := h.dnsService.DeleteProvider(id); err != nil {
+		if errors.Is(err, services.ErrDNSProviderNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "DNS provider not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to delete DNS provider: %v", err),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListRecords handles GET /api/v1/dns/records
+// Optional query parameter: provider_id
+func (h *DNSHandler) ListRecords(c *fiber.Ctx) error {
+	var providerID *uuid.UUID
+	if param := c.Query("provider_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid DNS provider ID",
+			})
+		}
+		providerID = &id
+	}
+
+	records, err := h.dnsService.ListRecords(providerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list DNS records: %v", err),
+		})
+	}
+
+	return c.JSON(records)
+}
+
+// Reconcile handles POST /api/v1/dns/reconcile
+// Fixes drift between the providers and the deployments and reports what changed per provider
+func (h *DNSHandler) Reconcile(c *fiber.Ctx) error {
+	results, err := h.dnsService.Reconcile()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to reconcile DNS records: %v", err),
+		})
+	}
+
+	return c.JSON(results)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// GraphHandler handles the dependency graph between deployments and shared infrastructure
+type GraphHandler struct {
+	deploymentService *services.DeploymentService
+}
+
+// NewGraphHandler creates a new dependency graph handler
+func NewGraphHandler(deploymentService *services.DeploymentService) *GraphHandler {
+	return &GraphHandler{
+		deploymentService: deploymentService,
+	}
+}
+
+// RegisterRoutes registers dependency graph routes
+func (h *GraphHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/graph", h.GetGraph)
+	router.Delete("/graph/nodes/:type/:id", h.DeleteNode)
+}
+
+// GetGraph handles GET /api/v1/graph?device_id=
+// Returns every deployment and shared instance with the dependencies between them
+func (h *GraphHandler) GetGraph(c *fiber.Ctx) error {
+	var deviceID *uuid.UUID
+	if param := c.Query("device_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "Invalid device ID",
+			})
+		}
+		deviceID = &id
+	}
+
+	graph, err := h.deploymentService.GetDependencyGraph(deviceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to get dependency graph: %v", err),
+		})
+	}
+
+	return c.JSON(graph)
+}
+
+// DeleteNode handles DELETE /api/v1/graph/nodes/:type/:id?cascade=true
+// A node that deployments still depend on is only deleted with cascade, which deletes those deployments first
+func (h *GraphHandler) DeleteNode(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid node ID",
+		})
+	}
+
+	nodeType := models.DependencyNodeType(c.Params("type"))
+	if err := h.deploymentService.DeleteDependencyNode(c.Context(), nodeType, id, c.QueryBool("cascade")); err != nil {
+		var inUse *services.ProviderInUseError
+		switch {
+		case errors.As(err, &inUse):
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
+				Error: fmt.Sprintf("Failed to delete node: %v", err),
+			})
+		case errors.Is(err, services.ErrDependencyNodeNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "Node not found",
+			})
+		case errors.Is(err, services.ErrDependencyNodeNotDeletable):
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to delete node: %v", err),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
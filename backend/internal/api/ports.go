@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// PortHandler handles the per-device port registry
+type PortHandler struct {
+	portRegistry *services.PortRegistry
+}
+
+// NewPortHandler creates a new port handler
+func NewPortHandler(portRegistry *services.PortRegistry) *PortHandler {
+	return &PortHandler{
+		portRegistry: portRegistry,
+	}
+}
+
+// RegisterRoutes registers port registry routes
+func (h *PortHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/devices/:id/ports", h.ListPorts)
+	router.Post("/devices/:id/ports/reservations", h.ReservePorts)
+	router.Delete("/devices/:id/ports/reservations/:reservationId", h.DeleteReservation)
+}
+
+// ListPorts handles GET /api/v1/devices/:id/ports?scan=true
+// Lists every port held on the device and its owner; scan=false skips checking the device for unmanaged ports
+func (h *PortHandler) ListPorts(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+
+	ports, err := h.portRegistry.ListDevicePorts(deviceID, c.QueryBool("scan", true))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list ports: %v", err),
+		})
+	}
+
+	return c.JSON(ports)
+}
+
+// ReservePorts handles POST /api/v1/devices/:id/ports/reservations
+// Body: {"start_port": 9000, "end_port": 9010, "description": "game servers"}
+func (h *PortHandler) ReservePorts(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+
+	var req services.PortReservationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	reservation, err := h.portRegistry.ReservePorts(deviceID, req)
+	if err != nil {
+		var conflict *services.PortConflictError
+		if errors.As(err, &conflict) {
+			return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
+				Error: fmt.Sprintf("Failed to reserve ports: %v", err),
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to reserve ports: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(reservation)
+}
+
+// DeleteReservation handles DELETE /api/v1/devices/:id/ports/reservations/:reservationId
+func (h *PortHandler) DeleteReservation(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+	reservationID, err := uuid.Parse(c.Params("reservationId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid reservation ID",
+		})
+	}
+
+	if err := h.portRegistry.DeleteReservation(deviceID, reservationID); err != nil {
+		if errors.Is(err, services.ErrPortReservationNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "Port reservation not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to delete port reservation: %v", err),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// ProxyRouteHandler handles the routes served by the reverse proxy on a device
+type ProxyRouteHandler struct {
+	deploymentService *services.DeploymentService
+}
+
+// NewProxyRouteHandler creates a new proxy route handler
+func NewProxyRouteHandler(deploymentService *services.DeploymentService) *ProxyRouteHandler {
+	return &ProxyRouteHandler{
+		deploymentService: deploymentService,
+	}
+}
+
+// RegisterRoutes registers proxy route routes
+func (h *ProxyRouteHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/devices/:id/routes", h.ListRoutes)
+	router.Post("/devices/:id/routes", h.CreateRoute)
+	router.Delete("/devices/:id/routes/:router", h.DeleteRoute)
+}
+
+// ListRoutes handles GET /api/v1/devices/:id/routes
+// Lists the routes of deployments and the ones added by hand, as the proxy reports them
+func (h *ProxyRouteHandler) ListRoutes(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+
+	routes, err := h.deploymentService.ListProxyRoutes(deviceID)
+	if err != nil {
+		if errors.Is(err, services.ErrNoReverseProxy) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "No reverse proxy deployed on device",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to list routes: %v", err),
+		})
+	}
+
+	return c.JSON(routes)
+}
+
+// CreateRoute handles POST /api/v1/devices/:id/routes
+// Body: {"router": "nas", "domain": "nas.home.lan", "upstream": "192.168.1.30:5000", "https": true}
+func (h *ProxyRouteHandler) CreateRoute(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+
+	var req services.ProxyRouteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	route, err := h.deploymentService.CreateProxyRoute(deviceID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrNoReverseProxy) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "No reverse proxy deployed on device",
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to add route: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(route)
+}
+
+// DeleteRoute handles DELETE /api/v1/devices/:id/routes/:router
+func (h *ProxyRouteHandler) DeleteRoute(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid device ID",
+		})
+	}
+
+	if err := h.deploymentService.DeleteProxyRoute(deviceID, c.Params("router")); err != nil {
+		if errors.Is(err, services.ErrNoReverseProxy) {
+			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+				Error: "No reverse proxy deployed on device",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to remove route: %v", err),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
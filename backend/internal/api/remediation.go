@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+)
+
+// RemediationHandler handles deployment self-healing policy requests
+type RemediationHandler struct {
+	remediationService *services.RemediationService
+}
+
+// NewRemediationHandler creates a new remediation handler
+func NewRemediationHandler(remediationService *services.RemediationService) *RemediationHandler {
+	return &RemediationHandler{
+		remediationService: remediationService,
+	}
+}
+
+// RegisterRoutes registers remediation routes
+func (h *RemediationHandler) RegisterRoutes(router fiber.Router) {
+	router.Get("/deployments/:id/remediation", h.GetPolicy)
+	router.Put("/deployments/:id/remediation", h.UpdatePolicy)
+}
+
+// GetPolicy handles GET /api/v1/deployments/:id/remediation
+// Returns the self-healing policy and current escalation state
+func (h *RemediationHandler) GetPolicy(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	policy, err := h.remediationService.GetPolicy(deploymentID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to get remediation policy: %v", err),
+		})
+	}
+
+	return c.JSON(policy)
+}
+
+// UpdatePolicy handles PUT /api/v1/deployments/:id/remediation
+func (h *RemediationHandler) UpdatePolicy(c *fiber.Ctx) error {
+	deploymentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid deployment ID",
+		})
+	}
+
+	var req services.UpdateRemediationPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Invalid request body",
+		})
+	}
+
+	if err := ValidateRequest(c, &req); err != nil {
+		return err
+	}
+
+	policy, err := h.remediationService.UpdatePolicy(deploymentID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Failed to update remediation policy: %v", err),
+		})
+	}
+
+	return c.JSON(policy)
+}
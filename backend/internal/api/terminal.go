@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/services"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+)
+
+// TerminalHandler serves interactive shells over WebSocket
+//
+// Connect to /ws/exec with either ?deployment_id=<id>&service=<compose service> for a shell inside
+// that service's container, or ?device_id=<id> for a shell on the device itself; optional cols/rows
+// set the initial size. Terminal output is sent as binary frames. Binary frames from the client are
+// written to the terminal, and text frames are JSON control messages:
+//
+//	{"type": "input", "data": "ls\r"}
+//	{"type": "resize", "cols": 120, "rows": 40}
+//
+// When the shell exits the server sends {"type": "exit", "code": 0} and closes the connection
+type TerminalHandler struct {
+	terminalService *services.TerminalService
+}
+
+// terminalMessage is a JSON control message exchanged with terminal clients
+type terminalMessage struct {
+	Type    string `json:"type"`
+	Data    string `json:"data,omitempty"`
+	Cols    int    `json:"cols,omitempty"`
+	Rows    int    `json:"rows,omitempty"`
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewTerminalHandler creates a new terminal handler
+func NewTerminalHandler(terminalService *services.TerminalService) *TerminalHandler {
+	return &TerminalHandler{
+		terminalService: terminalService,
+	}
+}
+
+// RegisterRoutes registers the terminal WebSocket endpoint behind the given (auth) handlers
+func (h *TerminalHandler) RegisterRoutes(app *fiber.App, handlers ...fiber.Handler) {
+	handlers = append(handlers, websocket.New(h.HandleExec))
+	app.Get("/ws/exec", handlers...)
+}
+
+// HandleExec handles GET /ws/exec
+func (h *TerminalHandler) HandleExec(c *websocket.Conn) {
+	username, _ := c.Locals("username").(string)
+	size := services.TerminalSize{
+		Cols: queryInt(c, "cols"),
+		Rows: queryInt(c, "rows"),
+	}
+
+	shell, target, err := h.openShell(c, size)
+	if err != nil {
+		writeTerminalMessage(c, &sync.Mutex{}, terminalMessage{Type: "error", Message: err.Error()})
+		c.Close()
+		return
+	}
+	defer shell.Close()
+
+	log.Printf("[Terminal] %s opened a shell on %s", username, target)
+
+	var writeMu sync.Mutex
+
+	// Terminal output -> client
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := shell.Stdout.Read(buf)
+			if n > 0 {
+				writeMu.Lock()
+				writeErr := c.WriteMessage(websocket.BinaryMessage, buf[:n])
+				writeMu.Unlock()
+				if writeErr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Client -> terminal input and resize events
+	go func() {
+		defer shell.Close()
+		for {
+			messageType, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if messageType == websocket.BinaryMessage {
+				if _, err := shell.Stdin.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+
+			var msg terminalMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				if _, err := shell.Stdin.Write([]byte(msg.Data)); err != nil {
+					return
+				}
+			case "resize":
+				size := services.TerminalSize{Cols: msg.Cols, Rows: msg.Rows}
+				if size.Cols > 0 && size.Rows > 0 {
+					shell.Resize(size.Cols, size.Rows)
+				}
+			}
+		}
+	}()
+
+	code, err := shell.Wait()
+	<-outputDone
+
+	if err != nil {
+		writeTerminalMessage(c, &writeMu, terminalMessage{Type: "error", Message: err.Error()})
+	} else {
+		writeTerminalMessage(c, &writeMu, terminalMessage{Type: "exit", Code: code})
+	}
+	c.Close()
+
+	log.Printf("[Terminal] %s closed the shell on %s", username, target)
+}
+
+// openShell opens the shell selected by the connection's query parameters
+// Returns the shell and a description of its target for logging
+func (h *TerminalHandler) openShell(c *websocket.Conn, size services.TerminalSize) (*ssh.Shell, string, error) {
+	if deploymentID := c.Query("deployment_id"); deploymentID != "" {
+		id, err := uuid.Parse(deploymentID)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid deployment ID")
+		}
+		service := c.Query("service")
+		shell, err := h.terminalService.OpenContainerShell(id, service, size)
+		return shell, fmt.Sprintf("deployment %s service %s", id, service), err
+	}
+
+	if deviceID := c.Query("device_id"); deviceID != "" {
+		id, err := uuid.Parse(deviceID)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid device ID")
+		}
+		shell, err := h.terminalService.OpenDeviceShell(id, size)
+		return shell, fmt.Sprintf("device %s", id), err
+	}
+
+	return nil, "", fmt.Errorf("deployment_id and service, or device_id, is required")
+}
+
+// writeTerminalMessage sends a JSON control message to a terminal client
+func writeTerminalMessage(c *websocket.Conn, mu *sync.Mutex, msg terminalMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	c.WriteMessage(websocket.TextMessage, data)
+}
+
+// queryInt parses an optional integer query parameter, returning 0 if absent or invalid
+func queryInt(c *websocket.Conn, key string) int {
+	value, err := strconv.Atoi(c.Query(key))
+	if err != nil {
+		return 0
+	}
+	return value
+}
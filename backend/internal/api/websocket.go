@@ -32,8 +32,10 @@ func (h *WebSocketHandler) HandleConnection(c *websocket.Conn) {
 	log.Printf("[WebSocket] Connection closed for %s", c.RemoteAddr())
 }
 
-// RegisterRoutes registers WebSocket routes
-func (h *WebSocketHandler) RegisterRoutes(app *fiber.App) {
+// RegisterRoutes registers WebSocket routes behind the given (auth) handlers
+// Clients authenticate the upgrade with ?token=<jwt>; restricted channels such as deployment logs
+// are only open to authenticated connections
+func (h *WebSocketHandler) RegisterRoutes(app *fiber.App, handlers ...fiber.Handler) {
 	// WebSocket upgrade middleware
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
@@ -44,5 +46,6 @@ func (h *WebSocketHandler) RegisterRoutes(app *fiber.App) {
 	})
 
 	// WebSocket endpoint
-	app.Get("/ws", websocket.New(h.HandleConnection))
+	handlers = append(handlers, websocket.New(h.HandleConnection))
+	app.Get("/ws", handlers...)
 }
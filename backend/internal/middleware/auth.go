@@ -30,7 +30,8 @@ func getJWTSecret() []byte {
 func AuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get Authorization header
-		authHeader := c.Get("Authorization")
+		authHeader := authorizationHeader(c)
+
 		if authHeader == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Missing authorization header",
@@ -77,6 +78,16 @@ func AuthMiddleware() fiber.Handler {
 	}
 }
 
+// authorizationHeader returns the Authorization header of a request
+// Browsers can't set headers on WebSocket handshakes, so upgrades may pass the token as a query parameter
+func authorizationHeader(c *fiber.Ctx) string {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" && strings.EqualFold(c.Get("Upgrade"), "websocket") && c.Query("token") != "" {
+		authHeader = "Bearer " + c.Query("token")
+	}
+	return authHeader
+}
+
 // GenerateToken generates a new JWT token for a username
 func GenerateToken(username string) (string, error) {
 	claims := &Claims{
@@ -96,7 +107,7 @@ func GenerateToken(username string) (string, error) {
 // Useful for endpoints that work differently when authenticated
 func OptionalAuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
+		authHeader := authorizationHeader(c)
 		if authHeader == "" {
 			return c.Next()
 		}
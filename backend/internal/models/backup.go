@@ -0,0 +1,145 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BackupDestinationType represents where backup archives are stored
+type BackupDestinationType string
+
+const (
+	// BackupDestinationLocal stores archives in a directory on the deployment's device
+	BackupDestinationLocal BackupDestinationType = "local"
+	// BackupDestinationNFS stores archives on an NFS export mounted on the deployment's device
+	BackupDestinationNFS BackupDestinationType = "nfs"
+)
+
+// BackupDestination represents a target for volume backup archives
+type BackupDestination struct {
+	ID      uuid.UUID             `gorm:"type:uuid;primaryKey" json:"id"`
+	Name    string                `gorm:"not null;uniqueIndex" json:"name"`
+	Type    BackupDestinationType `gorm:"not null" json:"type"`
+	Path    string                `gorm:"not null" json:"path"` // Local directory, or export path on the NFS server
+	Enabled bool                  `gorm:"default:true" json:"enabled"`
+
+	// NFS configuration (only used when Type is "nfs")
+	NFSServerIP string `json:"nfs_server_ip,omitempty"`
+	NFSOptions  string `json:"nfs_options,omitempty"`
+
+	// Statistics
+	LastBackupAt *time.Time `json:"last_backup_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (b *BackupDestination) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (BackupDestination) TableName() string {
+	return "backup_destinations"
+}
+
+// BackupPolicy defines where snapshots go and how many are retained
+// Backup frequency per volume comes from the recipe's volume metadata
+type BackupPolicy struct {
+	ID            uuid.UUID          `gorm:"type:uuid;primaryKey" json:"id"`
+	Name          string             `gorm:"not null;uniqueIndex" json:"name"`
+	Description   string             `json:"description,omitempty"`
+	IsDefault     bool               `gorm:"default:false;index" json:"is_default"`
+	Enabled       bool               `gorm:"default:true" json:"enabled"`
+	DestinationID uuid.UUID          `gorm:"type:uuid;not null" json:"destination_id"`
+	Destination   *BackupDestination `gorm:"foreignKey:DestinationID" json:"destination,omitempty"`
+
+	// Stop the deployment's containers while archiving for a consistent snapshot
+	StopContainers bool `gorm:"default:false" json:"stop_containers"`
+
+	// Retention policy (GFS - Grandfather-Father-Son)
+	KeepLast    int `json:"keep_last"`
+	KeepDaily   int `json:"keep_daily"`
+	KeepWeekly  int `json:"keep_weekly"`
+	KeepMonthly int `json:"keep_monthly"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (b *BackupPolicy) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (BackupPolicy) TableName() string {
+	return "backup_policies"
+}
+
+// SnapshotStatus represents the status of a backup snapshot
+type SnapshotStatus string
+
+const (
+	SnapshotStatusInProgress SnapshotStatus = "in_progress"
+	SnapshotStatusSuccess    SnapshotStatus = "success"
+	SnapshotStatusFailed     SnapshotStatus = "failed"
+)
+
+// SnapshotTrigger records why a snapshot was taken
+type SnapshotTrigger string
+
+const (
+	SnapshotTriggerManual    SnapshotTrigger = "manual"
+	SnapshotTriggerScheduled SnapshotTrigger = "scheduled"
+	SnapshotTriggerUpgrade   SnapshotTrigger = "pre_upgrade"
+	SnapshotTriggerRestore   SnapshotTrigger = "pre_restore"
+)
+
+// BackupSnapshot records a single backup of a deployment's volumes
+// Each snapshot is a directory containing one tar.gz per volume plus the compose and env files
+type BackupSnapshot struct {
+	ID            uuid.UUID          `gorm:"type:uuid;primaryKey" json:"id"`
+	DeploymentID  uuid.UUID          `gorm:"type:uuid;not null;index" json:"deployment_id"`
+	DeviceID      uuid.UUID          `gorm:"type:uuid;not null" json:"device_id"`
+	DestinationID uuid.UUID          `gorm:"type:uuid;not null;index" json:"destination_id"`
+	Destination   *BackupDestination `gorm:"foreignKey:DestinationID" json:"destination,omitempty"`
+	PolicyID      *uuid.UUID         `gorm:"type:uuid" json:"policy_id,omitempty"`
+
+	Trigger      SnapshotTrigger `gorm:"not null;default:manual" json:"trigger"`
+	Status       SnapshotStatus  `gorm:"not null;index" json:"status"`
+	Volumes      []byte          `gorm:"type:json" json:"volumes,omitempty"` // JSON array of compose volume names
+	ArchivePath  string          `json:"archive_path"`                       // Snapshot directory relative to the destination root
+	SizeBytes    int64           `json:"size_bytes"`
+	Duration     int             `json:"duration"` // seconds
+	ErrorMessage string          `gorm:"type:text" json:"error_message,omitempty"`
+
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (b *BackupSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	if b.Status == "" {
+		b.Status = SnapshotStatusInProgress
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (BackupSnapshot) TableName() string {
+	return "backup_snapshots"
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CertificateStatus is where a certificate stands in its lifetime
+type CertificateStatus string
+
+const (
+	CertificateStatusValid    CertificateStatus = "valid"
+	CertificateStatusExpiring CertificateStatus = "expiring" // Inside the renewal window and not renewed yet
+	CertificateStatusExpired  CertificateStatus = "expired"
+	CertificateStatusFailed   CertificateStatus = "failed" // The last issue or install failed, see LastError
+)
+
+// Certificate is a leaf certificate the homelab CA issued for a deployment's domain
+// The private key lives in the credential store under KeyCredentialKey
+type Certificate struct {
+	ID               uuid.UUID         `gorm:"type:uuid;primaryKey" json:"id"`
+	DeploymentID     uuid.UUID         `gorm:"type:uuid;not null;uniqueIndex" json:"deployment_id"`
+	DeviceID         uuid.UUID         `gorm:"type:uuid;not null;index" json:"device_id"`
+	Domain           string            `gorm:"not null" json:"domain"`
+	SerialNumber     string            `json:"serial_number"`
+	NotBefore        time.Time         `json:"not_before"`
+	NotAfter         time.Time         `gorm:"index" json:"not_after"`
+	Status           CertificateStatus `gorm:"not null;default:'valid'" json:"status"`
+	CertificatePEM   string            `gorm:"type:text" json:"-"`
+	KeyCredentialKey string            `json:"-"`
+	InstalledAt      *time.Time        `json:"installed_at,omitempty"` // Last install on the device's reverse proxy
+	LastError        string            `gorm:"type:text" json:"last_error,omitempty"`
+	AlertedAt        *time.Time        `json:"alerted_at,omitempty"` // Last expiry alert, so alerts are not repeated every check
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (c *Certificate) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (Certificate) TableName() string {
+	return "certificates"
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DatabaseDump records a gzipped SQL dump of a provisioned database
+// Dumps are taken in a single transaction, so each one is a consistent point-in-time export
+// A dump is stored either on the server (DestinationID nil) or on a backup destination
+type DatabaseDump struct {
+	ID                    uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
+	ProvisionedDatabaseID uuid.UUID       `gorm:"type:uuid;not null;index" json:"provisioned_database_id"`
+	DeploymentID          uuid.UUID       `gorm:"type:uuid;not null;index" json:"deployment_id"`
+	DeviceID              uuid.UUID       `gorm:"type:uuid;not null" json:"device_id"` // Device the dump was taken on
+	Engine                string          `gorm:"not null" json:"engine"`              // postgres, mysql, mariadb
+	Version               string          `json:"version"`                             // Engine version of the source instance
+	DatabaseName          string          `gorm:"not null" json:"database_name"`
+	Trigger               SnapshotTrigger `gorm:"not null;default:manual" json:"trigger"` // pre_restore dumps are safety copies taken by a restore
+
+	// Storage location
+	DestinationID *uuid.UUID         `gorm:"type:uuid;index" json:"destination_id,omitempty"`
+	Destination   *BackupDestination `gorm:"foreignKey:DestinationID" json:"destination,omitempty"`
+	Path          string             `json:"path"` // File on the server, or relative to the destination root
+
+	Status       SnapshotStatus `gorm:"not null;index" json:"status"`
+	SizeBytes    int64          `json:"size_bytes"` // Compressed size
+	ErrorMessage string         `gorm:"type:text" json:"error_message,omitempty"`
+
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *DatabaseDump) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	if d.Status == "" {
+		d.Status = SnapshotStatusInProgress
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DatabaseDump) TableName() string {
+	return "database_dumps"
+}
+
+// IsOnServer reports whether the dump file is stored on the orchestration server
+func (d *DatabaseDump) IsOnServer() bool {
+	return d.DestinationID == nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DedicatedInstanceKind identifies what a dedicated instance provides
+type DedicatedInstanceKind string
+
+const (
+	DedicatedInstanceKindDatabase DedicatedInstanceKind = "database"
+	DedicatedInstanceKindCache    DedicatedInstanceKind = "cache"
+)
+
+// DedicatedInstance is a database or cache container owned by a single deployment
+// Unlike shared instances it is never reused by other apps and is removed together with its deployment
+type DedicatedInstance struct {
+	ID           uuid.UUID             `gorm:"type:uuid;primaryKey" json:"id"`
+	DeploymentID uuid.UUID             `gorm:"type:uuid;not null;index" json:"deployment_id"` // Owning deployment
+	DeviceID     uuid.UUID             `gorm:"type:uuid;not null;index" json:"device_id"`
+	Kind         DedicatedInstanceKind `gorm:"type:varchar(20);not null" json:"kind"`
+	Engine       string                `gorm:"type:varchar(50);not null" json:"engine"` // postgres, mysql, mariadb, valkey, redis, memcached
+	Version      string                `gorm:"type:varchar(50);not null" json:"version"`
+	Image        string                `gorm:"type:varchar(255);not null" json:"image"` // Docker image without tag
+
+	// Container information
+	ContainerName  string `gorm:"type:varchar(255);not null;uniqueIndex" json:"container_name"`
+	ComposeProject string `gorm:"type:varchar(255);not null" json:"compose_project"`
+	Port           int    `gorm:"not null" json:"port"`          // Exposed port on device
+	InternalPort   int    `gorm:"not null" json:"internal_port"` // Container internal port
+
+	// Credentials (passwords are kept in the credential store)
+	MasterUsername      string `json:"master_username,omitempty"`
+	MasterCredentialKey string `json:"-"`
+	DatabaseName        string `json:"database_name,omitempty"` // Databases only
+	Username            string `json:"username,omitempty"`      // Databases only
+	CredentialKey       string `json:"-"`                       // App user password (databases only)
+	MaxMemoryMB         int    `json:"max_memory_mb,omitempty"` // Caches only
+
+	Status       string     `gorm:"type:varchar(50);not null;default:'provisioning'" json:"status"` // provisioning, running, failed
+	ErrorDetails string     `gorm:"type:text" json:"error_details,omitempty"`
+	DeployedAt   *time.Time `json:"deployed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *DedicatedInstance) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DedicatedInstance) TableName() string {
+	return "dedicated_instances"
+}
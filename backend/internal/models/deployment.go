@@ -21,32 +21,99 @@ const (
 	DeploymentStatusFailed      DeploymentStatus = "failed"
 	DeploymentStatusRollingBack DeploymentStatus = "rolling_back"
 	DeploymentStatusRolledBack  DeploymentStatus = "rolled_back"
+	DeploymentStatusUnhealthy   DeploymentStatus = "unhealthy" // Running, but failing its recipe health endpoint
+	DeploymentStatusMigrating   DeploymentStatus = "migrating" // Moving to another device
+)
+
+// DeploymentSource is where a deployment's compose file comes from
+type DeploymentSource string
+
+const (
+	DeploymentSourceRecipe     DeploymentSource = "recipe"     // Marketplace recipe identified by RecipeSlug
+	DeploymentSourceCustom     DeploymentSource = "custom"     // Compose file supplied by the user, kept in GeneratedCompose
+	DeploymentSourceDependency DeploymentSource = "dependency" // Recipe deployed to satisfy another deployment's dependency, removed once unused
+)
+
+// Schedulers a deployment's containers can run under
+const (
+	DeploymentOrchestratorCompose = "compose" // Docker Compose project on the deployment's device
+	DeploymentOrchestratorSwarm   = "swarm"   // Docker Swarm stack, scheduled across the cluster from the device as manager
 )
 
 // Deployment represents a deployed application on a device
 type Deployment struct {
-	ID               uuid.UUID        `gorm:"type:uuid;primaryKey" json:"id"`
-	RecipeSlug       string           `gorm:"not null" json:"recipe_slug"`                  // Marketplace recipe identifier
-	RecipeName       string           `json:"recipe_name"`                                  // Cached for display
-	ApplicationID    uuid.UUID        `gorm:"type:uuid" json:"application_id,omitempty"`    // Legacy - made nullable
-	Application      *Application     `gorm:"foreignKey:ApplicationID" json:"application,omitempty"`
-	DeviceID         uuid.UUID        `gorm:"type:uuid;not null" json:"device_id"`
-	Device           *Device          `gorm:"foreignKey:DeviceID" json:"device,omitempty"`
-	Status           DeploymentStatus `gorm:"default:validating" json:"status"`
-	Config           []byte           `gorm:"type:json" json:"config,omitempty"`
-	Domain           string           `json:"domain,omitempty"`
-	InternalPort     int              `json:"internal_port"`
-	ExternalPort     int              `json:"external_port,omitempty"`
-	ContainerID      string           `json:"container_id,omitempty"`
-	ComposeProject   string           `json:"compose_project,omitempty"`                    // Docker Compose project name
-	GeneratedCompose string           `gorm:"type:text" json:"generated_compose,omitempty"` // For debugging/transparency
-	DeploymentLogs   string           `gorm:"type:text" json:"deployment_logs,omitempty"`   // Logs from deployment process
-	SSHCommands      []byte           `gorm:"type:json" json:"ssh_commands,omitempty"`      // For debugging
-	RollbackLog      []byte           `gorm:"type:json" json:"rollback_log,omitempty"`      // For debugging
-	ErrorDetails     string           `gorm:"type:text" json:"error_details,omitempty"`
-	DeployedAt       *time.Time       `json:"deployed_at,omitempty"`
-	CreatedAt        time.Time        `json:"created_at"`
-	UpdatedAt        time.Time        `json:"updated_at"`
+	ID                  uuid.UUID        `gorm:"type:uuid;primaryKey" json:"id"`
+	Source              DeploymentSource `gorm:"default:recipe" json:"source"`
+	Orchestrator        string           `gorm:"default:compose" json:"orchestrator"`       // compose or swarm
+	RecipeSlug          string           `gorm:"not null" json:"recipe_slug"`               // Marketplace recipe identifier, empty for custom deployments
+	RecipeName          string           `json:"recipe_name"`                               // Cached for display
+	ApplicationID       uuid.UUID        `gorm:"type:uuid" json:"application_id,omitempty"` // Legacy - made nullable
+	Application         *Application     `gorm:"foreignKey:ApplicationID" json:"application,omitempty"`
+	DeviceID            uuid.UUID        `gorm:"type:uuid;not null" json:"device_id"`
+	Device              *Device          `gorm:"foreignKey:DeviceID" json:"device,omitempty"`
+	Status              DeploymentStatus `gorm:"default:validating" json:"status"`
+	Config              []byte           `gorm:"type:json" json:"config,omitempty"`
+	Domain              string           `json:"domain,omitempty"`
+	CertResolver        string           `json:"cert_resolver,omitempty"` // Traefik certificate resolver serving Domain over HTTPS, empty for plain HTTP
+	InternalPort        int              `json:"internal_port"`
+	ExternalPort        int              `json:"external_port,omitempty"`
+	ContainerID         string           `json:"container_id,omitempty"`
+	ComposeProject      string           `json:"compose_project,omitempty"`                    // Docker Compose project name
+	GeneratedCompose    string           `gorm:"type:text" json:"generated_compose,omitempty"` // For debugging/transparency
+	DeploymentLogs      string           `gorm:"type:text" json:"deployment_logs,omitempty"`   // Logs from deployment process
+	SSHCommands         []byte           `gorm:"type:json" json:"ssh_commands,omitempty"`      // For debugging
+	RollbackLog         []byte           `gorm:"type:json" json:"rollback_log,omitempty"`      // For debugging
+	ErrorDetails        string           `gorm:"type:text" json:"error_details,omitempty"`
+	DeployedAt          *time.Time       `json:"deployed_at,omitempty"`
+	UpdateAvailable     bool             `gorm:"default:false" json:"update_available"`
+	UpdateCheckedAt     *time.Time       `json:"update_checked_at,omitempty"`
+	ImageUpdates        []byte           `gorm:"type:json" json:"image_updates,omitempty"`         // JSON array of ImageUpdateStatus from the last check
+	PostInstallMessages []byte           `gorm:"type:json" json:"post_install_messages,omitempty"` // JSON array of PostInstallMessage shown to the user
+	HealthFailures      int              `gorm:"default:0" json:"health_failures"`                 // Consecutive failed health probes
+	LastHealthCheckAt   *time.Time       `json:"last_health_check_at,omitempty"`
+	AdoptedFrom         string           `json:"adopted_from,omitempty"` // Original compose directory or container name of an adopted app
+	AdoptedAt           *time.Time       `json:"adopted_at,omitempty"`   // Set once the platform has taken over an adopted app
+	CreatedAt           time.Time        `json:"created_at"`
+	UpdatedAt           time.Time        `json:"updated_at"`
+}
+
+// ImageUpdateStatus compares the digest a device is running with the registry's current digest
+type ImageUpdateStatus struct {
+	Image           string `json:"image"`
+	CurrentDigest   string `json:"current_digest"`
+	LatestDigest    string `json:"latest_digest,omitempty"`
+	UpdateAvailable bool   `json:"update_available"`
+	Error           string `json:"error,omitempty"`
+}
+
+// PostInstallMessage is a rendered recipe post-install message
+type PostInstallMessage struct {
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message"`
+}
+
+// RollbackStep records a single step taken while rolling back a failed upgrade or migration
+// Deployment.RollbackLog stores a JSON array of these
+type RollbackStep struct {
+	Timestamp time.Time `json:"timestamp"`
+	Step      string    `json:"step"`
+	Success   bool      `json:"success"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// IsAdopted reports whether the deployment was imported from an existing app rather than deployed from its recipe
+func (d *Deployment) IsAdopted() bool {
+	return d.AdoptedFrom != ""
+}
+
+// IsCustom reports whether the deployment runs a user-supplied compose file instead of a recipe
+func (d *Deployment) IsCustom() bool {
+	return d.Source == DeploymentSourceCustom
+}
+
+// IsSwarmStack reports whether the deployment runs as a Docker Swarm stack rather than a Compose project
+func (d *Deployment) IsSwarmStack() bool {
+	return d.Orchestrator == DeploymentOrchestratorSwarm
 }
 
 // BeforeCreate hook to generate UUID
@@ -54,6 +121,12 @@ func (d *Deployment) BeforeCreate(tx *gorm.DB) error {
 	if d.ID == uuid.Nil {
 		d.ID = uuid.New()
 	}
+	if d.Source == "" {
+		d.Source = DeploymentSourceRecipe
+	}
+	if d.Orchestrator == "" {
+		d.Orchestrator = DeploymentOrchestratorCompose
+	}
 	if d.Status == "" {
 		d.Status = DeploymentStatusValidating
 	}
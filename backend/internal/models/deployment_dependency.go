@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DependencyNodeType identifies the kind of resource in the dependency graph
+type DependencyNodeType string
+
+const (
+	DependencyNodeDeployment        DependencyNodeType = "deployment"         // An app, reverse proxy or dependency stack
+	DependencyNodeSharedDatabase    DependencyNodeType = "shared_database"    // SharedDatabaseInstance
+	DependencyNodeSharedCache       DependencyNodeType = "shared_cache"       // SharedCacheInstance
+	DependencyNodeDedicatedInstance DependencyNodeType = "dedicated_instance" // DedicatedInstance owned by the consumer
+)
+
+// DeploymentDependency is an edge of the dependency graph: a deployment consuming a provider
+// A provider with no edges left is unused and can be garbage-collected
+type DeploymentDependency struct {
+	ID           uuid.UUID          `gorm:"type:uuid;primaryKey" json:"id"`
+	ConsumerID   uuid.UUID          `gorm:"type:uuid;not null;uniqueIndex:idx_deployment_dependencies_edge,priority:1" json:"consumer_id"`
+	ProviderType DependencyNodeType `gorm:"type:varchar(20);not null;uniqueIndex:idx_deployment_dependencies_edge,priority:2;index:idx_deployment_dependencies_provider,priority:1" json:"provider_type"`
+	ProviderID   uuid.UUID          `gorm:"type:uuid;not null;uniqueIndex:idx_deployment_dependencies_edge,priority:3;index:idx_deployment_dependencies_provider,priority:2" json:"provider_id"`
+	Kind         string             `json:"kind"` // What the provider is used for: database, cache, reverse_proxy, application
+	CreatedAt    time.Time          `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *DeploymentDependency) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DeploymentDependency) TableName() string {
+	return "deployment_dependencies"
+}
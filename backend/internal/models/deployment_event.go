@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeploymentEventType categorises a deployment event
+type DeploymentEventType string
+
+const (
+	DeploymentEventStatus DeploymentEventType = "status" // Deployment moved to a new status
+	DeploymentEventStep   DeploymentEventType = "step"   // A named step finished
+	DeploymentEventLog    DeploymentEventType = "log"    // A deployment log line
+)
+
+// DeploymentEventSeverity is how serious an event is
+type DeploymentEventSeverity string
+
+const (
+	DeploymentEventInfo    DeploymentEventSeverity = "info"
+	DeploymentEventWarning DeploymentEventSeverity = "warning"
+	DeploymentEventError   DeploymentEventSeverity = "error"
+)
+
+// DeploymentEvent is one entry in a deployment's structured history
+type DeploymentEvent struct {
+	ID           uuid.UUID               `gorm:"type:uuid;primaryKey" json:"id"`
+	DeploymentID uuid.UUID               `gorm:"type:uuid;not null;index:idx_deployment_events_deployment_created,priority:1" json:"deployment_id"`
+	Type         DeploymentEventType     `gorm:"not null;index" json:"type"`
+	Severity     DeploymentEventSeverity `gorm:"not null" json:"severity"`
+	Phase        DeploymentStatus        `json:"phase,omitempty"` // Deployment status the event happened in
+	Step         string                  `json:"step,omitempty"`  // Step name for step events, e.g. "health_check"
+	Message      string                  `gorm:"type:text" json:"message,omitempty"`
+
+	// Status events
+	FromStatus DeploymentStatus `json:"from_status,omitempty"`
+	ToStatus   DeploymentStatus `json:"to_status,omitempty"`
+
+	// Time spent in FromStatus for status events, or in the step for step events
+	DurationMS *int64 `json:"duration_ms,omitempty"`
+
+	// Structured error; ErrorCode groups similar failures, e.g. "health_check_failed"
+	ErrorCode    string `gorm:"index" json:"error_code,omitempty"`
+	ErrorMessage string `gorm:"type:text" json:"error_message,omitempty"`
+
+	CreatedAt time.Time `gorm:"index:idx_deployment_events_deployment_created,priority:2" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *DeploymentEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DeploymentEvent) TableName() string {
+	return "deployment_events"
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeploymentHealthCheck records the result of a single application-level health probe
+// Rows are kept for a limited window and used to compute per-deployment uptime
+type DeploymentHealthCheck struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	DeploymentID   uuid.UUID `gorm:"type:uuid;not null;index:idx_deployment_health_checked" json:"deployment_id"`
+	CheckedAt      time.Time `gorm:"not null;index:idx_deployment_health_checked" json:"checked_at"`
+	Healthy        bool      `json:"healthy"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	ResponseTimeMs int64     `json:"response_time_ms"`
+	Error          string    `gorm:"type:text" json:"error,omitempty"`
+}
+
+// BeforeCreate hook to generate UUID
+func (h *DeploymentHealthCheck) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	if h.CheckedAt.IsZero() {
+		h.CheckedAt = time.Now()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DeploymentHealthCheck) TableName() string {
+	return "deployment_health_checks"
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeploymentJobType identifies the operation a deployment job performs
+type DeploymentJobType string
+
+const (
+	DeploymentJobDeploy       DeploymentJobType = "deploy"
+	DeploymentJobUpgrade      DeploymentJobType = "upgrade"
+	DeploymentJobConfigUpdate DeploymentJobType = "config_update"
+	DeploymentJobMigrate      DeploymentJobType = "migrate"
+	DeploymentJobAdopt        DeploymentJobType = "adopt"
+	DeploymentJobRestore      DeploymentJobType = "restore"
+)
+
+// DeploymentJobStatus represents where a job is in the queue
+type DeploymentJobStatus string
+
+const (
+	DeploymentJobQueued    DeploymentJobStatus = "queued"
+	DeploymentJobRunning   DeploymentJobStatus = "running"
+	DeploymentJobCompleted DeploymentJobStatus = "completed"
+	DeploymentJobFailed    DeploymentJobStatus = "failed"
+	DeploymentJobCancelled DeploymentJobStatus = "cancelled"
+)
+
+// DeploymentJob is a persisted deployment operation waiting for or holding a worker
+// Jobs survive server restarts: interrupted jobs are resumed or failed on startup
+type DeploymentJob struct {
+	ID             uuid.UUID           `gorm:"type:uuid;primaryKey" json:"id"`
+	DeploymentID   uuid.UUID           `gorm:"type:uuid;not null;index" json:"deployment_id"`
+	Type           DeploymentJobType   `gorm:"not null" json:"type"`
+	Status         DeploymentJobStatus `gorm:"not null;index" json:"status"`
+	DeviceID       uuid.UUID           `gorm:"type:uuid;not null;index" json:"device_id"`
+	TargetDeviceID *uuid.UUID          `gorm:"type:uuid" json:"target_device_id,omitempty"` // Second device held by migrations
+
+	Phase    string `json:"phase,omitempty"` // Last completed phase, used to resume after a restart
+	Attempts int    `gorm:"default:0" json:"attempts"`
+	Error    string `gorm:"type:text" json:"error,omitempty"`
+
+	// Job parameters may contain passwords, so they live in the credential store
+	CredentialKey string `json:"-"`
+
+	// Position among queued jobs (1 = next), computed when listing
+	QueuePosition int `gorm:"-" json:"queue_position,omitempty"`
+
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (j *DeploymentJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DeploymentJob) TableName() string {
+	return "deployment_jobs"
+}
+
+// IsActive reports whether the job is queued or running
+func (j *DeploymentJob) IsActive() bool {
+	return j.Status == DeploymentJobQueued || j.Status == DeploymentJobRunning
+}
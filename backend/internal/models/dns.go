@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DNSProviderType is the kind of DNS server records are managed on
+type DNSProviderType string
+
+const (
+	DNSProviderDnsmasq DNSProviderType = "dnsmasq" // Hosts file read by dnsmasq on a device, managed over SSH
+	DNSProviderPihole  DNSProviderType = "pihole"  // Pi-hole v6 local DNS records over its HTTP API
+	DNSProviderAdGuard DNSProviderType = "adguard" // AdGuard Home DNS rewrites over its HTTP API
+)
+
+// DNSProvider is a local DNS server that gets an A record for every deployment domain
+type DNSProvider struct {
+	ID            uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
+	Name          string          `gorm:"not null;uniqueIndex" json:"name"`
+	Type          DNSProviderType `gorm:"not null" json:"type"`
+	DeviceID      *uuid.UUID      `gorm:"type:uuid;index" json:"device_id,omitempty"` // dnsmasq: device running dnsmasq
+	HostsFile     string          `json:"hosts_file,omitempty"`                       // dnsmasq: hosts file holding the records
+	URL           string          `json:"url,omitempty"`                              // Pi-hole and AdGuard Home: base URL of the web interface
+	Username      string          `json:"username,omitempty"`                         // AdGuard Home login
+	CredentialKey string          `json:"-"`                                          // Password in the credential store, never expose in JSON
+	Enabled       bool            `gorm:"default:true" json:"enabled"`
+	LastSyncAt    *time.Time      `json:"last_sync_at,omitempty"`
+	LastError     string          `gorm:"type:text" json:"last_error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *DNSProvider) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DNSProvider) TableName() string {
+	return "dns_providers"
+}
+
+// DNSRecord is an A record the platform created on a provider for a deployment's domain
+// Records on the provider without a row here were added by hand and are never touched
+type DNSRecord struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ProviderID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_dns_record_provider_domain" json:"provider_id"`
+	Domain       string    `gorm:"not null;uniqueIndex:idx_dns_record_provider_domain" json:"domain"`
+	IPAddress    string    `gorm:"not null" json:"ip_address"`
+	DeploymentID uuid.UUID `gorm:"type:uuid;not null;index" json:"deployment_id"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *DNSRecord) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (DNSRecord) TableName() string {
+	return "dns_records"
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PortAllocation records a host port published by a deployment
+// Shared and dedicated instances keep their port on their own record
+type PortAllocation struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	DeviceID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_port_allocations_device_port,priority:1" json:"device_id"`
+	Port         int       `gorm:"not null;uniqueIndex:idx_port_allocations_device_port,priority:2" json:"port"`
+	Protocol     string    `gorm:"type:varchar(3);not null;uniqueIndex:idx_port_allocations_device_port,priority:3" json:"protocol"` // tcp or udp
+	DeploymentID uuid.UUID `gorm:"type:uuid;not null;index" json:"deployment_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *PortAllocation) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (PortAllocation) TableName() string {
+	return "port_allocations"
+}
+
+// PortReservation keeps a range of ports on a device out of use by deployments and automatic assignment
+type PortReservation struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	DeviceID    uuid.UUID `gorm:"type:uuid;not null;index" json:"device_id"`
+	StartPort   int       `gorm:"not null" json:"start_port"`
+	EndPort     int       `gorm:"not null" json:"end_port"` // Inclusive
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Contains reports whether port is in the reserved range
+func (r *PortReservation) Contains(port int) bool {
+	return port >= r.StartPort && port <= r.EndPort
+}
+
+// BeforeCreate hook to generate UUID
+func (r *PortReservation) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (PortReservation) TableName() string {
+	return "port_reservations"
+}
@@ -160,11 +160,19 @@ type RecipeVolumeConfig struct {
 
 // RecipePostInstallStep defines a post-installation action
 type RecipePostInstallStep struct {
-	Type    string `yaml:"type" json:"type"`       // "message", "command", "webhook"
-	Title   string `yaml:"title,omitempty" json:"title,omitempty"`
-	Message string `yaml:"message,omitempty" json:"message,omitempty"`
-	Command string `yaml:"command,omitempty" json:"command,omitempty"`
-	URL     string `yaml:"url,omitempty" json:"url,omitempty"`
+	Type      string `yaml:"type" json:"type"`       // "message", "command", "webhook"
+	Title     string `yaml:"title,omitempty" json:"title,omitempty"`
+	Message   string `yaml:"message,omitempty" json:"message,omitempty"`
+	Command   string `yaml:"command,omitempty" json:"command,omitempty"`
+	Service   string `yaml:"service,omitempty" json:"service,omitempty"`       // Compose service a command runs in
+	User      string `yaml:"user,omitempty" json:"user,omitempty"`             // Container user for commands (e.g., "www-data")
+	URL       string `yaml:"url,omitempty" json:"url,omitempty"`
+	OnFailure string `yaml:"on_failure,omitempty" json:"on_failure,omitempty"` // "warn" (default) or "fail"
+}
+
+// IsFatal reports whether a failure of this step should fail the deployment
+func (s RecipePostInstallStep) IsFatal() bool {
+	return s.OnFailure == "fail"
 }
 
 // RecipeHealthConfig defines health monitoring configuration
@@ -200,6 +208,8 @@ type RecipeDependency struct {
 	Name          string   `yaml:"name,omitempty" json:"name,omitempty"`               // Specific app name (for application dependencies)
 	Engine        string   `yaml:"engine,omitempty" json:"engine,omitempty"`           // Database/cache engine (for database/cache dependencies)
 	MinVersion    string   `yaml:"min_version,omitempty" json:"min_version,omitempty"` // Minimum version required
+	Version       string   `yaml:"version,omitempty" json:"version,omitempty"`         // Exact version for dedicated database/cache instances
+	Image         string   `yaml:"image,omitempty" json:"image,omitempty"`             // Image override for dedicated instances (e.g., "pgvector/pgvector")
 	Prefer        string   `yaml:"prefer,omitempty" json:"prefer,omitempty"`           // Preferred option (e.g., "traefik")
 	Alternatives  []string `yaml:"alternatives,omitempty" json:"alternatives,omitempty"` // Alternative options
 	Shared        bool     `yaml:"shared,omitempty" json:"shared,omitempty"`           // Use shared instance (default true for DB/cache)
@@ -291,6 +301,11 @@ func (r *Recipe) Validate() error {
 		return fmt.Errorf("dependencies: %w", err)
 	}
 
+	// Validate post-install steps
+	if err := r.ValidatePostInstall(); err != nil {
+		return fmt.Errorf("post_install: %w", err)
+	}
+
 	return nil
 }
 
@@ -389,6 +404,34 @@ func (r *Recipe) ValidateDependencies() error {
 	return nil
 }
 
+// ValidatePostInstall validates post-install step configuration
+func (r *Recipe) ValidatePostInstall() error {
+	for i, step := range r.PostInstall {
+		switch step.Type {
+		case "message":
+			if step.Message == "" {
+				return fmt.Errorf("step %d: message step must specify message", i)
+			}
+		case "command":
+			if step.Command == "" || step.Service == "" {
+				return fmt.Errorf("step %d: command step must specify command and service", i)
+			}
+		case "webhook":
+			if !strings.HasPrefix(step.URL, "http://") && !strings.HasPrefix(step.URL, "https://") {
+				return fmt.Errorf("step %d: webhook step must specify an http(s) url", i)
+			}
+		default:
+			return fmt.Errorf("step %d: invalid type: %s (must be 'message', 'command', or 'webhook')", i, step.Type)
+		}
+
+		if step.OnFailure != "" && step.OnFailure != "warn" && step.OnFailure != "fail" {
+			return fmt.Errorf("step %d: invalid on_failure: %s (must be 'warn' or 'fail')", i, step.OnFailure)
+		}
+	}
+
+	return nil
+}
+
 // validateDependency validates a single dependency configuration
 func validateDependency(dep RecipeDependency) error {
 	// Type is required
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RemediationAction is a step taken by the self-healing engine
+type RemediationAction string
+
+const (
+	// RemediationActionRestart restarts the deployment's containers in place
+	RemediationActionRestart RemediationAction = "restart"
+	// RemediationActionRedeploy recreates the containers from the stored compose file
+	RemediationActionRedeploy RemediationAction = "redeploy"
+	// RemediationActionFail gives up, marks the deployment failed and alerts
+	RemediationActionFail RemediationAction = "fail"
+)
+
+// RemediationPolicy controls how the self-healing engine reacts to an unhealthy deployment
+// Escalation order: restart (up to MaxRestarts) -> redeploy (up to MaxRedeploys) -> fail
+type RemediationPolicy struct {
+	ID                uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	DeploymentID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"deployment_id"`
+	Enabled           bool      `gorm:"default:true" json:"enabled"`
+	MaxRestarts       int       `gorm:"default:3" json:"max_restarts"`
+	MaxRedeploys      int       `gorm:"default:1" json:"max_redeploys"`
+	BackoffSeconds    int       `gorm:"default:30" json:"backoff_seconds"`      // Wait after the first action, doubled after each attempt
+	MaxBackoffSeconds int       `gorm:"default:900" json:"max_backoff_seconds"` // Upper bound for the doubled wait
+
+	// Escalation state, reset once the deployment is healthy again
+	RestartAttempts  int               `gorm:"default:0" json:"restart_attempts"`
+	RedeployAttempts int               `gorm:"default:0" json:"redeploy_attempts"`
+	LastAction       RemediationAction `json:"last_action,omitempty"`
+	LastActionAt     *time.Time        `json:"last_action_at,omitempty"`
+	NextAttemptAt    *time.Time        `json:"next_attempt_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *RemediationPolicy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName overrides the default table name
+func (RemediationPolicy) TableName() string {
+	return "remediation_policies"
+}
+
+// TotalAttempts returns the number of remediation actions taken in the current escalation
+func (p *RemediationPolicy) TotalAttempts() int {
+	return p.RestartAttempts + p.RedeployAttempts
+}
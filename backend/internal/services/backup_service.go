@@ -0,0 +1,979 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+	"gorm.io/gorm"
+)
+
+// backupHelperImage is the image used to read and write volume contents
+const backupHelperImage = "alpine:3.20"
+
+// defaultKeepLast is how many recent snapshots a policy keeps when the request doesn't say
+const defaultKeepLast = 7
+
+// nfsBackupMountRoot is where NFS destinations are mounted on deployment devices
+const nfsBackupMountRoot = "/mnt/homelab-backups"
+
+// volumeNameRegex matches Docker volume names
+var volumeNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// backupFrequencies maps recipe backup_frequency values to intervals
+var backupFrequencies = map[string]time.Duration{
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+}
+
+// backupPriorityOrder orders volumes so the most important data is archived first
+var backupPriorityOrder = map[string]int{
+	"high":   0,
+	"medium": 1,
+	"low":    2,
+}
+
+// BackupService snapshots deployment volumes into tar archives on a backup destination
+type BackupService struct {
+	db            *gorm.DB
+	sshClient     *ssh.Client
+	recipeLoader  RecipeProvider
+	wsHub         WSHub
+	checkInterval time.Duration
+	cancel        context.CancelFunc
+	activeBackups sync.Map // map[uuid.UUID]bool - deployments with a backup or restore in flight
+}
+
+// CreateBackupDestinationRequest represents a request to add a backup destination
+type CreateBackupDestinationRequest struct {
+	Name        string                       `json:"name" validate:"required"`
+	Type        models.BackupDestinationType `json:"type" validate:"required"`
+	Path        string                       `json:"path" validate:"required"`
+	NFSServerIP string                       `json:"nfs_server_ip,omitempty"`
+	NFSOptions  string                       `json:"nfs_options,omitempty"`
+}
+
+// CreateBackupPolicyRequest represents a request to add a backup policy
+type CreateBackupPolicyRequest struct {
+	Name           string    `json:"name" validate:"required"`
+	Description    string    `json:"description,omitempty"`
+	DestinationID  uuid.UUID `json:"destination_id" validate:"required"`
+	IsDefault      bool      `json:"is_default"`
+	StopContainers bool      `json:"stop_containers"`
+	KeepLast       *int      `json:"keep_last,omitempty"` // Defaults to defaultKeepLast; 0 keeps none by count
+	KeepDaily      int       `json:"keep_daily"`
+	KeepWeekly     int       `json:"keep_weekly"`
+	KeepMonthly    int       `json:"keep_monthly"`
+}
+
+// CreateBackupRequest represents a request to back up a deployment
+// All fields are optional; the default policy is used when no destination is given
+type CreateBackupRequest struct {
+	DestinationID  *uuid.UUID `json:"destination_id,omitempty"`
+	Volumes        []string   `json:"volumes,omitempty"` // Compose volume names (default: all)
+	StopContainers *bool      `json:"stop_containers,omitempty"`
+}
+
+// RestoreBackupRequest represents a request to restore a snapshot
+type RestoreBackupRequest struct {
+	Volumes       []string `json:"volumes,omitempty"`        // Compose volume names (default: all in snapshot)
+	RestoreConfig bool     `json:"restore_config,omitempty"` // Also restore docker-compose.yml and .env
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(db *gorm.DB, sshClient *ssh.Client, recipeLoader RecipeProvider, wsHub WSHub) *BackupService {
+	return &BackupService{
+		db:            db,
+		sshClient:     sshClient,
+		recipeLoader:  recipeLoader,
+		wsHub:         wsHub,
+		checkInterval: 1 * time.Hour,
+	}
+}
+
+// CreateDestination validates and stores a new backup destination
+func (s *BackupService) CreateDestination(req CreateBackupDestinationRequest) (*models.BackupDestination, error) {
+	destination := &models.BackupDestination{
+		Name:        req.Name,
+		Type:        req.Type,
+		Path:        strings.TrimRight(req.Path, "/"),
+		NFSServerIP: req.NFSServerIP,
+		NFSOptions:  req.NFSOptions,
+		Enabled:     true,
+	}
+
+	if err := validateBackupDestination(destination); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(destination).Error; err != nil {
+		return nil, fmt.Errorf("failed to create backup destination: %w", err)
+	}
+
+	log.Printf("[Backup] Created %s destination %s (%s)", destination.Type, destination.Name, destination.Path)
+	return destination, nil
+}
+
+// ListDestinations returns all backup destinations
+func (s *BackupService) ListDestinations() ([]models.BackupDestination, error) {
+	var destinations []models.BackupDestination
+	if err := s.db.Order("name").Find(&destinations).Error; err != nil {
+		return nil, err
+	}
+	return destinations, nil
+}
+
+// DeleteDestination removes a backup destination that is not referenced by a policy
+// Archives already written to the destination are left in place
+func (s *BackupService) DeleteDestination(id uuid.UUID) error {
+	var count int64
+	if err := s.db.Model(&models.BackupPolicy{}).Where("destination_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("backup destination is used by %d policies", count)
+	}
+
+	result := s.db.Delete(&models.BackupDestination{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete backup destination: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("backup destination not found")
+	}
+	return nil
+}
+
+// CreatePolicy stores a new backup policy
+// Making a policy the default clears the flag on every other policy
+func (s *BackupService) CreatePolicy(req CreateBackupPolicyRequest) (*models.BackupPolicy, error) {
+	keepLast := defaultKeepLast
+	if req.KeepLast != nil {
+		keepLast = *req.KeepLast
+	}
+	if keepLast < 0 || req.KeepDaily < 0 || req.KeepWeekly < 0 || req.KeepMonthly < 0 {
+		return nil, fmt.Errorf("retention counts cannot be negative")
+	}
+
+	var destination models.BackupDestination
+	if err := s.db.First(&destination, "id = ?", req.DestinationID).Error; err != nil {
+		return nil, fmt.Errorf("backup destination not found")
+	}
+
+	policy := &models.BackupPolicy{
+		Name:           req.Name,
+		Description:    req.Description,
+		IsDefault:      req.IsDefault,
+		Enabled:        true,
+		DestinationID:  req.DestinationID,
+		StopContainers: req.StopContainers,
+		KeepLast:       keepLast,
+		KeepDaily:      req.KeepDaily,
+		KeepWeekly:     req.KeepWeekly,
+		KeepMonthly:    req.KeepMonthly,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if policy.IsDefault {
+			if err := tx.Model(&models.BackupPolicy{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(policy).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup policy: %w", err)
+	}
+
+	policy.Destination = &destination
+	return policy, nil
+}
+
+// ListPolicies returns all backup policies with their destinations
+func (s *BackupService) ListPolicies() ([]models.BackupPolicy, error) {
+	var policies []models.BackupPolicy
+	if err := s.db.Preload("Destination").Order("name").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// ListSnapshots returns all snapshots for a deployment, newest first
+func (s *BackupService) ListSnapshots(deploymentID uuid.UUID) ([]models.BackupSnapshot, error) {
+	var snapshots []models.BackupSnapshot
+	if err := s.db.Preload("Destination").
+		Where("deployment_id = ?", deploymentID).
+		Order("started_at DESC").
+		Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// StartBackup creates a snapshot record and runs the backup in the background
+func (s *BackupService) StartBackup(deploymentID uuid.UUID, req CreateBackupRequest) (*models.BackupSnapshot, error) {
+	job, err := s.prepareBackup(deploymentID, req, models.SnapshotTriggerManual)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.runBackup(job)
+
+	return job.snapshot, nil
+}
+
+// CreateSnapshot backs up a deployment synchronously and returns the finished snapshot
+// Used by other services that need a snapshot before continuing (e.g. upgrades)
+func (s *BackupService) CreateSnapshot(deploymentID uuid.UUID, req CreateBackupRequest, trigger models.SnapshotTrigger) (*models.BackupSnapshot, error) {
+	job, err := s.prepareBackup(deploymentID, req, trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.runBackup(job); err != nil {
+		return job.snapshot, err
+	}
+	return job.snapshot, nil
+}
+
+// backupJob holds everything resolved before a backup runs
+type backupJob struct {
+	snapshot       *models.BackupSnapshot
+	deployment     *models.Deployment
+	device         *models.Device
+	destination    *models.BackupDestination
+	policy         *models.BackupPolicy
+	volumes        []string
+	stopContainers bool
+}
+
+// prepareBackup resolves the deployment, destination and policy and records an in-progress snapshot
+func (s *BackupService) prepareBackup(deploymentID uuid.UUID, req CreateBackupRequest, trigger models.SnapshotTrigger) (*backupJob, error) {
+	deployment, device, err := s.getDeploymentAndDevice(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isValidStackName(deployment.ComposeProject) {
+		return nil, fmt.Errorf("deployment has no valid compose project")
+	}
+
+	for _, volume := range req.Volumes {
+		if !volumeNameRegex.MatchString(volume) {
+			return nil, fmt.Errorf("invalid volume name: %s", volume)
+		}
+	}
+
+	policy, err := s.getDefaultPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	var destination *models.BackupDestination
+	if req.DestinationID != nil {
+		var dest models.BackupDestination
+		if err := s.db.First(&dest, "id = ?", *req.DestinationID).Error; err != nil {
+			return nil, fmt.Errorf("backup destination not found")
+		}
+		destination = &dest
+		// Only apply the default policy's retention to its own destination
+		if policy != nil && policy.DestinationID != dest.ID {
+			policy = nil
+		}
+	} else {
+		if policy == nil {
+			return nil, fmt.Errorf("no destination specified and no default backup policy configured")
+		}
+		destination = policy.Destination
+	}
+
+	if !destination.Enabled {
+		return nil, fmt.Errorf("backup destination %s is disabled", destination.Name)
+	}
+
+	stopContainers := policy != nil && policy.StopContainers
+	if req.StopContainers != nil {
+		stopContainers = *req.StopContainers
+	}
+
+	if !s.tryLock(deploymentID) {
+		return nil, fmt.Errorf("a backup or restore is already in progress for this deployment")
+	}
+
+	snapshot := &models.BackupSnapshot{
+		DeploymentID:  deployment.ID,
+		DeviceID:      device.ID,
+		DestinationID: destination.ID,
+		Trigger:       trigger,
+		Status:        models.SnapshotStatusInProgress,
+		StartedAt:     time.Now(),
+	}
+	if policy != nil {
+		snapshot.PolicyID = &policy.ID
+	}
+
+	if err := s.db.Create(snapshot).Error; err != nil {
+		s.unlock(deploymentID)
+		return nil, fmt.Errorf("failed to create snapshot record: %w", err)
+	}
+	snapshot.Destination = destination
+
+	return &backupJob{
+		snapshot:       snapshot,
+		deployment:     deployment,
+		device:         device,
+		destination:    destination,
+		policy:         policy,
+		volumes:        req.Volumes,
+		stopContainers: stopContainers,
+	}, nil
+}
+
+// runBackup archives the deployment's volumes and records the result
+func (s *BackupService) runBackup(job *backupJob) error {
+	defer s.unlock(job.deployment.ID)
+
+	snapshot := job.snapshot
+	project := job.deployment.ComposeProject
+	host := job.device.GetSSHHost()
+
+	log.Printf("[Backup] Starting %s backup of %s to %s", snapshot.Trigger, project, job.destination.Name)
+	s.broadcast(snapshot)
+
+	err := func() error {
+		root, err := s.prepareDestination(host, job.destination)
+		if err != nil {
+			return err
+		}
+
+		volumes, err := s.resolveVolumes(host, job.deployment, job.volumes)
+		if err != nil {
+			return err
+		}
+		if len(volumes) == 0 {
+			return fmt.Errorf("deployment has no volumes to back up")
+		}
+
+		volumesJSON, _ := json.Marshal(volumes)
+		snapshot.Volumes = volumesJSON
+		snapshot.ArchivePath = fmt.Sprintf("%s/%s-%s", project, snapshot.StartedAt.UTC().Format("20060102-150405"), snapshot.ID.String()[:8])
+		snapshotDir := fmt.Sprintf("%s/%s", root, snapshot.ArchivePath)
+
+		if _, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo mkdir -p %s", snapshotDir), 30*time.Second); err != nil {
+			return fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+
+		deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+
+		// Only a deployment that was up is started again; a stopped one stays stopped
+		wasUp := job.deployment.Status == models.DeploymentStatusRunning || job.deployment.Status == models.DeploymentStatusUnhealthy
+		if job.stopContainers && wasUp {
+			stopCmd := fmt.Sprintf("cd %s && docker compose -p %s stop", deployDir, project)
+			if output, err := s.sshClient.ExecuteWithTimeout(host, stopCmd, 2*time.Minute); err != nil {
+				return fmt.Errorf("failed to stop containers: %w (output: %s)", err, output)
+			}
+			defer func() {
+				startCmd := fmt.Sprintf("cd %s && docker compose -p %s start", deployDir, project)
+				if output, err := s.sshClient.ExecuteWithTimeout(host, startCmd, 2*time.Minute); err != nil {
+					log.Printf("[Backup] Warning: failed to restart %s after backup: %v (output: %s)", project, err, output)
+				}
+			}()
+		}
+
+		for _, volume := range volumes {
+			archiveCmd := fmt.Sprintf("docker run --rm -v %s_%s:/source:ro -v %s:/backup %s tar czf /backup/%s.tar.gz -C /source .",
+				project, volume, snapshotDir, backupHelperImage, volume)
+			if output, err := s.sshClient.ExecuteWithTimeout(host, archiveCmd, 1*time.Hour); err != nil {
+				return fmt.Errorf("failed to archive volume %s: %w (output: %s)", volume, err, output)
+			}
+			log.Printf("[Backup] Archived volume %s_%s", project, volume)
+		}
+
+		// Keep the compose and env files so a snapshot can bring back the exact configuration
+		configCmd := fmt.Sprintf("sudo cp %s/docker-compose.yml %s/ 2>/dev/null; sudo cp %s/.env %s/ 2>/dev/null; true",
+			deployDir, snapshotDir, deployDir, snapshotDir)
+		if _, err := s.sshClient.ExecuteWithTimeout(host, configCmd, 30*time.Second); err != nil {
+			log.Printf("[Backup] Warning: failed to copy compose files for %s: %v", project, err)
+		}
+
+		sizeOutput, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo du -sb %s | cut -f1", snapshotDir), 1*time.Minute)
+		if err == nil {
+			snapshot.SizeBytes, _ = strconv.ParseInt(strings.TrimSpace(sizeOutput), 10, 64)
+		}
+
+		return nil
+	}()
+
+	completedAt := time.Now()
+	snapshot.CompletedAt = &completedAt
+	snapshot.Duration = int(completedAt.Sub(snapshot.StartedAt).Seconds())
+
+	if err != nil {
+		snapshot.Status = models.SnapshotStatusFailed
+		snapshot.ErrorMessage = err.Error()
+		s.db.Save(snapshot)
+		s.broadcast(snapshot)
+		log.Printf("[Backup] Backup of %s failed: %v", project, err)
+		return err
+	}
+
+	snapshot.Status = models.SnapshotStatusSuccess
+	s.db.Save(snapshot)
+	s.db.Model(job.destination).Update("last_backup_at", completedAt)
+	s.broadcast(snapshot)
+	log.Printf("[Backup] Backup of %s completed (%d bytes in %ds)", project, snapshot.SizeBytes, snapshot.Duration)
+
+	if job.policy != nil {
+		s.enforceRetention(host, job.deployment.ID, job.destination, job.policy)
+	}
+
+	return nil
+}
+
+// snapshotRestore holds everything resolved before a snapshot is restored
+type snapshotRestore struct {
+	snapshot   *models.BackupSnapshot
+	deployment *models.Deployment
+	device     *models.Device
+	volumes    []string
+}
+
+// ValidateRestore checks that a snapshot can be restored into its deployment without touching the device
+// Used to reject a restore before it is queued
+func (s *BackupService) ValidateRestore(deploymentID uuid.UUID, snapshotID uuid.UUID, req RestoreBackupRequest) error {
+	if _, err := s.resolveRestore(deploymentID, snapshotID, req); err != nil {
+		return err
+	}
+	if s.IsBusy(deploymentID) {
+		return fmt.Errorf("a backup or restore is already in progress for this deployment")
+	}
+	return nil
+}
+
+// resolveRestore loads the snapshot and deployment and works out which volumes to restore
+func (s *BackupService) resolveRestore(deploymentID uuid.UUID, snapshotID uuid.UUID, req RestoreBackupRequest) (*snapshotRestore, error) {
+	var snapshot models.BackupSnapshot
+	if err := s.db.Preload("Destination").First(&snapshot, "id = ? AND deployment_id = ?", snapshotID, deploymentID).Error; err != nil {
+		return nil, fmt.Errorf("snapshot not found")
+	}
+
+	if snapshot.Status != models.SnapshotStatusSuccess {
+		return nil, fmt.Errorf("snapshot cannot be restored (status: %s)", snapshot.Status)
+	}
+	if snapshot.Destination == nil {
+		return nil, fmt.Errorf("snapshot destination no longer exists")
+	}
+
+	deployment, device, err := s.getDeploymentAndDevice(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Local archives live on the device the snapshot was taken on, which a migration may have left behind
+	if snapshot.Destination.Type == models.BackupDestinationLocal && snapshot.DeviceID != deployment.DeviceID {
+		return nil, fmt.Errorf("snapshot is stored on another device; local snapshots can only be restored on the device they were taken on")
+	}
+
+	var snapshotVolumes []string
+	if err := json.Unmarshal(snapshot.Volumes, &snapshotVolumes); err != nil {
+		return nil, fmt.Errorf("snapshot has no volume list: %w", err)
+	}
+
+	volumes := snapshotVolumes
+	if len(req.Volumes) > 0 {
+		volumes = []string{}
+		for _, requested := range req.Volumes {
+			if !containsString(snapshotVolumes, requested) {
+				return nil, fmt.Errorf("volume %s is not part of this snapshot", requested)
+			}
+			volumes = append(volumes, requested)
+		}
+	}
+
+	return &snapshotRestore{snapshot: &snapshot, deployment: deployment, device: device, volumes: volumes}, nil
+}
+
+// RestoreSnapshot restores volumes (and optionally config files) from a snapshot and waits for it to finish
+// The deployment's containers are stopped for the duration of the restore. Restores requested through the
+// API run as deployment jobs; see DeploymentService.RestoreBackup.
+func (s *BackupService) RestoreSnapshot(deploymentID uuid.UUID, snapshotID uuid.UUID, req RestoreBackupRequest) error {
+	restore, err := s.resolveRestore(deploymentID, snapshotID, req)
+	if err != nil {
+		return err
+	}
+	snapshot, deployment, device, volumes := restore.snapshot, restore.deployment, restore.device, restore.volumes
+
+	if !s.tryLock(deploymentID) {
+		return fmt.Errorf("a backup or restore is already in progress for this deployment")
+	}
+	defer s.unlock(deploymentID)
+
+	project := deployment.ComposeProject
+	host := device.GetSSHHost()
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+
+	root, err := s.prepareDestination(host, snapshot.Destination)
+	if err != nil {
+		return err
+	}
+	snapshotDir := fmt.Sprintf("%s/%s", root, snapshot.ArchivePath)
+	if !isValidDeployPath(snapshotDir) {
+		return fmt.Errorf("invalid snapshot path: %s", snapshotDir)
+	}
+
+	// Make sure every archive is there before anything is stopped or overwritten
+	for _, volume := range volumes {
+		checkCmd := fmt.Sprintf("sudo test -f %s/%s.tar.gz", snapshotDir, volume)
+		if _, err := s.sshClient.ExecuteWithTimeout(host, checkCmd, 30*time.Second); err != nil {
+			return fmt.Errorf("archive of volume %s is missing from the snapshot", volume)
+		}
+	}
+	if req.RestoreConfig {
+		if _, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo test -f %s/docker-compose.yml", snapshotDir), 30*time.Second); err != nil {
+			return fmt.Errorf("compose file is missing from the snapshot")
+		}
+	}
+
+	log.Printf("[Backup] Restoring %s from snapshot %s", project, snapshot.ID)
+
+	// Archives are unpacked into staging volumes first, so a corrupt archive never touches the live data
+	staging := make(map[string]string, len(volumes))
+	defer func() {
+		for _, stagingVolume := range staging {
+			if output, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("docker volume rm -f %s", stagingVolume), 1*time.Minute); err != nil {
+				log.Printf("[Backup] Warning: failed to remove staging volume %s: %v (output: %s)", stagingVolume, err, output)
+			}
+		}
+	}()
+	for _, volume := range volumes {
+		stagingVolume := fmt.Sprintf("%s_%s_restore", project, volume)
+		staging[volume] = stagingVolume
+		extractCmd := fmt.Sprintf("docker volume rm -f %s >/dev/null && docker run --rm -v %s:/staging -v %s:/backup:ro %s tar xzf /backup/%s.tar.gz -C /staging",
+			stagingVolume, stagingVolume, snapshotDir, backupHelperImage, volume)
+		if output, err := s.sshClient.ExecuteWithTimeout(host, extractCmd, 1*time.Hour); err != nil {
+			return fmt.Errorf("failed to extract volume %s: %w (output: %s)", volume, err, output)
+		}
+	}
+
+	stopCmd := fmt.Sprintf("cd %s && docker compose -p %s stop", deployDir, project)
+	if output, err := s.sshClient.ExecuteWithTimeout(host, stopCmd, 2*time.Minute); err != nil {
+		return fmt.Errorf("failed to stop containers: %w (output: %s)", err, output)
+	}
+
+	// Bring the deployment back up if it was up before the restore, whether or not the restore worked
+	wasUp := deployment.Status == models.DeploymentStatusRunning || deployment.Status == models.DeploymentStatusUnhealthy
+	err = func() error {
+		if req.RestoreConfig {
+			configCmd := fmt.Sprintf("sudo cp %s/docker-compose.yml %s/ && (sudo cp %s/.env %s/ 2>/dev/null || true)",
+				snapshotDir, deployDir, snapshotDir, deployDir)
+			if output, err := s.sshClient.ExecuteWithTimeout(host, configCmd, 30*time.Second); err != nil {
+				return fmt.Errorf("failed to restore compose files: %w (output: %s)", err, output)
+			}
+		}
+
+		for _, volume := range volumes {
+			swapCmd := fmt.Sprintf("docker run --rm -v %s_%s:/target -v %s:/staging:ro %s sh -c 'find /target -mindepth 1 -delete && cp -a /staging/. /target/'",
+				project, volume, staging[volume], backupHelperImage)
+			if output, err := s.sshClient.ExecuteWithTimeout(host, swapCmd, 1*time.Hour); err != nil {
+				return fmt.Errorf("failed to restore volume %s: %w (output: %s)", volume, err, output)
+			}
+			log.Printf("[Backup] Restored volume %s_%s", project, volume)
+		}
+		return nil
+	}()
+
+	if wasUp {
+		upCmd := fmt.Sprintf("cd %s && docker compose -p %s up -d", deployDir, project)
+		if output, upErr := s.sshClient.ExecuteWithTimeout(host, upCmd, 5*time.Minute); upErr != nil {
+			if err != nil {
+				return fmt.Errorf("%w; containers could not be started again: %v (output: %s)", err, upErr, output)
+			}
+			return fmt.Errorf("failed to start containers after restore: %w (output: %s)", upErr, output)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[Backup] Restore of %s from snapshot %s completed", project, snapshot.ID)
+	return nil
+}
+
+// Start begins the background loop that takes scheduled backups
+func (s *BackupService) Start(ctx context.Context) {
+	log.Println("[Backup] Starting backup scheduler")
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	ticker := time.NewTicker(s.checkInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Println("[Backup] Backup scheduler stopped")
+				return
+			case <-ticker.C:
+				s.runScheduledBackups(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the background backup loop
+func (s *BackupService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// runScheduledBackups backs up every running or unhealthy deployment whose recipe volumes are due
+// Backups run sequentially to avoid saturating device disks and the network
+func (s *BackupService) runScheduledBackups(ctx context.Context) {
+	policy, err := s.getDefaultPolicy()
+	if err != nil || policy == nil || !policy.Enabled {
+		return
+	}
+
+	var deployments []models.Deployment
+	// An unhealthy app still holds data worth keeping
+	if err := s.db.Where("status IN ?", []models.DeploymentStatus{models.DeploymentStatusRunning, models.DeploymentStatusUnhealthy}).Find(&deployments).Error; err != nil {
+		log.Printf("[Backup] Error fetching deployments: %v", err)
+		return
+	}
+
+	for _, deployment := range deployments {
+		if ctx.Err() != nil {
+			return
+		}
+
+		recipeVolumes := s.getRecipeVolumes(deployment.RecipeSlug)
+		if len(recipeVolumes) == 0 {
+			continue
+		}
+
+		var last models.BackupSnapshot
+		var lastAt *time.Time
+		if err := s.db.Where("deployment_id = ? AND status = ?", deployment.ID, models.SnapshotStatusSuccess).
+			Order("started_at DESC").First(&last).Error; err == nil {
+			lastAt = &last.StartedAt
+		}
+
+		if !isBackupDue(recipeVolumes, lastAt, time.Now()) {
+			continue
+		}
+
+		if _, err := s.CreateSnapshot(deployment.ID, CreateBackupRequest{}, models.SnapshotTriggerScheduled); err != nil {
+			log.Printf("[Backup] Scheduled backup of %s failed: %v", deployment.ComposeProject, err)
+		}
+	}
+}
+
+// enforceRetention deletes snapshots that fall outside the policy's retention rules
+func (s *BackupService) enforceRetention(host string, deploymentID uuid.UUID, destination *models.BackupDestination, policy *models.BackupPolicy) {
+	var snapshots []models.BackupSnapshot
+	if err := s.db.Where("deployment_id = ? AND destination_id = ? AND status = ?", deploymentID, destination.ID, models.SnapshotStatusSuccess).
+		Order("started_at DESC").Find(&snapshots).Error; err != nil {
+		log.Printf("[Backup] Warning: failed to load snapshots for retention: %v", err)
+		return
+	}
+
+	prune := selectSnapshotsToPrune(snapshots, policy)
+	if len(prune) == 0 {
+		return
+	}
+
+	root, err := s.prepareDestination(host, destination)
+	if err != nil {
+		log.Printf("[Backup] Warning: cannot enforce retention: %v", err)
+		return
+	}
+
+	for _, snapshot := range prune {
+		snapshotDir := fmt.Sprintf("%s/%s", root, snapshot.ArchivePath)
+		if snapshot.ArchivePath == "" || !isValidDeployPath(snapshotDir) {
+			continue
+		}
+		if _, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo rm -rf %s", snapshotDir), 5*time.Minute); err != nil {
+			log.Printf("[Backup] Warning: failed to delete snapshot %s: %v", snapshot.ID, err)
+			continue
+		}
+		s.db.Delete(&models.BackupSnapshot{}, "id = ?", snapshot.ID)
+	}
+
+	log.Printf("[Backup] Retention removed %d snapshots", len(prune))
+}
+
+// prepareDestination makes the destination available on host and returns its root directory
+func (s *BackupService) prepareDestination(host string, destination *models.BackupDestination) (string, error) {
+	if err := validateBackupDestination(destination); err != nil {
+		return "", err
+	}
+
+	switch destination.Type {
+	case models.BackupDestinationLocal:
+		if _, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo mkdir -p %s", destination.Path), 30*time.Second); err != nil {
+			return "", fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		return destination.Path, nil
+
+	case models.BackupDestinationNFS:
+		mountPoint := fmt.Sprintf("%s/%s", nfsBackupMountRoot, destination.ID)
+		options := destination.NFSOptions
+		if options == "" {
+			options = "defaults"
+		}
+		mountCmd := fmt.Sprintf("sudo mkdir -p %s && (mountpoint -q %s || sudo mount -t nfs -o %s %s:%s %s)",
+			mountPoint, mountPoint, options, destination.NFSServerIP, destination.Path, mountPoint)
+		if output, err := s.sshClient.ExecuteWithTimeout(host, mountCmd, 1*time.Minute); err != nil {
+			return "", fmt.Errorf("failed to mount NFS backup destination: %w (output: %s)", err, output)
+		}
+		return mountPoint, nil
+	}
+
+	return "", fmt.Errorf("unsupported backup destination type: %s", destination.Type)
+}
+
+// resolveVolumes returns the compose volume names to back up, highest priority first
+func (s *BackupService) resolveVolumes(host string, deployment *models.Deployment, requested []string) ([]string, error) {
+	existing, err := listProjectVolumes(s.sshClient, host, deployment.ComposeProject)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(requested) > 0 {
+		for _, volume := range requested {
+			if !containsString(existing, volume) {
+				return nil, fmt.Errorf("volume %s not found for deployment", volume)
+			}
+		}
+		existing = requested
+	}
+
+	return sortVolumesByPriority(existing, s.getRecipeVolumes(deployment.RecipeSlug)), nil
+}
+
+// listProjectVolumes returns the compose volume names (without the project prefix) of a project on a host
+func listProjectVolumes(sshClient *ssh.Client, host string, project string) ([]string, error) {
+	listCmd := fmt.Sprintf("docker volume ls -q --filter label=com.docker.compose.project=%s", project)
+	output, err := sshClient.ExecuteWithTimeout(host, listCmd, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	volumes := []string{}
+	prefix := project + "_"
+	for _, line := range strings.Split(output, "\n") {
+		name := strings.TrimSpace(line)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		volume := strings.TrimPrefix(name, prefix)
+		if volumeNameRegex.MatchString(volume) {
+			volumes = append(volumes, volume)
+		}
+	}
+	return volumes, nil
+}
+
+// getRecipeVolumes returns the recipe's volume metadata, or nil if unavailable
+func (s *BackupService) getRecipeVolumes(slug string) map[string]models.RecipeVolumeConfig {
+	if s.recipeLoader == nil {
+		return nil
+	}
+	recipe, err := s.recipeLoader.GetRecipe(slug)
+	if err != nil {
+		return nil
+	}
+	return recipe.Volumes
+}
+
+// getDefaultPolicy returns the default backup policy, or nil if none is configured
+func (s *BackupService) getDefaultPolicy() (*models.BackupPolicy, error) {
+	var policy models.BackupPolicy
+	err := s.db.Preload("Destination").Where("is_default = ?", true).First(&policy).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// getDeploymentAndDevice loads a deployment and the device it runs on
+func (s *BackupService) getDeploymentAndDevice(deploymentID uuid.UUID) (*models.Deployment, *models.Device, error) {
+	var deployment models.Deployment
+	if err := s.db.First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		return nil, nil, fmt.Errorf("deployment not found")
+	}
+
+	var device models.Device
+	if err := s.db.First(&device, "id = ?", deployment.DeviceID).Error; err != nil {
+		return nil, nil, fmt.Errorf("device not found")
+	}
+
+	return &deployment, &device, nil
+}
+
+// tryLock marks a deployment as having a backup operation in flight
+func (s *BackupService) tryLock(deploymentID uuid.UUID) bool {
+	_, loaded := s.activeBackups.LoadOrStore(deploymentID, true)
+	return !loaded
+}
+
+// IsBusy reports whether a backup or restore of the deployment is in flight
+func (s *BackupService) IsBusy(deploymentID uuid.UUID) bool {
+	_, busy := s.activeBackups.Load(deploymentID)
+	return busy
+}
+
+// unlock clears the in-flight marker for a deployment
+func (s *BackupService) unlock(deploymentID uuid.UUID) {
+	s.activeBackups.Delete(deploymentID)
+}
+
+// broadcast sends a snapshot status update via WebSocket
+func (s *BackupService) broadcast(snapshot *models.BackupSnapshot) {
+	if s.wsHub == nil {
+		return
+	}
+	s.wsHub.Broadcast("backups", "backup:status", map[string]interface{}{
+		"id":            snapshot.ID,
+		"deployment_id": snapshot.DeploymentID,
+		"status":        snapshot.Status,
+		"trigger":       snapshot.Trigger,
+		"size_bytes":    snapshot.SizeBytes,
+		"error_message": snapshot.ErrorMessage,
+	})
+}
+
+// validateBackupDestination checks destination fields that end up in shell commands
+func validateBackupDestination(destination *models.BackupDestination) error {
+	if !strings.HasPrefix(destination.Path, "/") || !isValidDeployPath(destination.Path) {
+		return fmt.Errorf("backup path must be an absolute path without special characters")
+	}
+
+	switch destination.Type {
+	case models.BackupDestinationLocal:
+		return nil
+	case models.BackupDestinationNFS:
+		if net.ParseIP(destination.NFSServerIP) == nil {
+			return fmt.Errorf("NFS destination requires a valid server IP")
+		}
+		if destination.NFSOptions != "" && !nfsOptionsRegex.MatchString(destination.NFSOptions) {
+			return fmt.Errorf("invalid NFS mount options")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported backup destination type: %s (must be local or nfs)", destination.Type)
+}
+
+// nfsOptionsRegex matches comma-separated mount options such as "rw,vers=4.1"
+var nfsOptionsRegex = regexp.MustCompile(`^[a-zA-Z0-9_=.,]+$`)
+
+// isBackupDue reports whether any volume's backup frequency has elapsed since the last backup
+func isBackupDue(volumes map[string]models.RecipeVolumeConfig, lastBackup *time.Time, now time.Time) bool {
+	var shortest time.Duration
+	for _, config := range volumes {
+		interval, ok := backupFrequencies[config.BackupFrequency]
+		if !ok {
+			continue
+		}
+		if shortest == 0 || interval < shortest {
+			shortest = interval
+		}
+	}
+
+	if shortest == 0 {
+		return false // No volume declares a backup frequency
+	}
+	if lastBackup == nil {
+		return true
+	}
+	return now.Sub(*lastBackup) >= shortest
+}
+
+// sortVolumesByPriority orders volumes by recipe backup priority (high first), then name
+func sortVolumesByPriority(volumes []string, config map[string]models.RecipeVolumeConfig) []string {
+	sorted := append([]string{}, volumes...)
+	rank := func(volume string) int {
+		if order, ok := backupPriorityOrder[config[volume].BackupPriority]; ok {
+			return order
+		}
+		return len(backupPriorityOrder)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if rank(sorted[i]) != rank(sorted[j]) {
+			return rank(sorted[i]) < rank(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// selectSnapshotsToPrune applies GFS retention to snapshots ordered newest first
+// A snapshot is kept if any rule keeps it; a policy with no rules keeps everything
+func selectSnapshotsToPrune(snapshots []models.BackupSnapshot, policy *models.BackupPolicy) []models.BackupSnapshot {
+	if policy.KeepLast == 0 && policy.KeepDaily == 0 && policy.KeepWeekly == 0 && policy.KeepMonthly == 0 {
+		return nil
+	}
+
+	keep := make(map[uuid.UUID]bool)
+	for i := 0; i < policy.KeepLast && i < len(snapshots); i++ {
+		keep[snapshots[i].ID] = true
+	}
+
+	keepBuckets := func(count int, bucket func(time.Time) string) {
+		seen := make(map[string]bool)
+		for _, snapshot := range snapshots {
+			if len(seen) >= count {
+				return
+			}
+			key := bucket(snapshot.StartedAt)
+			if !seen[key] {
+				seen[key] = true
+				keep[snapshot.ID] = true
+			}
+		}
+	}
+
+	keepBuckets(policy.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") })
+	keepBuckets(policy.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%02d", year, week)
+	})
+	keepBuckets(policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") })
+
+	prune := []models.BackupSnapshot{}
+	for _, snapshot := range snapshots {
+		if !keep[snapshot.ID] {
+			prune = append(prune, snapshot)
+		}
+	}
+	return prune
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
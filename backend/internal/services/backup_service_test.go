@@ -0,0 +1,293 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectSnapshotsToPrune(t *testing.T) {
+	base := time.Date(2025, 10, 15, 2, 0, 0, 0, time.UTC)
+
+	// 20 daily snapshots plus a second snapshot on the newest day, newest first
+	snapshots := []models.BackupSnapshot{{ID: uuid.New(), StartedAt: base.Add(6 * time.Hour)}}
+	for i := 0; i < 20; i++ {
+		snapshots = append(snapshots, models.BackupSnapshot{ID: uuid.New(), StartedAt: base.AddDate(0, 0, -i)})
+	}
+
+	tests := []struct {
+		name          string
+		policy        models.BackupPolicy
+		expectedPrune int
+	}{
+		{
+			name:          "no retention rules keeps everything",
+			policy:        models.BackupPolicy{},
+			expectedPrune: 0,
+		},
+		{
+			name:          "keep last 5",
+			policy:        models.BackupPolicy{KeepLast: 5},
+			expectedPrune: 16,
+		},
+		{
+			name:          "keep daily 7 collapses same-day snapshots",
+			policy:        models.BackupPolicy{KeepDaily: 7},
+			expectedPrune: 14,
+		},
+		{
+			name:          "keep last 1 plus 3 weekly",
+			policy:        models.BackupPolicy{KeepLast: 1, KeepWeekly: 3},
+			expectedPrune: 18,
+		},
+		{
+			name:          "keep more than available",
+			policy:        models.BackupPolicy{KeepLast: 50},
+			expectedPrune: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prune := selectSnapshotsToPrune(snapshots, &tt.policy)
+			assert.Len(t, prune, tt.expectedPrune)
+
+			// The newest snapshot is never pruned when any rule is set
+			for _, snapshot := range prune {
+				assert.NotEqual(t, snapshots[0].ID, snapshot.ID)
+			}
+		})
+	}
+}
+
+func TestIsBackupDue(t *testing.T) {
+	now := time.Date(2025, 10, 15, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) *time.Time {
+		t := now.AddDate(0, 0, -days)
+		return &t
+	}
+
+	volumes := map[string]models.RecipeVolumeConfig{
+		"data":   {BackupFrequency: "weekly"},
+		"config": {BackupFrequency: "daily"},
+	}
+
+	assert.True(t, isBackupDue(volumes, nil, now), "never backed up")
+	assert.True(t, isBackupDue(volumes, daysAgo(1), now), "daily volume is due after 24h")
+	assert.False(t, isBackupDue(volumes, &now, now), "just backed up")
+
+	weeklyOnly := map[string]models.RecipeVolumeConfig{"data": {BackupFrequency: "weekly"}}
+	assert.False(t, isBackupDue(weeklyOnly, daysAgo(3), now))
+	assert.True(t, isBackupDue(weeklyOnly, daysAgo(7), now))
+
+	noSchedule := map[string]models.RecipeVolumeConfig{"cache": {BackupPriority: "low"}}
+	assert.False(t, isBackupDue(noSchedule, nil, now), "volumes without a frequency are manual only")
+}
+
+func TestSortVolumesByPriority(t *testing.T) {
+	config := map[string]models.RecipeVolumeConfig{
+		"cache":  {BackupPriority: "low"},
+		"data":   {BackupPriority: "high"},
+		"config": {BackupPriority: "medium"},
+	}
+
+	sorted := sortVolumesByPriority([]string{"cache", "logs", "config", "data"}, config)
+	assert.Equal(t, []string{"data", "config", "cache", "logs"}, sorted)
+}
+
+func TestValidateBackupDestination(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination models.BackupDestination
+		wantErr     bool
+	}{
+		{
+			name:        "valid local",
+			destination: models.BackupDestination{Type: models.BackupDestinationLocal, Path: "/srv/backups"},
+		},
+		{
+			name:        "valid nfs",
+			destination: models.BackupDestination{Type: models.BackupDestinationNFS, Path: "/export/backups", NFSServerIP: "192.168.1.20", NFSOptions: "rw,vers=4.1"},
+		},
+		{
+			name:        "relative path",
+			destination: models.BackupDestination{Type: models.BackupDestinationLocal, Path: "backups"},
+			wantErr:     true,
+		},
+		{
+			name:        "path traversal",
+			destination: models.BackupDestination{Type: models.BackupDestinationLocal, Path: "/srv/../etc"},
+			wantErr:     true,
+		},
+		{
+			name:        "shell injection in path",
+			destination: models.BackupDestination{Type: models.BackupDestinationLocal, Path: "/srv/backups; rm -rf /"},
+			wantErr:     true,
+		},
+		{
+			name:        "nfs without server",
+			destination: models.BackupDestination{Type: models.BackupDestinationNFS, Path: "/export/backups"},
+			wantErr:     true,
+		},
+		{
+			name:        "nfs options injection",
+			destination: models.BackupDestination{Type: models.BackupDestinationNFS, Path: "/export", NFSServerIP: "10.0.0.5", NFSOptions: "rw;reboot"},
+			wantErr:     true,
+		},
+		{
+			name:        "unsupported type",
+			destination: models.BackupDestination{Type: "s3", Path: "/bucket"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBackupDestination(&tt.destination)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBackupPolicyDefaults(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewBackupService(db, nil, nil, nil)
+
+	destination, err := service.CreateDestination(CreateBackupDestinationRequest{
+		Name: "nas",
+		Type: models.BackupDestinationLocal,
+		Path: "/srv/backups/",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/backups", destination.Path, "trailing slash is trimmed")
+
+	first, err := service.CreatePolicy(CreateBackupPolicyRequest{Name: "daily", DestinationID: destination.ID, IsDefault: true, KeepDaily: 7})
+	require.NoError(t, err)
+	second, err := service.CreatePolicy(CreateBackupPolicyRequest{Name: "weekly", DestinationID: destination.ID, IsDefault: true, KeepWeekly: 4})
+	require.NoError(t, err)
+
+	defaultPolicy, err := service.getDefaultPolicy()
+	require.NoError(t, err)
+	require.NotNil(t, defaultPolicy)
+	assert.Equal(t, second.ID, defaultPolicy.ID, "newest default policy wins")
+	assert.NotNil(t, defaultPolicy.Destination)
+
+	var reloaded models.BackupPolicy
+	require.NoError(t, db.First(&reloaded, "id = ?", first.ID).Error)
+	assert.False(t, reloaded.IsDefault)
+
+	// Destinations referenced by a policy cannot be deleted
+	err = service.DeleteDestination(destination.ID)
+	assert.Error(t, err)
+
+	_, err = service.CreatePolicy(CreateBackupPolicyRequest{Name: "bad", DestinationID: uuid.New()})
+	assert.Error(t, err, "unknown destination")
+
+	_, err = service.CreatePolicy(CreateBackupPolicyRequest{Name: "negative", DestinationID: destination.ID, KeepLast: intPtr(-1)})
+	assert.Error(t, err)
+
+	// An explicit zero is kept rather than replaced by the default
+	assert.Equal(t, defaultKeepLast, first.KeepLast)
+	monthly, err := service.CreatePolicy(CreateBackupPolicyRequest{Name: "monthly", DestinationID: destination.ID, KeepLast: intPtr(0), KeepMonthly: 12})
+	require.NoError(t, err)
+	var stored models.BackupPolicy
+	require.NoError(t, db.First(&stored, "id = ?", monthly.ID).Error)
+	assert.Equal(t, 0, stored.KeepLast)
+}
+
+func TestRestoreSnapshotRejectsSnapshotFromAnotherDevice(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewBackupService(db, nil, nil, nil)
+
+	destination, err := service.CreateDestination(CreateBackupDestinationRequest{Name: "local", Type: models.BackupDestinationLocal, Path: "/srv/backups"})
+	require.NoError(t, err)
+
+	source := models.Device{Name: "server-1", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.20"}
+	target := models.Device{Name: "server-2", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.21"}
+	require.NoError(t, db.Create(&source).Error)
+	require.NoError(t, db.Create(&target).Error)
+
+	// The deployment was migrated after the snapshot was taken
+	deployment := models.Deployment{RecipeSlug: "vaultwarden", DeviceID: target.ID, ComposeProject: "vaultwarden-abc123", Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(&deployment).Error)
+	snapshot := models.BackupSnapshot{DeploymentID: deployment.ID, DeviceID: source.ID, DestinationID: destination.ID,
+		Status: models.SnapshotStatusSuccess, Volumes: []byte(`["data"]`), ArchivePath: "vaultwarden-abc123/20250101-000000-abcdef12"}
+	require.NoError(t, db.Create(&snapshot).Error)
+
+	// Refused before anything runs on the device (the service has no SSH client)
+	err = service.RestoreSnapshot(deployment.ID, snapshot.ID, RestoreBackupRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "another device")
+}
+
+func TestStartBackupRequiresDestination(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewBackupService(db, nil, nil, nil)
+
+	device := models.Device{Name: "server", Type: models.DeviceTypeServer}
+	require.NoError(t, db.Create(&device).Error)
+
+	deployment := models.Deployment{RecipeSlug: "vaultwarden", DeviceID: device.ID, ComposeProject: "vaultwarden-abc123", Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(&deployment).Error)
+
+	_, err := service.StartBackup(deployment.ID, CreateBackupRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no default backup policy")
+
+	_, err = service.StartBackup(uuid.New(), CreateBackupRequest{})
+	assert.Error(t, err, "unknown deployment")
+
+	_, err = service.StartBackup(deployment.ID, CreateBackupRequest{Volumes: []string{"data;rm"}})
+	assert.Error(t, err, "invalid volume name")
+
+	snapshots, err := service.ListSnapshots(deployment.ID)
+	require.NoError(t, err)
+	assert.Empty(t, snapshots, "failed validation records no snapshot")
+}
+
+func TestDeploymentService_RestoreBackupQueuesJob(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+	backups := NewBackupService(db, nil, nil, nil)
+	service.SetBackupService(backups)
+
+	destination, err := backups.CreateDestination(CreateBackupDestinationRequest{Name: "local", Type: models.BackupDestinationLocal, Path: "/srv/backups"})
+	require.NoError(t, err)
+	device := models.Device{Name: "server-1", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.30"}
+	require.NoError(t, db.Create(&device).Error)
+	deployment := models.Deployment{RecipeSlug: "vaultwarden", DeviceID: device.ID, ComposeProject: "vaultwarden-abc123", Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(&deployment).Error)
+	snapshot := models.BackupSnapshot{DeploymentID: deployment.ID, DeviceID: device.ID, DestinationID: destination.ID,
+		Status: models.SnapshotStatusSuccess, Volumes: []byte(`["data"]`), ArchivePath: "vaultwarden-abc123/20250101-000000-abcdef12"}
+	require.NoError(t, db.Create(&snapshot).Error)
+
+	// Invalid restores are refused before anything is queued
+	_, err = service.RestoreBackup(deployment.ID.String(), snapshot.ID, RestoreBackupRequest{Volumes: []string{"db"}})
+	assert.ErrorContains(t, err, "not part of this snapshot")
+	_, err = service.RestoreBackup(deployment.ID.String(), uuid.New(), RestoreBackupRequest{})
+	assert.ErrorContains(t, err, "snapshot not found")
+
+	job, err := service.RestoreBackup(deployment.ID.String(), snapshot.ID, RestoreBackupRequest{Volumes: []string{"data"}})
+	require.NoError(t, err)
+	assert.Equal(t, models.DeploymentJobRestore, job.Type)
+	assert.Equal(t, models.DeploymentJobQueued, job.Status)
+
+	var params restoreJobParams
+	require.NoError(t, service.jobQueue.LoadParams(job, &params))
+	assert.Equal(t, snapshot.ID, params.SnapshotID)
+	assert.Equal(t, []string{"data"}, params.Request.Volumes)
+
+	// A second restore waits for the first rather than running alongside it
+	_, err = service.RestoreBackup(deployment.ID.String(), snapshot.ID, RestoreBackupRequest{})
+	assert.ErrorContains(t, err, "queued or running job")
+	assert.True(t, service.IsBusy(deployment.ID.String()), "remediation leaves the deployment alone while the restore is queued")
+}
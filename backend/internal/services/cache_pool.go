@@ -6,7 +6,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,6 +22,7 @@ type CachePoolManager struct {
 	sshClient    *ssh.Client
 	infraConfig  *InfrastructureConfig
 	orchestrator ContainerOrchestrator
+	ports        *PortRegistry
 }
 
 // NewCachePoolManager creates a new CachePoolManager instance
@@ -32,6 +32,7 @@ func NewCachePoolManager(db *gorm.DB, sshClient *ssh.Client, infraConfig *Infras
 		sshClient:    sshClient,
 		infraConfig:  infraConfig,
 		orchestrator: orchestrator,
+		ports:        NewPortRegistry(db, sshClient),
 	}
 }
 
@@ -280,37 +281,42 @@ func (cpm *CachePoolManager) GetCacheCredentials(ctx context.Context, deviceID u
 		return nil, fmt.Errorf("failed to find cache config for app %s on instance %s: %w", appSlug, instance.ID, err)
 	}
 
-	// Build credentials map with correct host
+	return cacheConnectionEnvVars(host, instance.Port, instance.MasterPassword, instance.Engine, config.DatabaseNumber, config.KeyPrefix), nil
+}
+
+// cacheConnectionEnvVars builds the environment variables apps use to connect to a cache
+// Shared and dedicated instances expose the same variables
+func cacheConnectionEnvVars(host string, port int, password string, engine string, dbNumber int, keyPrefix string) map[string]string {
 	credentials := map[string]string{
 		"CACHE_HOST":     host,
-		"CACHE_PORT":     fmt.Sprintf("%d", instance.Port),
-		"CACHE_PASSWORD": instance.MasterPassword,
-		"CACHE_ENGINE":   instance.Engine,
+		"CACHE_PORT":     fmt.Sprintf("%d", port),
+		"CACHE_PASSWORD": password,
+		"CACHE_ENGINE":   engine,
 	}
 
 	// Redis/Valkey-specific credentials (they share the same protocol)
-	if instance.Engine == "redis" || instance.Engine == "valkey" {
+	if engine == "redis" || engine == "valkey" {
 		credentials["REDIS_HOST"] = host
-		credentials["REDIS_PORT"] = fmt.Sprintf("%d", instance.Port)
-		credentials["REDIS_PASSWORD"] = instance.MasterPassword
-		credentials["REDIS_DB"] = fmt.Sprintf("%d", config.DatabaseNumber)
-		credentials["REDIS_PREFIX"] = config.KeyPrefix
+		credentials["REDIS_PORT"] = fmt.Sprintf("%d", port)
+		credentials["REDIS_PASSWORD"] = password
+		credentials["REDIS_DB"] = fmt.Sprintf("%d", dbNumber)
+		credentials["REDIS_PREFIX"] = keyPrefix
 
 		// Also provide valkey-specific credentials for clarity
 		credentials["VALKEY_HOST"] = host
-		credentials["VALKEY_PORT"] = fmt.Sprintf("%d", instance.Port)
-		credentials["VALKEY_PASSWORD"] = instance.MasterPassword
-		credentials["VALKEY_DB"] = fmt.Sprintf("%d", config.DatabaseNumber)
-		credentials["VALKEY_PREFIX"] = config.KeyPrefix
+		credentials["VALKEY_PORT"] = fmt.Sprintf("%d", port)
+		credentials["VALKEY_PASSWORD"] = password
+		credentials["VALKEY_DB"] = fmt.Sprintf("%d", dbNumber)
+		credentials["VALKEY_PREFIX"] = keyPrefix
 	}
 
 	// Memcached-specific credentials
-	if instance.Engine == "memcached" {
+	if engine == "memcached" {
 		credentials["MEMCACHED_HOST"] = host
-		credentials["MEMCACHED_PORT"] = fmt.Sprintf("%d", instance.Port)
+		credentials["MEMCACHED_PORT"] = fmt.Sprintf("%d", port)
 	}
 
-	return credentials, nil
+	return credentials
 }
 
 // deploySharedCacheInstance deploys a shared cache instance using the orchestrator
@@ -355,8 +361,12 @@ func (cpm *CachePoolManager) deploySharedCacheInstance(ctx context.Context, inst
 
 // generateCacheInstanceCompose generates docker-compose for a cache instance
 func (cpm *CachePoolManager) generateCacheInstanceCompose(instance *models.SharedCacheInstance) (string, error) {
-	dockerImage := cpm.infraConfig.GetCacheImage(instance.Engine)
+	return cpm.generateCacheCompose(instance, cpm.infraConfig.GetCacheImage(instance.Engine))
+}
 
+// generateCacheCompose generates docker-compose for a cache container using the given image
+// Shared and dedicated instances are built from the same templates
+func (cpm *CachePoolManager) generateCacheCompose(instance *models.SharedCacheInstance, dockerImage string) (string, error) {
 	switch instance.Engine {
 	case "valkey", "redis":
 		return cpm.generateValkeyRedisCompose(instance, dockerImage), nil
@@ -457,106 +467,15 @@ func (cpm *CachePoolManager) cleanupDockerResources(deviceIP string, containerNa
 	return nil
 }
 
-// checkPortOnHost checks if a port is actually listening on the target host
-// This method does not access the database and is safe to call within transactions
-func (cpm *CachePoolManager) checkPortOnHost(host string, port int) (bool, error) {
-	// Check if port is listening using ss (socket statistics)
-	// ss is more portable and efficient than netstat
-	checkCmd := fmt.Sprintf("ss -tuln | grep ':%d ' || true", port)
-	output, err := cpm.sshClient.ExecuteWithTimeout(host, checkCmd, 10*time.Second)
-
-	// If there's an error executing the command (not just empty output), return error
-	if err != nil {
-		return false, fmt.Errorf("failed to check port on host %s: %w", host, err)
-	}
-
-	// If output is non-empty, port is in use
-	return strings.TrimSpace(output) != "", nil
-}
-
-// findAvailablePort finds an available port for a cache instance on the device
-// Uses database transaction with row-level locking to prevent race conditions
-// Also verifies port is not in use on the actual system
+// findAvailablePort finds a port for a cache instance on the device that nothing else holds
+// Privileged ports (< 1024) are never used
 func (cpm *CachePoolManager) findAvailablePort(ctx context.Context, deviceID uuid.UUID, startPort int) (int, error) {
-	// Query device BEFORE entering transaction to avoid nested database queries
 	var device models.Device
 	if err := cpm.db.WithContext(ctx).First(&device, deviceID).Error; err != nil {
 		return 0, fmt.Errorf("failed to get device %s: %w", deviceID, err)
 	}
 
-	// Build SSH host string for port checking
-	host := device.GetSSHHost()
-
-	var port int
-
-	// Use transaction with FOR UPDATE lock to prevent race condition
-	err := cpm.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// Get all used ports with row lock
-		var usedPorts []int
-		err := tx.Model(&models.SharedCacheInstance{}).
-			Where("device_id = ?", deviceID).
-			Clauses(clause.Locking{Strength: "UPDATE"}).
-			Pluck("port", &usedPorts).Error
-
-		if err != nil {
-			return fmt.Errorf("failed to query used ports: %w", err)
-		}
-
-		// Find available port
-		candidatePort := startPort
-		maxAttempts := 100 // Prevent infinite loop
-		attempts := 0
-
-		for {
-			attempts++
-			if attempts > maxAttempts {
-				return fmt.Errorf("failed to find available port after %d attempts", maxAttempts)
-			}
-
-			// Validate port range (avoid privileged ports < 1024)
-			if candidatePort < 1024 {
-				candidatePort = 1024
-			}
-			if candidatePort > 65535 {
-				return fmt.Errorf("no available ports in valid range (1024-65535)")
-			}
-
-			// Check if port is in database
-			usedInDB := false
-			for _, usedPort := range usedPorts {
-				if usedPort == candidatePort {
-					usedInDB = true
-					break
-				}
-			}
-
-			if !usedInDB {
-				// Port not in database, check if it's actually available on the system
-				// Uses host string queried before transaction (no nested DB queries)
-				inUse, err := cpm.checkPortOnHost(host, candidatePort)
-				if err != nil {
-					// Log warning but don't fail - continue trying other ports
-					log.Printf("[CachePool] Warning: Could not check if port %d is in use on device %s: %v", candidatePort, deviceID, err)
-					// Assume port is available if we can't check
-					port = candidatePort
-					return nil
-				}
-
-				if !inUse {
-					port = candidatePort
-					return nil
-				}
-			}
-
-			candidatePort++
-		}
-	})
-
-	if err != nil {
-		return 0, err
-	}
-
-	return port, nil
+	return cpm.ports.FindFreePort(&device, max(startPort, 1024))
 }
 
 // findAvailableDatabaseNumber finds an available database number for the cache instance
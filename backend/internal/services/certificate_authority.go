@@ -0,0 +1,516 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	homelabCAResolver = "homelab-ca" // Cert resolver for domains served with certificates from the homelab CA
+
+	caRootKeyCredential  = "homelab-ca-root-key"
+	caRootCertCredential = "homelab-ca-root-cert"
+	caRootValidity       = 10 * 365 * 24 * time.Hour
+	caLeafValidity       = 90 * 24 * time.Hour
+	caRenewBefore        = 30 * 24 * time.Hour // Renew once a certificate has less than this left
+	caCriticalWithin     = 7 * 24 * time.Hour  // Alerts turn critical this close to expiry
+	caAlertInterval      = 24 * time.Hour      // Repeat an unresolved expiry alert at most this often
+)
+
+// ErrCertificateNotFound is returned for an unknown certificate ID
+var ErrCertificateNotFound = errors.New("certificate not found")
+
+// privateTLDs are suffixes no public CA issues certificates for
+var privateTLDs = []string{"home.arpa", "home", "lan", "local", "internal", "localdomain", "test", "corp"}
+
+// CertificateDistributor installs certificates on the reverse proxy serving a deployment
+type CertificateDistributor interface {
+	InstallCertificate(deployment *models.Deployment, certPEM, keyPEM string) error
+	LogDeploymentEvent(id string, message string)
+}
+
+// CertificateAuthority is the homelab's own CA: it issues certificates for deployment domains public ACME cannot
+// validate, installs them on the device's reverse proxy and renews them before they expire
+type CertificateAuthority struct {
+	db            *gorm.DB
+	credService   *CredentialService
+	wsHub         WSHub
+	distributor   CertificateDistributor
+	checkInterval time.Duration
+	cancel        context.CancelFunc
+
+	mu       sync.Mutex // Serialises root creation and issuing
+	rootCert *x509.Certificate
+	rootKey  *ecdsa.PrivateKey
+	rootPEM  string
+}
+
+// NewCertificateAuthority creates a new certificate authority
+func NewCertificateAuthority(db *gorm.DB, credService *CredentialService, wsHub WSHub) *CertificateAuthority {
+	return &CertificateAuthority{
+		db:            db,
+		credService:   credService,
+		wsHub:         wsHub,
+		checkInterval: 12 * time.Hour,
+	}
+}
+
+// SetDistributor sets where issued certificates are installed
+func (ca *CertificateAuthority) SetDistributor(distributor CertificateDistributor) {
+	ca.distributor = distributor
+}
+
+// Start begins the background expiry check and renewal loop
+func (ca *CertificateAuthority) Start(ctx context.Context) {
+	log.Println("[CA] Starting certificate renewal service")
+
+	ctx, cancel := context.WithCancel(ctx)
+	ca.cancel = cancel
+
+	ticker := time.NewTicker(ca.checkInterval)
+	go func() {
+		ca.CheckAll(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Println("[CA] Certificate renewal service stopped")
+				return
+			case <-ticker.C:
+				ca.CheckAll(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the background renewal loop
+func (ca *CertificateAuthority) Stop() {
+	if ca.cancel != nil {
+		ca.cancel()
+	}
+}
+
+// RootCertificatePEM returns the root certificate clients install to trust the homelab's domains
+func (ca *CertificateAuthority) RootCertificatePEM() (string, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if err := ca.loadRoot(); err != nil {
+		return "", err
+	}
+	return ca.rootPEM, nil
+}
+
+// loadRoot loads the root key and certificate from the credential store, creating them on first use
+// Callers hold ca.mu
+func (ca *CertificateAuthority) loadRoot() error {
+	if ca.rootCert != nil {
+		return nil
+	}
+
+	keyPEM, keyErr := ca.credService.GetCredential(caRootKeyCredential)
+	certPEM, certErr := ca.credService.GetCredential(caRootCertCredential)
+	// Clients trust the existing root, so it is only created when neither half was ever stored
+	if isCredentialNotFound(keyErr) && isCredentialNotFound(certErr) {
+		return ca.createRoot()
+	}
+	if keyErr != nil {
+		return fmt.Errorf("failed to load root CA key: %w", keyErr)
+	}
+	if certErr != nil {
+		return fmt.Errorf("failed to load root CA certificate: %w", certErr)
+	}
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if keyBlock == nil || certBlock == nil {
+		return fmt.Errorf("stored root CA is not valid PEM")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse root CA key: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse root CA certificate: %w", err)
+	}
+
+	ca.rootKey, ca.rootCert, ca.rootPEM = key, cert, certPEM
+	return nil
+}
+
+// createRoot generates a new root key and self-signed certificate and stores them
+func (ca *CertificateAuthority) createRoot() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate root CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "Homelab Root CA",
+			Organization: []string{"Homelab Orchestration Platform"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caRootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create root CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse root CA certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode root CA key: %w", err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if err := ca.credService.StoreCredential(caRootKeyCredential, keyPEM); err != nil {
+		return fmt.Errorf("failed to store root CA key: %w", err)
+	}
+	if err := ca.credService.StoreCredential(caRootCertCredential, certPEM); err != nil {
+		return fmt.Errorf("failed to store root CA certificate: %w", err)
+	}
+
+	log.Printf("[CA] Created homelab root CA (valid until %s)", cert.NotAfter.Format("2006-01-02"))
+	ca.rootKey, ca.rootCert, ca.rootPEM = key, cert, certPEM
+	return nil
+}
+
+// EnsureCertificate installs a valid certificate for the deployment's domain on its device's proxy
+// The stored certificate is reused unless its domain changed or it is due for renewal
+func (ca *CertificateAuthority) EnsureCertificate(deployment *models.Deployment) (*models.Certificate, error) {
+	return ca.ensure(deployment, false)
+}
+
+// ensure installs the deployment's certificate, issuing a new one first if renew is set or the stored one cannot be reused
+func (ca *CertificateAuthority) ensure(deployment *models.Deployment, renew bool) (*models.Certificate, error) {
+	if deployment.Domain == "" {
+		return nil, fmt.Errorf("deployment has no domain")
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var cert models.Certificate
+	err := ca.db.Where("deployment_id = ?", deployment.ID).First(&cert).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	keyPEM := ""
+	if !renew && cert.ID != uuid.Nil && cert.Domain == deployment.Domain && time.Until(cert.NotAfter) > caRenewBefore {
+		keyPEM, err = ca.credService.GetCredential(cert.KeyCredentialKey)
+	}
+	next := cert
+	fresh := keyPEM == "" || err != nil
+	if fresh {
+		if keyPEM, err = ca.issue(deployment, &next); err != nil {
+			ca.recordFailure(&cert, deployment, err)
+			return nil, err
+		}
+	}
+
+	var installErr error
+	if ca.distributor == nil {
+		installErr = fmt.Errorf("no certificate distributor configured")
+	} else if err := ca.distributor.InstallCertificate(deployment, next.CertificatePEM, keyPEM); err != nil {
+		installErr = fmt.Errorf("failed to install certificate: %w", err)
+	}
+	// The proxy keeps serving the installed certificate, so a replacement that failed to install is dropped;
+	// a first certificate is kept so the renewal loop retries installing it
+	if installErr != nil && cert.ID != uuid.Nil {
+		ca.recordFailure(&cert, deployment, installErr)
+		return nil, installErr
+	}
+	if fresh {
+		if err := ca.credService.StoreCredential(next.KeyCredentialKey, keyPEM); err != nil {
+			err = fmt.Errorf("failed to store certificate key: %w", err)
+			ca.recordFailure(&cert, deployment, err)
+			return nil, err
+		}
+	}
+	if installErr != nil {
+		ca.recordFailure(&next, deployment, installErr)
+		return nil, installErr
+	}
+
+	now := time.Now()
+	next.DeviceID = deployment.DeviceID
+	next.InstalledAt = &now
+	next.LastError = ""
+	next.AlertedAt = nil
+	next.Status = certificateStatus(&next, now)
+	if err := ca.db.Save(&next).Error; err != nil {
+		return nil, fmt.Errorf("failed to save certificate: %w", err)
+	}
+	return &next, nil
+}
+
+// issue signs a new leaf certificate for the deployment's domain into cert, returning the key PEM
+// The caller stores the key and saves cert once the certificate is installed, and holds ca.mu
+func (ca *CertificateAuthority) issue(deployment *models.Deployment, cert *models.Certificate) (string, error) {
+	if err := ca.loadRoot(); err != nil {
+		return "", err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: deployment.Domain},
+		DNSNames:     []string{deployment.Domain},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(caLeafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.rootCert, &key.PublicKey, ca.rootKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign certificate for %s: %w", deployment.Domain, err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode certificate key: %w", err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	cert.DeploymentID = deployment.ID
+	cert.DeviceID = deployment.DeviceID
+	cert.Domain = deployment.Domain
+	cert.SerialNumber = serial.Text(16)
+	cert.NotBefore = template.NotBefore
+	cert.NotAfter = template.NotAfter
+	cert.CertificatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	cert.KeyCredentialKey = fmt.Sprintf("certificate-%s", deployment.ID)
+	cert.InstalledAt = nil
+
+	log.Printf("[CA] Issued certificate %s for %s (valid until %s)", cert.SerialNumber, cert.Domain, cert.NotAfter.Format("2006-01-02"))
+	return keyPEM, nil
+}
+
+// recordFailure stores the error on an issued certificate so it shows up as failed
+func (ca *CertificateAuthority) recordFailure(cert *models.Certificate, deployment *models.Deployment, cause error) {
+	log.Printf("[CA] Certificate for %s: %v", deployment.Domain, cause)
+	if cert.DeploymentID == uuid.Nil {
+		return
+	}
+	cert.LastError = cause.Error()
+	cert.Status = certificateStatus(cert, time.Now())
+	if err := ca.db.Save(cert).Error; err != nil {
+		log.Printf("[CA] Failed to record certificate error for %s: %v", deployment.Domain, err)
+	}
+}
+
+// CheckAll renews certificates that are due and alerts on the ones that could not be renewed
+func (ca *CertificateAuthority) CheckAll(ctx context.Context) {
+	var certs []models.Certificate
+	if err := ca.db.Find(&certs).Error; err != nil {
+		log.Printf("[CA] Failed to list certificates: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range certs {
+		if ctx.Err() != nil {
+			return
+		}
+		cert := &certs[i]
+
+		var deployment models.Deployment
+		if err := ca.db.First(&deployment, "id = ?", cert.DeploymentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				ca.RemoveForDeployment(cert.DeploymentID)
+			}
+			continue
+		}
+		// A deployment that no longer uses the CA keeps its certificate until it expires, but it is not renewed
+		if deployment.CertResolver != homelabCAResolver || deployment.Domain == "" {
+			continue
+		}
+
+		if time.Until(cert.NotAfter) > caRenewBefore && cert.LastError == "" {
+			if status := certificateStatus(cert, now); status != cert.Status {
+				ca.db.Model(cert).Update("status", status)
+			}
+			continue
+		}
+
+		renewed, err := ca.EnsureCertificate(&deployment)
+		if err == nil {
+			log.Printf("[CA] Renewed certificate for %s", renewed.Domain)
+			if ca.distributor != nil {
+				ca.distributor.LogDeploymentEvent(deployment.ID.String(), fmt.Sprintf("✓ Certificate for %s renewed, valid until %s", renewed.Domain, renewed.NotAfter.Format("2006-01-02")))
+			}
+			continue
+		}
+		// Install failures on a certificate with time left show as failed without paging anyone
+		if time.Until(cert.NotAfter) <= caRenewBefore {
+			ca.alert(&deployment, err)
+		}
+	}
+}
+
+// alert broadcasts that a certificate could not be renewed, at most once per caAlertInterval
+func (ca *CertificateAuthority) alert(deployment *models.Deployment, cause error) {
+	var cert models.Certificate
+	if err := ca.db.Where("deployment_id = ?", deployment.ID).First(&cert).Error; err != nil {
+		return
+	}
+	now := time.Now()
+	if cert.AlertedAt != nil && now.Sub(*cert.AlertedAt) < caAlertInterval {
+		return
+	}
+
+	severity := "warning"
+	message := fmt.Sprintf("The certificate for %s expires on %s and could not be renewed", cert.Domain, cert.NotAfter.Format("2006-01-02"))
+	if cert.Status == models.CertificateStatusExpired {
+		message = fmt.Sprintf("The certificate for %s expired on %s and could not be renewed", cert.Domain, cert.NotAfter.Format("2006-01-02"))
+	}
+	if time.Until(cert.NotAfter) < caCriticalWithin {
+		severity = "critical"
+	}
+
+	if ca.wsHub != nil {
+		ca.wsHub.Broadcast("deployments", "deployment:alert", map[string]interface{}{
+			"id":          deployment.ID,
+			"name":        deploymentNodeName(deployment),
+			"severity":    severity,
+			"message":     message,
+			"reason":      cause.Error(),
+			"certificate": cert.ID,
+		})
+	}
+	if ca.distributor != nil {
+		ca.distributor.LogDeploymentEvent(deployment.ID.String(), fmt.Sprintf("⚠️  %s: %v", message, cause))
+	}
+	ca.db.Model(&cert).Update("alerted_at", now)
+}
+
+// ListCertificates returns the certificates issued by the CA, optionally for one device
+func (ca *CertificateAuthority) ListCertificates(deviceID *uuid.UUID) ([]models.Certificate, error) {
+	query := ca.db.Order("not_after")
+	if deviceID != nil {
+		query = query.Where("device_id = ?", *deviceID)
+	}
+
+	var certs []models.Certificate
+	if err := query.Find(&certs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+	// Expiry moves on between checks
+	now := time.Now()
+	for i := range certs {
+		certs[i].Status = certificateStatus(&certs[i], now)
+	}
+	return certs, nil
+}
+
+// RenewCertificate issues and installs a new certificate right away
+func (ca *CertificateAuthority) RenewCertificate(id uuid.UUID) (*models.Certificate, error) {
+	var cert models.Certificate
+	if err := ca.db.First(&cert, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCertificateNotFound
+		}
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	var deployment models.Deployment
+	if err := ca.db.First(&deployment, "id = ?", cert.DeploymentID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load deployment: %w", err)
+	}
+	if deployment.Domain == "" {
+		return nil, fmt.Errorf("%s no longer has a domain", deploymentNodeName(&deployment))
+	}
+	return ca.ensure(&deployment, true)
+}
+
+// RemoveForDeployment deletes a deployment's certificate and its key
+func (ca *CertificateAuthority) RemoveForDeployment(deploymentID uuid.UUID) error {
+	var cert models.Certificate
+	if err := ca.db.Where("deployment_id = ?", deploymentID).First(&cert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if cert.KeyCredentialKey != "" {
+		if err := ca.credService.DeleteCredentials(cert.KeyCredentialKey); err != nil {
+			log.Printf("[CA] Warning: Failed to delete key of certificate for %s: %v", cert.Domain, err)
+		}
+	}
+	if err := ca.db.Delete(&cert).Error; err != nil {
+		return fmt.Errorf("failed to delete certificate: %w", err)
+	}
+	return nil
+}
+
+// certificateStatus derives a certificate's status from its expiry and last error
+func certificateStatus(cert *models.Certificate, now time.Time) models.CertificateStatus {
+	switch {
+	case !now.Before(cert.NotAfter):
+		return models.CertificateStatusExpired
+	case cert.NotAfter.Sub(now) <= caRenewBefore:
+		return models.CertificateStatusExpiring
+	case cert.LastError != "":
+		return models.CertificateStatusFailed
+	}
+	return models.CertificateStatusValid
+}
+
+// isPrivateDomain reports whether a domain ends in a suffix public CAs do not issue for
+func isPrivateDomain(domain string) bool {
+	for _, tld := range privateTLDs {
+		if domain == tld || strings.HasSuffix(domain, "."+tld) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDistributor records installed certificates and fails while err is set
+type fakeDistributor struct {
+	installed []string
+	keys      []string
+	events    []string
+	err       error
+}
+
+func (f *fakeDistributor) InstallCertificate(deployment *models.Deployment, certPEM, keyPEM string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.installed = append(f.installed, certPEM)
+	f.keys = append(f.keys, keyPEM)
+	return nil
+}
+
+func (f *fakeDistributor) LogDeploymentEvent(id string, message string) {
+	f.events = append(f.events, message)
+}
+
+func parseTestCertificate(t *testing.T, certPEM string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(certPEM))
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestCertificateAuthority_EnsureCertificate(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	ca := NewCertificateAuthority(db, credService, nil)
+	distributor := &fakeDistributor{}
+	ca.SetDistributor(distributor)
+
+	deployment := &models.Deployment{RecipeSlug: "nextcloud", ComposeProject: "nextcloud-abc123", DeviceID: uuid.New(),
+		Domain: "cloud.home.lan", CertResolver: homelabCAResolver}
+	require.NoError(t, db.Create(deployment).Error)
+
+	// A first certificate that could not be installed is kept for the renewal loop to retry
+	distributor.err = errors.New("proxy unreachable")
+	_, err := ca.EnsureCertificate(deployment)
+	assert.ErrorContains(t, err, "proxy unreachable")
+	certs, err := ca.ListCertificates(nil)
+	require.NoError(t, err)
+	require.Len(t, certs, 1)
+	assert.Equal(t, models.CertificateStatusFailed, certs[0].Status)
+	distributor.err = nil
+
+	cert, err := ca.EnsureCertificate(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, certs[0].SerialNumber, cert.SerialNumber)
+	assert.Equal(t, models.CertificateStatusValid, cert.Status)
+	assert.NotNil(t, cert.InstalledAt)
+	require.Len(t, distributor.installed, 1)
+
+	rootPEM, err := ca.RootCertificatePEM()
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM([]byte(rootPEM)))
+	leaf := parseTestCertificate(t, distributor.installed[0])
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "cloud.home.lan", Roots: roots})
+	assert.NoError(t, err, "the leaf chains to the root")
+	assert.WithinDuration(t, time.Now().Add(caLeafValidity), leaf.NotAfter, time.Hour)
+
+	storedKey, err := credService.GetCredential(cert.KeyCredentialKey)
+	require.NoError(t, err)
+	assert.Equal(t, distributor.keys[0], storedKey)
+
+	// A valid certificate is reinstalled as is, a changed domain gets a new one
+	_, err = ca.EnsureCertificate(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, distributor.installed[0], distributor.installed[1])
+	deployment.Domain = "files.home.lan"
+	renamed, err := ca.EnsureCertificate(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, cert.ID, renamed.ID)
+	assert.Equal(t, []string{"files.home.lan"}, parseTestCertificate(t, distributor.installed[2]).DNSNames)
+
+	// Another instance loads the stored root instead of creating one
+	reloaded, err := NewCertificateAuthority(db, credService, nil).RootCertificatePEM()
+	require.NoError(t, err)
+	assert.Equal(t, rootPEM, reloaded)
+
+	require.NoError(t, ca.RemoveForDeployment(deployment.ID))
+	_, err = credService.GetCredential(cert.KeyCredentialKey)
+	assert.Error(t, err)
+	certs, err = ca.ListCertificates(nil)
+	require.NoError(t, err)
+	assert.Empty(t, certs)
+}
+
+func TestCertificateAuthority_CheckAll(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	hub := &recordingHub{}
+	ca := NewCertificateAuthority(db, credService, hub)
+	distributor := &fakeDistributor{}
+	ca.SetDistributor(distributor)
+
+	deployment := &models.Deployment{RecipeSlug: "nextcloud", ComposeProject: "nextcloud-abc123", DeviceID: uuid.New(),
+		Domain: "cloud.home.lan", CertResolver: homelabCAResolver}
+	require.NoError(t, db.Create(deployment).Error)
+	cert, err := ca.EnsureCertificate(deployment)
+	require.NoError(t, err)
+
+	// Nothing is due yet
+	ca.CheckAll(context.Background())
+	assert.Len(t, distributor.installed, 1)
+
+	// Inside the renewal window the certificate is replaced
+	require.NoError(t, db.Model(cert).Update("not_after", time.Now().Add(10*24*time.Hour)).Error)
+	ca.CheckAll(context.Background())
+	require.Len(t, distributor.installed, 2)
+	assert.NotEqual(t, distributor.installed[0], distributor.installed[1])
+	certs, err := ca.ListCertificates(&deployment.DeviceID)
+	require.NoError(t, err)
+	require.Len(t, certs, 1)
+	assert.Equal(t, models.CertificateStatusValid, certs[0].Status)
+	assert.Empty(t, hub.events)
+
+	// A renewal that fails close to expiry alerts once per interval
+	distributor.err = errors.New("proxy unreachable")
+	require.NoError(t, db.Model(cert).Update("not_after", time.Now().Add(3*24*time.Hour)).Error)
+	ca.CheckAll(context.Background())
+	ca.CheckAll(context.Background())
+	assert.Equal(t, []string{"deployments:deployment:alert"}, hub.events)
+	certs, err = ca.ListCertificates(nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.CertificateStatusExpiring, certs[0].Status)
+	assert.Contains(t, certs[0].LastError, "proxy unreachable")
+	assert.NotNil(t, certs[0].AlertedAt)
+
+	// A failure with time left is recorded without an alert and retried on the next check
+	require.NoError(t, db.Model(cert).Updates(map[string]interface{}{"not_after": time.Now().Add(60 * 24 * time.Hour), "alerted_at": nil}).Error)
+	ca.CheckAll(context.Background())
+	assert.Len(t, hub.events, 1)
+	distributor.err = nil
+	ca.CheckAll(context.Background())
+	certs, err = ca.ListCertificates(nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.CertificateStatusValid, certs[0].Status)
+	assert.Empty(t, certs[0].LastError)
+
+	// Certificates of deleted deployments are cleaned up
+	require.NoError(t, db.Delete(deployment).Error)
+	ca.CheckAll(context.Background())
+	certs, err = ca.ListCertificates(nil)
+	require.NoError(t, err)
+	assert.Empty(t, certs)
+
+	_, err = ca.RenewCertificate(uuid.New())
+	assert.ErrorIs(t, err, ErrCertificateNotFound)
+}
+
+func TestIsPrivateDomain(t *testing.T) {
+	assert.True(t, isPrivateDomain("cloud.home.lan"))
+	assert.True(t, isPrivateDomain("nas.home.arpa"))
+	assert.True(t, isPrivateDomain("printer.local"))
+	assert.False(t, isPrivateDomain("cloud.example.com"))
+	assert.False(t, isPrivateDomain("plan.io"), "only whole labels match")
+}
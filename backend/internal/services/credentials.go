@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -279,6 +280,19 @@ func (s *CredentialService) DeleteCredentials(deviceID string) error {
 	return nil
 }
 
+// isCredentialNotFound reports whether a credential lookup failed because the key was never stored
+// The file backend may return a "no such file" error instead of ErrKeyNotFound
+func isCredentialNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, keyring.ErrKeyNotFound) {
+		return true
+	}
+	errMsg := err.Error()
+	return strings.Contains(errMsg, "no such file") || strings.Contains(errMsg, "not found")
+}
+
 // TestCredentials checks if credentials can be retrieved (used for testing connection)
 func (s *CredentialService) TestCredentials(deviceID string) (bool, error) {
 	_, err := s.GetCredentials(deviceID)
@@ -0,0 +1,785 @@
+package services
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+	"gorm.io/gorm"
+)
+
+// databaseDumpTimeout bounds a single dump or restore transfer
+const databaseDumpTimeout = 2 * time.Hour
+
+// sqlIdentifierRegex matches database and user names that are safe to put in SQL and shell commands
+var sqlIdentifierRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// DatabaseDumpService exports provisioned databases as gzipped SQL dumps and restores them
+// Dumps are streamed out of the shared database container over SSH and stored either on the
+// server or on a backup destination mounted on the database's device
+type DatabaseDumpService struct {
+	db            *gorm.DB
+	sshClient     *ssh.Client
+	databasePool  *DatabasePoolManager
+	backupService *BackupService
+	wsHub         WSHub
+	dumpDir       string   // Server directory for dumps not written to a backup destination
+	activeDumps   sync.Map // map[uuid.UUID]bool - provisioned databases with a dump or restore in flight
+}
+
+// CreateDatabaseDumpRequest represents a request to dump a deployment's database
+type CreateDatabaseDumpRequest struct {
+	DestinationID *uuid.UUID `json:"destination_id,omitempty"` // Backup destination (default: store on the server)
+}
+
+// RestoreDatabaseDumpRequest represents a request to restore a dump
+type RestoreDatabaseDumpRequest struct {
+	// Deployment whose database is replaced (default: the deployment the dump was taken from)
+	// A database is provisioned first if the deployment does not have one yet
+	TargetDeploymentID *uuid.UUID `json:"target_deployment_id,omitempty"`
+}
+
+// NewDatabaseDumpService creates a new database dump service
+func NewDatabaseDumpService(db *gorm.DB, sshClient *ssh.Client, databasePool *DatabasePoolManager, backupService *BackupService, wsHub WSHub, dumpDir string) *DatabaseDumpService {
+	return &DatabaseDumpService{
+		db:            db,
+		sshClient:     sshClient,
+		databasePool:  databasePool,
+		backupService: backupService,
+		wsHub:         wsHub,
+		dumpDir:       dumpDir,
+	}
+}
+
+// ListDumps returns all dumps of a deployment's database, newest first
+func (s *DatabaseDumpService) ListDumps(deploymentID uuid.UUID) ([]models.DatabaseDump, error) {
+	var dumps []models.DatabaseDump
+	if err := s.db.Preload("Destination").
+		Where("deployment_id = ?", deploymentID).
+		Order("started_at DESC").
+		Find(&dumps).Error; err != nil {
+		return nil, err
+	}
+	return dumps, nil
+}
+
+// GetDump returns a single dump
+func (s *DatabaseDumpService) GetDump(id uuid.UUID) (*models.DatabaseDump, error) {
+	var dump models.DatabaseDump
+	if err := s.db.Preload("Destination").First(&dump, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("database dump not found")
+	}
+	return &dump, nil
+}
+
+// StartDump creates a dump record and runs the dump in the background
+func (s *DatabaseDumpService) StartDump(deploymentID uuid.UUID, req CreateDatabaseDumpRequest) (*models.DatabaseDump, error) {
+	job, err := s.prepareDump(deploymentID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer s.unlock(job.provisioned.ID)
+		s.runDump(job)
+	}()
+
+	return job.dump, nil
+}
+
+// CreateDump dumps a deployment's database synchronously and returns the finished dump
+// Used by other services that need a dump before continuing (e.g. upgrades and migrations)
+func (s *DatabaseDumpService) CreateDump(deploymentID uuid.UUID, req CreateDatabaseDumpRequest) (*models.DatabaseDump, error) {
+	job, err := s.prepareDump(deploymentID, req)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlock(job.provisioned.ID)
+
+	if err := s.runDump(job); err != nil {
+		return job.dump, err
+	}
+	return job.dump, nil
+}
+
+// OpenDump returns the local path of a finished dump stored on the server, for downloading
+func (s *DatabaseDumpService) OpenDump(id uuid.UUID) (*models.DatabaseDump, string, error) {
+	dump, err := s.GetDump(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if dump.Status != models.SnapshotStatusSuccess {
+		return nil, "", fmt.Errorf("database dump is not available (status: %s)", dump.Status)
+	}
+	if !dump.IsOnServer() {
+		return nil, "", fmt.Errorf("database dump is stored on a backup destination and cannot be downloaded")
+	}
+
+	path, err := s.serverPath(dump)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, "", fmt.Errorf("database dump file is missing")
+	}
+	return dump, path, nil
+}
+
+// dumpJob holds everything resolved before a dump runs
+type dumpJob struct {
+	dump        *models.DatabaseDump
+	provisioned *models.ProvisionedDatabase
+	instance    *models.SharedDatabaseInstance
+	device      *models.Device
+	destination *models.BackupDestination
+}
+
+// prepareDump resolves the deployment's database and destination and records an in-progress dump
+func (s *DatabaseDumpService) prepareDump(deploymentID uuid.UUID, req CreateDatabaseDumpRequest) (*dumpJob, error) {
+	provisioned, err := s.databasePool.GetProvisionedDatabase(deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("deployment has no provisioned database")
+	}
+	if provisioned.Status != "ready" {
+		return nil, fmt.Errorf("database is not ready (status: %s)", provisioned.Status)
+	}
+
+	if !sqlIdentifierRegex.MatchString(provisioned.DatabaseName) {
+		return nil, fmt.Errorf("invalid database name: %s", provisioned.DatabaseName)
+	}
+
+	instance, device, err := s.getInstanceAndDevice(provisioned)
+	if err != nil {
+		return nil, err
+	}
+
+	var destination *models.BackupDestination
+	if req.DestinationID != nil {
+		var dest models.BackupDestination
+		if err := s.db.First(&dest, "id = ?", *req.DestinationID).Error; err != nil {
+			return nil, fmt.Errorf("backup destination not found")
+		}
+		if !dest.Enabled {
+			return nil, fmt.Errorf("backup destination %s is disabled", dest.Name)
+		}
+		destination = &dest
+	}
+
+	if !s.tryLock(provisioned.ID) {
+		return nil, fmt.Errorf("a dump or restore is already in progress for this database")
+	}
+
+	job, err := s.recordDump(provisioned, instance, device, destination, models.SnapshotTriggerManual)
+	if err != nil {
+		s.unlock(provisioned.ID)
+		return nil, err
+	}
+	return job, nil
+}
+
+// recordDump creates the in-progress record of a dump; the caller holds the database's lock
+func (s *DatabaseDumpService) recordDump(provisioned *models.ProvisionedDatabase, instance *models.SharedDatabaseInstance, device *models.Device, destination *models.BackupDestination, trigger models.SnapshotTrigger) (*dumpJob, error) {
+	dump := &models.DatabaseDump{
+		ID:                    uuid.New(),
+		ProvisionedDatabaseID: provisioned.ID,
+		DeploymentID:          provisioned.DeploymentID,
+		DeviceID:              device.ID,
+		Engine:                instance.Engine,
+		Version:               instance.Version,
+		DatabaseName:          provisioned.DatabaseName,
+		Trigger:               trigger,
+		Status:                models.SnapshotStatusInProgress,
+		StartedAt:             time.Now(),
+	}
+	dump.Path = fmt.Sprintf("%s/%s-%s.sql.gz", provisioned.DatabaseName, dump.StartedAt.UTC().Format("20060102-150405"), dump.ID.String()[:8])
+	if destination != nil {
+		dump.DestinationID = &destination.ID
+		dump.Path = "databases/" + dump.Path
+	}
+
+	if err := s.db.Create(dump).Error; err != nil {
+		return nil, fmt.Errorf("failed to create dump record: %w", err)
+	}
+	dump.Destination = destination
+
+	return &dumpJob{
+		dump:        dump,
+		provisioned: provisioned,
+		instance:    instance,
+		device:      device,
+		destination: destination,
+	}, nil
+}
+
+// runDump streams the dump to its storage location and records the result
+// The caller holds the database's lock
+func (s *DatabaseDumpService) runDump(job *dumpJob) error {
+	dump := job.dump
+	log.Printf("[DatabaseDump] Starting dump of %s", dump.DatabaseName)
+	s.broadcast(dump)
+
+	err := func() error {
+		dumpCmd, err := s.dumpCommand(job.instance, dump.DatabaseName)
+		if err != nil {
+			return err
+		}
+		if job.destination != nil {
+			return s.dumpToDestination(job, dumpCmd)
+		}
+		return s.dumpToServer(job, dumpCmd)
+	}()
+
+	completedAt := time.Now()
+	dump.CompletedAt = &completedAt
+
+	if err != nil {
+		dump.Status = models.SnapshotStatusFailed
+		dump.ErrorMessage = err.Error()
+		s.db.Save(dump)
+		s.broadcast(dump)
+		log.Printf("[DatabaseDump] Dump of %s failed: %v", dump.DatabaseName, err)
+		return err
+	}
+
+	dump.Status = models.SnapshotStatusSuccess
+	s.db.Save(dump)
+	s.broadcast(dump)
+	log.Printf("[DatabaseDump] Dump of %s completed (%d bytes)", dump.DatabaseName, dump.SizeBytes)
+	return nil
+}
+
+// dumpToServer streams the dump over SSH and compresses it into the server's dump directory
+func (s *DatabaseDumpService) dumpToServer(job *dumpJob, dumpCmd string) error {
+	path, err := s.serverPath(job.dump)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create dump directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create dump file: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	_, err = s.sshClient.ExecuteToWriter(job.device.GetSSHHost(), dumpCmd, gz, databaseDumpTimeout)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to dump database: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		job.dump.SizeBytes = info.Size()
+	}
+	return nil
+}
+
+// dumpToDestination compresses the dump on the database's device straight into the backup destination
+func (s *DatabaseDumpService) dumpToDestination(job *dumpJob, dumpCmd string) error {
+	host := job.device.GetSSHHost()
+
+	root, err := s.backupService.prepareDestination(host, job.destination)
+	if err != nil {
+		return err
+	}
+	file := fmt.Sprintf("%s/%s", root, job.dump.Path)
+	if !isValidDeployPath(file) {
+		return fmt.Errorf("invalid dump path: %s", file)
+	}
+
+	// pipefail makes a failing pg_dump/mysqldump fail the command instead of leaving a truncated file
+	writeCmd := fmt.Sprintf("sudo mkdir -p %s && set -o pipefail && %s | gzip | sudo tee %s > /dev/null",
+		filepath.Dir(file), dumpCmd, file)
+	if output, err := s.sshClient.ExecuteWithTimeout(host, writeCmd, databaseDumpTimeout); err != nil {
+		s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo rm -f %s", file), 30*time.Second)
+		return fmt.Errorf("failed to dump database: %w (output: %s)", err, output)
+	}
+
+	sizeOutput, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo stat -c %%s %s", file), 30*time.Second)
+	if err == nil {
+		job.dump.SizeBytes, _ = strconv.ParseInt(strings.TrimSpace(sizeOutput), 10, 64)
+	}
+	return nil
+}
+
+// restoreJob is a validated restore of a dump into a deployment's database
+type restoreJob struct {
+	dump             *models.DatabaseDump
+	deployment       *models.Deployment
+	deploymentDevice *models.Device
+	provisioned      *models.ProvisionedDatabase
+	instance         *models.SharedDatabaseInstance
+	device           *models.Device // Device of the shared database instance
+	recreateCmd      string
+	loadCmd          string
+	provisionedNow   bool // The database was provisioned for this restore, so there is nothing to keep
+}
+
+// StartRestore validates a restore and runs it in the background
+// Progress and the outcome are broadcast on the backups channel
+func (s *DatabaseDumpService) StartRestore(id uuid.UUID, req RestoreDatabaseDumpRequest) error {
+	job, err := s.prepareRestore(id, req)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer s.unlock(job.provisioned.ID)
+		s.runRestore(job)
+	}()
+	return nil
+}
+
+// RestoreDump replaces a deployment's database with the contents of a dump and waits for it to finish
+// The deployment's containers are stopped for the duration of the restore
+func (s *DatabaseDumpService) RestoreDump(id uuid.UUID, req RestoreDatabaseDumpRequest) error {
+	job, err := s.prepareRestore(id, req)
+	if err != nil {
+		return err
+	}
+	defer s.unlock(job.provisioned.ID)
+
+	return s.runRestore(job)
+}
+
+// prepareRestore checks that a dump can be restored into the target deployment and locks its database
+func (s *DatabaseDumpService) prepareRestore(id uuid.UUID, req RestoreDatabaseDumpRequest) (*restoreJob, error) {
+	dump, err := s.GetDump(id)
+	if err != nil {
+		return nil, err
+	}
+	if dump.Status != models.SnapshotStatusSuccess {
+		return nil, fmt.Errorf("database dump cannot be restored (status: %s)", dump.Status)
+	}
+	if !dump.IsOnServer() && dump.Destination == nil {
+		return nil, fmt.Errorf("database dump destination no longer exists")
+	}
+
+	targetID := dump.DeploymentID
+	if req.TargetDeploymentID != nil {
+		targetID = *req.TargetDeploymentID
+	}
+	deployment, deploymentDevice, err := s.backupService.getDeploymentAndDevice(targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	provisioned, provisionedNow, err := s.getOrProvisionDatabase(deployment, deploymentDevice, dump)
+	if err != nil {
+		return nil, err
+	}
+	if provisioned.Status != "ready" {
+		return nil, fmt.Errorf("target database is not ready (status: %s)", provisioned.Status)
+	}
+
+	instance, device, err := s.getInstanceAndDevice(provisioned)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Engine != dump.Engine {
+		return nil, fmt.Errorf("cannot restore a %s dump into a %s database", dump.Engine, instance.Engine)
+	}
+	if !sqlIdentifierRegex.MatchString(provisioned.Username) {
+		return nil, fmt.Errorf("invalid database username: %s", provisioned.Username)
+	}
+
+	recreateCmd, err := s.recreateCommand(instance, provisioned.DatabaseName, provisioned.Username)
+	if err != nil {
+		return nil, err
+	}
+	loadCmd, err := s.loadCommand(instance, provisioned.DatabaseName, provisioned.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.tryLock(provisioned.ID) {
+		return nil, fmt.Errorf("a dump or restore is already in progress for this database")
+	}
+
+	return &restoreJob{
+		dump:             dump,
+		deployment:       deployment,
+		deploymentDevice: deploymentDevice,
+		provisioned:      provisioned,
+		instance:         instance,
+		device:           device,
+		recreateCmd:      recreateCmd,
+		loadCmd:          loadCmd,
+		provisionedNow:   provisionedNow,
+	}, nil
+}
+
+// runRestore replaces the database with the dump's contents; the caller holds the database's lock
+// The current contents are dumped first and loaded back if the restore fails, and the app is
+// started again either way if it was up before
+func (s *DatabaseDumpService) runRestore(job *restoreJob) error {
+	dump, provisioned := job.dump, job.provisioned
+	host := job.device.GetSSHHost()
+	log.Printf("[DatabaseDump] Restoring %s from dump %s", provisioned.DatabaseName, dump.ID)
+	s.broadcastRestore(job, models.SnapshotStatusInProgress, nil)
+
+	err := s.restore(job, host)
+	if err != nil {
+		log.Printf("[DatabaseDump] Restore of %s from dump %s failed: %v", provisioned.DatabaseName, dump.ID, err)
+		s.broadcastRestore(job, models.SnapshotStatusFailed, err)
+		return err
+	}
+
+	log.Printf("[DatabaseDump] Restore of %s from dump %s completed", provisioned.DatabaseName, dump.ID)
+	s.broadcastRestore(job, models.SnapshotStatusSuccess, nil)
+	return nil
+}
+
+// restore performs the steps of a restore job
+func (s *DatabaseDumpService) restore(job *restoreJob, host string) error {
+	if err := s.verifyDump(job.dump); err != nil {
+		return err
+	}
+
+	// Stop the app so nothing holds connections to (or writes into) the database being replaced
+	project := job.deployment.ComposeProject
+	appHost := job.deploymentDevice.GetSSHHost()
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+	if isValidStackName(project) {
+		stopCmd := fmt.Sprintf("cd %s && docker compose -p %s stop", deployDir, project)
+		if output, err := s.sshClient.ExecuteWithTimeout(appHost, stopCmd, 2*time.Minute); err != nil {
+			return fmt.Errorf("failed to stop containers: %w (output: %s)", err, output)
+		}
+
+		wasUp := job.deployment.Status == models.DeploymentStatusRunning || job.deployment.Status == models.DeploymentStatusUnhealthy
+		if wasUp {
+			defer func() {
+				upCmd := fmt.Sprintf("cd %s && docker compose -p %s up -d", deployDir, project)
+				if output, err := s.sshClient.ExecuteWithTimeout(appHost, upCmd, 5*time.Minute); err != nil {
+					log.Printf("[DatabaseDump] Warning: failed to start %s after restore: %v (output: %s)", project, err, output)
+				}
+			}()
+		}
+	}
+
+	// Keep the current contents until the dump has loaded
+	var safety *dumpJob
+	if !job.provisionedNow {
+		var err error
+		safety, err = s.recordDump(job.provisioned, job.instance, job.device, nil, models.SnapshotTriggerRestore)
+		if err != nil {
+			return err
+		}
+		if err := s.runDump(safety); err != nil {
+			return fmt.Errorf("failed to dump the current database before restoring: %w", err)
+		}
+		log.Printf("[DatabaseDump] Saved %s as dump %s before restoring", job.provisioned.DatabaseName, safety.dump.ID)
+	}
+
+	restoreErr := func() error {
+		if output, err := s.sshClient.ExecuteWithTimeout(host, job.recreateCmd, 1*time.Minute); err != nil {
+			return fmt.Errorf("failed to recreate database: %w (output: %s)", err, output)
+		}
+		return s.loadDump(job.dump, job.device, job.loadCmd)
+	}()
+	if restoreErr == nil || safety == nil {
+		return restoreErr
+	}
+
+	// Put the previous contents back
+	if output, err := s.sshClient.ExecuteWithTimeout(host, job.recreateCmd, 1*time.Minute); err != nil {
+		return fmt.Errorf("%w; the previous contents could not be put back (saved as dump %s): %v (output: %s)", restoreErr, safety.dump.ID, err, output)
+	}
+	if err := s.loadDump(safety.dump, job.device, job.loadCmd); err != nil {
+		return fmt.Errorf("%w; the previous contents could not be put back (saved as dump %s): %v", restoreErr, safety.dump.ID, err)
+	}
+	return fmt.Errorf("%w; the previous contents were put back", restoreErr)
+}
+
+// getOrProvisionDatabase returns the deployment's database, provisioning one to restore into if it has none
+// The flag reports whether the database was provisioned just now
+func (s *DatabaseDumpService) getOrProvisionDatabase(deployment *models.Deployment, device *models.Device, dump *models.DatabaseDump) (*models.ProvisionedDatabase, bool, error) {
+	provisioned, err := s.databasePool.GetProvisionedDatabase(deployment.ID)
+	if err == nil {
+		return provisioned, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, fmt.Errorf("failed to get target database: %w", err)
+	}
+
+	provisioned, err = s.databasePool.ProvisionDatabase(deployment, device, models.RecipeDatabaseConfig{
+		Engine:  dump.Engine,
+		Version: dump.Version,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to provision target database: %w", err)
+	}
+	log.Printf("[DatabaseDump] Provisioned database %s to restore dump %s into", provisioned.DatabaseName, dump.ID)
+
+	provisioned, err = s.databasePool.GetProvisionedDatabase(deployment.ID)
+	return provisioned, true, err
+}
+
+// verifyDump checks that a dump file is intact before the target database is dropped
+func (s *DatabaseDumpService) verifyDump(dump *models.DatabaseDump) error {
+	if dump.IsOnServer() {
+		path, err := s.serverPath(dump)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("database dump file is missing")
+		}
+		defer file.Close()
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("database dump file is corrupt: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, gz); err != nil {
+			return fmt.Errorf("database dump file is corrupt: %w", err)
+		}
+		return nil
+	}
+
+	host, file, err := s.destinationFile(dump)
+	if err != nil {
+		return err
+	}
+	if output, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("gzip -t %s", file), 30*time.Minute); err != nil {
+		return fmt.Errorf("database dump file is missing or corrupt: %w (output: %s)", err, output)
+	}
+	return nil
+}
+
+// loadDump streams a dump from wherever it is stored into loadCmd on the database's device
+func (s *DatabaseDumpService) loadDump(dump *models.DatabaseDump, device *models.Device, loadCmd string) error {
+	host := device.GetSSHHost()
+	restoreCmd := fmt.Sprintf("set -o pipefail && gunzip -c | %s", loadCmd)
+
+	if dump.IsOnServer() {
+		path, err := s.serverPath(dump)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("database dump file is missing")
+		}
+		defer file.Close()
+
+		if _, err := s.sshClient.ExecuteWithInput(host, restoreCmd, file, databaseDumpTimeout); err != nil {
+			return fmt.Errorf("failed to restore database: %w", err)
+		}
+		return nil
+	}
+
+	sourceHost, file, err := s.destinationFile(dump)
+	if err != nil {
+		return err
+	}
+
+	if dump.DeviceID == device.ID {
+		localCmd := fmt.Sprintf("set -o pipefail && gunzip -c %s | %s", file, loadCmd)
+		if output, err := s.sshClient.ExecuteWithTimeout(host, localCmd, databaseDumpTimeout); err != nil {
+			return fmt.Errorf("failed to restore database: %w (output: %s)", err, output)
+		}
+		return nil
+	}
+
+	// The dump lives on another device's destination, so stream it across
+	if _, err := s.sshClient.Stream(sourceHost, fmt.Sprintf("sudo cat %s", file), host, restoreCmd, databaseDumpTimeout); err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	return nil
+}
+
+// DeleteDump removes a dump file and its record
+func (s *DatabaseDumpService) DeleteDump(id uuid.UUID) error {
+	dump, err := s.GetDump(id)
+	if err != nil {
+		return err
+	}
+	if dump.Status == models.SnapshotStatusInProgress {
+		return fmt.Errorf("database dump is still in progress")
+	}
+
+	if dump.IsOnServer() {
+		path, err := s.serverPath(dump)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete dump file: %w", err)
+		}
+	} else if dump.Destination != nil {
+		host, file, err := s.destinationFile(dump)
+		if err != nil {
+			return err
+		}
+		if output, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("sudo rm -f %s", file), 30*time.Second); err != nil {
+			return fmt.Errorf("failed to delete dump file: %w (output: %s)", err, output)
+		}
+	}
+
+	if err := s.db.Delete(&models.DatabaseDump{}, "id = ?", dump.ID).Error; err != nil {
+		return fmt.Errorf("failed to delete dump record: %w", err)
+	}
+	return nil
+}
+
+// dumpCommand returns a command that writes a plain SQL dump of a database to stdout
+// Postgres dumps leave out ownership and grants so they restore under any application user
+func (s *DatabaseDumpService) dumpCommand(instance *models.SharedDatabaseInstance, dbName string) (string, error) {
+	if !sqlIdentifierRegex.MatchString(dbName) {
+		return "", fmt.Errorf("invalid database name: %s", dbName)
+	}
+	if instance.Engine == "postgres" {
+		return fmt.Sprintf("docker exec %s pg_dump -U %s --no-owner --no-privileges %s", instance.ContainerName, instance.MasterUsername, dbName), nil
+	}
+	return s.databasePool.generateDumpCommand(instance, dbName)
+}
+
+// recreateCommand returns a command that replaces a database with an empty one the app user can write to
+func (s *DatabaseDumpService) recreateCommand(instance *models.SharedDatabaseInstance, dbName string, username string) (string, error) {
+	if !sqlIdentifierRegex.MatchString(dbName) {
+		return "", fmt.Errorf("invalid database name: %s", dbName)
+	}
+
+	switch instance.Engine {
+	case "postgres":
+		return fmt.Sprintf(`docker exec %s psql -U %s -c "DROP DATABASE IF EXISTS %s;" && \
+docker exec %s psql -U %s -c "CREATE DATABASE %s OWNER %s;"`,
+			instance.ContainerName, instance.MasterUsername, dbName,
+			instance.ContainerName, instance.MasterUsername, dbName, username), nil
+	case "mysql", "mariadb":
+		masterPassword, err := s.databasePool.credService.GetCredential(instance.CredentialKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve master password: %w", err)
+		}
+		// Grants are stored by database name, so the app user keeps access to the new database
+		return fmt.Sprintf(`docker exec %s mysql -u%s -p%s -e "DROP DATABASE IF EXISTS %s; CREATE DATABASE %s;"`,
+			instance.ContainerName, instance.MasterUsername, masterPassword, dbName, dbName), nil
+	default:
+		return "", fmt.Errorf("unsupported engine: %s", instance.Engine)
+	}
+}
+
+// loadCommand returns a command that loads a SQL dump from stdin into a database
+// Postgres dumps are loaded as the app user so the restored objects belong to it
+func (s *DatabaseDumpService) loadCommand(instance *models.SharedDatabaseInstance, dbName string, username string) (string, error) {
+	if instance.Engine == "postgres" {
+		return fmt.Sprintf("docker exec -i %s psql -q -v ON_ERROR_STOP=1 --single-transaction -U %s -d %s", instance.ContainerName, username, dbName), nil
+	}
+	return s.databasePool.generateRestoreCommand(instance, dbName)
+}
+
+// getInstanceAndDevice loads the shared instance a provisioned database lives in and its device
+func (s *DatabaseDumpService) getInstanceAndDevice(provisioned *models.ProvisionedDatabase) (*models.SharedDatabaseInstance, *models.Device, error) {
+	instance := provisioned.SharedDatabaseInstance
+	if instance == nil {
+		instance = &models.SharedDatabaseInstance{}
+		if err := s.db.First(instance, "id = ?", provisioned.SharedDatabaseInstanceID).Error; err != nil {
+			return nil, nil, fmt.Errorf("shared database instance not found")
+		}
+	}
+	if instance.Status != "running" {
+		return nil, nil, fmt.Errorf("shared database instance is not running (status: %s)", instance.Status)
+	}
+	if !isValidStackName(instance.ContainerName) {
+		return nil, nil, fmt.Errorf("invalid container name: %s", instance.ContainerName)
+	}
+
+	var device models.Device
+	if err := s.db.First(&device, "id = ?", instance.DeviceID).Error; err != nil {
+		return nil, nil, fmt.Errorf("device not found")
+	}
+	return instance, &device, nil
+}
+
+// serverPath returns the absolute location of a server-stored dump, refusing paths outside the dump directory
+func (s *DatabaseDumpService) serverPath(dump *models.DatabaseDump) (string, error) {
+	path := filepath.Join(s.dumpDir, dump.Path)
+	if !isValidDeployPath(dump.Path) || !strings.HasPrefix(path, filepath.Clean(s.dumpDir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid dump path: %s", dump.Path)
+	}
+	return path, nil
+}
+
+// destinationFile makes a dump's destination available on the device it was written from
+// and returns that device's SSH host and the dump's full path there
+func (s *DatabaseDumpService) destinationFile(dump *models.DatabaseDump) (string, string, error) {
+	var device models.Device
+	if err := s.db.First(&device, "id = ?", dump.DeviceID).Error; err != nil {
+		return "", "", fmt.Errorf("device holding the dump not found")
+	}
+	host := device.GetSSHHost()
+
+	root, err := s.backupService.prepareDestination(host, dump.Destination)
+	if err != nil {
+		return "", "", err
+	}
+	file := fmt.Sprintf("%s/%s", root, dump.Path)
+	if !isValidDeployPath(file) {
+		return "", "", fmt.Errorf("invalid dump path: %s", file)
+	}
+	return host, file, nil
+}
+
+// tryLock marks a provisioned database as having a dump or restore in flight
+func (s *DatabaseDumpService) tryLock(provisionedID uuid.UUID) bool {
+	_, loaded := s.activeDumps.LoadOrStore(provisionedID, true)
+	return !loaded
+}
+
+// unlock clears the in-flight marker for a provisioned database
+func (s *DatabaseDumpService) unlock(provisionedID uuid.UUID) {
+	s.activeDumps.Delete(provisionedID)
+}
+
+// broadcastRestore sends a restore status update via WebSocket
+func (s *DatabaseDumpService) broadcastRestore(job *restoreJob, status models.SnapshotStatus, err error) {
+	if s.wsHub == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"dump_id":       job.dump.ID,
+		"deployment_id": job.deployment.ID,
+		"database_name": job.provisioned.DatabaseName,
+		"status":        status,
+	}
+	if err != nil {
+		data["error_message"] = err.Error()
+	}
+	s.wsHub.Broadcast("backups", "database_dump:restore", data)
+}
+
+// broadcast sends a dump status update via WebSocket
+func (s *DatabaseDumpService) broadcast(dump *models.DatabaseDump) {
+	if s.wsHub == nil {
+		return
+	}
+	s.wsHub.Broadcast("backups", "database_dump:status", map[string]interface{}{
+		"id":            dump.ID,
+		"deployment_id": dump.DeploymentID,
+		"database_name": dump.DatabaseName,
+		"status":        dump.Status,
+		"size_bytes":    dump.SizeBytes,
+		"error_message": dump.ErrorMessage,
+	})
+}
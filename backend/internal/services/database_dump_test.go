@@ -0,0 +1,200 @@
+package services
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDatabaseDumpTest(t *testing.T) (*DatabaseDumpService, *models.ProvisionedDatabase) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	databasePool := NewDatabasePoolManager(db, nil, credService, nil, nil)
+	service := NewDatabaseDumpService(db, nil, databasePool, NewBackupService(db, nil, nil, nil), nil, t.TempDir())
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+
+	instance := &models.SharedDatabaseInstance{DeviceID: device.ID, Engine: "postgres", Version: "16", Status: "running",
+		ContainerName: "homelab-postgres-shared", ComposeProject: "homelab-postgres-shared", Port: 5432, InternalPort: 5432,
+		MasterUsername: "postgres", CredentialKey: "shared-postgres-master"}
+	require.NoError(t, db.Create(instance).Error)
+
+	provisioned := &models.ProvisionedDatabase{SharedDatabaseInstanceID: instance.ID, DeploymentID: uuid.New(),
+		DatabaseName: "nextcloud_1a2b3c4d", Username: "nextcloud_user", CredentialKey: "db-nextcloud", Status: "ready"}
+	require.NoError(t, db.Create(provisioned).Error)
+	provisioned.SharedDatabaseInstance = instance
+
+	return service, provisioned
+}
+
+// writeServerDump stores a finished server-side dump with the given SQL content
+func writeServerDump(t *testing.T, service *DatabaseDumpService, provisioned *models.ProvisionedDatabase, sql string) *models.DatabaseDump {
+	dump := &models.DatabaseDump{ProvisionedDatabaseID: provisioned.ID, DeploymentID: provisioned.DeploymentID,
+		DeviceID: provisioned.SharedDatabaseInstance.DeviceID, Engine: "postgres", Version: "16", DatabaseName: provisioned.DatabaseName,
+		Path: provisioned.DatabaseName + "/20260101-000000-abcdef12.sql.gz", Status: models.SnapshotStatusSuccess, StartedAt: time.Now()}
+	require.NoError(t, service.db.Create(dump).Error)
+
+	path := filepath.Join(service.dumpDir, dump.Path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	_, err = gz.Write([]byte(sql))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, file.Close())
+
+	return dump
+}
+
+func TestDatabaseDumpCommands(t *testing.T) {
+	service, provisioned := setupDatabaseDumpTest(t)
+	instance := provisioned.SharedDatabaseInstance
+
+	dump, err := service.dumpCommand(instance, "nextcloud_1a2b3c4d")
+	require.NoError(t, err)
+	assert.Equal(t, "docker exec homelab-postgres-shared pg_dump -U postgres --no-owner --no-privileges nextcloud_1a2b3c4d", dump)
+
+	recreate, err := service.recreateCommand(instance, "nextcloud_1a2b3c4d", "nextcloud_user")
+	require.NoError(t, err)
+	assert.Contains(t, recreate, `DROP DATABASE IF EXISTS nextcloud_1a2b3c4d;`)
+	assert.Contains(t, recreate, `CREATE DATABASE nextcloud_1a2b3c4d OWNER nextcloud_user;`)
+
+	load, err := service.loadCommand(instance, "nextcloud_1a2b3c4d", "nextcloud_user")
+	require.NoError(t, err)
+	assert.Equal(t, "docker exec -i homelab-postgres-shared psql -q -v ON_ERROR_STOP=1 --single-transaction -U nextcloud_user -d nextcloud_1a2b3c4d", load,
+		"dumps are loaded as the app user so it owns the restored tables")
+
+	_, err = service.dumpCommand(instance, "db; rm -rf /")
+	assert.Error(t, err)
+	_, err = service.recreateCommand(instance, "db\"; DROP", "user")
+	assert.Error(t, err)
+}
+
+func TestDatabaseDumpService_StartDumpValidation(t *testing.T) {
+	service, provisioned := setupDatabaseDumpTest(t)
+
+	_, err := service.StartDump(uuid.New(), CreateDatabaseDumpRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no provisioned database")
+
+	destination := &models.BackupDestination{Name: "nas", Type: models.BackupDestinationLocal, Path: "/mnt/backups"}
+	require.NoError(t, service.db.Create(destination).Error)
+	require.NoError(t, service.db.Model(destination).Update("enabled", false).Error)
+
+	_, err = service.StartDump(provisioned.DeploymentID, CreateDatabaseDumpRequest{DestinationID: &destination.ID})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disabled")
+
+	require.True(t, service.tryLock(provisioned.ID))
+	_, err = service.StartDump(provisioned.DeploymentID, CreateDatabaseDumpRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already in progress")
+	service.unlock(provisioned.ID)
+
+	require.NoError(t, service.db.Model(provisioned).Update("status", "failed").Error)
+	_, err = service.StartDump(provisioned.DeploymentID, CreateDatabaseDumpRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not ready")
+
+	dumps, err := service.ListDumps(provisioned.DeploymentID)
+	require.NoError(t, err)
+	assert.Empty(t, dumps, "nothing is recorded for rejected requests")
+}
+
+func TestDatabaseDumpService_OpenDump(t *testing.T) {
+	service, provisioned := setupDatabaseDumpTest(t)
+	dump := writeServerDump(t, service, provisioned, "CREATE TABLE files (id int);\n")
+
+	opened, path, err := service.OpenDump(dump.ID)
+	require.NoError(t, err)
+	assert.Equal(t, dump.ID, opened.ID)
+	assert.Equal(t, filepath.Join(service.dumpDir, dump.Path), path)
+
+	destinationID := uuid.New()
+	require.NoError(t, service.db.Model(dump).Update("destination_id", destinationID).Error)
+	_, _, err = service.OpenDump(dump.ID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backup destination")
+
+	// Paths from the database never escape the dump directory
+	_, err = service.serverPath(&models.DatabaseDump{Path: "../../etc/passwd"})
+	assert.Error(t, err)
+}
+
+func TestDatabaseDumpService_VerifyDump(t *testing.T) {
+	service, provisioned := setupDatabaseDumpTest(t)
+	dump := writeServerDump(t, service, provisioned, "CREATE TABLE files (id int);\n")
+
+	require.NoError(t, service.verifyDump(dump))
+
+	// A truncated file is refused before the target database is dropped
+	path := filepath.Join(service.dumpDir, dump.Path)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-4))
+	assert.Error(t, service.verifyDump(dump))
+}
+
+func TestDatabaseDumpService_RestoreValidation(t *testing.T) {
+	service, provisioned := setupDatabaseDumpTest(t)
+	dump := writeServerDump(t, service, provisioned, "CREATE TABLE files (id int);\n")
+
+	deployment := &models.Deployment{RecipeSlug: "nextcloud", DeviceID: provisioned.SharedDatabaseInstance.DeviceID, Status: models.DeploymentStatusRunning}
+	require.NoError(t, service.db.Create(deployment).Error)
+	mysql := &models.SharedDatabaseInstance{DeviceID: deployment.DeviceID, Engine: "mysql", Version: "8.0", Status: "running",
+		ContainerName: "homelab-mysql-shared", ComposeProject: "homelab-mysql-shared", Port: 3306, InternalPort: 3306,
+		MasterUsername: "root", CredentialKey: "shared-mysql-master"}
+	require.NoError(t, service.db.Create(mysql).Error)
+	require.NoError(t, service.db.Create(&models.ProvisionedDatabase{SharedDatabaseInstanceID: mysql.ID, DeploymentID: deployment.ID,
+		DatabaseName: "nextcloud_9f8e7d6c", Username: "nextcloud_user", CredentialKey: "db-other", Status: "ready"}).Error)
+
+	err := service.RestoreDump(dump.ID, RestoreDatabaseDumpRequest{TargetDeploymentID: &deployment.ID})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot restore a postgres dump into a mysql database")
+
+	missing := uuid.New()
+	err = service.RestoreDump(dump.ID, RestoreDatabaseDumpRequest{TargetDeploymentID: &missing})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deployment not found")
+
+	// Background restores are validated and locked before the request returns
+	source := &models.Deployment{ID: provisioned.DeploymentID, RecipeSlug: "nextcloud", DeviceID: deployment.DeviceID, Status: models.DeploymentStatusRunning}
+	require.NoError(t, service.db.Create(source).Error)
+	require.True(t, service.tryLock(provisioned.ID))
+	err = service.StartRestore(dump.ID, RestoreDatabaseDumpRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already in progress")
+	service.unlock(provisioned.ID)
+
+	require.NoError(t, service.db.Model(dump).Update("status", models.SnapshotStatusFailed).Error)
+	err = service.RestoreDump(dump.ID, RestoreDatabaseDumpRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be restored")
+	assert.Error(t, service.StartRestore(dump.ID, RestoreDatabaseDumpRequest{}))
+}
+
+func TestDatabaseDumpService_DeleteDump(t *testing.T) {
+	service, provisioned := setupDatabaseDumpTest(t)
+	dump := writeServerDump(t, service, provisioned, "CREATE TABLE files (id int);\n")
+	path := filepath.Join(service.dumpDir, dump.Path)
+
+	require.NoError(t, service.DeleteDump(dump.ID))
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "dump file is removed")
+	_, err = service.GetDump(dump.ID)
+	assert.Error(t, err)
+
+	inProgress := writeServerDump(t, service, provisioned, "")
+	require.NoError(t, service.db.Model(inProgress).Update("status", models.SnapshotStatusInProgress).Error)
+	assert.Error(t, service.DeleteDump(inProgress.ID))
+}
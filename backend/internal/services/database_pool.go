@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -22,6 +23,7 @@ type DatabasePoolManager struct {
 	credService    *CredentialService
 	infraConfig    *InfrastructureConfig
 	orchestrator   ContainerOrchestrator
+	ports          *PortRegistry
 }
 
 // NewDatabasePoolManager creates a new database pool manager
@@ -32,6 +34,7 @@ func NewDatabasePoolManager(db *gorm.DB, sshClient *ssh.Client, credService *Cre
 		credService:  credService,
 		infraConfig:  infraConfig,
 		orchestrator: orchestrator,
+		ports:        NewPortRegistry(db, sshClient),
 	}
 }
 
@@ -65,16 +68,20 @@ func (dpm *DatabasePoolManager) GetOrCreateSharedInstance(device *models.Device,
 // createSharedInstance creates and deploys a new shared database instance
 func (dpm *DatabasePoolManager) createSharedInstance(device *models.Device, engine string, version string) (*models.SharedDatabaseInstance, error) {
 	// Generate master credentials
+	// A removed instance leaves its data volume behind, which only accepts the master password it was created with
 	masterUsername := dpm.infraConfig.GetMasterUsername(engine)
-	masterPassword, err := dpm.generateSecurePassword(32)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate master password: %w", err)
-	}
-
-	// Store master credentials
 	credKey := fmt.Sprintf("shared-%s-%s", engine, device.ID.String())
-	if err := dpm.credService.StoreCredential(credKey, masterPassword); err != nil {
-		return nil, fmt.Errorf("failed to store master credentials: %w", err)
+	masterPassword, err := dpm.credService.GetCredential(credKey)
+	if err != nil || masterPassword == "" {
+		masterPassword, err = dpm.generateSecurePassword(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate master password: %w", err)
+		}
+
+		// Store master credentials
+		if err := dpm.credService.StoreCredential(credKey, masterPassword); err != nil {
+			return nil, fmt.Errorf("failed to store master credentials: %w", err)
+		}
 	}
 
 	// Determine version from config if not specified
@@ -88,6 +95,12 @@ func (dpm *DatabasePoolManager) createSharedInstance(device *models.Device, engi
 		return nil, fmt.Errorf("failed to get database config: %w", err)
 	}
 
+	// Another engine or an unmanaged process may already hold the engine's default port
+	port, err := dpm.ports.FindFreePort(device, dbConfig.Port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find available port: %w", err)
+	}
+
 	// Create database record
 	instance := &models.SharedDatabaseInstance{
 		DeviceID:       device.ID,
@@ -96,7 +109,7 @@ func (dpm *DatabasePoolManager) createSharedInstance(device *models.Device, engi
 		Status:         "provisioning",
 		ContainerName:  fmt.Sprintf("homelab-%s-shared", engine),
 		ComposeProject: fmt.Sprintf("homelab-%s-shared", engine),
-		Port:           dbConfig.Port,
+		Port:           port,
 		InternalPort:   dbConfig.InternalPort,
 		MasterUsername: masterUsername,
 		CredentialKey:  credKey,
@@ -164,21 +177,26 @@ func (dpm *DatabasePoolManager) deploySharedInstance(device *models.Device, inst
 
 // generateSharedInstanceCompose generates a docker-compose.yaml for a shared database instance
 func (dpm *DatabasePoolManager) generateSharedInstanceCompose(instance *models.SharedDatabaseInstance, masterPassword string) (string, error) {
+	return dpm.generateDatabaseCompose(instance, masterPassword, dpm.infraConfig.GetDatabaseImage(instance.Engine))
+}
+
+// generateDatabaseCompose generates a docker-compose.yaml for a database container using the given image
+// Shared and dedicated instances are built from the same templates
+func (dpm *DatabasePoolManager) generateDatabaseCompose(instance *models.SharedDatabaseInstance, masterPassword string, dockerImage string) (string, error) {
 	switch instance.Engine {
 	case "postgres":
-		return dpm.generatePostgresCompose(instance, masterPassword), nil
+		return dpm.generatePostgresCompose(instance, masterPassword, dockerImage), nil
 	case "mysql":
-		return dpm.generateMySQLCompose(instance, masterPassword), nil
+		return dpm.generateMySQLCompose(instance, masterPassword, dockerImage), nil
 	case "mariadb":
-		return dpm.generateMariaDBCompose(instance, masterPassword), nil
+		return dpm.generateMariaDBCompose(instance, masterPassword, dockerImage), nil
 	default:
 		return "", fmt.Errorf("unsupported database engine: %s", instance.Engine)
 	}
 }
 
-// generatePostgresCompose generates docker-compose for shared Postgres instance
-func (dpm *DatabasePoolManager) generatePostgresCompose(instance *models.SharedDatabaseInstance, masterPassword string) string {
-	dockerImage := dpm.infraConfig.GetDatabaseImage("postgres")
+// generatePostgresCompose generates docker-compose for a Postgres instance
+func (dpm *DatabasePoolManager) generatePostgresCompose(instance *models.SharedDatabaseInstance, masterPassword string, dockerImage string) string {
 	return fmt.Sprintf(`version: '3.8'
 services:
   postgres:
@@ -204,9 +222,8 @@ volumes:
 `, dockerImage, instance.Version, instance.ContainerName, instance.MasterUsername, masterPassword, instance.Port, instance.InternalPort, instance.MasterUsername)
 }
 
-// generateMySQLCompose generates docker-compose for shared MySQL instance
-func (dpm *DatabasePoolManager) generateMySQLCompose(instance *models.SharedDatabaseInstance, masterPassword string) string {
-	dockerImage := dpm.infraConfig.GetDatabaseImage("mysql")
+// generateMySQLCompose generates docker-compose for a MySQL instance
+func (dpm *DatabasePoolManager) generateMySQLCompose(instance *models.SharedDatabaseInstance, masterPassword string, dockerImage string) string {
 	return fmt.Sprintf(`version: '3.8'
 services:
   mysql:
@@ -231,9 +248,8 @@ volumes:
 `, dockerImage, instance.Version, instance.ContainerName, masterPassword, instance.Port, instance.InternalPort, masterPassword)
 }
 
-// generateMariaDBCompose generates docker-compose for shared MariaDB instance
-func (dpm *DatabasePoolManager) generateMariaDBCompose(instance *models.SharedDatabaseInstance, masterPassword string) string {
-	dockerImage := dpm.infraConfig.GetDatabaseImage("mariadb")
+// generateMariaDBCompose generates docker-compose for a MariaDB instance
+func (dpm *DatabasePoolManager) generateMariaDBCompose(instance *models.SharedDatabaseInstance, masterPassword string, dockerImage string) string {
 	return fmt.Sprintf(`version: '3.8'
 services:
   mariadb:
@@ -562,3 +578,217 @@ func (dpm *DatabasePoolManager) GetDatabaseCredentials(
 		"DB_ENGINE":   engine,
 	}, nil
 }
+
+// ====== DEPLOYMENT MIGRATION ======
+// These methods move a deployment's provisioned database between devices
+
+// CopyDatabaseToDevice recreates a provisioned database in the target device's shared instance
+// The database name, user and password are kept, and the contents are streamed from a dump of the source
+// Returns the target shared instance; nothing is left on the target if the copy fails
+func (dpm *DatabasePoolManager) CopyDatabaseToDevice(provisioned *models.ProvisionedDatabase, source *models.Device, target *models.Device) (*models.SharedDatabaseInstance, error) {
+	sourceInstance := provisioned.SharedDatabaseInstance
+	if sourceInstance == nil {
+		sourceInstance = &models.SharedDatabaseInstance{}
+		if err := dpm.db.First(sourceInstance, "id = ?", provisioned.SharedDatabaseInstanceID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get source shared instance: %w", err)
+		}
+	}
+
+	targetInstance, err := dpm.GetOrCreateSharedInstance(target, sourceInstance.Engine, sourceInstance.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared instance on target: %w", err)
+	}
+	if targetInstance.Status != "running" {
+		return nil, fmt.Errorf("shared instance on target is not running (status: %s)", targetInstance.Status)
+	}
+
+	password, err := dpm.credService.GetCredential(provisioned.CredentialKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve database password: %w", err)
+	}
+
+	// Refuse to touch a database or user that already exists, so a rollback never drops someone else's
+	exists, err := dpm.databaseOrUserExists(target, targetInstance, provisioned.DatabaseName, provisioned.Username)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("database %s or user %s already exists in the target's shared %s instance", provisioned.DatabaseName, provisioned.Username, targetInstance.Engine)
+	}
+
+	if err := dpm.createDatabaseAndUser(target, targetInstance, provisioned.DatabaseName, provisioned.Username, password); err != nil {
+		dpm.DropDatabase(target, targetInstance, provisioned.DatabaseName, provisioned.Username)
+		return nil, err
+	}
+
+	dumpCmd, err := dpm.generateDumpCommand(sourceInstance, provisioned.DatabaseName)
+	if err != nil {
+		dpm.DropDatabase(target, targetInstance, provisioned.DatabaseName, provisioned.Username)
+		return nil, err
+	}
+	restoreCmd, err := dpm.generateRestoreCommand(targetInstance, provisioned.DatabaseName)
+	if err != nil {
+		dpm.DropDatabase(target, targetInstance, provisioned.DatabaseName, provisioned.Username)
+		return nil, err
+	}
+
+	transferred, err := dpm.sshClient.Stream(source.GetSSHHost(), dumpCmd, target.GetSSHHost(), restoreCmd, 1*time.Hour)
+	if err != nil {
+		dpm.DropDatabase(target, targetInstance, provisioned.DatabaseName, provisioned.Username)
+		return nil, fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	log.Printf("[DatabasePool] Copied database %s from %s to %s (%d bytes)", provisioned.DatabaseName, source.Name, target.Name, transferred)
+	return targetInstance, nil
+}
+
+// MoveProvisionedDatabase points a provisioned database record at its copy on another device
+// It runs within the migration's transaction, so the record only moves together with the deployment
+func (dpm *DatabasePoolManager) MoveProvisionedDatabase(tx *gorm.DB, provisioned *models.ProvisionedDatabase, targetInstance *models.SharedDatabaseInstance, target *models.Device) error {
+	if err := tx.Model(&models.ProvisionedDatabase{}).Where("id = ?", provisioned.ID).Updates(map[string]interface{}{
+		"shared_database_instance_id": targetInstance.ID,
+		"host":                        target.GetPrimaryAddress(),
+		"port":                        targetInstance.Port,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update provisioned database: %w", err)
+	}
+	if err := tx.Model(&models.SharedDatabaseInstance{}).Where("id = ? AND database_count > 0", provisioned.SharedDatabaseInstanceID).
+		Update("database_count", gorm.Expr("database_count - 1")).Error; err != nil {
+		return fmt.Errorf("failed to update source instance: %w", err)
+	}
+	if err := tx.Model(&models.SharedDatabaseInstance{}).Where("id = ?", targetInstance.ID).
+		Update("database_count", gorm.Expr("database_count + 1")).Error; err != nil {
+		return fmt.Errorf("failed to update target instance: %w", err)
+	}
+	return nil
+}
+
+// RemoveSharedInstance stops a shared instance that no deployment uses any more and deletes its records
+// The data volume and master credential are kept so recreating the instance recovers its databases
+func (dpm *DatabasePoolManager) RemoveSharedInstance(instance *models.SharedDatabaseInstance) error {
+	var device models.Device
+	err := dpm.db.First(&device, "id = ?", instance.DeviceID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+
+	// A deleted device has nothing left to clean up remotely
+	if err == nil {
+		spec := RemovalSpec{
+			Host:      device.GetSSHHost(),
+			StackName: instance.ComposeProject,
+			DeployDir: fmt.Sprintf("~/homelab-deployments/%s", instance.ComposeProject),
+		}
+		if err := dpm.orchestrator.RemoveWithCleanup(context.Background(), spec); err != nil {
+			return fmt.Errorf("failed to remove shared instance containers: %w", err)
+		}
+	}
+
+	if err := dpm.db.Where("shared_database_instance_id = ?", instance.ID).Delete(&models.ProvisionedDatabase{}).Error; err != nil {
+		return fmt.Errorf("failed to delete provisioned databases: %w", err)
+	}
+	if err := dpm.db.Delete(instance).Error; err != nil {
+		return fmt.Errorf("failed to delete shared instance record: %w", err)
+	}
+
+	log.Printf("[DatabasePool] Removed shared %s instance on %s (volumes preserved)", instance.Engine, device.Name)
+	return nil
+}
+
+// DropDatabase removes a database and its user from a shared instance
+func (dpm *DatabasePoolManager) DropDatabase(device *models.Device, instance *models.SharedDatabaseInstance, dbName string, username string) error {
+	masterPassword, err := dpm.credService.GetCredential(instance.CredentialKey)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve master password: %w", err)
+	}
+
+	var dropCmd string
+	switch instance.Engine {
+	case "postgres":
+		dropCmd = fmt.Sprintf(`docker exec %s psql -U %s -c "DROP DATABASE IF EXISTS %s;" && \
+docker exec %s psql -U %s -c "DROP ROLE IF EXISTS %s;"`,
+			instance.ContainerName, instance.MasterUsername, dbName,
+			instance.ContainerName, instance.MasterUsername, username)
+	case "mysql", "mariadb":
+		dropCmd = fmt.Sprintf(`docker exec %s mysql -u%s -p%s -e "DROP DATABASE IF EXISTS %s; DROP USER IF EXISTS '%s'@'%%';"`,
+			instance.ContainerName, instance.MasterUsername, masterPassword, dbName, username)
+	default:
+		return fmt.Errorf("unsupported engine: %s", instance.Engine)
+	}
+
+	output, err := dpm.sshClient.ExecuteWithTimeout(device.GetSSHHost(), dropCmd, 1*time.Minute)
+	if err != nil {
+		log.Printf("[DatabasePool] Warning: failed to drop database %s on %s: %v", dbName, device.Name, err)
+		return fmt.Errorf("failed to drop database: %w (output: %s)", err, output)
+	}
+
+	log.Printf("[DatabasePool] Dropped database %s and user %s on %s", dbName, username, device.Name)
+	return nil
+}
+
+// databaseOrUserExists reports whether a database or user name is already taken in a shared instance
+func (dpm *DatabasePoolManager) databaseOrUserExists(device *models.Device, instance *models.SharedDatabaseInstance, dbName string, username string) (bool, error) {
+	masterPassword, err := dpm.credService.GetCredential(instance.CredentialKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve master password: %w", err)
+	}
+
+	var checkCmd string
+	switch instance.Engine {
+	case "postgres":
+		checkCmd = fmt.Sprintf(`docker exec %s psql -U %s -tAc "SELECT 1 FROM pg_database WHERE datname = '%s' UNION ALL SELECT 1 FROM pg_roles WHERE rolname = '%s';"`,
+			instance.ContainerName, instance.MasterUsername, dbName, username)
+	case "mysql", "mariadb":
+		checkCmd = fmt.Sprintf(`docker exec %s mysql -u%s -p%s -N -e "SELECT 1 FROM information_schema.schemata WHERE schema_name = '%s' UNION ALL SELECT 1 FROM mysql.user WHERE user = '%s';"`,
+			instance.ContainerName, instance.MasterUsername, masterPassword, dbName, username)
+	default:
+		return false, fmt.Errorf("unsupported engine: %s", instance.Engine)
+	}
+
+	output, err := dpm.sshClient.ExecuteWithTimeout(device.GetSSHHost(), checkCmd, 30*time.Second)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for existing database: %w (output: %s)", err, output)
+	}
+
+	// mysql prints a password warning alongside the results, so look for a result row
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "1" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// generateDumpCommand returns a command that writes a plain SQL dump of a database to stdout
+// Object ownership is kept, so the restored tables still belong to the application's user
+func (dpm *DatabasePoolManager) generateDumpCommand(instance *models.SharedDatabaseInstance, dbName string) (string, error) {
+	switch instance.Engine {
+	case "postgres":
+		return fmt.Sprintf("docker exec %s pg_dump -U %s %s", instance.ContainerName, instance.MasterUsername, dbName), nil
+	case "mysql", "mariadb":
+		masterPassword, err := dpm.credService.GetCredential(instance.CredentialKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve master password: %w", err)
+		}
+		return fmt.Sprintf("docker exec %s mysqldump -u%s -p%s --single-transaction --routines --triggers %s",
+			instance.ContainerName, instance.MasterUsername, masterPassword, dbName), nil
+	default:
+		return "", fmt.Errorf("unsupported engine: %s", instance.Engine)
+	}
+}
+
+// generateRestoreCommand returns a command that loads a SQL dump from stdin into a database
+func (dpm *DatabasePoolManager) generateRestoreCommand(instance *models.SharedDatabaseInstance, dbName string) (string, error) {
+	switch instance.Engine {
+	case "postgres":
+		return fmt.Sprintf("docker exec -i %s psql -q -v ON_ERROR_STOP=1 -U %s -d %s", instance.ContainerName, instance.MasterUsername, dbName), nil
+	case "mysql", "mariadb":
+		masterPassword, err := dpm.credService.GetCredential(instance.CredentialKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve master password: %w", err)
+		}
+		return fmt.Sprintf("docker exec -i %s mysql -u%s -p%s %s", instance.ContainerName, instance.MasterUsername, masterPassword, dbName), nil
+	default:
+		return "", fmt.Errorf("unsupported engine: %s", instance.Engine)
+	}
+}
@@ -0,0 +1,552 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+// DedicatedInstanceManager deploys database and cache containers owned by a single deployment
+// Compose files come from the same templates as DatabasePoolManager and CachePoolManager,
+// but each instance gets its own port, credentials and compose project
+type DedicatedInstanceManager struct {
+	db           *gorm.DB
+	credService  *CredentialService
+	infraConfig  *InfrastructureConfig
+	orchestrator ContainerOrchestrator
+	databasePool *DatabasePoolManager
+	cachePool    *CachePoolManager
+}
+
+// NewDedicatedInstanceManager creates a new dedicated instance manager
+func NewDedicatedInstanceManager(
+	db *gorm.DB,
+	credService *CredentialService,
+	infraConfig *InfrastructureConfig,
+	orchestrator ContainerOrchestrator,
+	databasePool *DatabasePoolManager,
+	cachePool *CachePoolManager,
+) *DedicatedInstanceManager {
+	return &DedicatedInstanceManager{
+		db:           db,
+		credService:  credService,
+		infraConfig:  infraConfig,
+		orchestrator: orchestrator,
+		databasePool: databasePool,
+		cachePool:    cachePool,
+	}
+}
+
+// DedicatedInstanceRequest describes a dedicated database or cache to provision for a deployment
+type DedicatedInstanceRequest struct {
+	DeploymentID uuid.UUID
+	DeviceID     uuid.UUID
+	Engine       string
+	Version      string // Defaults to the engine's configured version
+	Image        string // Defaults to the engine's configured image
+	AppSlug      string
+	DatabaseName string // Databases only; generated if empty
+}
+
+// ProvisionDatabase deploys a dedicated database container and creates the app's database and user in it
+// Returns the existing instance if the deployment already has a running one for this engine
+func (m *DedicatedInstanceManager) ProvisionDatabase(ctx context.Context, req DedicatedInstanceRequest) (*models.DedicatedInstance, error) {
+	if err := m.infraConfig.ValidateDatabaseEngine(req.Engine); err != nil {
+		return nil, err
+	}
+
+	existing, err := m.findRunning(req.DeploymentID, models.DedicatedInstanceKindDatabase, req.Engine)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	dbConfig, err := m.infraConfig.GetDatabaseConfig(req.Engine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database config: %w", err)
+	}
+
+	instance, device, err := m.newInstance(ctx, req, models.DedicatedInstanceKindDatabase, dbConfig.DefaultVersion, dbConfig.DockerImage, dbConfig.Port)
+	if err != nil {
+		return nil, err
+	}
+	instance.InternalPort = dbConfig.InternalPort
+	instance.MasterUsername = dbConfig.MasterUsername
+	instance.DatabaseName = req.DatabaseName
+	if instance.DatabaseName == "" {
+		instance.DatabaseName = m.databasePool.generateDatabaseName(req.AppSlug, req.DeploymentID)
+	}
+	instance.Username = m.databasePool.generateUsername(req.AppSlug)
+
+	masterPassword, err := generateSecurePassword(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate master password: %w", err)
+	}
+	password, err := generateSecurePassword(24)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	instance.MasterCredentialKey = fmt.Sprintf("dedicated-%s-master", instance.ID)
+	instance.CredentialKey = fmt.Sprintf("dedicated-%s-user", instance.ID)
+	if err := m.credService.StoreCredential(instance.MasterCredentialKey, masterPassword); err != nil {
+		return nil, fmt.Errorf("failed to store master credentials: %w", err)
+	}
+	if err := m.credService.StoreCredential(instance.CredentialKey, password); err != nil {
+		m.deleteCredentials(instance)
+		return nil, fmt.Errorf("failed to store credentials: %w", err)
+	}
+
+	if err := m.db.Create(instance).Error; err != nil {
+		m.deleteCredentials(instance)
+		return nil, fmt.Errorf("failed to create dedicated instance record: %w", err)
+	}
+
+	composeContent, err := m.databaseCompose(instance, masterPassword)
+	if err == nil {
+		err = m.deploy(ctx, device, instance, composeContent)
+	}
+	if err == nil {
+		// Same create commands as the shared pool; the master password is read from the credential store
+		err = m.databasePool.createDatabaseAndUser(device, m.asSharedDatabase(instance), instance.DatabaseName, instance.Username, password)
+	}
+	if err != nil {
+		m.discard(device, instance, err)
+		return nil, fmt.Errorf("failed to deploy dedicated %s instance: %w", req.Engine, err)
+	}
+
+	if err := m.markRunning(instance); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DedicatedInstance] Deployed dedicated %s %s for deployment %s on %s (port %d)", instance.Engine, instance.Version, req.DeploymentID, device.Name, instance.Port)
+	return instance, nil
+}
+
+// ProvisionCache deploys a dedicated cache container for a deployment
+// Returns the existing instance if the deployment already has a running one for this engine
+func (m *DedicatedInstanceManager) ProvisionCache(ctx context.Context, req DedicatedInstanceRequest) (*models.DedicatedInstance, error) {
+	if err := m.infraConfig.ValidateCacheEngine(req.Engine); err != nil {
+		return nil, err
+	}
+
+	existing, err := m.findRunning(req.DeploymentID, models.DedicatedInstanceKindCache, req.Engine)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	cacheConfig, err := m.infraConfig.GetCacheConfig(req.Engine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache config: %w", err)
+	}
+
+	instance, device, err := m.newInstance(ctx, req, models.DedicatedInstanceKindCache, cacheConfig.DefaultVersion, cacheConfig.DockerImage, cacheConfig.Port)
+	if err != nil {
+		return nil, err
+	}
+	instance.InternalPort = cacheInternalPort(req.Engine)
+	instance.MaxMemoryMB = cacheConfig.EstimatedRAMMB
+	if instance.MaxMemoryMB <= 0 {
+		instance.MaxMemoryMB = 64
+	}
+
+	// Memcached has no authentication, so only Valkey/Redis get a password
+	var masterPassword string
+	if req.Engine != "memcached" {
+		masterPassword, err = generateSecurePassword(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate master password: %w", err)
+		}
+		instance.MasterCredentialKey = fmt.Sprintf("dedicated-%s-master", instance.ID)
+		if err := m.credService.StoreCredential(instance.MasterCredentialKey, masterPassword); err != nil {
+			return nil, fmt.Errorf("failed to store master credentials: %w", err)
+		}
+	}
+
+	if err := m.db.Create(instance).Error; err != nil {
+		m.deleteCredentials(instance)
+		return nil, fmt.Errorf("failed to create dedicated instance record: %w", err)
+	}
+
+	composeContent, err := m.cacheCompose(instance, masterPassword)
+	if err == nil {
+		err = m.deploy(ctx, device, instance, composeContent)
+	}
+	if err != nil {
+		m.discard(device, instance, err)
+		return nil, fmt.Errorf("failed to deploy dedicated %s instance: %w", req.Engine, err)
+	}
+
+	if err := m.markRunning(instance); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DedicatedInstance] Deployed dedicated %s %s for deployment %s on %s (port %d)", instance.Engine, instance.Version, req.DeploymentID, device.Name, instance.Port)
+	return instance, nil
+}
+
+// GetInstances returns the dedicated instances owned by a deployment
+func (m *DedicatedInstanceManager) GetInstances(deploymentID uuid.UUID) ([]models.DedicatedInstance, error) {
+	var instances []models.DedicatedInstance
+	if err := m.db.Where("deployment_id = ?", deploymentID).Order("created_at").Find(&instances).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dedicated instances: %w", err)
+	}
+	return instances, nil
+}
+
+// GetConnectionEnvVars returns the environment variables the owning app uses to reach its dedicated instances
+// Databases use the recipe's env prefix (DB_ by default); caches use the same variables as shared caches
+func (m *DedicatedInstanceManager) GetConnectionEnvVars(deploymentID uuid.UUID, dbEnvPrefix string) (map[string]string, error) {
+	instances, err := m.GetInstances(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	return m.ConnectionEnvVars(instances, dbEnvPrefix)
+}
+
+// ConnectionEnvVars returns the environment variables an app uses to reach the given instances
+func (m *DedicatedInstanceManager) ConnectionEnvVars(instances []models.DedicatedInstance, dbEnvPrefix string) (map[string]string, error) {
+	var err error
+	envVars := make(map[string]string)
+	for i := range instances {
+		instance := &instances[i]
+		if instance.Status != "running" {
+			continue
+		}
+
+		var device models.Device
+		if err := m.db.First(&device, "id = ?", instance.DeviceID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get device for dedicated %s instance: %w", instance.Engine, err)
+		}
+		host := device.GetPrimaryAddress()
+
+		switch instance.Kind {
+		case models.DedicatedInstanceKindDatabase:
+			provisioned := &models.ProvisionedDatabase{
+				SharedDatabaseInstance: &models.SharedDatabaseInstance{Engine: instance.Engine},
+				DatabaseName:           instance.DatabaseName,
+				Username:               instance.Username,
+				CredentialKey:          instance.CredentialKey,
+				Host:                   host,
+				Port:                   instance.Port,
+			}
+			builder := &EnvironmentBuilder{secretManager: NewSecretManager(m.credService)}
+			dbEnv, err := builder.buildDatabaseEnvVars(provisioned, dbEnvPrefix)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range dbEnv {
+				envVars[k] = v
+			}
+
+		case models.DedicatedInstanceKindCache:
+			var password string
+			if instance.MasterCredentialKey != "" {
+				password, err = m.credService.GetCredential(instance.MasterCredentialKey)
+				if err != nil {
+					return nil, fmt.Errorf("failed to retrieve cache password: %w", err)
+				}
+			}
+			// The whole instance belongs to one app, so no key prefix or database number is needed
+			for k, v := range cacheConnectionEnvVars(host, instance.Port, password, instance.Engine, 0, "") {
+				envVars[k] = v
+			}
+		}
+	}
+
+	return envVars, nil
+}
+
+// RemoveForDeployment removes every dedicated instance owned by a deployment
+// Containers are removed but volumes are preserved, matching how the deployment itself is deleted
+func (m *DedicatedInstanceManager) RemoveForDeployment(deploymentID uuid.UUID) error {
+	instances, err := m.GetInstances(deploymentID)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	for i := range instances {
+		instance := &instances[i]
+		if err := m.remove(instance, false); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", instance.ContainerName, err))
+			continue
+		}
+		log.Printf("[DedicatedInstance] Removed dedicated %s instance %s (volumes preserved)", instance.Engine, instance.ContainerName)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to remove %d dedicated instance(s): %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// remove tears down an instance's containers, then deletes its record and credentials
+func (m *DedicatedInstanceManager) remove(instance *models.DedicatedInstance, includeVolumes bool) error {
+	var device models.Device
+	err := m.db.First(&device, "id = ?", instance.DeviceID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+
+	// A deleted device has nothing left to clean up remotely
+	if err == nil {
+		if err := m.removeContainers(&device, instance, includeVolumes); err != nil {
+			return err
+		}
+	}
+
+	if err := m.db.Delete(instance).Error; err != nil {
+		return fmt.Errorf("failed to delete dedicated instance record: %w", err)
+	}
+	m.deleteCredentials(instance)
+	return nil
+}
+
+// removeContainers tears down an instance's compose project on a device
+func (m *DedicatedInstanceManager) removeContainers(device *models.Device, instance *models.DedicatedInstance, includeVolumes bool) error {
+	spec := RemovalSpec{
+		Host:           device.GetSSHHost(),
+		StackName:      instance.ComposeProject,
+		DeployDir:      dedicatedDeployDir(instance),
+		ContainerName:  instance.ContainerName,
+		IncludeVolumes: includeVolumes,
+	}
+	return m.orchestrator.RemoveWithCleanup(context.Background(), spec)
+}
+
+// discard cleans up an instance whose deployment failed; nothing has been stored in it yet
+// If cleanup fails the record is kept as failed so it is retried when the deployment is deleted
+func (m *DedicatedInstanceManager) discard(device *models.Device, instance *models.DedicatedInstance, cause error) {
+	log.Printf("[DedicatedInstance] Deployment of %s failed, performing cleanup", instance.ContainerName)
+	if err := m.remove(instance, true); err != nil {
+		log.Printf("[DedicatedInstance] Warning: Failed to clean up %s on %s: %v", instance.ContainerName, device.Name, err)
+		instance.Status = "failed"
+		instance.ErrorDetails = cause.Error()
+		m.db.Save(instance)
+	}
+}
+
+// newInstance builds an unsaved instance record with a unique name and a free port on the device
+func (m *DedicatedInstanceManager) newInstance(ctx context.Context, req DedicatedInstanceRequest, kind models.DedicatedInstanceKind, defaultVersion string, defaultImage string, defaultPort int) (*models.DedicatedInstance, *models.Device, error) {
+	if err := validateAppSlug(req.AppSlug); err != nil {
+		return nil, nil, err
+	}
+
+	version := req.Version
+	if version == "" {
+		version = defaultVersion
+	}
+	image := req.Image
+	if image == "" {
+		image = defaultImage
+	}
+
+	// Both end up inside the generated compose file
+	if !volumeNameRegex.MatchString(version) {
+		return nil, nil, fmt.Errorf("invalid %s version: %q", req.Engine, version)
+	}
+	if !imageRefRegex.MatchString(image) || strings.ContainsAny(image, ":@") {
+		return nil, nil, fmt.Errorf("invalid %s image: %q (specify the tag via version)", req.Engine, image)
+	}
+
+	var device models.Device
+	if err := m.db.WithContext(ctx).First(&device, "id = ?", req.DeviceID).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get device: %w", err)
+	}
+
+	port, err := m.cachePool.ports.FindFreePort(&device, defaultPort)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find available port: %w", err)
+	}
+
+	id := uuid.New()
+	// Compose project names must be lowercase
+	name := strings.ToLower(fmt.Sprintf("%s-%s-%s", req.AppSlug, req.Engine, id.String()[:8]))
+
+	return &models.DedicatedInstance{
+		ID:             id,
+		DeploymentID:   req.DeploymentID,
+		DeviceID:       device.ID,
+		Kind:           kind,
+		Engine:         req.Engine,
+		Version:        version,
+		Image:          image,
+		ContainerName:  name,
+		ComposeProject: name,
+		Port:           port,
+		Status:         "provisioning",
+	}, &device, nil
+}
+
+// findRunning returns the deployment's running instance of the given kind and engine, if any
+func (m *DedicatedInstanceManager) findRunning(deploymentID uuid.UUID, kind models.DedicatedInstanceKind, engine string) (*models.DedicatedInstance, error) {
+	var instance models.DedicatedInstance
+	err := m.db.Where("deployment_id = ? AND kind = ? AND engine = ? AND status = ?", deploymentID, kind, engine, "running").
+		First(&instance).Error
+	if err == nil {
+		return &instance, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("failed to query dedicated instances: %w", err)
+}
+
+// deploy starts the instance's compose project and waits for its health check to pass
+func (m *DedicatedInstanceManager) deploy(ctx context.Context, device *models.Device, instance *models.DedicatedInstance, composeContent string) error {
+	host := device.GetSSHHost()
+
+	spec := DeploymentSpec{
+		Host:           host,
+		StackName:      instance.ComposeProject,
+		DeployDir:      dedicatedDeployDir(instance),
+		ComposeContent: composeContent,
+		Timeout:        10 * time.Minute,
+	}
+
+	if err := m.orchestrator.Deploy(ctx, spec); err != nil {
+		return fmt.Errorf("orchestrator deployment failed: %w", err)
+	}
+
+	if err := m.orchestrator.WaitForHealthy(ctx, instance.ComposeProject, host, 5*time.Minute); err != nil {
+		return fmt.Errorf("%s failed to become healthy: %w", instance.Engine, err)
+	}
+
+	return nil
+}
+
+// markRunning records a successful deployment
+func (m *DedicatedInstanceManager) markRunning(instance *models.DedicatedInstance) error {
+	now := time.Now()
+	instance.Status = "running"
+	instance.DeployedAt = &now
+	if err := m.db.Save(instance).Error; err != nil {
+		return fmt.Errorf("failed to update dedicated instance status: %w", err)
+	}
+	return nil
+}
+
+// deleteCredentials removes an instance's passwords from the credential store
+func (m *DedicatedInstanceManager) deleteCredentials(instance *models.DedicatedInstance) {
+	for _, key := range []string{instance.MasterCredentialKey, instance.CredentialKey} {
+		if key == "" {
+			continue
+		}
+		if err := m.credService.DeleteCredentials(key); err != nil {
+			log.Printf("[DedicatedInstance] Warning: Failed to delete credential %s: %v", key, err)
+		}
+	}
+}
+
+// databaseCompose renders the shared database template for a dedicated instance
+func (m *DedicatedInstanceManager) databaseCompose(instance *models.DedicatedInstance, masterPassword string) (string, error) {
+	return m.databasePool.generateDatabaseCompose(m.asSharedDatabase(instance), masterPassword, instance.Image)
+}
+
+// cacheCompose renders the shared cache template for a dedicated instance
+func (m *DedicatedInstanceManager) cacheCompose(instance *models.DedicatedInstance, masterPassword string) (string, error) {
+	return m.cachePool.generateCacheCompose(&models.SharedCacheInstance{
+		Engine:         instance.Engine,
+		Version:        instance.Version,
+		Port:           instance.Port,
+		ContainerName:  instance.ContainerName,
+		MasterPassword: masterPassword,
+		MaxMemoryMB:    instance.MaxMemoryMB,
+	}, instance.Image)
+}
+
+// asSharedDatabase adapts a dedicated instance to the shape the database pool templates and commands expect
+func (m *DedicatedInstanceManager) asSharedDatabase(instance *models.DedicatedInstance) *models.SharedDatabaseInstance {
+	return &models.SharedDatabaseInstance{
+		DeviceID:       instance.DeviceID,
+		Engine:         instance.Engine,
+		Version:        instance.Version,
+		ContainerName:  instance.ContainerName,
+		ComposeProject: instance.ComposeProject,
+		Port:           instance.Port,
+		InternalPort:   instance.InternalPort,
+		MasterUsername: instance.MasterUsername,
+		CredentialKey:  instance.MasterCredentialKey,
+	}
+}
+
+// ====== DEPLOYMENT MIGRATION ======
+// These methods move a deployment's dedicated instances between devices
+
+// PlaceOnDevice returns a copy of an instance for another device, on a port that is free there
+// Nothing is stored until the migration records the copy with MoveInstance
+func (m *DedicatedInstanceManager) PlaceOnDevice(instance *models.DedicatedInstance, target *models.Device) (*models.DedicatedInstance, error) {
+	port, err := m.cachePool.ports.FindFreePort(target, instance.Port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find available port on %s: %w", target.Name, err)
+	}
+
+	moved := *instance
+	moved.DeviceID = target.ID
+	moved.Port = port
+	return &moved, nil
+}
+
+// StartCopy deploys a copy placed with PlaceOnDevice; its volumes must already hold the instance's data
+func (m *DedicatedInstanceManager) StartCopy(ctx context.Context, moved *models.DedicatedInstance, target *models.Device) error {
+	var masterPassword string
+	if moved.MasterCredentialKey != "" {
+		var err error
+		masterPassword, err = m.credService.GetCredential(moved.MasterCredentialKey)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve master password: %w", err)
+		}
+	}
+
+	var composeContent string
+	var err error
+	switch moved.Kind {
+	case models.DedicatedInstanceKindDatabase:
+		composeContent, err = m.databaseCompose(moved, masterPassword)
+	case models.DedicatedInstanceKindCache:
+		composeContent, err = m.cacheCompose(moved, masterPassword)
+	default:
+		err = fmt.Errorf("unknown instance kind: %s", moved.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	return m.deploy(ctx, target, moved, composeContent)
+}
+
+// MoveInstance records a copy as the instance within the migration's transaction
+func (m *DedicatedInstanceManager) MoveInstance(tx *gorm.DB, moved *models.DedicatedInstance) error {
+	if err := tx.Model(&models.DedicatedInstance{}).Where("id = ?", moved.ID).Updates(map[string]interface{}{
+		"device_id": moved.DeviceID,
+		"port":      moved.Port,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update dedicated instance %s: %w", moved.ContainerName, err)
+	}
+	return nil
+}
+
+// RemoveFromDevice removes an instance's containers and volumes from a device it does not run on any more,
+// the copy on the target after a failed migration or the original after a successful one; the record is kept
+func (m *DedicatedInstanceManager) RemoveFromDevice(instance *models.DedicatedInstance, device *models.Device) error {
+	return m.removeContainers(device, instance, true)
+}
+
+// dedicatedDeployDir returns the directory holding a dedicated instance's compose file
+func dedicatedDeployDir(instance *models.DedicatedInstance) string {
+	return fmt.Sprintf("~/homelab-deployments/%s", instance.ComposeProject)
+}
+
+// cacheInternalPort returns the port a cache engine listens on inside its container
+func cacheInternalPort(engine string) int {
+	if engine == "memcached" {
+		return 11211
+	}
+	return 6379
+}
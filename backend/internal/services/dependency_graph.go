@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDependencyNodeNotFound     = errors.New("dependency graph node not found")
+	ErrDependencyNodeNotDeletable = errors.New("dependency graph node cannot be deleted")
+)
+
+// ProviderInUseError is returned when deleting a provider that deployments still depend on
+type ProviderInUseError struct {
+	Provider  string
+	Consumers []string
+}
+
+func (e *ProviderInUseError) Error() string {
+	return fmt.Sprintf("%s is still used by %s", e.Provider, strings.Join(e.Consumers, ", "))
+}
+
+// DependencyGraphNode is a deployment or piece of shared infrastructure in the dependency graph
+type DependencyGraphNode struct {
+	ID        uuid.UUID                 `json:"id"`
+	Type      models.DependencyNodeType `json:"type"`
+	Name      string                    `json:"name"`
+	Detail    string                    `json:"detail,omitempty"` // Recipe slug for deployments, engine for instances
+	Source    string                    `json:"source,omitempty"` // Deployments only: recipe, custom or dependency
+	DeviceID  uuid.UUID                 `json:"device_id"`
+	Status    string                    `json:"status"`
+	Consumers int                       `json:"consumers"` // Number of deployments depending on this node
+}
+
+// DependencyGraph is the set of deployments and shared infrastructure, and which depends on which
+type DependencyGraph struct {
+	Nodes []DependencyGraphNode         `json:"nodes"`
+	Edges []models.DeploymentDependency `json:"edges"`
+}
+
+// deploymentNodeName returns the name a deployment is shown under in the graph
+func deploymentNodeName(deployment *models.Deployment) string {
+	if deployment.ComposeProject != "" {
+		return deployment.ComposeProject
+	}
+	if deployment.RecipeName != "" {
+		return deployment.RecipeName
+	}
+	return deployment.ID.String()
+}
+
+// GetDependencyGraph returns every node and edge of the dependency graph, optionally limited to one device
+func (s *DeploymentService) GetDependencyGraph(deviceID *uuid.UUID) (*DependencyGraph, error) {
+	scope := func(query *gorm.DB) *gorm.DB {
+		if deviceID != nil {
+			return query.Where("device_id = ?", *deviceID)
+		}
+		return query
+	}
+
+	var deployments []models.Deployment
+	if err := scope(s.db.Order("created_at")).Find(&deployments).Error; err != nil {
+		return nil, fmt.Errorf("failed to query deployments: %w", err)
+	}
+	var databases []models.SharedDatabaseInstance
+	if err := scope(s.db.Order("created_at")).Find(&databases).Error; err != nil {
+		return nil, fmt.Errorf("failed to query shared databases: %w", err)
+	}
+	var caches []models.SharedCacheInstance
+	if err := scope(s.db.Order("created_at")).Find(&caches).Error; err != nil {
+		return nil, fmt.Errorf("failed to query shared caches: %w", err)
+	}
+	var dedicated []models.DedicatedInstance
+	if err := scope(s.db.Order("created_at")).Find(&dedicated).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dedicated instances: %w", err)
+	}
+
+	graph := &DependencyGraph{Nodes: []DependencyGraphNode{}, Edges: []models.DeploymentDependency{}}
+	for i := range deployments {
+		d := &deployments[i]
+		graph.Nodes = append(graph.Nodes, DependencyGraphNode{ID: d.ID, Type: models.DependencyNodeDeployment, Name: deploymentNodeName(d),
+			Detail: d.RecipeSlug, Source: string(d.Source), DeviceID: d.DeviceID, Status: string(d.Status)})
+	}
+	for _, db := range databases {
+		graph.Nodes = append(graph.Nodes, DependencyGraphNode{ID: db.ID, Type: models.DependencyNodeSharedDatabase, Name: db.ContainerName,
+			Detail: db.Engine, DeviceID: db.DeviceID, Status: db.Status})
+	}
+	for _, cache := range caches {
+		graph.Nodes = append(graph.Nodes, DependencyGraphNode{ID: cache.ID, Type: models.DependencyNodeSharedCache, Name: cache.ContainerName,
+			Detail: cache.Engine, DeviceID: cache.DeviceID, Status: cache.Status})
+	}
+	for _, instance := range dedicated {
+		graph.Nodes = append(graph.Nodes, DependencyGraphNode{ID: instance.ID, Type: models.DependencyNodeDedicatedInstance, Name: instance.ContainerName,
+			Detail: instance.Engine, DeviceID: instance.DeviceID, Status: instance.Status})
+	}
+
+	nodes := make(map[uuid.UUID]*DependencyGraphNode, len(graph.Nodes))
+	for i := range graph.Nodes {
+		nodes[graph.Nodes[i].ID] = &graph.Nodes[i]
+	}
+
+	var edges []models.DeploymentDependency
+	if err := s.db.Order("created_at").Find(&edges).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dependencies: %w", err)
+	}
+	for _, edge := range edges {
+		provider, ok := nodes[edge.ProviderID]
+		if _, consumer := nodes[edge.ConsumerID]; !ok || !consumer {
+			continue
+		}
+		provider.Consumers++
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	return graph, nil
+}
+
+// syncDependencies replaces a deployment's edges with the providers it uses now
+// Returns the edges that were dropped, whose providers may have become unused
+func (s *DeploymentService) syncDependencies(ctx context.Context, deployment *models.Deployment) ([]models.DeploymentDependency, error) {
+	var edges []models.DeploymentDependency
+	if !deployment.IsCustom() && s.dependencyService != nil {
+		recipe, err := s.recipeLoader.GetRecipe(deployment.RecipeSlug)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recipe: %w", err)
+		}
+		resolved, err := s.dependencyService.ResolveProviders(ctx, recipe, deployment.DeviceID, deployment.ID)
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, resolved...)
+	}
+
+	// A routed domain depends on the device's reverse proxy
+	if deployment.Domain != "" {
+		proxy, err := s.proxyDeployment(deployment.DeviceID, deployment.ID)
+		if err != nil {
+			return nil, err
+		}
+		if proxy != nil {
+			edges = append(edges, models.DeploymentDependency{ConsumerID: deployment.ID, ProviderType: models.DependencyNodeDeployment,
+				ProviderID: proxy.ID, Kind: "reverse_proxy"})
+		}
+	}
+
+	// The recipe's own database lives in a shared instance
+	var databases []models.ProvisionedDatabase
+	if err := s.db.WithContext(ctx).Where("deployment_id = ?", deployment.ID).Find(&databases).Error; err != nil {
+		return nil, fmt.Errorf("failed to query provisioned databases: %w", err)
+	}
+	for _, db := range databases {
+		edges = append(edges, models.DeploymentDependency{ConsumerID: deployment.ID, ProviderType: models.DependencyNodeSharedDatabase,
+			ProviderID: db.SharedDatabaseInstanceID, Kind: "database"})
+	}
+
+	var dedicated []models.DedicatedInstance
+	if err := s.db.WithContext(ctx).Where("deployment_id = ?", deployment.ID).Find(&dedicated).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dedicated instances: %w", err)
+	}
+	for _, instance := range dedicated {
+		edges = append(edges, models.DeploymentDependency{ConsumerID: deployment.ID, ProviderType: models.DependencyNodeDedicatedInstance,
+			ProviderID: instance.ID, Kind: string(instance.Kind)})
+	}
+
+	// A provider satisfying several dependencies is still a single edge
+	current := make(map[string]bool, len(edges))
+	unique := edges[:0]
+	for _, edge := range edges {
+		key := string(edge.ProviderType) + "/" + edge.ProviderID.String()
+		if current[key] {
+			continue
+		}
+		current[key] = true
+		unique = append(unique, edge)
+	}
+	edges = unique
+
+	var previous []models.DeploymentDependency
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("consumer_id = ?", deployment.ID).Find(&previous).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("consumer_id = ?", deployment.ID).Delete(&models.DeploymentDependency{}).Error; err != nil {
+			return err
+		}
+		if len(edges) == 0 {
+			return nil
+		}
+		return tx.Create(&edges).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record dependencies: %w", err)
+	}
+
+	var dropped []models.DeploymentDependency
+	for _, edge := range previous {
+		if !current[string(edge.ProviderType)+"/"+edge.ProviderID.String()] {
+			dropped = append(dropped, edge)
+		}
+	}
+	for _, edge := range append(previous, edges...) {
+		if edge.ProviderType == models.DependencyNodeSharedDatabase {
+			s.recountDatabases(edge.ProviderID)
+		}
+	}
+	return dropped, nil
+}
+
+// recordDependencies updates a deployment's edges and removes providers it no longer uses, logging failures
+func (s *DeploymentService) recordDependencies(ctx context.Context, deployment *models.Deployment) {
+	dropped, err := s.syncDependencies(ctx, deployment)
+	if err != nil {
+		log.Printf("[Deployment] Warning: Failed to record dependencies of %s: %v", deployment.ID, err)
+		return
+	}
+	s.collectGarbage(ctx, dropped)
+}
+
+// recountDatabases sets a shared database instance's DatabaseCount to the number of deployments using it
+func (s *DeploymentService) recountDatabases(instanceID uuid.UUID) {
+	var count int64
+	err := s.db.Model(&models.DeploymentDependency{}).
+		Where("provider_type = ? AND provider_id = ?", models.DependencyNodeSharedDatabase, instanceID).
+		Count(&count).Error
+	if err == nil {
+		err = s.db.Model(&models.SharedDatabaseInstance{}).Where("id = ?", instanceID).Update("database_count", count).Error
+	}
+	if err != nil {
+		log.Printf("[Deployment] Warning: Failed to update database count of %s: %v", instanceID, err)
+	}
+}
+
+// releaseDependencies deletes a deleted deployment's edges and removes providers left without consumers
+func (s *DeploymentService) releaseDependencies(ctx context.Context, deployment *models.Deployment) {
+	var edges []models.DeploymentDependency
+	if err := s.db.Where("consumer_id = ?", deployment.ID).Find(&edges).Error; err != nil {
+		log.Printf("[Deployment] Warning: Failed to query dependencies of %s: %v", deployment.ID, err)
+		return
+	}
+	if err := s.db.Where("consumer_id = ?", deployment.ID).Delete(&models.DeploymentDependency{}).Error; err != nil {
+		log.Printf("[Deployment] Warning: Failed to delete dependencies of %s: %v", deployment.ID, err)
+		return
+	}
+	s.collectGarbage(ctx, edges)
+}
+
+// collectGarbage removes the shared instances and dependency stacks among the providers that no deployment uses any more
+// Deployments the user created are never removed; dedicated instances go with the deployment owning them
+func (s *DeploymentService) collectGarbage(ctx context.Context, edges []models.DeploymentDependency) {
+	for _, edge := range edges {
+		if edge.ProviderType == models.DependencyNodeSharedDatabase {
+			s.recountDatabases(edge.ProviderID)
+		}
+
+		consumers, err := s.consumersOf(edge.ProviderType, edge.ProviderID)
+		if err != nil {
+			log.Printf("[Deployment] Warning: Failed to query consumers of %s: %v", edge.ProviderID, err)
+			continue
+		}
+		if len(consumers) > 0 {
+			continue
+		}
+
+		switch edge.ProviderType {
+		case models.DependencyNodeSharedDatabase:
+			var instance models.SharedDatabaseInstance
+			if err := s.db.First(&instance, "id = ?", edge.ProviderID).Error; err != nil {
+				continue
+			}
+			// Databases of deployments recorded before the graph existed still count as use
+			var held int64
+			s.db.Model(&models.ProvisionedDatabase{}).
+				Where("shared_database_instance_id = ? AND deployment_id IN (?)", instance.ID, s.db.Model(&models.Deployment{}).Select("id")).
+				Count(&held)
+			if held > 0 {
+				continue
+			}
+			if err := s.dbPoolManager.RemoveSharedInstance(&instance); err != nil {
+				log.Printf("[Deployment] Warning: Failed to remove unused shared %s instance: %v", instance.Engine, err)
+				continue
+			}
+			log.Printf("[Deployment] Removed unused shared %s instance %s", instance.Engine, instance.ContainerName)
+
+		case models.DependencyNodeSharedCache:
+			if err := s.cachePoolManager.DeleteInstance(ctx, edge.ProviderID); err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					log.Printf("[Deployment] Warning: Failed to remove unused shared cache %s: %v", edge.ProviderID, err)
+				}
+				continue
+			}
+			log.Printf("[Deployment] Removed unused shared cache %s", edge.ProviderID)
+
+		case models.DependencyNodeDeployment:
+			var stack models.Deployment
+			if err := s.db.First(&stack, "id = ?", edge.ProviderID).Error; err != nil || stack.Source != models.DeploymentSourceDependency {
+				continue
+			}
+			if err := s.deleteDeployment(&stack, false); err != nil {
+				log.Printf("[Deployment] Warning: Failed to remove unused dependency stack %s: %v", deploymentNodeName(&stack), err)
+				continue
+			}
+			log.Printf("[Deployment] Removed unused dependency stack %s", deploymentNodeName(&stack))
+		}
+	}
+}
+
+// consumersOf returns the deployments that depend on a provider
+func (s *DeploymentService) consumersOf(providerType models.DependencyNodeType, providerID uuid.UUID) ([]models.Deployment, error) {
+	var consumers []models.Deployment
+	err := s.db.Where("id IN (?)", s.db.Model(&models.DeploymentDependency{}).
+		Select("consumer_id").
+		Where("provider_type = ? AND provider_id = ?", providerType, providerID)).
+		Order("created_at").
+		Find(&consumers).Error
+	return consumers, err
+}
+
+// removeConsumers deletes the deployments depending on a provider before the provider itself is deleted
+// Without cascade, a provider that is still in use is not deleted and a ProviderInUseError is returned
+func (s *DeploymentService) removeConsumers(providerType models.DependencyNodeType, providerID uuid.UUID, providerName string, cascade bool) error {
+	consumers, err := s.consumersOf(providerType, providerID)
+	if err != nil {
+		return fmt.Errorf("failed to query dependent deployments: %w", err)
+	}
+	if len(consumers) == 0 {
+		return nil
+	}
+
+	if !cascade {
+		names := make([]string, len(consumers))
+		for i := range consumers {
+			names[i] = deploymentNodeName(&consumers[i])
+		}
+		return &ProviderInUseError{Provider: providerName, Consumers: names}
+	}
+
+	for i := range consumers {
+		consumer := &consumers[i]
+		if err := s.deleteDeployment(consumer, true); err != nil {
+			return fmt.Errorf("failed to delete dependent deployment %s: %w", deploymentNodeName(consumer), err)
+		}
+	}
+	return nil
+}
+
+// DeleteDependencyNode deletes a deployment or shared instance from the graph
+// With cascade, the deployments depending on it are deleted first; otherwise a node still in use is kept
+func (s *DeploymentService) DeleteDependencyNode(ctx context.Context, nodeType models.DependencyNodeType, id uuid.UUID, cascade bool) error {
+	switch nodeType {
+	case models.DependencyNodeDeployment:
+		var deployment models.Deployment
+		if err := s.db.First(&deployment, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDependencyNodeNotFound
+			}
+			return err
+		}
+		return s.deleteDeployment(&deployment, cascade)
+
+	case models.DependencyNodeSharedDatabase:
+		var instance models.SharedDatabaseInstance
+		if err := s.db.First(&instance, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDependencyNodeNotFound
+			}
+			return err
+		}
+		if err := s.removeConsumers(nodeType, id, instance.ContainerName, cascade); err != nil {
+			return err
+		}
+		// Deleting the last consumer may already have removed the instance
+		if err := s.db.First(&instance, "id = ?", id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return s.dbPoolManager.RemoveSharedInstance(&instance)
+
+	case models.DependencyNodeSharedCache:
+		instance, err := s.cachePoolManager.GetInstance(ctx, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrDependencyNodeNotFound
+			}
+			return err
+		}
+		if err := s.removeConsumers(nodeType, id, instance.ContainerName, cascade); err != nil {
+			return err
+		}
+		err = s.cachePoolManager.DeleteInstance(ctx, id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+
+	case models.DependencyNodeDedicatedInstance:
+		return fmt.Errorf("%w: dedicated instances are removed with the deployment that owns them", ErrDependencyNodeNotDeletable)
+
+	default:
+		return fmt.Errorf("%w: unknown node type %q", ErrDependencyNodeNotDeletable, nodeType)
+	}
+}
+
+// BackfillDependencyGraph records the dependencies of deployments created before the dependency graph existed
+// Deployments that already have edges, or that failed, are skipped; DatabaseCount is recomputed for every shared instance
+func (s *DeploymentService) BackfillDependencyGraph(ctx context.Context) error {
+	var deployments []models.Deployment
+	err := s.db.Where("status <> ?", models.DeploymentStatusFailed).
+		Where("id NOT IN (?)", s.db.Model(&models.DeploymentDependency{}).Select("consumer_id")).
+		Find(&deployments).Error
+	if err != nil {
+		return fmt.Errorf("failed to query deployments: %w", err)
+	}
+
+	for i := range deployments {
+		if _, err := s.syncDependencies(ctx, &deployments[i]); err != nil {
+			log.Printf("[Deployment] Warning: Could not record dependencies of %s: %v", deploymentNodeName(&deployments[i]), err)
+		}
+	}
+
+	var instances []models.SharedDatabaseInstance
+	if err := s.db.Find(&instances).Error; err != nil {
+		return fmt.Errorf("failed to query shared databases: %w", err)
+	}
+	for _, instance := range instances {
+		s.recountDatabases(instance.ID)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type dependencyGraphFixture struct {
+	service      *DeploymentService
+	orchestrator *removalRecordingOrchestrator
+	device       *models.Device
+	postgres     *models.SharedDatabaseInstance
+	redis        *models.SharedCacheInstance
+	traefik      *models.Deployment // Dependency stack
+	collabora    *models.Deployment // Deployed by the user
+	nextcloud    *models.Deployment
+}
+
+// setupDependencyGraphTest creates a Nextcloud deployment using a shared Postgres and Redis,
+// a Traefik dependency stack and a Collabora deployment; none of them has a compose project so nothing runs over SSH
+func setupDependencyGraphTest(t *testing.T) *dependencyGraphFixture {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+
+	recipes := map[string]*models.Recipe{
+		"nextcloud": {Slug: "nextcloud", Name: "Nextcloud", Dependencies: models.RecipeDependencies{
+			Required: []models.RecipeDependency{
+				{Type: "reverse_proxy", Prefer: "traefik"},
+				{Type: "database", Engine: "postgres", Shared: true},
+				{Type: "cache", Engine: "redis", Shared: true},
+			},
+			Recommended: []models.RecipeDependency{
+				{Type: "application", Name: "collabora"},
+				{Type: "infrastructure", Name: "docker"},
+			},
+		}},
+		"traefik":   {Slug: "traefik", Name: "Traefik"},
+		"collabora": {Slug: "collabora", Name: "Collabora"},
+	}
+	orchestrator := &removalRecordingOrchestrator{}
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(recipes), NewDeviceService(db, credService, nil), credService, nil, nil, orchestrator)
+
+	f := &dependencyGraphFixture{service: service, orchestrator: orchestrator}
+	f.device = &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(f.device).Error)
+
+	f.postgres = &models.SharedDatabaseInstance{DeviceID: f.device.ID, Engine: "postgres", Version: "16", Status: "running",
+		ContainerName: "homelab-postgres-shared", ComposeProject: "homelab-postgres-shared", Port: 5432, InternalPort: 5432,
+		MasterUsername: "postgres", CredentialKey: "shared-postgres-master", DatabaseCount: 7}
+	require.NoError(t, db.Create(f.postgres).Error)
+	f.redis = &models.SharedCacheInstance{DeviceID: f.device.ID, Engine: "redis", Version: "7", Name: "shared-redis",
+		Port: 6379, ContainerName: "homelab-redis-shared", MasterPassword: "x", Status: "running"}
+	require.NoError(t, db.Create(f.redis).Error)
+
+	f.traefik = &models.Deployment{Source: models.DeploymentSourceDependency, RecipeSlug: "traefik", RecipeName: "Traefik",
+		DeviceID: f.device.ID, Status: models.DeploymentStatusRunning}
+	f.collabora = &models.Deployment{RecipeSlug: "collabora", RecipeName: "Collabora", DeviceID: f.device.ID, Status: models.DeploymentStatusRunning}
+	f.nextcloud = &models.Deployment{RecipeSlug: "nextcloud", RecipeName: "Nextcloud", DeviceID: f.device.ID, Status: models.DeploymentStatusRunning}
+	for _, deployment := range []*models.Deployment{f.traefik, f.collabora, f.nextcloud} {
+		require.NoError(t, db.Create(deployment).Error)
+	}
+	return f
+}
+
+func TestDependencyGraph_SyncDependencies(t *testing.T) {
+	f := setupDependencyGraphTest(t)
+	ctx := context.Background()
+
+	dropped, err := f.service.syncDependencies(ctx, f.nextcloud)
+	require.NoError(t, err)
+	assert.Empty(t, dropped)
+
+	graph, err := f.service.GetDependencyGraph(&f.device.ID)
+	require.NoError(t, err)
+	require.Len(t, graph.Nodes, 5)
+	kinds := map[string]models.DependencyNodeType{}
+	for _, edge := range graph.Edges {
+		assert.Equal(t, f.nextcloud.ID, edge.ConsumerID)
+		kinds[edge.Kind] = edge.ProviderType
+	}
+	assert.Equal(t, map[string]models.DependencyNodeType{
+		"reverse_proxy": models.DependencyNodeDeployment,
+		"database":      models.DependencyNodeSharedDatabase,
+		"cache":         models.DependencyNodeSharedCache,
+		"application":   models.DependencyNodeDeployment,
+	}, kinds)
+	for _, node := range graph.Nodes {
+		if node.ID == f.nextcloud.ID {
+			assert.Zero(t, node.Consumers)
+		} else {
+			assert.Equal(t, 1, node.Consumers, node.Name)
+		}
+	}
+
+	var postgres models.SharedDatabaseInstance
+	require.NoError(t, f.service.db.First(&postgres, "id = ?", f.postgres.ID).Error)
+	assert.Equal(t, 1, postgres.DatabaseCount, "the count follows the deployments using the instance")
+
+	// Syncing again is idempotent; providers that go away are reported as dropped
+	require.NoError(t, f.service.db.Model(f.collabora).Update("status", models.DeploymentStatusFailed).Error)
+	dropped, err = f.service.syncDependencies(ctx, f.nextcloud)
+	require.NoError(t, err)
+	require.Len(t, dropped, 1)
+	assert.Equal(t, f.collabora.ID, dropped[0].ProviderID)
+
+	graph, err = f.service.GetDependencyGraph(nil)
+	require.NoError(t, err)
+	assert.Len(t, graph.Edges, 3)
+}
+
+func TestDependencyGraph_DeleteBlocksProvidersInUse(t *testing.T) {
+	f := setupDependencyGraphTest(t)
+	ctx := context.Background()
+	_, err := f.service.syncDependencies(ctx, f.nextcloud)
+	require.NoError(t, err)
+
+	var inUse *ProviderInUseError
+	err = f.service.DeleteDeployment(f.collabora.ID.String())
+	require.True(t, errors.As(err, &inUse))
+	assert.Equal(t, "Collabora is still used by Nextcloud", err.Error())
+
+	err = f.service.DeleteDependencyNode(ctx, models.DependencyNodeSharedDatabase, f.postgres.ID, false)
+	assert.True(t, errors.As(err, &inUse))
+	assert.Empty(t, f.orchestrator.removed)
+
+	assert.ErrorIs(t, f.service.DeleteDependencyNode(ctx, models.DependencyNodeSharedCache, f.nextcloud.ID, false), ErrDependencyNodeNotFound)
+	assert.ErrorIs(t, f.service.DeleteDependencyNode(ctx, "volume", f.nextcloud.ID, false), ErrDependencyNodeNotDeletable)
+}
+
+func TestDependencyGraph_DeleteCollectsUnusedProviders(t *testing.T) {
+	f := setupDependencyGraphTest(t)
+	_, err := f.service.syncDependencies(context.Background(), f.nextcloud)
+	require.NoError(t, err)
+
+	require.NoError(t, f.service.DeleteDeployment(f.nextcloud.ID.String()))
+
+	var edges int64
+	f.service.db.Model(&models.DeploymentDependency{}).Count(&edges)
+	assert.Zero(t, edges)
+
+	// The shared instances and the dependency stack had no other consumers
+	var count int64
+	f.service.db.Model(&models.SharedDatabaseInstance{}).Count(&count)
+	assert.Zero(t, count)
+	f.service.db.Model(&models.SharedCacheInstance{}).Count(&count)
+	assert.Zero(t, count)
+	f.service.db.Model(&models.Deployment{}).Where("id = ?", f.traefik.ID).Count(&count)
+	assert.Zero(t, count)
+
+	// The user's own deployment is kept
+	f.service.db.Model(&models.Deployment{}).Where("id = ?", f.collabora.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	require.Len(t, f.orchestrator.removed, 2)
+	for _, spec := range f.orchestrator.removed {
+		if spec.StackName == "homelab-postgres-shared" {
+			assert.False(t, spec.IncludeVolumes, "the shared database keeps its data")
+		}
+	}
+}
+
+func TestDependencyGraph_SharedProviderKeptWhileInUse(t *testing.T) {
+	f := setupDependencyGraphTest(t)
+	ctx := context.Background()
+
+	wiki := &models.Deployment{RecipeSlug: "wiki-js", DeviceID: f.device.ID, Status: models.DeploymentStatusRunning}
+	require.NoError(t, f.service.db.Create(wiki).Error)
+	require.NoError(t, f.service.db.Create(&models.ProvisionedDatabase{SharedDatabaseInstanceID: f.postgres.ID, DeploymentID: wiki.ID,
+		DatabaseName: "wiki", Username: "wiki", CredentialKey: "db-wiki", Status: "ready"}).Error)
+	f.service.recipeLoader.(*MockRecipeLoader).recipes["wiki-js"] = &models.Recipe{Slug: "wiki-js", Name: "Wiki.js"}
+
+	_, err := f.service.syncDependencies(ctx, f.nextcloud)
+	require.NoError(t, err)
+	_, err = f.service.syncDependencies(ctx, wiki)
+	require.NoError(t, err)
+
+	var postgres models.SharedDatabaseInstance
+	require.NoError(t, f.service.db.First(&postgres, "id = ?", f.postgres.ID).Error)
+	assert.Equal(t, 2, postgres.DatabaseCount)
+
+	require.NoError(t, f.service.DeleteDeployment(f.nextcloud.ID.String()))
+	require.NoError(t, f.service.db.First(&postgres, "id = ?", f.postgres.ID).Error)
+	assert.Equal(t, 1, postgres.DatabaseCount, "deleting a consumer decrements the count")
+}
+
+func TestDependencyGraph_CascadeDeletesConsumers(t *testing.T) {
+	f := setupDependencyGraphTest(t)
+	ctx := context.Background()
+	_, err := f.service.syncDependencies(ctx, f.nextcloud)
+	require.NoError(t, err)
+
+	require.NoError(t, f.service.DeleteDependencyNode(ctx, models.DependencyNodeSharedDatabase, f.postgres.ID, true))
+
+	var count int64
+	f.service.db.Model(&models.Deployment{}).Where("id IN ?", []interface{}{f.nextcloud.ID, f.traefik.ID}).Count(&count)
+	assert.Zero(t, count, "the consumer is deleted, and with it the stack only it used")
+	f.service.db.Model(&models.SharedDatabaseInstance{}).Count(&count)
+	assert.Zero(t, count)
+	f.service.db.Model(&models.Deployment{}).Where("id = ?", f.collabora.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
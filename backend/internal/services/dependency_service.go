@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -22,8 +23,10 @@ type DependencyService struct {
 	softwareService   *SoftwareService
 	databasePool      *DatabasePoolManager
 	cachePool         *CachePoolManager
+	dedicated         *DedicatedInstanceManager
 	infraConfig       *InfrastructureConfig
-	orchestrator      ContainerOrchestrator
+	orchestrator      ContainerOrchestrator // Compose; runs the reverse proxy next to the apps it routes
+	stacks            ContainerOrchestrator // Runs application dependency stacks, in Swarm when it is enabled
 }
 
 // NewDependencyService creates a new dependency service instance
@@ -35,8 +38,10 @@ func NewDependencyService(
 	softwareService *SoftwareService,
 	databasePool *DatabasePoolManager,
 	cachePool *CachePoolManager,
+	dedicated *DedicatedInstanceManager,
 	infraConfig *InfrastructureConfig,
 	orchestrator ContainerOrchestrator,
+	stacks ContainerOrchestrator,
 ) *DependencyService {
 	return &DependencyService{
 		db:              db,
@@ -46,8 +51,10 @@ func NewDependencyService(
 		softwareService: softwareService,
 		databasePool:    databasePool,
 		cachePool:       cachePool,
+		dedicated:       dedicated,
 		infraConfig:     infraConfig,
 		orchestrator:    orchestrator,
+		stacks:          stacks,
 	}
 }
 
@@ -203,13 +210,7 @@ func (s *DependencyService) checkReverseProxy(
 	}
 
 	// Check if any deployment is a reverse proxy
-	reverseProxies := []string{"traefik", "caddy", "nginx-proxy-manager"}
-	if dep.Prefer != "" {
-		reverseProxies = append([]string{dep.Prefer}, reverseProxies...)
-	}
-	if len(dep.Alternatives) > 0 {
-		reverseProxies = append(reverseProxies, dep.Alternatives...)
-	}
+	reverseProxies := reverseProxyCandidates(dep)
 
 	for _, deployment := range deployments {
 		// Load recipe to get slug
@@ -225,12 +226,31 @@ func (s *DependencyService) checkReverseProxy(
 		}
 	}
 
-	preferredProxy := "traefik"
+	return false, fmt.Sprintf("No reverse proxy found (will deploy %s)", s.reverseProxyChoice(dep)), nil
+}
+
+// reverseProxyChoice returns the proxy recipe to deploy for a reverse proxy dependency
+// The default proxy chosen in the infrastructure config wins over the recipe's preference, since it decides how every app on the device is routed
+func (s *DependencyService) reverseProxyChoice(dep models.RecipeDependency) string {
+	if s.infraConfig != nil && len(s.infraConfig.ReverseProxies) > 0 {
+		return s.infraConfig.GetDefaultReverseProxy()
+	}
 	if dep.Prefer != "" {
-		preferredProxy = dep.Prefer
+		return dep.Prefer
 	}
+	return "traefik"
+}
 
-	return false, fmt.Sprintf("No reverse proxy found (will deploy %s)", preferredProxy), nil
+// reverseProxyCandidates lists the recipes that satisfy a reverse proxy dependency, preferred first
+func reverseProxyCandidates(dep models.RecipeDependency) []string {
+	reverseProxies := []string{"traefik", "caddy", "nginx", "nginx-proxy-manager"}
+	if dep.Prefer != "" {
+		reverseProxies = append([]string{dep.Prefer}, reverseProxies...)
+	}
+	if len(dep.Alternatives) > 0 {
+		reverseProxies = append(reverseProxies, dep.Alternatives...)
+	}
+	return reverseProxies
 }
 
 // checkDatabase checks if database is available (shared instance or dedicated)
@@ -274,7 +294,11 @@ func (s *DependencyService) checkDatabase(
 		}
 	}
 
-	return false, "Database not available", nil
+	engine := dep.Engine
+	if engine == "" {
+		engine = "postgres"
+	}
+	return false, fmt.Sprintf("No dedicated %s instance (will create)", engine), nil
 }
 
 // checkCache checks if cache is available (shared instance or dedicated)
@@ -318,7 +342,10 @@ func (s *DependencyService) checkCache(
 		}
 	}
 
-	return false, "Cache not available", nil
+	if dep.Engine != "" {
+		return false, fmt.Sprintf("No dedicated %s instance (will create)", dep.Engine), nil
+	}
+	return false, "No dedicated cache instance (will create)", nil
 }
 
 // checkApplication checks if a specific application is deployed
@@ -415,10 +442,7 @@ func (s *DependencyService) createReverseProxyPlan(
 	dep models.RecipeDependency,
 	deviceID uuid.UUID,
 ) (ProvisionPlan, error) {
-	proxySlug := "traefik" // Default
-	if dep.Prefer != "" {
-		proxySlug = dep.Prefer
-	}
+	proxySlug := s.reverseProxyChoice(dep)
 
 	// Get recipe to estimate resources
 	recipe, err := s.recipeLoader.GetRecipe(proxySlug)
@@ -431,7 +455,7 @@ func (s *DependencyService) createReverseProxyPlan(
 		Name:            fmt.Sprintf("%s (Reverse Proxy)", recipe.Name),
 		Action:          "deploy",
 		UseSharedInstance: false,
-		EstimatedTime:   60, // ~1 minute for traefik deployment
+		EstimatedTime:   60, // ~1 minute for proxy deployment
 		RAMRequired:     recipe.GetEstimatedRAMMB(),
 		StorageRequired: recipe.GetEstimatedStorageGB(),
 		RecipeSlug:      proxySlug,
@@ -463,6 +487,7 @@ func (s *DependencyService) createDatabasePlan(
 			"db_name": dbName,
 		},
 	}
+	setDedicatedInstanceConfig(plan.Config, dep)
 
 	if dep.Shared {
 		// Creating database in shared instance
@@ -501,6 +526,7 @@ func (s *DependencyService) createCachePlan(
 			"key_prefix": fmt.Sprintf("%s:", appRecipe.Slug),
 		},
 	}
+	setDedicatedInstanceConfig(plan.Config, dep)
 
 	if dep.Shared {
 		plan.Action = "configure_in_shared"
@@ -517,6 +543,20 @@ func (s *DependencyService) createCachePlan(
 	return plan, nil
 }
 
+// setDedicatedInstanceConfig records the version and image a dedicated instance should run
+// Shared instances always use the engine defaults, so these are ignored for them
+func setDedicatedInstanceConfig(config map[string]string, dep models.RecipeDependency) {
+	if dep.Shared {
+		return
+	}
+	if dep.Version != "" {
+		config["version"] = dep.Version
+	}
+	if dep.Image != "" {
+		config["image"] = dep.Image
+	}
+}
+
 // createApplicationPlan creates a plan for deploying another application
 func (s *DependencyService) createApplicationPlan(
 	dep models.RecipeDependency,
@@ -568,10 +608,12 @@ func (s *DependencyService) generateResourceBreakdown(plans []ProvisionPlan) str
 
 // ProvisionDependencies provisions all dependencies in the plan
 // This is called during deployment if user confirms dependency provisioning
+// Dedicated databases and caches are owned by deploymentID and removed with it
 func (s *DependencyService) ProvisionDependencies(
 	ctx context.Context,
 	result *DependencyCheckResult,
 	deviceID uuid.UUID,
+	deploymentID uuid.UUID,
 	appRecipe *models.Recipe,
 	progressCallback func(step int, total int, message string),
 ) error {
@@ -592,13 +634,13 @@ func (s *DependencyService) ProvisionDependencies(
 			}
 
 		case "database":
-			err := s.provisionDatabase(ctx, plan, deviceID, appRecipe)
+			err := s.provisionDatabase(ctx, plan, deviceID, deploymentID, appRecipe)
 			if err != nil {
 				return fmt.Errorf("failed to provision database: %w", err)
 			}
 
 		case "cache":
-			err := s.provisionCache(ctx, plan, deviceID, appRecipe)
+			err := s.provisionCache(ctx, plan, deviceID, deploymentID, appRecipe)
 			if err != nil {
 				return fmt.Errorf("failed to provision cache: %w", err)
 			}
@@ -614,7 +656,8 @@ func (s *DependencyService) ProvisionDependencies(
 		}
 
 		// Wait for provisioned resource to be healthy
-		if plan.Action == "deploy" {
+		// Dedicated databases and caches are already health-checked while they are provisioned
+		if plan.Action == "deploy" && plan.Type != "database" && plan.Type != "cache" {
 			if err := s.waitForHealthy(ctx, plan, deviceID); err != nil {
 				// Check if error is due to context cancellation
 				if ctx.Err() != nil {
@@ -664,6 +707,7 @@ func (s *DependencyService) provisionReverseProxy(
 	if err := s.orchestrator.Deploy(ctx, spec); err != nil {
 		return fmt.Errorf("orchestrator deployment failed: %w", err)
 	}
+	s.recordDependencyStack(recipe, device, projectName, s.orchestrator.GetMode())
 
 	log.Printf("[DependencyService] Successfully deployed %s as dependency on device %s", recipe.Name, device.Name)
 	return nil
@@ -674,6 +718,7 @@ func (s *DependencyService) provisionDatabase(
 	ctx context.Context,
 	plan ProvisionPlan,
 	deviceID uuid.UUID,
+	deploymentID uuid.UUID,
 	appRecipe *models.Recipe,
 ) error {
 	engine := plan.Config["engine"]
@@ -690,9 +735,17 @@ func (s *DependencyService) provisionDatabase(
 		)
 	}
 
-	// Deploy dedicated database instance
-	// TODO: Implement dedicated database deployment
-	return fmt.Errorf("dedicated database provisioning not yet implemented")
+	// Deploy dedicated database instance owned by this deployment
+	_, err := s.dedicated.ProvisionDatabase(ctx, DedicatedInstanceRequest{
+		DeploymentID: deploymentID,
+		DeviceID:     deviceID,
+		Engine:       engine,
+		Version:      plan.Config["version"],
+		Image:        plan.Config["image"],
+		AppSlug:      appRecipe.Slug,
+		DatabaseName: dbName,
+	})
+	return err
 }
 
 // provisionCache provisions cache (shared or dedicated)
@@ -700,6 +753,7 @@ func (s *DependencyService) provisionCache(
 	ctx context.Context,
 	plan ProvisionPlan,
 	deviceID uuid.UUID,
+	deploymentID uuid.UUID,
 	appRecipe *models.Recipe,
 ) error {
 	engine := plan.Config["engine"]
@@ -714,9 +768,16 @@ func (s *DependencyService) provisionCache(
 		)
 	}
 
-	// Deploy dedicated cache instance
-	// TODO: Implement dedicated cache deployment
-	return fmt.Errorf("dedicated cache provisioning not yet implemented")
+	// Deploy dedicated cache instance owned by this deployment
+	_, err := s.dedicated.ProvisionCache(ctx, DedicatedInstanceRequest{
+		DeploymentID: deploymentID,
+		DeviceID:     deviceID,
+		Engine:       engine,
+		Version:      plan.Config["version"],
+		Image:        plan.Config["image"],
+		AppSlug:      appRecipe.Slug,
+	})
+	return err
 }
 
 // provisionApplication deploys another application as a dependency using the orchestrator
@@ -757,15 +818,155 @@ func (s *DependencyService) provisionApplication(
 		Timeout:        15 * time.Minute,
 	}
 
-	// Deploy using orchestrator
-	if err := s.orchestrator.Deploy(ctx, spec); err != nil {
+	// Deploy using the stack orchestrator
+	if err := s.stacks.Deploy(ctx, spec); err != nil {
 		return fmt.Errorf("orchestrator deployment failed: %w", err)
 	}
+	s.recordDependencyStack(recipe, device, projectName, s.stacks.GetMode())
 
-	log.Printf("[DependencyService] Successfully deployed %s as application dependency on device %s", recipe.Name, device.Name)
+	log.Printf("[DependencyService] Successfully deployed %s as application dependency on device %s (%s)", recipe.Name, device.Name, s.stacks.GetMode())
 	return nil
 }
 
+// recordDependencyStack tracks a stack deployed as a dependency as a deployment of its own
+// This lets later dependency checks find it, and lets it be removed once no deployment uses it
+func (s *DependencyService) recordDependencyStack(recipe *models.Recipe, device *models.Device, projectName string, orchestrator string) {
+	now := time.Now()
+	stack := &models.Deployment{
+		Source:           models.DeploymentSourceDependency,
+		Orchestrator:     orchestrator,
+		RecipeSlug:       recipe.Slug,
+		RecipeName:       recipe.Name,
+		DeviceID:         device.ID,
+		Status:           models.DeploymentStatusRunning,
+		ComposeProject:   projectName,
+		GeneratedCompose: recipe.ComposeContent,
+		DeployedAt:       &now,
+	}
+	if err := s.db.Create(stack).Error; err != nil {
+		log.Printf("[DependencyService] Warning: Failed to record dependency stack %s: %v", projectName, err)
+		return
+	}
+
+	if ports, err := deploymentPorts(stack); err == nil && len(ports) > 0 {
+		if err := s.cachePool.ports.RecordDeploymentPorts(device, stack.ID, ports); err != nil {
+			log.Printf("[DependencyService] Warning: Failed to record ports of %s: %v", projectName, err)
+		}
+	}
+}
+
+// ResolveProviders finds what currently satisfies each of the recipe's dependencies on the device
+// Returns an edge from consumerID to each provider found; unsatisfied dependencies are skipped
+// Dedicated instances are owned by the consumer and are not resolved here
+func (s *DependencyService) ResolveProviders(
+	ctx context.Context,
+	recipe *models.Recipe,
+	deviceID uuid.UUID,
+	consumerID uuid.UUID,
+) ([]models.DeploymentDependency, error) {
+	dependencies := append(append([]models.RecipeDependency{}, recipe.Dependencies.Required...), recipe.Dependencies.Recommended...)
+
+	var edges []models.DeploymentDependency
+	for _, dep := range dependencies {
+		providerType, providerID, err := s.resolveProvider(ctx, dep, deviceID, consumerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s dependency: %w", dep.Type, err)
+		}
+		if providerID == uuid.Nil {
+			continue
+		}
+		edges = append(edges, models.DeploymentDependency{
+			ConsumerID:   consumerID,
+			ProviderType: providerType,
+			ProviderID:   providerID,
+			Kind:         dep.Type,
+		})
+	}
+	return edges, nil
+}
+
+// resolveProvider returns the resource satisfying a single dependency, or uuid.Nil if there is none
+func (s *DependencyService) resolveProvider(
+	ctx context.Context,
+	dep models.RecipeDependency,
+	deviceID uuid.UUID,
+	consumerID uuid.UUID,
+) (models.DependencyNodeType, uuid.UUID, error) {
+	switch dep.Type {
+	case "reverse_proxy":
+		id, err := s.findProviderDeployment(ctx, deviceID, consumerID, reverseProxyCandidates(dep))
+		return models.DependencyNodeDeployment, id, err
+
+	case "application":
+		if dep.Name == "" {
+			return "", uuid.Nil, nil
+		}
+		id, err := s.findProviderDeployment(ctx, deviceID, consumerID, []string{dep.Name})
+		return models.DependencyNodeDeployment, id, err
+
+	case "database":
+		if !dep.Shared {
+			if dep.Name == "" {
+				return "", uuid.Nil, nil
+			}
+			id, err := s.findProviderDeployment(ctx, deviceID, consumerID, []string{dep.Name})
+			return models.DependencyNodeDeployment, id, err
+		}
+		engine := dep.Engine
+		if engine == "" {
+			engine = "postgres"
+		}
+		var instance models.SharedDatabaseInstance
+		err := s.db.WithContext(ctx).Where("device_id = ? AND engine = ? AND status = ?", deviceID, engine, "running").First(&instance).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", uuid.Nil, nil
+		}
+		return models.DependencyNodeSharedDatabase, instance.ID, err
+
+	case "cache":
+		if !dep.Shared {
+			if dep.Name == "" {
+				return "", uuid.Nil, nil
+			}
+			id, err := s.findProviderDeployment(ctx, deviceID, consumerID, []string{dep.Name})
+			return models.DependencyNodeDeployment, id, err
+		}
+		engine := dep.Engine
+		if engine == "" {
+			engine = s.infraConfig.GetDefaultCacheEngine()
+		}
+		var instance models.SharedCacheInstance
+		err := s.db.WithContext(ctx).Where("device_id = ? AND engine = ?", deviceID, engine).First(&instance).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", uuid.Nil, nil
+		}
+		return models.DependencyNodeSharedCache, instance.ID, err
+
+	default:
+		// Infrastructure and backup dependencies are installed software, not graph nodes
+		return "", uuid.Nil, nil
+	}
+}
+
+// findProviderDeployment returns the first deployment on the device, other than the consumer, running one of the recipes
+// Recipes are tried in order so a preferred provider wins; returns uuid.Nil if none is deployed
+func (s *DependencyService) findProviderDeployment(ctx context.Context, deviceID uuid.UUID, consumerID uuid.UUID, slugs []string) (uuid.UUID, error) {
+	for _, slug := range slugs {
+		var deployment models.Deployment
+		err := s.db.WithContext(ctx).
+			Where("device_id = ? AND recipe_slug = ? AND id <> ? AND status <> ?", deviceID, slug, consumerID, models.DeploymentStatusFailed).
+			Order("created_at").
+			First(&deployment).Error
+		if err == nil {
+			return deployment.ID, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, fmt.Errorf("failed to query deployments: %w", err)
+		}
+	}
+	return uuid.Nil, nil
+}
+
 // waitForHealthy waits for a provisioned resource to become healthy
 func (s *DependencyService) waitForHealthy(
 	ctx context.Context,
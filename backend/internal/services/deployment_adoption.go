@@ -0,0 +1,1017 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// DiscoveredAppKind says how an unmanaged app was started
+type DiscoveredAppKind string
+
+const (
+	DiscoveredAppCompose   DiscoveredAppKind = "compose"   // A Compose project started outside the platform
+	DiscoveredAppContainer DiscoveredAppKind = "container" // A container started with docker run
+)
+
+// Docker labels used to recognise Compose projects and Swarm tasks
+const (
+	composeProjectLabel     = "com.docker.compose.project"
+	composeServiceLabel     = "com.docker.compose.service"
+	composeWorkingDirLabel  = "com.docker.compose.project.working_dir"
+	composeConfigFilesLabel = "com.docker.compose.project.config_files"
+	swarmServiceLabel       = "com.docker.swarm.service.name"
+)
+
+// DiscoveredApp is a Compose project or standalone container found on a device
+type DiscoveredApp struct {
+	Kind        DiscoveredAppKind     `json:"kind"`
+	Name        string                `json:"name"`                   // Compose project or container name
+	WorkingDir  string                `json:"working_dir,omitempty"`  // Directory the Compose project was started from
+	ConfigFiles []string              `json:"config_files,omitempty"` // Compose files the project was started with
+	Containers  []DiscoveredContainer `json:"containers"`
+	Images      []string              `json:"images"`
+	Ports       []DiscoveredPort      `json:"ports"`
+	Volumes     []DiscoveredVolume    `json:"volumes"`
+	Matches     []RecipeMatch         `json:"matches"` // Best match first
+	Adoptable   bool                  `json:"adoptable"`
+	Reason      string                `json:"reason,omitempty"` // Why the app can't be adopted
+}
+
+// DiscoveredContainer is one container of a discovered app
+type DiscoveredContainer struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Service string `json:"service,omitempty"` // Compose service name
+	Image   string `json:"image"`
+	State   string `json:"state"` // e.g. "running", "exited"
+}
+
+// DiscoveredPort is a published container port
+type DiscoveredPort struct {
+	Container     string `json:"container"`
+	HostIP        string `json:"host_ip,omitempty"`
+	HostPort      int    `json:"host_port"`
+	ContainerPort int    `json:"container_port"`
+	Protocol      string `json:"protocol"`
+}
+
+// DiscoveredVolume is a named volume or host directory mounted into a container
+type DiscoveredVolume struct {
+	Container   string `json:"container"`
+	Type        string `json:"type"`             // "volume" or "bind"
+	Name        string `json:"name,omitempty"`   // Volume name
+	Source      string `json:"source,omitempty"` // Host path of a bind mount
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"read_only,omitempty"`
+}
+
+// RecipeMatch is a marketplace recipe whose images a discovered app runs
+type RecipeMatch struct {
+	Slug          string   `json:"slug"`
+	Name          string   `json:"name"`
+	Score         int      `json:"score"` // 0-100: share of the recipe's images the app runs
+	MatchedImages []string `json:"matched_images"`
+}
+
+// AdoptAppRequest represents a request to import a discovered app as a deployment
+type AdoptAppRequest struct {
+	Kind           DiscoveredAppKind `json:"kind"`
+	Name           string            `json:"name"`                      // Compose project or container name
+	RecipeSlug     string            `json:"recipe_slug,omitempty"`     // Defaults to the best image match
+	ComposeProject string            `json:"compose_project,omitempty"` // Project for an adopted container; defaults to its name
+}
+
+// containerInspect is the part of `docker inspect` output discovery uses
+type containerInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"` // Has a leading "/"
+	Config struct {
+		Image  string            `json:"Image"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status string `json:"Status"`
+	} `json:"State"`
+	HostConfig struct {
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+		PortBindings map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"PortBindings"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+}
+
+func (c containerInspect) name() string {
+	return strings.TrimPrefix(c.Name, "/")
+}
+
+// recipeLister is implemented by recipe providers that can list every recipe
+type recipeLister interface {
+	ListRecipes() []*models.Recipe
+}
+
+var (
+	// composeImageRegex matches `image:` lines in a compose file
+	composeImageRegex = regexp.MustCompile(`(?m)^\s*image:\s*["']?([^\s"'#]+)`)
+	// anonymousVolumeRegex matches the generated names of anonymous volumes
+	anonymousVolumeRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	// invalidProjectCharsRegex matches characters Compose doesn't allow in project names
+	invalidProjectCharsRegex = regexp.MustCompile(`[^a-z0-9_-]+`)
+)
+
+// DiscoverApps lists Compose projects and standalone containers on a device that the platform doesn't manage,
+// each matched against marketplace recipes by image
+func (s *DeploymentService) DiscoverApps(deviceID uuid.UUID) ([]DiscoveredApp, error) {
+	device, err := s.deviceService.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("device not found: %w", err)
+	}
+
+	containers, err := s.inspectContainers(device.GetSSHHost())
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []string
+	if err := s.db.Model(&models.Deployment{}).Where("device_id = ?", deviceID).Pluck("compose_project", &projects).Error; err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	managed := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		managed[project] = true
+	}
+
+	var recipes []*models.Recipe
+	if lister, ok := s.recipeLoader.(recipeLister); ok {
+		recipes = lister.ListRecipes()
+	}
+
+	apps := groupDiscoveredApps(containers, managed)
+	for i := range apps {
+		apps[i].Matches = matchRecipes(apps[i].Images, recipes)
+	}
+	return apps, nil
+}
+
+// AdoptApp imports a discovered app as a deployment and queues the job that takes it over
+// Compose projects keep running untouched; standalone containers are recreated under Compose
+func (s *DeploymentService) AdoptApp(deviceID uuid.UUID, req AdoptAppRequest) (*models.Deployment, error) {
+	apps, err := s.DiscoverApps(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	app := findDiscoveredApp(apps, req.Kind, req.Name)
+	if app == nil {
+		return nil, fmt.Errorf("no unmanaged %s named %s found on this device", req.Kind, req.Name)
+	}
+	if !app.Adoptable {
+		return nil, fmt.Errorf("%s cannot be adopted: %s", app.Name, app.Reason)
+	}
+
+	if req.RecipeSlug == "" {
+		if len(app.Matches) == 0 {
+			return nil, fmt.Errorf("no recipe matches the images of %s; choose a recipe_slug", app.Name)
+		}
+		req.RecipeSlug = app.Matches[0].Slug
+	}
+	recipe, err := s.recipeLoader.GetRecipe(req.RecipeSlug)
+	if err != nil {
+		return nil, fmt.Errorf("recipe not found: %w", err)
+	}
+
+	adoptedFrom := app.Name
+	switch app.Kind {
+	case DiscoveredAppCompose:
+		// Containers belong to their project, so the project name can't change
+		if req.ComposeProject != "" && req.ComposeProject != app.Name {
+			return nil, fmt.Errorf("an adopted Compose project keeps its project name (%s)", app.Name)
+		}
+		req.ComposeProject = app.Name
+		adoptedFrom = app.WorkingDir
+	case DiscoveredAppContainer:
+		if req.ComposeProject == "" {
+			req.ComposeProject = sanitizeProjectName(app.Name)
+		}
+	}
+	if err := s.validateComposeProject(req.ComposeProject); err != nil {
+		return nil, err
+	}
+
+	deployment := &models.Deployment{
+		RecipeSlug:     recipe.Slug,
+		RecipeName:     recipe.Name,
+		DeviceID:       deviceID,
+		Status:         models.DeploymentStatusValidating,
+		Config:         []byte("{}"),
+		ComposeProject: req.ComposeProject,
+		AdoptedFrom:    adoptedFrom,
+	}
+	if err := s.db.Create(deployment).Error; err != nil {
+		return nil, fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	job := &models.DeploymentJob{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentJobAdopt,
+		DeviceID:     deviceID,
+	}
+	if err := s.jobQueue.Enqueue(job, req); err != nil {
+		s.updateStatus(deployment, models.DeploymentStatusFailed, err.Error())
+		return nil, err
+	}
+
+	return deployment, nil
+}
+
+// adoptionState records what an adoption changed so it can be undone
+type adoptionState struct {
+	dirCreated        bool
+	containerStopped  bool
+	createdVolumes    []string
+	composeStarted    bool
+	originalContainer string // Standalone container replaced by the adoption, removed once its replacement runs
+}
+
+// executeAdoption takes over a discovered app: its compose file is captured in the deployment directory
+// so restarts, health checks, backups and upgrades work as for native deployments
+func (s *DeploymentService) executeAdoption(ctx context.Context, deployment *models.Deployment, recipe *models.Recipe, device *models.Device, req AdoptAppRequest) {
+	host := device.GetSSHHost()
+	project := deployment.ComposeProject
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+	state := &adoptionState{}
+
+	fail := func(reason string) {
+		s.rollbackAdoption(deployment, host, req, state)
+		s.appendLog(deployment, fmt.Sprintf("❌ %s", reason))
+		s.updateStatus(deployment, models.DeploymentStatusFailed, reason)
+	}
+
+	s.appendLog(deployment, fmt.Sprintf("Adopting %s %s as %s", req.Kind, req.Name, recipe.Name))
+	s.updateStatus(deployment, models.DeploymentStatusPreparing, "")
+
+	// The app may have changed since it was discovered
+	containers, err := s.inspectContainers(host)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	app := findDiscoveredApp(groupDiscoveredApps(containers, nil), req.Kind, req.Name)
+	if app == nil {
+		fail(fmt.Sprintf("%s %s no longer exists", req.Kind, req.Name))
+		return
+	}
+	if !app.Adoptable {
+		fail(fmt.Sprintf("%s cannot be adopted: %s", app.Name, app.Reason))
+		return
+	}
+
+	if output, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("test ! -e %s && mkdir -p %s", deployDir, deployDir), 30*time.Second); err != nil {
+		fail(fmt.Sprintf("Deployment directory %s already exists or could not be created: %v (output: %s)", deployDir, err, output))
+		return
+	}
+	state.dirCreated = true
+
+	var compose string
+	switch app.Kind {
+	case DiscoveredAppCompose:
+		compose, err = s.captureComposeProject(deployment, host, app, deployDir)
+	case DiscoveredAppContainer:
+		var inspect *containerInspect
+		for i := range containers {
+			if containers[i].name() == app.Name {
+				inspect = &containers[i]
+			}
+		}
+		compose, err = s.recreateUnderCompose(ctx, deployment, host, inspect, deployDir, state)
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	s.beginStep(deployment, "health_check")
+	runningCmd := fmt.Sprintf("cd %s && docker compose -p %s ps -q --status running", deployDir, project)
+	output, err := s.sshClient.ExecuteWithTimeout(host, runningCmd, 1*time.Minute)
+	if err != nil {
+		fail(fmt.Sprintf("Failed to check containers: %v", err))
+		return
+	}
+	status := models.DeploymentStatusRunning
+	if strings.TrimSpace(output) == "" {
+		if app.Kind == DiscoveredAppContainer {
+			fail("Recreated container is not running")
+			return
+		}
+		// A stopped Compose project is adopted as it is
+		status = models.DeploymentStatusStopped
+	}
+	if state.originalContainer != "" {
+		if output, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("docker rm %s", state.originalContainer), 1*time.Minute); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Could not remove the original container %s: %v (output: %s)", state.originalContainer, err, output))
+		} else {
+			s.appendLog(deployment, fmt.Sprintf("Original container %s removed", state.originalContainer))
+		}
+	}
+
+	// The app already listens on its ports, so only a conflicting registry entry is reported
+	ports := make([]PortSpec, 0, len(app.Ports))
+	for _, port := range app.Ports {
+		if port.HostPort > 0 {
+			ports = append(ports, PortSpec{Port: port.HostPort, Protocol: port.Protocol})
+		}
+	}
+	if err := s.ports.RecordDeploymentPorts(device, deployment.ID, ports); err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Could not record ports: %v", err))
+	}
+
+	now := time.Now()
+	deployment.GeneratedCompose = compose
+	deployment.InternalPort, deployment.ExternalPort = adoptedAppPort(app, recipe)
+	deployment.DeployedAt = &now
+	deployment.AdoptedAt = &now
+	s.appendLog(deployment, fmt.Sprintf("🎉 %s adopted; it is now managed from %s", app.Name, deployDir))
+	s.updateStatus(deployment, status, "")
+}
+
+// captureComposeProject copies a Compose project's compose and .env files into the deployment directory
+// The running containers are left alone: they already carry the project's labels
+func (s *DeploymentService) captureComposeProject(deployment *models.Deployment, host string, app *DiscoveredApp, deployDir string) (string, error) {
+	project := deployment.ComposeProject
+
+	s.beginStep(deployment, "capture")
+	s.appendLog(deployment, fmt.Sprintf("Capturing %s...", app.ConfigFiles[0]))
+	content, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("cat %s", app.ConfigFiles[0]), 30*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to read compose file: %v", err)
+	}
+
+	// Relative paths in the compose file point into the original directory
+	compose, err := rebaseComposePaths(content, app.WorkingDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse compose file: %v", err)
+	}
+
+	writeCmd := fmt.Sprintf("cat > %s/docker-compose.yml << 'EOF'\n%s\nEOF", deployDir, compose)
+	if _, err := s.sshClient.ExecuteWithTimeout(host, writeCmd, 1*time.Minute); err != nil {
+		return "", fmt.Errorf("failed to write compose file: %v", err)
+	}
+	envCmd := fmt.Sprintf("if [ -f %s/.env ]; then cp %s/.env %s/.env; fi", app.WorkingDir, app.WorkingDir, deployDir)
+	if output, err := s.sshClient.ExecuteWithTimeout(host, envCmd, 30*time.Second); err != nil {
+		return "", fmt.Errorf("failed to copy .env file: %v (output: %s)", err, output)
+	}
+
+	checkCmd := fmt.Sprintf("cd %s && docker compose -p %s config -q", deployDir, project)
+	if output, err := s.sshClient.ExecuteWithTimeout(host, checkCmd, 1*time.Minute); err != nil {
+		return "", fmt.Errorf("captured compose file is invalid: %v (output: %s)", err, output)
+	}
+	s.appendLog(deployment, "✓ Compose project captured")
+	s.appendLog(deployment, fmt.Sprintf("Files in %s are no longer used by the platform", app.WorkingDir))
+
+	return compose, nil
+}
+
+// recreateUnderCompose replaces a standalone container with an equivalent Compose service
+// Named volumes are copied into project volumes; the originals are kept
+func (s *DeploymentService) recreateUnderCompose(ctx context.Context, deployment *models.Deployment, host string, container *containerInspect, deployDir string, state *adoptionState) (string, error) {
+	project := deployment.ComposeProject
+	if container == nil {
+		return "", fmt.Errorf("container no longer exists")
+	}
+
+	s.beginStep(deployment, "capture")
+	imageEnvOutput, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("docker image inspect --format '{{json .Config.Env}}' %s", container.Config.Image), 30*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %v", container.Config.Image, err)
+	}
+	var imageEnv []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(imageEnvOutput)), &imageEnv); err != nil {
+		return "", fmt.Errorf("failed to parse image environment: %v", err)
+	}
+
+	compose, envContent, volumes, err := composeFromContainer(container, imageEnv)
+	if err != nil {
+		return "", err
+	}
+
+	writeCmd := fmt.Sprintf("cat > %s/docker-compose.yml << 'EOF'\n%s\nEOF", deployDir, compose)
+	if _, err := s.sshClient.ExecuteWithTimeout(host, writeCmd, 1*time.Minute); err != nil {
+		return "", fmt.Errorf("failed to write compose file: %v", err)
+	}
+	if envContent != "" {
+		writeEnvCmd := fmt.Sprintf("cat > %s/.env << 'EOF'\n%s\nEOF", deployDir, envContent)
+		if _, err := s.sshClient.ExecuteWithTimeout(host, writeEnvCmd, 1*time.Minute); err != nil {
+			return "", fmt.Errorf("failed to write .env file: %v", err)
+		}
+	}
+	checkCmd := fmt.Sprintf("cd %s && docker compose -p %s config -q", deployDir, project)
+	if output, err := s.sshClient.ExecuteWithTimeout(host, checkCmd, 1*time.Minute); err != nil {
+		return "", fmt.Errorf("generated compose file is invalid: %v (output: %s)", err, output)
+	}
+	s.appendLog(deployment, "✓ Compose file generated from the container's image, ports, volumes, environment and restart policy")
+	s.appendLog(deployment, "⚠️  Command overrides, networks and labels are not carried over")
+
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("adoption was cancelled")
+	}
+
+	s.updateStatus(deployment, models.DeploymentStatusDeploying, "")
+	s.beginStep(deployment, "containers")
+	if container.State.Status == "running" {
+		s.appendLog(deployment, fmt.Sprintf("Stopping %s...", container.name()))
+		if output, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("docker stop %s", container.ID), 2*time.Minute); err != nil {
+			return "", fmt.Errorf("failed to stop container: %v (output: %s)", err, output)
+		}
+		state.containerStopped = true
+	}
+
+	for _, volume := range volumes {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("adoption was cancelled")
+		}
+
+		volumeName := fmt.Sprintf("%s_%s", project, volume.key)
+		s.appendLog(deployment, fmt.Sprintf("Copying volume %s to %s...", volume.source, volumeName))
+
+		// Compose labels let docker compose adopt the volume instead of warning about it
+		createCmd := fmt.Sprintf("docker volume create --label com.docker.compose.project=%s --label com.docker.compose.volume=%s %s", project, volume.key, volumeName)
+		if output, err := s.sshClient.ExecuteWithTimeout(host, createCmd, 1*time.Minute); err != nil {
+			return "", fmt.Errorf("failed to create volume %s: %v (output: %s)", volumeName, err, output)
+		}
+		state.createdVolumes = append(state.createdVolumes, volumeName)
+
+		copyCmd := fmt.Sprintf("docker run --rm -v %s:/source:ro -v %s:/target %s cp -a /source/. /target/", volume.source, volumeName, backupHelperImage)
+		if output, err := s.sshClient.ExecuteWithTimeout(host, copyCmd, 2*time.Hour); err != nil {
+			return "", fmt.Errorf("failed to copy volume %s: %v (output: %s)", volume.source, err, output)
+		}
+	}
+
+	s.appendLog(deployment, "Starting the app under Docker Compose...")
+	state.composeStarted = true
+	upCmd := fmt.Sprintf("cd %s && docker compose -p %s up -d", deployDir, project)
+	if output, err := s.sshClient.ExecuteWithTimeout(host, upCmd, 15*time.Minute); err != nil {
+		return "", fmt.Errorf("docker compose up failed: %v (output: %s)", err, output)
+	}
+	s.appendLog(deployment, "✓ Containers started")
+
+	// The original stays (stopped) until the new container is verified, so a rollback can start it again
+	state.originalContainer = container.name()
+	if len(volumes) > 0 {
+		sources := make([]string, len(volumes))
+		for i, volume := range volumes {
+			sources[i] = volume.source
+		}
+		s.appendLog(deployment, fmt.Sprintf("Original volumes were kept; remove them once the app checks out: %s", strings.Join(sources, ", ")))
+	}
+
+	return compose, nil
+}
+
+// rollbackAdoption puts a standalone container back and removes anything the adoption created
+func (s *DeploymentService) rollbackAdoption(deployment *models.Deployment, host string, req AdoptAppRequest, state *adoptionState) {
+	project := deployment.ComposeProject
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+
+	if state.composeStarted {
+		downCmd := fmt.Sprintf("cd %s && docker compose -p %s down", deployDir, project)
+		if output, err := s.sshClient.ExecuteWithTimeout(host, downCmd, 2*time.Minute); err != nil {
+			log.Printf("[Deployment] Warning: failed to remove adopted containers of %s: %v (output: %s)", project, err, output)
+		}
+	}
+	if len(state.createdVolumes) > 0 {
+		removeCmd := fmt.Sprintf("docker volume rm %s", strings.Join(state.createdVolumes, " "))
+		if output, err := s.sshClient.ExecuteWithTimeout(host, removeCmd, 2*time.Minute); err != nil {
+			log.Printf("[Deployment] Warning: failed to remove copied volumes of %s: %v (output: %s)", project, err, output)
+		}
+	}
+	if state.containerStopped {
+		if output, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("docker start %s", req.Name), 2*time.Minute); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to restart the original container %s: %v (output: %s)", req.Name, err, output))
+		} else {
+			s.appendLog(deployment, fmt.Sprintf("Original container %s restarted", req.Name))
+		}
+	}
+	if state.dirCreated {
+		if _, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("rm -rf %s", deployDir), 30*time.Second); err != nil {
+			log.Printf("[Deployment] Warning: failed to remove deployment directory %s: %v", deployDir, err)
+		}
+	}
+}
+
+// inspectContainers returns `docker inspect` output for every container on a host
+func (s *DeploymentService) inspectContainers(host string) ([]containerInspect, error) {
+	cmd := `ids=$(docker ps -aq); if [ -n "$ids" ]; then docker inspect $ids; else echo '[]'; fi`
+	output, err := s.sshClient.ExecuteWithTimeout(host, cmd, 1*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var containers []containerInspect
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &containers); err != nil {
+		return nil, fmt.Errorf("failed to parse container list: %w", err)
+	}
+	return containers, nil
+}
+
+// groupDiscoveredApps groups containers into Compose projects and standalone containers
+// Projects in managed, platform deployment directories and Swarm tasks are skipped
+func groupDiscoveredApps(containers []containerInspect, managed map[string]bool) []DiscoveredApp {
+	projects := make(map[string]*DiscoveredApp)
+	var apps []*DiscoveredApp
+
+	for _, c := range containers {
+		labels := c.Config.Labels
+		if labels[swarmServiceLabel] != "" || c.Config.Image == backupHelperImage {
+			continue
+		}
+
+		project := labels[composeProjectLabel]
+		if project == "" {
+			app := &DiscoveredApp{Kind: DiscoveredAppContainer, Name: c.name()}
+			addDiscoveredContainer(app, c)
+			apps = append(apps, app)
+			continue
+		}
+
+		workingDir := labels[composeWorkingDirLabel]
+		if managed[project] || strings.Contains(workingDir, "/homelab-deployments/") {
+			continue
+		}
+		app, ok := projects[project]
+		if !ok {
+			app = &DiscoveredApp{Kind: DiscoveredAppCompose, Name: project, WorkingDir: workingDir}
+			if files := labels[composeConfigFilesLabel]; files != "" {
+				app.ConfigFiles = strings.Split(files, ",")
+			}
+			projects[project] = app
+			apps = append(apps, app)
+		}
+		addDiscoveredContainer(app, c)
+	}
+
+	result := make([]DiscoveredApp, 0, len(apps))
+	for _, app := range apps {
+		sort.Strings(app.Images)
+		sort.Slice(app.Ports, func(i, j int) bool { return app.Ports[i].HostPort < app.Ports[j].HostPort })
+		app.Reason = adoptionBlocker(app)
+		app.Adoptable = app.Reason == ""
+		result = append(result, *app)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// addDiscoveredContainer adds a container with its image, published ports and mounts to an app
+func addDiscoveredContainer(app *DiscoveredApp, c containerInspect) {
+	name := c.name()
+	app.Containers = append(app.Containers, DiscoveredContainer{
+		ID:      c.ID,
+		Name:    name,
+		Service: c.Config.Labels[composeServiceLabel],
+		Image:   c.Config.Image,
+		State:   c.State.Status,
+	})
+	if !containsString(app.Images, c.Config.Image) {
+		app.Images = append(app.Images, c.Config.Image)
+	}
+
+	for containerPort, bindings := range c.HostConfig.PortBindings {
+		port, protocol, _ := strings.Cut(containerPort, "/")
+		target, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+		for _, binding := range bindings {
+			hostPort, err := strconv.Atoi(binding.HostPort)
+			if err != nil {
+				continue
+			}
+			app.Ports = append(app.Ports, DiscoveredPort{
+				Container:     name,
+				HostIP:        binding.HostIP,
+				HostPort:      hostPort,
+				ContainerPort: target,
+				Protocol:      protocol,
+			})
+		}
+	}
+
+	for _, m := range c.Mounts {
+		if m.Type != "volume" && m.Type != "bind" {
+			continue
+		}
+		volume := DiscoveredVolume{Container: name, Type: m.Type, Destination: m.Destination, ReadOnly: !m.RW}
+		if m.Type == "volume" {
+			volume.Name = m.Name
+		} else {
+			volume.Source = m.Source
+		}
+		app.Volumes = append(app.Volumes, volume)
+	}
+}
+
+// adoptionBlocker returns why an app can't be adopted, or "" if it can
+func adoptionBlocker(app *DiscoveredApp) string {
+	switch app.Kind {
+	case DiscoveredAppCompose:
+		if !isValidStackName(app.Name) {
+			return fmt.Sprintf("project name %s is not supported", app.Name)
+		}
+		if app.WorkingDir == "" || len(app.ConfigFiles) == 0 {
+			return "the project was not started with docker compose, so its compose file is unknown"
+		}
+		if len(app.ConfigFiles) > 1 {
+			return fmt.Sprintf("the project uses %d compose files; merge them into one to adopt it", len(app.ConfigFiles))
+		}
+		if !isValidDeployPath(app.WorkingDir) || !isValidDeployPath(app.ConfigFiles[0]) {
+			return "the compose file path contains unsupported characters"
+		}
+	case DiscoveredAppContainer:
+		for _, volume := range app.Volumes {
+			if volume.Type == "bind" && !isValidDeployPath(volume.Source) {
+				return fmt.Sprintf("host path %s contains unsupported characters", volume.Source)
+			}
+		}
+	}
+	return ""
+}
+
+// findDiscoveredApp returns the app with the given kind and name, or nil
+func findDiscoveredApp(apps []DiscoveredApp, kind DiscoveredAppKind, name string) *DiscoveredApp {
+	for i := range apps {
+		if apps[i].Kind == kind && apps[i].Name == name {
+			return &apps[i]
+		}
+	}
+	return nil
+}
+
+// matchRecipes ranks recipes by the share of their images an app runs, ignoring tags and registries' default prefixes
+func matchRecipes(images []string, recipes []*models.Recipe) []RecipeMatch {
+	appRepos := make(map[string]string, len(images))
+	for _, image := range images {
+		if repo := imageRepository(image); repo != "" {
+			appRepos[repo] = image
+		}
+	}
+
+	matches := []RecipeMatch{}
+	for _, recipe := range recipes {
+		recipeRepos := make(map[string]bool)
+		for _, image := range composeImages(recipe.ComposeContent) {
+			if repo := imageRepository(image); repo != "" {
+				recipeRepos[repo] = true
+			}
+		}
+		if len(recipeRepos) == 0 {
+			continue
+		}
+
+		var matched []string
+		for repo := range recipeRepos {
+			if image, ok := appRepos[repo]; ok {
+				matched = append(matched, image)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		sort.Strings(matched)
+		matches = append(matches, RecipeMatch{
+			Slug:          recipe.Slug,
+			Name:          recipe.Name,
+			Score:         len(matched) * 100 / len(recipeRepos),
+			MatchedImages: matched,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Slug < matches[j].Slug
+	})
+	return matches
+}
+
+// composeImages returns the images referenced by a compose file
+func composeImages(compose string) []string {
+	var images []string
+	for _, match := range composeImageRegex.FindAllStringSubmatch(compose, -1) {
+		images = append(images, match[1])
+	}
+	return images
+}
+
+// imageRepository returns an image's registry and repository without tag or digest
+// Docker Hub references are normalised, so "nginx" and "docker.io/library/nginx:1.27" give the same result
+func imageRepository(image string) string {
+	// Interpolated tags such as "nextcloud:${VERSION:-latest}" are dropped
+	image, _, _ = strings.Cut(image, "@")
+	image = strings.TrimSuffix(composeVarRegex.ReplaceAllString(image, ""), ":")
+	ref, err := ParseImageReference(image)
+	if err != nil {
+		return ""
+	}
+	if ref.Registry == "docker.io" || ref.Registry == "index.docker.io" {
+		ref.Registry = dockerHubRegistry
+		if !strings.Contains(ref.Repository, "/") {
+			ref.Repository = "library/" + ref.Repository
+		}
+	}
+	return ref.Registry + "/" + ref.Repository
+}
+
+// sanitizeProjectName turns a container or app name into a Compose project name
+func sanitizeProjectName(name string) string {
+	project := strings.Trim(invalidProjectCharsRegex.ReplaceAllString(strings.ToLower(name), "-"), "-_")
+	if project == "" {
+		project = "app"
+	}
+	return project
+}
+
+// adoptedAppPort picks the published port of the container running the recipe's main image
+func adoptedAppPort(app *DiscoveredApp, recipe *models.Recipe) (internalPort, externalPort int) {
+	recipeRepos := make(map[string]bool)
+	for _, image := range composeImages(recipe.ComposeContent) {
+		recipeRepos[imageRepository(image)] = true
+	}
+	images := make(map[string]string, len(app.Containers))
+	for _, c := range app.Containers {
+		images[c.Name] = c.Image
+	}
+
+	var fallback *DiscoveredPort
+	for i := range app.Ports {
+		port := &app.Ports[i]
+		if port.Protocol != "tcp" {
+			continue
+		}
+		if recipeRepos[imageRepository(images[port.Container])] {
+			return port.ContainerPort, port.HostPort
+		}
+		if fallback == nil {
+			fallback = port
+		}
+	}
+	if fallback != nil {
+		return fallback.ContainerPort, fallback.HostPort
+	}
+	return 0, 0
+}
+
+// rebaseComposePaths makes the relative bind mounts, env files, build contexts, extends files and
+// config/secret files of a compose file absolute
+func rebaseComposePaths(compose string, workingDir string) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(compose), &doc); err != nil {
+		return "", err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("compose file is empty")
+	}
+
+	rebase := func(p string) string {
+		if p == "" || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "~") || strings.HasPrefix(p, "$") {
+			return p
+		}
+		return path.Join(workingDir, p)
+	}
+
+	services := yamlMappingValue(doc.Content[0], "services")
+	if services != nil && services.Kind == yaml.MappingNode {
+		for i := 1; i < len(services.Content); i += 2 {
+			service := services.Content[i]
+			if service.Kind != yaml.MappingNode {
+				continue
+			}
+
+			if volumes := yamlMappingValue(service, "volumes"); volumes != nil && volumes.Kind == yaml.SequenceNode {
+				for _, volume := range volumes.Content {
+					switch volume.Kind {
+					case yaml.ScalarNode:
+						// Short syntax: only "./" and "../" sources are host paths relative to the project
+						source, rest, found := strings.Cut(volume.Value, ":")
+						if found && (source == "." || strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")) {
+							volume.Value = rebase(source) + ":" + rest
+						}
+					case yaml.MappingNode:
+						if volumeType := yamlMappingValue(volume, "type"); volumeType != nil && volumeType.Value == "bind" {
+							if source := yamlMappingValue(volume, "source"); source != nil {
+								source.Value = rebase(source.Value)
+							}
+						}
+					}
+				}
+			}
+
+			if envFile := yamlMappingValue(service, "env_file"); envFile != nil {
+				switch envFile.Kind {
+				case yaml.ScalarNode:
+					envFile.Value = rebase(envFile.Value)
+				case yaml.SequenceNode:
+					for _, entry := range envFile.Content {
+						if entry.Kind == yaml.ScalarNode {
+							entry.Value = rebase(entry.Value)
+						} else if p := yamlMappingValue(entry, "path"); p != nil {
+							p.Value = rebase(p.Value)
+						}
+					}
+				}
+			}
+
+			if extends := yamlMappingValue(service, "extends"); extends != nil {
+				if file := yamlMappingValue(extends, "file"); file != nil && file.Kind == yaml.ScalarNode {
+					file.Value = rebase(file.Value)
+				}
+			}
+
+			if build := yamlMappingValue(service, "build"); build != nil {
+				buildContext := build
+				if build.Kind == yaml.MappingNode {
+					buildContext = yamlMappingValue(build, "context")
+				}
+				// Git URLs are left as they are
+				if buildContext != nil && buildContext.Kind == yaml.ScalarNode && !strings.Contains(buildContext.Value, "://") && !strings.HasPrefix(buildContext.Value, "git@") {
+					buildContext.Value = rebase(buildContext.Value)
+				}
+			}
+		}
+	}
+
+	// Top-level configs and secrets may be read from files next to the compose file
+	for _, section := range []string{"configs", "secrets"} {
+		definitions := yamlMappingValue(doc.Content[0], section)
+		if definitions == nil || definitions.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(definitions.Content); i += 2 {
+			if file := yamlMappingValue(definitions.Content[i], "file"); file != nil && file.Kind == yaml.ScalarNode {
+				file.Value = rebase(file.Value)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// yamlMappingValue returns the value for a key of a YAML mapping node, or nil
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// adoptedVolume is a named volume of a standalone container and the project volume it is copied to
+type adoptedVolume struct {
+	source string // Original volume name
+	key    string // Volume name in the compose file
+}
+
+// adoptedComposeService is the compose service generated for a standalone container
+type adoptedComposeService struct {
+	Image   string   `yaml:"image"`
+	Restart string   `yaml:"restart,omitempty"`
+	EnvFile []string `yaml:"env_file,omitempty"`
+	Ports   []string `yaml:"ports,omitempty"`
+	Volumes []string `yaml:"volumes,omitempty"`
+}
+
+// composeFromContainer builds a compose file and .env content equivalent to a standalone container
+// Environment variables set by the image itself are left out
+func composeFromContainer(c *containerInspect, imageEnv []string) (compose string, envContent string, volumes []adoptedVolume, err error) {
+	service := adoptedComposeService{Image: c.Config.Image}
+	if policy := c.HostConfig.RestartPolicy.Name; policy != "" && policy != "no" {
+		service.Restart = policy
+	}
+
+	containerPorts := make([]string, 0, len(c.HostConfig.PortBindings))
+	for containerPort := range c.HostConfig.PortBindings {
+		containerPorts = append(containerPorts, containerPort)
+	}
+	sort.Strings(containerPorts)
+	for _, containerPort := range containerPorts {
+		port, protocol, _ := strings.Cut(containerPort, "/")
+		for _, binding := range c.HostConfig.PortBindings[containerPort] {
+			if binding.HostPort == "" {
+				continue
+			}
+			spec := fmt.Sprintf("%s:%s", binding.HostPort, port)
+			if binding.HostIP != "" && binding.HostIP != "0.0.0.0" && binding.HostIP != "::" {
+				spec = fmt.Sprintf("%s:%s", binding.HostIP, spec)
+			}
+			if protocol != "" && protocol != "tcp" {
+				spec += "/" + protocol
+			}
+			service.Ports = append(service.Ports, spec)
+		}
+	}
+
+	namedVolumes := map[string]struct{}{}
+	anonymous := 0
+	for _, m := range c.Mounts {
+		var spec string
+		switch m.Type {
+		case "volume":
+			key := m.Name
+			if anonymousVolumeRegex.MatchString(m.Name) {
+				anonymous++
+				key = fmt.Sprintf("data%d", anonymous)
+			}
+			namedVolumes[key] = struct{}{}
+			volumes = append(volumes, adoptedVolume{source: m.Name, key: key})
+			spec = fmt.Sprintf("%s:%s", key, m.Destination)
+		case "bind":
+			spec = fmt.Sprintf("%s:%s", m.Source, m.Destination)
+		default:
+			continue
+		}
+		if !m.RW {
+			spec += ":ro"
+		}
+		service.Volumes = append(service.Volumes, spec)
+	}
+
+	imageDefaults := make(map[string]bool, len(imageEnv))
+	for _, entry := range imageEnv {
+		imageDefaults[entry] = true
+	}
+	var env strings.Builder
+	var keys []string
+	values := make(map[string]string)
+	for _, entry := range c.Config.Env {
+		if imageDefaults[entry] {
+			continue
+		}
+		key, value, _ := strings.Cut(entry, "=")
+		if !isValidEnvVarName(key) || !isValidEnvVarValue(value) {
+			return "", "", nil, fmt.Errorf("environment variable %s cannot be written to a .env file", key)
+		}
+		keys = append(keys, key)
+		values[key] = value
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env.WriteString(fmt.Sprintf("%s=%s\n", key, escapeEnvValue(values[key])))
+	}
+	if len(keys) > 0 {
+		service.EnvFile = []string{".env"}
+	}
+
+	file := struct {
+		Services map[string]adoptedComposeService `yaml:"services"`
+		Volumes  map[string]struct{}              `yaml:"volumes,omitempty"`
+	}{
+		Services: map[string]adoptedComposeService{sanitizeProjectName(c.name()): service},
+		Volumes:  namedVolumes,
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return "", "", nil, fmt.Errorf("failed to generate compose file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", "", nil, fmt.Errorf("failed to generate compose file: %w", err)
+	}
+
+	return strings.TrimRight(out.String(), "\n"), strings.TrimRight(env.String(), "\n"), volumes, nil
+}
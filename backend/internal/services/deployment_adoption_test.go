@@ -0,0 +1,286 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const inspectFixture = `[
+  {
+    "Id": "aaa111",
+    "Name": "/nextcloud-app-1",
+    "Config": {"Image": "nextcloud:29", "Labels": {
+      "com.docker.compose.project": "nextcloud",
+      "com.docker.compose.service": "app",
+      "com.docker.compose.project.working_dir": "/home/me/stacks/nextcloud",
+      "com.docker.compose.project.config_files": "/home/me/stacks/nextcloud/docker-compose.yml"}},
+    "State": {"Status": "running"},
+    "HostConfig": {"PortBindings": {"80/tcp": [{"HostIp": "", "HostPort": "8080"}]}},
+    "Mounts": [{"Type": "volume", "Name": "nextcloud_html", "Destination": "/var/www/html", "RW": true}]
+  },
+  {
+    "Id": "aaa222",
+    "Name": "/nextcloud-db-1",
+    "Config": {"Image": "postgres:16", "Labels": {
+      "com.docker.compose.project": "nextcloud",
+      "com.docker.compose.service": "db",
+      "com.docker.compose.project.working_dir": "/home/me/stacks/nextcloud",
+      "com.docker.compose.project.config_files": "/home/me/stacks/nextcloud/docker-compose.yml"}},
+    "State": {"Status": "running"},
+    "HostConfig": {"PortBindings": {"5432/tcp": [{"HostIp": "127.0.0.1", "HostPort": "5432"}]}},
+    "Mounts": [{"Type": "bind", "Source": "/home/me/stacks/nextcloud/db", "Destination": "/var/lib/postgresql/data", "RW": true}]
+  },
+  {
+    "Id": "bbb111",
+    "Name": "/vaultwarden",
+    "Config": {"Image": "vaultwarden/server:latest", "Env": ["PATH=/usr/bin", "ADMIN_TOKEN=s3cret $tuff", "DOMAIN=https://vw.lan"], "Labels": {}},
+    "State": {"Status": "exited"},
+    "HostConfig": {"RestartPolicy": {"Name": "unless-stopped"}, "PortBindings": {"80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "8081"}], "3012/udp": [{"HostIp": "", "HostPort": "3012"}]}},
+    "Mounts": [
+      {"Type": "volume", "Name": "vw-data", "Destination": "/data", "RW": true},
+      {"Type": "volume", "Name": "3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d", "Destination": "/cache", "RW": true},
+      {"Type": "bind", "Source": "/etc/localtime", "Destination": "/etc/localtime", "RW": false}
+    ]
+  },
+  {
+    "Id": "ccc111",
+    "Name": "/wiki-js-1a2b3c4d-wiki-1",
+    "Config": {"Image": "requarks/wiki:2", "Labels": {
+      "com.docker.compose.project": "wiki-js-1a2b3c4d",
+      "com.docker.compose.project.working_dir": "/home/me/homelab-deployments/wiki-js-1a2b3c4d",
+      "com.docker.compose.project.config_files": "/home/me/homelab-deployments/wiki-js-1a2b3c4d/docker-compose.yml"}},
+    "State": {"Status": "running"}
+  },
+  {
+    "Id": "ddd111",
+    "Name": "/gitea",
+    "Config": {"Image": "gitea/gitea:1.22", "Labels": {
+      "com.docker.compose.project": "gitea",
+      "com.docker.compose.project.working_dir": "/srv/gitea",
+      "com.docker.compose.project.config_files": "/srv/gitea/docker-compose.yml,/srv/gitea/docker-compose.override.yml"}},
+    "State": {"Status": "running"}
+  },
+  {
+    "Id": "eee111",
+    "Name": "/homepage",
+    "Config": {"Image": "ghcr.io/gethomepage/homepage:latest", "Labels": {"com.docker.compose.project": "homepage"}},
+    "State": {"Status": "running"}
+  },
+  {
+    "Id": "fff111",
+    "Name": "/web.1.xyz",
+    "Config": {"Image": "nginx:1.27", "Labels": {"com.docker.swarm.service.name": "web"}},
+    "State": {"Status": "running"}
+  }
+]`
+
+func loadInspectFixture(t *testing.T) []containerInspect {
+	var containers []containerInspect
+	require.NoError(t, json.Unmarshal([]byte(inspectFixture), &containers))
+	return containers
+}
+
+func TestGroupDiscoveredApps(t *testing.T) {
+	apps := groupDiscoveredApps(loadInspectFixture(t), map[string]bool{"homepage": true})
+
+	// Platform deployments, managed projects and Swarm tasks are not listed
+	require.Len(t, apps, 3)
+	assert.Equal(t, "gitea", apps[0].Name)
+	assert.Equal(t, "nextcloud", apps[1].Name)
+	assert.Equal(t, "vaultwarden", apps[2].Name)
+
+	nextcloud := apps[1]
+	assert.Equal(t, DiscoveredAppCompose, nextcloud.Kind)
+	assert.True(t, nextcloud.Adoptable)
+	assert.Equal(t, "/home/me/stacks/nextcloud", nextcloud.WorkingDir)
+	assert.Equal(t, []string{"nextcloud:29", "postgres:16"}, nextcloud.Images)
+	require.Len(t, nextcloud.Containers, 2)
+	assert.Equal(t, "app", nextcloud.Containers[0].Service)
+	assert.Equal(t, []DiscoveredPort{
+		{Container: "nextcloud-db-1", HostIP: "127.0.0.1", HostPort: 5432, ContainerPort: 5432, Protocol: "tcp"},
+		{Container: "nextcloud-app-1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+	}, nextcloud.Ports)
+	assert.Len(t, nextcloud.Volumes, 2)
+
+	gitea := apps[0]
+	assert.False(t, gitea.Adoptable)
+	assert.Contains(t, gitea.Reason, "2 compose files")
+
+	vaultwarden := apps[2]
+	assert.Equal(t, DiscoveredAppContainer, vaultwarden.Kind)
+	assert.True(t, vaultwarden.Adoptable)
+	assert.Equal(t, "exited", vaultwarden.Containers[0].State)
+}
+
+func TestMatchRecipes(t *testing.T) {
+	recipes := []*models.Recipe{
+		{Slug: "nextcloud", Name: "Nextcloud", ComposeContent: "services:\n  app:\n    image: nextcloud:${NEXTCLOUD_VERSION:-29}\n  cron:\n    image: \"nextcloud:${NEXTCLOUD_VERSION:-29}\"\n"},
+		{Slug: "nextcloud-aio", Name: "Nextcloud AIO", ComposeContent: "services:\n  app:\n    image: docker.io/library/nextcloud:stable\n  redis:\n    image: redis:7\n"},
+		{Slug: "vaultwarden", Name: "Vaultwarden", ComposeContent: "services:\n  app:\n    image: vaultwarden/server:latest\n"},
+		{Slug: "empty", Name: "Empty"},
+	}
+
+	matches := matchRecipes([]string{"nextcloud:29", "postgres:16@sha256:abc"}, recipes)
+	require.Len(t, matches, 2)
+	assert.Equal(t, RecipeMatch{Slug: "nextcloud", Name: "Nextcloud", Score: 100, MatchedImages: []string{"nextcloud:29"}}, matches[0])
+	assert.Equal(t, "nextcloud-aio", matches[1].Slug)
+	assert.Equal(t, 50, matches[1].Score)
+
+	assert.Empty(t, matchRecipes([]string{"ghcr.io/vaultwarden/server:latest"}, recipes), "registry is part of the match")
+}
+
+func TestImageRepository(t *testing.T) {
+	nginx := imageRepository("nginx")
+	assert.NotEmpty(t, nginx)
+	assert.Equal(t, nginx, imageRepository("docker.io/library/nginx:1.27@sha256:abc"))
+	assert.Equal(t, nginx, imageRepository("index.docker.io/nginx"))
+	assert.Equal(t, imageRepository("nextcloud"), imageRepository("nextcloud:${VERSION:-latest}"))
+	assert.Equal(t, "localhost:5000/team/app", imageRepository("localhost:5000/team/app:v2"))
+	assert.NotEqual(t, imageRepository("vaultwarden/server"), imageRepository("ghcr.io/vaultwarden/server"))
+	assert.Empty(t, imageRepository(""))
+}
+
+func TestSanitizeProjectName(t *testing.T) {
+	assert.Equal(t, "vaultwarden", sanitizeProjectName("vaultwarden"))
+	assert.Equal(t, "my-app_2", sanitizeProjectName("My.App_2"))
+	assert.Equal(t, "app", sanitizeProjectName("..."))
+}
+
+func TestRebaseComposePaths(t *testing.T) {
+	compose := `services:
+  app:
+    image: nextcloud:29 # pinned
+    build: ./docker
+    env_file: .env.app
+    volumes:
+      - ./html:/var/www/html
+      - data:/data
+      - /srv/media:/media:ro
+      - type: bind
+        source: ../shared
+        target: /shared
+  db:
+    image: postgres:16
+    build:
+      context: https://github.com/example/db.git
+    env_file:
+      - db.env
+      - path: ./secrets.env
+  worker:
+    extends:
+      file: ./common.yml
+      service: base
+  cron:
+    extends: worker
+volumes:
+  data:
+configs:
+  nginx:
+    file: ./nginx.conf
+  generated:
+    content: "x"
+secrets:
+  db_password:
+    file: secrets/db_password.txt
+  external_key:
+    external: true
+`
+
+	rebased, err := rebaseComposePaths(compose, "/home/me/stacks/nextcloud")
+	require.NoError(t, err)
+
+	assert.Contains(t, rebased, "image: nextcloud:29 # pinned")
+	assert.Contains(t, rebased, "build: /home/me/stacks/nextcloud/docker")
+	assert.Contains(t, rebased, "env_file: /home/me/stacks/nextcloud/.env.app")
+	assert.Contains(t, rebased, "- /home/me/stacks/nextcloud/html:/var/www/html")
+	assert.Contains(t, rebased, "- data:/data")
+	assert.Contains(t, rebased, "- /srv/media:/media:ro")
+	assert.Contains(t, rebased, "source: /home/me/stacks/shared")
+	assert.Contains(t, rebased, "context: https://github.com/example/db.git")
+	assert.Contains(t, rebased, "- /home/me/stacks/nextcloud/db.env")
+	assert.Contains(t, rebased, "path: /home/me/stacks/nextcloud/secrets.env")
+	assert.Contains(t, rebased, "file: /home/me/stacks/nextcloud/common.yml")
+	assert.Contains(t, rebased, "extends: worker")
+	assert.Contains(t, rebased, "file: /home/me/stacks/nextcloud/nginx.conf")
+	assert.Contains(t, rebased, "file: /home/me/stacks/nextcloud/secrets/db_password.txt")
+
+	_, err = rebaseComposePaths("", "/srv")
+	assert.Error(t, err)
+}
+
+func TestComposeFromContainer(t *testing.T) {
+	containers := loadInspectFixture(t)
+	vaultwarden := &containers[2]
+
+	compose, env, volumes, err := composeFromContainer(vaultwarden, []string{"PATH=/usr/bin"})
+	require.NoError(t, err)
+
+	assert.Equal(t, `services:
+  vaultwarden:
+    image: vaultwarden/server:latest
+    restart: unless-stopped
+    env_file:
+      - .env
+    ports:
+      - 3012:3012/udp
+      - 8081:80
+    volumes:
+      - vw-data:/data
+      - data1:/cache
+      - /etc/localtime:/etc/localtime:ro
+volumes:
+  data1: {}
+  vw-data: {}`, compose)
+	assert.Equal(t, "ADMIN_TOKEN=\"s3cret $tuff\"\nDOMAIN=https://vw.lan", env)
+	assert.Equal(t, []adoptedVolume{
+		{source: "vw-data", key: "vw-data"},
+		{source: "3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d3b4f1c2d", key: "data1"},
+	}, volumes)
+
+	// Ports in the generated file are found like those of native deployments
+	assert.ElementsMatch(t, []PortSpec{{Port: 3012, Protocol: "udp"}, {Port: 8081, Protocol: "tcp"}}, ExtractPortsFromCompose(compose))
+}
+
+func TestAdoptedAppPort(t *testing.T) {
+	apps := groupDiscoveredApps(loadInspectFixture(t), nil)
+	nextcloud := findDiscoveredApp(apps, DiscoveredAppCompose, "nextcloud")
+	require.NotNil(t, nextcloud)
+
+	recipe := &models.Recipe{ComposeContent: "services:\n  app:\n    image: nextcloud:${VERSION}\n"}
+	internalPort, externalPort := adoptedAppPort(nextcloud, recipe)
+	assert.Equal(t, 80, internalPort)
+	assert.Equal(t, 8080, externalPort)
+
+	// Without an image match the first published TCP port is used
+	internalPort, externalPort = adoptedAppPort(nextcloud, &models.Recipe{})
+	assert.Equal(t, 5432, internalPort)
+	assert.Equal(t, 5432, externalPort)
+}
+
+func TestDeleteDeployment_UnfinishedAdoptionLeavesAppAlone(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.10"}
+	require.NoError(t, db.Create(device).Error)
+	deployment := &models.Deployment{
+		RecipeSlug:     "nextcloud",
+		DeviceID:       device.ID,
+		ComposeProject: "nextcloud",
+		AdoptedFrom:    "/home/me/stacks/nextcloud",
+		Status:         models.DeploymentStatusFailed,
+	}
+	require.NoError(t, db.Create(deployment).Error)
+
+	// No SSH client: deleting must not try to take the project down
+	require.NoError(t, service.DeleteDeployment(deployment.ID.String()))
+
+	var count int64
+	db.Model(&models.Deployment{}).Where("id = ?", deployment.ID).Count(&count)
+	assert.Zero(t, count)
+}
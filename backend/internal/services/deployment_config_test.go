@@ -0,0 +1,169 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	content := "# Auto-generated environment file\n\n" +
+		"DOMAIN=cloud.home\n" +
+		"ADMIN_PASSWORD=\"p@ss \\\"word\\\" \\\\ end\"\n" +
+		"MOTD=\"line one\nline two\"\n" +
+		"EMPTY=\n" +
+		"not a variable\n" +
+		"PORT=8080"
+
+	assert.Equal(t, map[string]string{
+		"DOMAIN":         "cloud.home",
+		"ADMIN_PASSWORD": `p@ss "word" \ end`,
+		"MOTD":           "line one\nline two",
+		"EMPTY":          "",
+		"PORT":           "8080",
+	}, parseEnvFile(content))
+
+	// Values round-trip through the builder's escaping
+	builder := &EnvironmentBuilder{}
+	vars := map[string]string{"A": "plain", "B": "with space", "C": `quote " and \ slash`, "D": "$HOME"}
+	assert.Equal(t, vars, parseEnvFile(builder.buildEnvFileContent(vars)))
+}
+
+func TestMergeDeploymentConfig(t *testing.T) {
+	stored := map[string]interface{}{
+		"domain":         "old.home",
+		"port":           float64(8080),
+		"admin_password": redactedConfigValue,
+		"smtp_password":  redactedConfigValue,
+		"timezone":       "UTC",
+	}
+	updates := map[string]interface{}{
+		"domain":   "new.home",
+		"timezone": nil,
+		"language": "en",
+	}
+	deployed := map[string]string{"ADMIN_PASSWORD": "hunter22", "DOMAIN": "old.home"}
+
+	assert.Equal(t, map[string]interface{}{
+		"domain":         "new.home",
+		"port":           float64(8080),
+		"admin_password": "hunter22",
+		"language":       "en",
+	}, mergeDeploymentConfig(stored, updates, deployed), "redacted values come from the deployed env, or are dropped")
+
+	merged := mergeDeploymentConfig(stored, map[string]interface{}{"admin_password": "n3w-Passw0rd!"}, deployed)
+	assert.Equal(t, "n3w-Passw0rd!", merged["admin_password"])
+	assert.Equal(t, "UTC", merged["timezone"])
+}
+
+func TestDiffEnvVars(t *testing.T) {
+	recipe := &models.Recipe{ConfigOptions: []models.RecipeConfigOption{{Name: "encryption_seed", Type: "secret"}}}
+	oldVars := map[string]string{
+		"DOMAIN":               "old.home",
+		"DB_PASSWORD":          "a",
+		"ENCRYPTION_SEED":      "s1",
+		"TIMEZONE":             "UTC",
+		"DB_CONNECTION_STRING": "postgres://app:a@db:5432/app",
+	}
+	newVars := map[string]string{
+		"DOMAIN":               "new.home",
+		"DB_PASSWORD":          "a",
+		"ENCRYPTION_SEED":      "s2",
+		"LANGUAGE":             "en",
+		"DB_CONNECTION_STRING": "postgres://app:b@db:5432/app",
+	}
+
+	changes := diffEnvVars(oldVars, newVars, sensitiveEnvKeys(recipe, oldVars, newVars))
+	assert.Equal(t, []EnvVarChange{
+		{Key: "DB_CONNECTION_STRING", Change: "changed", Old: maskedEnvValue, New: maskedEnvValue},
+		{Key: "DOMAIN", Change: "changed", Old: "old.home", New: "new.home"},
+		{Key: "ENCRYPTION_SEED", Change: "changed", Old: maskedEnvValue, New: maskedEnvValue},
+		{Key: "LANGUAGE", Change: "added", New: "en"},
+		{Key: "TIMEZONE", Change: "removed", Old: "UTC"},
+	}, changes)
+
+	assert.Empty(t, diffEnvVars(oldVars, oldVars, nil))
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.Empty(t, unifiedDiff("a\nb", "a\nb"))
+
+	oldCompose := "services:\n  web:\n    image: app\n    ports:\n      - \"8080:80\"\n    environment:\n      - DOMAIN=old.home\n    restart: unless-stopped"
+	newCompose := "services:\n  web:\n    image: app\n    ports:\n      - \"9090:80\"\n    environment:\n      - DOMAIN=old.home\n    restart: unless-stopped"
+
+	assert.Equal(t, "--- docker-compose.yml (current)\n+++ docker-compose.yml (updated)\n"+
+		"@@ -2,7 +2,7 @@\n"+
+		"   web:\n"+
+		"     image: app\n"+
+		"     ports:\n"+
+		"-      - \"8080:80\"\n"+
+		"+      - \"9090:80\"\n"+
+		"     environment:\n"+
+		"       - DOMAIN=old.home\n"+
+		"     restart: unless-stopped\n",
+		unifiedDiff(oldCompose, newCompose))
+
+	// Changes far apart produce separate hunks
+	oldText := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"
+	newText := "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve"
+	diff := unifiedDiff(oldText, newText)
+	assert.Contains(t, diff, "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n")
+	assert.Contains(t, diff, "@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n")
+}
+
+func TestSubtractPortSpecs(t *testing.T) {
+	oldPorts := []PortSpec{{Port: 8080, Protocol: "tcp"}, {Port: 53, Protocol: "udp"}}
+	newPorts := []PortSpec{{Port: 9090, Protocol: "tcp"}, {Port: 53, Protocol: "udp"}}
+
+	assert.Equal(t, []PortSpec{{Port: 9090, Protocol: "tcp"}}, subtractPortSpecs(newPorts, oldPorts))
+	assert.Equal(t, []string{"8080/tcp"}, portSpecStrings(subtractPortSpecs(oldPorts, newPorts)))
+	assert.Empty(t, subtractPortSpecs(oldPorts, oldPorts))
+}
+
+func TestUpdateDeploymentConfig_Validation(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	deviceService := NewDeviceService(db, credService, nil)
+	mockRecipeLoader := NewMockRecipeLoader(map[string]*models.Recipe{
+		"nextcloud": {Slug: "nextcloud", Name: "Nextcloud"},
+	})
+	deploymentService := NewDeploymentService(db, nil, mockRecipeLoader, deviceService, credService, nil, nil, nil)
+
+	_, err := deploymentService.UpdateDeploymentConfig("not-a-uuid", UpdateDeploymentConfigRequest{Config: map[string]interface{}{"port": 8080}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deployment not found")
+
+	deployment := models.Deployment{RecipeSlug: "nextcloud", DeviceID: uuid.New(), ComposeProject: "nextcloud-abc123", Status: models.DeploymentStatusDeploying}
+	require.NoError(t, db.Create(&deployment).Error)
+
+	// In-progress deployments cannot be changed
+	_, err = deploymentService.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{Config: map[string]interface{}{"port": 8080}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be changed")
+
+	require.NoError(t, db.Model(&deployment).Update("status", models.DeploymentStatusRunning).Error)
+
+	_, err = deploymentService.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config or compose is required")
+
+	_, err = deploymentService.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{
+		Compose: "services:\n  web:\n    image: nginx\n",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only custom deployments")
+
+	// Keys become environment variable names, so they are checked before anything runs
+	_, err = deploymentService.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{
+		Config: map[string]interface{}{"bad-key; reboot": "x"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid config key")
+
+	_, err = deploymentService.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{Config: map[string]interface{}{"port": 8080}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get device")
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// maxCustomComposeSize limits the size of a user-supplied compose file
+const maxCustomComposeSize = 512 * 1024
+
+// maxCustomNameLength limits the display name of a custom deployment
+const maxCustomNameLength = 100
+
+// platformEnvVars are set on every deployment by the environment builder
+var platformEnvVars = map[string]bool{
+	"DEPLOYMENT_ID":   true,
+	"COMPOSE_PROJECT": true,
+	"DEVICE_IP":       true,
+}
+
+// heredocTerminatorRegex matches a line that would end the heredoc deployment files are written with
+var heredocTerminatorRegex = regexp.MustCompile(`(?m)^EOF\r?$`)
+
+// CreateCustomDeploymentRequest deploys a compose file that isn't a marketplace recipe
+type CreateCustomDeploymentRequest struct {
+	Name           string            `json:"name"`
+	DeviceID       uuid.UUID         `json:"device_id"`
+	Compose        string            `json:"compose"`
+	Environment    map[string]string `json:"environment,omitempty"`     // Written to the deployment's .env
+	ComposeProject string            `json:"compose_project,omitempty"` // Optional - derived from the name if empty
+	ProxyOptions
+}
+
+// CreateCustomDeployment deploys a user-supplied compose file and environment
+// It runs through the same pipeline as a recipe deployment: ports published by the compose file are opened
+// on the firewall, the containers are health checked and a failed deployment is cleaned up.
+// The environment is stored as the deployment's config, so it can be edited like recipe options
+func (s *DeploymentService) CreateCustomDeployment(req CreateCustomDeploymentRequest) (*models.Deployment, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(name) > maxCustomNameLength {
+		return nil, fmt.Errorf("name must be at most %d characters", maxCustomNameLength)
+	}
+	if req.DeviceID == uuid.Nil {
+		return nil, fmt.Errorf("device_id is required")
+	}
+	if err := validateCustomCompose(req.Compose); err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]interface{}, len(req.Environment))
+	for key, value := range req.Environment {
+		if err := validateCustomEnvName(key); err != nil {
+			return nil, err
+		}
+		if !isValidEnvVarValue(value) {
+			return nil, fmt.Errorf("invalid value for environment variable %s", key)
+		}
+		config[key] = value
+	}
+
+	composeProject := req.ComposeProject
+	if composeProject == "" {
+		composeProject = s.generateProjectName(sanitizeProjectName(name))
+	} else if err := s.validateComposeProject(composeProject); err != nil {
+		return nil, err
+	}
+
+	device, err := s.deviceService.GetDevice(req.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("device not found: %w", err)
+	}
+
+	configJSON, err := json.Marshal(s.sanitizeConfig(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	deployment := &models.Deployment{
+		ID:               uuid.New(),
+		Source:           models.DeploymentSourceCustom,
+		RecipeName:       name,
+		DeviceID:         req.DeviceID,
+		Status:           models.DeploymentStatusValidating,
+		Config:           configJSON,
+		ComposeProject:   composeProject,
+		GeneratedCompose: req.Compose,
+	}
+	if err := s.applyProxyOptions(deployment, req.ProxyOptions, nil); err != nil {
+		return nil, err
+	}
+
+	// The user chose the compose file's ports, so a port that is taken is an error rather than reassigned
+	env := s.environmentBuilder.PreviewEnvironment(deployment, customRecipe(deployment), config, device, nil, maskedEnvValue)
+	if err := s.ports.AllocateDeploymentPorts(device, deployment.ID, ExtractPortsFromCompose(interpolateComposeVars(req.Compose, env))); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(deployment).Error; err != nil {
+		s.releasePorts(deployment)
+		return nil, fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	// As with recipes, the unsanitized environment is kept with the job for the deploy
+	job := &models.DeploymentJob{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentJobDeploy,
+		DeviceID:     req.DeviceID,
+	}
+	if err := s.jobQueue.Enqueue(job, config); err != nil {
+		s.releasePorts(deployment)
+		s.updateStatus(deployment, models.DeploymentStatusFailed, err.Error())
+		return nil, err
+	}
+
+	return deployment, nil
+}
+
+// recipeFor returns the recipe a deployment runs from
+func (s *DeploymentService) recipeFor(deployment *models.Deployment) (*models.Recipe, error) {
+	if deployment.IsCustom() {
+		return customRecipe(deployment), nil
+	}
+	return s.recipeLoader.GetRecipe(deployment.RecipeSlug)
+}
+
+// customRecipe stands in for the recipe of a custom deployment
+// It has no config options, database, dependencies or post-install steps, so only the containers are health checked
+func customRecipe(deployment *models.Deployment) *models.Recipe {
+	return &models.Recipe{
+		Name:           deployment.RecipeName,
+		ComposeContent: deployment.GeneratedCompose,
+	}
+}
+
+// validateCustomCompose checks that a user-supplied compose file can be deployed
+// Services must run prebuilt images: only the compose file and .env are copied to the device
+func validateCustomCompose(compose string) error {
+	if strings.TrimSpace(compose) == "" {
+		return fmt.Errorf("compose is required")
+	}
+	if len(compose) > maxCustomComposeSize {
+		return fmt.Errorf("compose file must be at most %d KB", maxCustomComposeSize/1024)
+	}
+	if heredocTerminatorRegex.MatchString(compose) {
+		return fmt.Errorf("compose file must not contain a line consisting of EOF")
+	}
+
+	var file struct {
+		Services map[string]struct {
+			Image string      `yaml:"image"`
+			Build interface{} `yaml:"build"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal([]byte(compose), &file); err != nil {
+		return fmt.Errorf("invalid compose file: %w", err)
+	}
+	if len(file.Services) == 0 {
+		return fmt.Errorf("compose file must define at least one service")
+	}
+
+	names := make([]string, 0, len(file.Services))
+	for name := range file.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		service := file.Services[name]
+		if service.Build != nil {
+			return fmt.Errorf("service %s uses build: custom deployments can only run prebuilt images", name)
+		}
+		if strings.TrimSpace(service.Image) == "" {
+			return fmt.Errorf("service %s has no image", name)
+		}
+	}
+	return nil
+}
+
+// validateCustomEnvName checks a custom deployment's environment variable name
+// Names are used as-is in the .env, so they must already be upper case (see toEnvVarName)
+func validateCustomEnvName(name string) error {
+	if !isValidEnvVarName(name) {
+		return fmt.Errorf("invalid environment variable name: %s", name)
+	}
+	if name != toEnvVarName(name) {
+		return fmt.Errorf("environment variable %s must be upper case", name)
+	}
+	if platformEnvVars[name] {
+		return fmt.Errorf("environment variable %s is set by the platform", name)
+	}
+	return nil
+}
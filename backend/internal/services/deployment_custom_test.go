@@ -0,0 +1,143 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const customTestCompose = `services:
+  web:
+    image: ghcr.io/paperless-ngx/paperless-ngx:latest
+    ports:
+      - "8000:8000"
+    env_file: .env
+  redis:
+    image: redis:7
+`
+
+func TestValidateCustomCompose(t *testing.T) {
+	require.NoError(t, validateCustomCompose(customTestCompose))
+
+	tests := []struct {
+		name    string
+		compose string
+		err     string
+	}{
+		{"empty", "  \n", "compose is required"},
+		{"not yaml", "services: [", "invalid compose file"},
+		{"no services", "volumes:\n  data: {}\n", "at least one service"},
+		{"build", "services:\n  app:\n    build: .\n", "service app uses build"},
+		{"no image", "services:\n  app:\n    ports:\n      - \"80:80\"\n", "service app has no image"},
+		{"heredoc terminator", "services:\n  app:\n    image: nginx\nEOF\n", "EOF"},
+		{"too large", "services:\n  app:\n    image: nginx\n#" + strings.Repeat("x", maxCustomComposeSize), "at most"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCustomCompose(tt.compose)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestValidateCustomEnvName(t *testing.T) {
+	assert.NoError(t, validateCustomEnvName("PAPERLESS_SECRET_KEY"))
+	assert.ErrorContains(t, validateCustomEnvName("bad name"), "invalid environment variable name")
+	assert.ErrorContains(t, validateCustomEnvName("paperless_port"), "must be upper case")
+	assert.ErrorContains(t, validateCustomEnvName("DEVICE_IP"), "set by the platform")
+}
+
+func TestCreateCustomDeployment(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.10"}
+	require.NoError(t, db.Create(device).Error)
+
+	_, err := service.CreateCustomDeployment(CreateCustomDeploymentRequest{Name: "Paperless", DeviceID: uuid.New(), Compose: customTestCompose})
+	assert.ErrorContains(t, err, "device not found")
+
+	_, err = service.CreateCustomDeployment(CreateCustomDeploymentRequest{
+		Name: "Paperless", DeviceID: device.ID, Compose: customTestCompose,
+		Environment: map[string]string{"lowercase": "x"},
+	})
+	assert.ErrorContains(t, err, "must be upper case")
+
+	deployment, err := service.CreateCustomDeployment(CreateCustomDeploymentRequest{
+		Name:     "My Paperless",
+		DeviceID: device.ID,
+		Compose:  customTestCompose,
+		Environment: map[string]string{
+			"PAPERLESS_URL":        "https://docs.example.com",
+			"PAPERLESS_SECRET_KEY": "hunter22",
+		},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, deployment.IsCustom())
+	assert.Empty(t, deployment.RecipeSlug)
+	assert.Equal(t, "My Paperless", deployment.RecipeName)
+	assert.True(t, strings.HasPrefix(deployment.ComposeProject, "my-paperless-"))
+	assert.Equal(t, customTestCompose, deployment.GeneratedCompose)
+	assert.Contains(t, string(deployment.Config), `"PAPERLESS_SECRET_KEY":"[REDACTED]"`)
+
+	// The deploy job keeps the unsanitized environment
+	job, err := service.GetActiveJob(deployment.ID.String())
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, models.DeploymentJobDeploy, job.Type)
+	var config map[string]interface{}
+	require.NoError(t, service.jobQueue.LoadParams(job, &config))
+	assert.Equal(t, "hunter22", config["PAPERLESS_SECRET_KEY"])
+
+	// The compose file stands in for the recipe
+	recipe, err := service.recipeFor(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, customTestCompose, recipe.ComposeContent)
+	assert.Empty(t, recipe.ConfigOptions)
+
+	// The compose project must be unique
+	_, err = service.CreateCustomDeployment(CreateCustomDeploymentRequest{
+		Name: "Paperless", DeviceID: device.ID, Compose: customTestCompose, ComposeProject: deployment.ComposeProject,
+	})
+	assert.ErrorContains(t, err, "already in use")
+}
+
+func TestUpdateDeploymentConfig_CustomValidation(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	deployment := &models.Deployment{
+		Source:           models.DeploymentSourceCustom,
+		RecipeName:       "Paperless",
+		DeviceID:         uuid.New(),
+		ComposeProject:   "paperless-abc123",
+		GeneratedCompose: customTestCompose,
+		Status:           models.DeploymentStatusRunning,
+	}
+	require.NoError(t, db.Create(deployment).Error)
+
+	_, err := service.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{
+		Config: map[string]interface{}{"paperless_url": "x"},
+	})
+	assert.ErrorContains(t, err, "must be upper case")
+
+	_, err = service.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{
+		Compose: "services:\n  web:\n    build: .\n",
+	})
+	assert.ErrorContains(t, err, "uses build")
+
+	// Valid changes get as far as the device, without needing a marketplace recipe
+	_, err = service.UpdateDeploymentConfig(deployment.ID.String(), UpdateDeploymentConfigRequest{
+		Config:  map[string]interface{}{"PAPERLESS_URL": "https://docs.example.com"},
+		Compose: customTestCompose,
+	})
+	assert.ErrorContains(t, err, "failed to get device")
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxErrorCodeLength bounds error codes derived from error messages
+const maxErrorCodeLength = 64
+
+const (
+	eventRetention            = 90 * 24 * time.Hour // Events older than this are pruned
+	maxLogEventsPerDeployment = 1000                // Only the newest log events of a deployment are kept
+)
+
+// errorCodeSeparatorRegex matches runs of characters that are not allowed in an error code
+var errorCodeSeparatorRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// failedStatuses end a deployment operation unsuccessfully
+var failedStatuses = map[models.DeploymentStatus]bool{
+	models.DeploymentStatusFailed:     true,
+	models.DeploymentStatusRolledBack: true,
+}
+
+// DeploymentEventFilter narrows a deployment's event history
+type DeploymentEventFilter struct {
+	Type     models.DeploymentEventType
+	Severity models.DeploymentEventSeverity
+}
+
+// DeploymentEventPage is one page of a deployment's events, oldest first
+type DeploymentEventPage struct {
+	Events []models.DeploymentEvent `json:"events"`
+	Total  int64                    `json:"total"`
+	Limit  int                      `json:"limit"`
+	Offset int                      `json:"offset"`
+}
+
+// DurationStats summarises how long a phase or step took across deployments
+type DurationStats struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Failures int    `json:"failures"`
+	AvgMS    int64  `json:"avg_ms"`
+	P50MS    int64  `json:"p50_ms"`
+	P95MS    int64  `json:"p95_ms"`
+	MaxMS    int64  `json:"max_ms"`
+}
+
+// FailureCluster groups failures that happened in the same phase and step with the same error code
+type FailureCluster struct {
+	Phase       models.DeploymentStatus `json:"phase"`
+	Step        string                  `json:"step,omitempty"`
+	ErrorCode   string                  `json:"error_code"`
+	Count       int                     `json:"count"`
+	Deployments int                     `json:"deployments"` // Distinct deployments affected
+	LastSeen    time.Time               `json:"last_seen"`
+	Example     string                  `json:"example"`
+}
+
+// DeploymentEventStats reports phase and step durations and failure clusters across all deployments
+type DeploymentEventStats struct {
+	Since    time.Time        `json:"since"`
+	Phases   []DurationStats  `json:"phases"`   // Time spent in each deployment status
+	Steps    []DurationStats  `json:"steps"`    // Time taken by each named step
+	Failures []FailureCluster `json:"failures"` // Most frequent first
+}
+
+// openStep is a step that has started but not yet finished
+type openStep struct {
+	name    string
+	phase   models.DeploymentStatus
+	started time.Time
+}
+
+// DeploymentEventService records each deployment's history as structured events
+// Events are stored in the deployment_events table and broadcast on the "deployments" WebSocket channel.
+// Old events and a deployment's excess log events are pruned; a deployment's events are deleted with it.
+type DeploymentEventService struct {
+	db           *gorm.DB
+	wsHub        WSHub
+	steps        sync.Map // Deployment ID -> *openStep
+	retention    time.Duration
+	maxLogEvents int
+	lastPrune    time.Time
+	mu           sync.Mutex
+}
+
+// NewDeploymentEventService creates a new deployment event service
+func NewDeploymentEventService(db *gorm.DB, wsHub WSHub) *DeploymentEventService {
+	return &DeploymentEventService{
+		db:           db,
+		wsHub:        wsHub,
+		retention:    eventRetention,
+		maxLogEvents: maxLogEventsPerDeployment,
+	}
+}
+
+// Record stores an event and broadcasts it
+// Failures are logged rather than returned so history never blocks a deployment
+func (s *DeploymentEventService) Record(event *models.DeploymentEvent) {
+	if event.Severity == "" {
+		event.Severity = models.DeploymentEventInfo
+	}
+	if err := s.db.Create(event).Error; err != nil {
+		log.Printf("[DeploymentEvents] Failed to record %s event for %s: %v", event.Type, event.DeploymentID, err)
+		return
+	}
+	s.prune()
+
+	// Log lines already go out as deployment:log
+	if s.wsHub != nil && event.Type != models.DeploymentEventLog {
+		s.wsHub.Broadcast("deployments", "deployment:event", event)
+	}
+}
+
+// prune deletes events older than the retention window and all but the newest log events of each deployment,
+// at most once an hour
+func (s *DeploymentEventService) prune() {
+	s.mu.Lock()
+	if time.Since(s.lastPrune) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = time.Now()
+	s.mu.Unlock()
+
+	cutoff := time.Now().Add(-s.retention)
+	result := s.db.Where("created_at < ?", cutoff).Delete(&models.DeploymentEvent{})
+	if result.Error != nil {
+		log.Printf("[DeploymentEvents] Failed to prune events: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[DeploymentEvents] Pruned %d events older than %s", result.RowsAffected, cutoff.Format(time.RFC3339))
+	}
+
+	var deploymentIDs []uuid.UUID
+	if err := s.db.Model(&models.DeploymentEvent{}).Where("type = ?", models.DeploymentEventLog).
+		Group("deployment_id").Having("COUNT(*) > ?", s.maxLogEvents).Pluck("deployment_id", &deploymentIDs).Error; err != nil {
+		log.Printf("[DeploymentEvents] Failed to find deployments with excess log events: %v", err)
+		return
+	}
+	for _, id := range deploymentIDs {
+		newest := s.db.Model(&models.DeploymentEvent{}).Select("id").
+			Where("deployment_id = ? AND type = ?", id, models.DeploymentEventLog).
+			Order("created_at DESC").Limit(s.maxLogEvents)
+		result := s.db.Where("deployment_id = ? AND type = ? AND id NOT IN (?)", id, models.DeploymentEventLog, newest).
+			Delete(&models.DeploymentEvent{})
+		if result.Error != nil {
+			log.Printf("[DeploymentEvents] Failed to prune log events of %s: %v", id, result.Error)
+		} else {
+			log.Printf("[DeploymentEvents] Pruned %d log events of %s", result.RowsAffected, id)
+		}
+	}
+}
+
+// DeleteForDeployment deletes a deployment's events and forgets its open step
+func (s *DeploymentEventService) DeleteForDeployment(deploymentID uuid.UUID) error {
+	s.steps.Delete(deploymentID)
+	return s.db.Where("deployment_id = ?", deploymentID).Delete(&models.DeploymentEvent{}).Error
+}
+
+// RecordLog records a deployment log line; severity follows the ❌ and ⚠️ markers used in log messages
+func (s *DeploymentEventService) RecordLog(deployment *models.Deployment, message string) {
+	s.Record(&models.DeploymentEvent{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentEventLog,
+		Severity:     logSeverity(message),
+		Phase:        deployment.Status,
+		Message:      message,
+	})
+}
+
+// RecordStatusChange records a deployment moving from one status to its current status
+// The event carries the time spent in the previous status. Reaching a final status finishes
+// the open step, which is attached to the event when the deployment failed.
+func (s *DeploymentEventService) RecordStatusChange(deployment *models.Deployment, from models.DeploymentStatus, errorDetails string) {
+	to := deployment.Status
+	if from == to && errorDetails == "" {
+		return
+	}
+
+	event := &models.DeploymentEvent{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentEventStatus,
+		Severity:     models.DeploymentEventInfo,
+		Phase:        from,
+		FromStatus:   from,
+		ToStatus:     to,
+		Message:      fmt.Sprintf("Status changed from %s to %s", from, to),
+	}
+
+	since := deployment.CreatedAt
+	var previous models.DeploymentEvent
+	if err := s.db.Where("deployment_id = ? AND type = ?", deployment.ID, models.DeploymentEventStatus).
+		Order("created_at DESC").First(&previous).Error; err == nil {
+		since = previous.CreatedAt
+	}
+	if !since.IsZero() {
+		duration := time.Since(since).Milliseconds()
+		event.DurationMS = &duration
+	}
+
+	switch {
+	case failedStatuses[to]:
+		event.Severity = models.DeploymentEventError
+		event.Step = s.EndStep(deployment, errorDetails)
+		event.ErrorCode = errorCode(errorDetails)
+		event.ErrorMessage = errorDetails
+	case to == models.DeploymentStatusRunning || to == models.DeploymentStatusStopped:
+		s.EndStep(deployment, "")
+	case errorDetails != "":
+		event.Severity = models.DeploymentEventWarning
+		event.ErrorCode = errorCode(errorDetails)
+		event.ErrorMessage = errorDetails
+	}
+
+	s.Record(event)
+}
+
+// BeginStep starts timing a named step, finishing the deployment's previous step successfully
+func (s *DeploymentEventService) BeginStep(deployment *models.Deployment, step string) {
+	s.EndStep(deployment, "")
+	s.steps.Store(deployment.ID, &openStep{name: step, phase: deployment.Status, started: time.Now()})
+}
+
+// EndStep finishes the deployment's open step and returns its name ("" if no step was open)
+// A non-empty errMsg records the step as failed
+func (s *DeploymentEventService) EndStep(deployment *models.Deployment, errMsg string) string {
+	value, ok := s.steps.LoadAndDelete(deployment.ID)
+	if !ok {
+		return ""
+	}
+	step := value.(*openStep)
+
+	duration := time.Since(step.started).Milliseconds()
+	event := &models.DeploymentEvent{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentEventStep,
+		Severity:     models.DeploymentEventInfo,
+		Phase:        step.phase,
+		Step:         step.name,
+		DurationMS:   &duration,
+		Message:      fmt.Sprintf("Step %s completed", step.name),
+	}
+	if errMsg != "" {
+		event.Severity = models.DeploymentEventError
+		event.Message = fmt.Sprintf("Step %s failed", step.name)
+		event.ErrorCode = errorCode(errMsg)
+		event.ErrorMessage = errMsg
+	}
+	s.Record(event)
+	return step.name
+}
+
+// ListEvents returns a page of a deployment's events, oldest first
+func (s *DeploymentEventService) ListEvents(deploymentID uuid.UUID, filter DeploymentEventFilter, limit, offset int) (*DeploymentEventPage, error) {
+	query := s.db.Model(&models.DeploymentEvent{}).Where("deployment_id = ?", deploymentID)
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+
+	page := &DeploymentEventPage{Limit: limit, Offset: offset}
+	if err := query.Count(&page.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count events: %w", err)
+	}
+	if err := query.Order("created_at ASC").Limit(limit).Offset(offset).Find(&page.Events).Error; err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	return page, nil
+}
+
+// GetStats aggregates status and step events since the given time across all deployments
+func (s *DeploymentEventService) GetStats(since time.Time) (*DeploymentEventStats, error) {
+	var events []models.DeploymentEvent
+	if err := s.db.Where("created_at >= ? AND type IN ?", since,
+		[]models.DeploymentEventType{models.DeploymentEventStatus, models.DeploymentEventStep}).
+		Order("created_at ASC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+
+	phaseDurations := map[string][]int64{}
+	phaseFailures := map[string]int{}
+	stepDurations := map[string][]int64{}
+	stepFailures := map[string]int{}
+	clusters := map[string]*FailureCluster{}
+	clusterDeployments := map[string]map[uuid.UUID]bool{}
+
+	for _, event := range events {
+		switch event.Type {
+		case models.DeploymentEventStatus:
+			phase := string(event.FromStatus)
+			if event.DurationMS != nil {
+				phaseDurations[phase] = append(phaseDurations[phase], *event.DurationMS)
+			}
+			if !failedStatuses[event.ToStatus] {
+				continue
+			}
+			phaseFailures[phase]++
+
+			key := strings.Join([]string{phase, event.Step, event.ErrorCode}, "\x00")
+			cluster, ok := clusters[key]
+			if !ok {
+				cluster = &FailureCluster{Phase: event.FromStatus, Step: event.Step, ErrorCode: event.ErrorCode}
+				clusters[key] = cluster
+				clusterDeployments[key] = map[uuid.UUID]bool{}
+			}
+			cluster.Count++
+			cluster.LastSeen = event.CreatedAt
+			cluster.Example = event.ErrorMessage
+			clusterDeployments[key][event.DeploymentID] = true
+
+		case models.DeploymentEventStep:
+			if event.DurationMS != nil {
+				stepDurations[event.Step] = append(stepDurations[event.Step], *event.DurationMS)
+			}
+			if event.Severity == models.DeploymentEventError {
+				stepFailures[event.Step]++
+			}
+		}
+	}
+
+	stats := &DeploymentEventStats{
+		Since:    since,
+		Phases:   summarizeDurations(phaseDurations, phaseFailures),
+		Steps:    summarizeDurations(stepDurations, stepFailures),
+		Failures: make([]FailureCluster, 0, len(clusters)),
+	}
+	for key, cluster := range clusters {
+		cluster.Deployments = len(clusterDeployments[key])
+		stats.Failures = append(stats.Failures, *cluster)
+	}
+	sort.Slice(stats.Failures, func(i, j int) bool {
+		if stats.Failures[i].Count != stats.Failures[j].Count {
+			return stats.Failures[i].Count > stats.Failures[j].Count
+		}
+		return stats.Failures[i].LastSeen.After(stats.Failures[j].LastSeen)
+	})
+	return stats, nil
+}
+
+// summarizeDurations builds duration stats per name, sorted by name
+func summarizeDurations(durations map[string][]int64, failures map[string]int) []DurationStats {
+	names := make(map[string]bool, len(durations))
+	for name := range durations {
+		names[name] = true
+	}
+	for name := range failures {
+		names[name] = true
+	}
+
+	result := make([]DurationStats, 0, len(names))
+	for name := range names {
+		values := durations[name]
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+		entry := DurationStats{Name: name, Count: len(values), Failures: failures[name]}
+		if len(values) > 0 {
+			var total int64
+			for _, v := range values {
+				total += v
+			}
+			entry.AvgMS = total / int64(len(values))
+			entry.P50MS = percentile(values, 50)
+			entry.P95MS = percentile(values, 95)
+			entry.MaxMS = values[len(values)-1]
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// errorCode derives a stable code from an error message so similar failures group together
+// The text before the first colon is used, e.g. "Health check failed: timeout" -> "health_check_failed"
+func errorCode(message string) string {
+	if message == "" {
+		return ""
+	}
+	prefix, _, _ := strings.Cut(message, ":")
+	code := strings.Trim(errorCodeSeparatorRegex.ReplaceAllString(strings.ToLower(prefix), "_"), "_")
+	if len(code) > maxErrorCodeLength {
+		code = strings.TrimRight(code[:maxErrorCodeLength], "_")
+	}
+	if code == "" {
+		return "unknown"
+	}
+	return code
+}
+
+// logSeverity infers a log line's severity from its status marker
+func logSeverity(message string) models.DeploymentEventSeverity {
+	switch {
+	case strings.Contains(message, "❌"):
+		return models.DeploymentEventError
+	case strings.Contains(message, "⚠️"):
+		return models.DeploymentEventWarning
+	default:
+		return models.DeploymentEventInfo
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, "health_check_failed", errorCode("Health check failed: container web exited (1)"))
+	assert.Equal(t, "failed_to_provision_database", errorCode("Failed to provision database: connection refused"))
+	assert.Equal(t, "deployment_was_cancelled", errorCode("Deployment was cancelled"))
+	assert.Equal(t, "unknown", errorCode("❌: boom"))
+	assert.Empty(t, errorCode(""))
+	assert.LessOrEqual(t, len(errorCode(strings.Repeat("failed ", 20)+": detail")), maxErrorCodeLength)
+}
+
+func TestLogSeverity(t *testing.T) {
+	assert.Equal(t, models.DeploymentEventError, logSeverity("❌ Deployment failed: exit 1"))
+	assert.Equal(t, models.DeploymentEventWarning, logSeverity("⚠️  Could not check firewall"))
+	assert.Equal(t, models.DeploymentEventInfo, logSeverity("✓ Containers deployed successfully"))
+}
+
+func TestDeploymentEvents_RecordedByDeploymentService(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	hub := &recordingHub{}
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, hub, nil, nil)
+
+	deployment := &models.Deployment{RecipeSlug: "wiki-js", DeviceID: uuid.New(), ComposeProject: "wiki-js-1", Status: models.DeploymentStatusValidating}
+	require.NoError(t, db.Create(deployment).Error)
+
+	service.updateStatus(deployment, models.DeploymentStatusPreparing, "")
+	service.beginStep(deployment, "database")
+	service.appendLog(deployment, "⚠️  Using a new shared instance")
+	service.beginStep(deployment, "health_check")
+	service.updateStatus(deployment, models.DeploymentStatusFailed, "Health check failed: container exited")
+
+	page, err := service.Events().ListEvents(deployment.ID, DeploymentEventFilter{}, 100, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(page.Events), page.Total)
+
+	statusPage, err := service.Events().ListEvents(deployment.ID, DeploymentEventFilter{Type: models.DeploymentEventStatus}, 100, 0)
+	require.NoError(t, err)
+	require.Len(t, statusPage.Events, 2)
+	assert.Equal(t, models.DeploymentStatusValidating, statusPage.Events[0].FromStatus)
+	assert.Equal(t, models.DeploymentStatusPreparing, statusPage.Events[0].ToStatus)
+	require.NotNil(t, statusPage.Events[0].DurationMS)
+
+	failed := statusPage.Events[1]
+	assert.Equal(t, models.DeploymentEventError, failed.Severity)
+	assert.Equal(t, models.DeploymentStatusPreparing, failed.Phase)
+	assert.Equal(t, "health_check", failed.Step, "the failing step is attached to the status event")
+	assert.Equal(t, "health_check_failed", failed.ErrorCode)
+	assert.Equal(t, "Health check failed: container exited", failed.ErrorMessage)
+
+	steps, err := service.Events().ListEvents(deployment.ID, DeploymentEventFilter{Type: models.DeploymentEventStep}, 100, 0)
+	require.NoError(t, err)
+	require.Len(t, steps.Events, 2)
+	assert.Equal(t, "database", steps.Events[0].Step)
+	assert.Equal(t, models.DeploymentEventInfo, steps.Events[0].Severity)
+	assert.Equal(t, "health_check", steps.Events[1].Step)
+	assert.Equal(t, models.DeploymentEventError, steps.Events[1].Severity)
+
+	warnings, err := service.Events().ListEvents(deployment.ID, DeploymentEventFilter{Severity: models.DeploymentEventWarning}, 100, 0)
+	require.NoError(t, err)
+	require.Len(t, warnings.Events, 1)
+	assert.Equal(t, models.DeploymentEventLog, warnings.Events[0].Type)
+
+	// Paging
+	second, err := service.Events().ListEvents(deployment.ID, DeploymentEventFilter{}, 2, 2)
+	require.NoError(t, err)
+	require.Len(t, second.Events, 2)
+	assert.Equal(t, page.Events[2].ID, second.Events[0].ID)
+
+	assert.Contains(t, hub.events, "deployments:deployment:event")
+}
+
+func TestDeploymentEventService_GetStats(t *testing.T) {
+	db := setupTestDB(t)
+	events := NewDeploymentEventService(db, nil)
+
+	ms := func(v int64) *int64 { return &v }
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+	for _, event := range []models.DeploymentEvent{
+		{DeploymentID: first, Type: models.DeploymentEventStatus, FromStatus: models.DeploymentStatusPreparing, ToStatus: models.DeploymentStatusDeploying, DurationMS: ms(1000)},
+		{DeploymentID: second, Type: models.DeploymentEventStatus, FromStatus: models.DeploymentStatusPreparing, ToStatus: models.DeploymentStatusDeploying, DurationMS: ms(3000)},
+		{DeploymentID: third, Type: models.DeploymentEventStatus, FromStatus: models.DeploymentStatusPreparing, ToStatus: models.DeploymentStatusFailed, DurationMS: ms(2000),
+			Step: "database", ErrorCode: "failed_to_provision_database", ErrorMessage: "Failed to provision database: timeout"},
+		{DeploymentID: first, Type: models.DeploymentEventStatus, FromStatus: models.DeploymentStatusHealthCheck, ToStatus: models.DeploymentStatusFailed, DurationMS: ms(500),
+			Step: "health_check", ErrorCode: "health_check_failed", ErrorMessage: "Health check failed: a"},
+		{DeploymentID: second, Type: models.DeploymentEventStatus, FromStatus: models.DeploymentStatusHealthCheck, ToStatus: models.DeploymentStatusFailed, DurationMS: ms(700),
+			Step: "health_check", ErrorCode: "health_check_failed", ErrorMessage: "Health check failed: b"},
+		{DeploymentID: first, Type: models.DeploymentEventStep, Step: "database", DurationMS: ms(400)},
+		{DeploymentID: third, Type: models.DeploymentEventStep, Step: "database", Severity: models.DeploymentEventError, DurationMS: ms(1600)},
+		{DeploymentID: first, Type: models.DeploymentEventLog, Message: "ignored"},
+		{DeploymentID: third, Type: models.DeploymentEventStatus, FromStatus: models.DeploymentStatusRunning, ToStatus: models.DeploymentStatusFailed,
+			ErrorCode: "old", CreatedAt: now.Add(-48 * time.Hour)},
+	} {
+		events.Record(&event)
+	}
+
+	stats, err := events.GetStats(now.Add(-24 * time.Hour))
+	require.NoError(t, err)
+
+	assert.Equal(t, []DurationStats{
+		{Name: "health_check", Count: 2, Failures: 2, AvgMS: 600, P50MS: 500, P95MS: 700, MaxMS: 700},
+		{Name: "preparing", Count: 3, Failures: 1, AvgMS: 2000, P50MS: 2000, P95MS: 3000, MaxMS: 3000},
+	}, stats.Phases)
+	assert.Equal(t, []DurationStats{
+		{Name: "database", Count: 2, Failures: 1, AvgMS: 1000, P50MS: 400, P95MS: 1600, MaxMS: 1600},
+	}, stats.Steps)
+
+	require.Len(t, stats.Failures, 2)
+	assert.Equal(t, "health_check_failed", stats.Failures[0].ErrorCode)
+	assert.Equal(t, models.DeploymentStatusHealthCheck, stats.Failures[0].Phase)
+	assert.Equal(t, "health_check", stats.Failures[0].Step)
+	assert.Equal(t, 2, stats.Failures[0].Count)
+	assert.Equal(t, 2, stats.Failures[0].Deployments)
+	assert.Equal(t, "failed_to_provision_database", stats.Failures[1].ErrorCode)
+	assert.Equal(t, 1, stats.Failures[1].Count)
+}
+
+func TestDeploymentEventService_Prune(t *testing.T) {
+	db := setupTestDB(t)
+	hub := &recordingHub{}
+	events := NewDeploymentEventService(db, hub)
+	events.maxLogEvents = 3
+
+	deployment := &models.Deployment{ID: uuid.New(), Status: models.DeploymentStatusDeploying}
+	other := &models.Deployment{ID: uuid.New(), Status: models.DeploymentStatusRunning}
+
+	old := &models.DeploymentEvent{DeploymentID: other.ID, Type: models.DeploymentEventStatus, Severity: models.DeploymentEventInfo}
+	require.NoError(t, db.Create(old).Error)
+	require.NoError(t, db.Model(old).Update("created_at", time.Now().Add(-eventRetention-time.Hour)).Error)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Create(&models.DeploymentEvent{DeploymentID: deployment.ID, Type: models.DeploymentEventLog,
+			Severity: models.DeploymentEventInfo, Message: "line", CreatedAt: time.Now().Add(time.Duration(i-10) * time.Second)}).Error)
+	}
+
+	events.RecordLog(deployment, "newest line")
+	assert.Empty(t, hub.events, "log lines are broadcast as deployment:log only")
+
+	var logs []models.DeploymentEvent
+	require.NoError(t, db.Where("deployment_id = ?", deployment.ID).Order("created_at ASC").Find(&logs).Error)
+	require.Len(t, logs, 3, "only the newest log events are kept")
+	assert.Equal(t, "newest line", logs[2].Message)
+
+	var count int64
+	db.Model(&models.DeploymentEvent{}).Where("id = ?", old.ID).Count(&count)
+	assert.Zero(t, count, "events past the retention window are pruned")
+
+	events.RecordStatusChange(&models.Deployment{ID: other.ID, Status: models.DeploymentStatusStopped}, models.DeploymentStatusRunning, "")
+	assert.Contains(t, hub.events, "deployments:deployment:event")
+	require.NoError(t, events.DeleteForDeployment(other.ID))
+	db.Model(&models.DeploymentEvent{}).Where("deployment_id = ?", other.ID).Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,508 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+// Defaults for recipes that set a health endpoint but leave other fields empty
+const (
+	defaultHealthInterval  = 30 * time.Second
+	defaultHealthTimeout   = 10 * time.Second
+	defaultHealthThreshold = 3
+	minHealthInterval      = 10 * time.Second
+)
+
+// composeVarRegex matches ${VAR}, ${VAR:-default} and ${VAR-default} in compose files
+var composeVarRegex = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)(?:(:?-)([^}]*))?\}`)
+
+// monitoredStatuses are the deployment statuses probed by the health monitor
+var monitoredStatuses = []models.DeploymentStatus{
+	models.DeploymentStatusRunning,
+	models.DeploymentStatusUnhealthy,
+}
+
+// healthProbeConfig is a recipe's health config with defaults applied
+type healthProbeConfig struct {
+	endpoint      string
+	containerPort int // Port of the legacy health_check block, inside the container
+	interval      time.Duration
+	timeout       time.Duration
+	threshold     int
+}
+
+// DeploymentHealthSummary reports recent health history and uptime for a deployment
+type DeploymentHealthSummary struct {
+	DeploymentID   uuid.UUID                      `json:"deployment_id"`
+	Status         models.DeploymentStatus        `json:"status"`
+	HealthFailures int                            `json:"health_failures"`
+	Since          time.Time                      `json:"since"`
+	TotalChecks    int64                          `json:"total_checks"`
+	HealthyChecks  int64                          `json:"healthy_checks"`
+	UptimePercent  *float64                       `json:"uptime_percent,omitempty"` // Nil when no checks ran in the window
+	History        []models.DeploymentHealthCheck `json:"history"`                  // Most recent first
+}
+
+// DeploymentHealthMonitor continuously probes each running deployment's recipe health endpoint
+// Deployments that fail UnhealthyThreshold consecutive probes are marked "unhealthy"
+type DeploymentHealthMonitor struct {
+	db             *gorm.DB
+	recipeLoader   RecipeProvider
+	wsHub          WSHub
+	httpClient     *http.Client
+	tickInterval   time.Duration
+	retention      time.Duration
+	maxConcurrency int
+	nextCheck      map[uuid.UUID]time.Time
+	lastPrune      time.Time
+	mu             sync.Mutex
+	cancel         context.CancelFunc
+	events         *DeploymentEventService
+}
+
+// NewDeploymentHealthMonitor creates a new deployment health monitor
+func NewDeploymentHealthMonitor(db *gorm.DB, recipeLoader RecipeProvider, wsHub WSHub) *DeploymentHealthMonitor {
+	return &DeploymentHealthMonitor{
+		db:           db,
+		recipeLoader: recipeLoader,
+		wsHub:        wsHub,
+		httpClient: &http.Client{
+			// Any response means the app is serving; don't chase redirects to login pages or other hosts
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Transport: &http.Transport{
+				// Homelab apps commonly serve self-signed certificates; this is a liveness probe only
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		tickInterval:   5 * time.Second,    // Granularity for per-recipe intervals
+		retention:      7 * 24 * time.Hour, // Keep a week of history for uptime reporting
+		maxConcurrency: 10,
+		nextCheck:      make(map[uuid.UUID]time.Time),
+	}
+}
+
+// SetEventService records running/unhealthy transitions in the deployment event history
+func (m *DeploymentHealthMonitor) SetEventService(events *DeploymentEventService) {
+	m.events = events
+}
+
+// Start begins the background health probe loop
+func (m *DeploymentHealthMonitor) Start(ctx context.Context) {
+	log.Println("[HealthMonitor] Starting deployment health monitor")
+
+	ctx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+
+	ticker := time.NewTicker(m.tickInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Println("[HealthMonitor] Deployment health monitor stopped")
+				return
+			case <-ticker.C:
+				m.checkDue(ctx)
+				m.pruneHistory()
+			}
+		}
+	}()
+}
+
+// Stop stops the background health probe loop
+func (m *DeploymentHealthMonitor) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+// checkDue probes every monitored deployment whose interval has elapsed
+func (m *DeploymentHealthMonitor) checkDue(ctx context.Context) {
+	var deployments []models.Deployment
+	if err := m.db.Preload("Device").Where("status IN ?", monitoredStatuses).Find(&deployments).Error; err != nil {
+		log.Printf("[HealthMonitor] Error fetching deployments: %v", err)
+		return
+	}
+
+	now := time.Now()
+	type job struct {
+		deployment *models.Deployment
+		config     healthProbeConfig
+	}
+	var due []job
+
+	m.mu.Lock()
+	seen := make(map[uuid.UUID]bool, len(deployments))
+	for i := range deployments {
+		deployment := &deployments[i]
+		seen[deployment.ID] = true
+
+		config, ok := m.probeConfig(deployment.RecipeSlug)
+		if !ok || deployment.Device == nil {
+			continue
+		}
+		if next, scheduled := m.nextCheck[deployment.ID]; scheduled && now.Before(next) {
+			continue
+		}
+		m.nextCheck[deployment.ID] = now.Add(config.interval)
+		due = append(due, job{deployment: deployment, config: config})
+	}
+	// Forget deployments that were stopped or deleted so they are probed promptly when back
+	for id := range m.nextCheck {
+		if !seen[id] {
+			delete(m.nextCheck, id)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	jobs := make(chan job, len(due))
+	for _, j := range due {
+		jobs <- j
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	workers := m.maxConcurrency
+	if len(due) < workers {
+		workers = len(due)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				if _, err := m.checkDeployment(ctx, j.deployment, j.config); err != nil {
+					log.Printf("[HealthMonitor] Health check for %s failed to run: %v", j.deployment.ComposeProject, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// CheckDeployment probes a deployment once and records the result
+func (m *DeploymentHealthMonitor) CheckDeployment(ctx context.Context, deployment *models.Deployment) (*models.DeploymentHealthCheck, error) {
+	config, ok := m.probeConfig(deployment.RecipeSlug)
+	if !ok {
+		return nil, fmt.Errorf("recipe %s does not define a health endpoint", deployment.RecipeSlug)
+	}
+	return m.checkDeployment(ctx, deployment, config)
+}
+
+// checkDeployment probes the deployment's health URL and records the result
+func (m *DeploymentHealthMonitor) checkDeployment(ctx context.Context, deployment *models.Deployment, config healthProbeConfig) (*models.DeploymentHealthCheck, error) {
+	if deployment.Device == nil {
+		return nil, fmt.Errorf("deployment has no device loaded")
+	}
+
+	check := &models.DeploymentHealthCheck{DeploymentID: deployment.ID}
+
+	url, err := m.healthURL(deployment, config)
+	if err != nil {
+		check.Error = err.Error()
+	} else {
+		m.probe(ctx, url, config.timeout, check)
+	}
+
+	if err := m.recordResult(deployment, check, config.threshold); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// probe performs a single HTTP GET; any status below 400 counts as healthy
+func (m *DeploymentHealthMonitor) probe(ctx context.Context, url string, timeout time.Duration, check *models.DeploymentHealthCheck) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	check.CheckedAt = time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		check.Error = fmt.Sprintf("invalid health URL: %v", err)
+		return
+	}
+
+	resp, err := m.httpClient.Do(req)
+	check.ResponseTimeMs = time.Since(check.CheckedAt).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	check.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 400 {
+		check.Error = fmt.Sprintf("%s returned HTTP %d", url, resp.StatusCode)
+		return
+	}
+	check.Healthy = true
+}
+
+// recordResult stores a probe result and moves the deployment between running and unhealthy
+// Status changes are conditional on the status we read, so stops and upgrades are never overwritten
+func (m *DeploymentHealthMonitor) recordResult(deployment *models.Deployment, check *models.DeploymentHealthCheck, threshold int) error {
+	if err := m.db.Create(check).Error; err != nil {
+		return fmt.Errorf("failed to save health check: %w", err)
+	}
+
+	failures := 0
+	if !check.Healthy {
+		failures = deployment.HealthFailures + 1
+	}
+
+	updates := map[string]interface{}{
+		"health_failures":      failures,
+		"last_health_check_at": check.CheckedAt,
+	}
+
+	newStatus := deployment.Status
+	switch {
+	case check.Healthy && deployment.Status == models.DeploymentStatusUnhealthy:
+		newStatus = models.DeploymentStatusRunning
+		updates["status"] = newStatus
+		updates["error_details"] = ""
+	case !check.Healthy && deployment.Status == models.DeploymentStatusRunning && failures >= threshold:
+		newStatus = models.DeploymentStatusUnhealthy
+		updates["status"] = newStatus
+		updates["error_details"] = fmt.Sprintf("Health check failed %d times in a row: %s", failures, check.Error)
+	}
+
+	result := m.db.Model(&models.Deployment{}).
+		Where("id = ? AND status = ?", deployment.ID, deployment.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update deployment health: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// Status changed underneath us (stopped, upgrading, deleted); the next cycle re-reads it
+		return nil
+	}
+
+	previousStatus := deployment.Status
+	deployment.HealthFailures = failures
+	deployment.LastHealthCheckAt = &check.CheckedAt
+	if newStatus == previousStatus {
+		return nil
+	}
+
+	deployment.Status = newStatus
+	deployment.ErrorDetails, _ = updates["error_details"].(string)
+	log.Printf("[HealthMonitor] %s changed from %s to %s", deployment.ComposeProject, previousStatus, newStatus)
+
+	if m.events != nil {
+		m.events.RecordStatusChange(deployment, previousStatus, deployment.ErrorDetails)
+	}
+
+	if m.wsHub != nil {
+		m.wsHub.Broadcast("deployments", "deployment:status", map[string]interface{}{
+			"id":              deployment.ID,
+			"status":          deployment.Status,
+			"previous_status": previousStatus,
+			"error_details":   deployment.ErrorDetails,
+			"health_failures": failures,
+		})
+	}
+	return nil
+}
+
+// GetHealthSummary returns health history and uptime for a deployment since the given time
+func (m *DeploymentHealthMonitor) GetHealthSummary(deploymentID uuid.UUID, since time.Time, limit int) (*DeploymentHealthSummary, error) {
+	var deployment models.Deployment
+	if err := m.db.First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		return nil, fmt.Errorf("deployment not found: %w", err)
+	}
+
+	summary := &DeploymentHealthSummary{
+		DeploymentID:   deployment.ID,
+		Status:         deployment.Status,
+		HealthFailures: deployment.HealthFailures,
+		Since:          since,
+	}
+
+	base := m.db.Model(&models.DeploymentHealthCheck{}).Where("deployment_id = ? AND checked_at >= ?", deploymentID, since)
+	if err := base.Session(&gorm.Session{}).Count(&summary.TotalChecks).Error; err != nil {
+		return nil, fmt.Errorf("failed to count health checks: %w", err)
+	}
+	if err := base.Session(&gorm.Session{}).Where("healthy = ?", true).Count(&summary.HealthyChecks).Error; err != nil {
+		return nil, fmt.Errorf("failed to count healthy checks: %w", err)
+	}
+	if summary.TotalChecks > 0 {
+		uptime := float64(summary.HealthyChecks) / float64(summary.TotalChecks) * 100
+		summary.UptimePercent = &uptime
+	}
+
+	if err := base.Session(&gorm.Session{}).Order("checked_at DESC").Limit(limit).Find(&summary.History).Error; err != nil {
+		return nil, fmt.Errorf("failed to load health history: %w", err)
+	}
+
+	return summary, nil
+}
+
+// pruneHistory deletes health checks older than the retention window, at most once an hour
+func (m *DeploymentHealthMonitor) pruneHistory() {
+	m.mu.Lock()
+	if time.Since(m.lastPrune) < time.Hour {
+		m.mu.Unlock()
+		return
+	}
+	m.lastPrune = time.Now()
+	m.mu.Unlock()
+
+	cutoff := time.Now().Add(-m.retention)
+	result := m.db.Where("checked_at < ?", cutoff).Delete(&models.DeploymentHealthCheck{})
+	if result.Error != nil {
+		log.Printf("[HealthMonitor] Failed to prune health history: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[HealthMonitor] Pruned %d health checks older than %s", result.RowsAffected, cutoff.Format(time.RFC3339))
+	}
+}
+
+// probeConfig returns the recipe's health config with defaults, or false if it has no endpoint
+func (m *DeploymentHealthMonitor) probeConfig(slug string) (healthProbeConfig, bool) {
+	if m.recipeLoader == nil {
+		return healthProbeConfig{}, false
+	}
+	recipe, err := m.recipeLoader.GetRecipe(slug)
+	if err != nil || recipe.Health.Endpoint == "" {
+		return healthProbeConfig{}, false
+	}
+
+	config := healthProbeConfig{
+		endpoint:  recipe.Health.Endpoint,
+		interval:  defaultHealthInterval,
+		timeout:   defaultHealthTimeout,
+		threshold: defaultHealthThreshold,
+	}
+	if d, err := time.ParseDuration(recipe.Health.Interval); err == nil && d > 0 {
+		config.interval = d
+	}
+	if config.interval < minHealthInterval {
+		config.interval = minHealthInterval
+	}
+	if d, err := time.ParseDuration(recipe.Health.Timeout); err == nil && d > 0 {
+		config.timeout = d
+	}
+	if recipe.Health.UnhealthyThreshold > 0 {
+		config.threshold = recipe.Health.UnhealthyThreshold
+	}
+	// The legacy health_check block can pin the port explicitly
+	if recipe.HealthCheck.Port > 0 && !strings.Contains(config.endpoint, "://") {
+		config.containerPort = recipe.HealthCheck.Port
+	}
+	return config, true
+}
+
+// healthURL builds the URL to probe for a deployment
+// A pinned port is the port inside the container, so the host port the compose file publishes it on is probed
+func (m *DeploymentHealthMonitor) healthURL(deployment *models.Deployment, config healthProbeConfig) (string, error) {
+	endpoint := config.endpoint
+	if config.containerPort > 0 {
+		vars, err := deploymentComposeVars(deployment)
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(endpoint, "/") {
+			endpoint = "/" + endpoint
+		}
+		endpoint = fmt.Sprintf(":%d%s", publishedHostPort(deployment.GeneratedCompose, vars, config.containerPort), endpoint)
+	}
+	return m.resolveHealthURL(deployment, endpoint)
+}
+
+// resolveHealthURL builds the URL for a deployment's health endpoint
+// The port comes from an explicit ":port/path" endpoint, the deployment's external port,
+// or the first TCP port published by its compose file (with the deployment's config substituted)
+func (m *DeploymentHealthMonitor) resolveHealthURL(deployment *models.Deployment, endpoint string) (string, error) {
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return endpoint, nil
+	}
+
+	address := deployment.Device.GetPrimaryAddress()
+	if strings.HasPrefix(endpoint, ":") {
+		return "http://" + address + endpoint, nil
+	}
+
+	port := deployment.ExternalPort
+	if port == 0 {
+		vars, err := deploymentComposeVars(deployment)
+		if err != nil {
+			return "", err
+		}
+
+		for _, spec := range ExtractPortsFromCompose(interpolateComposeVars(deployment.GeneratedCompose, vars)) {
+			if spec.Protocol == "tcp" {
+				port = spec.Port
+				break
+			}
+		}
+	}
+	if port == 0 {
+		return "", fmt.Errorf("could not determine a published port for the health endpoint")
+	}
+
+	scheme := "http"
+	if port == 443 || port == 8443 {
+		scheme = "https"
+	}
+	if !strings.HasPrefix(endpoint, "/") {
+		endpoint = "/" + endpoint
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, address, port, endpoint), nil
+}
+
+// deploymentComposeVars returns a deployment's config as the variables its compose file refers to
+func deploymentComposeVars(deployment *models.Deployment) (map[string]string, error) {
+	var config map[string]interface{}
+	if len(deployment.Config) > 0 {
+		if err := json.Unmarshal(deployment.Config, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse deployment config: %w", err)
+		}
+	}
+	vars := make(map[string]string, len(config))
+	for key, value := range config {
+		vars[strings.ToUpper(key)] = fmt.Sprintf("%v", value)
+	}
+	return vars, nil
+}
+
+// interpolateComposeVars substitutes ${VAR}, ${VAR:-default} and ${VAR-default} like docker compose
+func interpolateComposeVars(content string, vars map[string]string) string {
+	return composeVarRegex.ReplaceAllStringFunc(content, func(ref string) string {
+		match := composeVarRegex.FindStringSubmatch(ref)
+		value, ok := vars[match[1]]
+		switch match[2] {
+		case ":-":
+			if value == "" {
+				return match[3]
+			}
+		case "-":
+			if !ok {
+				return match[3]
+			}
+		}
+		return value
+	})
+}
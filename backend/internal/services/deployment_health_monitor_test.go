@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolateComposeVars(t *testing.T) {
+	vars := map[string]string{"WEB_PORT": "9090", "EMPTY": ""}
+
+	assert.Equal(t, `"9090:80"`, interpolateComposeVars(`"${WEB_PORT}:80"`, vars))
+	assert.Equal(t, `"9090:80"`, interpolateComposeVars(`"${WEB_PORT:-8080}:80"`, vars))
+	assert.Equal(t, `"8080:80"`, interpolateComposeVars(`"${MISSING:-8080}:80"`, vars))
+	assert.Equal(t, `"8080:80"`, interpolateComposeVars(`"${EMPTY:-8080}:80"`, vars))
+	assert.Equal(t, `":80"`, interpolateComposeVars(`"${EMPTY-8080}:80"`, vars))
+	assert.Equal(t, `":80"`, interpolateComposeVars(`"${MISSING}:80"`, vars))
+}
+
+func TestResolveHealthURL(t *testing.T) {
+	monitor := NewDeploymentHealthMonitor(nil, nil, nil)
+	device := &models.Device{LocalIPAddress: "192.168.1.20"}
+	compose := "services:\n  app:\n    ports:\n      - \"${WEB_PORT:-8080}:80\"\n"
+
+	deployment := &models.Deployment{Device: device, GeneratedCompose: compose}
+	url, err := monitor.resolveHealthURL(deployment, "/alive")
+	require.NoError(t, err)
+	assert.Equal(t, "http://192.168.1.20:8080/alive", url, "compose default is used without config")
+
+	deployment.Config, _ = json.Marshal(map[string]interface{}{"web_port": 9443})
+	url, err = monitor.resolveHealthURL(deployment, "alive")
+	require.NoError(t, err)
+	assert.Equal(t, "http://192.168.1.20:9443/alive", url, "user config overrides compose default")
+
+	deployment.ExternalPort = 8443
+	url, err = monitor.resolveHealthURL(deployment, "/alive")
+	require.NoError(t, err)
+	assert.Equal(t, "https://192.168.1.20:8443/alive", url)
+
+	url, err = monitor.resolveHealthURL(deployment, ":3001/status")
+	require.NoError(t, err)
+	assert.Equal(t, "http://192.168.1.20:3001/status", url, "explicit port wins")
+
+	_, err = monitor.resolveHealthURL(&models.Deployment{Device: device}, "/alive")
+	assert.Error(t, err)
+}
+
+func TestDeploymentHealthMonitor_Transitions(t *testing.T) {
+	db := setupTestDB(t)
+
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/alive" || failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	recipes := NewMockRecipeLoader(map[string]*models.Recipe{
+		"app": {Slug: "app", Health: models.RecipeHealthConfig{Endpoint: "/alive", Timeout: "2s", UnhealthyThreshold: 2}},
+	})
+	hub := &recordingHub{}
+	monitor := NewDeploymentHealthMonitor(db, recipes, hub)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "127.0.0.1"}
+	require.NoError(t, db.Create(device).Error)
+	deployment := &models.Deployment{RecipeSlug: "app", ComposeProject: "app-1", DeviceID: device.ID, ExternalPort: port, Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(deployment).Error)
+	deployment.Device = device
+
+	reload := func() *models.Deployment {
+		var d models.Deployment
+		require.NoError(t, db.Preload("Device").First(&d, "id = ?", deployment.ID).Error)
+		return &d
+	}
+	ctx := context.Background()
+
+	check, err := monitor.CheckDeployment(ctx, reload())
+	require.NoError(t, err)
+	assert.True(t, check.Healthy)
+	assert.Equal(t, http.StatusOK, check.StatusCode)
+
+	// Failures below the threshold keep the deployment running
+	failing.Store(true)
+	check, err = monitor.CheckDeployment(ctx, reload())
+	require.NoError(t, err)
+	assert.False(t, check.Healthy)
+	assert.Equal(t, models.DeploymentStatusRunning, reload().Status)
+	assert.Equal(t, 1, reload().HealthFailures)
+	assert.Empty(t, hub.events)
+
+	// Reaching the threshold marks it unhealthy and broadcasts
+	_, err = monitor.CheckDeployment(ctx, reload())
+	require.NoError(t, err)
+	current := reload()
+	assert.Equal(t, models.DeploymentStatusUnhealthy, current.Status)
+	assert.Contains(t, current.ErrorDetails, "HTTP 503")
+	assert.Equal(t, []string{"deployments:deployment:status"}, hub.events)
+
+	// Recovery moves it back to running
+	failing.Store(false)
+	_, err = monitor.CheckDeployment(ctx, reload())
+	require.NoError(t, err)
+	current = reload()
+	assert.Equal(t, models.DeploymentStatusRunning, current.Status)
+	assert.Equal(t, 0, current.HealthFailures)
+	assert.Empty(t, current.ErrorDetails)
+	assert.Len(t, hub.events, 2)
+
+	summary, err := monitor.GetHealthSummary(deployment.ID, time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), summary.TotalChecks)
+	assert.Equal(t, int64(2), summary.HealthyChecks)
+	require.NotNil(t, summary.UptimePercent)
+	assert.InDelta(t, 50.0, *summary.UptimePercent, 0.001)
+	require.Len(t, summary.History, 4)
+	assert.True(t, summary.History[0].Healthy, "history is most recent first")
+}
+
+func TestDeploymentHealthMonitor_DoesNotOverrideStoppedDeployment(t *testing.T) {
+	db := setupTestDB(t)
+	hub := &recordingHub{}
+	monitor := NewDeploymentHealthMonitor(db, nil, hub)
+
+	deployment := &models.Deployment{RecipeSlug: "app", ComposeProject: "app-1", Status: models.DeploymentStatusRunning, HealthFailures: 5}
+	require.NoError(t, db.Create(deployment).Error)
+
+	// The user stopped the deployment while a probe was in flight
+	require.NoError(t, db.Model(deployment).Update("status", models.DeploymentStatusStopped).Error)
+
+	check := &models.DeploymentHealthCheck{DeploymentID: deployment.ID, Error: "connection refused"}
+	require.NoError(t, monitor.recordResult(deployment, check, 3))
+
+	var reloaded models.Deployment
+	require.NoError(t, db.First(&reloaded, "id = ?", deployment.ID).Error)
+	assert.Equal(t, models.DeploymentStatusStopped, reloaded.Status)
+	assert.Empty(t, hub.events)
+}
+
+func TestDeploymentHealthMonitor_ProbeConfigDefaults(t *testing.T) {
+	recipes := NewMockRecipeLoader(map[string]*models.Recipe{
+		"defaults": {Slug: "defaults", Health: models.RecipeHealthConfig{Endpoint: "/health"}},
+		"custom":   {Slug: "custom", Health: models.RecipeHealthConfig{Endpoint: "/health", Interval: "2s", Timeout: "3s", UnhealthyThreshold: 5}},
+		"none":     {Slug: "none"},
+	})
+	monitor := NewDeploymentHealthMonitor(nil, recipes, nil)
+
+	config, ok := monitor.probeConfig("defaults")
+	require.True(t, ok)
+	assert.Equal(t, defaultHealthInterval, config.interval)
+	assert.Equal(t, defaultHealthTimeout, config.timeout)
+	assert.Equal(t, defaultHealthThreshold, config.threshold)
+
+	config, ok = monitor.probeConfig("custom")
+	require.True(t, ok)
+	assert.Equal(t, minHealthInterval, config.interval, "intervals are clamped to the minimum")
+	assert.Equal(t, 3*time.Second, config.timeout)
+	assert.Equal(t, 5, config.threshold)
+
+	_, ok = monitor.probeConfig("none")
+	assert.False(t, ok)
+}
+
+func TestDeploymentHealthMonitor_LegacyPortIsContainerPort(t *testing.T) {
+	recipes := NewMockRecipeLoader(map[string]*models.Recipe{
+		"legacy": {Slug: "legacy", Health: models.RecipeHealthConfig{Endpoint: "/health"}, HealthCheck: models.RecipeHealthCheck{Port: 80}},
+	})
+	monitor := NewDeploymentHealthMonitor(nil, recipes, nil)
+	device := &models.Device{LocalIPAddress: "192.168.1.20"}
+
+	config, ok := monitor.probeConfig("legacy")
+	require.True(t, ok)
+	assert.Equal(t, 80, config.containerPort)
+
+	deployment := &models.Deployment{Device: device, GeneratedCompose: "services:\n  app:\n    ports:\n      - \"${WEB_PORT:-8080}:80\"\n"}
+	url, err := monitor.healthURL(deployment, config)
+	require.NoError(t, err)
+	assert.Equal(t, "http://192.168.1.20:8080/health", url, "the container port is probed on the host port it is published on")
+
+	deployment.Config, _ = json.Marshal(map[string]interface{}{"web_port": 9090})
+	url, err = monitor.healthURL(deployment, config)
+	require.NoError(t, err)
+	assert.Equal(t, "http://192.168.1.20:9090/health", url)
+
+	deployment = &models.Deployment{Device: device, GeneratedCompose: "services:\n  app:\n    ports:\n      - target: 80\n        published: 8081\n"}
+	url, err = monitor.healthURL(deployment, config)
+	require.NoError(t, err)
+	assert.Equal(t, "http://192.168.1.20:8081/health", url)
+
+	deployment = &models.Deployment{Device: device, GeneratedCompose: "services:\n  app:\n    network_mode: host\n"}
+	url, err = monitor.healthURL(deployment, config)
+	require.NoError(t, err)
+	assert.Equal(t, "http://192.168.1.20:80/health", url, "unpublished ports are probed as they are")
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+// Deployment job phases, in order; a job's Phase is the last one it completed
+const (
+	deployPhaseDependencies = "dependencies"
+	deployPhaseDatabase     = "database"
+	deployPhaseContainers   = "containers"
+	deployPhaseHealthCheck  = "health_check"
+	deployPhasePostInstall  = "post_install"
+)
+
+var deployPhases = []string{deployPhaseDependencies, deployPhaseDatabase, deployPhaseContainers, deployPhaseHealthCheck, deployPhasePostInstall}
+
+// Migration job phases; a migration interrupted by a restart is rolled back according to the last one
+const (
+	migratePhaseSourceWasStopped = "source_was_stopped" // The source was already stopped and stays stopped
+	migratePhaseSourceStopped    = "source_stopped"     // The migration stopped the source, so rolling back restarts it
+)
+
+// maxDeployJobAttempts is how many times a deploy or migration job is started before an interruption fails it
+const maxDeployJobAttempts = 3
+
+// jobStopTimeout is how long deleting a deployment waits for its running job to stop
+const jobStopTimeout = 2 * time.Minute
+
+// inProgressStatuses are deployment statuses that only a running job can move on from
+var inProgressStatuses = []models.DeploymentStatus{
+	models.DeploymentStatusValidating,
+	models.DeploymentStatusPreparing,
+	models.DeploymentStatusDeploying,
+	models.DeploymentStatusConfiguring,
+	models.DeploymentStatusHealthCheck,
+	models.DeploymentStatusRollingBack,
+	models.DeploymentStatusMigrating,
+}
+
+// activeJobStatuses are job statuses that still hold or wait for a worker
+var activeJobStatuses = []models.DeploymentJobStatus{models.DeploymentJobQueued, models.DeploymentJobRunning}
+
+// StartJobQueue recovers jobs interrupted by the last shutdown and starts the deployment worker pool
+func (s *DeploymentService) StartJobQueue(ctx context.Context, maxConcurrent int) error {
+	s.jobQueue.SetMaxConcurrent(maxConcurrent)
+	if err := s.jobQueue.Start(ctx); err != nil {
+		return err
+	}
+	s.failOrphanedDeployments()
+	return nil
+}
+
+// StopJobQueue stops starting new deployment jobs
+func (s *DeploymentService) StopJobQueue() {
+	s.jobQueue.Stop()
+}
+
+// GetActiveJob returns a deployment's queued or running job, including its queue position
+func (s *DeploymentService) GetActiveJob(id string) (*models.DeploymentJob, error) {
+	deploymentID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deployment ID: %w", err)
+	}
+	return s.jobQueue.ActiveJob(deploymentID)
+}
+
+// ListJobs returns deployment jobs, newest first; queued jobs include their queue position
+func (s *DeploymentService) ListJobs(deploymentID *uuid.UUID, status *models.DeploymentJobStatus, limit int) ([]models.DeploymentJob, error) {
+	return s.jobQueue.ListJobs(deploymentID, status, limit)
+}
+
+// ensureNoActiveJob rejects a new job for a deployment that already has one queued or running
+func (s *DeploymentService) ensureNoActiveJob(deploymentID uuid.UUID) error {
+	var count int64
+	if err := s.db.Model(&models.DeploymentJob{}).
+		Where("deployment_id = ? AND status IN ?", deploymentID, activeJobStatuses).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check deployment jobs: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("deployment already has a queued or running job")
+	}
+	return nil
+}
+
+// runJob executes a queued job against the deployment's current state
+func (s *DeploymentService) runJob(ctx context.Context, job *models.DeploymentJob) error {
+	deployment, err := s.GetDeployment(job.DeploymentID.String())
+	if err != nil {
+		return fmt.Errorf("deployment not found: %w", err)
+	}
+
+	fail := func(err error) error {
+		s.appendLog(deployment, fmt.Sprintf("❌ %v", err))
+		if job.Type == models.DeploymentJobDeploy || job.Type == models.DeploymentJobAdopt {
+			s.updateStatus(deployment, models.DeploymentStatusFailed, err.Error())
+			s.releasePorts(deployment)
+		}
+		return err
+	}
+
+	// Jobs other than the first deploy or adoption act on a deployed app, which may have changed while queued
+	// An interrupted migration finds the deployment mid-migration and rolls it back
+	resumedMigration := job.Type == models.DeploymentJobMigrate && job.Attempts > 1
+	if job.Type != models.DeploymentJobDeploy && job.Type != models.DeploymentJobAdopt && !resumedMigration {
+		switch deployment.Status {
+		case models.DeploymentStatusRunning, models.DeploymentStatusStopped,
+			models.DeploymentStatusRolledBack, models.DeploymentStatusUnhealthy:
+		default:
+			return fail(fmt.Errorf("skipped queued %s: deployment is %s", jobTypeLabel(job.Type), deployment.Status))
+		}
+	}
+
+	recipe, err := s.recipeFor(deployment)
+	if err != nil {
+		return fail(fmt.Errorf("recipe not found: %w", err))
+	}
+	device, err := s.deviceService.GetDevice(job.DeviceID)
+	if err != nil {
+		return fail(fmt.Errorf("failed to get device: %w", err))
+	}
+
+	switch job.Type {
+	case models.DeploymentJobDeploy:
+		var config map[string]interface{}
+		if err := s.jobQueue.LoadParams(job, &config); err != nil {
+			return fail(err)
+		}
+		s.executeDeployment(ctx, job, deployment, recipe, device, config)
+		// A failed first deploy leaves nothing running, so its ports are free for other deployments
+		if deployment.Status == models.DeploymentStatusFailed {
+			s.releasePorts(deployment)
+		}
+
+	case models.DeploymentJobUpgrade:
+		var req UpgradeDeploymentRequest
+		if err := s.jobQueue.LoadParams(job, &req); err != nil {
+			return fail(err)
+		}
+		s.executeUpgrade(ctx, deployment, recipe, device, req)
+
+	case models.DeploymentJobConfigUpdate:
+		var req UpdateDeploymentConfigRequest
+		if err := s.jobQueue.LoadParams(job, &req); err != nil {
+			return fail(err)
+		}
+		plan, diff, err := s.prepareConfigUpdate(deployment, recipe, device, req.Config, req.Compose)
+		if err != nil {
+			return fail(err)
+		}
+		if !diff.HasChanges() {
+			s.appendLog(deployment, "Configuration already up to date, nothing to apply")
+			return nil
+		}
+		s.executeConfigUpdate(ctx, deployment, recipe, device, plan)
+
+	case models.DeploymentJobMigrate:
+		if job.TargetDeviceID == nil {
+			return fail(fmt.Errorf("migration job has no target device"))
+		}
+		target, err := s.deviceService.GetDevice(*job.TargetDeviceID)
+		if err != nil {
+			return fail(fmt.Errorf("failed to get target device: %w", err))
+		}
+		if resumedMigration {
+			s.recoverMigration(job, deployment, recipe, device, target)
+		} else {
+			s.executeMigration(ctx, job, deployment, recipe, device, target)
+		}
+
+	case models.DeploymentJobAdopt:
+		var req AdoptAppRequest
+		if err := s.jobQueue.LoadParams(job, &req); err != nil {
+			return fail(err)
+		}
+		s.executeAdoption(ctx, deployment, recipe, device, req)
+
+	case models.DeploymentJobRestore:
+		var params restoreJobParams
+		if err := s.jobQueue.LoadParams(job, &params); err != nil {
+			return fail(err)
+		}
+		return s.executeRestore(deployment, params)
+
+	default:
+		return fmt.Errorf("unknown job type: %s", job.Type)
+	}
+
+	switch deployment.Status {
+	case models.DeploymentStatusFailed, models.DeploymentStatusRolledBack:
+		if deployment.ErrorDetails != "" {
+			return errors.New(deployment.ErrorDetails)
+		}
+		return fmt.Errorf("deployment %s", deployment.Status)
+	}
+	return nil
+}
+
+// recoverJob decides whether a job interrupted by a restart is resumed
+// Deploy jobs resume after their last completed phase. Migrations are requeued to be rolled back, so the
+// source does not stay stopped. Upgrades, config changes and adoptions kept their rollback state in memory,
+// so they are failed and left for the user to check. A restore is not repeated on its own, since the
+// deployment's data may be half restored.
+func (s *DeploymentService) recoverJob(job *models.DeploymentJob) bool {
+	deployment, err := s.GetDeployment(job.DeploymentID.String())
+	if err != nil {
+		return false
+	}
+
+	if job.Type == models.DeploymentJobDeploy && job.Attempts < maxDeployJobAttempts {
+		s.appendLog(deployment, "⚠️  Deployment was interrupted by a server restart and will resume")
+		return true
+	}
+	if job.Type == models.DeploymentJobMigrate && job.Attempts < maxDeployJobAttempts {
+		s.appendLog(deployment, "⚠️  Migration was interrupted by a server restart and will be rolled back")
+		return true
+	}
+
+	reason := fmt.Sprintf("Interrupted by a server restart during %s", jobTypeLabel(job.Type))
+	s.appendLog(deployment, fmt.Sprintf("❌ %s", reason))
+
+	if job.Type == models.DeploymentJobDeploy {
+		s.appendLog(deployment, fmt.Sprintf("Giving up after %d attempts; cleaning up the partial deployment", job.Attempts))
+		if device, err := s.deviceService.GetDevice(deployment.DeviceID); err == nil {
+			go s.cleanupFailedDeployment(device, deployment.ComposeProject)
+		}
+	} else {
+		s.appendLog(deployment, "The deployment may be partly changed; check it, then retry or redeploy")
+	}
+	s.updateStatus(deployment, models.DeploymentStatusFailed, reason)
+	return false
+}
+
+// failOrphanedDeployments fails deployments left in progress without a job to finish them
+func (s *DeploymentService) failOrphanedDeployments() {
+	var orphaned []models.Deployment
+	activeJobs := s.db.Model(&models.DeploymentJob{}).Select("deployment_id").Where("status IN ?", activeJobStatuses)
+	if err := s.db.Where("status IN ? AND id NOT IN (?)", inProgressStatuses, activeJobs).Find(&orphaned).Error; err != nil {
+		log.Printf("[Deployment] Failed to check for interrupted deployments: %v", err)
+		return
+	}
+
+	for i := range orphaned {
+		deployment := &orphaned[i]
+		log.Printf("[Deployment] Marking interrupted deployment %s (%s) as failed", deployment.ComposeProject, deployment.Status)
+		s.appendLog(deployment, "❌ Interrupted by a server restart")
+		s.updateStatus(deployment, models.DeploymentStatusFailed, "Interrupted by a server restart")
+	}
+}
+
+// deployPhaseDone reports whether a job already completed the given phase
+func deployPhaseDone(job *models.DeploymentJob, phase string) bool {
+	if job.Phase == "" {
+		return false
+	}
+	completed, target := -1, -1
+	for i, p := range deployPhases {
+		if p == job.Phase {
+			completed = i
+		}
+		if p == phase {
+			target = i
+		}
+	}
+	return completed >= target && target >= 0
+}
+
+// jobTypeLabel returns a job type for use in messages, e.g. "config update"
+func jobTypeLabel(jobType models.DeploymentJobType) string {
+	return strings.ReplaceAll(string(jobType), "_", " ")
+}
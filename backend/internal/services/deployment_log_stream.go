@@ -0,0 +1,386 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+	"gorm.io/gorm"
+)
+
+// DeploymentLogChannelPrefix prefixes the WebSocket channels that stream a deployment's container logs
+// Channels are "deployment-logs:<deployment id>", optionally followed by a query string of filters,
+// e.g. "deployment-logs:<id>?service=web&service=worker&since=10m&tail=200"
+// Subscribers to the same channel share one SSH session, which is closed when the last one leaves
+// Only authenticated connections may subscribe, to at most MaxLogSubscriptionsPerClient channels each
+const DeploymentLogChannelPrefix = "deployment-logs:"
+
+const (
+	// MaxLogSubscriptionsPerClient caps the log channels one WebSocket connection can follow
+	MaxLogSubscriptionsPerClient = 4
+
+	// maxLogStreamsPerDeployment caps the SSH sessions following one deployment; every distinct
+	// filter combination needs its own session
+	maxLogStreamsPerDeployment = 4
+
+	defaultLogTail = 100
+	maxLogTail     = 5000
+
+	// Lines are sent in batches so a chatty container doesn't flood the hub with one message per line
+	logBatchInterval = 250 * time.Millisecond
+	logBatchMaxLines = 200
+	maxPendingLines  = 2000
+	maxLogLineLength = 16 * 1024
+
+	// logRestartDelay is how long to wait before following again after `logs -f` exits
+	logRestartDelay = 5 * time.Second
+)
+
+// logSinceRegex matches relative `docker compose logs --since` values like "30s", "10m" or "2h"
+var logSinceRegex = regexp.MustCompile(`^[0-9]+[smh]$`)
+
+// DeploymentLogOptions filters a deployment log stream
+type DeploymentLogOptions struct {
+	Services   []string // Compose services to include (default: all)
+	Since      string   // Relative duration ("10m") or RFC3339 timestamp
+	Tail       int      // Lines of history per container before following
+	Timestamps bool     // Prefix lines with their timestamp
+}
+
+// DeploymentLogStreamer follows `docker compose logs` for deployments with WebSocket subscribers
+type DeploymentLogStreamer struct {
+	db        *gorm.DB
+	sshClient *ssh.Client
+	wsHub     WSHub
+	streams   map[string]*logStream // channel -> running stream
+	mu        sync.Mutex
+}
+
+// logStream is a running log follower for one channel
+type logStream struct {
+	cancel context.CancelFunc
+}
+
+// NewDeploymentLogStreamer creates a new deployment log streamer
+func NewDeploymentLogStreamer(db *gorm.DB, sshClient *ssh.Client, wsHub WSHub) *DeploymentLogStreamer {
+	return &DeploymentLogStreamer{
+		db:        db,
+		sshClient: sshClient,
+		wsHub:     wsHub,
+		streams:   make(map[string]*logStream),
+	}
+}
+
+// HandleSubscriptionChange starts a stream for a channel's first subscriber and stops it after the last leaves
+// Registered as the hub's subscription listener for DeploymentLogChannelPrefix, so it must not block
+func (s *DeploymentLogStreamer) HandleSubscriptionChange(channel string, subscribers int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stream, running := s.streams[channel]
+	if subscribers > 0 && !running {
+		if s.deploymentStreams(channel) >= maxLogStreamsPerDeployment {
+			// Broadcasting from a subscription listener could block the hub
+			go s.broadcastError(channel, fmt.Errorf("too many log streams for this deployment (limit %d); reuse an existing filter or try again later", maxLogStreamsPerDeployment))
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stream = &logStream{cancel: cancel}
+		s.streams[channel] = stream
+		go s.run(ctx, channel, stream)
+	} else if subscribers == 0 && running {
+		stream.cancel()
+		delete(s.streams, channel)
+	}
+}
+
+// deploymentStreams counts the running streams of the deployment a channel belongs to
+// Must be called with s.mu held
+func (s *DeploymentLogStreamer) deploymentStreams(channel string) int {
+	deployment, _, _ := strings.Cut(channel, "?")
+	count := 0
+	for running := range s.streams {
+		if other, _, _ := strings.Cut(running, "?"); other == deployment {
+			count++
+		}
+	}
+	return count
+}
+
+// Stop ends every running stream
+func (s *DeploymentLogStreamer) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for channel, stream := range s.streams {
+		stream.cancel()
+		delete(s.streams, channel)
+	}
+}
+
+// run follows a deployment's logs until the stream is cancelled
+// If `logs -f` exits (e.g. every container stopped) it is restarted from where it left off,
+// so subscribers keep seeing a flapping app's output across restarts
+func (s *DeploymentLogStreamer) run(ctx context.Context, channel string, stream *logStream) {
+	defer s.remove(channel, stream)
+
+	deploymentID, opts, err := ParseDeploymentLogChannel(channel)
+	if err != nil {
+		s.broadcastError(channel, err)
+		return
+	}
+
+	var deployment models.Deployment
+	if err := s.db.First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		s.broadcastError(channel, fmt.Errorf("deployment not found"))
+		return
+	}
+	if !isValidStackName(deployment.ComposeProject) {
+		s.broadcastError(channel, fmt.Errorf("deployment has no valid compose project"))
+		return
+	}
+
+	var device models.Device
+	if err := s.db.First(&device, "id = ?", deployment.DeviceID).Error; err != nil {
+		s.broadcastError(channel, fmt.Errorf("device not found"))
+		return
+	}
+	host := device.GetSSHHost()
+
+	writer := newLogLineWriter()
+	flushDone := make(chan struct{})
+	go func() {
+		defer close(flushDone)
+		s.flushLines(ctx, channel, deploymentID, writer)
+	}()
+
+	log.Printf("[Logs] Streaming logs of %s", deployment.ComposeProject)
+	for {
+		err := s.sshClient.ExecuteFollow(ctx, host, opts.command(deployment.ComposeProject), writer)
+		if ctx.Err() != nil {
+			break
+		}
+		writer.flushPartial()
+
+		if err != nil {
+			s.broadcastError(channel, err)
+		}
+
+		// Pick up again after the last line we sent instead of replaying history
+		opts.Tail = 0
+		opts.Since = time.Now().UTC().Format(time.RFC3339)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(logRestartDelay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	<-flushDone
+	log.Printf("[Logs] Stopped streaming logs of %s", deployment.ComposeProject)
+}
+
+// flushLines sends buffered lines in batches until ctx is cancelled
+func (s *DeploymentLogStreamer) flushLines(ctx context.Context, channel string, deploymentID uuid.UUID, writer *logLineWriter) {
+	ticker := time.NewTicker(logBatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				lines, dropped := writer.take(logBatchMaxLines)
+				if len(lines) == 0 && dropped == 0 {
+					break
+				}
+				s.broadcast(channel, "logs:lines", map[string]interface{}{
+					"deployment_id": deploymentID,
+					"lines":         lines,
+					"dropped":       dropped,
+				})
+			}
+		}
+	}
+}
+
+// remove forgets a finished stream, unless it was already replaced by a newer one
+func (s *DeploymentLogStreamer) remove(channel string, stream *logStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams[channel] == stream {
+		stream.cancel()
+		delete(s.streams, channel)
+	}
+}
+
+// broadcastError tells a channel's subscribers why lines aren't arriving
+func (s *DeploymentLogStreamer) broadcastError(channel string, err error) {
+	log.Printf("[Logs] %s: %v", channel, err)
+	s.broadcast(channel, "logs:error", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func (s *DeploymentLogStreamer) broadcast(channel string, event string, data interface{}) {
+	if s.wsHub == nil {
+		return
+	}
+	s.wsHub.Broadcast(channel, event, data)
+}
+
+// ParseDeploymentLogChannel extracts the deployment and filters from a log channel name
+func ParseDeploymentLogChannel(channel string) (uuid.UUID, DeploymentLogOptions, error) {
+	opts := DeploymentLogOptions{Tail: defaultLogTail}
+
+	rest, ok := strings.CutPrefix(channel, DeploymentLogChannelPrefix)
+	if !ok {
+		return uuid.Nil, opts, fmt.Errorf("not a deployment log channel: %s", channel)
+	}
+
+	idPart, rawQuery, _ := strings.Cut(rest, "?")
+	deploymentID, err := uuid.Parse(idPart)
+	if err != nil {
+		return uuid.Nil, opts, fmt.Errorf("invalid deployment ID")
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return uuid.Nil, opts, fmt.Errorf("invalid log filters: %w", err)
+	}
+
+	for _, service := range query["service"] {
+		if !volumeNameRegex.MatchString(service) {
+			return uuid.Nil, opts, fmt.Errorf("invalid service name: %s", service)
+		}
+		opts.Services = append(opts.Services, service)
+	}
+
+	if since := query.Get("since"); since != "" {
+		if !logSinceRegex.MatchString(since) {
+			if _, err := time.Parse(time.RFC3339, since); err != nil {
+				return uuid.Nil, opts, fmt.Errorf("invalid since value: %s (use e.g. 10m or an RFC3339 time)", since)
+			}
+		}
+		opts.Since = since
+	}
+
+	if tail := query.Get("tail"); tail != "" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 || n > maxLogTail {
+			return uuid.Nil, opts, fmt.Errorf("invalid tail value: %s (must be 0-%d)", tail, maxLogTail)
+		}
+		opts.Tail = n
+	}
+
+	opts.Timestamps = query.Get("timestamps") == "true"
+
+	return deploymentID, opts, nil
+}
+
+// command returns the `docker compose logs -f` command for a project
+func (o DeploymentLogOptions) command(project string) string {
+	cmd := fmt.Sprintf("cd ~/homelab-deployments/%s && docker compose -p %s logs -f --no-color --tail=%d", project, project, o.Tail)
+	if o.Since != "" {
+		cmd += " --since=" + o.Since
+	}
+	if o.Timestamps {
+		cmd += " --timestamps"
+	}
+	for _, service := range o.Services {
+		cmd += " " + service
+	}
+	return cmd
+}
+
+// logLineWriter splits streamed output into lines and buffers them for batching
+// When subscribers can't keep up the oldest lines are dropped and counted
+type logLineWriter struct {
+	mu      sync.Mutex
+	partial []byte
+	lines   []string
+	dropped int
+}
+
+func newLogLineWriter() *logLineWriter {
+	return &logLineWriter{}
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.appendLine(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+
+	// Don't let a line without a newline grow without bound
+	if len(w.partial) > maxLogLineLength {
+		w.appendLine(w.partial)
+		w.partial = nil
+	}
+	return len(p), nil
+}
+
+// flushPartial emits an unterminated last line, e.g. when the command exits
+func (w *logLineWriter) flushPartial() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.partial) > 0 {
+		w.appendLine(w.partial)
+		w.partial = nil
+	}
+}
+
+// appendLine buffers one line; must be called with w.mu held
+func (w *logLineWriter) appendLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > maxLogLineLength {
+		line = line[:maxLogLineLength]
+	}
+	w.lines = append(w.lines, string(line))
+	if len(w.lines) > maxPendingLines {
+		excess := len(w.lines) - maxPendingLines
+		w.lines = w.lines[excess:]
+		w.dropped += excess
+	}
+}
+
+// take removes up to max buffered lines and returns them with the number of lines dropped since the last take
+func (w *logLineWriter) take(max int) ([]string, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(w.lines)
+	if n > max {
+		n = max
+	}
+	lines := append([]string(nil), w.lines[:n]...)
+	w.lines = w.lines[n:]
+
+	dropped := w.dropped
+	w.dropped = 0
+	return lines, dropped
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDeploymentLogChannel(t *testing.T) {
+	deploymentID := uuid.New()
+
+	id, opts, err := ParseDeploymentLogChannel(DeploymentLogChannelPrefix + deploymentID.String())
+	require.NoError(t, err)
+	assert.Equal(t, deploymentID, id)
+	assert.Equal(t, DeploymentLogOptions{Tail: defaultLogTail}, opts)
+
+	_, opts, err = ParseDeploymentLogChannel(DeploymentLogChannelPrefix + deploymentID.String() + "?service=server&service=redis&since=10m&tail=500&timestamps=true")
+	require.NoError(t, err)
+	assert.Equal(t, DeploymentLogOptions{Services: []string{"server", "redis"}, Since: "10m", Tail: 500, Timestamps: true}, opts)
+
+	_, opts, err = ParseDeploymentLogChannel(DeploymentLogChannelPrefix + deploymentID.String() + "?since=2026-01-02T15:04:05Z")
+	require.NoError(t, err)
+	assert.Equal(t, "2026-01-02T15:04:05Z", opts.Since)
+
+	invalid := []string{
+		"deployments",
+		DeploymentLogChannelPrefix + "not-a-uuid",
+		DeploymentLogChannelPrefix + deploymentID.String() + "?service=web;reboot",
+		DeploymentLogChannelPrefix + deploymentID.String() + "?since=yesterday",
+		DeploymentLogChannelPrefix + deploymentID.String() + "?tail=-1",
+		DeploymentLogChannelPrefix + deploymentID.String() + "?tail=100000",
+	}
+	for _, channel := range invalid {
+		_, _, err := ParseDeploymentLogChannel(channel)
+		assert.Error(t, err, channel)
+	}
+}
+
+func TestDeploymentLogOptions_Command(t *testing.T) {
+	opts := DeploymentLogOptions{Tail: 100}
+	assert.Equal(t, "cd ~/homelab-deployments/immich-abc123 && docker compose -p immich-abc123 logs -f --no-color --tail=100",
+		opts.command("immich-abc123"))
+
+	opts = DeploymentLogOptions{Services: []string{"server", "machine-learning"}, Since: "10m", Tail: 0, Timestamps: true}
+	assert.Equal(t, "cd ~/homelab-deployments/immich-abc123 && docker compose -p immich-abc123 logs -f --no-color --tail=0 --since=10m --timestamps server machine-learning",
+		opts.command("immich-abc123"))
+}
+
+func TestLogLineWriter(t *testing.T) {
+	w := newLogLineWriter()
+
+	w.Write([]byte("server-1  | starting\r\nserver-1  | listen"))
+	w.Write([]byte("ing on :2283\nredis-1   | ready"))
+
+	lines, dropped := w.take(logBatchMaxLines)
+	assert.Equal(t, []string{"server-1  | starting", "server-1  | listening on :2283"}, lines, "partial lines wait for their newline")
+	assert.Zero(t, dropped)
+
+	w.flushPartial()
+	lines, _ = w.take(logBatchMaxLines)
+	assert.Equal(t, []string{"redis-1   | ready"}, lines)
+
+	// Lines beyond the buffer limit are dropped oldest-first and counted
+	w.Write([]byte(strings.Repeat("line\n", maxPendingLines+10)))
+	lines, dropped = w.take(logBatchMaxLines)
+	assert.Len(t, lines, logBatchMaxLines)
+	assert.Equal(t, 10, dropped)
+	lines, dropped = w.take(maxPendingLines)
+	assert.Len(t, lines, maxPendingLines-logBatchMaxLines)
+	assert.Zero(t, dropped)
+}
+
+func TestDeploymentLogStreamer_RejectsUnknownDeployment(t *testing.T) {
+	db := setupTestDB(t)
+	hub := &recordingHub{}
+	streamer := NewDeploymentLogStreamer(db, nil, hub)
+
+	channel := DeploymentLogChannelPrefix + uuid.New().String()
+	stream := &logStream{cancel: func() {}}
+	streamer.streams[channel] = stream
+
+	streamer.run(context.Background(), channel, stream)
+
+	assert.Equal(t, []string{channel + ":logs:error"}, hub.events)
+	assert.Empty(t, streamer.streams, "a stream that can't start is forgotten so a new subscriber retries")
+
+	// Deployments without a compose project are refused before any SSH session is opened
+	deployment := &models.Deployment{RecipeSlug: "immich", DeviceID: uuid.New(), ComposeProject: "immich; rm -rf /"}
+	require.NoError(t, db.Create(deployment).Error)
+	hub.events = nil
+	streamer.run(context.Background(), DeploymentLogChannelPrefix+deployment.ID.String(), stream)
+	assert.Equal(t, []string{DeploymentLogChannelPrefix + deployment.ID.String() + ":logs:error"}, hub.events)
+}
+
+func TestDeploymentLogStreamer_SubscriptionLifecycle(t *testing.T) {
+	streamer := NewDeploymentLogStreamer(setupTestDB(t), nil, nil)
+	channel := DeploymentLogChannelPrefix + uuid.New().String()
+
+	cancelled := false
+	streamer.streams[channel] = &logStream{cancel: func() { cancelled = true }}
+
+	// More subscribers joining don't start a second session
+	streamer.HandleSubscriptionChange(channel, 2)
+	assert.Len(t, streamer.streams, 1)
+	assert.False(t, cancelled)
+
+	streamer.HandleSubscriptionChange(channel, 0)
+	assert.True(t, cancelled, "the session is closed when the last subscriber leaves")
+	assert.Empty(t, streamer.streams)
+}
+
+func TestDeploymentLogStreamer_LimitsStreamsPerDeployment(t *testing.T) {
+	streamer := NewDeploymentLogStreamer(setupTestDB(t), nil, nil)
+	channel := DeploymentLogChannelPrefix + uuid.New().String()
+
+	for i := 0; i < maxLogStreamsPerDeployment; i++ {
+		streamer.streams[fmt.Sprintf("%s?tail=%d", channel, i)] = &logStream{cancel: func() {}}
+	}
+	other := DeploymentLogChannelPrefix + uuid.New().String()
+	streamer.streams[other] = &logStream{cancel: func() {}}
+
+	// Another filter variant of the same deployment would open one SSH session too many
+	streamer.HandleSubscriptionChange(channel+"?tail=500", 1)
+	assert.Len(t, streamer.streams, maxLogStreamsPerDeployment+1)
+	assert.NotContains(t, streamer.streams, channel+"?tail=500")
+}
@@ -0,0 +1,737 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+// MigrateDeploymentRequest represents a request to move a deployment to another device
+type MigrateDeploymentRequest struct {
+	TargetDeviceID uuid.UUID `json:"target_device_id" validate:"required"`
+}
+
+// migrationState tracks what a migration has changed so it can be rolled back
+type migrationState struct {
+	previousStatus models.DeploymentStatus
+	compose        string
+	env            string
+	volumes        []string
+	sourceStopped  bool
+	targetVolumes  []string // Volumes created on the target
+	targetDeployed bool
+	targetPorts    []PortSpec // Firewall ports opened on the target
+	database       *models.ProvisionedDatabase
+	sourceInstance *models.SharedDatabaseInstance
+	targetInstance *models.SharedDatabaseInstance // Set once the database was copied to the target
+	dedicated      []*dedicatedMove
+}
+
+// publishedPorts returns the host ports the migrated compose file publishes, with its environment substituted
+func (state *migrationState) publishedPorts() []PortSpec {
+	return ExtractPortsFromCompose(interpolateComposeVars(state.compose, parseEnvFile(state.env)))
+}
+
+// dedicatedMove tracks a dedicated database or cache being moved along with its deployment
+type dedicatedMove struct {
+	original      *models.DedicatedInstance
+	moved         *models.DedicatedInstance // The copy on the target, once placed there
+	stopped       bool                      // The original was stopped so its volumes copy consistently
+	targetVolumes []string
+	deployed      bool
+}
+
+// hostBindMountRegex matches compose volume entries that mount a host path
+var hostBindMountRegex = regexp.MustCompile(`(?m)^\s*-\s*["']?((?:/|\./|~|\$\{)[^:"'\s]*):`)
+
+// systemMountPrefixes are host paths present on every device, so not migrating them loses nothing
+var systemMountPrefixes = []string{"/var/run/", "/run/", "/etc/", "/sys/", "/proc/", "/dev/"}
+
+// MigrateDeployment moves a deployment to another device
+// Volumes and the provisioned database are copied device-to-device, and the source is only
+// removed once the deployment is healthy on the target; any failure restores the source
+func (s *DeploymentService) MigrateDeployment(id string, req MigrateDeploymentRequest) (*models.Deployment, error) {
+	deployment, err := s.GetDeployment(id)
+	if err != nil {
+		return nil, fmt.Errorf("deployment not found: %w", err)
+	}
+
+	migratableStatuses := map[models.DeploymentStatus]bool{
+		models.DeploymentStatusRunning:   true,
+		models.DeploymentStatusStopped:   true,
+		models.DeploymentStatusUnhealthy: true,
+	}
+	if !migratableStatuses[deployment.Status] {
+		return nil, fmt.Errorf("deployment cannot be migrated (current status: %s)", deployment.Status)
+	}
+	if err := requireComposeProject(deployment); err != nil {
+		return nil, err
+	}
+	if deployment.IsAdopted() {
+		return nil, fmt.Errorf("adopted deployments cannot be migrated: they may use host directories that only exist on this device")
+	}
+	if req.TargetDeviceID == uuid.Nil {
+		return nil, fmt.Errorf("target device is required")
+	}
+	if req.TargetDeviceID == deployment.DeviceID {
+		return nil, fmt.Errorf("deployment is already on this device")
+	}
+	if !isValidStackName(deployment.ComposeProject) {
+		return nil, fmt.Errorf("invalid compose project: %s", deployment.ComposeProject)
+	}
+
+	recipe, err := s.recipeFor(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("recipe not found: %w", err)
+	}
+
+	source, err := s.deviceService.GetDevice(deployment.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source device: %w", err)
+	}
+	target, err := s.deviceService.GetDevice(req.TargetDeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target device: %w", err)
+	}
+
+	// Validate the target before the source is touched
+	ports, err := migrationPorts(deployment)
+	if err != nil {
+		return nil, err
+	}
+	validation, err := s.resourceValidator.ValidateResourceRequirements(
+		target,
+		s.parseMemoryRequirement(recipe.Requirements.Memory.Minimum),
+		s.parseStorageRequirement(recipe.Requirements.Storage.Minimum),
+		recipe.Requirements.CPU.MinimumCores,
+		ports,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate target resources: %w", err)
+	}
+	if !validation.Valid {
+		return nil, fmt.Errorf("target device %s does not have the required resources: %s", target.Name, describeValidationFailure(validation))
+	}
+	specs, err := deploymentPorts(deployment)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ports.CheckPorts(target, deployment.ID, specs); err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureNoActiveJob(deployment.ID); err != nil {
+		return nil, err
+	}
+
+	// The queue holds both devices for the whole migration
+	job := &models.DeploymentJob{
+		DeploymentID:   deployment.ID,
+		Type:           models.DeploymentJobMigrate,
+		DeviceID:       source.ID,
+		TargetDeviceID: &target.ID,
+	}
+	if err := s.jobQueue.Enqueue(job, req); err != nil {
+		return nil, err
+	}
+
+	return deployment, nil
+}
+
+// executeMigration performs the migration steps and restores the source on failure
+func (s *DeploymentService) executeMigration(ctx context.Context, job *models.DeploymentJob, deployment *models.Deployment, recipe *models.Recipe, source *models.Device, target *models.Device) {
+	sourceHost := source.GetSSHHost()
+	targetHost := target.GetSSHHost()
+	project := deployment.ComposeProject
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+
+	state := &migrationState{previousStatus: deployment.Status}
+	deployment.RollbackLog = nil
+
+	s.appendLog(deployment, fmt.Sprintf("Starting migration of %s from %s to %s", recipe.Name, source.Name, target.Name))
+	if state.previousStatus == models.DeploymentStatusStopped {
+		s.jobQueue.SetPhase(job, migratePhaseSourceWasStopped)
+	}
+	s.updateStatus(deployment, models.DeploymentStatusMigrating, "")
+
+	// Capture the running configuration; the .env carries generated secrets and user config
+	compose, err := s.sshClient.ExecuteWithTimeout(sourceHost, fmt.Sprintf("cat %s/docker-compose.yml", deployDir), 30*time.Second)
+	if err != nil {
+		s.failMigration(deployment, state, fmt.Sprintf("Failed to read compose file on %s: %v", source.Name, err))
+		return
+	}
+	env, _ := s.sshClient.ExecuteWithTimeout(sourceHost, fmt.Sprintf("cat %s/.env 2>/dev/null || true", deployDir), 30*time.Second)
+	state.compose = strings.TrimRight(compose, "\n")
+	state.env = strings.TrimRight(env, "\n")
+
+	state.volumes, err = listProjectVolumes(s.sshClient, sourceHost, project)
+	if err != nil {
+		s.failMigration(deployment, state, fmt.Sprintf("Failed to list volumes on %s: %v", source.Name, err))
+		return
+	}
+	s.appendLog(deployment, fmt.Sprintf("Found %d volume(s) to migrate", len(state.volumes)))
+	if mounts := hostBindMounts(state.compose); len(mounts) > 0 {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Host bind mounts are not migrated and must be copied manually: %s", strings.Join(mounts, ", ")))
+	}
+
+	provisioned, err := s.dbPoolManager.GetProvisionedDatabase(deployment.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.failMigration(deployment, state, fmt.Sprintf("Failed to look up provisioned database: %v", err))
+		return
+	}
+	if provisioned != nil {
+		state.database = provisioned
+		state.sourceInstance = provisioned.SharedDatabaseInstance
+	}
+
+	if ctx.Err() != nil {
+		s.failMigration(deployment, state, "Migration was cancelled")
+		return
+	}
+
+	// Stop the source so volumes and the database are copied in a consistent state
+	if state.previousStatus != models.DeploymentStatusStopped {
+		s.appendLog(deployment, fmt.Sprintf("Stopping containers on %s...", source.Name))
+		// Marked before stopping so a partial stop is still undone by the rollback, also after a restart
+		state.sourceStopped = true
+		s.jobQueue.SetPhase(job, migratePhaseSourceStopped)
+		stopCmd := fmt.Sprintf("cd %s && docker compose -p %s stop", deployDir, project)
+		if output, err := s.sshClient.ExecuteWithTimeout(sourceHost, stopCmd, 2*time.Minute); err != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, fmt.Sprintf("Failed to stop source: %v (output: %s)", err, output))
+			return
+		}
+		s.appendLog(deployment, "✓ Source stopped")
+	}
+
+	// Stream each volume straight into a volume of the same name on the target
+	for _, volume := range state.volumes {
+		if ctx.Err() != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, "Migration was cancelled")
+			return
+		}
+
+		s.appendLog(deployment, fmt.Sprintf("Copying volume %s...", volume))
+		volumeName, transferred, err := s.copyVolume(sourceHost, targetHost, project, volume)
+		if volumeName != "" {
+			state.targetVolumes = append(state.targetVolumes, volumeName)
+		}
+		if err != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, err.Error())
+			return
+		}
+		s.appendLog(deployment, fmt.Sprintf("✓ Volume %s copied (%d bytes compressed)", volume, transferred))
+	}
+
+	// Dedicated databases and caches run as compose projects of their own and move with the deployment
+	instances, err := s.dedicatedInstances.GetInstances(deployment.ID)
+	if err != nil {
+		s.rollbackMigration(deployment, recipe, source, target, state, err.Error())
+		return
+	}
+	for i := range instances {
+		if ctx.Err() != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, "Migration was cancelled")
+			return
+		}
+		if err := s.moveDedicatedInstance(ctx, deployment, &instances[i], source, target, state); err != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, err.Error())
+			return
+		}
+	}
+
+	// Move the database into the target's shared instance
+	envOverrides := map[string]string{"DEVICE_IP": target.GetPrimaryAddress()}
+	if state.database != nil {
+		if ctx.Err() != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, "Migration was cancelled")
+			return
+		}
+
+		s.appendLog(deployment, fmt.Sprintf("Copying database %s...", state.database.DatabaseName))
+		targetInstance, err := s.dbPoolManager.CopyDatabaseToDevice(state.database, source, target)
+		if err != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, fmt.Sprintf("Failed to copy database: %v", err))
+			return
+		}
+		state.targetInstance = targetInstance
+		s.appendLog(deployment, fmt.Sprintf("✓ Database copied into the shared %s instance on %s", targetInstance.Engine, target.Name))
+
+		// Point the application at the copy without touching the stored record until the migration succeeds
+		moved := *state.database
+		moved.SharedDatabaseInstance = targetInstance
+		moved.Host = target.GetPrimaryAddress()
+		moved.Port = targetInstance.Port
+		dbEnv, err := s.environmentBuilder.buildDatabaseEnvVars(&moved, recipe.Database.EnvPrefix)
+		if err != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, fmt.Sprintf("Failed to build database environment: %v", err))
+			return
+		}
+		for key, value := range dbEnv {
+			envOverrides[key] = value
+		}
+	}
+
+	if len(state.dedicated) > 0 {
+		moved := make([]models.DedicatedInstance, len(state.dedicated))
+		for i, move := range state.dedicated {
+			moved[i] = *move.moved
+		}
+		dedicatedEnv, err := s.dedicatedInstances.ConnectionEnvVars(moved, recipe.Database.EnvPrefix)
+		if err != nil {
+			s.rollbackMigration(deployment, recipe, source, target, state, fmt.Sprintf("Failed to build dedicated instance environment: %v", err))
+			return
+		}
+		for key, value := range dedicatedEnv {
+			envOverrides[key] = value
+		}
+	}
+
+	// Deploy the same compose file and configuration on the target
+	s.appendLog(deployment, "Ensuring Docker networks are ready...")
+	if err := s.ensureProxyNetworkExists(target); err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Warning: Failed to ensure proxy network exists: %v", err))
+	}
+	// Recorded before opening so a partly applied change is still undone by the rollback
+	state.targetPorts = state.publishedPorts()
+	s.openFirewallPorts(deployment, target, state.targetPorts)
+
+	// The target may run a different reverse proxy than the source
+	compose = state.compose
+	var pendingRoute *pendingProxyRoute
+	if deployment.Domain != "" {
+		compose, pendingRoute = s.routeDomain(deployment, target, compose, parseEnvFile(state.env))
+	}
+
+	s.appendLog(deployment, fmt.Sprintf("Deploying containers on %s...", target.Name))
+	state.targetDeployed = true
+	if err := s.deployToDeviceWithEnv(target, project, compose, mergeEnvFile(state.env, envOverrides)); err != nil {
+		s.rollbackMigration(deployment, recipe, source, target, state, fmt.Sprintf("Deploy on target failed: %v", err))
+		return
+	}
+	s.appendLog(deployment, "✓ Containers deployed on target")
+
+	s.appendLog(deployment, "Waiting 5 seconds for containers to initialize...")
+	time.Sleep(5 * time.Second)
+
+	if err := s.checkDeploymentHealth(target, deployment, recipe); err != nil {
+		s.rollbackMigration(deployment, recipe, source, target, state, fmt.Sprintf("Health check failed on target: %v", err))
+		return
+	}
+	s.appendLog(deployment, "✓ Health checks passed on target")
+
+	if ctx.Err() != nil {
+		s.rollbackMigration(deployment, recipe, source, target, state, "Migration was cancelled")
+		return
+	}
+
+	// The target is now authoritative
+	if err := s.commitMigration(deployment, target, state); err != nil {
+		s.rollbackMigration(deployment, recipe, source, target, state, err.Error())
+		return
+	}
+	deployment.Device = target
+
+	s.unrouteDomain(deployment, source)
+	s.removeMigrationSource(deployment, source, state)
+	if deployment.Domain != "" && deployment.CertResolver == homelabCAResolver {
+		s.secureDomain(deployment)
+	}
+	if pendingRoute != nil {
+		s.publishRoute(deployment, target, pendingRoute)
+	}
+	s.registerDNS(deployment)
+	if ports, err := deploymentPorts(deployment); err == nil {
+		if err := s.ports.RecordDeploymentPorts(target, deployment.ID, ports); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to record ports on %s: %v", target.Name, err))
+		}
+	}
+	s.recordDependencies(ctx, deployment)
+
+	// A stopped deployment stays stopped on its new device
+	if state.previousStatus == models.DeploymentStatusStopped {
+		stopCmd := fmt.Sprintf("cd %s && docker compose -p %s stop", deployDir, project)
+		if output, err := s.sshClient.ExecuteWithTimeout(targetHost, stopCmd, 2*time.Minute); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to stop deployment on target: %v (output: %s)", err, output))
+		}
+	}
+
+	status := models.DeploymentStatusRunning
+	if state.previousStatus == models.DeploymentStatusStopped {
+		status = models.DeploymentStatusStopped
+	}
+	s.appendLog(deployment, fmt.Sprintf("🎉 Migration to %s completed successfully!", target.Name))
+	s.updateStatus(deployment, status, "")
+}
+
+// removeMigrationSource deletes the containers, files, volumes and database left on the source
+// Failures are logged only: the deployment already runs on the target
+func (s *DeploymentService) removeMigrationSource(deployment *models.Deployment, source *models.Device, state *migrationState) {
+	sourceHost := source.GetSSHHost()
+	project := deployment.ComposeProject
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+
+	s.appendLog(deployment, fmt.Sprintf("Removing deployment from %s...", source.Name))
+	downCmd := fmt.Sprintf("cd %s && docker compose -p %s down --volumes", deployDir, project)
+	if output, err := s.sshClient.ExecuteWithTimeout(sourceHost, downCmd, 5*time.Minute); err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to remove containers from %s: %v (output: %s)", source.Name, err, output))
+	}
+	if _, err := s.sshClient.ExecuteWithTimeout(sourceHost, fmt.Sprintf("rm -rf %s", deployDir), 30*time.Second); err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to remove %s from %s: %v", deployDir, source.Name, err))
+	}
+
+	if state.sourceInstance != nil && state.targetInstance != nil {
+		if err := s.dbPoolManager.DropDatabase(source, state.sourceInstance, state.database.DatabaseName, state.database.Username); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to drop database from %s: %v", source.Name, err))
+		}
+	}
+
+	for _, move := range state.dedicated {
+		if err := s.dedicatedInstances.RemoveFromDevice(move.original, source); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to remove dedicated %s instance from %s: %v", move.original.Engine, source.Name, err))
+		}
+	}
+
+	if ports := state.publishedPorts(); len(ports) > 0 {
+		if err := s.cleanupFirewallPorts(source, deployment.ID, ports); err != nil {
+			log.Printf("[Deployment] Warning: Failed to cleanup firewall ports on %s: %v", source.Name, err)
+		}
+	}
+
+	s.appendLog(deployment, fmt.Sprintf("✓ Source removed from %s", source.Name))
+}
+
+// rollbackMigration removes everything created on the target and restarts the source
+// Each step is recorded in the deployment's RollbackLog
+func (s *DeploymentService) rollbackMigration(deployment *models.Deployment, recipe *models.Recipe, source *models.Device, target *models.Device, state *migrationState, reason string) {
+	s.appendLog(deployment, fmt.Sprintf("❌ %s", reason))
+	s.updateStatus(deployment, models.DeploymentStatusRollingBack, reason)
+	s.appendLog(deployment, fmt.Sprintf("Rolling back - restoring %s on %s...", deployment.RecipeName, source.Name))
+
+	targetHost := target.GetSSHHost()
+	project := deployment.ComposeProject
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+
+	if state.targetDeployed {
+		downCmd := fmt.Sprintf("cd %s && docker compose -p %s down 2>/dev/null; rm -rf %s", deployDir, project, deployDir)
+		_, err := s.sshClient.ExecuteWithTimeout(targetHost, downCmd, 5*time.Minute)
+		s.recordRollbackStep(deployment, "remove_target_containers", err, target.Name)
+	}
+
+	if len(state.targetVolumes) > 0 {
+		removeCmd := fmt.Sprintf("docker volume rm %s", strings.Join(state.targetVolumes, " "))
+		_, err := s.sshClient.ExecuteWithTimeout(targetHost, removeCmd, 2*time.Minute)
+		s.recordRollbackStep(deployment, "remove_target_volumes", err, strings.Join(state.targetVolumes, ", "))
+	}
+
+	if state.targetInstance != nil {
+		err := s.dbPoolManager.DropDatabase(target, state.targetInstance, state.database.DatabaseName, state.database.Username)
+		s.recordRollbackStep(deployment, "remove_target_database", err, state.database.DatabaseName)
+	}
+
+	for _, move := range state.dedicated {
+		if move.deployed {
+			err := s.dedicatedInstances.RemoveFromDevice(move.moved, target)
+			s.recordRollbackStep(deployment, "remove_target_instance", err, move.original.ContainerName)
+		}
+		if len(move.targetVolumes) > 0 {
+			removeCmd := fmt.Sprintf("docker volume rm -f %s", strings.Join(move.targetVolumes, " "))
+			_, err := s.sshClient.ExecuteWithTimeout(targetHost, removeCmd, 2*time.Minute)
+			s.recordRollbackStep(deployment, "remove_target_volumes", err, strings.Join(move.targetVolumes, ", "))
+		}
+	}
+
+	// Ports still used by other deployments on the target stay open
+	if len(state.targetPorts) > 0 {
+		err := s.cleanupFirewallPorts(target, deployment.ID, state.targetPorts)
+		s.recordRollbackStep(deployment, "close_target_ports", err, formatPortSpecs(state.targetPorts))
+	}
+
+	// The app's dedicated instances must run before it restarts
+	for _, move := range state.dedicated {
+		if !move.stopped {
+			continue
+		}
+		startCmd := fmt.Sprintf("cd %s && docker compose -p %s start", dedicatedDeployDir(move.original), move.original.ComposeProject)
+		_, err := s.sshClient.ExecuteWithTimeout(source.GetSSHHost(), startCmd, 5*time.Minute)
+		s.recordRollbackStep(deployment, "restart_source_instance", err, move.original.ContainerName)
+	}
+
+	// Source volumes and the source database were never modified, so restarting is enough
+	if state.sourceStopped {
+		startCmd := fmt.Sprintf("cd %s && docker compose -p %s start", deployDir, project)
+		if output, err := s.sshClient.ExecuteWithTimeout(source.GetSSHHost(), startCmd, 5*time.Minute); err != nil {
+			s.recordRollbackStep(deployment, "restart_source", err, "")
+			s.appendLog(deployment, fmt.Sprintf("❌ Failed to restart source: %v (output: %s)", err, output))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("%s; rollback failed restarting source: %v", reason, err))
+			return
+		}
+		s.recordRollbackStep(deployment, "restart_source", nil, source.Name)
+
+		time.Sleep(5 * time.Second)
+		if err := s.checkDeploymentHealth(source, deployment, recipe); err != nil {
+			s.recordRollbackStep(deployment, "health_check", err, "")
+			s.appendLog(deployment, fmt.Sprintf("❌ Source is unhealthy after rollback: %v", err))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("%s; rollback health check failed: %v", reason, err))
+			return
+		}
+		s.recordRollbackStep(deployment, "health_check", nil, "source is running")
+	}
+
+	s.appendLog(deployment, fmt.Sprintf("↩️  Migration rolled back - %s is still on %s", deployment.RecipeName, source.Name))
+	s.updateStatus(deployment, state.previousStatus, fmt.Sprintf("Migration to %s failed: %s", target.Name, reason))
+}
+
+// recoverMigration rolls back a migration interrupted by a server restart
+// The rollback state is rebuilt from the job's phase and what is left on the target; a migration that
+// already switched the deployment to the target is kept
+func (s *DeploymentService) recoverMigration(job *models.DeploymentJob, deployment *models.Deployment, recipe *models.Recipe, source *models.Device, target *models.Device) {
+	previousStatus := models.DeploymentStatusRunning
+	if job.Phase == migratePhaseSourceWasStopped {
+		previousStatus = models.DeploymentStatusStopped
+	}
+
+	if deployment.DeviceID == target.ID {
+		s.appendLog(deployment, fmt.Sprintf("Migration had already moved %s to %s; files left on %s may need to be removed manually", deployment.RecipeName, target.Name, source.Name))
+		s.updateStatus(deployment, previousStatus, "")
+		return
+	}
+
+	state := &migrationState{
+		previousStatus: previousStatus,
+		sourceStopped:  job.Phase == migratePhaseSourceStopped,
+		targetDeployed: true,
+	}
+	deployment.RollbackLog = nil
+
+	// Volumes of the project on the target can only have been created by this migration
+	volumes, err := listProjectVolumes(s.sshClient, target.GetSSHHost(), deployment.ComposeProject)
+	if err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Failed to list volumes on %s: %v", target.Name, err))
+	}
+	for _, volume := range volumes {
+		state.targetVolumes = append(state.targetVolumes, fmt.Sprintf("%s_%s", deployment.ComposeProject, volume))
+	}
+
+	// A database copy in the target's shared instance has the deployment's own name and user
+	if provisioned, err := s.dbPoolManager.GetProvisionedDatabase(deployment.ID); err == nil && provisioned.SharedDatabaseInstance != nil {
+		var instance models.SharedDatabaseInstance
+		if err := s.db.Where("device_id = ? AND engine = ?", target.ID, provisioned.SharedDatabaseInstance.Engine).First(&instance).Error; err == nil {
+			state.database = provisioned
+			state.targetInstance = &instance
+		}
+	}
+	targetDir := fmt.Sprintf("~/homelab-deployments/%s", deployment.ComposeProject)
+	if compose, err := s.sshClient.ExecuteWithTimeout(target.GetSSHHost(), fmt.Sprintf("cat %s/docker-compose.yml 2>/dev/null || true", targetDir), 30*time.Second); err == nil {
+		state.compose = strings.TrimRight(compose, "\n")
+	}
+	if env, err := s.sshClient.ExecuteWithTimeout(target.GetSSHHost(), fmt.Sprintf("cat %s/.env 2>/dev/null || true", targetDir), 30*time.Second); err == nil {
+		state.env = strings.TrimRight(env, "\n")
+	}
+	state.targetPorts = state.publishedPorts()
+
+	// Copies of dedicated instances use the original's compose project on the target
+	instances, err := s.dedicatedInstances.GetInstances(deployment.ID)
+	if err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  %v", err))
+	}
+	for i := range instances {
+		original := &instances[i]
+		moved := *original
+		moved.DeviceID = target.ID
+		move := &dedicatedMove{original: original, moved: &moved, stopped: state.sourceStopped, deployed: true}
+		if volumes, err := listProjectVolumes(s.sshClient, target.GetSSHHost(), original.ComposeProject); err == nil {
+			for _, volume := range volumes {
+				move.targetVolumes = append(move.targetVolumes, fmt.Sprintf("%s_%s", original.ComposeProject, volume))
+			}
+		}
+		state.dedicated = append(state.dedicated, move)
+	}
+
+	s.rollbackMigration(deployment, recipe, source, target, state, "Interrupted by a server restart")
+}
+
+// copyVolume streams a compose volume into a volume of the same name on the target
+// Returns the volume's name once it exists on the target, so a rollback can remove it
+func (s *DeploymentService) copyVolume(sourceHost, targetHost, project, volume string) (string, int64, error) {
+	volumeName := fmt.Sprintf("%s_%s", project, volume)
+
+	// Compose labels let docker compose adopt the volume instead of warning about it
+	createCmd := fmt.Sprintf("docker volume create --label com.docker.compose.project=%s --label com.docker.compose.volume=%s %s", project, volume, volumeName)
+	if output, err := s.sshClient.ExecuteWithTimeout(targetHost, createCmd, 1*time.Minute); err != nil {
+		return "", 0, fmt.Errorf("failed to create volume %s on target: %v (output: %s)", volume, err, output)
+	}
+
+	readCmd := fmt.Sprintf("docker run --rm -v %s:/source:ro %s tar czf - -C /source .", volumeName, backupHelperImage)
+	writeCmd := fmt.Sprintf("docker run --rm -i -v %s:/target %s tar xzf - -C /target", volumeName, backupHelperImage)
+	transferred, err := s.sshClient.Stream(sourceHost, readCmd, targetHost, writeCmd, 6*time.Hour)
+	if err != nil {
+		return volumeName, 0, fmt.Errorf("failed to copy volume %s: %v", volume, err)
+	}
+	return volumeName, transferred, nil
+}
+
+// moveDedicatedInstance stops a dedicated instance on the source and starts a copy of it on the target
+// The original is only removed once the migration succeeds
+func (s *DeploymentService) moveDedicatedInstance(ctx context.Context, deployment *models.Deployment, instance *models.DedicatedInstance, source *models.Device, target *models.Device, state *migrationState) error {
+	sourceHost := source.GetSSHHost()
+	move := &dedicatedMove{original: instance}
+	state.dedicated = append(state.dedicated, move)
+
+	s.appendLog(deployment, fmt.Sprintf("Moving dedicated %s instance %s...", instance.Engine, instance.ContainerName))
+	move.stopped = true
+	stopCmd := fmt.Sprintf("cd %s && docker compose -p %s stop", dedicatedDeployDir(instance), instance.ComposeProject)
+	if output, err := s.sshClient.ExecuteWithTimeout(sourceHost, stopCmd, 2*time.Minute); err != nil {
+		return fmt.Errorf("failed to stop dedicated %s instance: %v (output: %s)", instance.Engine, err, output)
+	}
+
+	volumes, err := listProjectVolumes(s.sshClient, sourceHost, instance.ComposeProject)
+	if err != nil {
+		return fmt.Errorf("failed to list volumes of dedicated %s instance: %w", instance.Engine, err)
+	}
+	for _, volume := range volumes {
+		volumeName, _, err := s.copyVolume(sourceHost, target.GetSSHHost(), instance.ComposeProject, volume)
+		if volumeName != "" {
+			move.targetVolumes = append(move.targetVolumes, volumeName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	moved, err := s.dedicatedInstances.PlaceOnDevice(instance, target)
+	if err != nil {
+		return err
+	}
+	move.moved = moved
+	move.deployed = true
+	if err := s.dedicatedInstances.StartCopy(ctx, moved, target); err != nil {
+		return fmt.Errorf("failed to start dedicated %s instance on %s: %w", instance.Engine, target.Name, err)
+	}
+	s.appendLog(deployment, fmt.Sprintf("✓ Dedicated %s instance running on %s (port %d)", instance.Engine, target.Name, moved.Port))
+	return nil
+}
+
+// commitMigration points the deployment, its provisioned database and its dedicated instances at the target
+// in one transaction, so a failure leaves every record on the source for the rollback to restore
+func (s *DeploymentService) commitMigration(deployment *models.Deployment, target *models.Device, state *migrationState) error {
+	sourceID := deployment.DeviceID
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if state.targetInstance != nil {
+			if err := s.dbPoolManager.MoveProvisionedDatabase(tx, state.database, state.targetInstance, target); err != nil {
+				return err
+			}
+		}
+		for _, move := range state.dedicated {
+			if err := s.dedicatedInstances.MoveInstance(tx, move.moved); err != nil {
+				return err
+			}
+		}
+
+		deployment.DeviceID = target.ID
+		deployment.HealthFailures = 0
+		if err := tx.Save(deployment).Error; err != nil {
+			return fmt.Errorf("failed to record new device: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		deployment.DeviceID = sourceID
+	}
+	return err
+}
+
+// failMigration aborts a migration before anything on either device was changed
+func (s *DeploymentService) failMigration(deployment *models.Deployment, state *migrationState, reason string) {
+	s.appendLog(deployment, fmt.Sprintf("❌ %s", reason))
+	s.appendLog(deployment, "Migration aborted - the deployment was not changed")
+	s.updateStatus(deployment, state.previousStatus, reason)
+}
+
+// openFirewallPorts opens a deployment's published ports on a device, warning on failure
+func (s *DeploymentService) openFirewallPorts(deployment *models.Deployment, device *models.Device, ports []PortSpec) {
+	if len(ports) == 0 {
+		return
+	}
+
+	firewallStatus, err := s.firewallService.CheckFirewall(device)
+	if err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Could not check firewall: %v", err))
+		return
+	}
+	if !firewallStatus.Installed || !firewallStatus.Enabled {
+		return
+	}
+
+	if err := s.firewallService.OpenPorts(device, ports); err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  Warning: Failed to open firewall ports: %v", err))
+		return
+	}
+	s.appendLog(deployment, fmt.Sprintf("✓ Firewall ports opened: %s", formatPortSpecs(ports)))
+}
+
+// migrationPorts returns the host port numbers a deployment publishes
+func migrationPorts(deployment *models.Deployment) ([]int, error) {
+	specs, err := deploymentPorts(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := []int{}
+	seen := make(map[int]bool)
+	for _, spec := range specs {
+		if !seen[spec.Port] {
+			seen[spec.Port] = true
+			ports = append(ports, spec.Port)
+		}
+	}
+	return ports, nil
+}
+
+// hostBindMounts returns the host paths a compose file mounts, excluding system paths
+func hostBindMounts(compose string) []string {
+	mounts := []string{}
+	for _, match := range hostBindMountRegex.FindAllStringSubmatch(compose, -1) {
+		path := match[1]
+		system := false
+		for _, prefix := range systemMountPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				system = true
+				break
+			}
+		}
+		if !system && !containsString(mounts, path) {
+			mounts = append(mounts, path)
+		}
+	}
+	return mounts
+}
+
+// describeValidationFailure summarises why a device failed resource validation
+func describeValidationFailure(result *ResourceValidationResult) string {
+	reasons := []string{}
+	if !result.RAMSufficient {
+		reasons = append(reasons, fmt.Sprintf("insufficient RAM (%dMB available)", result.DeviceResources.AvailableRAMMB))
+	}
+	if !result.StorageSufficient {
+		reasons = append(reasons, fmt.Sprintf("insufficient storage (%dGB available)", result.DeviceResources.AvailableStorageGB))
+	}
+	if !result.CPUSufficient {
+		reasons = append(reasons, fmt.Sprintf("insufficient CPU cores (%d available)", result.DeviceResources.CPUCores))
+	}
+	if !result.PortsAvailable {
+		ports := make([]string, len(result.PortConflicts))
+		for i, port := range result.PortConflicts {
+			ports[i] = fmt.Sprintf("%d", port)
+		}
+		reasons = append(reasons, fmt.Sprintf("ports already in use (%s)", strings.Join(ports, ", ")))
+	}
+	return strings.Join(reasons, "; ")
+}
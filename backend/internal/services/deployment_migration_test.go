@@ -0,0 +1,203 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestHostBindMounts(t *testing.T) {
+	compose := `services:
+  server:
+    volumes:
+      - ${UPLOAD_LOCATION}:/usr/src/app/upload
+      - /etc/localtime:/etc/localtime:ro
+      - "/var/run/docker.sock:/var/run/docker.sock:ro"
+      - ./config:/config
+      - app-data:/data
+  worker:
+    volumes:
+      - ${UPLOAD_LOCATION}:/usr/src/app/upload
+      - /mnt/media:/media:ro
+`
+	assert.Equal(t, []string{"${UPLOAD_LOCATION}", "./config", "/mnt/media"}, hostBindMounts(compose))
+	assert.Empty(t, hostBindMounts("services:\n  app:\n    volumes:\n      - data:/data\n"))
+}
+
+func TestMigrationPorts(t *testing.T) {
+	deployment := &models.Deployment{
+		GeneratedCompose: "services:\n  app:\n    ports:\n      - \"${WEB_PORT:-8080}:80\"\n      - \"3478:3478/udp\"\n      - \"3478:3478/tcp\"\n",
+	}
+
+	ports, err := migrationPorts(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, []int{8080, 3478}, ports, "compose defaults are used and ports are deduplicated across protocols")
+
+	deployment.Config, _ = json.Marshal(map[string]interface{}{"web_port": 9090})
+	ports, err = migrationPorts(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, []int{9090, 3478}, ports)
+}
+
+func TestMigrationState_PublishedPorts(t *testing.T) {
+	// Recipes like nextcloud and portainer publish their host ports through variables
+	state := &migrationState{
+		compose: "services:\n  app:\n    ports:\n      - \"${PORT}:80\"\n      - \"${WEB_PORT:-9000}:9000\"\n      - \"3478:3478/udp\"\n",
+		env:     "PORT=8081\nDB_PASSWORD=secret",
+	}
+	assert.Equal(t, []string{"8081/tcp", "9000/tcp", "3478/udp"}, portSpecStrings(state.publishedPorts()))
+
+	state.env = "PORT=8081\nWEB_PORT=9443"
+	assert.Equal(t, []string{"8081/tcp", "9443/tcp", "3478/udp"}, portSpecStrings(state.publishedPorts()))
+}
+
+func TestDescribeValidationFailure(t *testing.T) {
+	result := &ResourceValidationResult{
+		DeviceResources:   &ResourceStatus{AvailableRAMMB: 256, AvailableStorageGB: 40, CPUCores: 4},
+		RAMSufficient:     false,
+		StorageSufficient: true,
+		CPUSufficient:     true,
+		PortsAvailable:    false,
+		PortConflicts:     []int{80, 443},
+	}
+
+	assert.Equal(t, "insufficient RAM (256MB available); ports already in use (80, 443)", describeValidationFailure(result))
+}
+
+func TestDatabaseMigrationCommands(t *testing.T) {
+	dpm := &DatabasePoolManager{}
+	instance := &models.SharedDatabaseInstance{Engine: "postgres", ContainerName: "homelab-postgres-shared", MasterUsername: "postgres"}
+
+	dump, err := dpm.generateDumpCommand(instance, "nextcloud_abc123")
+	require.NoError(t, err)
+	assert.Equal(t, "docker exec homelab-postgres-shared pg_dump -U postgres nextcloud_abc123", dump)
+
+	restore, err := dpm.generateRestoreCommand(instance, "nextcloud_abc123")
+	require.NoError(t, err)
+	assert.Equal(t, "docker exec -i homelab-postgres-shared psql -q -v ON_ERROR_STOP=1 -U postgres -d nextcloud_abc123", restore)
+
+	_, err = dpm.generateDumpCommand(&models.SharedDatabaseInstance{Engine: "mongodb"}, "db")
+	assert.Error(t, err)
+}
+
+func TestMigrateDeployment_Validation(t *testing.T) {
+	db := setupTestDB(t)
+	credService, _ := NewCredentialService()
+	deviceService := NewDeviceService(db, credService, nil)
+	mockRecipeLoader := NewMockRecipeLoader(map[string]*models.Recipe{
+		"vaultwarden": {Slug: "vaultwarden", Name: "Vaultwarden"},
+	})
+	deploymentService := NewDeploymentService(db, nil, mockRecipeLoader, deviceService, credService, nil, nil, nil)
+
+	device := models.Device{Name: "old-mini-pc", Type: models.DeviceTypeServer}
+	require.NoError(t, db.Create(&device).Error)
+
+	deployment := models.Deployment{RecipeSlug: "vaultwarden", DeviceID: device.ID, ComposeProject: "vaultwarden-abc123", Status: models.DeploymentStatusDeploying}
+	require.NoError(t, db.Create(&deployment).Error)
+
+	// In-progress deployments cannot be migrated
+	_, err := deploymentService.MigrateDeployment(deployment.ID.String(), MigrateDeploymentRequest{TargetDeviceID: uuid.New()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be migrated")
+
+	require.NoError(t, db.Model(&deployment).Update("status", models.DeploymentStatusRunning).Error)
+
+	_, err = deploymentService.MigrateDeployment(deployment.ID.String(), MigrateDeploymentRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "target device is required")
+
+	_, err = deploymentService.MigrateDeployment(deployment.ID.String(), MigrateDeploymentRequest{TargetDeviceID: device.ID})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already on this device")
+
+	_, err = deploymentService.MigrateDeployment(deployment.ID.String(), MigrateDeploymentRequest{TargetDeviceID: uuid.New()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get target device")
+
+	// Nothing was changed by the rejected requests
+	var reloaded models.Deployment
+	require.NoError(t, db.First(&reloaded, "id = ?", deployment.ID).Error)
+	assert.Equal(t, models.DeploymentStatusRunning, reloaded.Status)
+	assert.Equal(t, device.ID, reloaded.DeviceID)
+}
+
+func TestCommitMigration_RollsBackWithTheDeployment(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	source := &models.Device{Name: "old-mini-pc", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.20"}
+	target := &models.Device{Name: "new-server", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.21"}
+	require.NoError(t, db.Create(source).Error)
+	require.NoError(t, db.Create(target).Error)
+
+	sourceInstance := &models.SharedDatabaseInstance{DeviceID: source.ID, Engine: "postgres", Version: "16", ContainerName: "homelab-postgres-shared",
+		ComposeProject: "homelab-postgres-shared", Port: 5432, InternalPort: 5432, MasterUsername: "postgres", CredentialKey: "source-master", DatabaseCount: 1}
+	targetInstance := &models.SharedDatabaseInstance{DeviceID: target.ID, Engine: "postgres", Version: "16", ContainerName: "homelab-postgres-shared",
+		ComposeProject: "homelab-postgres-shared", Port: 5433, InternalPort: 5432, MasterUsername: "postgres", CredentialKey: "target-master"}
+	require.NoError(t, db.Create(sourceInstance).Error)
+	require.NoError(t, db.Create(targetInstance).Error)
+
+	deployment := &models.Deployment{RecipeSlug: "nextcloud", DeviceID: source.ID, ComposeProject: "nextcloud-abc123", Status: models.DeploymentStatusMigrating}
+	require.NoError(t, db.Create(deployment).Error)
+	provisioned := &models.ProvisionedDatabase{DeploymentID: deployment.ID, SharedDatabaseInstanceID: sourceInstance.ID, DatabaseName: "nextcloud_abc123",
+		Username: "nextcloud_user", CredentialKey: "nextcloud-db", Host: "192.168.1.20", Port: 5432}
+	require.NoError(t, db.Create(provisioned).Error)
+	cache := &models.DedicatedInstance{DeploymentID: deployment.ID, DeviceID: source.ID, Kind: models.DedicatedInstanceKindCache, Engine: "valkey", Version: "8.1",
+		Image: "valkey/valkey", ContainerName: "nextcloud-valkey-1", ComposeProject: "nextcloud-valkey-1", Port: 6379, Status: "running"}
+	require.NoError(t, db.Create(cache).Error)
+
+	moved := *cache
+	moved.DeviceID = target.ID
+	moved.Port = 6380
+	state := &migrationState{database: provisioned, sourceInstance: sourceInstance, targetInstance: targetInstance,
+		dedicated: []*dedicatedMove{{original: cache, moved: &moved, deployed: true}}}
+
+	// A failed deployment save leaves every record on the source, where the rollback restarts the app
+	failSave := true
+	require.NoError(t, db.Callback().Update().Before("gorm:update").Register("test:fail_deployment_save", func(tx *gorm.DB) {
+		if failSave && tx.Statement.Table == "deployments" {
+			tx.AddError(errors.New("database is locked"))
+		}
+	}))
+	err := service.commitMigration(deployment, target, state)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to record new device")
+	assert.Equal(t, source.ID, deployment.DeviceID)
+
+	var storedDatabase models.ProvisionedDatabase
+	require.NoError(t, db.First(&storedDatabase, "id = ?", provisioned.ID).Error)
+	assert.Equal(t, sourceInstance.ID, storedDatabase.SharedDatabaseInstanceID, "the target copy can be dropped without losing the record")
+	var storedCache models.DedicatedInstance
+	require.NoError(t, db.First(&storedCache, "id = ?", cache.ID).Error)
+	assert.Equal(t, source.ID, storedCache.DeviceID)
+	var storedSource models.SharedDatabaseInstance
+	require.NoError(t, db.First(&storedSource, "id = ?", sourceInstance.ID).Error)
+	assert.Equal(t, 1, storedSource.DatabaseCount)
+
+	failSave = false
+	require.NoError(t, service.commitMigration(deployment, target, state))
+
+	var storedDeployment models.Deployment
+	require.NoError(t, db.First(&storedDeployment, "id = ?", deployment.ID).Error)
+	assert.Equal(t, target.ID, storedDeployment.DeviceID)
+	require.NoError(t, db.First(&storedDatabase, "id = ?", provisioned.ID).Error)
+	assert.Equal(t, targetInstance.ID, storedDatabase.SharedDatabaseInstanceID)
+	assert.Equal(t, "192.168.1.21", storedDatabase.Host)
+	assert.Equal(t, 5433, storedDatabase.Port)
+	require.NoError(t, db.First(&storedCache, "id = ?", cache.ID).Error)
+	assert.Equal(t, target.ID, storedCache.DeviceID)
+	assert.Equal(t, 6380, storedCache.Port)
+
+	var storedTarget models.SharedDatabaseInstance
+	require.NoError(t, db.First(&storedSource, "id = ?", sourceInstance.ID).Error)
+	require.NoError(t, db.First(&storedTarget, "id = ?", targetInstance.ID).Error)
+	assert.Equal(t, 0, storedSource.DatabaseCount)
+	assert.Equal(t, 1, storedTarget.DatabaseCount)
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+// plannedValue stands in for values that are only known once a deployment is created
+const plannedValue = "<assigned on deploy>"
+
+// DeploymentPlan describes everything creating a deployment would do, without changing anything
+// Secret values are masked; pass ComposeProject back in CreateDeploymentRequest to deploy under the planned name
+type DeploymentPlan struct {
+	RecipeSlug         string                 `json:"recipe_slug"`
+	RecipeName         string                 `json:"recipe_name"`
+	DeviceID           uuid.UUID              `json:"device_id"`
+	DeviceName         string                 `json:"device_name"`
+	AutoSelectedDevice bool                   `json:"auto_selected_device"`
+	ComposeProject     string                 `json:"compose_project"`
+	Dependencies       *DependencyCheckResult `json:"dependencies,omitempty"`
+	Allocations        []PlannedAllocation    `json:"allocations"`
+	Compose            string                 `json:"compose"`  // Compose file with variables substituted
+	EnvVars            []string               `json:"env_vars"` // Names of the variables written to .env
+	Ports              []string               `json:"ports"`    // Firewall ports that will be opened, e.g. "8080/tcp"
+	Resources          PlanResourceImpact     `json:"resources"`
+	Warnings           []string               `json:"warnings"`
+}
+
+// PlannedAllocation is a database or cache the deployment will get
+type PlannedAllocation struct {
+	Type            string `json:"type"` // "database" or "cache"
+	Engine          string `json:"engine"`
+	Version         string `json:"version,omitempty"`
+	Shared          bool   `json:"shared"`                     // In a shared instance rather than a dedicated container
+	Action          string `json:"action"`                     // e.g. "create_in_shared", "configure_in_shared", "deploy"
+	Instance        string `json:"instance,omitempty"`         // Existing shared instance container
+	CreatesInstance bool   `json:"creates_instance,omitempty"` // A new shared instance is deployed first
+	DatabaseName    string `json:"database_name,omitempty"`
+	Username        string `json:"username,omitempty"`
+	RAMMB           int    `json:"ram_mb"`
+	StorageGB       int    `json:"storage_gb"`
+}
+
+// PlanResourceImpact compares what a deployment needs with the device's last reported metrics
+type PlanResourceImpact struct {
+	RequiredRAMMB      int        `json:"required_ram_mb"` // Recipe minimum plus new instances and dependencies
+	RequiredStorageGB  int        `json:"required_storage_gb"`
+	RequiredCPUCores   int        `json:"required_cpu_cores"`
+	AvailableRAMMB     *int       `json:"available_ram_mb,omitempty"`
+	AvailableStorageGB *int       `json:"available_storage_gb,omitempty"`
+	CPUCores           *int       `json:"cpu_cores,omitempty"`
+	RemainingRAMMB     *int       `json:"remaining_ram_mb,omitempty"` // Available minus required
+	RemainingStorageGB *int       `json:"remaining_storage_gb,omitempty"`
+	MetricsUpdatedAt   *time.Time `json:"metrics_updated_at,omitempty"`
+	Fits               bool       `json:"fits"` // False if the metrics show too little RAM or storage
+}
+
+// PlanDeployment returns what CreateDeployment would do for a request without touching the device
+// The request is validated exactly as CreateDeployment validates it
+func (s *DeploymentService) PlanDeployment(req CreateDeploymentRequest) (*DeploymentPlan, error) {
+	recipe, err := s.recipeLoader.GetRecipe(req.RecipeSlug)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRecipeNotFound, req.RecipeSlug)
+	}
+	if err := recipe.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRecipeValidationFailed, err)
+	}
+	if err := s.configValidator.Validate(recipe, req.Config); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	composeProject := req.ComposeProject
+	if composeProject == "" {
+		composeProject = s.generateProjectName(recipe.Slug)
+	} else if err := s.validateComposeProject(composeProject); err != nil {
+		return nil, err
+	}
+
+	deviceID, err := s.selectDevice(req, recipe)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.deviceService.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("device not found: %w", err)
+	}
+
+	plan := &DeploymentPlan{
+		RecipeSlug:         recipe.Slug,
+		RecipeName:         recipe.Name,
+		DeviceID:           device.ID,
+		DeviceName:         device.Name,
+		AutoSelectedDevice: req.AutoSelectDevice || req.DeviceID == uuid.Nil,
+		ComposeProject:     composeProject,
+		Allocations:        []PlannedAllocation{},
+		Warnings:           []string{},
+	}
+
+	if len(recipe.Dependencies.Required) > 0 || len(recipe.Dependencies.Recommended) > 0 {
+		if s.dependencyService == nil {
+			return nil, ErrDependencyServiceNotInit
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DependencyCheckTimeout)
+		defer cancel()
+
+		plan.Dependencies, err = s.dependencyService.CheckDependencies(ctx, recipe, device.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDependencyCheckFailed, err)
+		}
+		plan.Warnings = append(plan.Warnings, plan.Dependencies.Warnings...)
+	}
+
+	// Ports are assigned on a copy, exactly as CreateDeployment would assign them
+	config := make(map[string]interface{}, len(req.Config))
+	for key, value := range req.Config {
+		config[key] = value
+	}
+	portNotes, err := s.assignRecipePorts(recipe, device, config)
+	if err != nil {
+		return nil, err
+	}
+	plan.Warnings = append(plan.Warnings, portNotes...)
+
+	// The deployment ID is only assigned on create, so values derived from it are placeholders
+	deployment := &models.Deployment{RecipeSlug: recipe.Slug, ComposeProject: composeProject}
+
+	previewDB, err := s.planDatabase(plan, recipe, device)
+	if err != nil {
+		return nil, err
+	}
+	dedicatedEnv := s.planDependencyAllocations(plan, recipe)
+
+	env := s.environmentBuilder.PreviewEnvironment(deployment, recipe, config, device, previewDB, maskedEnvValue)
+	env["DEPLOYMENT_ID"] = plannedValue
+	for key, value := range dedicatedEnv {
+		env[key] = value
+	}
+
+	sensitive := sensitiveEnvKeys(recipe, env)
+	plan.Compose = interpolateComposeVars(recipe.ComposeContent, maskEnvVars(env, sensitive))
+	for key := range env {
+		plan.EnvVars = append(plan.EnvVars, key)
+	}
+	sort.Strings(plan.EnvVars)
+
+	// Ports come from the compose file with the real config substituted, not the masked one
+	ports := ExtractPortsFromCompose(interpolateComposeVars(recipe.ComposeContent, env))
+	plan.Ports = portSpecStrings(ports)
+	// Ports not set through a recipe option can't be reassigned, so creating the deployment would fail
+	var conflict *PortConflictError
+	if err := s.ports.CheckPorts(device, uuid.Nil, ports); errors.As(err, &conflict) {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("Deployment would be rejected, %s", conflict.Error()))
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.planResources(plan, recipe, device)
+
+	return plan, nil
+}
+
+// planDatabase records the recipe's pooled database and returns a stand-in for its env vars
+func (s *DeploymentService) planDatabase(plan *DeploymentPlan, recipe *models.Recipe, device *models.Device) (*models.ProvisionedDatabase, error) {
+	if !recipe.Database.AutoProvision || recipe.Database.Engine == "none" || recipe.Database.Engine == "" {
+		return nil, nil
+	}
+
+	allocation := PlannedAllocation{
+		Type:         "database",
+		Engine:       recipe.Database.Engine,
+		Version:      recipe.Database.Version,
+		Shared:       true,
+		Action:       "create_in_shared",
+		DatabaseName: fmt.Sprintf("%s_%s", strings.ReplaceAll(recipe.Slug, "-", "_"), plannedValue),
+		Username:     s.dbPoolManager.generateUsername(recipe.Slug),
+	}
+	previewDB := &models.ProvisionedDatabase{
+		DatabaseName: plannedValue,
+		Username:     allocation.Username,
+		Host:         device.GetPrimaryAddress(),
+	}
+
+	var instance models.SharedDatabaseInstance
+	err := s.db.Where("device_id = ? AND engine = ?", device.ID, recipe.Database.Engine).First(&instance).Error
+	switch {
+	case err == nil:
+		allocation.Instance = instance.ContainerName
+		allocation.Version = instance.Version
+		previewDB.Port = instance.Port
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		allocation.CreatesInstance = true
+		if infraConfig := s.dbPoolManager.infraConfig; infraConfig != nil {
+			allocation.RAMMB = infraConfig.GetDatabaseRAM(recipe.Database.Engine)
+			previewDB.Port = infraConfig.GetDatabasePort(recipe.Database.Engine)
+		}
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("A shared %s instance will be created on %s", recipe.Database.Engine, device.Name))
+	default:
+		return nil, fmt.Errorf("failed to query shared database instance: %w", err)
+	}
+
+	plan.Allocations = append(plan.Allocations, allocation)
+	return previewDB, nil
+}
+
+// planDependencyAllocations records the databases and caches provisioned as dependencies
+// Returns placeholder env vars for the dedicated instances the app will be pointed at
+func (s *DeploymentService) planDependencyAllocations(plan *DeploymentPlan, recipe *models.Recipe) map[string]string {
+	env := make(map[string]string)
+	if plan.Dependencies == nil {
+		return env
+	}
+
+	for _, provision := range plan.Dependencies.ToProvision {
+		if provision.Type != "database" && provision.Type != "cache" {
+			continue
+		}
+		plan.Allocations = append(plan.Allocations, PlannedAllocation{
+			Type:      provision.Type,
+			Engine:    provision.Config["engine"],
+			Version:   provision.Config["version"],
+			Shared:    provision.UseSharedInstance,
+			Action:    provision.Action,
+			RAMMB:     provision.RAMRequired,
+			StorageGB: provision.StorageRequired,
+		})
+		if provision.UseSharedInstance {
+			continue
+		}
+
+		var keys []string
+		if provision.Type == "database" {
+			envPrefix := recipe.Database.EnvPrefix
+			if envPrefix == "" {
+				envPrefix = "DB_"
+			}
+			for key := range (&models.ProvisionedDatabase{}).GetConnectionEnvVars(envPrefix) {
+				keys = append(keys, key)
+			}
+			keys = append(keys, envPrefix+"PASSWORD", envPrefix+"CONNECTION_STRING")
+		} else {
+			for key := range cacheConnectionEnvVars("", 0, "", provision.Config["engine"], 0, "") {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			env[key] = plannedValue
+		}
+	}
+	return env
+}
+
+// planResources compares the plan's requirements with the device's last reported metrics
+func (s *DeploymentService) planResources(plan *DeploymentPlan, recipe *models.Recipe, device *models.Device) {
+	resources := PlanResourceImpact{
+		RequiredRAMMB:      s.parseMemoryRequirement(recipe.Requirements.Memory.Minimum),
+		RequiredStorageGB:  s.parseStorageRequirement(recipe.Requirements.Storage.Minimum),
+		RequiredCPUCores:   recipe.Requirements.CPU.MinimumCores,
+		AvailableRAMMB:     device.AvailableRAMMB,
+		AvailableStorageGB: device.AvailableStorageGB,
+		CPUCores:           device.CPUCores,
+		MetricsUpdatedAt:   device.ResourcesUpdatedAt,
+		Fits:               true,
+	}
+	for _, allocation := range plan.Allocations {
+		if allocation.Shared && allocation.CreatesInstance {
+			resources.RequiredRAMMB += allocation.RAMMB
+		}
+	}
+	if plan.Dependencies != nil {
+		resources.RequiredRAMMB += plan.Dependencies.ResourceImpact.TotalRAMMB
+		resources.RequiredStorageGB += plan.Dependencies.ResourceImpact.TotalStorageGB
+	}
+
+	if device.ResourcesUpdatedAt == nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("No resource metrics reported for %s yet - resource impact can't be checked", device.Name))
+	}
+	if device.AvailableRAMMB != nil {
+		remaining := *device.AvailableRAMMB - resources.RequiredRAMMB
+		resources.RemainingRAMMB = &remaining
+		if remaining < 0 {
+			resources.Fits = false
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Not enough free RAM: %dMB needed, %dMB available", resources.RequiredRAMMB, *device.AvailableRAMMB))
+		}
+	}
+	if device.AvailableStorageGB != nil {
+		remaining := *device.AvailableStorageGB - resources.RequiredStorageGB
+		resources.RemainingStorageGB = &remaining
+		if remaining < 0 {
+			resources.Fits = false
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Not enough free storage: %dGB needed, %dGB available", resources.RequiredStorageGB, *device.AvailableStorageGB))
+		}
+	}
+	if device.CPUCores != nil && *device.CPUCores < resources.RequiredCPUCores {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s has %d CPU cores (app recommends %d)", device.Name, *device.CPUCores, resources.RequiredCPUCores))
+	}
+
+	plan.Resources = resources
+}
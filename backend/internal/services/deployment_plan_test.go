@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func planTestRecipe() *models.Recipe {
+	recipe := &models.Recipe{
+		Slug: "wiki-js",
+		Name: "Wiki.js",
+		ConfigOptions: []models.RecipeConfigOption{
+			{Name: "web_port", Type: "number"},
+			{Name: "admin_password", Type: "password", Required: true},
+			{Name: "session_secret", Type: "secret"},
+		},
+		Database: models.RecipeDatabaseConfig{Engine: "postgres", AutoProvision: true, Version: "16"},
+		ComposeContent: `services:
+  wiki:
+    image: ghcr.io/requarks/wiki:2
+    ports:
+      - "${WEB_PORT:-3000}:3000"
+    environment:
+      DB_HOST: ${DB_HOST}
+      DB_NAME: ${DB_NAME}
+      DB_PASS: ${DB_PASSWORD}
+      ADMIN_PASSWORD: ${ADMIN_PASSWORD}`,
+	}
+	recipe.Requirements.Memory.Minimum = "512MB"
+	recipe.Requirements.Storage.Minimum = "2GB"
+	return recipe
+}
+
+func TestPlanDeployment(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	deviceService := NewDeviceService(db, credService, nil)
+	recipe := planTestRecipe()
+	deploymentService := NewDeploymentService(db, nil, NewMockRecipeLoader(map[string]*models.Recipe{recipe.Slug: recipe}), deviceService, credService, nil, nil, nil)
+
+	availableRAM, availableStorage, cores := 4096, 100, 4
+	updatedAt := time.Now()
+	device := models.Device{
+		Name: "server", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.20",
+		AvailableRAMMB: &availableRAM, AvailableStorageGB: &availableStorage, CPUCores: &cores, ResourcesUpdatedAt: &updatedAt,
+	}
+	require.NoError(t, db.Create(&device).Error)
+	require.NoError(t, db.Create(&models.SharedDatabaseInstance{
+		DeviceID: device.ID, Engine: "postgres", Version: "15", Status: "running",
+		ContainerName: "homelab-postgres-shared", ComposeProject: "homelab-postgres", Port: 5432, InternalPort: 5432,
+		MasterUsername: "postgres", CredentialKey: "db-master",
+	}).Error)
+
+	plan, err := deploymentService.PlanDeployment(CreateDeploymentRequest{
+		RecipeSlug: recipe.Slug,
+		DeviceID:   device.ID,
+		Config:     map[string]interface{}{"web_port": 8088, "admin_password": "Sup3r-Secret-Pass!"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, device.ID, plan.DeviceID)
+	assert.False(t, plan.AutoSelectedDevice)
+	assert.Regexp(t, `^wiki-js-[0-9a-f]{8}$`, plan.ComposeProject)
+
+	require.Len(t, plan.Allocations, 1)
+	assert.Equal(t, PlannedAllocation{
+		Type: "database", Engine: "postgres", Version: "15", Shared: true, Action: "create_in_shared",
+		Instance: "homelab-postgres-shared", DatabaseName: "wiki_js_" + plannedValue, Username: "wiki_js_user",
+	}, plan.Allocations[0])
+
+	assert.Equal(t, []string{
+		"ADMIN_PASSWORD", "ADMIN_PASSWORD_HASH", "COMPOSE_PROJECT", "DB_CONNECTION_STRING", "DB_HOST", "DB_NAME",
+		"DB_PASSWORD", "DB_PORT", "DB_USER", "DEPLOYMENT_ID", "DEVICE_IP", "SESSION_SECRET", "WEB_PORT",
+	}, plan.EnvVars)
+
+	assert.Contains(t, plan.Compose, `- "8088:3000"`)
+	assert.Contains(t, plan.Compose, "DB_HOST: 192.168.1.20")
+	assert.Contains(t, plan.Compose, "DB_PASS: "+maskedEnvValue)
+	assert.Contains(t, plan.Compose, "ADMIN_PASSWORD: "+maskedEnvValue)
+	assert.NotContains(t, plan.Compose, "Sup3r-Secret-Pass!")
+	assert.Equal(t, []string{"8088/tcp"}, plan.Ports)
+
+	assert.True(t, plan.Resources.Fits)
+	assert.Equal(t, 512, plan.Resources.RequiredRAMMB)
+	assert.Equal(t, 3584, *plan.Resources.RemainingRAMMB)
+	assert.Equal(t, 98, *plan.Resources.RemainingStorageGB)
+	assert.Empty(t, plan.Warnings)
+
+	// Nothing was created while planning
+	var deployments int64
+	db.Model(&models.Deployment{}).Count(&deployments)
+	assert.Zero(t, deployments)
+	_, err = credService.GetCredential("deployment:" + uuid.Nil.String() + ":session_secret")
+	assert.Error(t, err, "no secrets are generated for a plan")
+}
+
+func TestPlanDeployment_Warnings(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	deviceService := NewDeviceService(db, credService, nil)
+	recipe := planTestRecipe()
+	deploymentService := NewDeploymentService(db, nil, NewMockRecipeLoader(map[string]*models.Recipe{recipe.Slug: recipe}), deviceService, credService, nil, nil, nil)
+
+	availableRAM := 256
+	device := models.Device{Name: "pi", Type: models.DeviceTypeServer, AvailableRAMMB: &availableRAM}
+	require.NoError(t, db.Create(&device).Error)
+	grafana := &models.Deployment{
+		RecipeSlug: "grafana", DeviceID: device.ID, Status: models.DeploymentStatusRunning,
+		ComposeProject: "grafana-abc123", GeneratedCompose: "ports:\n  - \"3000:3000\"",
+	}
+	require.NoError(t, db.Create(grafana).Error)
+	require.NoError(t, db.Create(&models.PortAllocation{DeviceID: device.ID, Port: 3000, Protocol: "tcp", DeploymentID: grafana.ID}).Error)
+
+	plan, err := deploymentService.PlanDeployment(CreateDeploymentRequest{
+		RecipeSlug:     recipe.Slug,
+		DeviceID:       device.ID,
+		ComposeProject: "wiki",
+		Config:         map[string]interface{}{"admin_password": "Sup3r-Secret-Pass!"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "wiki", plan.ComposeProject)
+	assert.True(t, plan.Allocations[0].CreatesInstance)
+	assert.False(t, plan.Resources.Fits)
+	assert.Equal(t, -256, *plan.Resources.RemainingRAMMB)
+	assert.Nil(t, plan.Resources.RemainingStorageGB)
+
+	warnings := plan.Warnings
+	require.Len(t, warnings, 4)
+	assert.Contains(t, warnings[0], "shared postgres instance will be created")
+	assert.Equal(t, "Deployment would be rejected, ports already in use on pi: 3000/tcp (deployment grafana-abc123)", warnings[1])
+	assert.Contains(t, warnings[2], "No resource metrics reported")
+	assert.Contains(t, warnings[3], "Not enough free RAM: 512MB needed, 256MB available")
+}
+
+func TestPlanDeployment_Validation(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	deviceService := NewDeviceService(db, credService, nil)
+	recipe := planTestRecipe()
+	deploymentService := NewDeploymentService(db, nil, NewMockRecipeLoader(map[string]*models.Recipe{recipe.Slug: recipe}), deviceService, credService, nil, nil, nil)
+
+	device := models.Device{Name: "server", Type: models.DeviceTypeServer}
+	require.NoError(t, db.Create(&device).Error)
+	require.NoError(t, db.Create(&models.Deployment{RecipeSlug: recipe.Slug, DeviceID: device.ID, ComposeProject: "wiki"}).Error)
+
+	_, err := deploymentService.PlanDeployment(CreateDeploymentRequest{RecipeSlug: "missing", DeviceID: device.ID})
+	assert.True(t, errors.Is(err, ErrRecipeNotFound))
+
+	_, err = deploymentService.PlanDeployment(CreateDeploymentRequest{RecipeSlug: recipe.Slug, DeviceID: device.ID})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing required field: admin_password")
+
+	config := map[string]interface{}{"admin_password": "Sup3r-Secret-Pass!"}
+	_, err = deploymentService.PlanDeployment(CreateDeploymentRequest{RecipeSlug: recipe.Slug, DeviceID: device.ID, Config: config, ComposeProject: "wiki; rm -rf /"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid compose project name")
+
+	_, err = deploymentService.PlanDeployment(CreateDeploymentRequest{RecipeSlug: recipe.Slug, DeviceID: device.ID, Config: config, ComposeProject: "wiki"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already in use")
+
+	_, err = deploymentService.PlanDeployment(CreateDeploymentRequest{RecipeSlug: recipe.Slug, DeviceID: uuid.New(), Config: config})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "device not found")
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+// isHostPortOption reports whether a recipe option sets a port published on the host, e.g. "port" or "web_port"
+func isHostPortOption(option models.RecipeConfigOption) bool {
+	name := strings.ToLower(option.Name)
+	return option.Type == "number" && (name == "port" || strings.HasSuffix(name, "_port"))
+}
+
+// portValue converts a config value to a port number
+func portValue(value interface{}) (int, bool) {
+	var port int
+	switch v := value.(type) {
+	case int:
+		port = v
+	case float64:
+		port = int(v)
+	case string:
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, false
+		}
+		port = parsed
+	default:
+		return 0, false
+	}
+	return port, port >= 1 && port <= 65535
+}
+
+// assignRecipePorts moves the recipe's host port options that are already held on the device to free ports
+// config is updated in place; returns a note for each port that was changed
+func (s *DeploymentService) assignRecipePorts(recipe *models.Recipe, device *models.Device, config map[string]interface{}) ([]string, error) {
+	notes := []string{}
+	for _, option := range recipe.ConfigOptions {
+		if !isHostPortOption(option) {
+			continue
+		}
+		value, ok := config[option.Name]
+		if !ok {
+			value = option.Default
+		}
+		requested, ok := portValue(value)
+		if !ok {
+			continue
+		}
+
+		err := s.ports.CheckPorts(device, uuid.Nil, []PortSpec{{Port: requested, Protocol: "tcp"}})
+		var conflict *PortConflictError
+		if !errors.As(err, &conflict) {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		port, err := s.ports.FindFreePort(device, requested+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", conflict.Error(), err)
+		}
+		config[option.Name] = port
+		notes = append(notes, fmt.Sprintf("Port %d is held by %s on %s; %s set to %d",
+			requested, conflict.Conflicts[0].describeOwner(), device.Name, option.Name, port))
+	}
+	return notes, nil
+}
+
+// deploymentPorts returns the host ports a deployment publishes, with its stored config substituted into the compose file
+func deploymentPorts(deployment *models.Deployment) ([]PortSpec, error) {
+	var config map[string]interface{}
+	if len(deployment.Config) > 0 {
+		if err := json.Unmarshal(deployment.Config, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse deployment config: %w", err)
+		}
+	}
+	vars := make(map[string]string, len(config))
+	for key, value := range config {
+		vars[toEnvVarName(key)] = fmt.Sprintf("%v", value)
+	}
+	return ExtractPortsFromCompose(interpolateComposeVars(deployment.GeneratedCompose, vars)), nil
+}
+
+// releasePorts frees a deployment's ports in the registry, logging failures
+func (s *DeploymentService) releasePorts(deployment *models.Deployment) {
+	if err := s.ports.ReleaseDeploymentPorts(deployment.ID); err != nil {
+		log.Printf("[Deployment] Warning: Failed to release ports of %s: %v", deployment.ID, err)
+	}
+}
+
+// BackfillPortAllocations records the ports of deployments created before the port registry existed
+// Deployments that already have an allocation, or that failed, are skipped; conflicts are logged
+func (s *DeploymentService) BackfillPortAllocations() error {
+	var deployments []models.Deployment
+	err := s.db.Preload("Device").
+		Where("status <> ? AND generated_compose <> ''", models.DeploymentStatusFailed).
+		Where("id NOT IN (?)", s.db.Model(&models.PortAllocation{}).Select("deployment_id")).
+		Find(&deployments).Error
+	if err != nil {
+		return fmt.Errorf("failed to query deployments: %w", err)
+	}
+
+	recorded := 0
+	for i := range deployments {
+		deployment := &deployments[i]
+		ports, err := deploymentPorts(deployment)
+		if err != nil || len(ports) == 0 || deployment.Device == nil {
+			continue
+		}
+		if err := s.ports.RecordDeploymentPorts(deployment.Device, deployment.ID, ports); err != nil {
+			log.Printf("[Deployment] Warning: Could not record ports of %s: %v", deployment.ComposeProject, err)
+			continue
+		}
+		recorded++
+	}
+
+	if recorded > 0 {
+		log.Printf("[Deployment] Recorded ports of %d existing deployments", recorded)
+	}
+	return nil
+}
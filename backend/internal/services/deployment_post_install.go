@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+// postInstallVarRegex matches ${VAR} references in post-install steps
+var postInstallVarRegex = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// postInstallEnvFile holds a command step's variables on the device until the step starts
+const postInstallEnvFile = ".post-install.env"
+
+// postInstallWebhookClient is used for webhook steps; webhook receivers should answer quickly
+var postInstallWebhookClient = &http.Client{Timeout: 15 * time.Second}
+
+// PostInstallWebhookPayload is the JSON body POSTed by webhook post-install steps
+type PostInstallWebhookPayload struct {
+	Event          string    `json:"event"`
+	DeploymentID   string    `json:"deployment_id"`
+	RecipeSlug     string    `json:"recipe_slug"`
+	RecipeName     string    `json:"recipe_name"`
+	ComposeProject string    `json:"compose_project"`
+	DeviceID       string    `json:"device_id"`
+	DeviceName     string    `json:"device_name"`
+	DeviceAddress  string    `json:"device_address"`
+	Domain         string    `json:"domain,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// runPostInstall executes the recipe's post-install steps in order
+// Results are logged to the deployment; rendered messages are stored for the UI.
+// Returns an error only when a step marked on_failure: fail does not succeed.
+func (s *DeploymentService) runPostInstall(ctx context.Context, deployment *models.Deployment, recipe *models.Recipe, device *models.Device, envMap map[string]string) error {
+	if len(recipe.PostInstall) == 0 {
+		return nil
+	}
+
+	s.appendLog(deployment, fmt.Sprintf("Running %d post-install step(s)...", len(recipe.PostInstall)))
+
+	var messages []models.PostInstallMessage
+	defer func() {
+		if len(messages) == 0 {
+			return
+		}
+		messagesJSON, err := json.Marshal(messages)
+		if err != nil {
+			log.Printf("[Deployment] Failed to marshal post-install messages: %v", err)
+			return
+		}
+		deployment.PostInstallMessages = messagesJSON
+		s.db.Model(deployment).Update("post_install_messages", messagesJSON)
+	}()
+
+	for i, step := range recipe.PostInstall {
+		if ctx.Err() != nil {
+			return fmt.Errorf("post-install cancelled")
+		}
+
+		label := step.Title
+		if label == "" {
+			label = step.Type
+		}
+		prefix := fmt.Sprintf("[post-install %d/%d] %s", i+1, len(recipe.PostInstall), label)
+
+		var err error
+		switch step.Type {
+		case "message":
+			messages = append(messages, models.PostInstallMessage{
+				Title:   step.Title,
+				Message: renderPostInstallMessage(step.Message, envMap),
+			})
+			s.appendLog(deployment, fmt.Sprintf("✓ %s: message saved", prefix))
+			continue
+
+		case "command":
+			var output string
+			output, err = s.runPostInstallCommand(device, deployment.ComposeProject, step, envMap)
+			if output = strings.TrimSpace(output); output != "" {
+				s.appendLog(deployment, fmt.Sprintf("%s output:\n%s", prefix, output))
+			}
+
+		case "webhook":
+			err = sendPostInstallWebhook(ctx, renderPostInstallTemplate(step.URL, envMap), buildPostInstallWebhookPayload(deployment, device))
+
+		default:
+			err = fmt.Errorf("unknown step type: %s", step.Type)
+		}
+
+		if err == nil {
+			s.appendLog(deployment, fmt.Sprintf("✓ %s", prefix))
+			continue
+		}
+
+		if step.IsFatal() {
+			s.appendLog(deployment, fmt.Sprintf("❌ %s failed: %v", prefix, err))
+			return fmt.Errorf("post-install step %q failed: %w", label, err)
+		}
+		s.appendLog(deployment, fmt.Sprintf("⚠️  %s failed: %v (continuing anyway)", prefix, err))
+	}
+
+	return nil
+}
+
+// runPostInstallCommand runs a command step inside its compose service container
+// Variables referenced as ${VAR} are passed into the container environment instead of
+// being spliced into the command, so values never need shell escaping. Their values are
+// uploaded over stdin rather than put on the command line, where the process list and
+// error output (which ends up in the deployment log) would show them.
+func (s *DeploymentService) runPostInstallCommand(device *models.Device, project string, step models.RecipePostInstallStep, envMap map[string]string) (string, error) {
+	cmd, envFile, err := buildPostInstallCommand(project, step, envMap)
+	if err != nil {
+		return "", err
+	}
+
+	host := device.GetSSHHost()
+	if envFile != "" {
+		writeCmd := fmt.Sprintf("cd ~/homelab-deployments/%s && umask 077 && cat > %s", project, postInstallEnvFile)
+		if _, err := s.sshClient.ExecuteWithInput(host, writeCmd, strings.NewReader(envFile), 30*time.Second); err != nil {
+			return "", fmt.Errorf("failed to upload post-install variables: %w", err)
+		}
+	}
+	return s.sshClient.ExecuteWithTimeout(host, cmd, 10*time.Minute)
+}
+
+// buildPostInstallCommand builds the docker compose exec command for a command step
+// Referenced variables are passed by name only (-e NAME), so compose takes their values from its
+// environment. The returned env file holds those values; the command exports it and deletes it
+// before running compose.
+func buildPostInstallCommand(project string, step models.RecipePostInstallStep, envMap map[string]string) (string, string, error) {
+	if !isValidStackName(project) {
+		return "", "", fmt.Errorf("invalid compose project: %s", project)
+	}
+	if !isValidStackName(step.Service) {
+		return "", "", fmt.Errorf("invalid service name: %s", step.Service)
+	}
+
+	args := []string{"docker", "compose", "-p", project, "exec", "-T"}
+	if step.User != "" {
+		args = append(args, "--user", shellQuote(step.User))
+	}
+
+	var names []string
+	for _, match := range postInstallVarRegex.FindAllStringSubmatch(step.Command, -1) {
+		if _, ok := envMap[match[1]]; ok && !containsString(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	sort.Strings(names)
+
+	var envFile strings.Builder
+	for _, name := range names {
+		args = append(args, "-e", name)
+		envFile.WriteString(fmt.Sprintf("%s=%s\n", name, shellQuote(envMap[name])))
+	}
+
+	args = append(args, step.Service, "sh", "-c", shellQuote(step.Command))
+
+	cmd := fmt.Sprintf("cd ~/homelab-deployments/%s && ", project)
+	if len(names) > 0 {
+		cmd += fmt.Sprintf("{ set -a; . ./%s; set +a; rm -f ./%s; } && ", postInstallEnvFile, postInstallEnvFile)
+	}
+	return cmd + strings.Join(args, " "), envFile.String(), nil
+}
+
+// sendPostInstallWebhook POSTs the deployment payload to a webhook URL
+func sendPostInstallWebhook(ctx context.Context, url string, payload PostInstallWebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := postInstallWebhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// buildPostInstallWebhookPayload collects non-sensitive deployment details for webhooks
+func buildPostInstallWebhookPayload(deployment *models.Deployment, device *models.Device) PostInstallWebhookPayload {
+	return PostInstallWebhookPayload{
+		Event:          "deployment.post_install",
+		DeploymentID:   deployment.ID.String(),
+		RecipeSlug:     deployment.RecipeSlug,
+		RecipeName:     deployment.RecipeName,
+		ComposeProject: deployment.ComposeProject,
+		DeviceID:       device.ID.String(),
+		DeviceName:     device.Name,
+		DeviceAddress:  device.GetPrimaryAddress(),
+		Domain:         deployment.Domain,
+		Timestamp:      time.Now(),
+	}
+}
+
+// renderPostInstallMessage substitutes ${VAR} references for display
+// Sensitive values are redacted because messages are stored in the database
+func renderPostInstallMessage(message string, envMap map[string]string) string {
+	return postInstallVarRegex.ReplaceAllStringFunc(message, func(ref string) string {
+		name := postInstallVarRegex.FindStringSubmatch(ref)[1]
+		value, ok := envMap[name]
+		if !ok {
+			return ref
+		}
+		if isSensitiveEnvName(name) {
+			return "[REDACTED]"
+		}
+		return value
+	})
+}
+
+// renderPostInstallTemplate substitutes ${VAR} references, leaving unknown ones untouched
+func renderPostInstallTemplate(template string, envMap map[string]string) string {
+	return postInstallVarRegex.ReplaceAllStringFunc(template, func(ref string) string {
+		if value, ok := envMap[postInstallVarRegex.FindStringSubmatch(ref)[1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// isSensitiveEnvName reports whether an env var likely holds a credential
+func isSensitiveEnvName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, marker := range []string{"password", "secret", "token", "api_key", "private_key", "connection_string"} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote wraps a value in single quotes for safe use as one shell argument
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPostInstallCommand(t *testing.T) {
+	envMap := map[string]string{
+		"ADMIN_USER":     "admin",
+		"ADMIN_PASSWORD": "it's secret",
+		"UNUSED":         "x",
+	}
+
+	step := models.RecipePostInstallStep{
+		Type:    "command",
+		Service: "nextcloud",
+		User:    "www-data",
+		Command: `php occ user:resetpassword "${ADMIN_USER}" --password-from-env ${ADMIN_PASSWORD}`,
+	}
+
+	cmd, envFile, err := buildPostInstallCommand("nextcloud-abc123", step, envMap)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`cd ~/homelab-deployments/nextcloud-abc123 && { set -a; . ./.post-install.env; set +a; rm -f ./.post-install.env; } && `+
+			`docker compose -p nextcloud-abc123 exec -T --user 'www-data' -e ADMIN_PASSWORD -e ADMIN_USER nextcloud sh -c `+
+			`'php occ user:resetpassword "${ADMIN_USER}" --password-from-env ${ADMIN_PASSWORD}'`,
+		cmd)
+	assert.NotContains(t, cmd, "secret", "values never appear on the command line")
+	assert.Equal(t, "ADMIN_PASSWORD='it'\\''s secret'\nADMIN_USER='admin'\n", envFile)
+
+	// Steps without variables need no env file
+	cmd, envFile, err = buildPostInstallCommand("nextcloud-abc123", models.RecipePostInstallStep{Service: "nextcloud", Command: "php occ maintenance:repair"}, envMap)
+	require.NoError(t, err)
+	assert.Empty(t, envFile)
+	assert.NotContains(t, cmd, ".post-install.env")
+
+	_, _, err = buildPostInstallCommand("bad;project", step, envMap)
+	assert.Error(t, err)
+
+	step.Service = "nextcloud && rm -rf /"
+	_, _, err = buildPostInstallCommand("nextcloud-abc123", step, envMap)
+	assert.Error(t, err)
+}
+
+func TestRenderPostInstallMessage(t *testing.T) {
+	envMap := map[string]string{
+		"DOMAIN":         "cloud.home",
+		"ADMIN_USER":     "admin",
+		"ADMIN_PASSWORD": "hunter2",
+	}
+
+	rendered := renderPostInstallMessage("https://${DOMAIN} ${ADMIN_USER}/${ADMIN_PASSWORD} ${MISSING}", envMap)
+	assert.Equal(t, "https://cloud.home admin/[REDACTED] ${MISSING}", rendered)
+
+	assert.Equal(t, "https://hooks.local/hunter2", renderPostInstallTemplate("https://hooks.local/${ADMIN_PASSWORD}", envMap))
+}
+
+func TestRunPostInstall(t *testing.T) {
+	db := setupTestDB(t)
+	service := &DeploymentService{db: db}
+
+	var received PostInstallWebhookPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.10"}
+	require.NoError(t, db.Create(device).Error)
+
+	newDeployment := func() *models.Deployment {
+		deployment := &models.Deployment{RecipeSlug: "app", RecipeName: "App", ComposeProject: "app-1", DeviceID: device.ID}
+		require.NoError(t, db.Create(deployment).Error)
+		return deployment
+	}
+	envMap := map[string]string{"DOMAIN": "app.home", "DB_PASSWORD": "secret"}
+
+	t.Run("runs steps and stores messages", func(t *testing.T) {
+		deployment := newDeployment()
+		recipe := &models.Recipe{PostInstall: []models.RecipePostInstallStep{
+			{Type: "message", Title: "Ready", Message: "Visit https://${DOMAIN} (db: ${DB_PASSWORD})"},
+			{Type: "webhook", URL: webhook.URL + "/ok"},
+			{Type: "webhook", Title: "Optional hook", URL: webhook.URL + "/fail"},
+		}}
+
+		err := service.runPostInstall(context.Background(), deployment, recipe, device, envMap)
+		require.NoError(t, err, "warn-only failures do not fail the deployment")
+
+		assert.Equal(t, "deployment.post_install", received.Event)
+		assert.Equal(t, deployment.ID.String(), received.DeploymentID)
+		assert.Equal(t, "server-1", received.DeviceName)
+
+		var reloaded models.Deployment
+		require.NoError(t, db.First(&reloaded, "id = ?", deployment.ID).Error)
+		var messages []models.PostInstallMessage
+		require.NoError(t, json.Unmarshal(reloaded.PostInstallMessages, &messages))
+		assert.Equal(t, []models.PostInstallMessage{{Title: "Ready", Message: "Visit https://app.home (db: [REDACTED])"}}, messages)
+
+		assert.Contains(t, reloaded.DeploymentLogs, "Optional hook failed")
+		assert.Contains(t, reloaded.DeploymentLogs, "continuing anyway")
+	})
+
+	t.Run("fatal step stops execution", func(t *testing.T) {
+		deployment := newDeployment()
+		recipe := &models.Recipe{PostInstall: []models.RecipePostInstallStep{
+			{Type: "webhook", Title: "Required hook", URL: webhook.URL + "/fail", OnFailure: "fail"},
+			{Type: "message", Message: "never rendered"},
+		}}
+
+		err := service.runPostInstall(context.Background(), deployment, recipe, device, envMap)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Required hook")
+		assert.Empty(t, deployment.PostInstallMessages)
+	})
+}
+
+func TestRecipeValidatePostInstall(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    models.RecipePostInstallStep
+		wantErr bool
+	}{
+		{name: "message", step: models.RecipePostInstallStep{Type: "message", Message: "hi"}},
+		{name: "command", step: models.RecipePostInstallStep{Type: "command", Service: "app", Command: "true", OnFailure: "fail"}},
+		{name: "webhook", step: models.RecipePostInstallStep{Type: "webhook", URL: "https://example.com/hook"}},
+		{name: "command without service", step: models.RecipePostInstallStep{Type: "command", Command: "true"}, wantErr: true},
+		{name: "webhook without scheme", step: models.RecipePostInstallStep{Type: "webhook", URL: "example.com"}, wantErr: true},
+		{name: "unknown type", step: models.RecipePostInstallStep{Type: "script"}, wantErr: true},
+		{name: "invalid on_failure", step: models.RecipePostInstallStep{Type: "message", Message: "hi", OnFailure: "ignore"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipe := &models.Recipe{PostInstall: []models.RecipePostInstallStep{tt.step}}
+			err := recipe.ValidatePostInstall()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
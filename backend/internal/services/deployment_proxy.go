@@ -0,0 +1,566 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	proxyNetwork        = "homelab-proxy"
+	defaultCertResolver = "letsencrypt" // Resolver configured by the Traefik recipe; Caddy uses ACME for any name but "internal"
+)
+
+var (
+	domainRegex   = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	routerRegex   = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+	upstreamRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?:[0-9]{1,5}$`)
+)
+
+// ErrNoReverseProxy is returned when managing routes on a device without a reverse proxy deployment
+var ErrNoReverseProxy = errors.New("no reverse proxy deployed on device")
+
+// ProxyOptions routes a deployment's domain through the reverse proxy on its device
+type ProxyOptions struct {
+	Domain       string `json:"domain,omitempty"`        // Recipe deployments fall back to their "domain" config option
+	HTTPS        bool   `json:"https,omitempty"`         // Serve the domain over HTTPS instead of plain HTTP
+	CertResolver string `json:"cert_resolver,omitempty"` // Certificate resolver for HTTPS: "homelab-ca" if empty for private domains, else "letsencrypt"
+}
+
+// ProxyRoute is a domain served by the reverse proxy on a device
+type ProxyRoute struct {
+	Domain       string `json:"domain"`
+	Router       string `json:"router"`                  // Route name, the compose project for deployments
+	Service      string `json:"service,omitempty"`       // Compose service receiving the traffic
+	Port         int    `json:"port,omitempty"`          // Container port the service listens on
+	Upstream     string `json:"upstream"`                // host:port the proxy forwards to over the proxy network
+	CertResolver string `json:"cert_resolver,omitempty"` // Empty for plain HTTP
+}
+
+// ProxyRouteRequest adds a route to a service the platform did not deploy, such as a container started by hand
+type ProxyRouteRequest struct {
+	Router       string `json:"router"`
+	Domain       string `json:"domain"`
+	Upstream     string `json:"upstream"` // host:port reachable from the proxy network
+	HTTPS        bool   `json:"https,omitempty"`
+	CertResolver string `json:"cert_resolver,omitempty"`
+}
+
+// DeviceRoutes lists the routes served by a device's reverse proxy
+type DeviceRoutes struct {
+	Proxy    string       `json:"proxy"`    // Name of the proxy deployment
+	Provider string       `json:"provider"` // Recipe of the proxy: traefik, caddy or nginx
+	Routes   []ProxyRoute `json:"routes"`
+}
+
+// pendingProxyRoute is a route to add to a proxy once the deployment's containers run
+type pendingProxyRoute struct {
+	provider ReverseProxyProvider
+	proxy    *models.Deployment
+	route    ProxyRoute
+}
+
+// applyProxyOptions validates the requested domain and records it, with its certificate resolver, on the deployment
+func (s *DeploymentService) applyProxyOptions(deployment *models.Deployment, opts ProxyOptions, config map[string]interface{}) error {
+	domain := strings.ToLower(strings.TrimSpace(opts.Domain))
+	if domain == "" {
+		if value, ok := config["domain"].(string); ok {
+			domain = strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	if domain == "" {
+		if opts.HTTPS {
+			return fmt.Errorf("https requires a domain")
+		}
+		return nil
+	}
+	if err := s.checkDomainAvailable(domain); err != nil {
+		return err
+	}
+
+	deployment.Domain = domain
+	if opts.HTTPS {
+		deployment.CertResolver = opts.CertResolver
+		if deployment.CertResolver == "" {
+			deployment.CertResolver = defaultCertResolver
+			// Public ACME cannot validate names like nas.home or cloud.lan
+			if isPrivateDomain(domain) {
+				deployment.CertResolver = homelabCAResolver
+			}
+		}
+	}
+	return nil
+}
+
+// checkDomainAvailable validates a domain and checks no deployment already uses it
+func (s *DeploymentService) checkDomainAvailable(domain string) error {
+	if len(domain) > 253 || !domainRegex.MatchString(domain) {
+		return fmt.Errorf("invalid domain %q", domain)
+	}
+
+	var existing models.Deployment
+	err := s.db.Where("domain = ? AND status <> ?", domain, models.DeploymentStatusFailed).First(&existing).Error
+	if err == nil {
+		return fmt.Errorf("domain %s is already used by %s", domain, deploymentNodeName(&existing))
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to check domain: %w", err)
+	}
+	return nil
+}
+
+// proxyDeployment returns the reverse proxy deployment on a device, or nil if there is none
+// The oldest proxy wins if several are deployed
+func (s *DeploymentService) proxyDeployment(deviceID uuid.UUID, excludeID uuid.UUID) (*models.Deployment, error) {
+	slugs := make([]string, 0, len(s.proxies))
+	for slug := range s.proxies {
+		slugs = append(slugs, slug)
+	}
+
+	var proxy models.Deployment
+	err := s.db.Where("device_id = ? AND recipe_slug IN ? AND id <> ? AND status <> ?", deviceID, slugs, excludeID, models.DeploymentStatusFailed).
+		Order("created_at").
+		First(&proxy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reverse proxy: %w", err)
+	}
+	return &proxy, nil
+}
+
+// routeDomain attaches the deployment's web service to the proxy network, logging the outcome
+// Traefik reads the route from labels added to the compose file, so it is dropped as soon as the containers are removed;
+// the other proxies get the returned route once the containers run
+func (s *DeploymentService) routeDomain(deployment *models.Deployment, device *models.Device, compose string, vars map[string]string) (string, *pendingProxyRoute) {
+	proxy, err := s.proxyDeployment(device.ID, deployment.ID)
+	if err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  %s is not routed: %v", deployment.Domain, err))
+		return compose, nil
+	}
+	if proxy == nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  No reverse proxy deployment on %s; %s is not routed until one is deployed and this deployment is redeployed", device.Name, deployment.Domain))
+		return compose, nil
+	}
+	provider := s.proxies[proxy.RecipeSlug]
+
+	routed, route, err := addProxyRoute(compose, vars, ProxyRoute{
+		Domain:       deployment.Domain,
+		Router:       deployment.ComposeProject,
+		CertResolver: deployment.CertResolver,
+	}, provider)
+	if err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  %s is not routed: %v", deployment.Domain, err))
+		return compose, nil
+	}
+	if route == nil {
+		s.appendLog(deployment, fmt.Sprintf("ℹ️  The compose file configures its own Traefik route for %s", deployment.Domain))
+		return compose, nil
+	}
+
+	scheme := "http"
+	if route.CertResolver != "" {
+		scheme = "https"
+	}
+	s.appendLog(deployment, fmt.Sprintf("✓ Routing %s://%s to %s through %s", scheme, route.Domain, route.Upstream, deploymentNodeName(proxy)))
+	if len(provider.Labels(*route)) > 0 {
+		return routed, nil
+	}
+	return routed, &pendingProxyRoute{provider: provider, proxy: proxy, route: *route}
+}
+
+// publishRoute adds a pending route to its proxy, logging the outcome
+// A failure leaves the app reachable on its ports, so the deployment carries on
+func (s *DeploymentService) publishRoute(deployment *models.Deployment, device *models.Device, pending *pendingProxyRoute) {
+	if err := pending.provider.AddRoute(device, pending.proxy, pending.route); err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  %s is not routed: %v", pending.route.Domain, err))
+		return
+	}
+	s.appendLog(deployment, fmt.Sprintf("✓ Route for %s added to %s", pending.route.Domain, deploymentNodeName(pending.proxy)))
+}
+
+// unrouteDomain removes the deployment's route from the proxy on a device
+// Failures are logged only, so a broken proxy never blocks removing an app
+func (s *DeploymentService) unrouteDomain(deployment *models.Deployment, device *models.Device) {
+	if deployment.Domain == "" || deployment.ComposeProject == "" {
+		return
+	}
+	proxy, err := s.proxyDeployment(device.ID, deployment.ID)
+	if err != nil || proxy == nil {
+		return
+	}
+	provider := s.proxies[proxy.RecipeSlug]
+	if err := provider.RemoveRoute(device, proxy, deployment.ComposeProject); err != nil {
+		log.Printf("[Deployment] Warning: Failed to remove route for %s from %s: %v", deployment.Domain, deploymentNodeName(proxy), err)
+	}
+	if deployment.CertResolver == homelabCAResolver {
+		if err := provider.RemoveCertificate(device, proxy, deployment.Domain); err != nil {
+			log.Printf("[Deployment] Warning: Failed to remove certificate for %s from %s: %v", deployment.Domain, deploymentNodeName(proxy), err)
+		}
+	}
+}
+
+// secureDomain installs a certificate from the homelab CA for the deployment's domain, logging the outcome
+// The renewal loop retries a failed install, so the deployment carries on
+func (s *DeploymentService) secureDomain(deployment *models.Deployment) {
+	cert, err := s.certificates.EnsureCertificate(deployment)
+	if err != nil {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  No certificate for %s: %v", deployment.Domain, err))
+		return
+	}
+	s.appendLog(deployment, fmt.Sprintf("✓ Certificate for %s issued by the homelab CA, valid until %s", cert.Domain, cert.NotAfter.Format("2006-01-02")))
+}
+
+// registerDNS points the deployment's domain at its device on the DNS providers, logging the outcome
+// A domain that was removed or moved to another device has its old record replaced
+func (s *DeploymentService) registerDNS(deployment *models.Deployment) {
+	for _, result := range s.dns.SyncDeployment(deployment) {
+		for _, msg := range result.Errors {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  DNS %s: %s", result.Provider, msg))
+		}
+		if len(result.Added) > 0 {
+			s.appendLog(deployment, fmt.Sprintf("✓ DNS record for %s added to %s", deployment.Domain, result.Provider))
+		}
+	}
+}
+
+// InstallCertificate installs a deployment's certificate on the reverse proxy of its device
+func (s *DeploymentService) InstallCertificate(deployment *models.Deployment, certPEM, keyPEM string) error {
+	device, proxy, provider, err := s.deviceProxy(deployment.DeviceID)
+	if err != nil {
+		return err
+	}
+	return provider.InstallCertificate(device, proxy, deployment.Domain, certPEM, keyPEM)
+}
+
+// deviceProxy returns the reverse proxy deployment on a device and its provider
+func (s *DeploymentService) deviceProxy(deviceID uuid.UUID) (*models.Device, *models.Deployment, ReverseProxyProvider, error) {
+	device, err := s.deviceService.GetDevice(deviceID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	proxy, err := s.proxyDeployment(deviceID, uuid.Nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if proxy == nil {
+		return nil, nil, nil, ErrNoReverseProxy
+	}
+	return device, proxy, s.proxies[proxy.RecipeSlug], nil
+}
+
+// ListProxyRoutes lists the routes served by the reverse proxy on a device
+func (s *DeploymentService) ListProxyRoutes(deviceID uuid.UUID) (*DeviceRoutes, error) {
+	device, proxy, provider, err := s.deviceProxy(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := provider.ListRoutes(device, proxy)
+	if err != nil {
+		return nil, err
+	}
+	if routes == nil {
+		routes = []ProxyRoute{}
+	}
+	return &DeviceRoutes{Proxy: deploymentNodeName(proxy), Provider: provider.Recipe(), Routes: routes}, nil
+}
+
+// CreateProxyRoute adds a route to the reverse proxy on a device
+func (s *DeploymentService) CreateProxyRoute(deviceID uuid.UUID, req ProxyRouteRequest) (*ProxyRoute, error) {
+	route := ProxyRoute{
+		Router:   strings.ToLower(strings.TrimSpace(req.Router)),
+		Domain:   strings.ToLower(strings.TrimSpace(req.Domain)),
+		Upstream: strings.TrimSpace(req.Upstream),
+	}
+	if !routerRegex.MatchString(route.Router) {
+		return nil, fmt.Errorf("invalid router name %q: use lowercase letters, digits and dashes", route.Router)
+	}
+	if !upstreamRegex.MatchString(route.Upstream) {
+		return nil, fmt.Errorf("invalid upstream %q: expected host:port", route.Upstream)
+	}
+	if err := s.checkDomainAvailable(route.Domain); err != nil {
+		return nil, err
+	}
+	if req.HTTPS {
+		route.CertResolver = req.CertResolver
+		if route.CertResolver == "" {
+			route.CertResolver = defaultCertResolver
+		}
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Deployment{}).Where("compose_project = ?", route.Router).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check router name: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("router name %s is used by a deployment", route.Router)
+	}
+
+	device, proxy, provider, err := s.deviceProxy(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.AddRoute(device, proxy, route); err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// DeleteProxyRoute removes a route from the reverse proxy on a device
+// Routes of deployments are removed along with the deployment instead
+func (s *DeploymentService) DeleteProxyRoute(deviceID uuid.UUID, router string) error {
+	var count int64
+	if err := s.db.Model(&models.Deployment{}).Where("compose_project = ? AND domain <> ''", router).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check router name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("route %s belongs to a deployment; delete the deployment or redeploy it without a domain", router)
+	}
+
+	device, proxy, provider, err := s.deviceProxy(deviceID)
+	if err != nil {
+		return err
+	}
+	return provider.RemoveRoute(device, proxy, router)
+}
+
+// addProxyRoute attaches the compose file's web service to the proxy network and adds the provider's labels for the route
+// The web service is the first one publishing a TCP port; vars are substituted into port mappings to find its container port.
+// The upstream is the service's container name, which Docker resolves on the proxy network.
+// If the proxy is Traefik and a service already defines Traefik routers, the compose file is returned unchanged with a nil route
+func addProxyRoute(compose string, vars map[string]string, route ProxyRoute, provider ReverseProxyProvider) (string, *ProxyRoute, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(compose), &doc); err != nil {
+		return "", nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", nil, fmt.Errorf("compose file is empty")
+	}
+	root := doc.Content[0]
+
+	services := yamlMappingValue(root, "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return "", nil, fmt.Errorf("compose file has no services")
+	}
+
+	var web *yaml.Node
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		service := services.Content[i+1]
+		if provider.Recipe() == traefikRecipe && hasTraefikRouter(yamlMappingValue(service, "labels")) {
+			return compose, nil, nil
+		}
+		if web == nil {
+			if port := publishedContainerPort(yamlMappingValue(service, "ports"), vars); port > 0 {
+				web = service
+				route.Service = services.Content[i].Value
+				route.Port = port
+			}
+		}
+	}
+	if web == nil {
+		return "", nil, fmt.Errorf("no service publishes a TCP port to route to")
+	}
+	host := fmt.Sprintf("%s-%s-1", route.Router, route.Service)
+	if name := yamlMappingValue(web, "container_name"); name != nil && name.Value != "" {
+		host = interpolateComposeVars(name.Value, vars)
+	}
+	route.Upstream = fmt.Sprintf("%s:%d", host, route.Port)
+
+	// Joining a network replaces the implicit default one, which the app's other services still use
+	switch networks := yamlMappingValue(web, "networks"); {
+	case networks == nil:
+		setYAMLMappingValue(web, "networks", yamlSequence("default", proxyNetwork))
+	case networks.Kind == yaml.SequenceNode:
+		if !yamlSequenceContains(networks, proxyNetwork) {
+			networks.Content = append(networks.Content, yamlScalar(proxyNetwork))
+		}
+	case networks.Kind == yaml.MappingNode:
+		if yamlMappingValue(networks, proxyNetwork) == nil {
+			setYAMLMappingValue(networks, proxyNetwork, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		}
+	}
+
+	topNetworks := yamlMappingValue(root, "networks")
+	if topNetworks == nil || topNetworks.Kind != yaml.MappingNode {
+		topNetworks = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setYAMLMappingValue(root, "networks", topNetworks)
+	}
+	if yamlMappingValue(topNetworks, proxyNetwork) == nil {
+		external := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		setYAMLMappingValue(external, "name", yamlScalar(proxyNetwork))
+		setYAMLMappingValue(external, "external", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+		setYAMLMappingValue(topNetworks, proxyNetwork, external)
+	}
+
+	routeLabels := provider.Labels(route)
+	labels := yamlMappingValue(web, "labels")
+	if labels == nil && len(routeLabels) > 0 {
+		labels = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setYAMLMappingValue(web, "labels", labels)
+	}
+	for _, label := range routeLabels {
+		key, value, _ := strings.Cut(label, "=")
+		if labels.Kind == yaml.MappingNode {
+			setYAMLMappingValue(labels, key, yamlScalar(value))
+		} else {
+			labels.Content = append(labels.Content, yamlScalar(label))
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return "", nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", nil, err
+	}
+	return out.String(), &route, nil
+}
+
+// hasTraefikRouter reports whether a service's labels define a Traefik HTTP router
+func hasTraefikRouter(labels *yaml.Node) bool {
+	if labels == nil {
+		return false
+	}
+	switch labels.Kind {
+	case yaml.SequenceNode:
+		for _, label := range labels.Content {
+			if strings.HasPrefix(label.Value, "traefik.http.routers.") {
+				return true
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(labels.Content); i += 2 {
+			if strings.HasPrefix(labels.Content[i].Value, "traefik.http.routers.") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publishedContainerPort returns the container port of the first TCP port a service publishes on the host, or 0
+// Handles the short syntax ("8080:80", "127.0.0.1:8080:80/tcp") and the long syntax with target and published
+func publishedContainerPort(ports *yaml.Node, vars map[string]string) int {
+	if ports == nil || ports.Kind != yaml.SequenceNode {
+		return 0
+	}
+	for _, entry := range ports.Content {
+		switch entry.Kind {
+		case yaml.ScalarNode:
+			mapping := interpolateComposeVars(entry.Value, vars)
+			mapping, protocol, _ := strings.Cut(mapping, "/")
+			parts := strings.Split(mapping, ":")
+			if (protocol != "" && protocol != "tcp") || len(parts) < 2 {
+				continue
+			}
+			// Container port ranges ("8000-8010") are not routable
+			if port, err := strconv.Atoi(parts[len(parts)-1]); err == nil && port > 0 {
+				return port
+			}
+		case yaml.MappingNode:
+			target := yamlMappingValue(entry, "target")
+			protocol := yamlMappingValue(entry, "protocol")
+			if target == nil || yamlMappingValue(entry, "published") == nil || (protocol != nil && protocol.Value != "tcp") {
+				continue
+			}
+			if port, err := strconv.Atoi(interpolateComposeVars(target.Value, vars)); err == nil && port > 0 {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// publishedHostPort returns the host port a compose file publishes a container's TCP port on
+// Falls back to the container port itself, which is right for services on the host network
+func publishedHostPort(compose string, vars map[string]string, containerPort int) int {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(compose), &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return containerPort
+	}
+	services := yamlMappingValue(doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return containerPort
+	}
+
+	for i := 1; i < len(services.Content); i += 2 {
+		ports := yamlMappingValue(services.Content[i], "ports")
+		if ports == nil || ports.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, entry := range ports.Content {
+			var published, target int
+			switch entry.Kind {
+			case yaml.ScalarNode:
+				mapping, protocol, _ := strings.Cut(interpolateComposeVars(entry.Value, vars), "/")
+				parts := strings.Split(mapping, ":")
+				if (protocol != "" && protocol != "tcp") || len(parts) < 2 {
+					continue
+				}
+				published, _ = strconv.Atoi(parts[len(parts)-2])
+				target, _ = strconv.Atoi(parts[len(parts)-1])
+			case yaml.MappingNode:
+				targetNode := yamlMappingValue(entry, "target")
+				publishedNode := yamlMappingValue(entry, "published")
+				protocol := yamlMappingValue(entry, "protocol")
+				if targetNode == nil || publishedNode == nil || (protocol != nil && protocol.Value != "tcp") {
+					continue
+				}
+				published, _ = strconv.Atoi(interpolateComposeVars(publishedNode.Value, vars))
+				target, _ = strconv.Atoi(interpolateComposeVars(targetNode.Value, vars))
+			}
+			if target == containerPort && published > 0 {
+				return published
+			}
+		}
+	}
+	return containerPort
+}
+
+// setYAMLMappingValue sets the value for a key of a YAML mapping node, adding the key if it is missing
+func setYAMLMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, yamlScalar(key), value)
+}
+
+// yamlScalar returns a string node
+func yamlScalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// yamlSequence returns a sequence node of strings
+func yamlSequence(values ...string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, value := range values {
+		node.Content = append(node.Content, yamlScalar(value))
+	}
+	return node
+}
+
+// yamlSequenceContains reports whether a sequence node holds a scalar with the value
+func yamlSequenceContains(node *yaml.Node, value string) bool {
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode && item.Value == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAddProxyRoute(t *testing.T) {
+	compose := `services:
+  db:
+    image: postgres:16
+  app:
+    image: nextcloud:29
+    ports:
+      - "${WEB_PORT:-8080}:${APP_PORT}"
+    labels:
+      - "com.example.team=home"
+volumes:
+  data: {}
+`
+	routed, route, err := addProxyRoute(compose, map[string]string{"APP_PORT": "80"}, ProxyRoute{
+		Domain: "cloud.home.lan", Router: "nextcloud-abc123", CertResolver: "letsencrypt",
+	}, &traefikProvider{})
+	require.NoError(t, err)
+	require.NotNil(t, route)
+	assert.Equal(t, "app", route.Service)
+	assert.Equal(t, 80, route.Port)
+	assert.Equal(t, "nextcloud-abc123-app-1:80", route.Upstream)
+
+	var parsed struct {
+		Services map[string]struct {
+			Networks []string `yaml:"networks"`
+			Labels   []string `yaml:"labels"`
+		} `yaml:"services"`
+		Networks map[string]struct {
+			Name     string `yaml:"name"`
+			External bool   `yaml:"external"`
+		} `yaml:"networks"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(routed), &parsed))
+	assert.Empty(t, parsed.Services["db"].Networks, "other services are left alone")
+	assert.Equal(t, []string{"default", "homelab-proxy"}, parsed.Services["app"].Networks)
+	assert.Equal(t, []string{
+		"com.example.team=home",
+		"traefik.enable=true",
+		"traefik.docker.network=homelab-proxy",
+		"traefik.http.routers.nextcloud-abc123.rule=Host(`cloud.home.lan`)",
+		"traefik.http.routers.nextcloud-abc123.service=nextcloud-abc123",
+		"traefik.http.routers.nextcloud-abc123.entrypoints=websecure",
+		"traefik.http.routers.nextcloud-abc123.tls.certresolver=letsencrypt",
+		"traefik.http.services.nextcloud-abc123.loadbalancer.server.port=80",
+	}, parsed.Services["app"].Labels)
+	assert.True(t, parsed.Networks["homelab-proxy"].External)
+	assert.Contains(t, routed, "${WEB_PORT:-8080}:${APP_PORT}", "variables are still substituted at deploy time")
+}
+
+func TestAddProxyRoute_LongSyntaxAndMappings(t *testing.T) {
+	compose := `services:
+  web:
+    image: wiki:2
+    ports:
+      - target: 53
+        published: 53
+        protocol: udp
+      - target: 3000
+        published: 3000
+    networks:
+      backend: {}
+    labels:
+      com.example.team: home
+networks:
+  backend: {}
+`
+	routed, route, err := addProxyRoute(compose, nil, ProxyRoute{Domain: "wiki.home.lan", Router: "wiki-js-1"}, &traefikProvider{})
+	require.NoError(t, err)
+	require.NotNil(t, route)
+	assert.Equal(t, 3000, route.Port)
+
+	var parsed struct {
+		Services map[string]struct {
+			Networks map[string]interface{} `yaml:"networks"`
+			Labels   map[string]string      `yaml:"labels"`
+		} `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(routed), &parsed))
+	assert.Contains(t, parsed.Services["web"].Networks, "backend")
+	assert.Contains(t, parsed.Services["web"].Networks, "homelab-proxy")
+	assert.Equal(t, "web", parsed.Services["web"].Labels["traefik.http.routers.wiki-js-1.entrypoints"], "plain HTTP without a resolver")
+	assert.NotContains(t, parsed.Services["web"].Labels, "traefik.http.routers.wiki-js-1.tls.certresolver")
+}
+
+func TestAddProxyRoute_Skipped(t *testing.T) {
+	own := `services:
+  vaultwarden:
+    image: vaultwarden/server
+    ports: ["8080:80"]
+    labels:
+      - "traefik.http.routers.vaultwarden.rule=Host(` + "`vault.home.lan`" + `)"
+`
+	routed, route, err := addProxyRoute(own, nil, ProxyRoute{Domain: "vault.home.lan", Router: "vaultwarden-1"}, &traefikProvider{})
+	require.NoError(t, err)
+	assert.Nil(t, route, "the recipe routes itself")
+	assert.Equal(t, own, routed)
+
+	_, _, err = addProxyRoute("services:\n  worker:\n    image: busybox\n", nil, ProxyRoute{Domain: "x.home.lan", Router: "worker-1"}, &traefikProvider{})
+	assert.EqualError(t, err, "no service publishes a TCP port to route to")
+}
+
+func TestAddProxyRoute_FileProvider(t *testing.T) {
+	compose := `services:
+  vaultwarden:
+    image: vaultwarden/server
+    container_name: ${CONTAINER_NAME:-vaultwarden}
+    ports: ["8080:80"]
+    labels:
+      - "traefik.http.routers.vaultwarden.rule=Host(` + "`vault.home.lan`" + `)"
+`
+	routed, route, err := addProxyRoute(compose, map[string]string{"CONTAINER_NAME": "vault"}, ProxyRoute{Domain: "vault.home.lan", Router: "vaultwarden-1"}, &caddyProvider{})
+	require.NoError(t, err)
+	require.NotNil(t, route, "Traefik labels do not configure Caddy")
+	assert.Equal(t, "vault:80", route.Upstream, "the container name is resolved on the proxy network")
+
+	var parsed struct {
+		Services map[string]struct {
+			Networks []string `yaml:"networks"`
+			Labels   []string `yaml:"labels"`
+		} `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(routed), &parsed))
+	assert.Equal(t, []string{"default", "homelab-proxy"}, parsed.Services["vaultwarden"].Networks)
+	assert.Len(t, parsed.Services["vaultwarden"].Labels, 1, "no labels are added")
+}
+
+func TestApplyProxyOptions(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	deployment := &models.Deployment{ComposeProject: "nextcloud-abc123"}
+	require.NoError(t, service.applyProxyOptions(deployment, ProxyOptions{HTTPS: true}, map[string]interface{}{"domain": " Cloud.Home.LAN "}))
+	assert.Equal(t, "cloud.home.lan", deployment.Domain)
+	assert.Equal(t, "homelab-ca", deployment.CertResolver, "public ACME cannot validate private domains")
+	require.NoError(t, db.Create(&models.Deployment{RecipeSlug: "nextcloud", ComposeProject: "nextcloud-abc123", Domain: "cloud.home.lan"}).Error)
+
+	other := &models.Deployment{}
+	assert.EqualError(t, service.applyProxyOptions(other, ProxyOptions{Domain: "cloud.home.lan"}, nil), "domain cloud.home.lan is already used by nextcloud-abc123")
+	assert.EqualError(t, service.applyProxyOptions(other, ProxyOptions{Domain: "not a domain"}, nil), `invalid domain "not a domain"`)
+	assert.EqualError(t, service.applyProxyOptions(other, ProxyOptions{HTTPS: true}, nil), "https requires a domain")
+
+	require.NoError(t, service.applyProxyOptions(other, ProxyOptions{Domain: "wiki.home.lan", HTTPS: true, CertResolver: "internal-ca"}, nil))
+	assert.Equal(t, "internal-ca", other.CertResolver)
+	public := &models.Deployment{}
+	require.NoError(t, service.applyProxyOptions(public, ProxyOptions{Domain: "cloud.example.com", HTTPS: true}, nil))
+	assert.Equal(t, "letsencrypt", public.CertResolver)
+
+	plain := &models.Deployment{}
+	require.NoError(t, service.applyProxyOptions(plain, ProxyOptions{Domain: "photos.home.lan"}, nil))
+	assert.Empty(t, plain.CertResolver)
+}
@@ -0,0 +1,464 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultMaxConcurrentJobs is how many deployment jobs run at once across all devices
+	defaultMaxConcurrentJobs = 2
+	// jobPollInterval re-checks the queue in case a wake-up was missed
+	jobPollInterval = 10 * time.Second
+)
+
+// ErrJobNotActive is returned when cancelling a deployment that has no queued or running job
+var ErrJobNotActive = errors.New("no queued or running job")
+
+// JobRunner executes a deployment job; a non-nil error marks the job failed
+type JobRunner func(ctx context.Context, job *models.DeploymentJob) error
+
+// JobRecoverer decides what happens to a job that was running when the server stopped
+// Returning true requeues the job so it resumes from its last completed phase
+type JobRecoverer func(job *models.DeploymentJob) bool
+
+// DeploymentQueue runs persisted deployment jobs on a bounded worker pool
+// Jobs touching the same device run one at a time, in the order they were queued
+type DeploymentQueue struct {
+	db            *gorm.DB
+	credService   *CredentialService
+	run           JobRunner
+	recoverJob    JobRecoverer
+	maxConcurrent int
+	running       map[uuid.UUID]*runningJob // Job ID -> running job
+	busyDevices   map[uuid.UUID]bool
+	wake          chan struct{}
+	mu            sync.Mutex
+	cancel        context.CancelFunc
+}
+
+// runningJob is a job that holds a worker
+type runningJob struct {
+	job       *models.DeploymentJob
+	cancel    context.CancelFunc
+	cancelled bool
+	done      chan struct{} // Closed once the runner returned and the outcome is recorded
+}
+
+// NewDeploymentQueue creates a deployment job queue; it does nothing until Start is called
+func NewDeploymentQueue(db *gorm.DB, credService *CredentialService, run JobRunner, recoverJob JobRecoverer) *DeploymentQueue {
+	return &DeploymentQueue{
+		db:            db,
+		credService:   credService,
+		run:           run,
+		recoverJob:    recoverJob,
+		maxConcurrent: defaultMaxConcurrentJobs,
+		running:       make(map[uuid.UUID]*runningJob),
+		busyDevices:   make(map[uuid.UUID]bool),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// SetMaxConcurrent sets how many jobs may run at once (minimum 1)
+func (q *DeploymentQueue) SetMaxConcurrent(n int) {
+	if n < 1 {
+		n = 1
+	}
+	q.mu.Lock()
+	q.maxConcurrent = n
+	q.mu.Unlock()
+	q.signal()
+}
+
+// Start recovers jobs interrupted by the last shutdown and begins dispatching queued jobs
+// Stopping the queue does not cancel running jobs; jobs still running at exit are recovered on the next start
+func (q *DeploymentQueue) Start(ctx context.Context) error {
+	if err := q.recoverInterrupted(); err != nil {
+		return err
+	}
+
+	log.Println("[DeploymentQueue] Starting deployment job queue")
+
+	ctx, cancel := context.WithCancel(ctx)
+	q.cancel = cancel
+
+	ticker := time.NewTicker(jobPollInterval)
+	go func() {
+		for {
+			q.dispatch()
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Println("[DeploymentQueue] Deployment job queue stopped")
+				return
+			case <-q.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops dispatching new jobs
+func (q *DeploymentQueue) Stop() {
+	if q.cancel != nil {
+		q.cancel()
+	}
+}
+
+// Enqueue persists a job and its parameters and wakes the dispatcher
+// Parameters are stored in the credential store because they can contain passwords
+func (q *DeploymentQueue) Enqueue(job *models.DeploymentJob, params interface{}) error {
+	if job.ID == uuid.Nil {
+		job.ID = uuid.New()
+	}
+	job.Status = models.DeploymentJobQueued
+
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal job parameters: %w", err)
+		}
+		key := fmt.Sprintf("deployment-job:%s", job.ID)
+		if err := q.credService.StoreCredential(key, string(data)); err != nil {
+			return fmt.Errorf("failed to store job parameters: %w", err)
+		}
+		job.CredentialKey = key
+	}
+
+	if err := q.db.Create(job).Error; err != nil {
+		q.deleteParams(job)
+		return fmt.Errorf("failed to queue job: %w", err)
+	}
+
+	log.Printf("[DeploymentQueue] Queued %s job %s for deployment %s", job.Type, job.ID, job.DeploymentID)
+	q.signal()
+	return nil
+}
+
+// LoadParams decodes the parameters a job was queued with
+func (q *DeploymentQueue) LoadParams(job *models.DeploymentJob, params interface{}) error {
+	if job.CredentialKey == "" {
+		return fmt.Errorf("job has no stored parameters")
+	}
+	data, err := q.credService.GetCredential(job.CredentialKey)
+	if err != nil {
+		return fmt.Errorf("failed to load job parameters: %w", err)
+	}
+	if err := json.Unmarshal([]byte(data), params); err != nil {
+		return fmt.Errorf("failed to parse job parameters: %w", err)
+	}
+	return nil
+}
+
+// SetPhase records the last phase a job completed so it can resume there after a restart
+func (q *DeploymentQueue) SetPhase(job *models.DeploymentJob, phase string) {
+	job.Phase = phase
+	if err := q.db.Model(job).Update("phase", phase).Error; err != nil {
+		log.Printf("[DeploymentQueue] Failed to record phase %s for job %s: %v", phase, job.ID, err)
+	}
+}
+
+// Cancel cancels a deployment's active job
+// A queued job is marked cancelled immediately and returned with wasRunning false;
+// a running job has its context cancelled and is marked cancelled once its runner returns
+func (q *DeploymentQueue) Cancel(deploymentID uuid.UUID) (job *models.DeploymentJob, wasRunning bool, err error) {
+	job, r, err := q.cancelJob(deploymentID)
+	return job, r != nil, err
+}
+
+// CancelAndWait cancels a deployment's active job and waits until a running one has returned
+// Returns ErrJobNotActive if there is none, and an error if the runner does not stop within the timeout
+func (q *DeploymentQueue) CancelAndWait(deploymentID uuid.UUID, timeout time.Duration) error {
+	_, r, err := q.cancelJob(deploymentID)
+	if err != nil || r == nil {
+		return err
+	}
+
+	select {
+	case <-r.done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("%s job %s is still stopping", r.job.Type, r.job.ID)
+	}
+}
+
+// cancelJob cancels a deployment's active job, returning its worker if it is running
+func (q *DeploymentQueue) cancelJob(deploymentID uuid.UUID) (*models.DeploymentJob, *runningJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, r := range q.running {
+		if r.job.DeploymentID == deploymentID {
+			r.cancelled = true
+			r.cancel()
+			log.Printf("[DeploymentQueue] Cancelling running %s job %s", r.job.Type, r.job.ID)
+			return r.job, r, nil
+		}
+	}
+
+	var queued models.DeploymentJob
+	if err := q.db.Where("deployment_id = ? AND status = ?", deploymentID, models.DeploymentJobQueued).
+		Order("created_at ASC").First(&queued).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrJobNotActive
+		}
+		return nil, nil, err
+	}
+
+	q.finish(&queued, models.DeploymentJobCancelled, "")
+	log.Printf("[DeploymentQueue] Cancelled queued %s job %s", queued.Type, queued.ID)
+	return &queued, nil, nil
+}
+
+// ActiveJob returns a deployment's queued or running job with its queue position
+// Returns ErrJobNotActive if the deployment has none
+func (q *DeploymentQueue) ActiveJob(deploymentID uuid.UUID) (*models.DeploymentJob, error) {
+	var job models.DeploymentJob
+	if err := q.db.Where("deployment_id = ? AND status IN ?", deploymentID, activeJobStatuses).
+		Order("created_at ASC").First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJobNotActive
+		}
+		return nil, err
+	}
+	if err := q.fillQueuePositions([]*models.DeploymentJob{&job}); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs returns jobs, newest first, optionally filtered by deployment and status
+// Queued jobs include their position in the queue
+func (q *DeploymentQueue) ListJobs(deploymentID *uuid.UUID, status *models.DeploymentJobStatus, limit int) ([]models.DeploymentJob, error) {
+	query := q.db.Order("created_at DESC")
+	if deploymentID != nil {
+		query = query.Where("deployment_id = ?", *deploymentID)
+	}
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var jobs []models.DeploymentJob
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*models.DeploymentJob, len(jobs))
+	for i := range jobs {
+		ptrs[i] = &jobs[i]
+	}
+	if err := q.fillQueuePositions(ptrs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// fillQueuePositions sets QueuePosition on queued jobs (1 = next to run)
+func (q *DeploymentQueue) fillQueuePositions(jobs []*models.DeploymentJob) error {
+	var hasQueued bool
+	for _, job := range jobs {
+		if job.Status == models.DeploymentJobQueued {
+			hasQueued = true
+			break
+		}
+	}
+	if !hasQueued {
+		return nil
+	}
+
+	var queued []models.DeploymentJob
+	if err := q.db.Select("id").Where("status = ?", models.DeploymentJobQueued).
+		Order("created_at ASC").Find(&queued).Error; err != nil {
+		return err
+	}
+	positions := make(map[uuid.UUID]int, len(queued))
+	for i, job := range queued {
+		positions[job.ID] = i + 1
+	}
+	for _, job := range jobs {
+		job.QueuePosition = positions[job.ID]
+	}
+	return nil
+}
+
+// recoverInterrupted handles jobs left running by the previous server process
+func (q *DeploymentQueue) recoverInterrupted() error {
+	var interrupted []models.DeploymentJob
+	if err := q.db.Where("status = ?", models.DeploymentJobRunning).Order("created_at ASC").Find(&interrupted).Error; err != nil {
+		return fmt.Errorf("failed to load interrupted jobs: %w", err)
+	}
+
+	for i := range interrupted {
+		job := &interrupted[i]
+		if q.recoverJob != nil && q.recoverJob(job) {
+			log.Printf("[DeploymentQueue] Resuming interrupted %s job %s (last completed phase: %s)", job.Type, job.ID, job.Phase)
+			if err := q.db.Model(job).Update("status", models.DeploymentJobQueued).Error; err != nil {
+				return fmt.Errorf("failed to requeue job %s: %w", job.ID, err)
+			}
+			continue
+		}
+		log.Printf("[DeploymentQueue] Failing interrupted %s job %s", job.Type, job.ID)
+		q.finish(job, models.DeploymentJobFailed, "Interrupted by a server restart")
+	}
+	return nil
+}
+
+// dispatch starts queued jobs while workers are free
+// Devices of a job that has to wait are reserved for the rest of the pass, so later jobs can't overtake it
+func (q *DeploymentQueue) dispatch() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.running) >= q.maxConcurrent {
+		return
+	}
+
+	var queued []models.DeploymentJob
+	if err := q.db.Where("status = ?", models.DeploymentJobQueued).Order("created_at ASC").Find(&queued).Error; err != nil {
+		log.Printf("[DeploymentQueue] Failed to load queued jobs: %v", err)
+		return
+	}
+
+	reserved := make(map[uuid.UUID]bool)
+	for i := range queued {
+		if len(q.running) >= q.maxConcurrent {
+			return
+		}
+		job := &queued[i]
+		devices := jobDevices(job)
+
+		blocked := false
+		for _, id := range devices {
+			if q.busyDevices[id] || reserved[id] {
+				blocked = true
+			}
+		}
+		if blocked {
+			for _, id := range devices {
+				reserved[id] = true
+			}
+			continue
+		}
+
+		q.start(job, devices)
+	}
+}
+
+// start marks a job running and hands it to a worker; the caller holds q.mu
+func (q *DeploymentQueue) start(job *models.DeploymentJob, devices []uuid.UUID) {
+	now := time.Now()
+	job.Status = models.DeploymentJobRunning
+	job.StartedAt = &now
+	job.Attempts++
+	if err := q.db.Model(job).Updates(map[string]interface{}{
+		"status":     job.Status,
+		"started_at": job.StartedAt,
+		"attempts":   job.Attempts,
+	}).Error; err != nil {
+		log.Printf("[DeploymentQueue] Failed to start job %s: %v", job.ID, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &runningJob{job: job, cancel: cancel, done: make(chan struct{})}
+	q.running[job.ID] = r
+	for _, id := range devices {
+		q.busyDevices[id] = true
+	}
+
+	log.Printf("[DeploymentQueue] Running %s job %s for deployment %s (attempt %d)", job.Type, job.ID, job.DeploymentID, job.Attempts)
+	go q.execute(ctx, r, devices)
+}
+
+// execute runs a job and records its outcome
+func (q *DeploymentQueue) execute(ctx context.Context, r *runningJob, devices []uuid.UUID) {
+	job := r.job
+	defer close(r.done)
+
+	var err error
+	func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = fmt.Errorf("job panicked: %v", rec)
+			}
+		}()
+		err = q.run(ctx, job)
+	}()
+	r.cancel()
+
+	q.mu.Lock()
+	delete(q.running, job.ID)
+	for _, id := range devices {
+		delete(q.busyDevices, id)
+	}
+	cancelled := r.cancelled
+	q.mu.Unlock()
+
+	switch {
+	case cancelled:
+		q.finish(job, models.DeploymentJobCancelled, "")
+	case err != nil:
+		log.Printf("[DeploymentQueue] %s job %s failed: %v", job.Type, job.ID, err)
+		q.finish(job, models.DeploymentJobFailed, err.Error())
+	default:
+		q.finish(job, models.DeploymentJobCompleted, "")
+	}
+
+	q.signal()
+}
+
+// finish records a job's final status and removes its stored parameters
+func (q *DeploymentQueue) finish(job *models.DeploymentJob, status models.DeploymentJobStatus, errMsg string) {
+	now := time.Now()
+	job.Status = status
+	job.Error = errMsg
+	job.CompletedAt = &now
+	if err := q.db.Model(job).Updates(map[string]interface{}{
+		"status":       status,
+		"error":        errMsg,
+		"completed_at": now,
+	}).Error; err != nil {
+		log.Printf("[DeploymentQueue] Failed to record result of job %s: %v", job.ID, err)
+	}
+	q.deleteParams(job)
+}
+
+// deleteParams removes a job's parameters from the credential store
+func (q *DeploymentQueue) deleteParams(job *models.DeploymentJob) {
+	if job.CredentialKey == "" {
+		return
+	}
+	if err := q.credService.DeleteCredentials(job.CredentialKey); err != nil {
+		log.Printf("[DeploymentQueue] Failed to delete parameters of job %s: %v", job.ID, err)
+	}
+}
+
+// signal wakes the dispatcher without blocking
+func (q *DeploymentQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// jobDevices returns the devices a job needs exclusive use of
+func jobDevices(job *models.DeploymentJob) []uuid.UUID {
+	devices := []uuid.UUID{job.DeviceID}
+	if job.TargetDeviceID != nil && *job.TargetDeviceID != job.DeviceID {
+		devices = append(devices, *job.TargetDeviceID)
+	}
+	return devices
+}
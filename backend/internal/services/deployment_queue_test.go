@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingRunner runs jobs until the test releases them
+type blockingRunner struct {
+	mu       sync.Mutex
+	started  chan uuid.UUID
+	release  map[uuid.UUID]chan error
+	finished chan uuid.UUID
+}
+
+func newBlockingRunner() *blockingRunner {
+	return &blockingRunner{
+		started:  make(chan uuid.UUID, 10),
+		release:  make(map[uuid.UUID]chan error),
+		finished: make(chan uuid.UUID, 10),
+	}
+}
+
+func (r *blockingRunner) channel(deploymentID uuid.UUID) chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.release[deploymentID] == nil {
+		r.release[deploymentID] = make(chan error, 1)
+	}
+	return r.release[deploymentID]
+}
+
+func (r *blockingRunner) run(ctx context.Context, job *models.DeploymentJob) error {
+	r.started <- job.DeploymentID
+	defer func() { r.finished <- job.DeploymentID }()
+	select {
+	case err := <-r.channel(job.DeploymentID):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func waitForID(t *testing.T, ch chan uuid.UUID) uuid.UUID {
+	t.Helper()
+	select {
+	case id := <-ch:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for job")
+		return uuid.Nil
+	}
+}
+
+func assertNoneStarted(t *testing.T, ch chan uuid.UUID) {
+	t.Helper()
+	select {
+	case id := <-ch:
+		t.Fatalf("job for deployment %s started unexpectedly", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func jobStatus(t *testing.T, queue *DeploymentQueue, deploymentID uuid.UUID) models.DeploymentJobStatus {
+	t.Helper()
+	var job models.DeploymentJob
+	require.NoError(t, queue.db.Where("deployment_id = ?", deploymentID).First(&job).Error)
+	return job.Status
+}
+
+func TestDeploymentQueue_SerializesPerDeviceWithGlobalLimit(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newBlockingRunner()
+	queue := NewDeploymentQueue(db, setupTestCredentialService(t), runner.run, nil)
+	queue.SetMaxConcurrent(2)
+
+	deviceA, deviceB, deviceC := uuid.New(), uuid.New(), uuid.New()
+	first, second, third, fourth := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	for _, job := range []*models.DeploymentJob{
+		{DeploymentID: first, Type: models.DeploymentJobDeploy, DeviceID: deviceA},
+		{DeploymentID: second, Type: models.DeploymentJobUpgrade, DeviceID: deviceA},
+		{DeploymentID: third, Type: models.DeploymentJobDeploy, DeviceID: deviceB},
+		{DeploymentID: fourth, Type: models.DeploymentJobDeploy, DeviceID: deviceC},
+	} {
+		require.NoError(t, queue.Enqueue(job, nil))
+		time.Sleep(time.Millisecond) // Distinct creation times keep queue order stable
+	}
+
+	jobs, err := queue.ListJobs(nil, nil, 0)
+	require.NoError(t, err)
+	positions := map[uuid.UUID]int{}
+	for _, job := range jobs {
+		positions[job.DeploymentID] = job.QueuePosition
+	}
+	assert.Equal(t, map[uuid.UUID]int{first: 1, second: 2, third: 3, fourth: 4}, positions)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, queue.Start(ctx))
+	defer queue.Stop()
+
+	// The second job on device A waits; the device B job takes the other worker
+	started := []uuid.UUID{waitForID(t, runner.started), waitForID(t, runner.started)}
+	assert.ElementsMatch(t, []uuid.UUID{first, third}, started)
+	assertNoneStarted(t, runner.started)
+
+	active, err := queue.ActiveJob(second)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeploymentJobQueued, active.Status)
+	assert.Equal(t, 1, active.QueuePosition)
+
+	// Freeing device A starts the job that was queued first for it
+	runner.channel(first) <- nil
+	waitForID(t, runner.finished)
+	assert.Equal(t, second, waitForID(t, runner.started))
+	assertNoneStarted(t, runner.started)
+	assert.Equal(t, models.DeploymentJobCompleted, jobStatus(t, queue, first))
+
+	runner.channel(third) <- errors.New("health check failed")
+	waitForID(t, runner.finished)
+	assert.Equal(t, fourth, waitForID(t, runner.started))
+
+	var failed models.DeploymentJob
+	require.NoError(t, db.Where("deployment_id = ?", third).First(&failed).Error)
+	assert.Equal(t, models.DeploymentJobFailed, failed.Status)
+	assert.Equal(t, "health check failed", failed.Error)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.NotNil(t, failed.CompletedAt)
+
+	runner.channel(second) <- nil
+	runner.channel(fourth) <- nil
+}
+
+func TestDeploymentQueue_Cancel(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	runner := newBlockingRunner()
+	queue := NewDeploymentQueue(db, credService, runner.run, nil)
+
+	device := uuid.New()
+	running, queued := uuid.New(), uuid.New()
+	require.NoError(t, queue.Enqueue(&models.DeploymentJob{DeploymentID: running, Type: models.DeploymentJobDeploy, DeviceID: device}, nil))
+	time.Sleep(time.Millisecond)
+	queuedJob := &models.DeploymentJob{DeploymentID: queued, Type: models.DeploymentJobDeploy, DeviceID: device}
+	require.NoError(t, queue.Enqueue(queuedJob, map[string]interface{}{"admin_password": "hunter22"}))
+
+	var params map[string]interface{}
+	require.NoError(t, queue.LoadParams(queuedJob, &params))
+	assert.Equal(t, "hunter22", params["admin_password"])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, queue.Start(ctx))
+	defer queue.Stop()
+	assert.Equal(t, running, waitForID(t, runner.started))
+
+	// A queued job is cancelled without running, and its stored parameters are removed
+	job, wasRunning, err := queue.Cancel(queued)
+	require.NoError(t, err)
+	assert.False(t, wasRunning)
+	assert.Equal(t, models.DeploymentJobCancelled, job.Status)
+	_, err = credService.GetCredential(queuedJob.CredentialKey)
+	assert.Error(t, err)
+
+	// A running job has its context cancelled
+	_, wasRunning, err = queue.Cancel(running)
+	require.NoError(t, err)
+	assert.True(t, wasRunning)
+	waitForID(t, runner.finished)
+	assert.Eventually(t, func() bool {
+		return jobStatus(t, queue, running) == models.DeploymentJobCancelled
+	}, 2*time.Second, 10*time.Millisecond)
+	assertNoneStarted(t, runner.started)
+
+	_, _, err = queue.Cancel(running)
+	assert.ErrorIs(t, err, ErrJobNotActive)
+}
+
+func TestDeploymentQueue_CancelAndWait(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newBlockingRunner()
+	queue := NewDeploymentQueue(db, setupTestCredentialService(t), runner.run, nil)
+
+	deploymentID := uuid.New()
+	require.NoError(t, queue.Enqueue(&models.DeploymentJob{DeploymentID: deploymentID, Type: models.DeploymentJobUpgrade, DeviceID: uuid.New()}, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, queue.Start(ctx))
+	defer queue.Stop()
+	waitForID(t, runner.started)
+
+	// Returns only once the runner is done with the deployment and the outcome is recorded
+	require.NoError(t, queue.CancelAndWait(deploymentID, 2*time.Second))
+	select {
+	case <-runner.finished:
+	default:
+		t.Fatal("CancelAndWait returned while the job was still running")
+	}
+	assert.Equal(t, models.DeploymentJobCancelled, jobStatus(t, queue, deploymentID))
+
+	assert.ErrorIs(t, queue.CancelAndWait(deploymentID, time.Second), ErrJobNotActive)
+}
+
+func TestDeploymentQueue_RecoversInterruptedJobs(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newBlockingRunner()
+	queue := NewDeploymentQueue(db, setupTestCredentialService(t), runner.run, func(job *models.DeploymentJob) bool {
+		return job.Type == models.DeploymentJobDeploy
+	})
+
+	resumed := models.DeploymentJob{DeploymentID: uuid.New(), Type: models.DeploymentJobDeploy, Status: models.DeploymentJobRunning,
+		DeviceID: uuid.New(), Phase: deployPhaseDatabase, Attempts: 1}
+	interrupted := models.DeploymentJob{DeploymentID: uuid.New(), Type: models.DeploymentJobUpgrade, Status: models.DeploymentJobRunning,
+		DeviceID: uuid.New(), Attempts: 1}
+	require.NoError(t, db.Create(&resumed).Error)
+	require.NoError(t, db.Create(&interrupted).Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, queue.Start(ctx))
+	defer queue.Stop()
+
+	assert.Equal(t, resumed.DeploymentID, waitForID(t, runner.started))
+	assertNoneStarted(t, runner.started)
+
+	var job models.DeploymentJob
+	require.NoError(t, db.First(&job, "id = ?", resumed.ID).Error)
+	assert.Equal(t, models.DeploymentJobRunning, job.Status)
+	assert.Equal(t, deployPhaseDatabase, job.Phase, "resumes from the last completed phase")
+	assert.Equal(t, 2, job.Attempts)
+
+	var failed models.DeploymentJob
+	require.NoError(t, db.First(&failed, "id = ?", interrupted.ID).Error)
+	assert.Equal(t, models.DeploymentJobFailed, failed.Status)
+	assert.Equal(t, "Interrupted by a server restart", failed.Error)
+
+	runner.channel(resumed.DeploymentID) <- nil
+}
+
+func TestDeployPhaseDone(t *testing.T) {
+	job := &models.DeploymentJob{}
+	assert.False(t, deployPhaseDone(job, deployPhaseDependencies))
+
+	job.Phase = deployPhaseDatabase
+	assert.True(t, deployPhaseDone(job, deployPhaseDependencies))
+	assert.True(t, deployPhaseDone(job, deployPhaseDatabase))
+	assert.False(t, deployPhaseDone(job, deployPhaseContainers))
+	assert.False(t, deployPhaseDone(job, "unknown"))
+
+	// A job resumed after the health check runs post-install steps; one resumed after them does not
+	job.Phase = deployPhaseHealthCheck
+	assert.False(t, deployPhaseDone(job, deployPhasePostInstall))
+	job.Phase = deployPhasePostInstall
+	assert.True(t, deployPhaseDone(job, deployPhasePostInstall))
+	assert.True(t, deployPhaseDone(job, deployPhaseHealthCheck))
+}
+
+func TestDeploymentService_RecoverInterruptedDeployments(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	deviceService := NewDeviceService(db, credService, nil)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), deviceService, credService, nil, nil, nil)
+
+	resumable := models.Deployment{RecipeSlug: "wiki-js", DeviceID: uuid.New(), ComposeProject: "wiki-js-1", Status: models.DeploymentStatusDeploying}
+	upgrading := models.Deployment{RecipeSlug: "wiki-js", DeviceID: uuid.New(), ComposeProject: "wiki-js-2", Status: models.DeploymentStatusPreparing}
+	orphaned := models.Deployment{RecipeSlug: "wiki-js", DeviceID: uuid.New(), ComposeProject: "wiki-js-3", Status: models.DeploymentStatusHealthCheck}
+	queued := models.Deployment{RecipeSlug: "wiki-js", DeviceID: uuid.New(), ComposeProject: "wiki-js-4", Status: models.DeploymentStatusValidating}
+	migrating := models.Deployment{RecipeSlug: "wiki-js", DeviceID: uuid.New(), ComposeProject: "wiki-js-5", Status: models.DeploymentStatusMigrating}
+	for _, d := range []*models.Deployment{&resumable, &upgrading, &orphaned, &queued, &migrating} {
+		require.NoError(t, db.Create(d).Error)
+	}
+
+	assert.True(t, service.recoverJob(&models.DeploymentJob{DeploymentID: resumable.ID, Type: models.DeploymentJobDeploy, Attempts: 1}))
+	assert.False(t, service.recoverJob(&models.DeploymentJob{DeploymentID: upgrading.ID, Type: models.DeploymentJobUpgrade, Attempts: 1}))
+	assert.True(t, service.recoverJob(&models.DeploymentJob{DeploymentID: migrating.ID, Type: models.DeploymentJobMigrate, Attempts: 1}),
+		"interrupted migrations are requeued to roll back")
+	assert.False(t, service.recoverJob(&models.DeploymentJob{DeploymentID: migrating.ID, Type: models.DeploymentJobMigrate, Attempts: maxDeployJobAttempts}))
+
+	require.NoError(t, db.Create(&models.DeploymentJob{DeploymentID: resumable.ID, Type: models.DeploymentJobDeploy,
+		Status: models.DeploymentJobQueued, DeviceID: resumable.DeviceID}).Error)
+	require.NoError(t, db.Create(&models.DeploymentJob{DeploymentID: queued.ID, Type: models.DeploymentJobDeploy,
+		Status: models.DeploymentJobQueued, DeviceID: queued.DeviceID}).Error)
+	service.failOrphanedDeployments()
+
+	statuses := map[uuid.UUID]models.DeploymentStatus{}
+	var deployments []models.Deployment
+	require.NoError(t, db.Find(&deployments).Error)
+	for _, d := range deployments {
+		statuses[d.ID] = d.Status
+	}
+	assert.Equal(t, models.DeploymentStatusDeploying, statuses[resumable.ID])
+	assert.Equal(t, models.DeploymentStatusFailed, statuses[upgrading.ID])
+	assert.Equal(t, models.DeploymentStatusFailed, statuses[orphaned.ID])
+	assert.Equal(t, models.DeploymentStatusValidating, statuses[queued.ID], "queued deployments keep waiting")
+
+	failed, err := service.GetDeployment(upgrading.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "Interrupted by a server restart during upgrade", failed.ErrorDetails)
+}
+
+func TestDeploymentService_CancelQueuedUpgrade(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	deployment := &models.Deployment{RecipeSlug: "wiki-js", DeviceID: uuid.New(), ComposeProject: "wiki-js-1", Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(deployment).Error)
+	job := &models.DeploymentJob{DeploymentID: deployment.ID, Type: models.DeploymentJobUpgrade, DeviceID: deployment.DeviceID}
+	require.NoError(t, service.jobQueue.Enqueue(job, UpgradeDeploymentRequest{}))
+
+	// The app keeps running while the upgrade waits, and cancelling leaves it that way
+	require.NoError(t, service.CancelDeployment(deployment.ID.String()))
+	assert.Equal(t, models.DeploymentJobCancelled, jobStatus(t, service.jobQueue, deployment.ID))
+	reloaded, err := service.GetDeployment(deployment.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, models.DeploymentStatusRunning, reloaded.Status)
+
+	assert.Error(t, service.CancelDeployment(deployment.ID.String()), "nothing left to cancel")
+}
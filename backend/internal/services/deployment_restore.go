@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+// restoreJobParams are the parameters of a queued snapshot restore
+type restoreJobParams struct {
+	SnapshotID uuid.UUID            `json:"snapshot_id"`
+	Request    RestoreBackupRequest `json:"request"`
+}
+
+// RestoreBackup queues a restore of a backup snapshot into its deployment
+// The restore runs on the deployment job queue, so it never overlaps an upgrade, migration or other job
+func (s *DeploymentService) RestoreBackup(id string, snapshotID uuid.UUID, req RestoreBackupRequest) (*models.DeploymentJob, error) {
+	if s.backupService == nil {
+		return nil, fmt.Errorf("backups are not configured")
+	}
+
+	deployment, err := s.GetDeployment(id)
+	if err != nil {
+		return nil, fmt.Errorf("deployment not found: %w", err)
+	}
+
+	restorableStatuses := map[models.DeploymentStatus]bool{
+		models.DeploymentStatusRunning:    true,
+		models.DeploymentStatusStopped:    true,
+		models.DeploymentStatusRolledBack: true,
+		models.DeploymentStatusUnhealthy:  true,
+	}
+	if !restorableStatuses[deployment.Status] {
+		return nil, fmt.Errorf("deployment cannot be restored (current status: %s)", deployment.Status)
+	}
+	if err := requireComposeProject(deployment); err != nil {
+		return nil, err
+	}
+	if err := s.backupService.ValidateRestore(deployment.ID, snapshotID, req); err != nil {
+		return nil, err
+	}
+	if err := s.ensureNoActiveJob(deployment.ID); err != nil {
+		return nil, err
+	}
+
+	job := &models.DeploymentJob{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentJobRestore,
+		DeviceID:     deployment.DeviceID,
+	}
+	if err := s.jobQueue.Enqueue(job, restoreJobParams{SnapshotID: snapshotID, Request: req}); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// executeRestore restores a snapshot for a queued restore job
+func (s *DeploymentService) executeRestore(deployment *models.Deployment, params restoreJobParams) error {
+	s.appendLog(deployment, fmt.Sprintf("Restoring backup snapshot %s", params.SnapshotID))
+
+	if err := s.backupService.RestoreSnapshot(deployment.ID, params.SnapshotID, params.Request); err != nil {
+		s.appendLog(deployment, fmt.Sprintf("❌ Restore failed: %v", err))
+		return err
+	}
+
+	s.appendLog(deployment, "✓ Backup restored")
+	return nil
+}
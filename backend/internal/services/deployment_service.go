@@ -8,7 +8,6 @@ import (
 	"log"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -43,11 +42,19 @@ type DeploymentService struct {
 	deviceScorer       *DeviceScorer
 	dbPoolManager      *DatabasePoolManager
 	cachePoolManager   *CachePoolManager
+	dedicatedInstances *DedicatedInstanceManager
 	dependencyService  *DependencyService
 	environmentBuilder *EnvironmentBuilder
 	configValidator    *ConfigValidator
-	deviceLocks        sync.Map // Map of device ID -> *sync.Mutex to prevent concurrent deployments
-	cancelFuncs        sync.Map // Map of deployment ID -> context.CancelFunc for cancellation
+	resourceValidator  *ResourceValidator
+	backupService      *BackupService
+	jobQueue           *DeploymentQueue // Runs deployments, upgrades, config changes, migrations and restores
+	events             *DeploymentEventService
+	ports              *PortRegistry
+	proxies            map[string]ReverseProxyProvider // Reverse proxy providers by recipe slug
+	certificates       *CertificateAuthority
+	dns                *DNSService
+	mdns               *MDNSAdvertiser
 }
 
 // WSHub interface for WebSocket broadcasting
@@ -72,8 +79,10 @@ func NewDeploymentService(
 	orchestrator ContainerOrchestrator,
 ) *DeploymentService {
 	// Initialize pool managers with infraConfig and orchestrator
+	// Pools address their containers by container_name, which only Compose honours; see SetStackOrchestrator
 	dbPoolManager := NewDatabasePoolManager(db, sshClient, credService, infraConfig, orchestrator)
 	cachePoolManager := NewCachePoolManager(db, sshClient, infraConfig, orchestrator)
+	dedicatedInstances := NewDedicatedInstanceManager(db, credService, infraConfig, orchestrator, dbPoolManager, cachePoolManager)
 
 	// Initialize services for DependencyService
 	// For software registry, use default path (will be overridden if already initialized in main)
@@ -99,11 +108,13 @@ func NewDeploymentService(
 		softwareService,
 		dbPoolManager,
 		cachePoolManager,
+		dedicatedInstances,
 		infraConfig,
 		orchestrator,
+		orchestrator,
 	)
 
-	return &DeploymentService{
+	s := &DeploymentService{
 		db:                 db,
 		sshClient:          sshClient,
 		recipeLoader:       recipeLoader,
@@ -113,10 +124,57 @@ func NewDeploymentService(
 		deviceScorer:       NewDeviceScorer(db, sshClient),
 		dbPoolManager:      dbPoolManager,
 		cachePoolManager:   cachePoolManager,
+		dedicatedInstances: dedicatedInstances,
 		dependencyService:  dependencyService,
 		environmentBuilder: NewEnvironmentBuilder(credService, dbPoolManager),
 		configValidator:    NewConfigValidator(),
-	}
+		resourceValidator:  NewResourceValidator(sshClient),
+		events:             NewDeploymentEventService(db, wsHub),
+		ports:              NewPortRegistry(db, sshClient),
+		proxies:            newReverseProxyProviders(sshClient),
+		certificates:       NewCertificateAuthority(db, credService, wsHub),
+		dns:                NewDNSService(db, credService, sshClient),
+		mdns:               NewMDNSAdvertiser(db),
+	}
+	s.jobQueue = NewDeploymentQueue(db, credService, s.runJob, s.recoverJob)
+	s.certificates.SetDistributor(s)
+	return s
+}
+
+// Events returns the service recording deployment history
+func (s *DeploymentService) Events() *DeploymentEventService {
+	return s.events
+}
+
+// Ports returns the registry of ports held on each device
+func (s *DeploymentService) Ports() *PortRegistry {
+	return s.ports
+}
+
+// Certificates returns the homelab CA issuing certificates for deployment domains
+func (s *DeploymentService) Certificates() *CertificateAuthority {
+	return s.certificates
+}
+
+// DNS returns the service keeping DNS records for deployment domains
+func (s *DeploymentService) DNS() *DNSService {
+	return s.dns
+}
+
+// MDNS returns the advertiser announcing running deployments over mDNS
+func (s *DeploymentService) MDNS() *MDNSAdvertiser {
+	return s.mdns
+}
+
+// SetStackOrchestrator sets the orchestrator that schedules application dependency stacks, e.g. Docker Swarm
+// Everything else keeps running on the orchestrator the service was created with
+func (s *DeploymentService) SetStackOrchestrator(stacks ContainerOrchestrator) {
+	s.dependencyService.stacks = stacks
+}
+
+// SetBackupService sets the backup service used for pre-upgrade snapshots and rollback
+func (s *DeploymentService) SetBackupService(bs *BackupService) {
+	s.backupService = bs
 }
 
 // CreateDeploymentRequest represents a request to create a deployment
@@ -125,6 +183,8 @@ type CreateDeploymentRequest struct {
 	DeviceID       uuid.UUID              `json:"device_id,omitempty"`       // Optional - if not provided, will recommend
 	AutoSelectDevice bool                   `json:"auto_select_device"`       // Auto-select best device
 	Config         map[string]interface{} `json:"config"`
+	ComposeProject string                 `json:"compose_project,omitempty"` // Optional - e.g. the name chosen by a deployment plan
+	ProxyOptions
 }
 
 // DeviceRecommendation represents a recommended device for a recipe
@@ -225,37 +285,16 @@ func (s *DeploymentService) CreateDeployment(req CreateDeploymentRequest) (*mode
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
 
-	// Handle intelligent device selection
-	var deviceID uuid.UUID
-	if req.AutoSelectDevice || req.DeviceID == uuid.Nil {
-		// Use intelligent placement to select best device
-		log.Printf("[Deployment] Auto-selecting device for %s using intelligent placement", recipe.Name)
-		recommendations, err := s.RecommendDevicesForRecipe(req.RecipeSlug)
-		if err != nil {
-			return nil, fmt.Errorf("failed to recommend devices: %w", err)
-		}
-
-		if len(recommendations) == 0 {
-			return nil, fmt.Errorf("no available devices found")
-		}
-
-		// Find first available device
-		var bestDevice *DeviceRecommendation
-		for i := range recommendations {
-			if recommendations[i].Available {
-				bestDevice = &recommendations[i]
-				break
-			}
-		}
-
-		if bestDevice == nil {
-			return nil, fmt.Errorf("no suitable devices found for %s", recipe.Name)
-		}
+	composeProject := req.ComposeProject
+	if composeProject == "" {
+		composeProject = s.generateProjectName(recipe.Slug)
+	} else if err := s.validateComposeProject(composeProject); err != nil {
+		return nil, err
+	}
 
-		deviceID = bestDevice.DeviceID
-		log.Printf("[Deployment] Selected device %s (score: %d) for %s", bestDevice.DeviceName, bestDevice.Score, recipe.Name)
-	} else {
-		deviceID = req.DeviceID
+	deviceID, err := s.selectDevice(req, recipe)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get the device (using intelligently selected deviceID or user-provided)
@@ -264,6 +303,15 @@ func (s *DeploymentService) CreateDeployment(req CreateDeploymentRequest) (*mode
 		return nil, fmt.Errorf("device not found: %w", err)
 	}
 
+	// Port options whose port is already held on the device are moved to a free port
+	if req.Config == nil {
+		req.Config = make(map[string]interface{})
+	}
+	portNotes, err := s.assignRecipePorts(recipe, device, req.Config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Sanitize config: Remove sensitive data (passwords) before storing in database
 	// We only need passwords during template rendering, not after deployment
 	sanitizedConfig := s.sanitizeConfig(req.Config)
@@ -275,31 +323,91 @@ func (s *DeploymentService) CreateDeployment(req CreateDeploymentRequest) (*mode
 	}
 
 	deployment := &models.Deployment{
+		ID:             uuid.New(), // Needed up front to allocate the deployment's ports
 		RecipeSlug:     req.RecipeSlug,
 		RecipeName:     recipe.Name,
 		DeviceID:       deviceID, // Use intelligently selected or user-provided device
 		Status:         models.DeploymentStatusValidating,
 		Config:         configJSON,
-		ComposeProject: s.generateProjectName(recipe.Slug),
+		ComposeProject: composeProject,
+	}
+	if err := s.applyProxyOptions(deployment, req.ProxyOptions, req.Config); err != nil {
+		return nil, err
+	}
+
+	// Claim the published ports now so deployments created before this one runs can't take them
+	env := s.environmentBuilder.PreviewEnvironment(deployment, recipe, req.Config, device, nil, maskedEnvValue)
+	ports := ExtractPortsFromCompose(interpolateComposeVars(recipe.ComposeContent, env))
+	if err := s.ports.AllocateDeploymentPorts(device, deployment.ID, ports); err != nil {
+		return nil, err
 	}
 
 	// Save to database
 	if err := s.db.Create(deployment).Error; err != nil {
+		s.releasePorts(deployment)
 		return nil, fmt.Errorf("failed to create deployment: %w", err)
 	}
+	for _, note := range portNotes {
+		s.appendLog(deployment, fmt.Sprintf("⚠️  %s", note))
+	}
 
-	// Important: Store the ORIGINAL config (with passwords) for template rendering
-	// But use a temporary copy - don't modify the deployment.Config field
-	deployment.Config, _ = json.Marshal(req.Config)
+	// Queue the deployment; the ORIGINAL config (with passwords) is kept with the job for template rendering
+	job := &models.DeploymentJob{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentJobDeploy,
+		DeviceID:     deviceID,
+	}
+	if err := s.jobQueue.Enqueue(job, req.Config); err != nil {
+		s.releasePorts(deployment)
+		s.updateStatus(deployment, models.DeploymentStatusFailed, err.Error())
+		return nil, err
+	}
 
-	// Create cancellable context for this deployment
-	ctx, cancel := context.WithCancel(context.Background())
-	s.cancelFuncs.Store(deployment.ID.String(), cancel)
+	return deployment, nil
+}
 
-	// Start deployment process asynchronously
-	go s.executeDeployment(ctx, deployment, recipe, device)
+// validateComposeProject checks that a requested compose project name is usable and not taken
+func (s *DeploymentService) validateComposeProject(project string) error {
+	if !isValidStackName(project) {
+		return fmt.Errorf("invalid compose project name: %s", project)
+	}
 
-	return deployment, nil
+	var count int64
+	if err := s.db.Model(&models.Deployment{}).Where("compose_project = ?", project).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check compose project: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("compose project %s is already in use", project)
+	}
+	return nil
+}
+
+// selectDevice returns the requested device, or the best available device when auto-selection is requested
+func (s *DeploymentService) selectDevice(req CreateDeploymentRequest, recipe *models.Recipe) (uuid.UUID, error) {
+	if !req.AutoSelectDevice && req.DeviceID != uuid.Nil {
+		return req.DeviceID, nil
+	}
+
+	// Use intelligent placement to select best device
+	log.Printf("[Deployment] Auto-selecting device for %s using intelligent placement", recipe.Name)
+	recommendations, err := s.RecommendDevicesForRecipe(req.RecipeSlug)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to recommend devices: %w", err)
+	}
+
+	if len(recommendations) == 0 {
+		return uuid.Nil, fmt.Errorf("no available devices found")
+	}
+
+	// Find first available device
+	for _, recommendation := range recommendations {
+		if recommendation.Available {
+			log.Printf("[Deployment] Selected device %s (score: %d) for %s", recommendation.DeviceName, recommendation.Score, recipe.Name)
+			return recommendation.DeviceID, nil
+		}
+	}
+
+	return uuid.Nil, fmt.Errorf("no suitable devices found for %s", recipe.Name)
 }
 
 // GetDeployment retrieves a deployment by ID
@@ -337,11 +445,46 @@ func (s *DeploymentService) ListDeployments(deviceID *uuid.UUID, status *models.
 }
 
 // DeleteDeployment stops and removes a deployment
+// Fails with a ProviderInUseError while other deployments depend on it
 func (s *DeploymentService) DeleteDeployment(id string) error {
 	deployment, err := s.GetDeployment(id)
 	if err != nil {
 		return err
 	}
+	return s.deleteDeployment(deployment, false)
+}
+
+// DeleteDeploymentCascade stops and removes a deployment after deleting every deployment that depends on it
+func (s *DeploymentService) DeleteDeploymentCascade(id string) error {
+	deployment, err := s.GetDeployment(id)
+	if err != nil {
+		return err
+	}
+	return s.deleteDeployment(deployment, true)
+}
+
+// deleteDeployment removes a deployment, then any shared infrastructure and dependency stacks it leaves unused
+func (s *DeploymentService) deleteDeployment(deployment *models.Deployment, cascade bool) error {
+	if err := s.removeConsumers(models.DependencyNodeDeployment, deployment.ID, deploymentNodeName(deployment), cascade); err != nil {
+		return err
+	}
+	// Deleting the last consumer of a dependency stack already removes the stack
+	if err := s.db.First(&models.Deployment{}, "id = ?", deployment.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	// Queued or running jobs must not act on a deleted deployment; a running job saves the deployment
+	// until its runner returns, so deleting before then would bring the record back
+	if err := s.jobQueue.CancelAndWait(deployment.ID, jobStopTimeout); err != nil && !errors.Is(err, ErrJobNotActive) {
+		return fmt.Errorf("failed to cancel deployment job, try again once it has stopped: %w", err)
+	}
+	// The job may have changed the deployment, e.g. moved it to another device
+	if err := s.db.First(deployment, "id = ?", deployment.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to reload deployment: %w", err)
+	}
 
 	// Get device for SSH
 	device, err := s.deviceService.GetDevice(deployment.DeviceID)
@@ -350,10 +493,28 @@ func (s *DeploymentService) DeleteDeployment(id string) error {
 	}
 
 	// Extract ports from deployment before stopping
-	portsToClose := ExtractPortsFromCompose(deployment.GeneratedCompose)
+	portsToClose, err := deploymentPorts(deployment)
+	if err != nil {
+		portsToClose = ExtractPortsFromCompose(deployment.GeneratedCompose)
+	}
+
+	// Stop routing the domain before the app goes away
+	s.unrouteDomain(deployment, device)
 
 	// Stop and remove containers
-	if deployment.ComposeProject != "" {
+	// An adoption that never completed left the app running from its original setup, so it is not touched
+	if deployment.IsSwarmStack() {
+		// Volumes are kept, like for Compose projects
+		spec := RemovalSpec{
+			Host:      device.GetSSHHost(),
+			StackName: deployment.ComposeProject,
+			DeployDir: fmt.Sprintf("~/homelab-deployments/%s", deployment.ComposeProject),
+		}
+		if err := NewSwarmOrchestrator(s.sshClient).RemoveWithCleanup(context.Background(), spec); err != nil {
+			return fmt.Errorf("failed to remove stack: %w", err)
+		}
+		log.Printf("[Deployment] Removed stack %s (volumes preserved)", deployment.ComposeProject)
+	} else if deployment.ComposeProject != "" && (!deployment.IsAdopted() || deployment.AdoptedAt != nil) {
 		host := device.GetSSHHost()
 		deployDir := fmt.Sprintf("~/homelab-deployments/%s", deployment.ComposeProject)
 
@@ -368,6 +529,12 @@ func (s *DeploymentService) DeleteDeployment(id string) error {
 		log.Printf("[Deployment] Stopped %s (volumes preserved)", deployment.ComposeProject)
 	}
 
+	// Remove dedicated databases/caches owned by this deployment
+	// Keep the deployment record if this fails so deletion can be retried
+	if err := s.dedicatedInstances.RemoveForDeployment(deployment.ID); err != nil {
+		return err
+	}
+
 	// Clean up firewall ports (only if no other deployments are using them)
 	if len(portsToClose) > 0 {
 		if err := s.cleanupFirewallPorts(device, deployment.ID, portsToClose); err != nil {
@@ -381,6 +548,30 @@ func (s *DeploymentService) DeleteDeployment(id string) error {
 		return fmt.Errorf("failed to delete deployment record: %w", err)
 	}
 
+	// Health history is only meaningful while the deployment exists
+	if err := s.db.Where("deployment_id = ?", deployment.ID).Delete(&models.DeploymentHealthCheck{}).Error; err != nil {
+		log.Printf("[Deployment] Warning: Failed to delete health history for %s: %v", deployment.ID, err)
+	}
+	if err := s.db.Where("deployment_id = ?", deployment.ID).Delete(&models.RemediationPolicy{}).Error; err != nil {
+		log.Printf("[Deployment] Warning: Failed to delete remediation policy for %s: %v", deployment.ID, err)
+	}
+	if s.events != nil {
+		if err := s.events.DeleteForDeployment(deployment.ID); err != nil {
+			log.Printf("[Deployment] Warning: Failed to delete event history for %s: %v", deployment.ID, err)
+		}
+	}
+	if err := s.certificates.RemoveForDeployment(deployment.ID); err != nil {
+		log.Printf("[Deployment] Warning: Failed to delete certificate for %s: %v", deployment.ID, err)
+	}
+	s.mdns.Withdraw(deployment.ID)
+	for _, result := range s.dns.RemoveDeployment(deployment.ID) {
+		for _, msg := range result.Errors {
+			log.Printf("[Deployment] Warning: DNS on %s for %s: %s", result.Provider, deployment.ID, msg)
+		}
+	}
+	s.releasePorts(deployment)
+	s.releaseDependencies(context.Background(), deployment)
+
 	return nil
 }
 
@@ -424,33 +615,43 @@ func (s *DeploymentService) CancelDeployment(id string) error {
 		return fmt.Errorf("deployment not found: %w", err)
 	}
 
-	// Check if deployment is in a cancellable state
-	// Only deployments that are still in progress can be cancelled
-	cancellableStatuses := map[models.DeploymentStatus]bool{
-		models.DeploymentStatusValidating:  true,
-		models.DeploymentStatusPreparing:   true,
-		models.DeploymentStatusDeploying:   true,
-		models.DeploymentStatusConfiguring: true,
-		models.DeploymentStatusHealthCheck: true,
-	}
-
-	if !cancellableStatuses[deployment.Status] {
-		return fmt.Errorf("deployment cannot be cancelled (current status: %s)", deployment.Status)
+	// Whatever the deployment's status, its queued or running job can be cancelled; upgrades, configuration
+	// changes and migrations wait in the queue while the app keeps running
+	// A running job stops at its next cancellation check
+	job, wasRunning, err := s.jobQueue.Cancel(deployment.ID)
+	if err != nil {
+		if errors.Is(err, ErrJobNotActive) {
+			// Deployment may have already completed or been cancelled
+			return fmt.Errorf("deployment is not active (may have already completed)")
+		}
+		return fmt.Errorf("failed to cancel deployment: %w", err)
+	}
+	log.Printf("[Deployment] Cancelling deployment %s", id)
+
+	// A job that never started has no runner to record the cancellation
+	if !wasRunning {
+		switch job.Type {
+		case models.DeploymentJobDeploy, models.DeploymentJobAdopt:
+			s.appendLog(deployment, "Deployment cancelled before starting")
+			s.updateStatus(deployment, models.DeploymentStatusFailed, "Deployment was cancelled")
+			if job.Type == models.DeploymentJobDeploy {
+				s.releasePorts(deployment)
+			}
+		default:
+			// The deployment was not changed yet
+			s.appendLog(deployment, fmt.Sprintf("Queued %s cancelled", jobTypeLabel(job.Type)))
+		}
 	}
 
-	// Look up the cancel function for this deployment
-	cancelFunc, exists := s.cancelFuncs.Load(id)
-	if !exists {
-		// Deployment may have already completed or been cancelled
-		return fmt.Errorf("deployment is not active (may have already completed)")
-	}
+	return nil
+}
 
-	// Call the cancel function to stop the deployment goroutine
-	if cancel, ok := cancelFunc.(context.CancelFunc); ok {
-		log.Printf("[Deployment] Cancelling deployment %s", id)
-		cancel()
+// requireComposeProject rejects operations that drive a deployment with docker compose on its device
+// Swarm stacks are scheduled by Swarm and only removed by the platform
+func requireComposeProject(deployment *models.Deployment) error {
+	if deployment.IsSwarmStack() {
+		return fmt.Errorf("%s runs as a Docker Swarm stack and is managed by Swarm", deploymentNodeName(deployment))
 	}
-
 	return nil
 }
 
@@ -462,9 +663,12 @@ func (s *DeploymentService) RestartDeployment(id string) error {
 	}
 
 	// Check if deployment can be restarted
-	if deployment.Status != models.DeploymentStatusRunning && deployment.Status != models.DeploymentStatusStopped {
+	if deployment.Status != models.DeploymentStatusRunning && deployment.Status != models.DeploymentStatusStopped && deployment.Status != models.DeploymentStatusUnhealthy {
 		return fmt.Errorf("deployment cannot be restarted (current status: %s)", deployment.Status)
 	}
+	if err := requireComposeProject(deployment); err != nil {
+		return err
+	}
 
 	// Get device for SSH
 	device, err := s.deviceService.GetDevice(deployment.DeviceID)
@@ -481,7 +685,7 @@ func (s *DeploymentService) RestartDeployment(id string) error {
 		// If stopped, use 'start' instead of 'restart'
 		restartCmd = fmt.Sprintf("cd %s && docker compose -p %s start", deployDir, deployment.ComposeProject)
 	} else {
-		// If running, use 'restart'
+		// If running (or unhealthy), use 'restart'
 		restartCmd = fmt.Sprintf("cd %s && docker compose -p %s restart", deployDir, deployment.ComposeProject)
 	}
 
@@ -492,7 +696,8 @@ func (s *DeploymentService) RestartDeployment(id string) error {
 
 	log.Printf("[Deployment] Restarted %s on %s", deployment.ComposeProject, device.Name)
 
-	// Update status to running
+	// Update status to running; the health monitor re-evaluates from a clean slate
+	deployment.HealthFailures = 0
 	s.updateStatus(deployment, models.DeploymentStatusRunning, "")
 
 	return nil
@@ -506,9 +711,12 @@ func (s *DeploymentService) StopDeployment(id string) error {
 	}
 
 	// Check if deployment can be stopped
-	if deployment.Status != models.DeploymentStatusRunning {
+	if deployment.Status != models.DeploymentStatusRunning && deployment.Status != models.DeploymentStatusUnhealthy {
 		return fmt.Errorf("deployment cannot be stopped (current status: %s)", deployment.Status)
 	}
+	if err := requireComposeProject(deployment); err != nil {
+		return err
+	}
 
 	// Get device for SSH
 	device, err := s.deviceService.GetDevice(deployment.DeviceID)
@@ -545,6 +753,9 @@ func (s *DeploymentService) StartDeployment(id string) error {
 	if deployment.Status != models.DeploymentStatusStopped {
 		return fmt.Errorf("deployment cannot be started (current status: %s)", deployment.Status)
 	}
+	if err := requireComposeProject(deployment); err != nil {
+		return err
+	}
 
 	// Get device for SSH
 	device, err := s.deviceService.GetDevice(deployment.DeviceID)
@@ -570,6 +781,100 @@ func (s *DeploymentService) StartDeployment(id string) error {
 	return nil
 }
 
+// RedeployDeployment recreates a deployment's containers from its stored compose file
+// The .env written at deploy time is left in place, so secrets and database credentials are unchanged
+func (s *DeploymentService) RedeployDeployment(id string) error {
+	deployment, err := s.GetDeployment(id)
+	if err != nil {
+		return fmt.Errorf("deployment not found: %w", err)
+	}
+
+	redeployableStatuses := map[models.DeploymentStatus]bool{
+		models.DeploymentStatusRunning:   true,
+		models.DeploymentStatusUnhealthy: true,
+		models.DeploymentStatusStopped:   true,
+	}
+	if !redeployableStatuses[deployment.Status] {
+		return fmt.Errorf("deployment cannot be redeployed (current status: %s)", deployment.Status)
+	}
+	if err := requireComposeProject(deployment); err != nil {
+		return err
+	}
+	if deployment.GeneratedCompose == "" {
+		return fmt.Errorf("deployment has no stored compose file")
+	}
+	if !isValidStackName(deployment.ComposeProject) {
+		return fmt.Errorf("invalid compose project: %s", deployment.ComposeProject)
+	}
+
+	// Get device for SSH
+	device, err := s.deviceService.GetDevice(deployment.DeviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+
+	host := device.GetSSHHost()
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", deployment.ComposeProject)
+
+	s.appendLog(deployment, "Redeploying containers from stored compose file...")
+
+	writeCmd := fmt.Sprintf("mkdir -p %s && cat > %s/docker-compose.yml << 'EOF'\n%s\nEOF", deployDir, deployDir, deployment.GeneratedCompose)
+	if _, err := s.sshClient.ExecuteWithTimeout(host, writeCmd, 1*time.Minute); err != nil {
+		return fmt.Errorf("failed to write compose file: %w", err)
+	}
+
+	// --force-recreate replaces containers even when their configuration is unchanged
+	upCmd := fmt.Sprintf("cd %s && docker compose -p %s up -d --force-recreate --remove-orphans", deployDir, deployment.ComposeProject)
+	output, err := s.sshClient.ExecuteWithTimeout(host, upCmd, 15*time.Minute)
+	if err != nil {
+		return fmt.Errorf("failed to redeploy: %w (output: %s)", err, output)
+	}
+
+	log.Printf("[Deployment] Redeployed %s on %s", deployment.ComposeProject, device.Name)
+
+	// Update status to running; the health monitor re-evaluates from a clean slate
+	deployment.HealthFailures = 0
+	s.appendLog(deployment, "✓ Containers recreated")
+	s.updateStatus(deployment, models.DeploymentStatusRunning, "")
+
+	return nil
+}
+
+// IsBusy reports whether a job, backup or restore is queued or running for the deployment
+func (s *DeploymentService) IsBusy(id string) bool {
+	deploymentID, err := uuid.Parse(id)
+	if err != nil {
+		return false
+	}
+	if s.ensureNoActiveJob(deploymentID) != nil {
+		return true
+	}
+	return s.backupService != nil && s.backupService.IsBusy(deploymentID)
+}
+
+// FailDeployment marks a deployment as failed with the given reason
+func (s *DeploymentService) FailDeployment(id string, reason string) error {
+	deployment, err := s.GetDeployment(id)
+	if err != nil {
+		return fmt.Errorf("deployment not found: %w", err)
+	}
+
+	s.appendLog(deployment, fmt.Sprintf("❌ %s", reason))
+	s.updateStatus(deployment, models.DeploymentStatusFailed, reason)
+	return nil
+}
+
+// LogDeploymentEvent appends a message to a deployment's log
+// The deployment is re-read first so entries written by concurrent operations are kept
+func (s *DeploymentService) LogDeploymentEvent(id string, message string) {
+	deployment, err := s.GetDeployment(id)
+	if err != nil {
+		log.Printf("[Deployment] Failed to log event for %s: %v", id, err)
+		return
+	}
+	s.appendLog(deployment, message)
+}
+
 // GetAccessURLs generates access URLs for a deployment based on exposed ports
 func (s *DeploymentService) GetAccessURLs(id string) ([]map[string]interface{}, error) {
 	deployment, err := s.GetDeployment(id)
@@ -586,16 +891,16 @@ func (s *DeploymentService) GetAccessURLs(id string) ([]map[string]interface{},
 	// Extract ports from compose
 	portSpecs := ExtractPortsFromCompose(deployment.GeneratedCompose)
 
+	mdnsHost := ""
+	if s.mdns != nil && s.mdns.Enabled() && (deployment.Status == models.DeploymentStatusRunning || deployment.Status == models.DeploymentStatusUnhealthy) {
+		mdnsHost = s.mdns.HostLabel(device)
+	}
+
 	urls := []map[string]interface{}{}
 	for _, spec := range portSpecs {
 		// Only generate HTTP URLs for TCP ports
 		if spec.Protocol == "tcp" {
-			// Determine protocol (http vs https)
-			protocol := "http"
-			if spec.Port == 443 || spec.Port == 8443 {
-				protocol = "https"
-			}
-
+			protocol := accessURLScheme(spec.Port)
 			url := fmt.Sprintf("%s://%s:%d", protocol, device.GetPrimaryAddress(), spec.Port)
 
 			// Add description - only label ports we're absolutely certain about
@@ -614,19 +919,33 @@ func (s *DeploymentService) GetAccessURLs(id string) ([]map[string]interface{},
 				"protocol":    protocol,
 				"description": description,
 			})
+
+			// The same port under the device's .local name, answered by the mDNS advertiser
+			if mdnsHost != "" {
+				urls = append(urls, map[string]interface{}{
+					"url":         fmt.Sprintf("%s://%s.local:%d", protocol, mdnsHost, spec.Port),
+					"port":        spec.Port,
+					"protocol":    protocol,
+					"description": description + " (mDNS)",
+				})
+			}
 		}
 	}
 
 	return urls, nil
 }
 
-// executeDeployment performs the actual deployment steps
-func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *models.Deployment, recipe *models.Recipe, device *models.Device) {
-	// Clean up cancel function when deployment completes (success, failure, or cancellation)
-	defer func() {
-		s.cancelFuncs.Delete(deployment.ID.String())
-	}()
+// accessURLScheme guesses the scheme of a published port
+func accessURLScheme(port int) string {
+	if port == 443 || port == 8443 {
+		return "https"
+	}
+	return "http"
+}
 
+// executeDeployment performs the actual deployment steps
+// Completed phases are recorded on the job, and phases a resumed job already completed are skipped
+func (s *DeploymentService) executeDeployment(ctx context.Context, job *models.DeploymentJob, deployment *models.Deployment, recipe *models.Recipe, device *models.Device, userConfig map[string]interface{}) {
 	// Check if already cancelled before starting
 	select {
 	case <-ctx.Done():
@@ -636,29 +955,21 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 	default:
 	}
 
-	// Acquire device lock to prevent concurrent deployments to the same device
-	deviceLock := s.acquireDeviceLock(device.ID)
-	defer s.releaseDeviceLock(device.ID)
-
-	deviceLock.Lock()
-	defer deviceLock.Unlock()
-
-	s.appendLog(deployment, fmt.Sprintf("Starting deployment of %s to device %s (%s)", recipe.Name, device.Name, device.GetPrimaryAddress()))
-	s.appendLog(deployment, fmt.Sprintf("Acquired deployment lock for device %s", device.Name))
+	// The job queue runs one job per device at a time, so no other deployment is touching this device
+	if job.Phase == "" {
+		s.appendLog(deployment, fmt.Sprintf("Starting deployment of %s to device %s (%s)", recipe.Name, device.Name, device.GetPrimaryAddress()))
+	} else {
+		s.appendLog(deployment, fmt.Sprintf("Resuming deployment of %s on device %s after phase: %s", recipe.Name, device.Name, job.Phase))
+	}
 
 	// Update status to preparing
 	s.updateStatus(deployment, models.DeploymentStatusPreparing, "")
 
-	// Parse user config from deployment
-	var userConfig map[string]interface{}
-	if err := json.Unmarshal(deployment.Config, &userConfig); err != nil {
-		s.appendLog(deployment, fmt.Sprintf("❌ Failed to parse config: %v", err))
-		s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Failed to parse config: %v", err))
-		return
-	}
-
 	// DEPENDENCY AUTO-PROVISIONING: Check and provision dependencies
-	if len(recipe.Dependencies.Required) > 0 || len(recipe.Dependencies.Recommended) > 0 {
+	if deployPhaseDone(job, deployPhaseDependencies) {
+		s.appendLog(deployment, "✓ Dependencies already provisioned")
+	} else if len(recipe.Dependencies.Required) > 0 || len(recipe.Dependencies.Recommended) > 0 {
+		s.beginStep(deployment, "dependencies")
 		s.appendLog(deployment, "Checking dependencies...")
 		depResult, err := s.dependencyService.CheckDependencies(ctx, recipe, device.ID)
 		if err != nil {
@@ -678,7 +989,7 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 			}
 
 			// Provision dependencies
-			if err := s.dependencyService.ProvisionDependencies(ctx, depResult, device.ID, recipe, progressCallback); err != nil {
+			if err := s.dependencyService.ProvisionDependencies(ctx, depResult, device.ID, deployment.ID, recipe, progressCallback); err != nil {
 				s.appendLog(deployment, fmt.Sprintf("❌ Failed to provision dependencies: %v", err))
 				s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Failed to provision dependencies: %v", err))
 				return
@@ -694,10 +1005,22 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 			s.appendLog(deployment, fmt.Sprintf("⚠️  %s", warning))
 		}
 	}
+	s.jobQueue.SetPhase(job, deployPhaseDependencies)
 
 	// INTELLIGENT ORCHESTRATION: Database Provisioning
 	var provisionedDB *models.ProvisionedDatabase
-	if recipe.Database.AutoProvision && recipe.Database.Engine != "none" && recipe.Database.Engine != "" {
+	needsDatabase := recipe.Database.AutoProvision && recipe.Database.Engine != "none" && recipe.Database.Engine != ""
+	if needsDatabase && deployPhaseDone(job, deployPhaseDatabase) {
+		db, err := s.dbPoolManager.GetProvisionedDatabase(deployment.ID)
+		if err != nil {
+			s.appendLog(deployment, fmt.Sprintf("❌ Failed to load provisioned database: %v", err))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Failed to load provisioned database: %v", err))
+			return
+		}
+		provisionedDB = db
+		s.appendLog(deployment, fmt.Sprintf("✓ Database already provisioned: %s", provisionedDB.DatabaseName))
+	} else if needsDatabase {
+		s.beginStep(deployment, "database")
 		s.appendLog(deployment, fmt.Sprintf("Provisioning %s database using intelligent pooling...", recipe.Database.Engine))
 
 		db, err := s.dbPoolManager.ProvisionDatabase(deployment, device, recipe.Database)
@@ -710,8 +1033,13 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 		s.appendLog(deployment, fmt.Sprintf("✓ Database provisioned: %s", provisionedDB.DatabaseName))
 		s.appendLog(deployment, fmt.Sprintf("  Using shared %s instance (saving ~%dMB RAM)", recipe.Database.Engine, 200))
 	}
+	s.jobQueue.SetPhase(job, deployPhaseDatabase)
+
+	// Record the shared infrastructure and stacks this deployment now depends on
+	s.recordDependencies(ctx, deployment)
 
 	// Build environment variables (replaces template rendering)
+	s.beginStep(deployment, "environment")
 	s.appendLog(deployment, "Building environment variables...")
 	envMap, envFileContent, err := s.environmentBuilder.BuildEnvironment(
 		deployment,
@@ -725,10 +1053,28 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 		s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Failed to build environment: %v", err))
 		return
 	}
+
+	// Point the app at any dedicated databases/caches provisioned as dependencies
+	dedicatedEnv, err := s.dedicatedInstances.GetConnectionEnvVars(deployment.ID, recipe.Database.EnvPrefix)
+	if err != nil {
+		s.appendLog(deployment, fmt.Sprintf("❌ Failed to load dedicated instance credentials: %v", err))
+		s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Failed to build environment: %v", err))
+		return
+	}
+	if len(dedicatedEnv) > 0 {
+		for k, v := range dedicatedEnv {
+			envMap[k] = v
+		}
+		envFileContent = mergeEnvFile(envFileContent, dedicatedEnv)
+	}
 	s.appendLog(deployment, fmt.Sprintf("✓ Environment variables built (%d vars)", len(envMap)))
 
 	// Get docker-compose content (standard format with ${VAR} substitution via .env file)
 	composeContent := recipe.ComposeContent
+	var pendingRoute *pendingProxyRoute
+	if deployment.Domain != "" {
+		composeContent, pendingRoute = s.routeDomain(deployment, device, composeContent, envMap)
+	}
 	s.appendLog(deployment, "✓ Docker Compose prepared")
 
 	// Check for cancellation after template rendering
@@ -749,87 +1095,134 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 	deployment.Config, _ = json.Marshal(sanitizedConfig)
 	s.db.Save(deployment)
 
-	// Ensure homelab-proxy network exists (required for Traefik and other proxy-based services)
-	s.appendLog(deployment, "Ensuring Docker networks are ready...")
-	if err := s.ensureProxyNetworkExists(device); err != nil {
-		s.appendLog(deployment, fmt.Sprintf("⚠️  Warning: Failed to ensure proxy network exists: %v", err))
-		// Don't fail deployment, just warn - the network might not be needed
+	if deployPhaseDone(job, deployPhaseContainers) {
+		s.appendLog(deployment, "✓ Containers already deployed")
 	} else {
-		s.appendLog(deployment, "✓ Docker network 'homelab-proxy' is ready")
-	}
+		s.beginStep(deployment, "containers")
 
-	// Extract ports from compose
-	portsToOpen := ExtractPortsFromCompose(composeContent)
-	if len(portsToOpen) > 0 {
-		// Format port list for logging
-		portList := formatPortSpecs(portsToOpen)
-		s.appendLog(deployment, fmt.Sprintf("Detected ports to expose: %s", portList))
-
-		// Check firewall status
-		s.appendLog(deployment, "Checking firewall configuration...")
-		firewallStatus, err := s.firewallService.CheckFirewall(device)
-		if err != nil {
-			s.appendLog(deployment, fmt.Sprintf("⚠️  Could not check firewall: %v", err))
-		} else if firewallStatus.Installed && firewallStatus.Enabled {
-			s.appendLog(deployment, fmt.Sprintf("Firewall detected: %s (active)", firewallStatus.Type))
-			s.appendLog(deployment, "Opening required ports on firewall...")
-
-			if err := s.firewallService.OpenPorts(device, portsToOpen); err != nil {
-				s.appendLog(deployment, fmt.Sprintf("⚠️  Warning: Failed to open firewall ports: %v", err))
-				s.appendLog(deployment, "You may need to manually open ports. See post-deployment instructions.")
-			} else {
-				s.appendLog(deployment, "✓ Firewall ports opened successfully")
-			}
+		// Ensure homelab-proxy network exists (required for Traefik and other proxy-based services)
+		s.appendLog(deployment, "Ensuring Docker networks are ready...")
+		if err := s.ensureProxyNetworkExists(device); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Warning: Failed to ensure proxy network exists: %v", err))
+			// Don't fail deployment, just warn - the network might not be needed
 		} else {
-			s.appendLog(deployment, "ℹ️  No active firewall detected - ports should be accessible")
+			s.appendLog(deployment, "✓ Docker network 'homelab-proxy' is ready")
 		}
-	}
-
-	// Update status to deploying
-	s.updateStatus(deployment, models.DeploymentStatusDeploying, "")
 
-	// Deploy to device (with env file)
-	s.appendLog(deployment, fmt.Sprintf("Deploying containers (project: %s)...", deployment.ComposeProject))
-	if err := s.deployToDeviceWithEnv(device, deployment.ComposeProject, composeContent, envFileContent); err != nil {
-		s.appendLog(deployment, fmt.Sprintf("❌ Deployment failed: %v", err))
-		s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Deployment failed: %v", err))
-		// Attempt cleanup of partial deployment
-		s.appendLog(deployment, "Attempting cleanup of failed deployment...")
-		s.cleanupFailedDeployment(device, deployment.ComposeProject)
-		return
-	}
-	s.appendLog(deployment, "✓ Containers deployed successfully")
+		// Ports come from the compose file with the environment substituted, e.g. "${PORT}:80"
+		portsToOpen := ExtractPortsFromCompose(interpolateComposeVars(composeContent, envMap))
+		if err := s.ports.AllocateDeploymentPorts(device, deployment.ID, portsToOpen); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("❌ %v", err))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Port allocation failed: %v", err))
+			return
+		}
+		if len(portsToOpen) > 0 {
+			// Format port list for logging
+			portList := formatPortSpecs(portsToOpen)
+			s.appendLog(deployment, fmt.Sprintf("Detected ports to expose: %s", portList))
+
+			// Check firewall status
+			s.appendLog(deployment, "Checking firewall configuration...")
+			firewallStatus, err := s.firewallService.CheckFirewall(device)
+			if err != nil {
+				s.appendLog(deployment, fmt.Sprintf("⚠️  Could not check firewall: %v", err))
+			} else if firewallStatus.Installed && firewallStatus.Enabled {
+				s.appendLog(deployment, fmt.Sprintf("Firewall detected: %s (active)", firewallStatus.Type))
+				s.appendLog(deployment, "Opening required ports on firewall...")
+
+				if err := s.firewallService.OpenPorts(device, portsToOpen); err != nil {
+					s.appendLog(deployment, fmt.Sprintf("⚠️  Warning: Failed to open firewall ports: %v", err))
+					s.appendLog(deployment, "You may need to manually open ports. See post-deployment instructions.")
+				} else {
+					s.appendLog(deployment, "✓ Firewall ports opened successfully")
+				}
+			} else {
+				s.appendLog(deployment, "ℹ️  No active firewall detected - ports should be accessible")
+			}
+		}
 
-	// Check for cancellation after deployment
-	select {
-	case <-ctx.Done():
-		s.appendLog(deployment, "Deployment cancelled during deployment phase")
-		s.updateStatus(deployment, models.DeploymentStatusFailed, "Deployment was cancelled")
-		// Attempt cleanup of partial deployment
-		s.appendLog(deployment, "Attempting cleanup of cancelled deployment...")
-		s.cleanupFailedDeployment(device, deployment.ComposeProject)
-		return
-	default:
+		// Update status to deploying
+		s.updateStatus(deployment, models.DeploymentStatusDeploying, "")
+
+		// Deploy to device (with env file)
+		s.appendLog(deployment, fmt.Sprintf("Deploying containers (project: %s)...", deployment.ComposeProject))
+		if err := s.deployToDeviceWithEnv(device, deployment.ComposeProject, composeContent, envFileContent); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("❌ Deployment failed: %v", err))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Deployment failed: %v", err))
+			// Attempt cleanup of partial deployment
+			s.appendLog(deployment, "Attempting cleanup of failed deployment...")
+			s.cleanupFailedDeployment(device, deployment.ComposeProject)
+			return
+		}
+		s.appendLog(deployment, "✓ Containers deployed successfully")
+
+		// Check for cancellation after deployment
+		select {
+		case <-ctx.Done():
+			s.appendLog(deployment, "Deployment cancelled during deployment phase")
+			s.updateStatus(deployment, models.DeploymentStatusFailed, "Deployment was cancelled")
+			// Attempt cleanup of partial deployment
+			s.appendLog(deployment, "Attempting cleanup of cancelled deployment...")
+			s.cleanupFailedDeployment(device, deployment.ComposeProject)
+			return
+		default:
+		}
+		s.jobQueue.SetPhase(job, deployPhaseContainers)
 	}
 
-	// Update status to health check
-	s.updateStatus(deployment, models.DeploymentStatusHealthCheck, "")
-
-	// Wait a bit for containers to start
-	s.appendLog(deployment, "Waiting 5 seconds for containers to initialize...")
-	time.Sleep(5 * time.Second)
-
-	// Check health
-	s.appendLog(deployment, "Running health checks...")
-	if err := s.checkDeploymentHealth(device, deployment, recipe); err != nil {
-		s.appendLog(deployment, fmt.Sprintf("❌ Health check failed: %v", err))
-		s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Health check failed: %v", err))
-		// Attempt cleanup of failed deployment
-		s.appendLog(deployment, "Attempting cleanup of failed deployment...")
-		s.cleanupFailedDeployment(device, deployment.ComposeProject)
-		return
+	if deployPhaseDone(job, deployPhaseHealthCheck) {
+		s.appendLog(deployment, "✓ Health checks already passed")
+	} else {
+		// Update status to health check
+		s.updateStatus(deployment, models.DeploymentStatusHealthCheck, "")
+		s.beginStep(deployment, "health_check")
+
+		// Wait a bit for containers to start
+		s.appendLog(deployment, "Waiting 5 seconds for containers to initialize...")
+		time.Sleep(5 * time.Second)
+
+		// Check health
+		s.appendLog(deployment, "Running health checks...")
+		if err := s.checkDeploymentHealth(device, deployment, recipe); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("❌ Health check failed: %v", err))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Health check failed: %v", err))
+			// Attempt cleanup of failed deployment
+			s.appendLog(deployment, "Attempting cleanup of failed deployment...")
+			s.cleanupFailedDeployment(device, deployment.ComposeProject)
+			return
+		}
+		s.appendLog(deployment, "✓ Health checks passed")
+		s.jobQueue.SetPhase(job, deployPhaseHealthCheck)
+	}
+
+	// Proxies configured outside the compose file get the route once the app is up,
+	// after the certificate the route may refer to
+	if deployment.Domain != "" && deployment.CertResolver == homelabCAResolver {
+		s.secureDomain(deployment)
+	}
+	if pendingRoute != nil {
+		s.publishRoute(deployment, device, pendingRoute)
+	}
+	s.registerDNS(deployment)
+
+	// Run recipe post-install steps (first-run commands, webhooks, messages)
+	// They are not idempotent, so a resumed job does not run them a second time
+	if len(recipe.PostInstall) > 0 && deployPhaseDone(job, deployPhasePostInstall) {
+		s.appendLog(deployment, "✓ Post-install steps already completed")
+	} else if len(recipe.PostInstall) > 0 {
+		s.updateStatus(deployment, models.DeploymentStatusConfiguring, "")
+		s.beginStep(deployment, "post_install")
+		if err := s.runPostInstall(ctx, deployment, recipe, device, envMap); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("❌ Post-install failed: %v", err))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("Post-install failed: %v", err))
+			// Attempt cleanup of failed deployment
+			s.appendLog(deployment, "Attempting cleanup of failed deployment...")
+			s.cleanupFailedDeployment(device, deployment.ComposeProject)
+			return
+		}
+		s.appendLog(deployment, "✓ Post-install steps completed")
+		s.jobQueue.SetPhase(job, deployPhasePostInstall)
 	}
-	s.appendLog(deployment, "✓ Health checks passed")
 
 	// Update to running
 	now := time.Now()
@@ -864,7 +1257,7 @@ func (s *DeploymentService) sanitizeConfig(config map[string]interface{}) map[st
 			sanitized[key] = value
 		} else {
 			// Replace sensitive values with placeholder
-			sanitized[key] = "[REDACTED]"
+			sanitized[key] = redactedConfigValue
 			log.Printf("[Deployment] Sanitized sensitive field: %s", key)
 		}
 	}
@@ -977,6 +1370,10 @@ func (s *DeploymentService) checkDeploymentHealth(device *models.Device, deploym
 			// Default to port 80 if not specified
 			port = 80
 		}
+		// The recipe names the port inside the container; probe the host port it is published on
+		if vars, err := deploymentComposeVars(deployment); err == nil {
+			port = publishedHostPort(deployment.GeneratedCompose, vars, port)
+		}
 
 		// Build health check URL
 		healthURL := fmt.Sprintf("http://%s:%d%s", device.GetPrimaryAddress(), port, recipe.HealthCheck.Path)
@@ -1048,6 +1445,9 @@ func (s *DeploymentService) appendLog(deployment *models.Deployment, message str
 
 	// Save logs to database
 	s.db.Model(deployment).Update("deployment_logs", deployment.DeploymentLogs)
+	if s.events != nil {
+		s.events.RecordLog(deployment, message)
+	}
 
 	// Broadcast log update via WebSocket
 	if s.wsHub != nil {
@@ -1058,11 +1458,25 @@ func (s *DeploymentService) appendLog(deployment *models.Deployment, message str
 	}
 }
 
+// beginStep starts timing a named deployment step for the event history
+func (s *DeploymentService) beginStep(deployment *models.Deployment, step string) {
+	if s.events != nil {
+		s.events.BeginStep(deployment, step)
+	}
+}
+
 // updateStatus updates the deployment status and broadcasts to WebSocket
 func (s *DeploymentService) updateStatus(deployment *models.Deployment, status models.DeploymentStatus, errorDetails string) {
+	previousStatus := deployment.Status
 	deployment.Status = status
 	deployment.ErrorDetails = errorDetails
 	s.db.Save(deployment)
+	if s.events != nil {
+		s.events.RecordStatusChange(deployment, previousStatus, errorDetails)
+	}
+	if s.mdns != nil {
+		s.mdns.Update(deployment)
+	}
 
 	// Also log the status change
 	s.appendLog(deployment, fmt.Sprintf("Status changed to: %s", status))
@@ -1084,20 +1498,6 @@ func (s *DeploymentService) generateProjectName(recipeSlug string) string {
 	return fmt.Sprintf("%s-%s", recipeSlug, shortID)
 }
 
-// acquireDeviceLock gets or creates a mutex for a specific device
-func (s *DeploymentService) acquireDeviceLock(deviceID uuid.UUID) *sync.Mutex {
-	// Get existing lock or create new one
-	lock, _ := s.deviceLocks.LoadOrStore(deviceID.String(), &sync.Mutex{})
-	return lock.(*sync.Mutex)
-}
-
-// releaseDeviceLock is called when deployment is complete (for future cleanup if needed)
-func (s *DeploymentService) releaseDeviceLock(deviceID uuid.UUID) {
-	// Currently a no-op, but reserved for potential cleanup logic
-	// We keep locks in memory for the lifetime of the service
-	// Could implement lock cleanup after X minutes of inactivity in the future
-}
-
 // TroubleshootDeployment provides detailed troubleshooting information for a deployment
 func (s *DeploymentService) TroubleshootDeployment(id string) (map[string]interface{}, error) {
 	// Get deployment
@@ -1164,6 +1564,8 @@ func (s *DeploymentService) TroubleshootDeployment(id string) (map[string]interf
 	} else {
 		troubleshoot["recent_logs"] = containerLogs
 	}
+	// Subscribe to this WebSocket channel to follow the logs live
+	troubleshoot["log_stream_channel"] = DeploymentLogChannelPrefix + deployment.ID.String()
 
 	// Check which ports are actually listening
 	listeningCmd := "ss -tuln | grep LISTEN"
@@ -1210,7 +1612,10 @@ func (s *DeploymentService) cleanupFirewallPorts(device *models.Device, deletedD
 	// Build map of ports in use by other deployments
 	portsInUse := make(map[string]bool) // key: "port/protocol"
 	for _, deployment := range otherDeployments {
-		otherPorts := ExtractPortsFromCompose(deployment.GeneratedCompose)
+		otherPorts, err := deploymentPorts(&deployment)
+		if err != nil {
+			otherPorts = ExtractPortsFromCompose(deployment.GeneratedCompose)
+		}
 		for _, spec := range otherPorts {
 			key := fmt.Sprintf("%d/%s", spec.Port, spec.Protocol)
 			portsInUse[key] = true
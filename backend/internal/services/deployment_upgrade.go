@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+// UpgradeDeploymentRequest represents a request to upgrade a deployment in place
+// The latest recipe compose file is applied on top of the deployment's existing .env,
+// so generated secrets and database credentials are preserved
+type UpgradeDeploymentRequest struct {
+	Environment map[string]string `json:"environment,omitempty"` // Overrides, e.g. {"VAULTWARDEN_VERSION": "1.32.0"}
+	SkipBackup  bool              `json:"skip_backup,omitempty"` // Upgrade without a snapshot even if the recipe asks for one
+}
+
+// upgradeState holds the configuration needed to roll an upgrade back
+type upgradeState struct {
+	previousCompose string
+	previousEnv     string
+	previousStatus  models.DeploymentStatus
+	snapshot        *models.BackupSnapshot
+	ports           []PortSpec // Every port the new compose file publishes
+	previousPorts   []PortSpec
+	portsOpened     []PortSpec
+	portsClosed     []PortSpec
+}
+
+// planPorts works out which host ports the upgrade starts and stops publishing
+func (state *upgradeState) planPorts(newCompose, newEnv string) {
+	state.ports = ExtractPortsFromCompose(interpolateComposeVars(newCompose, parseEnvFile(newEnv)))
+	state.previousPorts = ExtractPortsFromCompose(interpolateComposeVars(state.previousCompose, parseEnvFile(state.previousEnv)))
+	state.portsOpened = subtractPortSpecs(state.ports, state.previousPorts)
+	state.portsClosed = subtractPortSpecs(state.previousPorts, state.ports)
+}
+
+// UpgradeDeployment upgrades a deployment to the latest recipe compose file
+// Behaviour follows the recipe's update config: optional pre-update snapshot and rollback on failure
+func (s *DeploymentService) UpgradeDeployment(id string, req UpgradeDeploymentRequest) (*models.Deployment, error) {
+	deployment, err := s.GetDeployment(id)
+	if err != nil {
+		return nil, fmt.Errorf("deployment not found: %w", err)
+	}
+
+	upgradableStatuses := map[models.DeploymentStatus]bool{
+		models.DeploymentStatusRunning:    true,
+		models.DeploymentStatusStopped:    true,
+		models.DeploymentStatusRolledBack: true,
+		models.DeploymentStatusUnhealthy:  true,
+	}
+	if !upgradableStatuses[deployment.Status] {
+		return nil, fmt.Errorf("deployment cannot be upgraded (current status: %s)", deployment.Status)
+	}
+	if err := requireComposeProject(deployment); err != nil {
+		return nil, err
+	}
+
+	for key, value := range req.Environment {
+		if !isValidEnvVarName(key) {
+			return nil, fmt.Errorf("invalid environment variable name: %s", key)
+		}
+		if !isValidEnvVarValue(value) {
+			return nil, fmt.Errorf("invalid value for environment variable %s", key)
+		}
+	}
+
+	recipe, err := s.recipeFor(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("recipe not found: %w", err)
+	}
+
+	if recipe.Updates.BackupBeforeUpdate && !req.SkipBackup && s.backupService == nil {
+		return nil, fmt.Errorf("recipe requires a backup before updating but backups are not configured (set skip_backup to override)")
+	}
+
+	if _, err := s.deviceService.GetDevice(deployment.DeviceID); err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	if err := s.ensureNoActiveJob(deployment.ID); err != nil {
+		return nil, err
+	}
+
+	job := &models.DeploymentJob{
+		DeploymentID: deployment.ID,
+		Type:         models.DeploymentJobUpgrade,
+		DeviceID:     deployment.DeviceID,
+	}
+	if err := s.jobQueue.Enqueue(job, req); err != nil {
+		return nil, err
+	}
+
+	return deployment, nil
+}
+
+// executeUpgrade performs the upgrade steps and rolls back on failure when the recipe allows it
+func (s *DeploymentService) executeUpgrade(ctx context.Context, deployment *models.Deployment, recipe *models.Recipe, device *models.Device, req UpgradeDeploymentRequest) {
+	host := device.GetSSHHost()
+	project := deployment.ComposeProject
+	deployDir := fmt.Sprintf("~/homelab-deployments/%s", project)
+
+	state := &upgradeState{previousStatus: deployment.Status}
+	deployment.RollbackLog = nil
+
+	s.appendLog(deployment, fmt.Sprintf("Starting upgrade of %s (update strategy: %s)", recipe.Name, recipe.Updates.Strategy))
+	s.updateStatus(deployment, models.DeploymentStatusPreparing, "")
+
+	// Capture the running configuration so it can be restored
+	previousCompose, err := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("cat %s/docker-compose.yml", deployDir), 30*time.Second)
+	if err != nil {
+		s.failUpgrade(deployment, state, fmt.Sprintf("Failed to read current compose file: %v", err))
+		return
+	}
+	previousEnv, _ := s.sshClient.ExecuteWithTimeout(host, fmt.Sprintf("cat %s/.env 2>/dev/null || true", deployDir), 30*time.Second)
+	state.previousCompose = strings.TrimRight(previousCompose, "\n")
+	state.previousEnv = strings.TrimRight(previousEnv, "\n")
+
+	newEnv := mergeEnvFile(state.previousEnv, req.Environment)
+	newCompose, pendingRoute := s.upgradeCompose(deployment, recipe, device, state.previousCompose, newEnv)
+
+	// A new version can publish different ports; fail early if one is taken
+	state.planPorts(newCompose, newEnv)
+	if len(state.portsOpened) > 0 {
+		if err := s.ports.CheckPorts(device, deployment.ID, state.portsOpened); err != nil {
+			s.failUpgrade(deployment, state, err.Error())
+			return
+		}
+	}
+
+	// Pull new images before touching the running containers to keep downtime short
+	s.appendLog(deployment, "Pulling updated images...")
+	stageCmd := fmt.Sprintf("cd %s && cat > docker-compose.upgrade.yml << 'EOF'\n%s\nEOF", deployDir, newCompose)
+	if _, err := s.sshClient.ExecuteWithTimeout(host, stageCmd, 1*time.Minute); err != nil {
+		s.failUpgrade(deployment, state, fmt.Sprintf("Failed to stage new compose file: %v", err))
+		return
+	}
+	if newEnv != "" {
+		stageEnvCmd := fmt.Sprintf("cd %s && cat > .env.upgrade << 'EOF'\n%s\nEOF", deployDir, newEnv)
+		if _, err := s.sshClient.ExecuteWithTimeout(host, stageEnvCmd, 1*time.Minute); err != nil {
+			s.failUpgrade(deployment, state, fmt.Sprintf("Failed to stage new environment file: %v", err))
+			return
+		}
+	}
+	pullCmd := fmt.Sprintf("cd %s && docker compose -p %s -f docker-compose.upgrade.yml --env-file .env.upgrade pull; status=$?; rm -f docker-compose.upgrade.yml .env.upgrade; exit $status", deployDir, project)
+	if newEnv == "" {
+		pullCmd = fmt.Sprintf("cd %s && docker compose -p %s -f docker-compose.upgrade.yml pull; status=$?; rm -f docker-compose.upgrade.yml; exit $status", deployDir, project)
+	}
+	if output, err := s.sshClient.ExecuteWithTimeout(host, pullCmd, 30*time.Minute); err != nil {
+		s.failUpgrade(deployment, state, fmt.Sprintf("Failed to pull images: %v (output: %s)", err, output))
+		return
+	}
+	s.appendLog(deployment, "✓ Images pulled")
+
+	if ctx.Err() != nil {
+		s.failUpgrade(deployment, state, "Upgrade was cancelled")
+		return
+	}
+
+	// Snapshot volumes before the new version can migrate data
+	if recipe.Updates.BackupBeforeUpdate && !req.SkipBackup {
+		s.appendLog(deployment, "Creating pre-upgrade backup...")
+		snapshot, err := s.backupService.CreateSnapshot(deployment.ID, CreateBackupRequest{}, models.SnapshotTriggerUpgrade)
+		if err != nil {
+			s.failUpgrade(deployment, state, fmt.Sprintf("Pre-upgrade backup failed: %v", err))
+			return
+		}
+		state.snapshot = snapshot
+		s.appendLog(deployment, fmt.Sprintf("✓ Backup created (snapshot %s, %d bytes)", snapshot.ID, snapshot.SizeBytes))
+	} else if req.SkipBackup {
+		s.appendLog(deployment, "⚠️  Skipping pre-upgrade backup as requested")
+	}
+
+	// The running containers are untouched, so a port taken since the check just aborts the upgrade
+	if err := s.ports.AllocateDeploymentPorts(device, deployment.ID, state.ports); err != nil {
+		s.failUpgrade(deployment, state, fmt.Sprintf("Port allocation failed: %v", err))
+		return
+	}
+
+	// Redeploy with the new compose file and merged environment
+	s.updateStatus(deployment, models.DeploymentStatusDeploying, "")
+	if len(state.portsOpened) > 0 {
+		s.openFirewallPorts(deployment, device, state.ports)
+	}
+	s.appendLog(deployment, "Redeploying containers...")
+	if err := s.deployToDeviceWithEnv(device, project, newCompose, newEnv); err != nil {
+		s.handleUpgradeFailure(deployment, recipe, device, state, fmt.Sprintf("Redeploy failed: %v", err))
+		return
+	}
+	s.appendLog(deployment, "✓ Containers redeployed")
+
+	s.updateStatus(deployment, models.DeploymentStatusHealthCheck, "")
+	s.appendLog(deployment, "Waiting 5 seconds for containers to initialize...")
+	time.Sleep(5 * time.Second)
+
+	if err := s.checkDeploymentHealth(device, deployment, recipe); err != nil {
+		s.handleUpgradeFailure(deployment, recipe, device, state, fmt.Sprintf("Health check failed after upgrade: %v", err))
+		return
+	}
+	s.appendLog(deployment, "✓ Health checks passed")
+
+	if pendingRoute != nil {
+		s.publishRoute(deployment, device, pendingRoute)
+	}
+	if len(state.portsClosed) > 0 {
+		if err := s.cleanupFirewallPorts(device, deployment.ID, state.portsClosed); err != nil {
+			s.appendLog(deployment, fmt.Sprintf("⚠️  Warning: Failed to close unused firewall ports: %v", err))
+		} else {
+			s.appendLog(deployment, fmt.Sprintf("✓ Firewall ports no longer used: %s", formatPortSpecs(state.portsClosed)))
+		}
+	}
+
+	now := time.Now()
+	deployment.GeneratedCompose = newCompose
+	deployment.DeployedAt = &now
+	deployment.UpdateAvailable = false
+	s.appendLog(deployment, "🎉 Upgrade completed successfully!")
+	s.updateStatus(deployment, models.DeploymentStatusRunning, "")
+}
+
+// upgradeCompose returns the compose file an upgrade deploys
+// The recipe's compose file is routed like on a fresh deployment, so the domain survives the upgrade;
+// adopted and custom apps keep their own compose file, and upgrading pulls newer images for it
+func (s *DeploymentService) upgradeCompose(deployment *models.Deployment, recipe *models.Recipe, device *models.Device, previousCompose string, env string) (string, *pendingProxyRoute) {
+	if deployment.IsAdopted() || deployment.IsCustom() {
+		return previousCompose, nil
+	}
+	if deployment.Domain == "" {
+		return recipe.ComposeContent, nil
+	}
+	return s.routeDomain(deployment, device, recipe.ComposeContent, parseEnvFile(env))
+}
+
+// handleUpgradeFailure rolls back if the recipe allows it, otherwise marks the deployment failed
+func (s *DeploymentService) handleUpgradeFailure(deployment *models.Deployment, recipe *models.Recipe, device *models.Device, state *upgradeState, reason string) {
+	s.appendLog(deployment, fmt.Sprintf("❌ %s", reason))
+
+	if !recipe.Updates.RollbackOnFailure {
+		s.updateStatus(deployment, models.DeploymentStatusFailed, reason)
+		return
+	}
+
+	s.rollbackUpgrade(deployment, recipe, device, state, reason)
+}
+
+// rollbackUpgrade restores the previous compose file, environment and volumes
+// Each step is recorded in the deployment's RollbackLog
+func (s *DeploymentService) rollbackUpgrade(deployment *models.Deployment, recipe *models.Recipe, device *models.Device, state *upgradeState, reason string) {
+	s.updateStatus(deployment, models.DeploymentStatusRollingBack, reason)
+	s.appendLog(deployment, "Rolling back to previous version...")
+
+	// Restore volumes first so the old version never sees data migrated by the new one
+	if state.snapshot != nil {
+		err := s.backupService.RestoreSnapshot(deployment.ID, state.snapshot.ID, RestoreBackupRequest{})
+		s.recordRollbackStep(deployment, "restore_volumes", err, fmt.Sprintf("snapshot %s", state.snapshot.ID))
+		if err != nil {
+			s.appendLog(deployment, fmt.Sprintf("❌ Failed to restore volumes: %v", err))
+			s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("%s; rollback failed restoring volumes: %v", reason, err))
+			return
+		}
+		s.appendLog(deployment, "✓ Volumes restored from pre-upgrade backup")
+	} else {
+		s.recordRollbackStep(deployment, "restore_volumes", nil, "skipped - no pre-upgrade backup")
+	}
+
+	if err := s.deployToDeviceWithEnv(device, deployment.ComposeProject, state.previousCompose, state.previousEnv); err != nil {
+		s.recordRollbackStep(deployment, "restore_compose", err, "")
+		s.appendLog(deployment, fmt.Sprintf("❌ Failed to redeploy previous version: %v", err))
+		s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("%s; rollback failed: %v", reason, err))
+		return
+	}
+	s.recordRollbackStep(deployment, "restore_compose", nil, "previous compose file and environment redeployed")
+	if err := s.ports.RecordDeploymentPorts(device, deployment.ID, state.previousPorts); err != nil {
+		log.Printf("[Deployment] Warning: Failed to restore port allocation of %s: %v", deployment.ComposeProject, err)
+	}
+	if len(state.portsOpened) > 0 {
+		err := s.cleanupFirewallPorts(device, deployment.ID, state.portsOpened)
+		s.recordRollbackStep(deployment, "close_ports", err, formatPortSpecs(state.portsOpened))
+	}
+
+	time.Sleep(5 * time.Second)
+	if err := s.checkDeploymentHealth(device, deployment, recipe); err != nil {
+		s.recordRollbackStep(deployment, "health_check", err, "")
+		s.appendLog(deployment, fmt.Sprintf("❌ Previous version is unhealthy after rollback: %v", err))
+		s.updateStatus(deployment, models.DeploymentStatusFailed, fmt.Sprintf("%s; rollback health check failed: %v", reason, err))
+		return
+	}
+	s.recordRollbackStep(deployment, "health_check", nil, "previous version is running")
+
+	// A stopped deployment is returned to the stopped state after rollback
+	if state.previousStatus == models.DeploymentStatusStopped {
+		stopCmd := fmt.Sprintf("cd ~/homelab-deployments/%s && docker compose -p %s stop", deployment.ComposeProject, deployment.ComposeProject)
+		_, err := s.sshClient.ExecuteWithTimeout(device.GetSSHHost(), stopCmd, 2*time.Minute)
+		s.recordRollbackStep(deployment, "stop", err, "restored stopped state")
+	}
+
+	s.appendLog(deployment, "↩️  Rolled back to previous version")
+	s.updateStatus(deployment, models.DeploymentStatusRolledBack, reason)
+}
+
+// failUpgrade aborts an upgrade before anything on the device was changed
+func (s *DeploymentService) failUpgrade(deployment *models.Deployment, state *upgradeState, reason string) {
+	s.appendLog(deployment, fmt.Sprintf("❌ %s", reason))
+	s.appendLog(deployment, "Upgrade aborted - the running version was not changed")
+	s.updateStatus(deployment, state.previousStatus, reason)
+}
+
+// recordRollbackStep appends a step to the deployment's RollbackLog
+func (s *DeploymentService) recordRollbackStep(deployment *models.Deployment, step string, err error, message string) {
+	var steps []models.RollbackStep
+	if len(deployment.RollbackLog) > 0 {
+		if jsonErr := json.Unmarshal(deployment.RollbackLog, &steps); jsonErr != nil {
+			log.Printf("[Deployment] Warning: discarding unreadable rollback log: %v", jsonErr)
+		}
+	}
+
+	entry := models.RollbackStep{
+		Timestamp: time.Now(),
+		Step:      step,
+		Success:   err == nil,
+		Message:   message,
+	}
+	if err != nil {
+		entry.Message = err.Error()
+	}
+	steps = append(steps, entry)
+
+	deployment.RollbackLog, _ = json.Marshal(steps)
+	s.db.Model(deployment).Update("rollback_log", deployment.RollbackLog)
+	log.Printf("[Deployment] Rollback step %s for %s (success: %v)", step, deployment.ComposeProject, entry.Success)
+}
+
+// mergeEnvFile applies overrides to .env content, replacing existing keys and appending new ones
+// Lines that are not overridden (comments, generated secrets) are preserved verbatim
+func mergeEnvFile(content string, overrides map[string]string) string {
+	if len(overrides) == 0 {
+		return content
+	}
+
+	applied := make(map[string]bool)
+	lines := []string{}
+	if content != "" {
+		lines = strings.Split(content, "\n")
+	}
+
+	for i, line := range lines {
+		key, _, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if value, ok := overrides[key]; ok {
+			lines[i] = fmt.Sprintf("%s=%s", key, escapeEnvValue(value))
+			applied[key] = true
+		}
+	}
+
+	// Append new keys in sorted order for deterministic output
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		if !applied[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, escapeEnvValue(overrides[key])))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeEnvFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		overrides map[string]string
+		expected  string
+	}{
+		{
+			name:     "no overrides keeps content verbatim",
+			content:  "# generated\nDB_PASSWORD=\"a b\"\nVERSION=1.0",
+			expected: "# generated\nDB_PASSWORD=\"a b\"\nVERSION=1.0",
+		},
+		{
+			name:      "replaces existing key",
+			content:   "DB_PASSWORD=secret\nVERSION=1.0",
+			overrides: map[string]string{"VERSION": "1.1"},
+			expected:  "DB_PASSWORD=secret\nVERSION=1.1",
+		},
+		{
+			name:      "appends new keys sorted",
+			content:   "VERSION=1.0",
+			overrides: map[string]string{"ZETA": "z", "ALPHA": "a"},
+			expected:  "VERSION=1.0\nALPHA=a\nZETA=z",
+		},
+		{
+			name:      "escapes override values",
+			content:   "",
+			overrides: map[string]string{"MOTD": "hello world"},
+			expected:  "MOTD=\"hello world\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mergeEnvFile(tt.content, tt.overrides))
+		})
+	}
+}
+
+func TestUpgradeDeployment_Validation(t *testing.T) {
+	db := setupTestDB(t)
+	credService, _ := NewCredentialService()
+	deviceService := NewDeviceService(db, credService, nil)
+	mockRecipeLoader := NewMockRecipeLoader(map[string]*models.Recipe{
+		"vaultwarden": {
+			Slug:    "vaultwarden",
+			Name:    "Vaultwarden",
+			Updates: models.RecipeUpdateConfig{Strategy: "notify", BackupBeforeUpdate: true, RollbackOnFailure: true},
+		},
+	})
+	deploymentService := NewDeploymentService(db, nil, mockRecipeLoader, deviceService, credService, nil, nil, nil)
+
+	device := models.Device{Name: "server", Type: models.DeviceTypeServer}
+	require.NoError(t, db.Create(&device).Error)
+
+	deployment := models.Deployment{RecipeSlug: "vaultwarden", DeviceID: device.ID, ComposeProject: "vaultwarden-abc123", Status: models.DeploymentStatusDeploying}
+	require.NoError(t, db.Create(&deployment).Error)
+
+	// In-progress deployments cannot be upgraded
+	_, err := deploymentService.UpgradeDeployment(deployment.ID.String(), UpgradeDeploymentRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be upgraded")
+
+	require.NoError(t, db.Model(&deployment).Update("status", models.DeploymentStatusRunning).Error)
+
+	// Invalid environment overrides are rejected before anything runs
+	_, err = deploymentService.UpgradeDeployment(deployment.ID.String(), UpgradeDeploymentRequest{
+		Environment: map[string]string{"BAD-NAME": "x"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid environment variable name")
+
+	// Recipe asks for a backup but no backup service is configured
+	_, err = deploymentService.UpgradeDeployment(deployment.ID.String(), UpgradeDeploymentRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "skip_backup")
+}
+
+func TestUpgradeCompose_KeepsDomainRouted(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	require.NoError(t, db.Create(&models.Deployment{RecipeSlug: traefikRecipe, ComposeProject: "traefik-abc123",
+		DeviceID: device.ID, Status: models.DeploymentStatusRunning}).Error)
+
+	recipe := &models.Recipe{Slug: "wiki-js", ComposeContent: "services:\n  wiki:\n    image: ghcr.io/requarks/wiki:2.5\n    ports:\n      - \"${WIKI_PORT}:3000\"\n"}
+	deployment := &models.Deployment{RecipeSlug: "wiki-js", ComposeProject: "wiki-js-1", Domain: "wiki.home.lan",
+		DeviceID: device.ID, Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(deployment).Error)
+
+	compose, pending := service.upgradeCompose(deployment, recipe, device, "previous", "WIKI_PORT=3000")
+	assert.Nil(t, pending, "Traefik reads the route from labels")
+	assert.Contains(t, compose, "traefik.http.routers.wiki-js-1.rule=Host(`wiki.home.lan`)")
+	assert.Contains(t, compose, "homelab-proxy")
+	assert.Contains(t, compose, "ghcr.io/requarks/wiki:2.5", "the new recipe version is deployed")
+
+	// Without a domain the recipe's compose file is used as it is
+	deployment.Domain = ""
+	compose, _ = service.upgradeCompose(deployment, recipe, device, "previous", "")
+	assert.Equal(t, recipe.ComposeContent, compose)
+
+	// Custom apps keep the file they run with, routing included
+	deployment.Domain = "wiki.home.lan"
+	deployment.Source = models.DeploymentSourceCustom
+	compose, _ = service.upgradeCompose(deployment, recipe, device, "previous", "")
+	assert.Equal(t, "previous", compose)
+}
+
+func TestUpgradeState_PlanPorts(t *testing.T) {
+	state := &upgradeState{
+		previousCompose: "services:\n  app:\n    ports:\n      - \"${WEB_PORT}:80\"\n      - \"8443:443\"\n",
+		previousEnv:     "WEB_PORT=8080",
+	}
+	compose := "services:\n  app:\n    ports:\n      - \"${WEB_PORT}:80\"\n      - \"3478:3478/udp\"\n"
+
+	state.planPorts(compose, "WEB_PORT=8080")
+	assert.Equal(t, []string{"8080/tcp", "3478/udp"}, portSpecStrings(state.ports))
+	assert.Equal(t, []string{"3478/udp"}, portSpecStrings(state.portsOpened))
+	assert.Equal(t, []string{"8443/tcp"}, portSpecStrings(state.portsClosed))
+
+	// An environment override moves a published port
+	state.planPorts(compose, "WEB_PORT=9090")
+	assert.Equal(t, []string{"9090/tcp", "3478/udp"}, portSpecStrings(state.portsOpened))
+	assert.Equal(t, []string{"8080/tcp", "8443/tcp"}, portSpecStrings(state.portsClosed))
+}
+
+func TestRecordRollbackStep(t *testing.T) {
+	db := setupTestDB(t)
+	deploymentService := &DeploymentService{db: db}
+
+	deployment := models.Deployment{RecipeSlug: "immich", ComposeProject: "immich-abc123"}
+	require.NoError(t, db.Create(&deployment).Error)
+
+	deploymentService.recordRollbackStep(&deployment, "restore_volumes", nil, "snapshot 123")
+	deploymentService.recordRollbackStep(&deployment, "restore_compose", errors.New("compose up failed"), "")
+
+	var reloaded models.Deployment
+	require.NoError(t, db.First(&reloaded, "id = ?", deployment.ID).Error)
+
+	var steps []models.RollbackStep
+	require.NoError(t, json.Unmarshal(reloaded.RollbackLog, &steps))
+	require.Len(t, steps, 2)
+
+	assert.Equal(t, "restore_volumes", steps[0].Step)
+	assert.True(t, steps[0].Success)
+	assert.Equal(t, "snapshot 123", steps[0].Message)
+
+	assert.Equal(t, "restore_compose", steps[1].Step)
+	assert.False(t, steps[1].Success)
+	assert.Equal(t, "compose up failed", steps[1].Message)
+}
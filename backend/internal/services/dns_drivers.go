@@ -0,0 +1,318 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+const (
+	defaultDNSHostsFile = "/etc/homelab.hosts"
+	dnsmasqConfFile     = "/etc/dnsmasq.d/homelab.conf"
+	dnsCommandTimeout   = 30 * time.Second
+)
+
+// DNSEntry is an A record on a DNS server
+type DNSEntry struct {
+	Domain string `json:"domain"`
+	IP     string `json:"ip"`
+}
+
+// DNSDriver manages A records on one kind of DNS server
+// Adding a record that exists or removing one that does not is not an error
+type DNSDriver interface {
+	ListRecords() ([]DNSEntry, error)
+	AddRecord(domain, ip string) error
+	RemoveRecord(domain, ip string) error
+}
+
+// newDNSDriver returns the driver for a provider, given its password
+func newDNSDriver(provider *models.DNSProvider, password string, device *models.Device, ssh sshExecutor, client *http.Client) (DNSDriver, error) {
+	switch provider.Type {
+	case models.DNSProviderDnsmasq:
+		if device == nil {
+			return nil, fmt.Errorf("dnsmasq provider %s has no device", provider.Name)
+		}
+		path := provider.HostsFile
+		if path == "" {
+			path = defaultDNSHostsFile
+		}
+		return &dnsmasqDriver{ssh: ssh, host: device.GetSSHHost(), path: path}, nil
+	case models.DNSProviderPihole:
+		return &piholeDriver{client: client, baseURL: strings.TrimRight(provider.URL, "/"), password: password}, nil
+	case models.DNSProviderAdGuard:
+		return &adguardDriver{client: client, baseURL: strings.TrimRight(provider.URL, "/"), username: provider.Username, password: password}, nil
+	}
+	return nil, fmt.Errorf("unknown DNS provider type %q", provider.Type)
+}
+
+// dnsmasqDriver keeps the records in a hosts file dnsmasq reads through addn-hosts
+// The file belongs to the platform and is rewritten as a whole; dnsmasq re-reads it on SIGHUP
+type dnsmasqDriver struct {
+	ssh  sshExecutor
+	host string
+	path string
+}
+
+func (d *dnsmasqDriver) ListRecords() ([]DNSEntry, error) {
+	output, err := d.ssh.ExecuteWithTimeout(d.host, fmt.Sprintf("cat %s 2>/dev/null; true", shellQuote(d.path)), dnsCommandTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w (output: %s)", d.path, err, output)
+	}
+	return parseHostsFile(output), nil
+}
+
+func (d *dnsmasqDriver) AddRecord(domain, ip string) error {
+	entries, err := d.ListRecords()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Domain == domain && entry.IP == ip {
+			return nil
+		}
+	}
+	return d.write(append(entries, DNSEntry{Domain: domain, IP: ip}))
+}
+
+func (d *dnsmasqDriver) RemoveRecord(domain, ip string) error {
+	entries, err := d.ListRecords()
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Domain != domain || entry.IP != ip {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(entries) {
+		return nil
+	}
+	return d.write(kept)
+}
+
+// write replaces the hosts file and reloads dnsmasq, pointing it at the file the first time
+func (d *dnsmasqDriver) write(entries []DNSEntry) error {
+	var b strings.Builder
+	b.WriteString("# Managed by the homelab orchestration platform, changes are overwritten\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "%s %s\n", entry.IP, entry.Domain)
+	}
+
+	path := shellQuote(d.path)
+	addnHosts := shellQuote("addn-hosts=" + d.path)
+	reload := fmt.Sprintf("if grep -qsx %[1]s %[2]s; then sudo pkill -HUP -x dnsmasq; else echo %[1]s | sudo tee %[2]s > /dev/null && sudo systemctl restart dnsmasq; fi",
+		addnHosts, dnsmasqConfFile)
+	command := fmt.Sprintf("sudo tee %s > /dev/null << 'EOF' && %s\n%sEOF", path, reload, b.String())
+	output, err := d.ssh.ExecuteWithTimeout(d.host, command, dnsCommandTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w (output: %s)", d.path, err, output)
+	}
+	return nil
+}
+
+// parseHostsFile reads the A records from a hosts file, one entry per name
+func parseHostsFile(content string) []DNSEntry {
+	var entries []DNSEntry
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || net.ParseIP(fields[0]).To4() == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			entries = append(entries, DNSEntry{Domain: strings.ToLower(name), IP: fields[0]})
+		}
+	}
+	return entries
+}
+
+// piholeDriver manages Pi-hole v6 local DNS records ("dns.hosts") through its REST API
+// Each call logs in and out again, as Pi-hole only keeps a few API sessions
+type piholeDriver struct {
+	client   *http.Client
+	baseURL  string
+	password string
+}
+
+func (d *piholeDriver) ListRecords() ([]DNSEntry, error) {
+	var result struct {
+		Config struct {
+			DNS struct {
+				Hosts []string `json:"hosts"`
+			} `json:"dns"`
+		} `json:"config"`
+	}
+	err := d.session(func(sid string) error {
+		return dnsRequest(d.client, d.request(http.MethodGet, "/api/config/dns/hosts", sid), &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseHostsFile(strings.Join(result.Config.DNS.Hosts, "\n")), nil
+}
+
+func (d *piholeDriver) AddRecord(domain, ip string) error {
+	return d.session(func(sid string) error {
+		err := dnsRequest(d.client, d.request(http.MethodPut, "/api/config/dns/hosts/"+url.PathEscape(ip+" "+domain), sid), nil)
+		// Pi-hole rejects adding an entry it already has
+		var status *dnsStatusError
+		if errors.As(err, &status) && status.Code == http.StatusBadRequest && strings.Contains(status.Body, "already present") {
+			return nil
+		}
+		return err
+	})
+}
+
+func (d *piholeDriver) RemoveRecord(domain, ip string) error {
+	return d.session(func(sid string) error {
+		err := dnsRequest(d.client, d.request(http.MethodDelete, "/api/config/dns/hosts/"+url.PathEscape(ip+" "+domain), sid), nil)
+		var status *dnsStatusError
+		if errors.As(err, &status) && status.Code == http.StatusNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// session logs in, runs fn with the session ID and logs out
+// Pi-hole without a password answers with an empty session ID, which is then not sent
+func (d *piholeDriver) session(fn func(sid string) error) error {
+	body, _ := json.Marshal(map[string]string{"password": d.password})
+	req, err := http.NewRequest(http.MethodPost, d.baseURL+"/api/auth", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var auth struct {
+		Session struct {
+			Valid bool   `json:"valid"`
+			SID   string `json:"sid"`
+		} `json:"session"`
+	}
+	if err := dnsRequest(d.client, req, &auth); err != nil {
+		return fmt.Errorf("failed to log in to Pi-hole: %w", err)
+	}
+	if !auth.Session.Valid {
+		return fmt.Errorf("failed to log in to Pi-hole: wrong password")
+	}
+	if auth.Session.SID != "" {
+		defer dnsRequest(d.client, d.request(http.MethodDelete, "/api/auth", auth.Session.SID), nil)
+	}
+	return fn(auth.Session.SID)
+}
+
+func (d *piholeDriver) request(method, path, sid string) *http.Request {
+	req, _ := http.NewRequest(method, d.baseURL+path, nil)
+	if sid != "" {
+		req.Header.Set("X-FTL-SID", sid)
+	}
+	return req
+}
+
+// adguardDriver manages AdGuard Home DNS rewrites; rewrites answering with an IPv4 address are its A records
+type adguardDriver struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	password string
+}
+
+type adguardRewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+func (d *adguardDriver) ListRecords() ([]DNSEntry, error) {
+	var rewrites []adguardRewrite
+	if err := dnsRequest(d.client, d.request(http.MethodGet, "/control/rewrite/list", nil), &rewrites); err != nil {
+		return nil, err
+	}
+	var entries []DNSEntry
+	for _, rewrite := range rewrites {
+		if net.ParseIP(rewrite.Answer).To4() != nil {
+			entries = append(entries, DNSEntry{Domain: strings.ToLower(rewrite.Domain), IP: rewrite.Answer})
+		}
+	}
+	return entries, nil
+}
+
+// AddRecord checks the list first, as AdGuard Home stores duplicate rewrites
+func (d *adguardDriver) AddRecord(domain, ip string) error {
+	entries, err := d.ListRecords()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Domain == domain && entry.IP == ip {
+			return nil
+		}
+	}
+	return dnsRequest(d.client, d.request(http.MethodPost, "/control/rewrite/add", adguardRewrite{Domain: domain, Answer: ip}), nil)
+}
+
+func (d *adguardDriver) RemoveRecord(domain, ip string) error {
+	return dnsRequest(d.client, d.request(http.MethodPost, "/control/rewrite/delete", adguardRewrite{Domain: domain, Answer: ip}), nil)
+}
+
+func (d *adguardDriver) request(method, path string, payload interface{}) *http.Request {
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, d.baseURL+path, body)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if d.username != "" {
+		req.SetBasicAuth(d.username, d.password)
+	}
+	return req
+}
+
+// dnsStatusError is an unexpected HTTP status from a DNS server's API
+type dnsStatusError struct {
+	Code int
+	Body string
+}
+
+func (e *dnsStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.Code, e.Body)
+}
+
+// dnsRequest sends a request and decodes a JSON response into out, if set
+func dnsRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &dnsStatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", req.URL.Path, err)
+	}
+	return nil
+}
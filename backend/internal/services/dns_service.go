@@ -0,0 +1,427 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrDNSProviderNotFound is returned for an unknown DNS provider ID
+var ErrDNSProviderNotFound = errors.New("DNS provider not found")
+
+// DNSProviderRequest configures a DNS provider
+type DNSProviderRequest struct {
+	Name      string                 `json:"name"`
+	Type      models.DNSProviderType `json:"type"`
+	DeviceID  *uuid.UUID             `json:"device_id,omitempty"`
+	HostsFile string                 `json:"hosts_file,omitempty"`
+	URL       string                 `json:"url,omitempty"`
+	Username  string                 `json:"username,omitempty"`
+	Password  string                 `json:"password,omitempty"`
+}
+
+// DNSSyncResult is what a sync changed on one provider
+type DNSSyncResult struct {
+	ProviderID uuid.UUID `json:"provider_id"`
+	Provider   string    `json:"provider"`
+	Added      []string  `json:"added,omitempty"`   // Records created or pointed at a new address
+	Removed    []string  `json:"removed,omitempty"` // Records of removed deployments or old addresses
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// dnsTarget is the address a domain should resolve to and the deployment it belongs to
+type dnsTarget struct {
+	ip           string
+	deploymentID uuid.UUID
+}
+
+// DNSService keeps an A record for every deployment domain on the configured DNS providers
+// Only records the platform created are changed; records added by hand are left alone
+type DNSService struct {
+	db          *gorm.DB
+	credService *CredentialService
+	sshClient   sshExecutor
+	httpClient  *http.Client
+	mu          sync.Mutex // Serialises read-modify-write cycles on the providers
+}
+
+// NewDNSService creates a new DNS service
+func NewDNSService(db *gorm.DB, credService *CredentialService, sshClient sshExecutor) *DNSService {
+	return &DNSService{
+		db:          db,
+		credService: credService,
+		sshClient:   sshClient,
+		httpClient:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// ListProviders returns the configured DNS providers
+func (s *DNSService) ListProviders() ([]models.DNSProvider, error) {
+	var providers []models.DNSProvider
+	if err := s.db.Order("name").Find(&providers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list DNS providers: %w", err)
+	}
+	return providers, nil
+}
+
+// CreateProvider checks that the DNS server can be reached, saves it and adds the records of existing deployments
+func (s *DNSService) CreateProvider(req DNSProviderRequest) (*models.DNSProvider, *DNSSyncResult, error) {
+	provider := &models.DNSProvider{
+		Name:      strings.TrimSpace(req.Name),
+		Type:      req.Type,
+		DeviceID:  req.DeviceID,
+		HostsFile: strings.TrimSpace(req.HostsFile),
+		URL:       strings.TrimSpace(req.URL),
+		Username:  req.Username,
+		Enabled:   true,
+	}
+	if provider.Name == "" {
+		return nil, nil, fmt.Errorf("name is required")
+	}
+	switch provider.Type {
+	case models.DNSProviderDnsmasq:
+		if provider.DeviceID == nil {
+			return nil, nil, fmt.Errorf("dnsmasq needs the device it runs on")
+		}
+		if provider.HostsFile != "" && !strings.HasPrefix(provider.HostsFile, "/") {
+			return nil, nil, fmt.Errorf("hosts file must be an absolute path")
+		}
+	case models.DNSProviderPihole, models.DNSProviderAdGuard:
+		parsed, err := url.Parse(provider.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, nil, fmt.Errorf("invalid URL %q", provider.URL)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown DNS provider type %q", provider.Type)
+	}
+
+	var existing int64
+	s.db.Model(&models.DNSProvider{}).Where("name = ?", provider.Name).Count(&existing)
+	if existing > 0 {
+		return nil, nil, fmt.Errorf("a DNS provider named %s already exists", provider.Name)
+	}
+
+	driver, err := s.driver(provider, req.Password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := driver.ListRecords(); err != nil {
+		return nil, nil, fmt.Errorf("failed to reach %s: %w", provider.Name, err)
+	}
+
+	if err := s.db.Create(provider).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to save DNS provider: %w", err)
+	}
+	if req.Password != "" {
+		provider.CredentialKey = fmt.Sprintf("dns-provider-%s", provider.ID)
+		if err := s.credService.StoreCredential(provider.CredentialKey, req.Password); err != nil {
+			s.db.Delete(provider)
+			return nil, nil, fmt.Errorf("failed to store password: %w", err)
+		}
+		if err := s.db.Model(provider).Update("credential_key", provider.CredentialKey).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to save DNS provider: %w", err)
+		}
+	}
+
+	desired, err := s.desiredRecords()
+	if err != nil {
+		return provider, nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := s.syncProvider(provider, desired, nil)
+	return provider, result, nil
+}
+
+// DeleteProvider removes the records the platform created on a provider, then the provider
+// Records that cannot be removed are logged, so an unreachable server can still be deleted
+func (s *DNSService) DeleteProvider(id uuid.UUID) error {
+	provider, err := s.getProvider(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []models.DNSRecord
+	s.db.Where("provider_id = ?", provider.ID).Find(&records)
+	if driver, err := s.providerDriver(provider); err == nil {
+		for _, record := range records {
+			if err := driver.RemoveRecord(record.Domain, record.IPAddress); err != nil {
+				log.Printf("[DNS] Warning: Failed to remove %s from %s: %v", record.Domain, provider.Name, err)
+			}
+		}
+	} else {
+		log.Printf("[DNS] Warning: Records on %s are left in place: %v", provider.Name, err)
+	}
+
+	if err := s.db.Where("provider_id = ?", provider.ID).Delete(&models.DNSRecord{}).Error; err != nil {
+		return fmt.Errorf("failed to delete DNS records: %w", err)
+	}
+	if provider.CredentialKey != "" {
+		if err := s.credService.DeleteCredentials(provider.CredentialKey); err != nil {
+			log.Printf("[DNS] Warning: Failed to delete password of %s: %v", provider.Name, err)
+		}
+	}
+	if err := s.db.Delete(provider).Error; err != nil {
+		return fmt.Errorf("failed to delete DNS provider: %w", err)
+	}
+	return nil
+}
+
+// ListRecords returns the records the platform manages, optionally on one provider
+func (s *DNSService) ListRecords(providerID *uuid.UUID) ([]models.DNSRecord, error) {
+	query := s.db.Order("domain")
+	if providerID != nil {
+		query = query.Where("provider_id = ?", *providerID)
+	}
+	var records []models.DNSRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to list DNS records: %w", err)
+	}
+	return records, nil
+}
+
+// SyncDeployment points the deployment's domain at its device on every provider,
+// replacing the record of a previous domain or device
+func (s *DNSService) SyncDeployment(deployment *models.Deployment) []DNSSyncResult {
+	desired := map[string]dnsTarget{}
+	if deployment.Domain == "" {
+		var count int64
+		if s.db.Model(&models.DNSRecord{}).Where("deployment_id = ?", deployment.ID).Count(&count); count == 0 {
+			return nil
+		}
+	} else {
+		var device models.Device
+		if err := s.db.First(&device, "id = ?", deployment.DeviceID).Error; err != nil {
+			return []DNSSyncResult{{Errors: []string{fmt.Sprintf("failed to load device: %v", err)}}}
+		}
+		desired[deployment.Domain] = dnsTarget{ip: device.LocalIPAddress, deploymentID: deployment.ID}
+	}
+	return s.sync(desired, &deployment.ID)
+}
+
+// RemoveDeployment removes the deployment's records from every provider
+func (s *DNSService) RemoveDeployment(deploymentID uuid.UUID) []DNSSyncResult {
+	var count int64
+	if s.db.Model(&models.DNSRecord{}).Where("deployment_id = ?", deploymentID).Count(&count); count == 0 {
+		return nil
+	}
+	return s.sync(map[string]dnsTarget{}, &deploymentID)
+}
+
+// Reconcile brings every provider in line with the deployments: missing records are added, records pointing at
+// the wrong device are corrected and records of deployments that are gone are removed
+func (s *DNSService) Reconcile() ([]DNSSyncResult, error) {
+	desired, err := s.desiredRecords()
+	if err != nil {
+		return nil, err
+	}
+	return s.sync(desired, nil), nil
+}
+
+// sync applies desired to every enabled provider; scope limits pruning to one deployment's records
+func (s *DNSService) sync(desired map[string]dnsTarget, scope *uuid.UUID) []DNSSyncResult {
+	var providers []models.DNSProvider
+	if err := s.db.Where("enabled = ?", true).Order("name").Find(&providers).Error; err != nil {
+		return []DNSSyncResult{{Errors: []string{fmt.Sprintf("failed to list DNS providers: %v", err)}}}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]DNSSyncResult, 0, len(providers))
+	for i := range providers {
+		results = append(results, *s.syncProvider(&providers[i], desired, scope))
+	}
+	return results
+}
+
+// syncProvider makes one provider match desired and records the outcome on it
+// Callers hold s.mu
+func (s *DNSService) syncProvider(provider *models.DNSProvider, desired map[string]dnsTarget, scope *uuid.UUID) *DNSSyncResult {
+	result := &DNSSyncResult{ProviderID: provider.ID, Provider: provider.Name}
+	defer func() {
+		now := time.Now()
+		s.db.Model(provider).Updates(map[string]interface{}{"last_sync_at": now, "last_error": strings.Join(result.Errors, "; ")})
+	}()
+
+	driver, err := s.providerDriver(provider)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+	actual, err := driver.ListRecords()
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to list records: %v", err))
+		return result
+	}
+	present := make(map[string][]string) // Domain -> addresses on the server
+	for _, entry := range actual {
+		present[entry.Domain] = append(present[entry.Domain], entry.IP)
+	}
+
+	query := s.db.Where("provider_id = ?", provider.ID)
+	if scope != nil {
+		domains := make([]string, 0, len(desired))
+		for domain := range desired {
+			domains = append(domains, domain)
+		}
+		query = query.Where("deployment_id = ? OR domain IN ?", *scope, domains)
+	}
+	var records []models.DNSRecord
+	if err := query.Find(&records).Error; err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to load records: %v", err))
+		return result
+	}
+
+	managed := make(map[string]bool)
+	for _, record := range records {
+		managed[record.Domain] = true
+		if target, ok := desired[record.Domain]; ok && target.ip == record.IPAddress {
+			continue
+		}
+		if containsString(present[record.Domain], record.IPAddress) {
+			if err := driver.RemoveRecord(record.Domain, record.IPAddress); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("failed to remove %s: %v", record.Domain, err))
+				continue
+			}
+			present[record.Domain] = removeString(present[record.Domain], record.IPAddress)
+		}
+		if _, ok := desired[record.Domain]; !ok {
+			result.Removed = append(result.Removed, record.Domain)
+		}
+		s.db.Delete(&record)
+	}
+
+	domains := make([]string, 0, len(desired))
+	for domain := range desired {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		target := desired[domain]
+		var stale []string
+		for _, ip := range present[domain] {
+			if ip != target.ip {
+				stale = append(stale, ip)
+			}
+		}
+		// A record added by hand wins: replacing it could break whatever it points at
+		if len(stale) > 0 && !managed[domain] {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s already resolves to %s; remove that record to let the platform manage it",
+				domain, strings.Join(stale, ", ")))
+			continue
+		}
+
+		failed := false
+		for _, ip := range stale {
+			if err := driver.RemoveRecord(domain, ip); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("failed to remove %s -> %s: %v", domain, ip, err))
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+		if len(stale) > 0 || !containsString(present[domain], target.ip) {
+			if err := driver.AddRecord(domain, target.ip); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("failed to add %s: %v", domain, err))
+				continue
+			}
+			result.Added = append(result.Added, domain)
+		}
+
+		record := models.DNSRecord{ProviderID: provider.ID, Domain: domain, IPAddress: target.ip, DeploymentID: target.deploymentID}
+		if err := s.db.Where("provider_id = ? AND domain = ?", provider.ID, domain).Delete(&models.DNSRecord{}).Error; err == nil {
+			err = s.db.Create(&record).Error
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to save record for %s: %v", domain, err))
+		}
+	}
+
+	if len(result.Added) > 0 || len(result.Removed) > 0 {
+		log.Printf("[DNS] %s: added %v, removed %v", provider.Name, result.Added, result.Removed)
+	}
+	return result
+}
+
+// desiredRecords maps every deployment domain to the address of its device
+func (s *DNSService) desiredRecords() (map[string]dnsTarget, error) {
+	var deployments []models.Deployment
+	if err := s.db.Where("domain <> '' AND status <> ?", models.DeploymentStatusFailed).Find(&deployments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	var devices []models.Device
+	if err := s.db.Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	addresses := make(map[uuid.UUID]string, len(devices))
+	for _, device := range devices {
+		addresses[device.ID] = device.LocalIPAddress
+	}
+
+	desired := make(map[string]dnsTarget, len(deployments))
+	for _, deployment := range deployments {
+		if ip := addresses[deployment.DeviceID]; ip != "" {
+			desired[deployment.Domain] = dnsTarget{ip: ip, deploymentID: deployment.ID}
+		}
+	}
+	return desired, nil
+}
+
+// providerDriver returns the driver for a saved provider, loading its password and device
+func (s *DNSService) providerDriver(provider *models.DNSProvider) (DNSDriver, error) {
+	password := ""
+	if provider.CredentialKey != "" {
+		var err error
+		if password, err = s.credService.GetCredential(provider.CredentialKey); err != nil {
+			return nil, fmt.Errorf("failed to load password: %w", err)
+		}
+	}
+	return s.driver(provider, password)
+}
+
+func (s *DNSService) driver(provider *models.DNSProvider, password string) (DNSDriver, error) {
+	var device *models.Device
+	if provider.DeviceID != nil {
+		device = &models.Device{}
+		if err := s.db.First(device, "id = ?", *provider.DeviceID).Error; err != nil {
+			return nil, fmt.Errorf("device not found: %w", err)
+		}
+	}
+	return newDNSDriver(provider, password, device, s.sshClient, s.httpClient)
+}
+
+func (s *DNSService) getProvider(id uuid.UUID) (*models.DNSProvider, error) {
+	var provider models.DNSProvider
+	if err := s.db.First(&provider, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDNSProviderNotFound
+		}
+		return nil, fmt.Errorf("failed to load DNS provider: %w", err)
+	}
+	return &provider, nil
+}
+
+// removeString returns values without the first occurrence of value
+func removeString(values []string, value string) []string {
+	for i, v := range values {
+		if v == value {
+			return append(values[:i:i], values[i+1:]...)
+		}
+	}
+	return values
+}
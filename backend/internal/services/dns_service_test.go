@@ -0,0 +1,290 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePihole is a minimal Pi-hole v6 API stand-in serving local DNS records
+type fakePihole struct {
+	server   *httptest.Server
+	hosts    []string
+	sessions int
+	mu       sync.Mutex
+}
+
+func newFakePihole(t *testing.T, hosts ...string) *fakePihole {
+	pihole := &fakePihole{hosts: hosts}
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("X-FTL-SID") != "test-sid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/auth", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Password string `json:"password"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"session":{"valid":false,"sid":null}}`)
+			return
+		}
+		pihole.mu.Lock()
+		pihole.sessions++
+		pihole.mu.Unlock()
+		fmt.Fprint(w, `{"session":{"valid":true,"sid":"test-sid","validity":300}}`)
+	})
+	mux.HandleFunc("DELETE /api/auth", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			pihole.mu.Lock()
+			pihole.sessions--
+			pihole.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	mux.HandleFunc("GET /api/config/dns/hosts", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			pihole.mu.Lock()
+			defer pihole.mu.Unlock()
+			json.NewEncoder(w).Encode(map[string]interface{}{"config": map[string]interface{}{"dns": map[string]interface{}{"hosts": pihole.hosts}}})
+		}
+	})
+	mux.HandleFunc("PUT /api/config/dns/hosts/{entry}", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			pihole.mu.Lock()
+			defer pihole.mu.Unlock()
+			if containsString(pihole.hosts, r.PathValue("entry")) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"key":"bad_request","message":"Item already present"}}`)
+				return
+			}
+			pihole.hosts = append(pihole.hosts, r.PathValue("entry"))
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+	mux.HandleFunc("DELETE /api/config/dns/hosts/{entry}", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			pihole.mu.Lock()
+			defer pihole.mu.Unlock()
+			if !containsString(pihole.hosts, r.PathValue("entry")) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			pihole.hosts = removeString(pihole.hosts, r.PathValue("entry"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	pihole.server = httptest.NewServer(mux)
+	t.Cleanup(pihole.server.Close)
+	return pihole
+}
+
+func (p *fakePihole) entries() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.hosts...)
+}
+
+// fakeHostsSSH keeps a hosts file written with "sudo tee" and read back with "cat"
+type fakeHostsSSH struct {
+	content  string
+	commands []string
+}
+
+func (f *fakeHostsSSH) Execute(host, command string) (string, error) {
+	f.commands = append(f.commands, command)
+	if strings.HasPrefix(command, "cat ") {
+		return f.content, nil
+	}
+	if start := strings.Index(command, "<< 'EOF'"); start >= 0 {
+		body := command[strings.Index(command[start:], "\n")+start+1:]
+		f.content = strings.TrimSuffix(body, "EOF")
+	}
+	return "", nil
+}
+
+func (f *fakeHostsSSH) ExecuteWithTimeout(host, command string, timeout time.Duration) (string, error) {
+	return f.Execute(host, command)
+}
+
+func TestDNSDrivers(t *testing.T) {
+	t.Run("dnsmasq", func(t *testing.T) {
+		ssh := &fakeHostsSSH{content: "# Managed by the homelab orchestration platform\n192.168.1.20 wiki.home.lan cloud.home.lan\n"}
+		driver := &dnsmasqDriver{ssh: ssh, host: "192.168.1.2", path: defaultDNSHostsFile}
+
+		require.NoError(t, driver.AddRecord("photos.home.lan", "192.168.1.21"))
+		records, err := driver.ListRecords()
+		require.NoError(t, err)
+		assert.Equal(t, []DNSEntry{
+			{Domain: "wiki.home.lan", IP: "192.168.1.20"},
+			{Domain: "cloud.home.lan", IP: "192.168.1.20"},
+			{Domain: "photos.home.lan", IP: "192.168.1.21"},
+		}, records)
+		write := ssh.commands[1]
+		assert.Contains(t, write, "sudo tee '/etc/homelab.hosts' > /dev/null << 'EOF' && if grep -qsx 'addn-hosts=/etc/homelab.hosts' /etc/dnsmasq.d/homelab.conf; then sudo pkill -HUP -x dnsmasq;")
+		assert.Contains(t, write, "sudo systemctl restart dnsmasq")
+
+		commands := len(ssh.commands)
+		require.NoError(t, driver.AddRecord("photos.home.lan", "192.168.1.21"))
+		require.NoError(t, driver.RemoveRecord("nas.home.lan", "192.168.1.30"))
+		assert.Len(t, ssh.commands, commands+2, "nothing is written when nothing changes")
+
+		require.NoError(t, driver.RemoveRecord("wiki.home.lan", "192.168.1.20"))
+		assert.Equal(t, "# Managed by the homelab orchestration platform, changes are overwritten\n192.168.1.20 cloud.home.lan\n192.168.1.21 photos.home.lan\n", ssh.content)
+	})
+
+	t.Run("pihole", func(t *testing.T) {
+		pihole := newFakePihole(t, "192.168.1.5 nas.home.lan")
+		driver := &piholeDriver{client: http.DefaultClient, baseURL: pihole.server.URL, password: "secret"}
+
+		require.NoError(t, driver.AddRecord("wiki.home.lan", "192.168.1.20"))
+		require.NoError(t, driver.AddRecord("wiki.home.lan", "192.168.1.20"))
+		require.NoError(t, driver.RemoveRecord("nas.home.lan", "192.168.1.99"))
+		records, err := driver.ListRecords()
+		require.NoError(t, err)
+		assert.Equal(t, []DNSEntry{{Domain: "nas.home.lan", IP: "192.168.1.5"}, {Domain: "wiki.home.lan", IP: "192.168.1.20"}}, records)
+		assert.Zero(t, pihole.sessions, "every session is logged out")
+
+		driver.password = "wrong"
+		_, err = driver.ListRecords()
+		assert.ErrorContains(t, err, "failed to log in to Pi-hole")
+	})
+
+	t.Run("adguard", func(t *testing.T) {
+		rewrites := []adguardRewrite{{Domain: "nas.home.lan", Answer: "192.168.1.5"}, {Domain: "media.home.lan", Answer: "nas.home.lan"}}
+		var mu sync.Mutex
+		mux := http.NewServeMux()
+		mux.HandleFunc("/control/rewrite/", func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			var rewrite adguardRewrite
+			switch r.URL.Path {
+			case "/control/rewrite/list":
+				json.NewEncoder(w).Encode(rewrites)
+			case "/control/rewrite/add":
+				json.NewDecoder(r.Body).Decode(&rewrite)
+				rewrites = append(rewrites, rewrite)
+			case "/control/rewrite/delete":
+				json.NewDecoder(r.Body).Decode(&rewrite)
+				for i, existing := range rewrites {
+					if existing == rewrite {
+						rewrites = append(rewrites[:i], rewrites[i+1:]...)
+						break
+					}
+				}
+			}
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		driver := &adguardDriver{client: http.DefaultClient, baseURL: server.URL, username: "admin", password: "secret"}
+
+		require.NoError(t, driver.AddRecord("wiki.home.lan", "192.168.1.20"))
+		require.NoError(t, driver.AddRecord("wiki.home.lan", "192.168.1.20"))
+		records, err := driver.ListRecords()
+		require.NoError(t, err)
+		assert.Equal(t, []DNSEntry{{Domain: "nas.home.lan", IP: "192.168.1.5"}, {Domain: "wiki.home.lan", IP: "192.168.1.20"}}, records,
+			"CNAME-style rewrites are not A records and no duplicate is added")
+
+		require.NoError(t, driver.RemoveRecord("nas.home.lan", "192.168.1.5"))
+		assert.Len(t, rewrites, 2)
+
+		driver.password = "wrong"
+		_, err = driver.ListRecords()
+		assert.ErrorContains(t, err, "unexpected status 401")
+	})
+}
+
+func TestDNSService_SyncAndReconcile(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDNSService(db, credService, nil)
+	pihole := newFakePihole(t, "192.168.1.5 nas.home.lan", "192.168.1.9 photos.home.lan")
+
+	device := &models.Device{Name: "server-1", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.20"}
+	other := &models.Device{Name: "server-2", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.21"}
+	require.NoError(t, db.Create(device).Error)
+	require.NoError(t, db.Create(other).Error)
+	wiki := &models.Deployment{RecipeSlug: "wiki-js", DeviceID: device.ID, Domain: "wiki.home.lan", Status: models.DeploymentStatusRunning}
+	photos := &models.Deployment{RecipeSlug: "immich", DeviceID: device.ID, Domain: "photos.home.lan", Status: models.DeploymentStatusRunning}
+	broken := &models.Deployment{RecipeSlug: "gitea", DeviceID: device.ID, Domain: "git.home.lan", Status: models.DeploymentStatusFailed}
+	for _, deployment := range []*models.Deployment{wiki, photos, broken} {
+		require.NoError(t, db.Create(deployment).Error)
+	}
+
+	_, _, err := service.CreateProvider(DNSProviderRequest{Name: "pihole", Type: models.DNSProviderPihole, URL: pihole.server.URL, Password: "wrong"})
+	assert.ErrorContains(t, err, "failed to reach pihole")
+	_, _, err = service.CreateProvider(DNSProviderRequest{Name: "dnsmasq", Type: models.DNSProviderDnsmasq})
+	assert.EqualError(t, err, "dnsmasq needs the device it runs on")
+	_, _, err = service.CreateProvider(DNSProviderRequest{Name: "adguard", Type: models.DNSProviderAdGuard, URL: "adguard.home.lan"})
+	assert.EqualError(t, err, `invalid URL "adguard.home.lan"`)
+
+	// Existing deployments get their records; a domain someone pointed elsewhere by hand is left alone
+	provider, result, err := service.CreateProvider(DNSProviderRequest{Name: "pihole", Type: models.DNSProviderPihole, URL: pihole.server.URL, Password: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wiki.home.lan"}, result.Added)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0], "photos.home.lan already resolves to 192.168.1.9")
+	assert.ElementsMatch(t, []string{"192.168.1.5 nas.home.lan", "192.168.1.9 photos.home.lan", "192.168.1.20 wiki.home.lan"}, pihole.entries())
+	saved, err := service.getProvider(provider.ID)
+	require.NoError(t, err)
+	assert.Contains(t, saved.LastError, "photos.home.lan")
+	assert.NotNil(t, saved.LastSyncAt)
+
+	// A migrated deployment's record follows it to the new device
+	wiki.DeviceID = other.ID
+	require.NoError(t, db.Save(wiki).Error)
+	results := service.SyncDeployment(wiki)
+	require.Len(t, results, 1)
+	assert.Empty(t, results[0].Errors)
+	assert.ElementsMatch(t, []string{"192.168.1.5 nas.home.lan", "192.168.1.9 photos.home.lan", "192.168.1.21 wiki.home.lan"}, pihole.entries())
+
+	// Drift: the record was deleted on the server and the manual photos record was cleaned up
+	pihole.mu.Lock()
+	pihole.hosts = []string{"192.168.1.5 nas.home.lan"}
+	pihole.mu.Unlock()
+	results, err = service.Reconcile()
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, []string{"photos.home.lan", "wiki.home.lan"}, results[0].Added)
+	assert.Empty(t, results[0].Errors)
+	records, err := service.ListRecords(&provider.ID)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, photos.ID, records[0].DeploymentID)
+
+	// Records of deployments that are gone are removed, manual ones stay
+	require.NoError(t, db.Delete(photos).Error)
+	results, err = service.Reconcile()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"photos.home.lan"}, results[0].Removed)
+	service.RemoveDeployment(wiki.ID)
+	assert.Equal(t, []string{"192.168.1.5 nas.home.lan"}, pihole.entries())
+	records, err = service.ListRecords(nil)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.Nil(t, service.SyncDeployment(&models.Deployment{DeviceID: device.ID}), "deployments without a domain or records skip the providers")
+
+	require.NoError(t, service.DeleteProvider(provider.ID))
+	assert.ErrorIs(t, service.DeleteProvider(provider.ID), ErrDNSProviderNotFound)
+	assert.Zero(t, pihole.sessions)
+}
@@ -12,19 +12,224 @@ import (
 	"time"
 )
 
+// dockerHubRegistry is the registry host used for images without an explicit registry
+const dockerHubRegistry = "registry-1.docker.io"
+
+// manifestAcceptHeaders lists manifest media types, preferring multi-arch indexes
+// Docker stores the index digest in RepoDigests when pulling a multi-arch tag, so we must ask for the same
+var manifestAcceptHeaders = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
 // DockerRegistryClient fetches metadata about Docker images
 type DockerRegistryClient struct {
-	cacheDir      string
-	cacheDuration time.Duration
-	mu            sync.RWMutex
+	cacheDir           string
+	cacheDuration      time.Duration
+	httpClient         *http.Client
+	insecureRegistries map[string]bool // Registries reached over plain HTTP (e.g. local mirrors)
+	mu                 sync.RWMutex
 }
 
 // NewDockerRegistryClient creates a new Docker registry client
 func NewDockerRegistryClient(cacheDir string) *DockerRegistryClient {
 	return &DockerRegistryClient{
-		cacheDir:      cacheDir,
-		cacheDuration: 24 * time.Hour, // Cache for 24 hours
+		cacheDir:           cacheDir,
+		cacheDuration:      24 * time.Hour, // Cache for 24 hours
+		httpClient:         &http.Client{Timeout: 30 * time.Second},
+		insecureRegistries: make(map[string]bool),
+	}
+}
+
+// ImageReference is a parsed image reference such as "ghcr.io/org/app:1.2"
+type ImageReference struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+}
+
+// String returns the reference in registry/repository:tag form
+func (r ImageReference) String() string {
+	return fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Tag)
+}
+
+// AddInsecureRegistry allows a registry host (host:port) to be contacted over plain HTTP
+func (c *DockerRegistryClient) AddInsecureRegistry(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insecureRegistries[host] = true
+}
+
+// ParseImageReference splits an image reference into registry, repository and tag
+// Follows Docker's rules: the first path component is a registry if it contains '.' or ':' or is "localhost"
+func ParseImageReference(image string) (ImageReference, error) {
+	image = strings.TrimSpace(image)
+	if image == "" {
+		return ImageReference{}, fmt.Errorf("empty image reference")
+	}
+
+	// Digest-pinned references never have updates
+	if strings.Contains(image, "@") {
+		return ImageReference{}, fmt.Errorf("image %s is pinned by digest", image)
+	}
+
+	ref := ImageReference{Registry: dockerHubRegistry, Tag: "latest"}
+
+	remainder := image
+	if slash := strings.Index(image, "/"); slash != -1 {
+		first := image[:slash]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.Registry = first
+			remainder = image[slash+1:]
+		}
+	}
+
+	// A colon after the last slash separates the tag
+	if colon := strings.LastIndex(remainder, ":"); colon != -1 && colon > strings.LastIndex(remainder, "/") {
+		ref.Tag = remainder[colon+1:]
+		remainder = remainder[:colon]
+	}
+	ref.Repository = remainder
+
+	if ref.Registry == dockerHubRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if ref.Repository == "" || ref.Tag == "" {
+		return ImageReference{}, fmt.Errorf("invalid image reference: %s", image)
+	}
+
+	return ref, nil
+}
+
+// GetManifestDigest resolves the current manifest digest for an image tag from its registry
+// Uses the Registry HTTP API v2 and handles anonymous bearer-token authentication
+func (c *DockerRegistryClient) GetManifestDigest(image string) (string, error) {
+	ref, err := ParseImageReference(image)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.RLock()
+	scheme := "https"
+	if c.insecureRegistries[ref.Registry] {
+		scheme = "http"
+	}
+	c.mu.RUnlock()
+
+	url := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, ref.Registry, ref.Repository, ref.Tag)
+
+	resp, err := c.headManifest(url, "")
+	if err != nil {
+		return "", err
+	}
+
+	// Most public registries require an anonymous pull token
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := c.fetchRegistryToken(resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+		resp, err = c.headManifest(url, token)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry returned HTTP %d for %s", resp.StatusCode, ref)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s", ref)
+	}
+
+	return digest, nil
+}
+
+// headManifest issues a HEAD request for a manifest
+func (c *DockerRegistryClient) headManifest(url string, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestAcceptHeaders, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry: %w", err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// fetchRegistryToken requests an anonymous token using a WWW-Authenticate bearer challenge
+func (c *DockerRegistryClient) fetchRegistryToken(challenge string) (string, error) {
+	params := parseAuthChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry requires authentication but sent no bearer realm")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, realm, nil)
+	if err != nil {
+		return "", err
+	}
+	query := req.URL.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope := params["scope"]; scope != "" {
+		query.Set("scope", scope)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch registry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned HTTP %d", resp.StatusCode)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	return tokenResponse.AccessToken, nil
+}
+
+// parseAuthChallenge parses `Bearer realm="...",service="...",scope="..."` into a map
+func parseAuthChallenge(challenge string) map[string]string {
+	params := make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return params
+	}
+
+	for _, part := range strings.Split(challenge[len("bearer "):], ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		params[strings.ToLower(key)] = strings.Trim(value, "\"")
 	}
+	return params
 }
 
 // ImageMetadata contains metadata about a Docker image
@@ -32,17 +32,8 @@ func (eb *EnvironmentBuilder) BuildEnvironment(
 	provisionedDB *models.ProvisionedDatabase,
 ) (map[string]string, string, error) {
 
-	envMap := make(map[string]string)
-
-	// 1. Add user-provided configuration (convert to uppercase env var names)
-	for key, value := range userConfig {
-		envMap[strings.ToUpper(key)] = fmt.Sprintf("%v", value)
-	}
-
-	// 2. Add deployment-specific variables
-	envMap["DEPLOYMENT_ID"] = deployment.ID.String()
-	envMap["COMPOSE_PROJECT"] = deployment.ComposeProject
-	envMap["DEVICE_IP"] = device.GetPrimaryAddress()
+	// 1-2. User-provided configuration and deployment-specific variables
+	envMap := eb.baseEnvironment(deployment, userConfig, device)
 
 	// 3. Generate or retrieve persistent secrets
 	secrets, err := eb.secretManager.GenerateOrRetrieveSecrets(deployment.ID, recipe, userConfig)
@@ -75,6 +66,67 @@ func (eb *EnvironmentBuilder) BuildEnvironment(
 	return envMap, envFileContent, nil
 }
 
+// PreviewEnvironment builds the environment a deployment would get without generating or reading any secrets
+// Generated secrets, database passwords and password hashes are set to placeholder values,
+// so the result is only suitable for showing which variables will be set
+func (eb *EnvironmentBuilder) PreviewEnvironment(
+	deployment *models.Deployment,
+	recipe *models.Recipe,
+	userConfig map[string]interface{},
+	device *models.Device,
+	provisionedDB *models.ProvisionedDatabase,
+	placeholder string,
+) map[string]string {
+	envMap := eb.baseEnvironment(deployment, userConfig, device)
+
+	for _, option := range recipe.ConfigOptions {
+		if option.Type == "secret" || option.Type == "api_key" {
+			if _, exists := userConfig[option.Name]; !exists {
+				envMap[strings.ToUpper(option.Name)] = placeholder
+			}
+		}
+	}
+
+	if provisionedDB != nil {
+		envPrefix := recipe.Database.EnvPrefix
+		if envPrefix == "" {
+			envPrefix = "DB_"
+		}
+		for k, v := range provisionedDB.GetConnectionEnvVars(envPrefix) {
+			envMap[k] = v
+		}
+		envMap[envPrefix+"PASSWORD"] = placeholder
+		envMap[envPrefix+"CONNECTION_STRING"] = placeholder
+	}
+
+	for _, option := range recipe.ConfigOptions {
+		if option.Type == "password" {
+			if password, exists := envMap[toEnvVarName(option.Name)]; exists && password != "" {
+				envMap[toEnvVarName(option.Name)+"_HASH"] = placeholder
+			}
+		}
+	}
+
+	return envMap
+}
+
+// baseEnvironment returns the user-provided configuration and deployment-specific variables
+func (eb *EnvironmentBuilder) baseEnvironment(deployment *models.Deployment, userConfig map[string]interface{}, device *models.Device) map[string]string {
+	envMap := make(map[string]string)
+
+	// Add user-provided configuration (convert to uppercase env var names)
+	for key, value := range userConfig {
+		envMap[strings.ToUpper(key)] = fmt.Sprintf("%v", value)
+	}
+
+	// Add deployment-specific variables
+	envMap["DEPLOYMENT_ID"] = deployment.ID.String()
+	envMap["COMPOSE_PROJECT"] = deployment.ComposeProject
+	envMap["DEVICE_IP"] = device.GetPrimaryAddress()
+
+	return envMap
+}
+
 // buildDatabaseEnvVars creates environment variables for database connection
 func (eb *EnvironmentBuilder) buildDatabaseEnvVars(provisionedDB *models.ProvisionedDatabase, envPrefix string) (map[string]string, error) {
 	if envPrefix == "" {
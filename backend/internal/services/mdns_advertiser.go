@@ -0,0 +1,278 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/grandcat/zeroconf"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+const mdnsDomain = "local."
+
+// mdnsLabelInvalid matches the characters not allowed in a .local host label
+var mdnsLabelInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// mdnsServer is a registered DNS-SD service
+type mdnsServer interface {
+	Shutdown()
+}
+
+// mdnsRegisterFunc registers a service on behalf of another host, like zeroconf.RegisterProxy
+type mdnsRegisterFunc func(instance, service, domain string, port int, host string, ips []string, text []string, ifaces []net.Interface) (mdnsServer, error)
+
+// MDNSService is a deployment advertised over DNS-SD
+type MDNSService struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Instance     string    `json:"instance"` // Name shown when browsing, e.g. "Nextcloud"
+	Service      string    `json:"service"`  // Service type, _http._tcp or _https._tcp
+	Host         string    `json:"host"`     // Host label of the device, answered as <host>.local
+	IP           string    `json:"ip"`
+	Port         int       `json:"port"`
+	Text         []string  `json:"text"`
+}
+
+type mdnsRegistration struct {
+	service MDNSService
+	server  mdnsServer
+}
+
+// MDNSAdvertiser registers running deployments as DNS-SD services, so phones and laptops on the LAN find them
+// by name; the platform answers for the devices, which need no mDNS daemon of their own
+// Nothing is advertised until Start is called
+type MDNSAdvertiser struct {
+	db            *gorm.DB
+	register      mdnsRegisterFunc
+	mu            sync.Mutex
+	started       bool
+	registrations map[uuid.UUID]*mdnsRegistration
+}
+
+// NewMDNSAdvertiser creates a new mDNS advertiser
+func NewMDNSAdvertiser(db *gorm.DB) *MDNSAdvertiser {
+	return &MDNSAdvertiser{
+		db: db,
+		register: func(instance, service, domain string, port int, host string, ips []string, text []string, ifaces []net.Interface) (mdnsServer, error) {
+			server, err := zeroconf.RegisterProxy(instance, service, domain, port, host, ips, text, ifaces)
+			if err != nil {
+				return nil, err
+			}
+			return server, nil
+		},
+		registrations: make(map[uuid.UUID]*mdnsRegistration),
+	}
+}
+
+// Start advertises every running deployment and the ones that start later
+func (a *MDNSAdvertiser) Start() {
+	a.mu.Lock()
+	a.started = true
+	a.mu.Unlock()
+
+	var deployments []models.Deployment
+	if err := a.db.Where("status IN ?", []models.DeploymentStatus{models.DeploymentStatusRunning, models.DeploymentStatusUnhealthy}).
+		Order("created_at").Find(&deployments).Error; err != nil {
+		log.Printf("[mDNS] Failed to list deployments: %v", err)
+		return
+	}
+	for i := range deployments {
+		if err := a.Advertise(&deployments[i]); err != nil {
+			log.Printf("[mDNS] Failed to advertise %s: %v", deploymentNodeName(&deployments[i]), err)
+		}
+	}
+	log.Printf("[mDNS] Advertising %d deployments", len(a.Services()))
+}
+
+// Stop withdraws every advertised service
+func (a *MDNSAdvertiser) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for id, registration := range a.registrations {
+		registration.server.Shutdown()
+		delete(a.registrations, id)
+	}
+	a.started = false
+}
+
+// Update advertises a deployment while its containers run and withdraws it otherwise
+func (a *MDNSAdvertiser) Update(deployment *models.Deployment) {
+	switch deployment.Status {
+	case models.DeploymentStatusRunning, models.DeploymentStatusUnhealthy:
+		if err := a.Advertise(deployment); err != nil {
+			log.Printf("[mDNS] Failed to advertise %s: %v", deploymentNodeName(deployment), err)
+		}
+	default:
+		a.Withdraw(deployment.ID)
+	}
+}
+
+// Advertise registers the deployment's service, replacing an outdated registration
+// Deployments without a published TCP port or domain are not advertised
+func (a *MDNSAdvertiser) Advertise(deployment *models.Deployment) error {
+	var device models.Device
+	if err := a.db.First(&device, "id = ?", deployment.DeviceID).Error; err != nil {
+		return fmt.Errorf("failed to load device: %w", err)
+	}
+	host := a.HostLabel(&device)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.started {
+		return nil
+	}
+
+	service := describeMDNSService(deployment, &device, host)
+	existing := a.registrations[deployment.ID]
+	if service == nil {
+		a.withdraw(deployment.ID)
+		return nil
+	}
+	service.Instance = a.instanceName(deployment, &device)
+	if existing != nil && reflect.DeepEqual(existing.service, *service) {
+		return nil
+	}
+	a.withdraw(deployment.ID)
+
+	server, err := a.register(service.Instance, service.Service, mdnsDomain, service.Port, service.Host, []string{service.IP}, service.Text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to register %s: %w", service.Instance, err)
+	}
+	a.registrations[deployment.ID] = &mdnsRegistration{service: *service, server: server}
+	log.Printf("[mDNS] Advertising %s as %s on %s.local:%d", service.Instance, service.Service, service.Host, service.Port)
+	return nil
+}
+
+// Withdraw deregisters a deployment's service, if it is advertised
+func (a *MDNSAdvertiser) Withdraw(deploymentID uuid.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.withdraw(deploymentID)
+}
+
+// withdraw deregisters a service; callers hold a.mu
+func (a *MDNSAdvertiser) withdraw(deploymentID uuid.UUID) {
+	if registration, ok := a.registrations[deploymentID]; ok {
+		registration.server.Shutdown()
+		delete(a.registrations, deploymentID)
+	}
+}
+
+// Services returns the advertised services sorted by instance name
+func (a *MDNSAdvertiser) Services() []MDNSService {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	services := make([]MDNSService, 0, len(a.registrations))
+	for _, registration := range a.registrations {
+		services = append(services, registration.service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Instance < services[j].Instance })
+	return services
+}
+
+// Enabled reports whether services are being advertised
+func (a *MDNSAdvertiser) Enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.started
+}
+
+// HostLabel returns the .local host label the platform answers for a device, derived from its name
+// Devices whose names map to the same label are told apart by a short ID suffix
+func (a *MDNSAdvertiser) HostLabel(device *models.Device) string {
+	label := mdnsHostLabel(device.Name)
+	if label == "" {
+		return "device-" + device.ID.String()[:8]
+	}
+
+	var devices []models.Device
+	a.db.Select("id", "name").Where("id <> ?", device.ID).Find(&devices)
+	for _, other := range devices {
+		if mdnsHostLabel(other.Name) == label {
+			return label + "-" + device.ID.String()[:4]
+		}
+	}
+	return label
+}
+
+// instanceName returns the name a deployment is browsed as, unique among the advertised services
+// Callers hold a.mu
+func (a *MDNSAdvertiser) instanceName(deployment *models.Deployment, device *models.Device) string {
+	base := deployment.RecipeName
+	if base == "" {
+		base = deploymentNodeName(deployment)
+	}
+	taken := func(name string) bool {
+		for id, registration := range a.registrations {
+			if id != deployment.ID && registration.service.Instance == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, name := range []string{base, fmt.Sprintf("%s (%s)", base, device.Name), fmt.Sprintf("%s (%s)", base, deploymentNodeName(deployment))} {
+		if !taken(name) {
+			return name
+		}
+	}
+	return fmt.Sprintf("%s (%s)", base, deployment.ID.String()[:8])
+}
+
+// describeMDNSService returns the service for a deployment's first published TCP port, falling back to its
+// domain on the device's reverse proxy; the URL record points at the domain when there is one
+func describeMDNSService(deployment *models.Deployment, device *models.Device, host string) *MDNSService {
+	scheme, port := "", 0
+	for _, spec := range ExtractPortsFromCompose(deployment.GeneratedCompose) {
+		if spec.Protocol == "tcp" {
+			port = spec.Port
+			scheme = accessURLScheme(spec.Port)
+			break
+		}
+	}
+	if port == 0 {
+		if deployment.Domain == "" {
+			return nil
+		}
+		scheme, port = "http", 80
+		if deployment.CertResolver != "" {
+			scheme, port = "https", 443
+		}
+	}
+
+	url := fmt.Sprintf("%s://%s.local:%d", scheme, host, port)
+	if deployment.Domain != "" {
+		url = "http://" + deployment.Domain
+		if deployment.CertResolver != "" {
+			url = "https://" + deployment.Domain
+		}
+	}
+
+	return &MDNSService{
+		DeploymentID: deployment.ID,
+		Service:      fmt.Sprintf("_%s._tcp", scheme),
+		Host:         host,
+		IP:           device.LocalIPAddress,
+		Port:         port,
+		Text:         []string{"recipe=" + deployment.RecipeSlug, "url=" + url},
+	}
+}
+
+// mdnsHostLabel turns a device name into a host label, e.g. "Media Server" into "media-server"
+func mdnsHostLabel(name string) string {
+	label := mdnsLabelInvalid.ReplaceAllString(strings.ToLower(name), "-")
+	label = strings.Trim(label, "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
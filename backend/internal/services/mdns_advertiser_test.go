@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMDNSServer records whether it was shut down
+type fakeMDNSServer struct {
+	shutdown bool
+}
+
+func (f *fakeMDNSServer) Shutdown() {
+	f.shutdown = true
+}
+
+// fakeMDNSRegistry records registrations instead of sending multicast
+type fakeMDNSRegistry struct {
+	registered []string
+	servers    []*fakeMDNSServer
+}
+
+func (f *fakeMDNSRegistry) register(instance, service, domain string, port int, host string, ips []string, text []string, ifaces []net.Interface) (mdnsServer, error) {
+	f.registered = append(f.registered, fmt.Sprintf("%s %s.%s %s:%d %v %v", instance, service, domain, host, port, ips, text))
+	server := &fakeMDNSServer{}
+	f.servers = append(f.servers, server)
+	return server, nil
+}
+
+const mdnsTestCompose = "services:\n  app:\n    image: nextcloud\n    ports:\n      - \"8080:80\"\n"
+
+func TestMDNSAdvertiser(t *testing.T) {
+	db := setupTestDB(t)
+	registry := &fakeMDNSRegistry{}
+	advertiser := NewMDNSAdvertiser(db)
+	advertiser.register = registry.register
+
+	media := &models.Device{Name: "Media Server", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.20"}
+	backup := &models.Device{Name: "server-2", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.21"}
+	require.NoError(t, db.Create(media).Error)
+	require.NoError(t, db.Create(backup).Error)
+
+	nextcloud := &models.Deployment{RecipeSlug: "nextcloud", RecipeName: "Nextcloud", DeviceID: media.ID, ComposeProject: "nextcloud-1",
+		GeneratedCompose: mdnsTestCompose, Status: models.DeploymentStatusRunning}
+	second := &models.Deployment{RecipeSlug: "nextcloud", RecipeName: "Nextcloud", DeviceID: backup.ID, ComposeProject: "nextcloud-2",
+		GeneratedCompose: mdnsTestCompose, Status: models.DeploymentStatusRunning}
+	proxied := &models.Deployment{RecipeSlug: "wiki-js", RecipeName: "Wiki.js", DeviceID: media.ID, ComposeProject: "wiki-js-1",
+		Domain: "wiki.home.lan", CertResolver: homelabCAResolver, Status: models.DeploymentStatusRunning}
+	headless := &models.Deployment{RecipeSlug: "valkey", RecipeName: "Valkey", DeviceID: media.ID, Status: models.DeploymentStatusRunning}
+	stopped := &models.Deployment{RecipeSlug: "gitea", RecipeName: "Gitea", DeviceID: media.ID, GeneratedCompose: mdnsTestCompose,
+		Status: models.DeploymentStatusStopped}
+	for _, deployment := range []*models.Deployment{nextcloud, second, proxied, headless, stopped} {
+		require.NoError(t, db.Create(deployment).Error)
+	}
+
+	// Nothing goes out before the advertiser is started
+	require.NoError(t, advertiser.Advertise(nextcloud))
+	assert.Empty(t, registry.registered)
+
+	advertiser.Start()
+	assert.Equal(t, []string{
+		"Nextcloud _http._tcp.local. media-server:8080 [192.168.1.20] [recipe=nextcloud url=http://media-server.local:8080]",
+		"Nextcloud (server-2) _http._tcp.local. server-2:8080 [192.168.1.21] [recipe=nextcloud url=http://server-2.local:8080]",
+		"Wiki.js _https._tcp.local. media-server:443 [192.168.1.20] [recipe=wiki-js url=https://wiki.home.lan]",
+	}, registry.registered, "services without a port or domain and stopped ones are not advertised")
+
+	// An unchanged deployment is not registered twice; stopping it withdraws the service
+	advertiser.Update(nextcloud)
+	assert.Len(t, registry.registered, 3)
+	nextcloud.Status = models.DeploymentStatusStopped
+	advertiser.Update(nextcloud)
+	assert.True(t, registry.servers[0].shutdown)
+	assert.Len(t, advertiser.Services(), 2)
+
+	// Moving to another device re-registers under its host
+	proxied.DeviceID = backup.ID
+	require.NoError(t, advertiser.Advertise(proxied))
+	assert.True(t, registry.servers[2].shutdown)
+	assert.Equal(t, "Wiki.js _https._tcp.local. server-2:443 [192.168.1.21] [recipe=wiki-js url=https://wiki.home.lan]", registry.registered[3])
+
+	advertiser.Stop()
+	assert.Empty(t, advertiser.Services())
+	for _, server := range registry.servers {
+		assert.True(t, server.shutdown)
+	}
+}
+
+func TestMDNSHostLabel(t *testing.T) {
+	db := setupTestDB(t)
+	advertiser := NewMDNSAdvertiser(db)
+
+	first := &models.Device{Name: "NAS", Type: models.DeviceTypeNAS, LocalIPAddress: "192.168.1.30"}
+	second := &models.Device{Name: "nas!", Type: models.DeviceTypeNAS, LocalIPAddress: "192.168.1.31"}
+	unnamed := &models.Device{Name: "***", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.32"}
+	for _, device := range []*models.Device{first, second, unnamed} {
+		require.NoError(t, db.Create(device).Error)
+	}
+
+	assert.Equal(t, "nas-"+first.ID.String()[:4], advertiser.HostLabel(first), "devices whose names collide get an ID suffix")
+	assert.Equal(t, "device-"+unnamed.ID.String()[:8], advertiser.HostLabel(unnamed))
+	assert.Equal(t, "my-media-server", mdnsHostLabel("My Media_Server "))
+}
+
+func TestGetAccessURLs_MDNS(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+	registry := &fakeMDNSRegistry{}
+	service.mdns.register = registry.register
+
+	device := &models.Device{Name: "server-1", Type: models.DeviceTypeServer, LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	deployment := &models.Deployment{RecipeSlug: "nextcloud", RecipeName: "Nextcloud", DeviceID: device.ID, ComposeProject: "nextcloud-1",
+		GeneratedCompose: mdnsTestCompose, Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(deployment).Error)
+
+	urls, err := service.GetAccessURLs(deployment.ID.String())
+	require.NoError(t, err)
+	require.Len(t, urls, 1, "no .local URLs while nothing is advertised")
+
+	service.MDNS().Start()
+	urls, err = service.GetAccessURLs(deployment.ID.String())
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+	assert.Equal(t, "http://server-1.local:8080", urls[1]["url"])
+
+	// Status changes drive the advertisement
+	service.updateStatus(deployment, models.DeploymentStatusStopped, "")
+	assert.Empty(t, service.MDNS().Services())
+	service.updateStatus(deployment, models.DeploymentStatusRunning, "")
+	require.Len(t, service.MDNS().Services(), 1)
+	service.MDNS().Stop()
+}
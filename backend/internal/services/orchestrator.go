@@ -97,6 +97,7 @@ func (ds *DeploymentSpec) Validate() error {
 type HealthStatus struct {
 	Healthy   bool
 	Running   bool
+	Starting  bool // Health checks have not settled yet, so health is not known
 	Message   string
 	Timestamp time.Time
 }
@@ -289,9 +290,7 @@ func checkContextCancelled(ctx context.Context) error {
 func NewOrchestrator(config OrchestratorConfig, sshClient *ssh.Client) ContainerOrchestrator {
 	switch config.Mode {
 	case "swarm":
-		// Swarm orchestrator will be implemented in the future
-		log.Printf("[Orchestrator] Swarm mode requested but not yet implemented, falling back to Docker Compose")
-		return NewDockerComposeOrchestrator(sshClient)
+		return NewSwarmOrchestrator(sshClient)
 	case "compose":
 		fallthrough
 	default:
@@ -452,40 +451,50 @@ func (dco *DockerComposeOrchestrator) HealthCheck(ctx context.Context, stackName
 		return status, err
 	}
 
-	// If output is empty, no containers found
-	if strings.TrimSpace(output) == "" {
-		status.Message = "No containers found"
-		return status, nil
-	}
-
-	// Check if status contains "Up"
-	if strings.Contains(output, "Up") {
-		status.Running = true
+	return parseComposeHealth(output, status), nil
+}
 
-		// Try to check health status
-		healthCmd := fmt.Sprintf("docker ps --filter label=com.docker.compose.project=%s --format '{{.Status}}' | grep -o '(healthy)\\|(unhealthy)\\|(health: starting)' || echo 'no-health'", stackName)
-		healthOutput, err := dco.sshClient.ExecuteWithTimeout(host, healthCmd, 10*time.Second)
-
-		if err == nil {
-			healthStr := strings.TrimSpace(healthOutput)
-			if healthStr == "(healthy)" || healthStr == "no-health" {
-				status.Healthy = true
-				status.Message = "Container is running and healthy"
-			} else if healthStr == "(health: starting)" {
-				status.Message = "Container is starting"
-			} else {
-				status.Message = "Container is unhealthy"
-			}
-		} else {
-			// If we can't check health but container is up, consider it healthy
-			status.Healthy = true
-			status.Message = "Container is running"
+// parseComposeHealth evaluates the `docker ps` status line of every container in a stack
+// The stack is running when all containers are up and healthy when none of them reports a failing
+// health check; containers whose health check has not settled yet leave the health unknown (Starting)
+func parseComposeHealth(output string, status HealthStatus) HealthStatus {
+	var total, up, unhealthy, starting int
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		total++
+		if !strings.HasPrefix(line, "Up") {
+			continue
+		}
+		up++
+		switch {
+		case strings.Contains(line, "(unhealthy)"):
+			unhealthy++
+		case strings.Contains(line, "(health: starting)"):
+			starting++
 		}
-	} else {
-		status.Message = "Container is not running"
 	}
 
-	return status, nil
+	switch {
+	case total == 0:
+		status.Message = "No containers found"
+	case up < total:
+		status.Message = fmt.Sprintf("%d of %d containers are not up", total-up, total)
+	case unhealthy > 0:
+		status.Running = true
+		status.Message = fmt.Sprintf("%d of %d containers are unhealthy", unhealthy, total)
+	case starting > 0:
+		status.Running = true
+		status.Starting = true
+		status.Message = fmt.Sprintf("%d of %d containers are starting", starting, total)
+	default:
+		status.Running = true
+		status.Healthy = true
+		status.Message = "Container is running and healthy"
+	}
+	return status
 }
 
 // Remove removes a Docker Compose stack
@@ -167,12 +167,12 @@ func TestNewOrchestrator(t *testing.T) {
 			expectedMode: "compose",
 		},
 		{
-			name: "swarm mode (fallback to compose)",
+			name: "swarm mode",
 			config: OrchestratorConfig{
 				Mode:         "swarm",
 				SwarmEnabled: true,
 			},
-			expectedMode: "compose", // Falls back since swarm not implemented
+			expectedMode: "swarm",
 		},
 		{
 			name: "default mode",
@@ -265,6 +265,35 @@ func TestHealthStatus(t *testing.T) {
 	}
 }
 
+// TestParseComposeHealth tests health evaluation across the containers of a stack
+func TestParseComposeHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		running  bool
+		healthy  bool
+		starting bool
+	}{
+		{"no containers", "", false, false, false},
+		{"single healthy", "Up 2 hours (healthy)", true, true, false},
+		{"multiple healthy", "Up 2 hours (healthy)\nUp 2 hours (healthy)\nUp 2 hours (healthy)", true, true, false},
+		{"without health checks", "Up 2 hours\nUp 2 hours (healthy)", true, true, false},
+		{"one starting", "Up 2 hours (healthy)\nUp 4 seconds (health: starting)", true, false, true},
+		{"one unhealthy", "Up 2 hours (health: starting)\nUp 2 hours (unhealthy)", true, false, false},
+		{"one restarting", "Up 2 hours (healthy)\nRestarting (1) 3 seconds ago", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := parseComposeHealth(tt.output, HealthStatus{})
+			if status.Running != tt.running || status.Healthy != tt.healthy || status.Starting != tt.starting {
+				t.Errorf("parseComposeHealth(%q) = running %v, healthy %v, starting %v (%s); want %v, %v, %v",
+					tt.output, status.Running, status.Healthy, status.Starting, status.Message, tt.running, tt.healthy, tt.starting)
+			}
+		})
+	}
+}
+
 // TestRemovalSpec tests removal spec construction
 func TestRemovalSpec(t *testing.T) {
 	spec := RemovalSpec{
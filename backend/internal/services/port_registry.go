@@ -0,0 +1,517 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+	"gorm.io/gorm"
+)
+
+// PortOwnerType is what holds a port on a device
+type PortOwnerType string
+
+const (
+	PortOwnerDeployment        PortOwnerType = "deployment"
+	PortOwnerSharedDatabase    PortOwnerType = "shared_database"
+	PortOwnerSharedCache       PortOwnerType = "shared_cache"
+	PortOwnerDedicatedInstance PortOwnerType = "dedicated_instance"
+	PortOwnerReserved          PortOwnerType = "reserved"
+	PortOwnerUnmanaged         PortOwnerType = "unmanaged" // Something outside the platform listens on it
+)
+
+// portSearchRange is how many ports from the requested one are tried when assigning a free port
+const portSearchRange = 100
+
+// maxReservationDescriptionLength limits the description of a port reservation
+const maxReservationDescriptionLength = 255
+
+// ErrPortReservationNotFound is returned when deleting a reservation that doesn't exist on the device
+var ErrPortReservationNotFound = errors.New("port reservation not found")
+
+// ssProcessRegex extracts the process name from the users column of "ss -p" output
+var ssProcessRegex = regexp.MustCompile(`users:\(\("([^"]+)"`)
+
+// DevicePort is a port held on a device and what holds it
+type DevicePort struct {
+	Port      int           `json:"port"`
+	Protocol  string        `json:"protocol"`
+	OwnerType PortOwnerType `json:"owner_type"`
+	OwnerID   *uuid.UUID    `json:"owner_id,omitempty"`
+	OwnerName string        `json:"owner_name,omitempty"` // Compose project, container, reservation description or process
+	Conflict  bool          `json:"conflict,omitempty"`   // Another owner holds the same port
+}
+
+// describeOwner names the port's owner for error messages
+func (p DevicePort) describeOwner() string {
+	switch p.OwnerType {
+	case PortOwnerReserved:
+		if p.OwnerName != "" {
+			return fmt.Sprintf("reserved: %s", p.OwnerName)
+		}
+		return "reserved"
+	case PortOwnerUnmanaged:
+		if p.OwnerName != "" {
+			return fmt.Sprintf("unmanaged process %s", p.OwnerName)
+		}
+		return "an unmanaged process"
+	default:
+		owner := strings.ReplaceAll(string(p.OwnerType), "_", " ")
+		if p.OwnerName != "" {
+			owner += " " + p.OwnerName
+		}
+		return owner
+	}
+}
+
+// DevicePorts is a device's port registry
+type DevicePorts struct {
+	DeviceID     uuid.UUID                `json:"device_id"`
+	Ports        []DevicePort             `json:"ports"` // Sorted by port
+	Reservations []models.PortReservation `json:"reservations"`
+	ScanError    string                   `json:"scan_error,omitempty"` // Unmanaged ports could not be listed
+}
+
+// PortConflictError lists requested ports that are already held on a device
+type PortConflictError struct {
+	Device    string
+	Conflicts []DevicePort
+}
+
+func (e *PortConflictError) Error() string {
+	held := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		held[i] = fmt.Sprintf("%d/%s (%s)", conflict.Port, conflict.Protocol, conflict.describeOwner())
+	}
+	return fmt.Sprintf("ports already in use on %s: %s", e.Device, strings.Join(held, ", "))
+}
+
+// PortReservationRequest reserves a range of ports on a device
+type PortReservationRequest struct {
+	StartPort   int    `json:"start_port"`
+	EndPort     int    `json:"end_port,omitempty"` // Defaults to StartPort
+	Description string `json:"description,omitempty"`
+}
+
+// PortRegistry tracks the host ports held on each device
+// Deployments' ports are recorded as PortAllocations; shared and dedicated instances keep theirs on their own
+// records, so the registry reads them from there. Ports nothing on the platform owns are found by listing the
+// device's listening sockets
+type PortRegistry struct {
+	db        *gorm.DB
+	sshClient *ssh.Client
+}
+
+// NewPortRegistry creates a new port registry
+func NewPortRegistry(db *gorm.DB, sshClient *ssh.Client) *PortRegistry {
+	return &PortRegistry{
+		db:        db,
+		sshClient: sshClient,
+	}
+}
+
+// ListDevicePorts returns every port held on a device
+// With scan set, ports something outside the platform listens on are listed as unmanaged
+func (r *PortRegistry) ListDevicePorts(deviceID uuid.UUID, scan bool) (*DevicePorts, error) {
+	device, err := r.getDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	managed, err := r.managedPorts(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := r.reservations(device.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DevicePorts{DeviceID: device.ID, Ports: managed, Reservations: reservations}
+	if scan {
+		listening, err := r.listeningPorts(device)
+		if err != nil {
+			result.ScanError = err.Error()
+		} else {
+			held := make(map[PortSpec]bool, len(managed))
+			for _, port := range managed {
+				held[PortSpec{Port: port.Port, Protocol: port.Protocol}] = true
+			}
+			for _, port := range listening {
+				if !held[PortSpec{Port: port.Port, Protocol: port.Protocol}] {
+					result.Ports = append(result.Ports, port)
+				}
+			}
+		}
+	}
+
+	owners := make(map[PortSpec]int)
+	for _, port := range result.Ports {
+		owners[PortSpec{Port: port.Port, Protocol: port.Protocol}]++
+	}
+	for i := range result.Ports {
+		result.Ports[i].Conflict = owners[PortSpec{Port: result.Ports[i].Port, Protocol: result.Ports[i].Protocol}] > 1
+	}
+	sort.SliceStable(result.Ports, func(i, j int) bool {
+		a, b := result.Ports[i], result.Ports[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Protocol < b.Protocol
+	})
+
+	return result, nil
+}
+
+// FindFreePort returns the first port from start that nothing on the device holds or reserves, on any protocol
+// If the device's listening ports can't be checked, only the registry is consulted
+func (r *PortRegistry) FindFreePort(device *models.Device, start int) (int, error) {
+	managed, err := r.managedPorts(device.ID)
+	if err != nil {
+		return 0, err
+	}
+	reservations, err := r.reservations(device.ID)
+	if err != nil {
+		return 0, err
+	}
+	listening, err := r.listeningPorts(device)
+	if err != nil {
+		log.Printf("[PortRegistry] Warning: Could not check listening ports on %s: %v", device.Name, err)
+	}
+
+	held := make(map[int]bool)
+	for _, port := range append(managed, listening...) {
+		held[port.Port] = true
+	}
+
+	end := min(start+portSearchRange-1, 65535)
+	for port := start; port <= end; port++ {
+		if held[port] || findReservation(reservations, port) != nil {
+			continue
+		}
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free port in %d-%d on %s", start, end, device.Name)
+}
+
+// CheckPorts returns a *PortConflictError if any of the ports is held on the device by something
+// other than the deployment, or falls in a reserved range
+func (r *PortRegistry) CheckPorts(device *models.Device, deploymentID uuid.UUID, ports []PortSpec) error {
+	conflicts, err := r.conflicts(device, deploymentID, ports, true)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &PortConflictError{Device: device.Name, Conflicts: conflicts}
+	}
+	return nil
+}
+
+// AllocateDeploymentPorts records the ports a deployment publishes on a device, replacing its previous allocation
+// Returns a *PortConflictError without changing anything if a port is held by something else
+func (r *PortRegistry) AllocateDeploymentPorts(device *models.Device, deploymentID uuid.UUID, ports []PortSpec) error {
+	return r.allocate(device, deploymentID, ports, true)
+}
+
+// RecordDeploymentPorts records ports the deployment's own containers already listen on,
+// e.g. after adopting an app, so the device's listening ports are not checked
+func (r *PortRegistry) RecordDeploymentPorts(device *models.Device, deploymentID uuid.UUID, ports []PortSpec) error {
+	return r.allocate(device, deploymentID, ports, false)
+}
+
+// ReleaseDeploymentPorts removes a deployment's port allocation
+func (r *PortRegistry) ReleaseDeploymentPorts(deploymentID uuid.UUID) error {
+	if err := r.db.Where("deployment_id = ?", deploymentID).Delete(&models.PortAllocation{}).Error; err != nil {
+		return fmt.Errorf("failed to release ports: %w", err)
+	}
+	return nil
+}
+
+// ReservePorts keeps a range of ports on a device out of use
+// The range must not overlap another reservation or include ports the platform already holds
+func (r *PortRegistry) ReservePorts(deviceID uuid.UUID, req PortReservationRequest) (*models.PortReservation, error) {
+	if req.EndPort == 0 {
+		req.EndPort = req.StartPort
+	}
+	if req.StartPort < 1 || req.EndPort > 65535 || req.StartPort > req.EndPort {
+		return nil, fmt.Errorf("invalid port range %d-%d", req.StartPort, req.EndPort)
+	}
+	if len(req.Description) > maxReservationDescriptionLength {
+		return nil, fmt.Errorf("description must be at most %d characters", maxReservationDescriptionLength)
+	}
+
+	device, err := r.getDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := r.reservations(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range reservations {
+		if req.StartPort <= existing.EndPort && existing.StartPort <= req.EndPort {
+			return nil, fmt.Errorf("ports %d-%d overlap the reservation of %d-%d", req.StartPort, req.EndPort, existing.StartPort, existing.EndPort)
+		}
+	}
+
+	managed, err := r.managedPorts(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := []DevicePort{}
+	for _, port := range managed {
+		if port.Port >= req.StartPort && port.Port <= req.EndPort {
+			conflicts = append(conflicts, port)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, &PortConflictError{Device: device.Name, Conflicts: conflicts}
+	}
+
+	reservation := &models.PortReservation{
+		DeviceID:    device.ID,
+		StartPort:   req.StartPort,
+		EndPort:     req.EndPort,
+		Description: req.Description,
+	}
+	if err := r.db.Create(reservation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create port reservation: %w", err)
+	}
+	return reservation, nil
+}
+
+// DeleteReservation removes a port reservation from a device
+func (r *PortRegistry) DeleteReservation(deviceID, reservationID uuid.UUID) error {
+	result := r.db.Where("id = ? AND device_id = ?", reservationID, deviceID).Delete(&models.PortReservation{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete port reservation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPortReservationNotFound
+	}
+	return nil
+}
+
+// allocate replaces a deployment's port allocation after checking the ports for conflicts
+func (r *PortRegistry) allocate(device *models.Device, deploymentID uuid.UUID, ports []PortSpec, scanHost bool) error {
+	conflicts, err := r.conflicts(device, deploymentID, ports, scanHost)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &PortConflictError{Device: device.Name, Conflicts: conflicts}
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deployment_id = ?", deploymentID).Delete(&models.PortAllocation{}).Error; err != nil {
+			return fmt.Errorf("failed to release previous ports: %w", err)
+		}
+		seen := make(map[PortSpec]bool, len(ports))
+		for _, spec := range ports {
+			if seen[spec] {
+				continue
+			}
+			seen[spec] = true
+			allocation := &models.PortAllocation{DeviceID: device.ID, Port: spec.Port, Protocol: spec.Protocol, DeploymentID: deploymentID}
+			if err := tx.Create(allocation).Error; err != nil {
+				return fmt.Errorf("failed to allocate port %d/%s: %w", spec.Port, spec.Protocol, err)
+			}
+		}
+		return nil
+	})
+}
+
+// conflicts returns the requested ports that are held on the device by something other than the deployment
+// With scanHost set, ports not already allocated to the deployment are also checked against the device's
+// listening sockets; if that check fails it is skipped
+func (r *PortRegistry) conflicts(device *models.Device, deploymentID uuid.UUID, ports []PortSpec, scanHost bool) ([]DevicePort, error) {
+	managed, err := r.managedPorts(device.ID)
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := r.reservations(device.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[PortSpec]DevicePort, len(managed))
+	own := make(map[PortSpec]bool)
+	for _, port := range managed {
+		spec := PortSpec{Port: port.Port, Protocol: port.Protocol}
+		if port.OwnerType == PortOwnerDeployment && *port.OwnerID == deploymentID {
+			own[spec] = true
+			continue
+		}
+		owners[spec] = port
+	}
+
+	var listening map[PortSpec]DevicePort
+	conflicts := []DevicePort{}
+	for _, spec := range ports {
+		if owner, ok := owners[spec]; ok {
+			conflicts = append(conflicts, owner)
+			continue
+		}
+		if reservation := findReservation(reservations, spec.Port); reservation != nil {
+			id := reservation.ID
+			conflicts = append(conflicts, DevicePort{Port: spec.Port, Protocol: spec.Protocol, OwnerType: PortOwnerReserved, OwnerID: &id, OwnerName: reservation.Description})
+			continue
+		}
+		if !scanHost || own[spec] {
+			continue
+		}
+
+		if listening == nil {
+			ports, err := r.listeningPorts(device)
+			if err != nil {
+				log.Printf("[PortRegistry] Warning: Could not check listening ports on %s: %v", device.Name, err)
+				scanHost = false
+				continue
+			}
+			listening = make(map[PortSpec]DevicePort, len(ports))
+			for _, port := range ports {
+				listening[PortSpec{Port: port.Port, Protocol: port.Protocol}] = port
+			}
+		}
+		if port, ok := listening[spec]; ok {
+			conflicts = append(conflicts, port)
+		}
+	}
+	return conflicts, nil
+}
+
+// managedPorts returns the ports the platform holds on a device
+func (r *PortRegistry) managedPorts(deviceID uuid.UUID) ([]DevicePort, error) {
+	ports := []DevicePort{}
+
+	var allocations []models.PortAllocation
+	if err := r.db.Where("device_id = ?", deviceID).Find(&allocations).Error; err != nil {
+		return nil, fmt.Errorf("failed to query port allocations: %w", err)
+	}
+	if len(allocations) > 0 {
+		ids := make([]uuid.UUID, len(allocations))
+		for i, allocation := range allocations {
+			ids[i] = allocation.DeploymentID
+		}
+		var deployments []models.Deployment
+		if err := r.db.Select("id", "compose_project").Where("id IN ?", ids).Find(&deployments).Error; err != nil {
+			return nil, fmt.Errorf("failed to query deployments: %w", err)
+		}
+		names := make(map[uuid.UUID]string, len(deployments))
+		for _, deployment := range deployments {
+			names[deployment.ID] = deployment.ComposeProject
+		}
+		for _, allocation := range allocations {
+			id := allocation.DeploymentID
+			ports = append(ports, DevicePort{Port: allocation.Port, Protocol: allocation.Protocol, OwnerType: PortOwnerDeployment, OwnerID: &id, OwnerName: names[id]})
+		}
+	}
+
+	var databases []models.SharedDatabaseInstance
+	if err := r.db.Where("device_id = ?", deviceID).Find(&databases).Error; err != nil {
+		return nil, fmt.Errorf("failed to query shared database instances: %w", err)
+	}
+	for _, instance := range databases {
+		id := instance.ID
+		ports = append(ports, DevicePort{Port: instance.Port, Protocol: "tcp", OwnerType: PortOwnerSharedDatabase, OwnerID: &id, OwnerName: instance.ContainerName})
+	}
+
+	var caches []models.SharedCacheInstance
+	if err := r.db.Where("device_id = ?", deviceID).Find(&caches).Error; err != nil {
+		return nil, fmt.Errorf("failed to query shared cache instances: %w", err)
+	}
+	for _, instance := range caches {
+		id := instance.ID
+		ports = append(ports, DevicePort{Port: instance.Port, Protocol: "tcp", OwnerType: PortOwnerSharedCache, OwnerID: &id, OwnerName: instance.ContainerName})
+	}
+
+	var dedicated []models.DedicatedInstance
+	if err := r.db.Where("device_id = ?", deviceID).Find(&dedicated).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dedicated instances: %w", err)
+	}
+	for _, instance := range dedicated {
+		id := instance.ID
+		ports = append(ports, DevicePort{Port: instance.Port, Protocol: "tcp", OwnerType: PortOwnerDedicatedInstance, OwnerID: &id, OwnerName: instance.ContainerName})
+	}
+
+	return ports, nil
+}
+
+// reservations returns a device's port reservations ordered by start port
+func (r *PortRegistry) reservations(deviceID uuid.UUID) ([]models.PortReservation, error) {
+	reservations := []models.PortReservation{}
+	if err := r.db.Where("device_id = ?", deviceID).Order("start_port").Find(&reservations).Error; err != nil {
+		return nil, fmt.Errorf("failed to query port reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+// listeningPorts lists the TCP and UDP ports something listens on on the device
+func (r *PortRegistry) listeningPorts(device *models.Device) ([]DevicePort, error) {
+	if r.sshClient == nil {
+		return nil, fmt.Errorf("SSH client not available")
+	}
+	// -p needs root to show other users' processes; fall back to plain output where ss rejects it
+	output, err := r.sshClient.ExecuteWithTimeout(device.GetSSHHost(), "ss -Htulnp 2>/dev/null || ss -tuln", 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listening ports on %s: %w", device.Name, err)
+	}
+	return parseListeningPorts(output), nil
+}
+
+// getDevice loads a device by ID
+func (r *PortRegistry) getDevice(deviceID uuid.UUID) (*models.Device, error) {
+	var device models.Device
+	if err := r.db.First(&device, "id = ?", deviceID).Error; err != nil {
+		return nil, fmt.Errorf("device not found: %w", err)
+	}
+	return &device, nil
+}
+
+// parseListeningPorts parses "ss -tuln" output, with or without the process column, into unmanaged ports
+// A port bound on several addresses is listed once
+func parseListeningPorts(output string) []DevicePort {
+	ports := []DevicePort{}
+	seen := make(map[PortSpec]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || (fields[0] != "tcp" && fields[0] != "udp") {
+			continue
+		}
+
+		local := fields[4]
+		port, err := strconv.Atoi(local[strings.LastIndex(local, ":")+1:])
+		if err != nil || port < 1 || port > 65535 {
+			continue
+		}
+		spec := PortSpec{Port: port, Protocol: fields[0]}
+		if seen[spec] {
+			continue
+		}
+		seen[spec] = true
+
+		devicePort := DevicePort{Port: port, Protocol: fields[0], OwnerType: PortOwnerUnmanaged}
+		if match := ssProcessRegex.FindStringSubmatch(line); match != nil {
+			devicePort.OwnerName = match[1]
+		}
+		ports = append(ports, devicePort)
+	}
+	return ports
+}
+
+// findReservation returns the reservation containing port, if any
+func findReservation(reservations []models.PortReservation, port int) *models.PortReservation {
+	for i := range reservations {
+		if reservations[i].Contains(port) {
+			return &reservations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListeningPorts(t *testing.T) {
+	output := `Netid State  Recv-Q Send-Q Local Address:Port Peer Address:Port Process
+udp   UNCONN 0      0            0.0.0.0:53        0.0.0.0:*     users:(("dnsmasq",pid=612,fd=4))
+tcp   LISTEN 0      4096         0.0.0.0:22        0.0.0.0:*     users:(("sshd",pid=700,fd=3))
+tcp   LISTEN 0      4096            [::]:22           [::]:*     users:(("sshd",pid=700,fd=4))
+tcp   LISTEN 0      511        127.0.0.1:8443      0.0.0.0:*
+tcp   LISTEN 0      4096   [fe80::1]%eth0:9100        [::]:*
+`
+
+	assert.Equal(t, []DevicePort{
+		{Port: 53, Protocol: "udp", OwnerType: PortOwnerUnmanaged, OwnerName: "dnsmasq"},
+		{Port: 22, Protocol: "tcp", OwnerType: PortOwnerUnmanaged, OwnerName: "sshd"},
+		{Port: 8443, Protocol: "tcp", OwnerType: PortOwnerUnmanaged},
+		{Port: 9100, Protocol: "tcp", OwnerType: PortOwnerUnmanaged},
+	}, parseListeningPorts(output))
+	assert.Empty(t, parseListeningPorts(""))
+}
+
+func TestPortRegistry_AllocateDeploymentPorts(t *testing.T) {
+	db := setupTestDB(t)
+	registry := NewPortRegistry(db, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	nextcloud := &models.Deployment{RecipeSlug: "nextcloud", DeviceID: device.ID, ComposeProject: "nextcloud-abc123"}
+	require.NoError(t, db.Create(nextcloud).Error)
+	require.NoError(t, db.Create(&models.SharedCacheInstance{DeviceID: device.ID, Engine: "redis", Version: "7", Name: "shared-redis",
+		Port: 6379, ContainerName: "homelab-redis-shared", MasterPassword: "x"}).Error)
+	_, err := registry.ReservePorts(device.ID, PortReservationRequest{StartPort: 9000, EndPort: 9010, Description: "game servers"})
+	require.NoError(t, err)
+
+	tcp := func(port int) []PortSpec { return []PortSpec{{Port: port, Protocol: "tcp"}} }
+	require.NoError(t, registry.AllocateDeploymentPorts(device, nextcloud.ID, tcp(8081)))
+
+	other := uuid.New()
+	err = registry.AllocateDeploymentPorts(device, other, tcp(8081))
+	var conflict *PortConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, "ports already in use on server-1: 8081/tcp (deployment nextcloud-abc123)", err.Error())
+
+	err = registry.AllocateDeploymentPorts(device, other, tcp(6379))
+	assert.EqualError(t, err, "ports already in use on server-1: 6379/tcp (shared cache homelab-redis-shared)")
+	err = registry.AllocateDeploymentPorts(device, other, tcp(9005))
+	assert.EqualError(t, err, "ports already in use on server-1: 9005/tcp (reserved: game servers)")
+
+	// The same port on another protocol or another device is free
+	require.NoError(t, registry.AllocateDeploymentPorts(device, other, []PortSpec{{Port: 8081, Protocol: "udp"}}))
+	otherDevice := &models.Device{Name: "server-2", LocalIPAddress: "192.168.1.21"}
+	require.NoError(t, db.Create(otherDevice).Error)
+	require.NoError(t, registry.AllocateDeploymentPorts(otherDevice, uuid.New(), tcp(8081)))
+
+	// Allocating again replaces the deployment's previous ports
+	require.NoError(t, registry.AllocateDeploymentPorts(device, nextcloud.ID, tcp(8082)))
+	require.NoError(t, registry.AllocateDeploymentPorts(device, uuid.New(), tcp(8081)))
+
+	require.NoError(t, registry.ReleaseDeploymentPorts(nextcloud.ID))
+	var count int64
+	db.Model(&models.PortAllocation{}).Where("deployment_id = ?", nextcloud.ID).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestPortRegistry_FindFreePort(t *testing.T) {
+	db := setupTestDB(t)
+	registry := NewPortRegistry(db, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	require.NoError(t, registry.AllocateDeploymentPorts(device, uuid.New(), []PortSpec{{Port: 8080, Protocol: "udp"}}))
+	_, err := registry.ReservePorts(device.ID, PortReservationRequest{StartPort: 8081, EndPort: 8082})
+	require.NoError(t, err)
+
+	// Without an SSH client only the registry is consulted
+	port, err := registry.FindFreePort(device, 8080)
+	require.NoError(t, err)
+	assert.Equal(t, 8083, port)
+
+	_, err = registry.ReservePorts(device.ID, PortReservationRequest{StartPort: 65500, EndPort: 65535})
+	require.NoError(t, err)
+	_, err = registry.FindFreePort(device, 65500)
+	assert.EqualError(t, err, "no free port in 65500-65535 on server-1")
+}
+
+func TestPortRegistry_ReservePorts(t *testing.T) {
+	db := setupTestDB(t)
+	registry := NewPortRegistry(db, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	require.NoError(t, registry.AllocateDeploymentPorts(device, uuid.New(), []PortSpec{{Port: 8080, Protocol: "tcp"}}))
+
+	for _, req := range []PortReservationRequest{{StartPort: 0}, {StartPort: 9010, EndPort: 9000}, {StartPort: 65535, EndPort: 65536}} {
+		_, err := registry.ReservePorts(device.ID, req)
+		assert.Error(t, err, "%+v", req)
+	}
+
+	single, err := registry.ReservePorts(device.ID, PortReservationRequest{StartPort: 9000})
+	require.NoError(t, err)
+	assert.Equal(t, 9000, single.EndPort)
+
+	_, err = registry.ReservePorts(device.ID, PortReservationRequest{StartPort: 8990, EndPort: 9000})
+	assert.EqualError(t, err, "ports 8990-9000 overlap the reservation of 9000-9000")
+
+	_, err = registry.ReservePorts(device.ID, PortReservationRequest{StartPort: 8000, EndPort: 8100})
+	var conflict *PortConflictError
+	assert.True(t, errors.As(err, &conflict), "ports the platform holds can't be reserved")
+
+	_, err = registry.ReservePorts(uuid.New(), PortReservationRequest{StartPort: 9000})
+	assert.Error(t, err)
+
+	assert.ErrorIs(t, registry.DeleteReservation(uuid.New(), single.ID), ErrPortReservationNotFound)
+	require.NoError(t, registry.DeleteReservation(device.ID, single.ID))
+	assert.ErrorIs(t, registry.DeleteReservation(device.ID, single.ID), ErrPortReservationNotFound)
+}
+
+func TestPortRegistry_ListDevicePorts(t *testing.T) {
+	db := setupTestDB(t)
+	registry := NewPortRegistry(db, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	postgres := &models.SharedDatabaseInstance{DeviceID: device.ID, Engine: "postgres", Version: "16", Status: "running",
+		ContainerName: "homelab-postgres-shared", ComposeProject: "homelab-postgres-shared", Port: 5432, InternalPort: 5432,
+		MasterUsername: "postgres", CredentialKey: "shared-postgres-master"}
+	require.NoError(t, db.Create(postgres).Error)
+	wiki := &models.Deployment{RecipeSlug: "wiki-js", DeviceID: device.ID, ComposeProject: "wiki-js-abc123"}
+	require.NoError(t, db.Create(wiki).Error)
+	// Recorded without the conflict check, as adoption does
+	require.NoError(t, db.Create(&models.PortAllocation{DeviceID: device.ID, Port: 5432, Protocol: "tcp", DeploymentID: wiki.ID}).Error)
+	require.NoError(t, db.Create(&models.PortAllocation{DeviceID: device.ID, Port: 3000, Protocol: "tcp", DeploymentID: wiki.ID}).Error)
+
+	ports, err := registry.ListDevicePorts(device.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, "SSH client not available", ports.ScanError)
+	require.Len(t, ports.Ports, 3)
+
+	assert.Equal(t, 3000, ports.Ports[0].Port)
+	assert.Equal(t, PortOwnerDeployment, ports.Ports[0].OwnerType)
+	assert.Equal(t, "wiki-js-abc123", ports.Ports[0].OwnerName)
+	assert.False(t, ports.Ports[0].Conflict)
+	for _, port := range ports.Ports[1:] {
+		assert.Equal(t, 5432, port.Port)
+		assert.True(t, port.Conflict)
+	}
+
+	_, err = registry.ListDevicePorts(uuid.New(), false)
+	assert.Error(t, err)
+}
+
+func TestAssignRecipePorts(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	require.NoError(t, service.Ports().AllocateDeploymentPorts(device, uuid.New(), []PortSpec{{Port: 8081, Protocol: "tcp"}, {Port: 8082, Protocol: "tcp"}}))
+
+	recipe := &models.Recipe{ConfigOptions: []models.RecipeConfigOption{
+		{Name: "port", Type: "number", Default: 8081},
+		{Name: "admin_port", Type: "number"},
+		{Name: "max_upload", Type: "number", Default: 8081},
+	}}
+
+	config := map[string]interface{}{"admin_port": float64(9000)}
+	notes, err := service.assignRecipePorts(recipe, device, config)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"port": 8083, "admin_port": float64(9000)}, config)
+	assert.Equal(t, []string{"Port 8081 is held by deployment on server-1; port set to 8083"}, notes)
+
+	config = map[string]interface{}{"port": "8090"}
+	notes, err = service.assignRecipePorts(recipe, device, config)
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+	assert.Equal(t, "8090", config["port"])
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"gorm.io/gorm"
+)
+
+// remediationStableWindow is how long a deployment must stay healthy after an action before escalation resets
+const remediationStableWindow = 5 * time.Minute
+
+// DeploymentRemediator performs the actions the self-healing engine escalates through
+type DeploymentRemediator interface {
+	RestartDeployment(id string) error
+	RedeployDeployment(id string) error
+	FailDeployment(id string, reason string) error
+	LogDeploymentEvent(id string, message string)
+	IsBusy(id string) bool // A job, backup or restore is queued or running for the deployment
+}
+
+// UpdateRemediationPolicyRequest represents a request to change a deployment's self-healing policy
+type UpdateRemediationPolicyRequest struct {
+	Enabled           *bool `json:"enabled,omitempty"`
+	MaxRestarts       *int  `json:"max_restarts,omitempty" validate:"omitempty,min=0,max=20"`
+	MaxRedeploys      *int  `json:"max_redeploys,omitempty" validate:"omitempty,min=0,max=10"`
+	BackoffSeconds    *int  `json:"backoff_seconds,omitempty" validate:"omitempty,min=5,max=3600"`
+	MaxBackoffSeconds *int  `json:"max_backoff_seconds,omitempty" validate:"omitempty,min=5,max=86400"`
+}
+
+// RemediationService restarts, redeploys and finally fails deployments whose containers are unhealthy
+// It watches ContainerOrchestrator.HealthCheck results and the "unhealthy" status set by the health monitor
+// Swarm stacks are left to Swarm, which reschedules failed tasks itself
+type RemediationService struct {
+	db            *gorm.DB
+	orchestrator  ContainerOrchestrator // Compose; checks the deployments' compose projects
+	remediator    DeploymentRemediator
+	wsHub         WSHub
+	checkInterval time.Duration
+	cancel        context.CancelFunc
+}
+
+// NewRemediationService creates a new self-healing service
+func NewRemediationService(db *gorm.DB, orchestrator ContainerOrchestrator, remediator DeploymentRemediator, wsHub WSHub) *RemediationService {
+	return &RemediationService{
+		db:            db,
+		orchestrator:  orchestrator,
+		remediator:    remediator,
+		wsHub:         wsHub,
+		checkInterval: 30 * time.Second,
+	}
+}
+
+// Start begins the background remediation loop
+func (s *RemediationService) Start(ctx context.Context) {
+	log.Println("[Remediation] Starting self-healing service")
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	ticker := time.NewTicker(s.checkInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Println("[Remediation] Self-healing service stopped")
+				return
+			case <-ticker.C:
+				s.CheckAll(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the background remediation loop
+func (s *RemediationService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// GetPolicy returns a deployment's remediation policy, creating the default policy if none exists
+func (s *RemediationService) GetPolicy(deploymentID uuid.UUID) (*models.RemediationPolicy, error) {
+	var deployment models.Deployment
+	if err := s.db.First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		return nil, fmt.Errorf("deployment not found: %w", err)
+	}
+	return s.getOrCreatePolicy(deploymentID)
+}
+
+// UpdatePolicy changes a deployment's remediation policy
+func (s *RemediationService) UpdatePolicy(deploymentID uuid.UUID, req UpdateRemediationPolicyRequest) (*models.RemediationPolicy, error) {
+	policy, err := s.GetPolicy(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.MaxRestarts != nil {
+		policy.MaxRestarts = *req.MaxRestarts
+	}
+	if req.MaxRedeploys != nil {
+		policy.MaxRedeploys = *req.MaxRedeploys
+	}
+	if req.BackoffSeconds != nil {
+		policy.BackoffSeconds = *req.BackoffSeconds
+	}
+	if req.MaxBackoffSeconds != nil {
+		policy.MaxBackoffSeconds = *req.MaxBackoffSeconds
+	}
+	if policy.MaxBackoffSeconds < policy.BackoffSeconds {
+		return nil, fmt.Errorf("max_backoff_seconds (%d) cannot be less than backoff_seconds (%d)", policy.MaxBackoffSeconds, policy.BackoffSeconds)
+	}
+
+	// Save writes zero values too (e.g., enabled=false, max_redeploys=0)
+	if err := s.db.Save(policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to save remediation policy: %w", err)
+	}
+	return policy, nil
+}
+
+// CheckAll evaluates every running or unhealthy deployment and remediates where needed
+// Deployments are handled sequentially so a device is never restarting several stacks at once
+func (s *RemediationService) CheckAll(ctx context.Context) {
+	var deployments []models.Deployment
+	if err := s.db.Preload("Device").Where("status IN ?", monitoredStatuses).Find(&deployments).Error; err != nil {
+		log.Printf("[Remediation] Error fetching deployments: %v", err)
+		return
+	}
+
+	for i := range deployments {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.CheckDeployment(ctx, &deployments[i]); err != nil {
+			log.Printf("[Remediation] Check failed for %s: %v", deployments[i].ComposeProject, err)
+		}
+	}
+}
+
+// CheckDeployment evaluates a single deployment and takes the next remediation step if it is unhealthy
+func (s *RemediationService) CheckDeployment(ctx context.Context, deployment *models.Deployment) error {
+	if deployment.Device == nil {
+		return fmt.Errorf("deployment has no device loaded")
+	}
+	if deployment.IsSwarmStack() {
+		return nil
+	}
+
+	policy, err := s.getOrCreatePolicy(deployment.ID)
+	if err != nil {
+		return err
+	}
+	if !policy.Enabled {
+		return nil
+	}
+	// Upgrades, migrations and backups stop containers on purpose; acting now would race them
+	if s.remediator.IsBusy(deployment.ID.String()) {
+		return nil
+	}
+
+	status, err := s.orchestrator.HealthCheck(ctx, deployment.ComposeProject, deployment.Device.GetSSHHost())
+	if err != nil {
+		// Unreachable devices are the device health check's concern, not the app's
+		return fmt.Errorf("health check failed: %w", err)
+	}
+
+	// Health checks still settling say nothing either way; wait for them instead of acting
+	if status.Running && status.Starting && deployment.Status != models.DeploymentStatusUnhealthy {
+		return nil
+	}
+
+	now := time.Now()
+	healthy := status.Running && status.Healthy && deployment.Status != models.DeploymentStatusUnhealthy
+	if healthy {
+		// A restart clears the unhealthy status straight away, so only trust recovery
+		// once the deployment has stayed healthy for a while
+		if policy.LastActionAt != nil && now.Sub(*policy.LastActionAt) < remediationStableWindow {
+			return nil
+		}
+		return s.resetPolicy(deployment, policy)
+	}
+
+	if policy.NextAttemptAt != nil && now.Before(*policy.NextAttemptAt) {
+		return nil
+	}
+
+	reason := status.Message
+	if deployment.Status == models.DeploymentStatusUnhealthy && deployment.ErrorDetails != "" {
+		reason = deployment.ErrorDetails
+	}
+
+	return s.escalate(deployment, policy, reason, now)
+}
+
+// escalate performs the next action in the restart -> redeploy -> fail chain
+func (s *RemediationService) escalate(deployment *models.Deployment, policy *models.RemediationPolicy, reason string, now time.Time) error {
+	id := deployment.ID.String()
+
+	var action models.RemediationAction
+	var actionErr error
+	var attempt, limit int
+
+	switch {
+	case policy.RestartAttempts < policy.MaxRestarts:
+		action = models.RemediationActionRestart
+		policy.RestartAttempts++
+		attempt, limit = policy.RestartAttempts, policy.MaxRestarts
+		s.remediator.LogDeploymentEvent(id, fmt.Sprintf("🩹 Self-healing: %s; restarting containers (attempt %d/%d)", reason, attempt, limit))
+		actionErr = s.remediator.RestartDeployment(id)
+
+	case policy.RedeployAttempts < policy.MaxRedeploys:
+		action = models.RemediationActionRedeploy
+		policy.RedeployAttempts++
+		attempt, limit = policy.RedeployAttempts, policy.MaxRedeploys
+		s.remediator.LogDeploymentEvent(id, fmt.Sprintf("🩹 Self-healing: %s; redeploying from stored compose file (attempt %d/%d)", reason, attempt, limit))
+		actionErr = s.remediator.RedeployDeployment(id)
+
+	default:
+		action = models.RemediationActionFail
+		failure := fmt.Sprintf("Self-healing gave up after %d restart(s) and %d redeploy(s): %s", policy.RestartAttempts, policy.RedeployAttempts, reason)
+		actionErr = s.remediator.FailDeployment(id, failure)
+	}
+
+	policy.LastAction = action
+	policy.LastActionAt = &now
+	next := now.Add(remediationBackoff(policy))
+	policy.NextAttemptAt = &next
+	if err := s.db.Save(policy).Error; err != nil {
+		return fmt.Errorf("failed to save remediation state: %w", err)
+	}
+
+	if actionErr != nil {
+		log.Printf("[Remediation] %s of %s failed: %v", action, deployment.ComposeProject, actionErr)
+		if action != models.RemediationActionFail {
+			s.remediator.LogDeploymentEvent(id, fmt.Sprintf("⚠️  Self-healing %s failed: %v", action, actionErr))
+		}
+	} else {
+		log.Printf("[Remediation] %s of %s (%s)", action, deployment.ComposeProject, reason)
+	}
+
+	event := map[string]interface{}{
+		"id":      deployment.ID,
+		"name":    deployment.RecipeName,
+		"action":  action,
+		"attempt": attempt,
+		"limit":   limit,
+		"reason":  reason,
+		"success": actionErr == nil,
+	}
+	if actionErr != nil {
+		event["error"] = actionErr.Error()
+	}
+	s.broadcast("deployment:remediation", event)
+
+	// Giving up is what a human needs to hear about
+	if action == models.RemediationActionFail {
+		s.broadcast("deployment:alert", map[string]interface{}{
+			"id":       deployment.ID,
+			"name":     deployment.RecipeName,
+			"severity": "critical",
+			"message":  fmt.Sprintf("%s could not be healed automatically and was marked failed", deployment.RecipeName),
+			"reason":   reason,
+		})
+	}
+
+	return actionErr
+}
+
+// resetPolicy clears escalation state once a deployment is healthy again
+func (s *RemediationService) resetPolicy(deployment *models.Deployment, policy *models.RemediationPolicy) error {
+	if policy.TotalAttempts() == 0 && policy.NextAttemptAt == nil {
+		return nil
+	}
+
+	attempts := policy.TotalAttempts()
+	policy.RestartAttempts = 0
+	policy.RedeployAttempts = 0
+	policy.NextAttemptAt = nil
+	if err := s.db.Save(policy).Error; err != nil {
+		return fmt.Errorf("failed to reset remediation state: %w", err)
+	}
+
+	if attempts > 0 {
+		s.remediator.LogDeploymentEvent(deployment.ID.String(), fmt.Sprintf("✓ Self-healing: deployment recovered after %d action(s)", attempts))
+		s.broadcast("deployment:remediation", map[string]interface{}{
+			"id":      deployment.ID,
+			"name":    deployment.RecipeName,
+			"action":  "recovered",
+			"success": true,
+		})
+	}
+	return nil
+}
+
+// getOrCreatePolicy loads a deployment's policy, creating one with defaults on first use
+func (s *RemediationService) getOrCreatePolicy(deploymentID uuid.UUID) (*models.RemediationPolicy, error) {
+	var policy models.RemediationPolicy
+	err := s.db.Where("deployment_id = ?", deploymentID).First(&policy).Error
+	if err == nil {
+		return &policy, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load remediation policy: %w", err)
+	}
+
+	policy = models.RemediationPolicy{
+		DeploymentID:      deploymentID,
+		Enabled:           true,
+		MaxRestarts:       3,
+		MaxRedeploys:      1,
+		BackoffSeconds:    30,
+		MaxBackoffSeconds: 900,
+	}
+	if err := s.db.Create(&policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to create remediation policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// broadcast sends a remediation event on the deployments channel
+func (s *RemediationService) broadcast(event string, data map[string]interface{}) {
+	if s.wsHub != nil {
+		s.wsHub.Broadcast("deployments", event, data)
+	}
+}
+
+// remediationBackoff returns the wait before the next action: BackoffSeconds doubled per attempt, capped
+func remediationBackoff(policy *models.RemediationPolicy) time.Duration {
+	backoff := time.Duration(policy.BackoffSeconds) * time.Second
+	maxBackoff := time.Duration(policy.MaxBackoffSeconds) * time.Second
+	for i := 1; i < policy.TotalAttempts() && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
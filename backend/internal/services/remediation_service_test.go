@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubHealthOrchestrator returns a fixed health status; other orchestrator methods are unused
+type stubHealthOrchestrator struct {
+	ContainerOrchestrator
+	status HealthStatus
+	err    error
+}
+
+func (o *stubHealthOrchestrator) HealthCheck(ctx context.Context, stackName string, host string) (HealthStatus, error) {
+	return o.status, o.err
+}
+
+type mockRemediator struct {
+	actions    []string
+	logs       []string
+	restartErr error
+	busy       bool
+}
+
+func (m *mockRemediator) RestartDeployment(id string) error {
+	m.actions = append(m.actions, "restart")
+	return m.restartErr
+}
+
+func (m *mockRemediator) RedeployDeployment(id string) error {
+	m.actions = append(m.actions, "redeploy")
+	return nil
+}
+
+func (m *mockRemediator) FailDeployment(id string, reason string) error {
+	m.actions = append(m.actions, "fail")
+	return nil
+}
+
+func (m *mockRemediator) LogDeploymentEvent(id string, message string) {
+	m.logs = append(m.logs, message)
+}
+
+func (m *mockRemediator) IsBusy(id string) bool {
+	return m.busy
+}
+
+func setupRemediationTest(t *testing.T, status HealthStatus) (*RemediationService, *mockRemediator, *recordingHub, *models.Deployment) {
+	db := setupTestDB(t)
+	remediator := &mockRemediator{}
+	hub := &recordingHub{}
+	service := NewRemediationService(db, &stubHealthOrchestrator{status: status}, remediator, hub)
+
+	device := &models.Device{Name: "server-1", LocalIPAddress: "192.168.1.20"}
+	require.NoError(t, db.Create(device).Error)
+	deployment := &models.Deployment{RecipeSlug: "app", RecipeName: "App", ComposeProject: "app-1", DeviceID: device.ID, Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(deployment).Error)
+	deployment.Device = device
+
+	return service, remediator, hub, deployment
+}
+
+// expireBackoff makes the next remediation attempt due immediately
+func expireBackoff(t *testing.T, service *RemediationService, deployment *models.Deployment) {
+	past := time.Now().Add(-time.Second)
+	require.NoError(t, service.db.Model(&models.RemediationPolicy{}).Where("deployment_id = ?", deployment.ID).Update("next_attempt_at", past).Error)
+}
+
+func TestRemediationService_EscalationOrder(t *testing.T) {
+	service, remediator, hub, deployment := setupRemediationTest(t, HealthStatus{Running: false, Message: "0/1 containers running"})
+	ctx := context.Background()
+
+	_, err := service.UpdatePolicy(deployment.ID, UpdateRemediationPolicyRequest{MaxRestarts: intPtr(2)})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, service.CheckDeployment(ctx, deployment))
+		expireBackoff(t, service, deployment)
+	}
+
+	assert.Equal(t, []string{"restart", "restart", "redeploy", "fail", "fail"}, remediator.actions)
+	assert.Contains(t, remediator.logs[0], "attempt 1/2")
+	assert.Contains(t, remediator.logs[2], "redeploying")
+	assert.Contains(t, hub.events, "deployments:deployment:alert")
+
+	policy, err := service.GetPolicy(deployment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RemediationActionFail, policy.LastAction)
+	assert.Equal(t, 2, policy.RestartAttempts)
+	assert.Equal(t, 1, policy.RedeployAttempts)
+}
+
+func TestRemediationService_RespectsBackoff(t *testing.T) {
+	service, remediator, _, deployment := setupRemediationTest(t, HealthStatus{Running: true, Healthy: false})
+	ctx := context.Background()
+
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Equal(t, []string{"restart"}, remediator.actions, "second check is within the backoff window")
+
+	policy, err := service.GetPolicy(deployment.ID)
+	require.NoError(t, err)
+	require.NotNil(t, policy.NextAttemptAt)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), *policy.NextAttemptAt, 5*time.Second)
+}
+
+func TestRemediationService_ResetsAfterStableRecovery(t *testing.T) {
+	service, remediator, hub, deployment := setupRemediationTest(t, HealthStatus{Running: true, Healthy: true})
+	ctx := context.Background()
+
+	// Unhealthy status from the HTTP health monitor triggers remediation even if containers are up
+	deployment.Status = models.DeploymentStatusUnhealthy
+	deployment.ErrorDetails = "HTTP 503 from /health"
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	require.Equal(t, []string{"restart"}, remediator.actions)
+	assert.Contains(t, remediator.logs[0], "HTTP 503")
+
+	// Healthy straight after the restart does not reset escalation yet
+	deployment.Status = models.DeploymentStatusRunning
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	policy, err := service.GetPolicy(deployment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, policy.RestartAttempts)
+
+	// Once stable for the window, counters reset
+	longAgo := time.Now().Add(-remediationStableWindow - time.Minute)
+	require.NoError(t, service.db.Model(policy).Update("last_action_at", longAgo).Error)
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+
+	policy, err = service.GetPolicy(deployment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, policy.TotalAttempts())
+	assert.Nil(t, policy.NextAttemptAt)
+	assert.Contains(t, remediator.logs[len(remediator.logs)-1], "recovered")
+	assert.Equal(t, "deployments:deployment:remediation", hub.events[len(hub.events)-1])
+}
+
+func TestRemediationService_SkipsDisabledAndUnreachable(t *testing.T) {
+	service, remediator, _, deployment := setupRemediationTest(t, HealthStatus{Running: false})
+	ctx := context.Background()
+
+	_, err := service.UpdatePolicy(deployment.ID, UpdateRemediationPolicyRequest{Enabled: boolPtr(false)})
+	require.NoError(t, err)
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Empty(t, remediator.actions)
+
+	_, err = service.UpdatePolicy(deployment.ID, UpdateRemediationPolicyRequest{Enabled: boolPtr(true)})
+	require.NoError(t, err)
+	service.orchestrator = &stubHealthOrchestrator{err: errors.New("ssh: connection refused")}
+	assert.Error(t, service.CheckDeployment(ctx, deployment))
+	assert.Empty(t, remediator.actions)
+}
+
+func TestRemediationService_SkipsBusyDeploymentsAndSwarmStacks(t *testing.T) {
+	service, remediator, _, deployment := setupRemediationTest(t, HealthStatus{Running: false, Message: "0/1 containers running"})
+	ctx := context.Background()
+
+	// An upgrade, migration or backup has the containers stopped on purpose
+	remediator.busy = true
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Empty(t, remediator.actions)
+
+	remediator.busy = false
+	deployment.Orchestrator = models.DeploymentOrchestratorSwarm
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Empty(t, remediator.actions, "Swarm reschedules its own tasks")
+
+	deployment.Orchestrator = models.DeploymentOrchestratorCompose
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Equal(t, []string{"restart"}, remediator.actions)
+}
+
+func TestDeploymentService_IsBusy(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, nil)
+	backups := NewBackupService(db, nil, NewMockRecipeLoader(nil), nil)
+	service.SetBackupService(backups)
+
+	deployment := &models.Deployment{RecipeSlug: "app", ComposeProject: "app-1", DeviceID: uuid.New(), Status: models.DeploymentStatusRunning}
+	require.NoError(t, db.Create(deployment).Error)
+	assert.False(t, service.IsBusy(deployment.ID.String()))
+
+	require.True(t, backups.tryLock(deployment.ID))
+	assert.True(t, service.IsBusy(deployment.ID.String()), "a backup or restore is in flight")
+	backups.unlock(deployment.ID)
+
+	require.NoError(t, db.Create(&models.DeploymentJob{DeploymentID: deployment.ID, DeviceID: deployment.DeviceID,
+		Type: models.DeploymentJobUpgrade, Status: models.DeploymentJobQueued}).Error)
+	assert.True(t, service.IsBusy(deployment.ID.String()), "an upgrade is queued")
+}
+
+func TestRemediationService_MultiContainerStack(t *testing.T) {
+	ctx := context.Background()
+
+	// A healthy multi-container stack prints one marker per container
+	status := parseComposeHealth("Up 5 minutes (healthy)\nUp 5 minutes (healthy)\nUp 5 minutes\n", HealthStatus{})
+	service, remediator, _, deployment := setupRemediationTest(t, status)
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Empty(t, remediator.actions)
+
+	// A container still starting leaves health unknown rather than unhealthy
+	service.orchestrator = &stubHealthOrchestrator{status: parseComposeHealth("Up 5 minutes (healthy)\nUp 3 seconds (health: starting)", HealthStatus{})}
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Empty(t, remediator.actions)
+
+	// One failing container is enough to act on
+	service.orchestrator = &stubHealthOrchestrator{status: parseComposeHealth("Up 5 minutes (healthy)\nUp 5 minutes (unhealthy)", HealthStatus{})}
+	require.NoError(t, service.CheckDeployment(ctx, deployment))
+	assert.Equal(t, []string{"restart"}, remediator.actions)
+	assert.Contains(t, remediator.logs[0], "1 of 2 containers are unhealthy")
+}
+
+func TestRemediationBackoff(t *testing.T) {
+	policy := &models.RemediationPolicy{BackoffSeconds: 30, MaxBackoffSeconds: 100}
+
+	policy.RestartAttempts = 1
+	assert.Equal(t, 30*time.Second, remediationBackoff(policy))
+	policy.RestartAttempts = 2
+	assert.Equal(t, 60*time.Second, remediationBackoff(policy))
+	policy.RestartAttempts = 3
+	assert.Equal(t, 100*time.Second, remediationBackoff(policy), "capped at MaxBackoffSeconds")
+}
+
+func TestRemediationService_UpdatePolicyValidation(t *testing.T) {
+	service, _, _, deployment := setupRemediationTest(t, HealthStatus{})
+
+	_, err := service.UpdatePolicy(deployment.ID, UpdateRemediationPolicyRequest{BackoffSeconds: intPtr(600), MaxBackoffSeconds: intPtr(60)})
+	assert.Error(t, err)
+
+	policy, err := service.UpdatePolicy(deployment.ID, UpdateRemediationPolicyRequest{MaxRedeploys: intPtr(0)})
+	require.NoError(t, err)
+	assert.Equal(t, 0, policy.MaxRedeploys, "zero is persisted despite the column default")
+
+	reloaded, err := service.GetPolicy(deployment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, reloaded.MaxRedeploys)
+}
+
+func intPtr(v int) *int { return &v }
+
+func boolPtr(v bool) *bool { return &v }
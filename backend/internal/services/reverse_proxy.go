@@ -0,0 +1,490 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+const (
+	traefikRecipe = "traefik"
+	caddyRecipe   = "caddy"
+	nginxRecipe   = "nginx"
+
+	caddyInternalResolver = "internal" // Caddy signs certificates with its local CA instead of ACME
+	routeMarker           = "# homelab-route"
+	proxyCommandTimeout   = 1 * time.Minute
+)
+
+var traefikHostRule = regexp.MustCompile("Host\\(`([^`]+)`\\)")
+
+// ReverseProxyProvider writes routes for one kind of reverse proxy
+// The proxy runs as a deployment of the provider's recipe on the device and is configured over SSH
+type ReverseProxyProvider interface {
+	// Recipe returns the slug of the recipe running the proxy
+	Recipe() string
+	// Labels returns the container labels configuring a deployment's route, or nil if the proxy does not read labels
+	Labels(route ProxyRoute) []string
+	// AddRoute creates or replaces a route on the proxy
+	AddRoute(device *models.Device, proxy *models.Deployment, route ProxyRoute) error
+	// RemoveRoute deletes a route by router name; a missing route is not an error
+	RemoveRoute(device *models.Device, proxy *models.Deployment, router string) error
+	// ListRoutes returns every route the proxy serves
+	ListRoutes(device *models.Device, proxy *models.Deployment) ([]ProxyRoute, error)
+	// InstallCertificate stores the certificate and key routes with the homelab-ca resolver use for a domain
+	InstallCertificate(device *models.Device, proxy *models.Deployment, domain, certPEM, keyPEM string) error
+	// RemoveCertificate deletes a domain's installed certificate; a missing certificate is not an error
+	RemoveCertificate(device *models.Device, proxy *models.Deployment, domain string) error
+}
+
+// newReverseProxyProviders returns the supported providers by recipe slug
+func newReverseProxyProviders(ssh sshExecutor) map[string]ReverseProxyProvider {
+	return map[string]ReverseProxyProvider{
+		traefikRecipe: &traefikProvider{files: routeFiles{ssh: ssh, service: "traefik", dir: "/etc/traefik/dynamic", ext: ".yml"}},
+		caddyRecipe:   &caddyProvider{files: routeFiles{ssh: ssh, service: "caddy", dir: "/etc/caddy/sites", ext: ".caddy"}},
+		nginxRecipe:   &nginxProvider{files: routeFiles{ssh: ssh, service: "nginx", dir: "/etc/nginx/conf.d", ext: ".conf"}},
+	}
+}
+
+// routeFiles keeps one config file per route in a directory of the proxy's container
+// Each file starts with a marker comment recording the route, so routes are listed without parsing proxy config
+type routeFiles struct {
+	ssh     sshExecutor
+	service string // Compose service running the proxy
+	dir     string
+	ext     string
+}
+
+// path returns the container path of a route's file
+func (f routeFiles) path(router string) string {
+	return f.dir + "/" + router + f.ext
+}
+
+// marker returns the comment line recording a route
+func (f routeFiles) marker(route ProxyRoute) string {
+	line := fmt.Sprintf("%s router=%s domain=%s upstream=%s", routeMarker, route.Router, route.Domain, route.Upstream)
+	if route.CertResolver != "" {
+		line += " cert_resolver=" + route.CertResolver
+	}
+	return line
+}
+
+// run executes a shell script inside the proxy's container, feeding it input on stdin when set
+func (f routeFiles) run(device *models.Device, proxy *models.Deployment, script, input string) (string, error) {
+	command := fmt.Sprintf(`c=$(docker ps -q --filter label=com.docker.compose.project=%s --filter label=com.docker.compose.service=%s | head -n 1); `+
+		`[ -n "$c" ] || { echo "%s container of %s is not running" >&2; exit 1; }; docker exec`,
+		shellQuote(proxy.ComposeProject), shellQuote(f.service), f.service, proxy.ComposeProject)
+	if input != "" {
+		command += " -i"
+	}
+	command += fmt.Sprintf(` "$c" sh -c %s`, shellQuote(script))
+	if input != "" {
+		command += fmt.Sprintf(" << 'EOF'\n%s\nEOF", input)
+	}
+	return f.ssh.ExecuteWithTimeout(device.GetSSHHost(), command, proxyCommandTimeout)
+}
+
+// write stores a route's file and runs apply; the file is removed again if apply fails
+func (f routeFiles) write(device *models.Device, proxy *models.Deployment, route ProxyRoute, content, apply string) error {
+	path := f.path(route.Router)
+	script := fmt.Sprintf("mkdir -p %s && cat > %s", f.dir, path)
+	if apply != "" {
+		script += fmt.Sprintf(" && { %s || { rm -f %s; exit 1; }; }", apply, path)
+	}
+	output, err := f.run(device, proxy, script, f.marker(route)+"\n"+content)
+	if err != nil {
+		return fmt.Errorf("failed to add route %s: %w (output: %s)", route.Router, err, output)
+	}
+	return nil
+}
+
+// put writes a file readable only by the proxy's user, such as a private key, then runs apply if set
+func (f routeFiles) put(device *models.Device, proxy *models.Deployment, path, content, apply string) error {
+	dir := path[:strings.LastIndex(path, "/")]
+	script := fmt.Sprintf("mkdir -p %s && umask 077 && cat > %s", dir, path)
+	if apply != "" {
+		script += " && " + apply
+	}
+	output, err := f.run(device, proxy, script, strings.TrimRight(content, "\n"))
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w (output: %s)", path, err, output)
+	}
+	return nil
+}
+
+// remove deletes a route's file and runs apply
+func (f routeFiles) remove(device *models.Device, proxy *models.Deployment, router, apply string) error {
+	script := "rm -f " + f.path(router)
+	if apply != "" {
+		script += " && " + apply
+	}
+	output, err := f.run(device, proxy, script, "")
+	if err != nil {
+		return fmt.Errorf("failed to remove route %s: %w (output: %s)", router, err, output)
+	}
+	return nil
+}
+
+// removePath deletes a file or directory in the proxy's container
+func (f routeFiles) removePath(device *models.Device, proxy *models.Deployment, path string) error {
+	output, err := f.run(device, proxy, "rm -rf "+path, "")
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w (output: %s)", path, err, output)
+	}
+	return nil
+}
+
+// list reads the routes recorded in the route files
+func (f routeFiles) list(device *models.Device, proxy *models.Deployment) ([]ProxyRoute, error) {
+	output, err := f.run(device, proxy, fmt.Sprintf("cat %s/*%s 2>/dev/null; true", f.dir, f.ext), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w (output: %s)", err, output)
+	}
+	return parseRouteMarkers(output), nil
+}
+
+// parseRouteMarkers returns the routes recorded by marker comments in concatenated route files
+func parseRouteMarkers(output string) []ProxyRoute {
+	var routes []ProxyRoute
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, routeMarker+" ") {
+			continue
+		}
+		var route ProxyRoute
+		for _, field := range strings.Fields(strings.TrimPrefix(line, routeMarker)) {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "router":
+				route.Router = value
+			case "domain":
+				route.Domain = value
+			case "upstream":
+				route.Upstream = value
+			case "cert_resolver":
+				route.CertResolver = value
+			}
+		}
+		if route.Router != "" {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// traefikProvider routes deployments with docker-provider labels and other routes with file-provider config
+type traefikProvider struct {
+	files routeFiles
+}
+
+func (p *traefikProvider) Recipe() string { return traefikRecipe }
+
+// Labels returns the Traefik docker-provider labels for the route, as key=value
+func (p *traefikProvider) Labels(route ProxyRoute) []string {
+	router := "traefik.http.routers." + route.Router
+	labels := []string{
+		"traefik.enable=true",
+		"traefik.docker.network=" + proxyNetwork,
+		fmt.Sprintf("%s.rule=Host(`%s`)", router, route.Domain),
+		router + ".service=" + route.Router,
+	}
+	switch route.CertResolver {
+	case "":
+		labels = append(labels, router+".entrypoints=web")
+	case homelabCAResolver:
+		// Traefik picks the installed certificate by SNI
+		labels = append(labels,
+			router+".entrypoints=websecure",
+			router+".tls=true")
+	default:
+		labels = append(labels,
+			router+".entrypoints=websecure",
+			router+".tls.certresolver="+route.CertResolver)
+	}
+	return append(labels, fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port=%d", route.Router, route.Port))
+}
+
+// AddRoute writes a file-provider config; Traefik watches the directory, so no reload is needed
+func (p *traefikProvider) AddRoute(device *models.Device, proxy *models.Deployment, route ProxyRoute) error {
+	return p.files.write(device, proxy, route, traefikRouteConfig(route), "")
+}
+
+// RemoveRoute removes a file-provider route; label routes go away with their containers
+func (p *traefikProvider) RemoveRoute(device *models.Device, proxy *models.Deployment, router string) error {
+	return p.files.remove(device, proxy, router, "")
+}
+
+// ListRoutes returns the routes from container labels followed by the file-provider routes
+func (p *traefikProvider) ListRoutes(device *models.Device, proxy *models.Deployment) ([]ProxyRoute, error) {
+	command := `docker ps -q --filter label=traefik.enable=true | xargs -r docker inspect --format '{{.Name}} {{json .Config.Labels}}'`
+	output, err := p.files.ssh.ExecuteWithTimeout(device.GetSSHHost(), command, proxyCommandTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list labeled containers: %w (output: %s)", err, output)
+	}
+	routes, err := parseTraefikLabelRoutes(output)
+	if err != nil {
+		return nil, err
+	}
+
+	fileRoutes, err := p.files.list(device, proxy)
+	if err != nil {
+		return nil, err
+	}
+	return append(routes, fileRoutes...), nil
+}
+
+// InstallCertificate writes a file-provider TLS config with the PEM inline, so Traefik reloads it on every renewal
+func (p *traefikProvider) InstallCertificate(device *models.Device, proxy *models.Deployment, domain, certPEM, keyPEM string) error {
+	config := fmt.Sprintf("tls:\n  certificates:\n    - certFile: |\n%s\n      keyFile: |\n%s",
+		indentLines(certPEM, "        "), indentLines(keyPEM, "        "))
+	return p.files.put(device, proxy, traefikCertPath(domain), config, "")
+}
+
+func (p *traefikProvider) RemoveCertificate(device *models.Device, proxy *models.Deployment, domain string) error {
+	return p.files.removePath(device, proxy, traefikCertPath(domain))
+}
+
+// traefikCertPath returns the file-provider config holding a domain's certificate
+// Its name cannot clash with a route file, as router names have no dots
+func traefikCertPath(domain string) string {
+	return "/etc/traefik/dynamic/" + domain + ".cert.yml"
+}
+
+// traefikRouteConfig returns the file-provider config for a route
+func traefikRouteConfig(route ProxyRoute) string {
+	entryPoint, tls := "web", ""
+	switch route.CertResolver {
+	case "":
+	case homelabCAResolver:
+		entryPoint = "websecure"
+		tls = "      tls: {}\n"
+	default:
+		entryPoint = "websecure"
+		tls = fmt.Sprintf("      tls:\n        certResolver: %q\n", route.CertResolver)
+	}
+	return fmt.Sprintf(`http:
+  routers:
+    %[1]s:
+      rule: "Host(`+"`%[2]s`"+`)"
+      entryPoints: [%[3]s]
+      service: %[1]s
+%[4]s  services:
+    %[1]s:
+      loadBalancer:
+        servers:
+          - url: "http://%[5]s"`, route.Router, route.Domain, entryPoint, tls, route.Upstream)
+}
+
+// parseTraefikLabelRoutes reads the routers from "docker inspect" lines of container name and labels JSON
+// Routers without a Host rule, like path-only rules, are skipped
+func parseTraefikLabelRoutes(output string) ([]ProxyRoute, error) {
+	var routes []ProxyRoute
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		name, labelsJSON, found := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !found {
+			continue
+		}
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(labelsJSON), &labels); err != nil {
+			return nil, fmt.Errorf("failed to parse labels of %s: %w", name, err)
+		}
+		container := strings.TrimPrefix(name, "/")
+
+		var routers []string
+		for key := range labels {
+			if router, ok := strings.CutPrefix(key, "traefik.http.routers."); ok && strings.HasSuffix(router, ".rule") {
+				routers = append(routers, strings.TrimSuffix(router, ".rule"))
+			}
+		}
+		sort.Strings(routers)
+
+		for _, router := range routers {
+			prefix := "traefik.http.routers." + router
+			match := traefikHostRule.FindStringSubmatch(labels[prefix+".rule"])
+			if match == nil {
+				continue
+			}
+			service := labels[prefix+".service"]
+			if service == "" {
+				service = router
+			}
+			// Internal services like api@internal have no container behind them
+			upstream := service
+			if !strings.Contains(service, "@") {
+				upstream = container
+				if port := labels["traefik.http.services."+service+".loadbalancer.server.port"]; port != "" {
+					upstream += ":" + port
+				}
+			}
+			routes = append(routes, ProxyRoute{
+				Domain:       match[1],
+				Router:       router,
+				Upstream:     upstream,
+				CertResolver: labels[prefix+".tls.certresolver"],
+			})
+		}
+	}
+	return routes, scanner.Err()
+}
+
+// caddyProvider writes a Caddyfile snippet per route, imported by the recipe's root Caddyfile
+type caddyProvider struct {
+	files routeFiles
+}
+
+const caddyReload = "caddy reload --config /etc/caddy/Caddyfile --adapter caddyfile"
+
+func (p *caddyProvider) Recipe() string { return caddyRecipe }
+
+func (p *caddyProvider) Labels(route ProxyRoute) []string { return nil }
+
+// AddRoute writes the snippet and reloads Caddy through its admin API; Caddy keeps its running config if the reload fails
+func (p *caddyProvider) AddRoute(device *models.Device, proxy *models.Deployment, route ProxyRoute) error {
+	return p.files.write(device, proxy, route, caddyRouteConfig(route), caddyReload)
+}
+
+func (p *caddyProvider) RemoveRoute(device *models.Device, proxy *models.Deployment, router string) error {
+	return p.files.remove(device, proxy, router, caddyReload)
+}
+
+func (p *caddyProvider) ListRoutes(device *models.Device, proxy *models.Deployment) ([]ProxyRoute, error) {
+	return p.files.list(device, proxy)
+}
+
+// InstallCertificate writes the certificate next to the route snippets; --force makes Caddy reload the unchanged config
+func (p *caddyProvider) InstallCertificate(device *models.Device, proxy *models.Deployment, domain, certPEM, keyPEM string) error {
+	dir := caddyCertDir(domain)
+	if err := p.files.put(device, proxy, dir+"/fullchain.pem", certPEM, ""); err != nil {
+		return err
+	}
+	return p.files.put(device, proxy, dir+"/privkey.pem", keyPEM, caddyReload+" --force")
+}
+
+func (p *caddyProvider) RemoveCertificate(device *models.Device, proxy *models.Deployment, domain string) error {
+	return p.files.removePath(device, proxy, caddyCertDir(domain))
+}
+
+// caddyCertDir returns the container directory holding a domain's certificate and key
+func caddyCertDir(domain string) string {
+	return "/etc/caddy/sites/certs/" + domain
+}
+
+// caddyRouteConfig returns the site block for a route
+// Plain HTTP sites use an http:// address, which turns off Caddy's automatic HTTPS for them
+func caddyRouteConfig(route ProxyRoute) string {
+	var b strings.Builder
+	if route.CertResolver == "" {
+		fmt.Fprintf(&b, "http://%s {\n", route.Domain)
+	} else {
+		fmt.Fprintf(&b, "%s {\n", route.Domain)
+		switch route.CertResolver {
+		case caddyInternalResolver:
+			b.WriteString("\ttls internal\n")
+		case homelabCAResolver:
+			dir := caddyCertDir(route.Domain)
+			fmt.Fprintf(&b, "\ttls %[1]s/fullchain.pem %[1]s/privkey.pem\n", dir)
+		}
+	}
+	fmt.Fprintf(&b, "\treverse_proxy %s\n}", route.Upstream)
+	return b.String()
+}
+
+// nginxProvider writes a server block per route, checked with nginx -t before a graceful reload
+// Nginx does not obtain certificates: HTTPS routes use the ones copied to /etc/nginx/certs/<domain>/
+type nginxProvider struct {
+	files routeFiles
+}
+
+const nginxReload = "nginx -t -q && nginx -s reload"
+
+func (p *nginxProvider) Recipe() string { return nginxRecipe }
+
+func (p *nginxProvider) Labels(route ProxyRoute) []string { return nil }
+
+func (p *nginxProvider) AddRoute(device *models.Device, proxy *models.Deployment, route ProxyRoute) error {
+	if route.CertResolver != "" {
+		dir := nginxCertDir(route.Domain)
+		check := fmt.Sprintf(`[ -f %[1]s/fullchain.pem ] && [ -f %[1]s/privkey.pem ] || { echo "copy fullchain.pem and privkey.pem to %[1]s in the proxy container first"; exit 1; }`, dir)
+		if output, err := p.files.run(device, proxy, check, ""); err != nil {
+			return fmt.Errorf("no certificate for %s: %w (output: %s)", route.Domain, err, output)
+		}
+	}
+	return p.files.write(device, proxy, route, nginxRouteConfig(route), nginxReload)
+}
+
+func (p *nginxProvider) RemoveRoute(device *models.Device, proxy *models.Deployment, router string) error {
+	return p.files.remove(device, proxy, router, nginxReload)
+}
+
+func (p *nginxProvider) ListRoutes(device *models.Device, proxy *models.Deployment) ([]ProxyRoute, error) {
+	return p.files.list(device, proxy)
+}
+
+func (p *nginxProvider) InstallCertificate(device *models.Device, proxy *models.Deployment, domain, certPEM, keyPEM string) error {
+	dir := nginxCertDir(domain)
+	if err := p.files.put(device, proxy, dir+"/fullchain.pem", certPEM, ""); err != nil {
+		return err
+	}
+	return p.files.put(device, proxy, dir+"/privkey.pem", keyPEM, nginxReload)
+}
+
+func (p *nginxProvider) RemoveCertificate(device *models.Device, proxy *models.Deployment, domain string) error {
+	return p.files.removePath(device, proxy, nginxCertDir(domain))
+}
+
+// nginxCertDir returns the container directory holding a domain's certificate and key
+func nginxCertDir(domain string) string {
+	return "/etc/nginx/certs/" + domain
+}
+
+// nginxRouteConfig returns the server blocks for a route
+// The upstream is resolved through Docker's DNS at request time, so Nginx starts even while the app is down
+func nginxRouteConfig(route ProxyRoute) string {
+	location := fmt.Sprintf(`    location / {
+        resolver 127.0.0.11 valid=30s;
+        set $upstream http://%s;
+        proxy_pass $upstream;
+        proxy_http_version 1.1;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection $http_connection;
+        client_max_body_size 0;
+    }`, route.Upstream)
+
+	if route.CertResolver == "" {
+		return fmt.Sprintf("server {\n    listen 80;\n    server_name %s;\n\n%s\n}", route.Domain, location)
+	}
+	dir := nginxCertDir(route.Domain)
+	return fmt.Sprintf(`server {
+    listen 80;
+    server_name %[1]s;
+    return 301 https://$host$request_uri;
+}
+
+server {
+    listen 443 ssl;
+    server_name %[1]s;
+    ssl_certificate %[2]s/fullchain.pem;
+    ssl_certificate_key %[2]s/privkey.pem;
+
+%[3]s
+}`, route.Domain, dir, location)
+}
+
+// indentLines prefixes every line of text with indent
+func indentLines(text, indent string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return indent + strings.Join(lines, "\n"+indent)
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// swarmStackFile is the rendered compose file a stack is deployed from, next to docker-compose.yml
+const swarmStackFile = "docker-compose.stack.yml"
+
+// SwarmOrchestrator implements ContainerOrchestrator for Docker Swarm
+// All commands run on a manager node; Swarm schedules tasks across the cluster
+// and reschedules them when a worker goes down
+type SwarmOrchestrator struct {
+	sshClient *ssh.Client
+}
+
+// ServiceReplicaStatus describes replica convergence for a single Swarm service
+type ServiceReplicaStatus struct {
+	Name      string `json:"name"`
+	Mode      string `json:"mode"` // "replicated" or "global"
+	Running   int    `json:"running"`
+	Desired   int    `json:"desired"`
+	Converged bool   `json:"converged"`
+}
+
+// NewSwarmOrchestrator creates a new Docker Swarm orchestrator
+// Note: sshClient can be nil for testing, but actual deployment operations will fail
+func NewSwarmOrchestrator(sshClient *ssh.Client) *SwarmOrchestrator {
+	if sshClient == nil {
+		log.Printf("[Orchestrator] Warning: SSH client is nil - swarm operations will fail")
+	}
+	return &SwarmOrchestrator{
+		sshClient: sshClient,
+	}
+}
+
+// GetMode returns the orchestration mode
+func (so *SwarmOrchestrator) GetMode() string {
+	return "swarm"
+}
+
+// Deploy deploys a stack using docker stack deploy on a Swarm manager
+func (so *SwarmOrchestrator) Deploy(ctx context.Context, spec DeploymentSpec) error {
+	// Validate SSH client is available
+	if so.sshClient == nil {
+		return fmt.Errorf("SSH client is nil - cannot perform deployment operations")
+	}
+
+	// Validate spec (includes security checks for injection prevention)
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+
+	// Set default timeout if not specified
+	if spec.Timeout == 0 {
+		spec.Timeout = 10 * time.Minute
+	}
+
+	// Check context before starting (fail fast if already cancelled)
+	if err := checkContextCancelled(ctx); err != nil {
+		return fmt.Errorf("deployment cancelled before start: %w", err)
+	}
+
+	// Stacks can only be deployed from a manager node
+	if err := so.ensureManager(spec.Host); err != nil {
+		return err
+	}
+
+	// Create deployment directory
+	mkdirCmd := fmt.Sprintf("mkdir -p %s", spec.DeployDir)
+	if _, err := so.sshClient.ExecuteWithTimeout(spec.Host, mkdirCmd, 30*time.Second); err != nil {
+		return fmt.Errorf("failed to create deployment directory: %w", err)
+	}
+
+	// Write compose file
+	composeFile := fmt.Sprintf("%s/docker-compose.yml", spec.DeployDir)
+	if !isValidDeployPath(composeFile) {
+		return fmt.Errorf("invalid compose file path after construction: %s", composeFile)
+	}
+
+	// SECURITY: heredoc MUST use single quotes ('EOF') to prevent shell expansion
+	writeCmd := fmt.Sprintf("cat > %s << 'EOF'\n%s\nEOF", composeFile, spec.ComposeContent)
+	if _, err := so.sshClient.ExecuteWithTimeout(spec.Host, writeCmd, 1*time.Minute); err != nil {
+		return fmt.Errorf("failed to write compose file: %w", err)
+	}
+
+	// Always write an env file (possibly empty) so the render step below has a stable input
+	envFile := fmt.Sprintf("%s/.env", spec.DeployDir)
+	if !isValidDeployPath(envFile) {
+		return fmt.Errorf("invalid env file path after construction: %s", envFile)
+	}
+
+	// Sort keys for deterministic output
+	keys := make([]string, 0, len(spec.Environment))
+	for k := range spec.Environment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	envContent := ""
+	for _, key := range keys {
+		envContent += fmt.Sprintf("%s=%s\n", key, escapeEnvValue(spec.Environment[key]))
+	}
+
+	writeEnvCmd := fmt.Sprintf("cat > %s << 'EOF'\n%s\nEOF", envFile, envContent)
+	if _, err := so.sshClient.ExecuteWithTimeout(spec.Host, writeEnvCmd, 30*time.Second); err != nil {
+		return fmt.Errorf("failed to write environment file: %w", err)
+	}
+
+	// Check context before deployment
+	if err := checkContextCancelled(ctx); err != nil {
+		return fmt.Errorf("deployment cancelled before docker stack deploy: %w", err)
+	}
+
+	// docker stack deploy does not read .env files, so render the compose file with
+	// docker compose first (same ${VAR} substitution rules as compose mode).
+	// Rendering is its own step: a broken compose or .env file must never reach
+	// stack deploy, where --prune would tear the running stack down
+	renderCmd := fmt.Sprintf("cd %s && docker compose -p %s --env-file .env config > %s", spec.DeployDir, spec.StackName, swarmStackFile)
+	if output, err := so.sshClient.ExecuteWithTimeout(spec.Host, renderCmd, 1*time.Minute); err != nil {
+		return fmt.Errorf("failed to render compose file: %w (output: %s)", err, output)
+	}
+	rendered, err := so.sshClient.ExecuteWithTimeout(spec.Host, fmt.Sprintf("cat %s/%s", spec.DeployDir, swarmStackFile), 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to read rendered compose file: %w", err)
+	}
+	stackContent, err := stackComposeFile(rendered)
+	if err != nil {
+		return err
+	}
+	writeStackCmd := fmt.Sprintf("cat > %s/%s << 'EOF'\n%s\nEOF", spec.DeployDir, swarmStackFile, stackContent)
+	if _, err := so.sshClient.ExecuteWithTimeout(spec.Host, writeStackCmd, 1*time.Minute); err != nil {
+		return fmt.Errorf("failed to write stack file: %w", err)
+	}
+
+	deployCmd := fmt.Sprintf("cd %s && docker stack deploy --prune --with-registry-auth -c %s %s", spec.DeployDir, swarmStackFile, spec.StackName)
+	output, err := so.sshClient.ExecuteWithTimeout(spec.Host, deployCmd, spec.Timeout)
+	if err != nil {
+		return fmt.Errorf("docker stack deploy failed: %w (output: %s)", err, output)
+	}
+
+	log.Printf("[Swarm] Successfully deployed stack %s", spec.StackName)
+	return nil
+}
+
+// HealthCheck checks replica convergence for every service in a stack
+// A stack is healthy once every service runs its desired number of tasks
+func (so *SwarmOrchestrator) HealthCheck(ctx context.Context, stackName string, host string) (HealthStatus, error) {
+	status := HealthStatus{
+		Timestamp: time.Now(),
+		Healthy:   false,
+		Running:   false,
+	}
+
+	// Validate SSH client is available
+	if so.sshClient == nil {
+		status.Message = "SSH client is nil"
+		return status, fmt.Errorf("SSH client is nil - cannot perform health check operations")
+	}
+
+	// Validate stack name (prevent shell injection)
+	if !isValidStackName(stackName) {
+		status.Message = "Invalid stack name"
+		return status, fmt.Errorf("invalid stack name: only alphanumeric, hyphens, and underscores allowed")
+	}
+
+	// Check context before starting (fail fast if already cancelled)
+	if err := checkContextCancelled(ctx); err != nil {
+		status.Message = "Health check cancelled"
+		return status, err
+	}
+
+	services, err := so.GetReplicaStatus(ctx, stackName, host)
+	if err != nil {
+		status.Message = fmt.Sprintf("Failed to check service status: %v", err)
+		return status, err
+	}
+
+	if len(services) == 0 {
+		status.Message = "No services found"
+		return status, nil
+	}
+
+	running, desired, pending := 0, 0, []string{}
+	for _, svc := range services {
+		running += svc.Running
+		desired += svc.Desired
+		if !svc.Converged {
+			pending = append(pending, fmt.Sprintf("%s (%d/%d)", svc.Name, svc.Running, svc.Desired))
+		}
+	}
+
+	status.Running = running > 0
+	if len(pending) == 0 {
+		status.Healthy = true
+		status.Message = fmt.Sprintf("All %d services converged (%d/%d replicas running)", len(services), running, desired)
+		return status, nil
+	}
+
+	status.Message = fmt.Sprintf("Waiting for replicas to converge: %s", strings.Join(pending, ", "))
+
+	// Surface the most recent task error for the first unconverged service to aid debugging
+	if taskErr := so.lastTaskError(host, stackName, services); taskErr != "" {
+		status.Message += fmt.Sprintf(" - last task error: %s", taskErr)
+	}
+
+	return status, nil
+}
+
+// GetReplicaStatus returns running/desired replica counts for each service in a stack
+func (so *SwarmOrchestrator) GetReplicaStatus(ctx context.Context, stackName string, host string) ([]ServiceReplicaStatus, error) {
+	if so.sshClient == nil {
+		return nil, fmt.Errorf("SSH client is nil - cannot query swarm services")
+	}
+	if !isValidStackName(stackName) {
+		return nil, fmt.Errorf("invalid stack name: only alphanumeric, hyphens, and underscores allowed")
+	}
+	if err := checkContextCancelled(ctx); err != nil {
+		return nil, err
+	}
+
+	listCmd := fmt.Sprintf("docker stack services %s --format '{{.Name}}|{{.Mode}}|{{.Replicas}}' 2>/dev/null || true", stackName)
+	output, err := so.sshClient.ExecuteWithTimeout(host, listCmd, 15*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stack services: %w", err)
+	}
+
+	return parseStackServices(output)
+}
+
+// lastTaskError returns the error of the newest failed task for the first unconverged service
+func (so *SwarmOrchestrator) lastTaskError(host string, stackName string, services []ServiceReplicaStatus) string {
+	for _, svc := range services {
+		if svc.Converged || !isValidStackName(svc.Name) {
+			continue
+		}
+
+		psCmd := fmt.Sprintf("docker service ps %s --no-trunc --format '{{.Error}}' 2>/dev/null | grep -v '^$' | head -1", svc.Name)
+		output, err := so.sshClient.ExecuteWithTimeout(host, psCmd, 10*time.Second)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(output)
+	}
+	return ""
+}
+
+// Remove removes a Swarm stack and optionally its volumes
+func (so *SwarmOrchestrator) Remove(ctx context.Context, stackName string, host string, includeVolumes bool) error {
+	// Validate SSH client is available
+	if so.sshClient == nil {
+		return fmt.Errorf("SSH client is nil - cannot perform removal operations")
+	}
+
+	// Validate stack name (prevent shell injection)
+	if !isValidStackName(stackName) {
+		return fmt.Errorf("invalid stack name: only alphanumeric, hyphens, and underscores allowed")
+	}
+
+	// Check context before starting (fail fast if already cancelled)
+	if err := checkContextCancelled(ctx); err != nil {
+		return fmt.Errorf("removal cancelled: %w", err)
+	}
+
+	so.removeStack(host, stackName, includeVolumes)
+
+	log.Printf("[Swarm] Removed stack %s (volumes: %v)", stackName, includeVolumes)
+	return nil
+}
+
+// RemoveWithCleanup removes a stack and cleans up associated resources on the manager
+func (so *SwarmOrchestrator) RemoveWithCleanup(ctx context.Context, spec RemovalSpec) error {
+	// Validate SSH client is available
+	if so.sshClient == nil {
+		return fmt.Errorf("SSH client is nil - cannot perform cleanup operations")
+	}
+
+	// Validate spec (includes security checks for injection prevention)
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+
+	// Check context before starting (fail fast if already cancelled)
+	if err := checkContextCancelled(ctx); err != nil {
+		return fmt.Errorf("cleanup cancelled before start: %w", err)
+	}
+
+	so.removeStack(spec.Host, spec.StackName, spec.IncludeVolumes)
+
+	// Check context after stack removal
+	if err := checkContextCancelled(ctx); err != nil {
+		return fmt.Errorf("cleanup cancelled during container removal: %w", err)
+	}
+
+	// Fallback: force remove specific container if specified
+	if spec.ContainerName != "" {
+		forceRemoveCmd := fmt.Sprintf("docker rm -f %s 2>/dev/null || true", spec.ContainerName)
+		if _, err := so.sshClient.ExecuteWithTimeout(spec.Host, forceRemoveCmd, 30*time.Second); err != nil {
+			log.Printf("[Swarm] Warning: force remove container failed for %s: %v", spec.ContainerName, err)
+		}
+	}
+
+	// Check context before directory cleanup
+	if err := checkContextCancelled(ctx); err != nil {
+		return fmt.Errorf("cleanup cancelled before directory removal: %w", err)
+	}
+
+	// Clean up deployment directory if specified
+	if spec.DeployDir != "" {
+		cleanupDirCmd := fmt.Sprintf("rm -rf %s", spec.DeployDir)
+		if _, err := so.sshClient.ExecuteWithTimeout(spec.Host, cleanupDirCmd, 30*time.Second); err != nil {
+			log.Printf("[Swarm] Warning: Failed to cleanup deployment directory %s: %v", spec.DeployDir, err)
+		}
+	}
+
+	log.Printf("[Swarm] Cleanup completed for %s", spec.StackName)
+	return nil
+}
+
+// removeStack runs docker stack rm and, if requested, removes the stack's volumes
+// Volumes are node-local in Swarm; only volumes on the manager can be removed from here
+func (so *SwarmOrchestrator) removeStack(host string, stackName string, includeVolumes bool) {
+	rmCmd := fmt.Sprintf("docker stack rm %s 2>/dev/null || true", stackName)
+	if _, err := so.sshClient.ExecuteWithTimeout(host, rmCmd, 2*time.Minute); err != nil {
+		log.Printf("[Swarm] Warning: docker stack rm failed for %s: %v", stackName, err)
+	}
+
+	if !includeVolumes {
+		return
+	}
+
+	// Tasks shut down asynchronously after stack rm; volumes in use cannot be removed
+	waitCmd := fmt.Sprintf("for i in $(seq 1 30); do [ -z \"$(docker ps -q --filter label=com.docker.stack.namespace=%s)\" ] && break; sleep 2; done", stackName)
+	if _, err := so.sshClient.ExecuteWithTimeout(host, waitCmd, 90*time.Second); err != nil {
+		log.Printf("[Swarm] Warning: timed out waiting for %s tasks to stop: %v", stackName, err)
+	}
+
+	volumeCmd := fmt.Sprintf("docker volume ls -q --filter label=com.docker.stack.namespace=%s | xargs -r docker volume rm 2>/dev/null || true", stackName)
+	if _, err := so.sshClient.ExecuteWithTimeout(host, volumeCmd, 1*time.Minute); err != nil {
+		log.Printf("[Swarm] Warning: failed to remove volumes for %s: %v", stackName, err)
+	}
+}
+
+// WaitForHealthy waits for all services in a stack to reach their desired replica count
+// Respects both the timeout parameter and the context deadline (whichever comes first)
+func (so *SwarmOrchestrator) WaitForHealthy(ctx context.Context, stackName string, host string, timeout time.Duration) error {
+	// Validate SSH client is available
+	if so.sshClient == nil {
+		return fmt.Errorf("SSH client is nil - cannot perform health check operations")
+	}
+
+	// Validate stack name (prevent shell injection)
+	if !isValidStackName(stackName) {
+		return fmt.Errorf("invalid stack name: only alphanumeric, hyphens, and underscores allowed")
+	}
+
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	attempt := 0
+	maxAttempts := int(timeout.Seconds() / 5)
+
+	for {
+		attempt++
+
+		// Explicit attempt limit as fallback (defense-in-depth)
+		if attempt > maxAttempts {
+			return fmt.Errorf("exceeded maximum health check attempts (%d)", maxAttempts)
+		}
+
+		if err := checkContextCancelled(timeoutCtx); err != nil {
+			return fmt.Errorf("waiting for health cancelled after %d attempts: %w", attempt, err)
+		}
+
+		status, err := so.HealthCheck(timeoutCtx, stackName, host)
+		if err == nil && status.Healthy {
+			log.Printf("[Swarm] Stack %s is healthy", stackName)
+			return nil
+		}
+
+		log.Printf("[Swarm] Waiting for %s to converge (attempt %d/%d): %s", stackName, attempt, maxAttempts, status.Message)
+
+		select {
+		case <-timeoutCtx.Done():
+			return fmt.Errorf("stack did not converge: %w", timeoutCtx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// ensureManager verifies that host is an active Swarm manager
+func (so *SwarmOrchestrator) ensureManager(host string) error {
+	infoCmd := "docker info --format '{{.Swarm.LocalNodeState}}/{{.Swarm.ControlAvailable}}'"
+	output, err := so.sshClient.ExecuteWithTimeout(host, infoCmd, 15*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to query swarm state: %w", err)
+	}
+	return checkSwarmManagerState(output)
+}
+
+// checkSwarmManagerState interprets "docker info" output of the form "<state>/<control>"
+func checkSwarmManagerState(output string) error {
+	parts := strings.SplitN(strings.TrimSpace(output), "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("unexpected swarm state output: %q", strings.TrimSpace(output))
+	}
+
+	state, control := parts[0], parts[1]
+	if state != "active" {
+		return fmt.Errorf("node is not part of an active swarm (state: %s) - run 'docker swarm init' or join the node first", state)
+	}
+	if control != "true" {
+		return fmt.Errorf("node is a swarm worker - stacks must be deployed from a manager node")
+	}
+	return nil
+}
+
+// stackComposeFile checks a compose file rendered by "docker compose config" and prepares it for stack deploy
+// Empty output or a file without services is rejected. The top-level "name" key emitted by compose
+// is not accepted by stack deploy and is dropped
+func stackComposeFile(rendered string) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(rendered), &doc); err != nil {
+		return "", fmt.Errorf("rendered compose file is invalid: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("rendered compose file is empty")
+	}
+	root := doc.Content[0]
+	services := yamlMappingValue(root, "services")
+	if services == nil || services.Kind != yaml.MappingNode || len(services.Content) == 0 {
+		return "", fmt.Errorf("rendered compose file has no services")
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "name" {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			break
+		}
+	}
+
+	out, err := yaml.Marshal(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode stack file: %w", err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// parseStackServices parses "docker stack services" output formatted as Name|Mode|Replicas
+// Replicas look like "2/3" and may carry a suffix such as "1/1 (max 1 per node)"
+func parseStackServices(output string) ([]ServiceReplicaStatus, error) {
+	services := []ServiceReplicaStatus{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "|", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unexpected service line: %q", line)
+		}
+
+		replicas := strings.Fields(parts[2])
+		if len(replicas) == 0 {
+			return nil, fmt.Errorf("missing replica count for service %s", parts[0])
+		}
+
+		var running, desired int
+		if _, err := fmt.Sscanf(replicas[0], "%d/%d", &running, &desired); err != nil {
+			return nil, fmt.Errorf("invalid replica count %q for service %s", replicas[0], parts[0])
+		}
+
+		services = append(services, ServiceReplicaStatus{
+			Name:      parts[0],
+			Mode:      parts[1],
+			Running:   running,
+			Desired:   desired,
+			Converged: running == desired,
+		})
+	}
+
+	return services, nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+)
+
+func TestParseStackServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected []ServiceReplicaStatus
+		wantErr  bool
+	}{
+		{
+			name:     "empty output",
+			output:   "",
+			expected: []ServiceReplicaStatus{},
+		},
+		{
+			name:   "converged replicated service",
+			output: "app_web|replicated|3/3\n",
+			expected: []ServiceReplicaStatus{
+				{Name: "app_web", Mode: "replicated", Running: 3, Desired: 3, Converged: true},
+			},
+		},
+		{
+			name:   "mixed services with max-per-node suffix",
+			output: "app_web|replicated|1/2\napp_agent|global|2/2\napp_db|replicated|1/1 (max 1 per node)\n",
+			expected: []ServiceReplicaStatus{
+				{Name: "app_web", Mode: "replicated", Running: 1, Desired: 2, Converged: false},
+				{Name: "app_agent", Mode: "global", Running: 2, Desired: 2, Converged: true},
+				{Name: "app_db", Mode: "replicated", Running: 1, Desired: 1, Converged: true},
+			},
+		},
+		{
+			name:    "malformed line",
+			output:  "app_web replicated 1/1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid replica count",
+			output:  "app_web|replicated|n/a",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services, err := parseStackServices(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseStackServices() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStackServices() unexpected error: %v", err)
+			}
+			if len(services) != len(tt.expected) {
+				t.Fatalf("parseStackServices() returned %d services, want %d", len(services), len(tt.expected))
+			}
+			for i := range services {
+				if services[i] != tt.expected[i] {
+					t.Errorf("service %d = %+v, want %+v", i, services[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSwarmManagerState(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantErr string
+	}{
+		{name: "active manager", output: "active/true\n"},
+		{name: "worker node", output: "active/false", wantErr: "worker"},
+		{name: "swarm inactive", output: "inactive/false", wantErr: "not part of an active swarm"},
+		{name: "unexpected output", output: "garbage", wantErr: "unexpected swarm state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSwarmManagerState(tt.output)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkSwarmManagerState() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkSwarmManagerState() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSwarmNilSSHClientHandling(t *testing.T) {
+	orchestrator := NewSwarmOrchestrator(nil)
+	if orchestrator.GetMode() != "swarm" {
+		t.Errorf("GetMode() = %s, want swarm", orchestrator.GetMode())
+	}
+
+	ctx := context.Background()
+	spec := DeploymentSpec{
+		Host:           "192.168.1.10:22",
+		StackName:      "test-stack",
+		DeployDir:      "/home/user/deployments/test",
+		ComposeContent: "version: '3'\nservices:\n  web:\n    image: nginx",
+	}
+
+	if err := orchestrator.Deploy(ctx, spec); err == nil || !strings.Contains(err.Error(), "SSH client is nil") {
+		t.Errorf("Deploy() error should mention nil SSH client, got: %v", err)
+	}
+
+	if _, err := orchestrator.HealthCheck(ctx, "test-stack", "192.168.1.10:22"); err == nil || !strings.Contains(err.Error(), "SSH client is nil") {
+		t.Errorf("HealthCheck() error should mention nil SSH client, got: %v", err)
+	}
+
+	if err := orchestrator.Remove(ctx, "test-stack", "192.168.1.10:22", true); err == nil || !strings.Contains(err.Error(), "SSH client is nil") {
+		t.Errorf("Remove() error should mention nil SSH client, got: %v", err)
+	}
+
+	if err := orchestrator.WaitForHealthy(ctx, "test-stack", "192.168.1.10:22", 1*time.Minute); err == nil || !strings.Contains(err.Error(), "SSH client is nil") {
+		t.Errorf("WaitForHealthy() error should mention nil SSH client, got: %v", err)
+	}
+}
+
+func TestStackComposeFile(t *testing.T) {
+	rendered := "name: wiki-dep-1\nservices:\n  wiki:\n    image: ghcr.io/requarks/wiki:2.5\n    environment:\n      DB_NAME: wiki\n"
+	stack, err := stackComposeFile(rendered)
+	if err != nil {
+		t.Fatalf("stackComposeFile() error = %v", err)
+	}
+	if strings.Contains(stack, "name: wiki-dep-1") {
+		t.Errorf("top-level name should be dropped, got:\n%s", stack)
+	}
+	if !strings.Contains(stack, "DB_NAME: wiki") || !strings.Contains(stack, "image: ghcr.io/requarks/wiki:2.5") {
+		t.Errorf("services should be kept, got:\n%s", stack)
+	}
+
+	// A failed render must never reach stack deploy --prune
+	for _, broken := range []string{"", "\n", "name: wiki-dep-1\n", "services: {}\n", "services:\n  - wiki\n", "services: [\n"} {
+		if _, err := stackComposeFile(broken); err == nil {
+			t.Errorf("stackComposeFile(%q) should fail", broken)
+		}
+	}
+}
+
+func TestDeploymentService_PoolsStayOnCompose(t *testing.T) {
+	db := setupTestDB(t)
+	credService := setupTestCredentialService(t)
+	service := NewDeploymentService(db, nil, NewMockRecipeLoader(nil), NewDeviceService(db, credService, nil), credService, nil, nil, NewDockerComposeOrchestrator(nil))
+	service.SetStackOrchestrator(NewSwarmOrchestrator(nil))
+
+	if mode := service.dbPoolManager.orchestrator.GetMode(); mode != "compose" {
+		t.Errorf("database pool orchestrator = %s, want compose", mode)
+	}
+	if mode := service.cachePoolManager.orchestrator.GetMode(); mode != "compose" {
+		t.Errorf("cache pool orchestrator = %s, want compose", mode)
+	}
+	if mode := service.dependencyService.orchestrator.GetMode(); mode != "compose" {
+		t.Errorf("reverse proxy orchestrator = %s, want compose", mode)
+	}
+	if mode := service.dependencyService.stacks.GetMode(); mode != "swarm" {
+		t.Errorf("dependency stack orchestrator = %s, want swarm", mode)
+	}
+
+	stack := &models.Deployment{RecipeSlug: "wiki-js", ComposeProject: "wiki-js-dep-1", Source: models.DeploymentSourceDependency,
+		Orchestrator: models.DeploymentOrchestratorSwarm, DeviceID: uuid.New(), Status: models.DeploymentStatusRunning}
+	if err := db.Create(stack).Error; err != nil {
+		t.Fatalf("failed to create stack: %v", err)
+	}
+	if err := service.StopDeployment(stack.ID.String()); err == nil || !strings.Contains(err.Error(), "Docker Swarm") {
+		t.Errorf("StopDeployment() on a swarm stack should be rejected, got: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+	"gorm.io/gorm"
+)
+
+// containerIDRegex matches Docker container IDs as printed by `docker ps -q`
+var containerIDRegex = regexp.MustCompile(`^[a-f0-9]{12,64}$`)
+
+// containerShellScript starts the best shell available in a container
+const containerShellScript = `if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi`
+
+// TerminalService opens interactive shells on devices and inside deployment containers
+type TerminalService struct {
+	db            *gorm.DB
+	sshClient     *ssh.Client
+	deviceService *DeviceService
+}
+
+// TerminalSize is the initial terminal size in characters
+type TerminalSize struct {
+	Cols int
+	Rows int
+}
+
+// NewTerminalService creates a new terminal service
+func NewTerminalService(db *gorm.DB, sshClient *ssh.Client, deviceService *DeviceService) *TerminalService {
+	return &TerminalService{
+		db:            db,
+		sshClient:     sshClient,
+		deviceService: deviceService,
+	}
+}
+
+// OpenDeviceShell opens a login shell on a device
+func (s *TerminalService) OpenDeviceShell(deviceID uuid.UUID, size TerminalSize) (*ssh.Shell, error) {
+	device, err := s.deviceService.GetDevice(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("device not found")
+	}
+
+	host, err := s.connect(device)
+	if err != nil {
+		return nil, err
+	}
+
+	size = size.normalized()
+	return s.sshClient.OpenShell(host, "", size.Cols, size.Rows)
+}
+
+// OpenContainerShell opens a shell inside a running container of one of a deployment's services
+func (s *TerminalService) OpenContainerShell(deploymentID uuid.UUID, service string, size TerminalSize) (*ssh.Shell, error) {
+	if !volumeNameRegex.MatchString(service) {
+		return nil, fmt.Errorf("invalid service name: %s", service)
+	}
+
+	var deployment models.Deployment
+	if err := s.db.First(&deployment, "id = ?", deploymentID).Error; err != nil {
+		return nil, fmt.Errorf("deployment not found")
+	}
+	if !isValidStackName(deployment.ComposeProject) {
+		return nil, fmt.Errorf("deployment has no valid compose project")
+	}
+
+	device, err := s.deviceService.GetDevice(deployment.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("device not found")
+	}
+
+	host, err := s.connect(device)
+	if err != nil {
+		return nil, err
+	}
+
+	containerID, err := s.findContainer(host, deployment.ComposeProject, service)
+	if err != nil {
+		return nil, err
+	}
+
+	size = size.normalized()
+	return s.sshClient.OpenShell(host, containerShellCommand(containerID), size.Cols, size.Rows)
+}
+
+// findContainer returns the ID of a running container for a compose service
+func (s *TerminalService) findContainer(host string, project string, service string) (string, error) {
+	psCmd := fmt.Sprintf("docker ps -q --filter label=com.docker.compose.project=%s --filter label=com.docker.compose.service=%s", project, service)
+	output, err := s.sshClient.ExecuteWithTimeout(host, psCmd, 30*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to list containers: %w (output: %s)", err, output)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		id := strings.TrimSpace(line)
+		if containerIDRegex.MatchString(id) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no running container for service %s", service)
+}
+
+// connect returns the device's SSH host, reusing a pooled connection or opening one with the device's credentials
+func (s *TerminalService) connect(device *models.Device) (string, error) {
+	host := device.GetSSHHost()
+	if _, err := s.sshClient.GetConnection(host); err == nil {
+		return host, nil
+	}
+
+	creds, err := s.deviceService.GetDeviceCredentials(device.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get credentials: %w", err)
+	}
+
+	switch creds.Type {
+	case "auto":
+		_, err = s.sshClient.TryAutoAuth(host, creds.Username)
+	case "password":
+		_, err = s.sshClient.ConnectWithPassword(host, creds.Username, creds.Password)
+	case "ssh_key":
+		_, err = s.sshClient.ConnectWithKey(host, creds.Username, creds.SSHKey, creds.SSHKeyPasswd)
+	case "tailscale":
+		_, err = s.sshClient.ConnectWithTailscale(host, creds.Username)
+	default:
+		return "", fmt.Errorf("unknown credential type: %s", creds.Type)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to establish SSH connection: %w", err)
+	}
+
+	log.Printf("[Terminal] Established new SSH connection to %s", device.Name)
+	return host, nil
+}
+
+// containerShellCommand returns the command that attaches an interactive shell to a container
+func containerShellCommand(containerID string) string {
+	return fmt.Sprintf("docker exec -it %s sh -c '%s'", containerID, containerShellScript)
+}
+
+// normalized fills in a default size and clamps nonsensical values
+func (t TerminalSize) normalized() TerminalSize {
+	if t.Cols <= 0 || t.Cols > 1000 {
+		t.Cols = 80
+	}
+	if t.Rows <= 0 || t.Rows > 1000 {
+		t.Rows = 24
+	}
+	return t
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerShellCommand(t *testing.T) {
+	assert.Equal(t,
+		`docker exec -it 3f2a9c1b7d4e sh -c 'if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi'`,
+		containerShellCommand("3f2a9c1b7d4e"))
+}
+
+func TestTerminalSize_Normalized(t *testing.T) {
+	assert.Equal(t, TerminalSize{Cols: 80, Rows: 24}, TerminalSize{}.normalized())
+	assert.Equal(t, TerminalSize{Cols: 200, Rows: 50}, TerminalSize{Cols: 200, Rows: 50}.normalized())
+	assert.Equal(t, TerminalSize{Cols: 80, Rows: 24}, TerminalSize{Cols: -1, Rows: 100000}.normalized())
+}
+
+func TestTerminalService_OpenContainerShellValidation(t *testing.T) {
+	db := setupTestDB(t)
+	deviceService := NewDeviceService(db, setupTestCredentialService(t), nil)
+	service := NewTerminalService(db, nil, deviceService)
+
+	_, err := service.OpenContainerShell(uuid.New(), "web; reboot", TerminalSize{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid service name")
+
+	_, err = service.OpenContainerShell(uuid.New(), "web", TerminalSize{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deployment not found")
+
+	deployment := &models.Deployment{RecipeSlug: "nextcloud", DeviceID: uuid.New(), ComposeProject: "nextcloud-abc123"}
+	require.NoError(t, db.Create(deployment).Error)
+	_, err = service.OpenContainerShell(deployment.ID, "app", TerminalSize{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "device not found")
+
+	_, err = service.OpenDeviceShell(uuid.New(), TerminalSize{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "device not found")
+}
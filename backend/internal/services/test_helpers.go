@@ -38,12 +38,29 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		&models.Deployment{},
 		&models.Credential{},
 		&models.SharedDatabaseInstance{},
+		&models.SharedCacheInstance{},
+		&models.ProvisionedCacheConfig{},
 		&models.ProvisionedDatabase{},
 		&models.InstalledSoftware{},
 		&models.SoftwareInstallation{},
 		&models.NFSExport{},
 		&models.NFSMount{},
 		&models.Volume{},
+		&models.BackupDestination{},
+		&models.BackupPolicy{},
+		&models.BackupSnapshot{},
+		&models.DeploymentHealthCheck{},
+		&models.RemediationPolicy{},
+		&models.DedicatedInstance{},
+		&models.DatabaseDump{},
+		&models.DeploymentJob{},
+		&models.DeploymentEvent{},
+		&models.PortAllocation{},
+		&models.PortReservation{},
+		&models.DeploymentDependency{},
+		&models.Certificate{},
+		&models.DNSProvider{},
+		&models.DNSRecord{},
 	)
 	require.NoError(t, err, "Failed to run migrations")
 
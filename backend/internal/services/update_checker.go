@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/ssh"
+	"gorm.io/gorm"
+)
+
+// imageRefRegex matches image references that are safe to pass to the docker CLI
+var imageRefRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/:@-]*$`)
+
+// DeploymentUpgrader starts an in-place upgrade of a deployment
+type DeploymentUpgrader interface {
+	UpgradeDeployment(id string, req UpgradeDeploymentRequest) (*models.Deployment, error)
+}
+
+// ImageDigestResolver resolves the registry's current digest for an image tag
+type ImageDigestResolver interface {
+	GetManifestDigest(image string) (string, error)
+}
+
+// UpdateCheckerService periodically compares running image digests with their registries
+type UpdateCheckerService struct {
+	db            *gorm.DB
+	sshClient     *ssh.Client
+	registry      ImageDigestResolver
+	upgrader      DeploymentUpgrader
+	recipeLoader  RecipeProvider
+	wsHub         WSHub
+	checkInterval time.Duration
+	cancel        context.CancelFunc
+}
+
+// NewUpdateCheckerService creates a new update checker service
+func NewUpdateCheckerService(db *gorm.DB, sshClient *ssh.Client, registry ImageDigestResolver, upgrader DeploymentUpgrader, recipeLoader RecipeProvider, wsHub WSHub) *UpdateCheckerService {
+	return &UpdateCheckerService{
+		db:            db,
+		sshClient:     sshClient,
+		registry:      registry,
+		upgrader:      upgrader,
+		recipeLoader:  recipeLoader,
+		wsHub:         wsHub,
+		checkInterval: 6 * time.Hour, // Registries rate-limit anonymous pulls; a few checks per day is plenty
+	}
+}
+
+// Start begins the background update check loop
+func (s *UpdateCheckerService) Start(ctx context.Context) {
+	log.Println("[UpdateChecker] Starting update checker service")
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	ticker := time.NewTicker(s.checkInterval)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Println("[UpdateChecker] Update checker service stopped")
+				return
+			case <-ticker.C:
+				s.CheckAll(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the background update check loop
+func (s *UpdateCheckerService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// CheckAll checks every running or unhealthy deployment for image updates
+// Deployments are checked sequentially to stay well within registry rate limits
+func (s *UpdateCheckerService) CheckAll(ctx context.Context) {
+	var deployments []models.Deployment
+	if err := s.db.Preload("Device").Where("status IN ?", []models.DeploymentStatus{models.DeploymentStatusRunning, models.DeploymentStatusUnhealthy}).Find(&deployments).Error; err != nil {
+		log.Printf("[UpdateChecker] Error fetching deployments: %v", err)
+		return
+	}
+
+	for i := range deployments {
+		if ctx.Err() != nil {
+			return
+		}
+
+		deployment := &deployments[i]
+		if deployment.Device == nil {
+			continue
+		}
+
+		currentDigests, err := s.resolveDeviceDigests(deployment.Device, deployment.ComposeProject)
+		if err != nil {
+			log.Printf("[UpdateChecker] Failed to read image digests for %s: %v", deployment.ComposeProject, err)
+			continue
+		}
+
+		if _, err := s.ApplyCheck(deployment, currentDigests); err != nil {
+			log.Printf("[UpdateChecker] Update check failed for %s: %v", deployment.ComposeProject, err)
+		}
+	}
+}
+
+// ApplyCheck compares the given running digests with the registry, stores the result,
+// notifies subscribers of new updates and starts an upgrade for "automatic" recipes
+// unless one is already queued or running
+func (s *UpdateCheckerService) ApplyCheck(deployment *models.Deployment, currentDigests map[string]string) ([]models.ImageUpdateStatus, error) {
+	statuses := s.compareDigests(currentDigests)
+
+	updateAvailable := false
+	for _, status := range statuses {
+		if status.UpdateAvailable {
+			updateAvailable = true
+			break
+		}
+	}
+
+	alreadyNotified := deployment.UpdateAvailable
+	now := time.Now()
+	statusJSON, err := json.Marshal(statuses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update status: %w", err)
+	}
+
+	if err := s.db.Model(deployment).Updates(map[string]interface{}{
+		"update_available":  updateAvailable,
+		"update_checked_at": now,
+		"image_updates":     statusJSON,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to save update status: %w", err)
+	}
+	deployment.UpdateAvailable = updateAvailable
+	deployment.UpdateCheckedAt = &now
+	deployment.ImageUpdates = statusJSON
+
+	if !updateAvailable {
+		return statuses, nil
+	}
+
+	// Only notify when an update first appears, not on every check
+	if !alreadyNotified {
+		log.Printf("[UpdateChecker] Update available for %s", deployment.ComposeProject)
+		if s.wsHub != nil {
+			s.wsHub.Broadcast("deployments", "update_available", map[string]interface{}{
+				"id":     deployment.ID,
+				"name":   deployment.RecipeName,
+				"images": statuses,
+			})
+		}
+	}
+
+	// Automatic upgrades are retried on every check until one succeeds, so an upgrade that could not
+	// start (e.g. another job was queued) or that failed does not leave the deployment outdated
+	if s.isAutomatic(deployment.RecipeSlug) && s.upgrader != nil {
+		pending, err := s.hasPendingUpgrade(deployment)
+		if err != nil {
+			return statuses, err
+		}
+		if !pending {
+			log.Printf("[UpdateChecker] Starting automatic upgrade of %s", deployment.ComposeProject)
+			if _, err := s.upgrader.UpgradeDeployment(deployment.ID.String(), UpgradeDeploymentRequest{}); err != nil {
+				log.Printf("[UpdateChecker] Automatic upgrade of %s could not start: %v", deployment.ComposeProject, err)
+			}
+		}
+	}
+
+	return statuses, nil
+}
+
+// hasPendingUpgrade reports whether an upgrade of the deployment is already queued or running
+func (s *UpdateCheckerService) hasPendingUpgrade(deployment *models.Deployment) (bool, error) {
+	var count int64
+	if err := s.db.Model(&models.DeploymentJob{}).
+		Where("deployment_id = ? AND type = ? AND status IN ?", deployment.ID, models.DeploymentJobUpgrade, activeJobStatuses).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check upgrade jobs: %w", err)
+	}
+	return count > 0, nil
+}
+
+// compareDigests checks each running image against its registry digest
+// Images without a local repo digest (built locally or pinned) are reported but never flagged
+func (s *UpdateCheckerService) compareDigests(currentDigests map[string]string) []models.ImageUpdateStatus {
+	images := make([]string, 0, len(currentDigests))
+	for image := range currentDigests {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+
+	statuses := make([]models.ImageUpdateStatus, 0, len(images))
+	for _, image := range images {
+		status := models.ImageUpdateStatus{
+			Image:         image,
+			CurrentDigest: currentDigests[image],
+		}
+
+		if status.CurrentDigest == "" {
+			status.Error = "no registry digest recorded for local image"
+			statuses = append(statuses, status)
+			continue
+		}
+
+		latest, err := s.registry.GetManifestDigest(image)
+		if err != nil {
+			status.Error = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
+
+		status.LatestDigest = latest
+		status.UpdateAvailable = latest != status.CurrentDigest
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// resolveDeviceDigests returns image reference -> repo digest for a project's running containers
+func (s *UpdateCheckerService) resolveDeviceDigests(device *models.Device, project string) (map[string]string, error) {
+	if !isValidStackName(project) {
+		return nil, fmt.Errorf("invalid compose project: %s", project)
+	}
+
+	host := device.GetSSHHost()
+
+	// Image references as written in the compose file, e.g. "vaultwarden/server:latest"
+	listCmd := fmt.Sprintf("docker ps --filter label=com.docker.compose.project=%s --format '{{.Image}}' | sort -u", project)
+	output, err := s.sshClient.ExecuteWithTimeout(host, listCmd, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	digests := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		image := strings.TrimSpace(line)
+		if image == "" || !imageRefRegex.MatchString(image) {
+			continue
+		}
+
+		inspectCmd := fmt.Sprintf("docker image inspect --format '{{join .RepoDigests \" \"}}' %s", image)
+		repoDigests, err := s.sshClient.ExecuteWithTimeout(host, inspectCmd, 30*time.Second)
+		if err != nil {
+			digests[image] = ""
+			continue
+		}
+		digests[image] = matchRepoDigest(image, repoDigests)
+	}
+
+	return digests, nil
+}
+
+// isAutomatic reports whether a recipe opts in to automatic updates
+func (s *UpdateCheckerService) isAutomatic(slug string) bool {
+	if s.recipeLoader == nil {
+		return false
+	}
+	recipe, err := s.recipeLoader.GetRecipe(slug)
+	if err != nil {
+		return false
+	}
+	return recipe.Updates.Strategy == "automatic"
+}
+
+// matchRepoDigest picks the digest from "docker image inspect" RepoDigests that belongs to image
+// RepoDigests look like "vaultwarden/server@sha256:..." (Docker Hub names are not normalized)
+func matchRepoDigest(image string, repoDigests string) string {
+	want, err := ParseImageReference(image)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range strings.Fields(repoDigests) {
+		name, digest, found := strings.Cut(entry, "@")
+		if !found {
+			continue
+		}
+		have, err := ParseImageReference(name)
+		if err != nil {
+			continue
+		}
+		if have.Registry == want.Registry && have.Repository == want.Repository {
+			return digest
+		}
+	}
+	return ""
+}
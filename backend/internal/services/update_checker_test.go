@@ -0,0 +1,276 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jared-cannon/homelab-orchestration-platform/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeRegistry is a minimal Registry HTTP API v2 stand-in with bearer-token auth
+type fakeRegistry struct {
+	server  *httptest.Server
+	digests map[string]string // "repository:tag" -> digest
+	mu      sync.Mutex
+}
+
+func newFakeRegistry(t *testing.T, digests map[string]string) *fakeRegistry {
+	registry := &fakeRegistry{digests: digests}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "fake-registry" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token":"test-token"}`)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry",scope="repository:app:pull"`, registry.server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		// /v2/<repository>/manifests/<tag>
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		repository, tag, found := strings.Cut(path, "/manifests/")
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		registry.mu.Lock()
+		digest, ok := registry.digests[repository+":"+tag]
+		registry.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	registry.server = httptest.NewServer(mux)
+	t.Cleanup(registry.server.Close)
+	return registry
+}
+
+// host returns the registry's host:port for use in image references
+func (f *fakeRegistry) host() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+// mockUpgrader records upgrade requests and queues an upgrade job like DeploymentService does
+type mockUpgrader struct {
+	db       *gorm.DB
+	upgraded []string
+	err      error
+}
+
+func (m *mockUpgrader) UpgradeDeployment(id string, req UpgradeDeploymentRequest) (*models.Deployment, error) {
+	m.upgraded = append(m.upgraded, id)
+	if m.err != nil {
+		return nil, m.err
+	}
+	job := &models.DeploymentJob{DeploymentID: uuid.MustParse(id), DeviceID: uuid.New(), Type: models.DeploymentJobUpgrade, Status: models.DeploymentJobQueued}
+	if err := m.db.Create(job).Error; err != nil {
+		return nil, err
+	}
+	return &models.Deployment{}, nil
+}
+
+// recordingHub records WebSocket broadcasts
+type recordingHub struct {
+	events []string
+}
+
+func (h *recordingHub) Broadcast(channel string, event string, data interface{}) {
+	h.events = append(h.events, channel+":"+event)
+}
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image    string
+		expected ImageReference
+		wantErr  bool
+	}{
+		{image: "nginx", expected: ImageReference{Registry: "registry-1.docker.io", Repository: "library/nginx", Tag: "latest"}},
+		{image: "vaultwarden/server:1.32.0", expected: ImageReference{Registry: "registry-1.docker.io", Repository: "vaultwarden/server", Tag: "1.32.0"}},
+		{image: "ghcr.io/immich-app/immich-server:v1.94.1", expected: ImageReference{Registry: "ghcr.io", Repository: "immich-app/immich-server", Tag: "v1.94.1"}},
+		{image: "localhost:5000/app", expected: ImageReference{Registry: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{image: "192.168.1.50:5000/team/app:2", expected: ImageReference{Registry: "192.168.1.50:5000", Repository: "team/app", Tag: "2"}},
+		{image: "nginx@sha256:abc", wantErr: true},
+		{image: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			ref, err := ParseImageReference(tt.image)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ref)
+		})
+	}
+}
+
+func TestMatchRepoDigest(t *testing.T) {
+	repoDigests := "vaultwarden/server@sha256:aaa ghcr.io/other/server@sha256:bbb"
+
+	assert.Equal(t, "sha256:aaa", matchRepoDigest("vaultwarden/server:latest", repoDigests))
+	assert.Equal(t, "sha256:bbb", matchRepoDigest("ghcr.io/other/server:1", repoDigests))
+	assert.Equal(t, "", matchRepoDigest("nginx:latest", repoDigests))
+	assert.Equal(t, "sha256:ccc", matchRepoDigest("nginx", "nginx@sha256:ccc"), "official images match without library/ prefix")
+}
+
+func TestGetManifestDigest(t *testing.T) {
+	registry := newFakeRegistry(t, map[string]string{
+		"app:1.0":      "sha256:111",
+		"team/app:2.0": "sha256:222",
+	})
+
+	client := NewDockerRegistryClient(t.TempDir())
+	client.AddInsecureRegistry(registry.host())
+
+	digest, err := client.GetManifestDigest(registry.host() + "/app:1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:111", digest)
+
+	digest, err = client.GetManifestDigest(registry.host() + "/team/app:2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:222", digest)
+
+	_, err = client.GetManifestDigest(registry.host() + "/missing:1.0")
+	assert.Error(t, err)
+}
+
+func TestUpdateChecker_ApplyCheck(t *testing.T) {
+	db := setupTestDB(t)
+	registry := newFakeRegistry(t, map[string]string{
+		"app:latest":    "sha256:new",
+		"worker:latest": "sha256:same",
+	})
+
+	client := NewDockerRegistryClient(t.TempDir())
+	client.AddInsecureRegistry(registry.host())
+
+	recipes := NewMockRecipeLoader(map[string]*models.Recipe{
+		"auto-app":   {Slug: "auto-app", Updates: models.RecipeUpdateConfig{Strategy: "automatic"}},
+		"notify-app": {Slug: "notify-app", Updates: models.RecipeUpdateConfig{Strategy: "notify"}},
+	})
+	upgrader := &mockUpgrader{db: db}
+	hub := &recordingHub{}
+	checker := NewUpdateCheckerService(db, nil, client, upgrader, recipes, hub)
+
+	appImage := registry.host() + "/app:latest"
+	workerImage := registry.host() + "/worker:latest"
+
+	t.Run("automatic strategy upgrades once", func(t *testing.T) {
+		deployment := models.Deployment{RecipeSlug: "auto-app", ComposeProject: "auto-app-1", Status: models.DeploymentStatusRunning}
+		require.NoError(t, db.Create(&deployment).Error)
+
+		statuses, err := checker.ApplyCheck(&deployment, map[string]string{
+			appImage:    "sha256:old",
+			workerImage: "sha256:same",
+		})
+		require.NoError(t, err)
+		require.Len(t, statuses, 2)
+		assert.True(t, statuses[0].UpdateAvailable)
+		assert.Equal(t, "sha256:new", statuses[0].LatestDigest)
+		assert.False(t, statuses[1].UpdateAvailable)
+
+		var reloaded models.Deployment
+		require.NoError(t, db.First(&reloaded, "id = ?", deployment.ID).Error)
+		assert.True(t, reloaded.UpdateAvailable)
+		assert.NotNil(t, reloaded.UpdateCheckedAt)
+		assert.NotEmpty(t, reloaded.ImageUpdates)
+
+		assert.Equal(t, []string{deployment.ID.String()}, upgrader.upgraded)
+		assert.Equal(t, []string{"deployments:update_available"}, hub.events)
+
+		// A second check while the upgrade is queued does not notify or upgrade again
+		_, err = checker.ApplyCheck(&deployment, map[string]string{appImage: "sha256:old"})
+		require.NoError(t, err)
+		assert.Len(t, upgrader.upgraded, 1)
+		assert.Len(t, hub.events, 1)
+	})
+
+	t.Run("automatic upgrade is retried until it starts", func(t *testing.T) {
+		upgrader.upgraded = nil
+		hub.events = nil
+
+		deployment := models.Deployment{RecipeSlug: "auto-app", ComposeProject: "auto-app-2", Status: models.DeploymentStatusRunning}
+		require.NoError(t, db.Create(&deployment).Error)
+
+		// The deployment is busy when the update first appears
+		upgrader.err = errors.New("deployment already has a queued or running job")
+		_, err := checker.ApplyCheck(&deployment, map[string]string{appImage: "sha256:old"})
+		require.NoError(t, err)
+		assert.Len(t, upgrader.upgraded, 1)
+
+		// The next check retries without notifying again
+		upgrader.err = nil
+		_, err = checker.ApplyCheck(&deployment, map[string]string{appImage: "sha256:old"})
+		require.NoError(t, err)
+		assert.Len(t, upgrader.upgraded, 2)
+		assert.Equal(t, []string{"deployments:update_available"}, hub.events)
+
+		// An upgrade that failed leaves the update available, so it is tried again
+		require.NoError(t, db.Model(&models.DeploymentJob{}).Where("deployment_id = ?", deployment.ID).
+			Update("status", models.DeploymentJobFailed).Error)
+		_, err = checker.ApplyCheck(&deployment, map[string]string{appImage: "sha256:old"})
+		require.NoError(t, err)
+		assert.Len(t, upgrader.upgraded, 3)
+	})
+
+	t.Run("notify strategy does not upgrade", func(t *testing.T) {
+		upgrader.upgraded = nil
+		hub.events = nil
+
+		deployment := models.Deployment{RecipeSlug: "notify-app", ComposeProject: "notify-app-1", Status: models.DeploymentStatusRunning}
+		require.NoError(t, db.Create(&deployment).Error)
+
+		_, err := checker.ApplyCheck(&deployment, map[string]string{appImage: "sha256:old"})
+		require.NoError(t, err)
+		assert.Empty(t, upgrader.upgraded)
+		assert.Equal(t, []string{"deployments:update_available"}, hub.events)
+	})
+
+	t.Run("up to date and local images are not flagged", func(t *testing.T) {
+		hub.events = nil
+
+		deployment := models.Deployment{RecipeSlug: "notify-app", ComposeProject: "notify-app-2", Status: models.DeploymentStatusRunning}
+		require.NoError(t, db.Create(&deployment).Error)
+
+		statuses, err := checker.ApplyCheck(&deployment, map[string]string{
+			workerImage:     "sha256:same",
+			"local/app:dev": "",
+		})
+		require.NoError(t, err)
+		require.Len(t, statuses, 2)
+		for _, status := range statuses {
+			assert.False(t, status.UpdateAvailable)
+			if status.Image == "local/app:dev" {
+				assert.NotEmpty(t, status.Error, "local image without digest reports why it was skipped")
+			}
+		}
+		assert.False(t, deployment.UpdateAvailable)
+		assert.Empty(t, hub.events)
+	})
+}
@@ -1,6 +1,8 @@
 package ssh
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
@@ -11,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -460,6 +463,328 @@ func (c *Client) ExecuteWithTimeout(host string, command string, timeout time.Du
 	}
 }
 
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count.Add(int64(n))
+	return n, err
+}
+
+// syncBuffer is a bytes.Buffer that is safe to use as both stdout and stderr of a session
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Stream runs srcCommand on srcHost and pipes its stdout into dstCommand on dstHost
+// Data is relayed through this process, so the two hosts do not need SSH access to each other
+// Returns the number of bytes transferred
+func (c *Client) Stream(srcHost string, srcCommand string, dstHost string, dstCommand string, timeout time.Duration) (int64, error) {
+	srcClient, err := c.GetConnection(srcHost)
+	if err != nil {
+		return 0, err
+	}
+	dstClient, err := c.GetConnection(dstHost)
+	if err != nil {
+		return 0, err
+	}
+
+	srcSession, err := srcClient.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create source session: %w", err)
+	}
+	defer srcSession.Close()
+
+	dstSession, err := dstClient.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create destination session: %w", err)
+	}
+	defer dstSession.Close()
+
+	stdout, err := srcSession.StdoutPipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open source stdout: %w", err)
+	}
+	// The destination's stdout and stderr are copied concurrently into the same buffer
+	var srcStderr bytes.Buffer
+	var dstOutput syncBuffer
+	srcSession.Stderr = &srcStderr
+	reader := &countingReader{reader: stdout}
+	dstSession.Stdin = reader
+	dstSession.Stdout = &dstOutput
+	dstSession.Stderr = &dstOutput
+
+	if err := dstSession.Start(dstCommand); err != nil {
+		return 0, fmt.Errorf("failed to start destination command: %w", err)
+	}
+	if err := srcSession.Start(srcCommand); err != nil {
+		return 0, fmt.Errorf("failed to start source command: %w", err)
+	}
+
+	resultChan := make(chan error, 1)
+	go func() {
+		dstErr := dstSession.Wait()
+		if dstErr != nil {
+			// Nothing reads the source's output any more - close it so it cannot block
+			srcSession.Close()
+		}
+		srcErr := srcSession.Wait()
+
+		switch {
+		case srcErr != nil && dstErr == nil:
+			resultChan <- fmt.Errorf("source command failed: %w (output: %s)", srcErr, srcStderr.String())
+		case dstErr != nil:
+			resultChan <- fmt.Errorf("destination command failed: %w (output: %s)", dstErr, dstOutput.String())
+		default:
+			resultChan <- nil
+		}
+	}()
+
+	select {
+	case err := <-resultChan:
+		return reader.count.Load(), err
+	case <-time.After(timeout):
+		// Timeout occurred - close both sessions to kill the commands
+		srcSession.Close()
+		dstSession.Close()
+		return reader.count.Load(), fmt.Errorf("stream timed out after %v", timeout)
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	writer io.Writer
+	count  atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count.Add(int64(n))
+	return n, err
+}
+
+// ExecuteToWriter runs a command on the remote host and copies its stdout into w
+// Used for downloading large outputs (e.g. database dumps) without buffering them in memory
+// Returns the number of bytes written
+func (c *Client) ExecuteToWriter(host string, command string, w io.Writer, timeout time.Duration) (int64, error) {
+	client, err := c.GetConnection(host)
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	writer := &countingWriter{writer: w}
+	session.Stdout = writer
+	session.Stderr = &stderr
+
+	resultChan := make(chan error, 1)
+	go func() {
+		if err := session.Run(command); err != nil {
+			resultChan <- fmt.Errorf("command failed: %w (output: %s)", err, stderr.String())
+			return
+		}
+		resultChan <- nil
+	}()
+
+	select {
+	case err := <-resultChan:
+		return writer.count.Load(), err
+	case <-time.After(timeout):
+		// Timeout occurred - close session to kill the command
+		session.Close()
+		return writer.count.Load(), fmt.Errorf("command timed out after %v", timeout)
+	}
+}
+
+// ExecuteWithInput runs a command on the remote host with r as its stdin
+// Used for uploading large inputs (e.g. database dumps) without buffering them in memory
+// Returns the number of bytes read from r
+func (c *Client) ExecuteWithInput(host string, command string, r io.Reader, timeout time.Duration) (int64, error) {
+	client, err := c.GetConnection(host)
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	var output syncBuffer
+	reader := &countingReader{reader: r}
+	session.Stdin = reader
+	session.Stdout = &output
+	session.Stderr = &output
+
+	resultChan := make(chan error, 1)
+	go func() {
+		if err := session.Run(command); err != nil {
+			resultChan <- fmt.Errorf("command failed: %w (output: %s)", err, output.String())
+			return
+		}
+		resultChan <- nil
+	}()
+
+	select {
+	case err := <-resultChan:
+		return reader.count.Load(), err
+	case <-time.After(timeout):
+		// Timeout occurred - close session to kill the command
+		session.Close()
+		return reader.count.Load(), fmt.Errorf("command timed out after %v", timeout)
+	}
+}
+
+// ExecuteFollow runs a long-lived command (e.g. `docker compose logs -f`) on the remote host,
+// copying its output into w until the command exits or ctx is cancelled
+// The command runs under a pseudo-terminal so it receives SIGHUP when the session is closed,
+// rather than being left running on the host; stdout and stderr are therefore combined
+func (c *Client) ExecuteFollow(ctx context.Context, host string, command string, w io.Writer) error {
+	client, err := c.GetConnection(host)
+	if err != nil {
+		return err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:  0,
+		ssh.OPOST: 0, // Keep plain \n line endings
+	}
+	if err := session.RequestPty("dumb", 40, 512, modes); err != nil {
+		return fmt.Errorf("failed to request pty: %w", err)
+	}
+	session.Stdout = w
+
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	resultChan := make(chan error, 1)
+	go func() {
+		resultChan <- session.Wait()
+	}()
+
+	select {
+	case err := <-resultChan:
+		if err != nil {
+			return fmt.Errorf("command failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		// Closing the session hangs up the pty, which stops the remote command
+		session.Signal(ssh.SIGTERM)
+		session.Close()
+		<-resultChan
+		return ctx.Err()
+	}
+}
+
+// Shell is an interactive pseudo-terminal session on a remote host
+type Shell struct {
+	session *ssh.Session
+	Stdin   io.WriteCloser
+	Stdout  io.Reader // Combined stdout and stderr, as written to the terminal
+}
+
+// OpenShell starts an interactive session with a pseudo-terminal of the given size
+// An empty command opens the user's login shell
+func (c *Client) OpenShell(host string, command string, cols int, rows int) (*Shell, error) {
+	client, err := c.GetConnection(host)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm-256color", rows, cols, modes); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to request pty: %w", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open stdin: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open stdout: %w", err)
+	}
+
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start shell: %w", err)
+	}
+
+	return &Shell{session: session, Stdin: stdin, Stdout: stdout}, nil
+}
+
+// Resize changes the terminal size
+func (s *Shell) Resize(cols int, rows int) error {
+	return s.session.WindowChange(rows, cols)
+}
+
+// Wait blocks until the remote command exits and returns its exit code
+func (s *Shell) Wait() (int, error) {
+	err := s.session.Wait()
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// Close ends the session, hanging up the remote terminal
+func (s *Shell) Close() error {
+	return s.session.Close()
+}
+
 // CopyFile copies a file to the remote host
 func (c *Client) CopyFile(host string, remotePath string, content string) error {
 	client, err := c.GetConnection(host)
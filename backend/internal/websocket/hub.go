@@ -2,7 +2,9 @@ package websocket
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,8 +27,12 @@ type Client struct {
 	mu       sync.RWMutex
 	closed   bool      // Track if send channel is closed
 	done     chan bool // Signal when client is finished
+	username string    // Authenticated user, empty for anonymous connections
 }
 
+// SubscriptionListener is notified when the number of subscribers to a channel changes
+type SubscriptionListener func(channel string, subscribers int)
+
 // Hub maintains active WebSocket connections and broadcasts messages
 type Hub struct {
 	clients      map[*Client]bool
@@ -35,6 +41,12 @@ type Hub struct {
 	unregister   chan *Client
 	shutdownChan chan struct{}
 	mu           sync.RWMutex
+
+	// Subscriber counts per channel, for channels with a registered listener
+	subscribers map[string]int
+	listeners   map[string]SubscriptionListener // channel prefix -> listener
+	restricted  map[string]int                  // channel prefix -> max subscriptions per client
+	subMu       sync.Mutex
 }
 
 // NewHub creates a new WebSocket hub
@@ -45,6 +57,104 @@ func NewHub() *Hub {
 		register:     make(chan *Client),
 		unregister:   make(chan *Client),
 		shutdownChan: make(chan struct{}),
+		subscribers:  make(map[string]int),
+		listeners:    make(map[string]SubscriptionListener),
+		restricted:   make(map[string]int),
+	}
+}
+
+// OnSubscriptionChange registers a listener for subscriber count changes on channels starting with prefix
+// Used to run producers (e.g. log streams) only while someone is listening
+func (h *Hub) OnSubscriptionChange(prefix string, listener SubscriptionListener) {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+	h.listeners[prefix] = listener
+}
+
+// RestrictChannels limits channels starting with prefix to authenticated clients, each subscribed to at most
+// maxPerClient of them; used for channels carrying sensitive data or backed by expensive producers
+func (h *Hub) RestrictChannels(prefix string, maxPerClient int) {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+	h.restricted[prefix] = maxPerClient
+}
+
+// authorize checks whether a client may subscribe to a channel
+// Must be called with client.mu held
+func (h *Hub) authorize(client *Client, channel string) error {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	for prefix, limit := range h.restricted {
+		if !strings.HasPrefix(channel, prefix) {
+			continue
+		}
+		if client.username == "" {
+			return fmt.Errorf("authentication required")
+		}
+		count := 0
+		for subscribed := range client.channels {
+			if strings.HasPrefix(subscribed, prefix) {
+				count++
+			}
+		}
+		if count >= limit {
+			return fmt.Errorf("too many subscriptions (limit %d per connection)", limit)
+		}
+	}
+	return nil
+}
+
+// updateSubscribers adjusts a channel's subscriber count and notifies its listener
+func (h *Hub) updateSubscribers(channel string, delta int) {
+	h.subMu.Lock()
+	var listener SubscriptionListener
+	for prefix, l := range h.listeners {
+		if strings.HasPrefix(channel, prefix) {
+			listener = l
+			break
+		}
+	}
+	if listener == nil {
+		h.subMu.Unlock()
+		return
+	}
+
+	count := h.subscribers[channel] + delta
+	if count <= 0 {
+		count = 0
+		delete(h.subscribers, channel)
+	} else {
+		h.subscribers[channel] = count
+	}
+	h.subMu.Unlock()
+
+	// Listeners run on the hub's goroutines and must not block (e.g. by broadcasting)
+	listener(channel, count)
+}
+
+// removeClient closes a client's send channel and drops its subscriptions
+// Must be called with h.mu held
+func (h *Hub) removeClient(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+
+	// Safe close - check if already closed
+	client.mu.Lock()
+	var channels []string
+	if !client.closed {
+		close(client.send)
+		client.closed = true
+		for channel := range client.channels {
+			channels = append(channels, channel)
+		}
+	}
+	client.mu.Unlock()
+
+	for _, channel := range channels {
+		h.updateSubscribers(channel, -1)
 	}
 }
 
@@ -79,16 +189,7 @@ func (h *Hub) Run() {
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				// Safe close - check if already closed
-				client.mu.Lock()
-				if !client.closed {
-					close(client.send)
-					client.closed = true
-				}
-				client.mu.Unlock()
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
 			// Only log in production or when debugging
 			// log.Printf("WebSocket client disconnected (total: %d)", len(h.clients))
@@ -126,16 +227,7 @@ func (h *Hub) Run() {
 			if len(clientsToRemove) > 0 {
 				h.mu.Lock()
 				for _, client := range clientsToRemove {
-					if _, ok := h.clients[client]; ok {
-						delete(h.clients, client)
-						// Safe close - check if already closed
-						client.mu.Lock()
-						if !client.closed {
-							close(client.send)
-							client.closed = true
-						}
-						client.mu.Unlock()
-					}
+					h.removeClient(client)
 				}
 				h.mu.Unlock()
 			}
@@ -193,16 +285,29 @@ func (c *Client) readPump() {
 			continue
 		}
 
+		// Only count actual changes, and nothing once the hub has dropped this client
+		// Counts are updated under the client lock so they can't race with its removal
 		if msg.Action == "subscribe" {
 			c.mu.Lock()
 			for _, channel := range msg.Channels {
-				c.channels[channel] = true
+				if !c.closed && !c.channels[channel] {
+					if err := c.hub.authorize(c, channel); err != nil {
+						log.Printf("[WebSocket] Refused subscription to %s: %v", channel, err)
+						c.reject(channel, err)
+						continue
+					}
+					c.channels[channel] = true
+					c.hub.updateSubscribers(channel, 1)
+				}
 			}
 			c.mu.Unlock()
 		} else if msg.Action == "unsubscribe" {
 			c.mu.Lock()
 			for _, channel := range msg.Channels {
-				delete(c.channels, channel)
+				if !c.closed && c.channels[channel] {
+					delete(c.channels, channel)
+					c.hub.updateSubscribers(channel, -1)
+				}
 			}
 			c.mu.Unlock()
 		}
@@ -246,14 +351,34 @@ func (c *Client) writePump() {
 	}
 }
 
+// reject tells the client a subscription was refused
+// Must be called with c.mu held and the send channel open
+func (c *Client) reject(channel string, err error) {
+	data, marshalErr := json.Marshal(&Message{
+		Channel: channel,
+		Event:   "subscribe:error",
+		Data:    map[string]string{"error": err.Error()},
+	})
+	if marshalErr != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+	}
+}
+
 // NewClient creates a new WebSocket client
+// The user set by the auth middleware on the upgrade request, if any, is kept for channel authorization
 func NewClient(hub *Hub, conn *websocket.Conn) *Client {
+	username, _ := conn.Locals("username").(string)
 	return &Client{
 		hub:      hub,
 		conn:     conn,
 		send:     make(chan []byte, 256),
 		channels: make(map[string]bool),
 		done:     make(chan bool),
+		username: username,
 	}
 }
 